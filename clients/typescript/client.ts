@@ -0,0 +1,165 @@
+// Code generated by apigen from openapi.json. DO NOT EDIT.
+
+export interface ErrorResponse {
+  /** The human-readable message. */
+  error: string;
+  /** A stable identifier, e.g. LINK_NOT_FOUND. */
+  code: string;
+  fields?: FieldError[];
+}
+
+export interface FieldError {
+  field: string;
+  message: string;
+}
+
+export interface ShortenRequest {
+  /** The absolute http or https destination. */
+  url: string;
+  /** Creates a link that opens only once. */
+  single_use?: boolean;
+  /**
+   * Also redirects /{code}/{path...} to the destination with the path
+   * appended.
+   */
+  wildcard?: boolean;
+  /**
+   * The response of the CAPTCHA widget, required from anonymous clients when
+   * the server has CAPTCHA enabled.
+   */
+  captcha_token?: string;
+}
+
+export interface ShortenResponse {
+  short_code: string;
+  short_url: string;
+  /** The destination as stored. */
+  long_url: string;
+  /**
+   * The destination in its human-readable form, with an internationalized
+   * domain decoded from punycode.
+   */
+  original_url: string;
+  /** Flags destinations that look like homograph (look-alike) domains. */
+  warnings?: string[];
+}
+
+export interface TimeRule {
+  days?: string[];
+  from?: string;
+  to?: string;
+  time_zone?: string;
+  url: string;
+}
+
+export interface UpdateRequest {
+  new_url?: string;
+  headers?: Record<string, string> | null;
+  redirect_type?: number | null;
+  cache_control?: string | null;
+  language?: string | null;
+  /** An RFC 3339 timestamp; an empty string removes the expiry. */
+  expires_at?: string | null;
+  language_targets?: Record<string, string> | null;
+  pixel_ids?: number[] | null;
+  stats_visibility?: string | null;
+  single_use?: boolean | null;
+  /** ISO 3166-1 alpha-2 codes; an empty list removes the rule. */
+  allowed_countries?: string[] | null;
+  /** ISO 3166-1 alpha-2 codes; an empty list removes the rule. */
+  blocked_countries?: string[] | null;
+  /** Replaces the ordered time rules; an empty list removes them. */
+  time_rules?: TimeRule[] | null;
+  social_preview?: boolean | null;
+  query_passthrough?: string | null;
+  /**
+   * The click spike alert threshold; 0 restores the default and a negative
+   * factor turns the alerts off.
+   */
+  spike_factor?: number | null;
+  spike_min_clicks?: number | null;
+}
+
+export interface UpdateResponse {
+  message: string;
+  /** The new stats token, only ever shown in this response. */
+  stats_token?: string;
+}
+
+/**
+ * Thrown for a response with another status than the operation succeeds
+ * with. body is the decoded error response, when the server sent one.
+ */
+export class ApiError extends Error {
+  constructor(
+    readonly status: number,
+    readonly body?: ErrorResponse,
+  ) {
+    super(body ? `${status} ${body.code}: ${body.error}` : `unexpected status ${status}`);
+  }
+}
+
+export interface ClientOptions {
+  /** Replaces the global fetch, e.g. in tests. */
+  fetch?: typeof fetch;
+  /** Sent with every request, e.g. an Authorization header. */
+  headers?: Record<string, string>;
+}
+
+export class Client {
+  private readonly baseURL: string;
+
+  constructor(
+    baseURL: string,
+    private readonly options: ClientOptions = {},
+  ) {
+    this.baseURL = baseURL.replace(/\/+$/, "");
+  }
+
+  /** Deletes a link. */
+  async deleteLink(code: string): Promise<void> {
+    await this.request("DELETE", `/delete/${encodeURIComponent(code)}`, undefined, 204);
+  }
+
+  /**
+   * Creates a short link, or returns the existing link to the same
+   * destination.
+   */
+  async shorten(body: ShortenRequest): Promise<ShortenResponse> {
+    return (await this.request("POST", "/shorten", body, 201)) as ShortenResponse;
+  }
+
+  /**
+   * Changes the destination or settings of a link; fields left out stay as
+   * they are.
+   */
+  async updateLink(code: string, body: UpdateRequest): Promise<UpdateResponse> {
+    return (await this.request("PUT", `/update/${encodeURIComponent(code)}`, body, 200)) as UpdateResponse;
+  }
+
+  private async request(method: string, path: string, body: unknown, status: number): Promise<unknown> {
+    const doFetch = this.options.fetch ?? fetch;
+    const headers: Record<string, string> = { Accept: "application/json", ...this.options.headers };
+    if (body !== undefined) {
+      headers["Content-Type"] = "application/json";
+    }
+    const response = await doFetch(this.baseURL + path, {
+      method,
+      headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (response.status !== status) {
+      let error: ErrorResponse | undefined;
+      try {
+        error = (await response.json()) as ErrorResponse;
+      } catch {
+        error = undefined;
+      }
+      throw new ApiError(response.status, error);
+    }
+    if (response.status === 204) {
+      return undefined;
+    }
+    return response.json();
+  }
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"strings"
+)
+
+// generateGo renders the Go client: a type per component schema and a
+// Client method per operation.
+func generateGo(s *spec, ops []*operation, source, pkg string) ([]byte, error) {
+	errorType, err := errorTypeName(s, ops)
+	if err != nil {
+		return nil, err
+	}
+	imports := []string{"bytes", "context", "encoding/json", "fmt", "io", "net/http", "strings"}
+	for _, op := range ops {
+		if len(op.Parameters) > 0 {
+			imports = append(imports, "net/url")
+			break
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by apigen from %s. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	b.WriteString("import (\n")
+	for _, imp := range imports {
+		fmt.Fprintf(&b, "\t%q\n", imp)
+	}
+	b.WriteString(")\n\n")
+
+	for _, name := range s.schemaNames() {
+		sc := s.Components.Schemas[name]
+		if sc.Type != "object" {
+			return nil, fmt.Errorf("schema %s: only object schemas are supported", name)
+		}
+		writeGoComment(&b, "", sc.Description, name+" is the "+name+" schema.")
+		fmt.Fprintf(&b, "type %s struct {\n", name)
+		for _, p := range sc.Properties {
+			typ, err := goType(p.Schema)
+			if err != nil {
+				return nil, fmt.Errorf("schema %s, property %s: %w", name, p.Name, err)
+			}
+			tag := p.Name
+			switch {
+			case sc.required(p.Name):
+			case p.Schema.Nullable && (p.Schema.Type == "array" || p.Schema.Type == "object"):
+				// null leaves the value alone, an empty one clears it.
+			case p.Schema.Nullable:
+				typ = "*" + typ
+				tag += ",omitempty"
+			default:
+				tag += ",omitempty"
+			}
+			writeGoComment(&b, "\t", p.Schema.Description, "")
+			fmt.Fprintf(&b, "\t%s %s `json:%q`\n", exportedName(p.Name), typ, tag)
+		}
+		b.WriteString("}\n\n")
+	}
+
+	fmt.Fprintf(&b, goRuntime, errorType)
+
+	for _, op := range ops {
+		if err := writeGoOperation(&b, op); err != nil {
+			return nil, err
+		}
+	}
+
+	out, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return nil, fmt.Errorf("formatting Go client: %w", err)
+	}
+	return out, nil
+}
+
+func writeGoOperation(b *strings.Builder, op *operation) error {
+	name := exportedName(op.OperationID)
+	params := []string{"ctx context.Context"}
+	for _, p := range op.Parameters {
+		params = append(params, lowerCamel(p.Name)+" string")
+	}
+	body := "nil"
+	if req := op.requestSchema(); req != nil {
+		typ, err := goType(req)
+		if err != nil {
+			return fmt.Errorf("%s request: %w", op.OperationID, err)
+		}
+		params = append(params, "body "+typ)
+		body = "body"
+	}
+	status, resp := op.success()
+	if status == "" {
+		return fmt.Errorf("%s: no 2xx response", op.OperationID)
+	}
+
+	summary := op.Summary
+	if summary != "" {
+		summary = name + " " + strings.ToLower(summary[:1]) + summary[1:]
+	}
+	writeGoComment(b, "", summary, name+" calls "+op.Method+" "+op.Path+".")
+	fmt.Fprintf(b, "//\n// %s %s\n", op.Method, op.Path)
+
+	path := goPath(op.Path)
+	if resp == nil {
+		fmt.Fprintf(b, "func (c *Client) %s(%s) error {\n", name, strings.Join(params, ", "))
+		fmt.Fprintf(b, "\treturn c.do(ctx, %q, %s, %s, nil, %s)\n}\n\n", op.Method, path, body, status)
+		return nil
+	}
+	typ, err := goType(resp)
+	if err != nil {
+		return fmt.Errorf("%s response: %w", op.OperationID, err)
+	}
+	fmt.Fprintf(b, "func (c *Client) %s(%s) (*%s, error) {\n", name, strings.Join(params, ", "), typ)
+	fmt.Fprintf(b, "\tvar out %s\n", typ)
+	fmt.Fprintf(b, "\tif err := c.do(ctx, %q, %s, %s, &out, %s); err != nil {\n\t\treturn nil, err\n\t}\n", op.Method, path, body, status)
+	b.WriteString("\treturn &out, nil\n}\n\n")
+	return nil
+}
+
+// goPath is the Go expression building path, with its {parameters}
+// escaped.
+func goPath(path string) string {
+	var parts []string
+	for path != "" {
+		start := strings.Index(path, "{")
+		if start < 0 {
+			parts = append(parts, fmt.Sprintf("%q", path))
+			break
+		}
+		end := strings.Index(path[start:], "}") + start
+		if start > 0 {
+			parts = append(parts, fmt.Sprintf("%q", path[:start]))
+		}
+		parts = append(parts, "url.PathEscape("+lowerCamel(path[start+1:end])+")")
+		path = path[end+1:]
+	}
+	return strings.Join(parts, " + ")
+}
+
+func goType(s *schema) (string, error) {
+	if s.Ref != "" {
+		return s.refName(), nil
+	}
+	switch s.Type {
+	case "string":
+		return "string", nil
+	case "boolean":
+		return "bool", nil
+	case "number":
+		return "float64", nil
+	case "integer":
+		if s.Format == "int64" {
+			return "int64", nil
+		}
+		return "int", nil
+	case "array":
+		if s.Items == nil {
+			return "", fmt.Errorf("array without items")
+		}
+		item, err := goType(s.Items)
+		return "[]" + item, err
+	case "object":
+		if s.AdditionalProperties == nil {
+			return "", fmt.Errorf("inline objects must be maps (additionalProperties)")
+		}
+		value, err := goType(s.AdditionalProperties)
+		return "map[string]" + value, err
+	}
+	return "", fmt.Errorf("unsupported type %q", s.Type)
+}
+
+// writeGoComment writes text, or fallback when it is empty, as a comment.
+func writeGoComment(b *strings.Builder, indent, text, fallback string) {
+	if text == "" {
+		text = fallback
+	}
+	if text == "" {
+		return
+	}
+	for _, line := range wrap(text, 76-len(indent)) {
+		fmt.Fprintf(b, "%s// %s\n", indent, line)
+	}
+}
+
+// errorTypeName is the schema of the default responses, which must be the
+// same for every operation and have the error and code properties.
+func errorTypeName(s *spec, ops []*operation) (string, error) {
+	name := ""
+	for _, op := range ops {
+		sc := op.errorSchema()
+		if sc == nil || sc.Ref == "" {
+			return "", fmt.Errorf("%s: a default response with a schema reference is required", op.OperationID)
+		}
+		if name != "" && sc.refName() != name {
+			return "", fmt.Errorf("%s: default response %s differs from %s", op.OperationID, sc.refName(), name)
+		}
+		name = sc.refName()
+	}
+	if sc, ok := s.Components.Schemas[name]; name != "" && ok {
+		var props []string
+		for _, p := range sc.Properties {
+			props = append(props, p.Name)
+		}
+		if !containsString(props, "error") || !containsString(props, "code") {
+			return "", fmt.Errorf("error schema %s must have the error and code properties", name)
+		}
+	}
+	return name, nil
+}
+
+func wrap(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// goRuntime is the part of the Go client that does not depend on the spec;
+// %[1]s is the error response type.
+const goRuntime = `// Client calls the API at BaseURL. The zero HTTPClient is
+// http.DefaultClient.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Header is sent with every request, e.g. an Authorization header.
+	Header http.Header
+}
+
+// New returns a Client for the API at baseURL, e.g. https://go.example.com.
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Header: http.Header{}}
+}
+
+// Error is returned for a response with another status than the operation
+// succeeds with. Body is the decoded error response, zero when the server
+// did not send one.
+type Error struct {
+	Status int
+	Body   %[1]s
+}
+
+func (e *Error) Error() string {
+	if e.Body.Error != "" {
+		return fmt.Sprintf("%%d %%s: %%s", e.Status, e.Body.Code, e.Body.Error)
+	}
+	return fmt.Sprintf("unexpected status %%d", e.Status)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}, status int) error {
+	var reqBody io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.BaseURL, "/")+path, reqBody)
+	if err != nil {
+		return err
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != status {
+		apiErr := &Error{Status: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr.Body)
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %%s %%s response: %%w", method, path, err)
+	}
+	return nil
+}
+
+`
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// spec is the part of an OpenAPI 3 document the generators understand:
+// JSON request and response bodies described by component schemas, and
+// path parameters.
+type spec struct {
+	Info struct {
+		Title string `json:"title"`
+	} `json:"info"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Parameters map[string]*parameter `json:"parameters"`
+		Responses  map[string]*response  `json:"responses"`
+		Schemas    map[string]*schema    `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string       `json:"operationId"`
+	Summary     string       `json:"summary"`
+	Parameters  []*parameter `json:"parameters"`
+	RequestBody *struct {
+		Content map[string]mediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]*response `json:"responses"`
+
+	// Set by resolve.
+	Method string `json:"-"`
+	Path   string `json:"-"`
+}
+
+type parameter struct {
+	Ref         string  `json:"$ref"`
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Schema      *schema `json:"schema"`
+}
+
+type response struct {
+	Ref         string               `json:"$ref"`
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref                  string     `json:"$ref"`
+	Type                 string     `json:"type"`
+	Format               string     `json:"format"`
+	Description          string     `json:"description"`
+	Nullable             bool       `json:"nullable"`
+	Required             []string   `json:"required"`
+	Properties           properties `json:"properties"`
+	Items                *schema    `json:"items"`
+	AdditionalProperties *schema    `json:"additionalProperties"`
+}
+
+// properties keeps the order the spec lists them in, which encoding/json
+// loses for maps, so generated types read like the spec.
+type properties []property
+
+type property struct {
+	Name   string
+	Schema *schema
+}
+
+func (p *properties) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return fmt.Errorf("properties must be an object")
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var s schema
+		if err := dec.Decode(&s); err != nil {
+			return fmt.Errorf("property %v: %w", tok, err)
+		}
+		*p = append(*p, property{Name: tok.(string), Schema: &s})
+	}
+	return nil
+}
+
+const (
+	schemaRefPrefix    = "#/components/schemas/"
+	parameterRefPrefix = "#/components/parameters/"
+	responseRefPrefix  = "#/components/responses/"
+	contentTypeJSON    = "application/json"
+)
+
+var methodOrder = []string{"get", "post", "put", "patch", "delete"}
+
+// operations returns the operations of s ordered by path and method, with
+// parameter and response references resolved.
+func (s *spec) operations() ([]*operation, error) {
+	paths := make([]string, 0, len(s.Paths))
+	for path := range s.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var ops []*operation
+	for _, path := range paths {
+		for method := range s.Paths[path] {
+			if !containsString(methodOrder, method) {
+				return nil, fmt.Errorf("%s: unsupported method %q", path, method)
+			}
+		}
+		for _, method := range methodOrder {
+			op, ok := s.Paths[path][method]
+			if !ok {
+				continue
+			}
+			if op.OperationID == "" {
+				return nil, fmt.Errorf("%s %s: operationId is required", strings.ToUpper(method), path)
+			}
+			op.Method, op.Path = strings.ToUpper(method), path
+			for i, p := range op.Parameters {
+				if p.Ref == "" {
+					continue
+				}
+				resolved, ok := s.Components.Parameters[strings.TrimPrefix(p.Ref, parameterRefPrefix)]
+				if !ok {
+					return nil, fmt.Errorf("%s: unknown parameter %s", op.OperationID, p.Ref)
+				}
+				op.Parameters[i] = resolved
+			}
+			for _, p := range op.Parameters {
+				if p.In != "path" {
+					return nil, fmt.Errorf("%s: parameter %q: only path parameters are supported", op.OperationID, p.Name)
+				}
+			}
+			for status, r := range op.Responses {
+				if r.Ref == "" {
+					continue
+				}
+				resolved, ok := s.Components.Responses[strings.TrimPrefix(r.Ref, responseRefPrefix)]
+				if !ok {
+					return nil, fmt.Errorf("%s: unknown response %s", op.OperationID, r.Ref)
+				}
+				op.Responses[status] = resolved
+			}
+			ops = append(ops, op)
+		}
+	}
+	return ops, nil
+}
+
+// schemaNames returns the names of the component schemas in order.
+func (s *spec) schemaNames() []string {
+	names := make([]string, 0, len(s.Components.Schemas))
+	for name := range s.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// requestSchema is the JSON body schema of op, nil without a body.
+func (op *operation) requestSchema() *schema {
+	if op.RequestBody == nil {
+		return nil
+	}
+	return op.RequestBody.Content[contentTypeJSON].Schema
+}
+
+// success returns the 2xx status of op and the schema of its JSON body,
+// nil when the response has none.
+func (op *operation) success() (string, *schema) {
+	statuses := make([]string, 0, len(op.Responses))
+	for status := range op.Responses {
+		if strings.HasPrefix(status, "2") {
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Strings(statuses)
+	if len(statuses) == 0 {
+		return "", nil
+	}
+	return statuses[0], op.Responses[statuses[0]].Content[contentTypeJSON].Schema
+}
+
+// errorSchema is the schema of the default response of op.
+func (op *operation) errorSchema() *schema {
+	if r, ok := op.Responses["default"]; ok {
+		return r.Content[contentTypeJSON].Schema
+	}
+	return nil
+}
+
+func (s *schema) refName() string {
+	return strings.TrimPrefix(s.Ref, schemaRefPrefix)
+}
+
+func (s *schema) required(name string) bool {
+	return containsString(s.Required, name)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// initialisms are written in capitals in Go identifiers.
+var initialisms = map[string]string{"id": "ID", "ids": "IDs", "url": "URL", "http": "HTTP", "api": "API"}
+
+// exportedName turns a snake_case or camelCase name into a Go identifier,
+// e.g. pixel_ids into PixelIDs and updateLink into UpdateLink.
+func exportedName(name string) string {
+	var words []string
+	for _, part := range strings.Split(name, "_") {
+		start := 0
+		for i := 1; i < len(part); i++ {
+			if part[i] >= 'A' && part[i] <= 'Z' {
+				words = append(words, part[start:i])
+				start = i
+			}
+		}
+		words = append(words, part[start:])
+	}
+	var b strings.Builder
+	for _, w := range words {
+		if w == "" {
+			continue
+		}
+		if initialism, ok := initialisms[strings.ToLower(w)]; ok {
+			b.WriteString(initialism)
+			continue
+		}
+		b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+	return b.String()
+}
+
+// lowerCamel turns a snake_case name into a camelCase one.
+func lowerCamel(name string) string {
+	exported := exportedName(name)
+	if initialism, ok := initialisms[strings.ToLower(name)]; ok && initialism == exported {
+		return strings.ToLower(exported)
+	}
+	return strings.ToLower(exported[:1]) + exported[1:]
+}
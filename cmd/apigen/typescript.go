@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// generateTypeScript renders the TypeScript client: an interface per
+// component schema and a Client method per operation, on top of fetch.
+func generateTypeScript(s *spec, ops []*operation, source string) ([]byte, error) {
+	errorType, err := errorTypeName(s, ops)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by apigen from %s. DO NOT EDIT.\n\n", source)
+
+	for _, name := range s.schemaNames() {
+		sc := s.Components.Schemas[name]
+		writeTSComment(&b, "", sc.Description)
+		fmt.Fprintf(&b, "export interface %s {\n", name)
+		for _, p := range sc.Properties {
+			typ, err := tsType(p.Schema)
+			if err != nil {
+				return nil, fmt.Errorf("schema %s, property %s: %w", name, p.Name, err)
+			}
+			if p.Schema.Nullable {
+				typ += " | null"
+			}
+			optional := "?"
+			if sc.required(p.Name) {
+				optional = ""
+			}
+			writeTSComment(&b, "  ", p.Schema.Description)
+			fmt.Fprintf(&b, "  %s%s: %s;\n", p.Name, optional, typ)
+		}
+		b.WriteString("}\n\n")
+	}
+
+	fmt.Fprintf(&b, tsRuntimeHead, errorType)
+	for _, op := range ops {
+		if err := writeTSOperation(&b, op); err != nil {
+			return nil, err
+		}
+	}
+	fmt.Fprintf(&b, tsRuntimeTail, errorType)
+	return []byte(b.String()), nil
+}
+
+func writeTSOperation(b *strings.Builder, op *operation) error {
+	var params []string
+	for _, p := range op.Parameters {
+		params = append(params, lowerCamel(p.Name)+": string")
+	}
+	body := "undefined"
+	if req := op.requestSchema(); req != nil {
+		typ, err := tsType(req)
+		if err != nil {
+			return fmt.Errorf("%s request: %w", op.OperationID, err)
+		}
+		params = append(params, "body: "+typ)
+		body = "body"
+	}
+	status, resp := op.success()
+	if status == "" {
+		return fmt.Errorf("%s: no 2xx response", op.OperationID)
+	}
+	result := "void"
+	if resp != nil {
+		typ, err := tsType(resp)
+		if err != nil {
+			return fmt.Errorf("%s response: %w", op.OperationID, err)
+		}
+		result = typ
+	}
+
+	b.WriteString("\n")
+	summary := op.Summary
+	if summary == "" {
+		summary = op.Method + " " + op.Path
+	}
+	writeTSComment(b, "  ", summary)
+	fmt.Fprintf(b, "  async %s(%s): Promise<%s> {\n", op.OperationID, strings.Join(params, ", "), result)
+	call := fmt.Sprintf("this.request(%q, %s, %s, %s)", op.Method, tsPath(op.Path), body, status)
+	if resp == nil {
+		fmt.Fprintf(b, "    await %s;\n  }\n", call)
+	} else {
+		fmt.Fprintf(b, "    return (await %s) as %s;\n  }\n", call, result)
+	}
+	return nil
+}
+
+// tsPath is the TypeScript expression building path, with its
+// {parameters} escaped.
+func tsPath(path string) string {
+	if !strings.Contains(path, "{") {
+		return fmt.Sprintf("%q", path)
+	}
+	var b strings.Builder
+	b.WriteString("`")
+	for path != "" {
+		start := strings.Index(path, "{")
+		if start < 0 {
+			b.WriteString(path)
+			break
+		}
+		end := strings.Index(path[start:], "}") + start
+		b.WriteString(path[:start])
+		b.WriteString("${encodeURIComponent(" + lowerCamel(path[start+1:end]) + ")}")
+		path = path[end+1:]
+	}
+	b.WriteString("`")
+	return b.String()
+}
+
+func tsType(s *schema) (string, error) {
+	if s.Ref != "" {
+		return s.refName(), nil
+	}
+	switch s.Type {
+	case "string", "boolean":
+		return s.Type, nil
+	case "number", "integer":
+		return "number", nil
+	case "array":
+		if s.Items == nil {
+			return "", fmt.Errorf("array without items")
+		}
+		item, err := tsType(s.Items)
+		return item + "[]", err
+	case "object":
+		if s.AdditionalProperties == nil {
+			return "", fmt.Errorf("inline objects must be maps (additionalProperties)")
+		}
+		value, err := tsType(s.AdditionalProperties)
+		return "Record<string, " + value + ">", err
+	}
+	return "", fmt.Errorf("unsupported type %q", s.Type)
+}
+
+func writeTSComment(b *strings.Builder, indent, text string) {
+	if text == "" {
+		return
+	}
+	lines := wrap(text, 74-len(indent))
+	if len(lines) == 1 {
+		fmt.Fprintf(b, "%s/** %s */\n", indent, lines[0])
+		return
+	}
+	fmt.Fprintf(b, "%s/**\n", indent)
+	for _, line := range lines {
+		fmt.Fprintf(b, "%s * %s\n", indent, line)
+	}
+	fmt.Fprintf(b, "%s */\n", indent)
+}
+
+// tsRuntimeHead and tsRuntimeTail surround the operation methods; %[1]s is
+// the error response type.
+const tsRuntimeHead = `/**
+ * Thrown for a response with another status than the operation succeeds
+ * with. body is the decoded error response, when the server sent one.
+ */
+export class ApiError extends Error {
+  constructor(
+    readonly status: number,
+    readonly body?: %[1]s,
+  ) {
+    super(body ? ` + "`${status} ${body.code}: ${body.error}`" + ` : ` + "`unexpected status ${status}`" + `);
+  }
+}
+
+export interface ClientOptions {
+  /** Replaces the global fetch, e.g. in tests. */
+  fetch?: typeof fetch;
+  /** Sent with every request, e.g. an Authorization header. */
+  headers?: Record<string, string>;
+}
+
+export class Client {
+  private readonly baseURL: string;
+
+  constructor(
+    baseURL: string,
+    private readonly options: ClientOptions = {},
+  ) {
+    this.baseURL = baseURL.replace(/\/+$/, "");
+  }
+`
+
+const tsRuntimeTail = `
+  private async request(method: string, path: string, body: unknown, status: number): Promise<unknown> {
+    const doFetch = this.options.fetch ?? fetch;
+    const headers: Record<string, string> = { Accept: "application/json", ...this.options.headers };
+    if (body !== undefined) {
+      headers["Content-Type"] = "application/json";
+    }
+    const response = await doFetch(this.baseURL + path, {
+      method,
+      headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (response.status !== status) {
+      let error: %[1]s | undefined;
+      try {
+        error = (await response.json()) as %[1]s;
+      } catch {
+        error = undefined;
+      }
+      throw new ApiError(response.status, error);
+    }
+    if (response.status === 204) {
+      return undefined;
+    }
+    return response.json();
+  }
+}
+`
@@ -0,0 +1,292 @@
+// Command backfill brings features enabled on an existing dataset up to
+// date with its history. It can run while the server is serving.
+//
+// With -events it replays the links and clicks already in the database to
+// the webhooks subscribed to link.created and click.created, oldest first,
+// with the payloads the server sends for new ones. With -rollups it empties
+// the stats rollup tables and recomputes them from the raw links and
+// clicks, e.g. after they drifted or were lost.
+//
+// Progress is saved to the -checkpoint file after every batch, so an
+// interrupted or failed run continues where it stopped when run again.
+// Delete the file to start over.
+//
+// Usage:
+//
+//	backfill -events link.created,click.created
+//	backfill -rollups
+//
+// Backfill reads the server's environment (DB_PATH, DB_SHARD_PATHS,
+// SHORT_CODE_CASE, the encryption keys and the OUTBOUND_* settings).
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"template/internal/config"
+	"template/internal/pkg/metrics"
+	"template/internal/pkg/outbound"
+	"template/internal/repositories"
+	"template/internal/services"
+)
+
+// rollupsKey is the checkpoint entry of a rollup rebuild in progress.
+const rollupsKey = "rollups"
+
+func main() {
+	events := flag.String("events", "", "events to replay to their webhooks, separated by commas: link.created, click.created")
+	rollups := flag.Bool("rollups", false, "recompute the stats rollups from the raw links and clicks")
+	checkpointPath := flag.String("checkpoint", "backfill.checkpoint.json", "file the progress is saved to and resumed from")
+	batch := flag.Int("batch", 500, "rows read per batch")
+	flag.Parse()
+
+	if *batch <= 0 {
+		log.Fatal("-batch must be positive")
+	}
+	if *events == "" && !*rollups {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	cipher, err := cfg.Encryption.Cipher()
+	if err != nil {
+		log.Fatalf("Failed to configure encryption: %v", err)
+	}
+	db, err := repositories.ConnectDB(cfg.DBPath)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	cp, err := loadCheckpoint(*checkpointPath)
+	if err != nil {
+		log.Fatalf("Failed to load checkpoint: %v", err)
+	}
+
+	if *events != "" {
+		linkDBs := []string{cfg.DBPath}
+		if len(cfg.DBShardPaths) > 0 {
+			linkDBs = cfg.DBShardPaths
+		}
+		links, shardDBs, err := repositories.OpenSQLiteShortenerRepo(linkDBs, repositories.ConnectDB, cfg.CodeCase == config.CodeCaseInsensitive, cipher)
+		if err != nil {
+			log.Fatalf("Failed to open links: %v", err)
+		}
+		defer func() {
+			for _, shardDB := range shardDBs {
+				shardDB.Close()
+			}
+		}()
+		if err := links.InitSchema(); err != nil {
+			log.Fatalf("Failed to initialize links schema: %v", err)
+		}
+		linkLister, err := repositories.ListLinks(links)
+		if err != nil {
+			log.Fatalf("Failed to open links: %v", err)
+		}
+		clicks := repositories.NewSQLiteClickRepo(db)
+		if err := clicks.InitSchema(); err != nil {
+			log.Fatalf("Failed to initialize clicks schema: %v", err)
+		}
+		hookRepo := repositories.NewSQLiteHookRepo(db)
+		if err := hookRepo.InitSchema(); err != nil {
+			log.Fatalf("Failed to initialize hooks schema: %v", err)
+		}
+		client := outbound.New(outbound.Options{
+			Timeout:         cfg.Outbound.Timeout,
+			MaxRedirects:    cfg.Outbound.MaxRedirects,
+			MaxBodyBytes:    cfg.Outbound.MaxBodyBytes,
+			UserAgent:       "url-shortener (+" + cfg.BaseURL + ")",
+			AllowPrivate:    cfg.Outbound.AllowPrivate,
+			AllowedNetworks: cfg.Outbound.AllowedNetworks,
+		}, metrics.NewRegistry(nil))
+		hooks := services.NewHookService(hookRepo, links, client, nil)
+
+		for _, event := range strings.Split(*events, ",") {
+			event = strings.TrimSpace(event)
+			var list func(afterID int64) ([]record, error)
+			switch event {
+			case services.EventLinkCreated:
+				list = func(afterID int64) ([]record, error) {
+					mappings, err := linkLister.ListSince(afterID, *batch)
+					records := make([]record, len(mappings))
+					for i, m := range mappings {
+						records[i] = record{id: m.ID, payload: m}
+					}
+					return records, err
+				}
+			case services.EventClickCreated:
+				list = func(afterID int64) ([]record, error) {
+					found, err := clicks.ListSince(afterID, *batch)
+					records := make([]record, len(found))
+					for i, c := range found {
+						records[i] = record{id: c.ID, payload: c}
+					}
+					return records, err
+				}
+			default:
+				log.Fatalf("Cannot replay event '%s': only %s and %s are backfilled", event, services.EventLinkCreated, services.EventClickCreated)
+			}
+			if err := replay(hooks, event, list, cp); err != nil {
+				log.Fatalf("Replaying %s failed: %v. Run backfill again to continue from the checkpoint.", event, err)
+			}
+		}
+	}
+
+	if *rollups {
+		stats := repositories.NewSQLiteStatsRepo(db)
+		if cipher != nil {
+			stats.EnableEncryption(cipher)
+		}
+		if err := stats.InitSchema(); err != nil {
+			log.Fatalf("Failed to initialize stats schema: %v", err)
+		}
+		if err := rebuildRollups(stats, *batch, cp); err != nil {
+			log.Fatalf("Rebuilding rollups failed: %v. Run backfill again to continue from the checkpoint.", err)
+		}
+	}
+}
+
+// record is a row replayed as the payload of an event.
+type record struct {
+	id      int64
+	payload interface{}
+}
+
+// replay sends event for every record list returns after the checkpoint,
+// batch by batch in ID order, and saves the checkpoint after each batch.
+// Records are delivered one at a time, so a failure stops the run on the
+// record that failed and nothing after it is sent.
+func replay(hooks services.HookService, event string, list func(afterID int64) ([]record, error), cp *checkpoint) error {
+	afterID := cp.Positions[event]
+	if afterID > 0 {
+		log.Printf("Resuming %s after id %d", event, afterID)
+	}
+	replayed := 0
+	start := time.Now()
+	for {
+		records, err := list(afterID)
+		if err != nil {
+			return fmt.Errorf("listing after id %d: %w", afterID, err)
+		}
+		if len(records) == 0 {
+			break
+		}
+		for _, r := range records {
+			if err := hooks.Replay(event, r.payload); err != nil {
+				if saveErr := cp.save(event, afterID); saveErr != nil {
+					log.Printf("Failed to save checkpoint: %v", saveErr)
+				}
+				return fmt.Errorf("id %d: %w", r.id, err)
+			}
+			afterID = r.id
+			replayed++
+		}
+		if err := cp.save(event, afterID); err != nil {
+			return fmt.Errorf("saving checkpoint: %w", err)
+		}
+		log.Printf("%s: %d replayed, up to id %d (%s)", event, replayed, afterID, time.Since(start).Round(time.Millisecond))
+	}
+	log.Printf("Done: %d %s event(s) replayed", replayed, event)
+	return nil
+}
+
+// rebuildRollups empties the rollup tables, unless the checkpoint shows a
+// rebuild already under way, and folds every link and click in again. The
+// rollups keep their own watermarks, so the checkpoint only counts rows.
+func rebuildRollups(stats *repositories.SQLiteStatsRepo, batch int, cp *checkpoint) error {
+	folded, resuming := cp.Positions[rollupsKey]
+	if resuming {
+		log.Printf("Resuming the rollup rebuild after %d row(s)", folded)
+	} else {
+		if err := stats.ResetRollups(); err != nil {
+			return fmt.Errorf("resetting rollups: %w", err)
+		}
+		if err := cp.save(rollupsKey, 0); err != nil {
+			return fmt.Errorf("saving checkpoint: %w", err)
+		}
+		log.Println("Rollups reset; the admin overview counts partially until the rebuild is done")
+	}
+	start := time.Now()
+	for {
+		n, err := stats.Rollup(batch)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		folded += int64(n)
+		if err := cp.save(rollupsKey, folded); err != nil {
+			return fmt.Errorf("saving checkpoint: %w", err)
+		}
+		log.Printf("Rollups: %d row(s) folded in (%s)", folded, time.Since(start).Round(time.Millisecond))
+	}
+	if err := cp.clear(rollupsKey); err != nil {
+		return fmt.Errorf("saving checkpoint: %w", err)
+	}
+	log.Printf("Done: rollups rebuilt from %d row(s)", folded)
+	return nil
+}
+
+// checkpoint is the progress of backfill runs, kept in a JSON file: the
+// last replayed ID per event, and the rows folded into a rollup rebuild in
+// progress.
+type checkpoint struct {
+	path      string
+	Positions map[string]int64 `json:"positions"`
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	cp := &checkpoint{path: path, Positions: map[string]int64{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cp.Positions == nil {
+		cp.Positions = map[string]int64{}
+	}
+	return cp, nil
+}
+
+func (cp *checkpoint) save(key string, value int64) error {
+	cp.Positions[key] = value
+	return cp.write()
+}
+
+func (cp *checkpoint) clear(key string) error {
+	delete(cp.Positions, key)
+	return cp.write()
+}
+
+// write replaces the file through a rename, so an interruption never
+// leaves it half written.
+func (cp *checkpoint) write() error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := cp.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cp.path)
+}
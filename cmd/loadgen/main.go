@@ -0,0 +1,327 @@
+// Command loadgen drives a running shortener with a mix of link creations
+// (POST /shorten) and redirects (GET /{code}) and reports, per operation,
+// the throughput, the status codes and the latency percentiles.
+//
+//	go run ./cmd/loadgen -target http://localhost:8080 -duration 30s -concurrency 32 -mix create=1,redirect=9
+//
+// Redirects pick a random code among the links created before the run
+// (-seed of them) and during it; they are not followed. Every created link
+// gets a new destination, so creations always insert a row instead of
+// returning an existing code. It exits with status 1 if any request failed
+// (a transport error or a 4xx/5xx response). Run it against a test
+// instance: the links it creates are not deleted.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"template/internal/pkg/latency"
+)
+
+const (
+	opCreate   = "create"
+	opRedirect = "redirect"
+)
+
+type config struct {
+	target      string
+	duration    time.Duration
+	requests    int64
+	concurrency int
+	mix         map[string]int
+	seed        int
+	rate        int
+	destination string
+	timeout     time.Duration
+}
+
+func main() {
+	var cfg config
+	var mix string
+	flag.StringVar(&cfg.target, "target", "http://localhost:8080", "address of the instance under test")
+	flag.DurationVar(&cfg.duration, "duration", 30*time.Second, "how long to run")
+	flag.Int64Var(&cfg.requests, "requests", 0, "stop after this many requests (0: run for -duration)")
+	flag.IntVar(&cfg.concurrency, "concurrency", 16, "concurrent clients")
+	flag.StringVar(&mix, "mix", "create=1,redirect=9", "relative weights of the operations")
+	flag.IntVar(&cfg.seed, "seed", 100, "links created before the run for redirects to use")
+	flag.IntVar(&cfg.rate, "rate", 0, "maximum requests per second across all clients (0: unlimited)")
+	flag.StringVar(&cfg.destination, "destination", "https://example.com/loadgen", "prefix of the destinations of created links")
+	flag.DurationVar(&cfg.timeout, "timeout", 10*time.Second, "timeout of a single request")
+	flag.Parse()
+
+	var err error
+	if cfg.mix, err = parseMix(mix); err != nil {
+		log.Fatalf("Invalid -mix: %v", err)
+	}
+	if cfg.concurrency <= 0 {
+		log.Fatal("-concurrency must be positive")
+	}
+	if cfg.mix[opRedirect] > 0 && cfg.seed <= 0 && cfg.mix[opCreate] == 0 {
+		log.Fatal("redirects need links: set -seed or give create a weight")
+	}
+	cfg.target = strings.TrimSuffix(cfg.target, "/")
+
+	g := newGenerator(cfg)
+	log.Printf("Creating %d seed links on %s...", cfg.seed, cfg.target)
+	for i := 0; i < cfg.seed; i++ {
+		if _, err := g.create(); err != nil {
+			log.Fatalf("Failed to create seed link: %v", err)
+		}
+	}
+	g.reset()
+
+	log.Printf("Running %d clients for %s (mix %s)...", cfg.concurrency, describeRun(cfg), mix)
+	elapsed := g.run()
+	g.report(os.Stdout, elapsed)
+	if g.failed() {
+		os.Exit(1)
+	}
+}
+
+// parseMix reads weights like "create=1,redirect=9".
+func parseMix(s string) (map[string]int, error) {
+	mix := map[string]int{}
+	total := 0
+	for _, part := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not op=weight", part)
+		}
+		if name != opCreate && name != opRedirect {
+			return nil, fmt.Errorf("unknown operation %q (want %s or %s)", name, opCreate, opRedirect)
+		}
+		weight, err := strconv.Atoi(value)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q for %s", value, name)
+		}
+		mix[name] = weight
+		total += weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("no operation has a weight")
+	}
+	return mix, nil
+}
+
+func describeRun(cfg config) string {
+	if cfg.requests > 0 {
+		return fmt.Sprintf("%d requests", cfg.requests)
+	}
+	return cfg.duration.String()
+}
+
+// opStats are the results of one operation.
+type opStats struct {
+	latency  latency.Recorder
+	mu       sync.Mutex
+	statuses map[string]int
+	errors   int
+}
+
+func (s *opStats) add(status string, d time.Duration, failed bool) {
+	s.latency.Record(d)
+	s.mu.Lock()
+	s.statuses[status]++
+	if failed {
+		s.errors++
+	}
+	s.mu.Unlock()
+}
+
+type generator struct {
+	cfg    config
+	client *http.Client
+	ops    map[string]*opStats
+	sent   atomic.Int64
+	next   atomic.Int64
+	runID  string
+
+	mu    sync.RWMutex
+	codes []string
+}
+
+func newGenerator(cfg config) *generator {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = cfg.concurrency
+	return &generator{
+		cfg: cfg,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		ops: map[string]*opStats{
+			opCreate:   {statuses: map[string]int{}},
+			opRedirect: {statuses: map[string]int{}},
+		},
+		runID: strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+}
+
+// reset drops the results of the seed links.
+func (g *generator) reset() {
+	for _, s := range g.ops {
+		s.latency.Reset()
+		s.statuses = map[string]int{}
+		s.errors = 0
+	}
+}
+
+// run starts the clients and returns once the duration or the request
+// budget is used up.
+func (g *generator) run() time.Duration {
+	deadline := time.Now().Add(g.cfg.duration)
+	var tick <-chan time.Time
+	if g.cfg.rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(g.cfg.rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < g.cfg.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if g.cfg.requests > 0 {
+					if g.sent.Add(1) > g.cfg.requests {
+						return
+					}
+				} else if time.Now().After(deadline) {
+					return
+				}
+				if tick != nil {
+					<-tick
+				}
+				g.do(g.pick())
+			}
+		}()
+	}
+	wg.Wait()
+	return time.Since(start)
+}
+
+func (g *generator) pick() string {
+	n := rand.IntN(g.cfg.mix[opCreate] + g.cfg.mix[opRedirect])
+	if n < g.cfg.mix[opCreate] {
+		return opCreate
+	}
+	return opRedirect
+}
+
+func (g *generator) do(op string) {
+	if op == opCreate {
+		g.create()
+	} else {
+		g.redirect()
+	}
+}
+
+// create shortens a new destination and keeps the code for redirects.
+func (g *generator) create() (string, error) {
+	destination := fmt.Sprintf("%s/%s/%d", g.cfg.destination, g.runID, g.next.Add(1))
+	body, _ := json.Marshal(map[string]string{"url": destination})
+
+	start := time.Now()
+	resp, err := g.client.Post(g.cfg.target+"/shorten", "application/json", bytes.NewReader(body))
+	if err != nil {
+		g.ops[opCreate].add("error", time.Since(start), true)
+		return "", err
+	}
+	var created struct {
+		ShortURL string `json:"short_url"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	elapsed := time.Since(start)
+
+	if resp.StatusCode != http.StatusCreated || decodeErr != nil || created.ShortURL == "" {
+		g.ops[opCreate].add(strconv.Itoa(resp.StatusCode), elapsed, true)
+		return "", fmt.Errorf("POST /shorten returned %s", resp.Status)
+	}
+	g.ops[opCreate].add(strconv.Itoa(resp.StatusCode), elapsed, false)
+
+	code := created.ShortURL[strings.LastIndex(created.ShortURL, "/")+1:]
+	g.mu.Lock()
+	g.codes = append(g.codes, code)
+	g.mu.Unlock()
+	return code, nil
+}
+
+// redirect opens a random known code without following the redirect.
+func (g *generator) redirect() {
+	g.mu.RLock()
+	if len(g.codes) == 0 {
+		g.mu.RUnlock()
+		g.create()
+		return
+	}
+	code := g.codes[rand.IntN(len(g.codes))]
+	g.mu.RUnlock()
+
+	start := time.Now()
+	resp, err := g.client.Get(g.cfg.target + "/" + code)
+	if err != nil {
+		g.ops[opRedirect].add("error", time.Since(start), true)
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	failed := resp.StatusCode >= http.StatusBadRequest
+	g.ops[opRedirect].add(strconv.Itoa(resp.StatusCode), time.Since(start), failed)
+}
+
+func (g *generator) failed() bool {
+	for _, s := range g.ops {
+		if s.errors > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) report(w io.Writer, elapsed time.Duration) {
+	total := 0
+	for _, op := range []string{opCreate, opRedirect} {
+		s := g.ops[op]
+		summary := s.latency.Summary()
+		if summary.Count == 0 {
+			continue
+		}
+		total += summary.Count
+		fmt.Fprintf(w, "%-8s %8.1f req/s  errors=%d  statuses=%s\n", op, summary.Throughput(elapsed), s.errors, formatStatuses(s.statuses))
+		fmt.Fprintf(w, "         %s\n", summary)
+	}
+	fmt.Fprintf(w, "total    %8.1f req/s  %d requests in %s\n", float64(total)/elapsed.Seconds(), total, elapsed.Round(time.Millisecond))
+}
+
+func formatStatuses(statuses map[string]int) string {
+	keys := make([]string, 0, len(statuses))
+	for status := range statuses {
+		keys = append(keys, status)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, status := range keys {
+		parts[i] = fmt.Sprintf("%s:%d", status, statuses[status])
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,301 @@
+// Command migrate copies links, and optionally clicks, from one storage
+// layout to another: from a single SQLite file to shards, between shard
+// sets, or to a new file. It can be run while the server keeps serving
+// from the source. A zero-downtime cutover is:
+//
+//  1. start the server with DB_DUAL_WRITE_PATHS set to the destination, so
+//     every change is mirrored there from now on;
+//  2. run migrate to copy the existing links; a rerun copies what is still
+//     missing and corrects links that changed during the copy;
+//  3. run migrate -verify until it reports no differences;
+//  4. restart the server on the destination (DB_PATH or DB_SHARD_PATHS)
+//     without DB_DUAL_WRITE_PATHS.
+//
+// Usage:
+//
+//	migrate -from ./data/shortener.db -to ./data/s0.db,./data/s1.db
+//	migrate -from ./data/shortener.db -to ./data/s0.db,./data/s1.db -verify
+//	migrate -clicks-from ./data/old.db -clicks-to ./data/new.db -clicks-after 0
+//
+// Migrate reads the server's environment for SHORT_CODE_CASE and the
+// DATA_ENCRYPTION_KEY destinations are encrypted with.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"template/internal/config"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+// maxReportedMismatches is how many differing codes -verify prints.
+const maxReportedMismatches = 20
+
+func main() {
+	from := flag.String("from", "", "source of the links: a SQLite file, or shard files separated by commas")
+	to := flag.String("to", "", "destination of the links, in the same form as -from")
+	clicksFrom := flag.String("clicks-from", "", "SQLite file to copy the clicks table from")
+	clicksTo := flag.String("clicks-to", "", "SQLite file to copy the clicks table to")
+	clicksAfter := flag.Int64("clicks-after", 0, "copy only clicks with a larger id; pass the last id printed by an earlier run to resume")
+	batch := flag.Int("batch", 500, "rows read per batch")
+	verify := flag.Bool("verify", false, "only compare the links of -from and -to, without copying")
+	flag.Parse()
+
+	if *batch <= 0 {
+		log.Fatal("-batch must be positive")
+	}
+	if (*from == "") != (*to == "") || (*clicksFrom == "") != (*clicksTo == "") || (*from == "" && *clicksFrom == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	cipher, err := cfg.Encryption.Cipher()
+	if err != nil {
+		log.Fatalf("Failed to configure encryption: %v", err)
+	}
+	caseInsensitive := cfg.CodeCase == config.CodeCaseInsensitive
+
+	if *from != "" {
+		src, srcDBs, err := repositories.OpenSQLiteShortenerRepo(splitPaths(*from), repositories.ConnectDB, caseInsensitive, cipher)
+		if err != nil {
+			log.Fatalf("Failed to open source: %v", err)
+		}
+		dst, dstDBs, err := repositories.OpenSQLiteShortenerRepo(splitPaths(*to), repositories.ConnectDB, caseInsensitive, cipher)
+		if err != nil {
+			log.Fatalf("Failed to open destination: %v", err)
+		}
+		if err := dst.InitSchema(); err != nil {
+			log.Fatalf("Failed to initialize destination schema: %v", err)
+		}
+		if !*verify {
+			if err := copyLinks(src, dst, *batch); err != nil {
+				log.Fatalf("Copying links failed: %v", err)
+			}
+		}
+		mismatches, err := verifyLinks(src, dst, *batch)
+		if err != nil {
+			log.Fatalf("Verifying links failed: %v", err)
+		}
+		for _, db := range append(srcDBs, dstDBs...) {
+			db.Close()
+		}
+		if mismatches > 0 {
+			log.Printf("Verification found %d difference(s); run migrate again to correct them", mismatches)
+			os.Exit(1)
+		}
+		log.Println("Verification passed: every source link is present and equal in the destination.")
+	}
+
+	if *clicksFrom != "" {
+		if err := copyClicks(*clicksFrom, *clicksTo, *clicksAfter, *batch); err != nil {
+			log.Fatalf("Copying clicks failed: %v", err)
+		}
+	}
+}
+
+// copyLinks copies every link of src that dst lacks and updates those that
+// differ, batch by batch in ID order, reporting progress after each batch.
+func copyLinks(src, dst repositories.ShortenerRepository, batch int) error {
+	lister, err := repositories.ListLinks(src)
+	if err != nil {
+		return err
+	}
+	var afterID int64
+	var seen, created, updated int
+	start := time.Now()
+	for {
+		mappings, err := lister.ListSince(afterID, batch)
+		if err != nil {
+			return fmt.Errorf("listing source links after id %d: %w", afterID, err)
+		}
+		for _, m := range mappings {
+			afterID = m.ID
+			seen++
+			existing, err := dst.GetMapping(m.ShortCode)
+			switch {
+			case errors.Is(err, repositories.ErrNotFound):
+				if _, err := dst.CreateMapping(m); err != nil {
+					return fmt.Errorf("creating '%s': %w", m.ShortCode, err)
+				}
+				if m.ConsumedAt != nil {
+					// CreateMapping stores new links unconsumed.
+					if err := dst.UpdateMapping(m); err != nil {
+						return fmt.Errorf("marking '%s' consumed: %w", m.ShortCode, err)
+					}
+				}
+				created++
+			case err != nil:
+				return fmt.Errorf("looking up '%s' in destination: %w", m.ShortCode, err)
+			case !sameMapping(m, *existing):
+				if err := dst.UpdateMapping(m); err != nil {
+					return fmt.Errorf("updating '%s': %w", m.ShortCode, err)
+				}
+				updated++
+			}
+		}
+		log.Printf("Links: %d read, %d created, %d updated (%s)", seen, created, updated, time.Since(start).Round(time.Millisecond))
+		if len(mappings) < batch {
+			return nil
+		}
+	}
+}
+
+// verifyLinks compares every link of src with its copy in dst and returns
+// the number of links that are missing or differ. Links only dst has, such
+// as ones created and deleted while dual-writing, are counted too.
+func verifyLinks(src, dst repositories.ShortenerRepository, batch int) (int, error) {
+	lister, err := repositories.ListLinks(src)
+	if err != nil {
+		return 0, err
+	}
+	var afterID int64
+	var srcCount, mismatches int
+	for {
+		mappings, err := lister.ListSince(afterID, batch)
+		if err != nil {
+			return 0, fmt.Errorf("listing source links after id %d: %w", afterID, err)
+		}
+		for _, m := range mappings {
+			afterID = m.ID
+			srcCount++
+			existing, err := dst.GetMapping(m.ShortCode)
+			if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+				return 0, fmt.Errorf("looking up '%s' in destination: %w", m.ShortCode, err)
+			}
+			if err != nil || !sameMapping(m, *existing) {
+				mismatches++
+				if mismatches <= maxReportedMismatches {
+					log.Printf("Differs: '%s'", m.ShortCode)
+				}
+			}
+		}
+		if len(mappings) < batch {
+			break
+		}
+	}
+
+	dstCount, err := countLinks(dst, batch)
+	if err != nil {
+		return 0, err
+	}
+	if dstCount > srcCount {
+		log.Printf("Destination has %d link(s) the source does not", dstCount-srcCount)
+		mismatches += dstCount - srcCount
+	}
+	log.Printf("Verified %d source link(s) against %d destination link(s)", srcCount, dstCount)
+	return mismatches, nil
+}
+
+func countLinks(repo repositories.ShortenerRepository, batch int) (int, error) {
+	lister, err := repositories.ListLinks(repo)
+	if err != nil {
+		return 0, err
+	}
+	var afterID int64
+	count := 0
+	for {
+		mappings, err := lister.ListSince(afterID, batch)
+		if err != nil {
+			return 0, fmt.Errorf("listing destination links after id %d: %w", afterID, err)
+		}
+		count += len(mappings)
+		if len(mappings) < batch {
+			return count, nil
+		}
+		afterID = mappings[len(mappings)-1].ID
+	}
+}
+
+// copyClicks appends the clicks of fromPath with an ID above afterID to
+// toPath. Clicks have no natural key, so a rerun must resume from the last
+// ID this prints rather than start over.
+func copyClicks(fromPath, toPath string, afterID int64, batch int) error {
+	fromDB, err := repositories.ConnectDB(fromPath)
+	if err != nil {
+		return err
+	}
+	defer fromDB.Close()
+	toDB, err := repositories.ConnectDB(toPath)
+	if err != nil {
+		return err
+	}
+	defer toDB.Close()
+	src := repositories.NewSQLiteClickRepo(fromDB)
+	dst := repositories.NewSQLiteClickRepo(toDB)
+	if err := dst.InitSchema(); err != nil {
+		return err
+	}
+
+	copied := 0
+	start := time.Now()
+	for {
+		clicks, err := src.ListSince(afterID, batch)
+		if err != nil {
+			return fmt.Errorf("listing clicks after id %d: %w", afterID, err)
+		}
+		for _, c := range clicks {
+			if _, err := dst.RecordClick(c); err != nil {
+				return fmt.Errorf("copying click %d (resume with -clicks-after %d): %w", c.ID, afterID, err)
+			}
+			afterID = c.ID
+			copied++
+		}
+		log.Printf("Clicks: %d copied, last id %d (%s)", copied, afterID, time.Since(start).Round(time.Millisecond))
+		if len(clicks) < batch {
+			return nil
+		}
+	}
+}
+
+// sameMapping reports whether a and b describe the same link, ignoring
+// their IDs and the storage details of times and empty maps.
+func sameMapping(a, b shortner.URLMapping) bool {
+	return reflect.DeepEqual(normalizeMapping(a), normalizeMapping(b))
+}
+
+func normalizeMapping(m shortner.URLMapping) shortner.URLMapping {
+	m.ID = 0
+	m.CreatedAt = m.CreatedAt.UTC().Truncate(time.Second)
+	m.ExpiresAt = normalizeTime(m.ExpiresAt)
+	m.ConsumedAt = normalizeTime(m.ConsumedAt)
+	if len(m.Headers) == 0 {
+		m.Headers = nil
+	}
+	if len(m.LanguageTargets) == 0 {
+		m.LanguageTargets = nil
+	}
+	if len(m.PixelIDs) == 0 {
+		m.PixelIDs = nil
+	}
+	return m
+}
+
+func normalizeTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	n := t.UTC().Truncate(time.Second)
+	return &n
+}
+
+func splitPaths(raw string) []string {
+	var paths []string
+	for _, p := range strings.Split(raw, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
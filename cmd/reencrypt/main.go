@@ -0,0 +1,93 @@
+// Command reencrypt rewrites the encrypted columns (link destinations,
+// revision history and notes) under the current DATA_ENCRYPTION_KEY. Run it
+// after enabling encryption, to encrypt rows written before, and after a
+// key rotation: move the old key to DATA_ENCRYPTION_OLD_KEYS, set the new
+// one, restart the server, run reencrypt, then drop the old key.
+//
+// It reads the server's environment (DB_PATH, DB_SHARD_PATHS and the
+// encryption keys) and can run while the server is serving.
+package main
+
+import (
+	"flag"
+	"log"
+
+	"template/internal/config"
+	"template/internal/repositories"
+)
+
+func main() {
+	batch := flag.Int("batch", 500, "rows read per batch")
+	flag.Parse()
+	if *batch <= 0 {
+		log.Fatal("-batch must be positive")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	cipher, err := cfg.Encryption.Cipher()
+	if err != nil {
+		log.Fatalf("Failed to configure encryption: %v", err)
+	}
+	if cipher == nil {
+		log.Fatal("DATA_ENCRYPTION_KEY is not set")
+	}
+
+	db, err := repositories.ConnectDB(cfg.DBPath)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	caseInsensitive := cfg.CodeCase == config.CodeCaseInsensitive
+	linkDBs := []string{cfg.DBPath}
+	if len(cfg.DBShardPaths) > 0 {
+		linkDBs = cfg.DBShardPaths
+	}
+
+	type table struct {
+		name string
+		repo interface {
+			InitSchema() error
+			repositories.Reencrypter
+		}
+	}
+	var tables []table
+	for _, path := range linkDBs {
+		linkDB := db
+		if path != cfg.DBPath {
+			if linkDB, err = repositories.ConnectDB(path); err != nil {
+				log.Fatalf("Failed to connect to shard '%s': %v", path, err)
+			}
+			defer linkDB.Close()
+		}
+		links := repositories.NewSQLiteShortenerRepo(linkDB, caseInsensitive)
+		links.EnableEncryption(cipher)
+		tables = append(tables, table{"urls in " + path, links})
+	}
+	revisions := repositories.NewSQLiteRevisionRepo(db)
+	revisions.EnableEncryption(cipher)
+	pastes := repositories.NewSQLitePasteRepo(db)
+	pastes.EnableEncryption(cipher)
+	trash := repositories.NewSQLiteTrashRepo(db)
+	trash.EnableEncryption(cipher)
+	slack := repositories.NewSQLiteSlackWorkspaceRepo(db)
+	slack.EnableEncryption(cipher)
+	tables = append(tables, table{"link_revisions", revisions}, table{"pastes", pastes}, table{"link_trash", trash}, table{"slack_workspaces", slack})
+
+	total := 0
+	for _, t := range tables {
+		if err := t.repo.InitSchema(); err != nil {
+			log.Fatalf("Failed to initialize schema for %s: %v", t.name, err)
+		}
+		n, err := t.repo.Reencrypt(*batch)
+		if err != nil {
+			log.Fatalf("Re-encrypting %s failed after %d row(s): %v", t.name, n, err)
+		}
+		log.Printf("Re-encrypted %d row(s) of %s", n, t.name)
+		total += n
+	}
+	log.Printf("Done: %d row(s) re-encrypted", total)
+}
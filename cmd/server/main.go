@@ -3,6 +3,8 @@ package main
 import (
 	"log"
 	"os"
+	// The runtime image has no zone database; link time rules need one.
+	_ "time/tzdata"
 
 	"template/internal/app"
 )
@@ -7,3 +7,10 @@ toolchain go1.23.2
 require github.com/mattn/go-sqlite3 v1.14.28
 
 require github.com/rs/cors v1.11.1
+
+require golang.org/x/crypto v0.31.0
+
+require (
+	golang.org/x/net v0.33.0
+	golang.org/x/text v0.21.0 // indirect
+)
@@ -1,20 +1,62 @@
 package app
 
 import (
+	"context"
+	"crypto/tls"
+	"database/sql"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/rs/cors"
+	"template/internal/config"
 	httpHandlers "template/internal/deliveries/http"
+	"template/internal/pkg/acmedns"
+	"template/internal/pkg/captcha"
+	"template/internal/pkg/clientip"
+	"template/internal/pkg/cron"
+	"template/internal/pkg/featureflags"
+	"template/internal/pkg/geo"
+	"template/internal/pkg/linksign"
+	"template/internal/pkg/mailer"
+	"template/internal/pkg/metrics"
+	"template/internal/pkg/objectstore"
+	"template/internal/pkg/outbound"
+	"template/internal/pkg/ratelimit"
+	"template/internal/pkg/sdlisten"
+	"template/internal/pkg/sms"
+	"template/internal/pkg/tasks"
+	"template/internal/pkg/wal"
 	"template/internal/repositories"
 	"template/internal/services"
+	"template/internal/usecases/shortner"
 )
 
+// App runs the service in three phases. build connects to the databases
+// and wires every component without starting anything; start launches the
+// background work; serve answers HTTP until SIGINT or SIGTERM. Whatever the
+// phases set up is torn down by stop in reverse order, also when a phase
+// fails halfway.
 type App struct {
+	cfg       *config.Config
+	server    *http.Server
+	health    *httpHandlers.HealthHandler
+	scheduler *cron.Scheduler
+	dynamic   *config.DynamicStore
+	certs     *acmedns.Manager
+	stops     []namedStop
+}
+
+// namedStop releases one resource; the name is only for the logs.
+type namedStop struct {
+	name string
+	stop func()
 }
 
 func NewApp() *App {
@@ -23,74 +65,838 @@ func NewApp() *App {
 
 func (a *App) Run() error {
 	log.Println("Starting application setup...")
-
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./data/shortener.db"
+	defer a.stop()
+	if err := a.build(); err != nil {
+		return err
 	}
-	baseURL := os.Getenv("BASE_URL")
-	if baseURL == "" {
-		baseURL = "http://localhost:8080"
+	if err := a.start(); err != nil {
+		return err
+	}
+	return a.serve()
+}
+
+// onStop registers a resource to release when the application stops.
+func (a *App) onStop(name string, stop func()) {
+	a.stops = append(a.stops, namedStop{name: name, stop: stop})
+}
+
+// stop releases what build and start set up, last registered first.
+func (a *App) stop() {
+	for i := len(a.stops) - 1; i >= 0; i-- {
+		log.Printf("Stopping %s...", a.stops[i].name)
+		a.stops[i].stop()
 	}
-	serverPort := os.Getenv("PORT")
-	if serverPort == "" {
-		serverPort = "8080"
+	a.stops = nil
+}
+
+// build loads the configuration, connects to the databases, migrates their
+// schemas and wires the services and handlers. Nothing runs in the
+// background yet.
+func (a *App) build() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
 	}
-	listenAddr := ":" + serverPort
 
-	log.Printf("Database Path: %s", dbPath)
-	log.Printf("Base URL: %s", baseURL)
-	log.Printf("Server Port: %s", serverPort)
+	log.Printf("Database Path: %s", cfg.DBPath)
+	log.Printf("Base URL: %s", cfg.BaseURL)
+	if cfg.ListenSocket != "" {
+		log.Printf("Server Socket: %s", cfg.ListenSocket)
+	} else {
+		log.Printf("Server Port: %s", cfg.ServerPort)
+	}
 
-	dbDir := filepath.Dir(dbPath)
+	dbDir := filepath.Dir(cfg.DBPath)
 	if err := os.MkdirAll(dbDir, 0755); err != nil {
-		log.Fatalf("Failed to create data directory '%s': %v", dbDir, err)
+		return fmt.Errorf("failed to create data directory '%s': %w", dbDir, err)
 	}
-	db, err := repositories.ConnectDB(dbPath)
+	connect := func(path string) (*sql.DB, error) {
+		return repositories.ConnectDBWithRetry(path, cfg.DBConnectAttempts, cfg.DBConnectBackoff)
+	}
+	db, err := connect(cfg.DBPath)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		return fmt.Errorf("failed to connect to database: %w", err)
 	}
-	defer func() {
+	a.onStop("database", func() {
 		if err := db.Close(); err != nil {
 			log.Printf("Error closing database: %v", err)
 		} else {
 			log.Println("Database connection closed.")
 		}
-	}()
+	})
 
 	log.Println("Initializing dependencies...")
-	shortenerRepo := repositories.NewSQLiteShortenerRepo(db)
+	registry := metrics.NewRegistry(map[string]string{"env": cfg.Metrics.Environment})
+
+	cipher, err := cfg.Encryption.Cipher()
+	if err != nil {
+		return fmt.Errorf("failed to configure encryption: %w", err)
+	}
+	if cipher != nil {
+		log.Println("Destinations and notes are encrypted at rest.")
+	}
+
+	sqliteShortenerRepo := repositories.NewSQLiteShortenerRepo(db, cfg.CodeCase == config.CodeCaseInsensitive)
+	if cipher != nil {
+		sqliteShortenerRepo.EnableEncryption(cipher)
+	}
+	var shortenerRepo repositories.ShortenerRepository = sqliteShortenerRepo
+	// Databases besides DBPath, checked by the health report under these
+	// names. Shards hold the links themselves, so they are critical.
+	var extraDBs []dbComponent
+	if len(cfg.DBShardPaths) > 0 {
+		sharded, shardDBs, err := repositories.OpenSQLiteShortenerRepo(cfg.DBShardPaths, connect, cfg.CodeCase == config.CodeCaseInsensitive, cipher)
+		if err != nil {
+			return fmt.Errorf("failed to connect to shards: %w", err)
+		}
+		a.onStop("shards", func() { closeAll(shardDBs) })
+		for i, shardDB := range shardDBs {
+			extraDBs = append(extraDBs, dbComponent{name: fmt.Sprintf("shard_%d", i), db: shardDB, critical: true})
+		}
+		shortenerRepo = sharded
+		log.Printf("Links partitioned across %d shard(s)", len(shardDBs))
+	}
+	if cfg.DBReplicaPath != "" {
+		replicaDB, err := connect(cfg.DBReplicaPath)
+		if err != nil {
+			return fmt.Errorf("failed to connect to read replica: %w", err)
+		}
+		a.onStop("read replica", func() { closeAll([]*sql.DB{replicaDB}) })
+		// Lookups fall back to the primary when the replica fails.
+		extraDBs = append(extraDBs, dbComponent{name: "replica", db: replicaDB})
+		replicaRepo := repositories.NewSQLiteShortenerRepo(replicaDB, cfg.CodeCase == config.CodeCaseInsensitive)
+		if cipher != nil {
+			replicaRepo.EnableEncryption(cipher)
+		}
+		shortenerRepo = repositories.NewReplicatedShortenerRepo(shortenerRepo, replicaRepo, cfg.DBReplicaStaleness)
+		log.Printf("Link reads served from replica '%s' (staleness window %s)", cfg.DBReplicaPath, cfg.DBReplicaStaleness)
+	}
+	if len(cfg.DBDualWritePaths) > 0 {
+		secondary, secondaryDBs, err := repositories.OpenSQLiteShortenerRepo(cfg.DBDualWritePaths, connect, cfg.CodeCase == config.CodeCaseInsensitive, cipher)
+		if err != nil {
+			return fmt.Errorf("failed to connect to dual-write target: %w", err)
+		}
+		a.onStop("dual-write target", func() { closeAll(secondaryDBs) })
+		if err := secondary.InitSchema(); err != nil {
+			return fmt.Errorf("failed to initialize dual-write target schema: %w", err)
+		}
+		for i, secondaryDB := range secondaryDBs {
+			extraDBs = append(extraDBs, dbComponent{name: fmt.Sprintf("dual_write_%d", i), db: secondaryDB})
+		}
+		shortenerRepo = repositories.NewDualWriteShortenerRepo(shortenerRepo, secondary)
+		log.Printf("Link changes also written to %v", cfg.DBDualWritePaths)
+	}
+	homeRegion, multiRegion := cfg.Region.HomeRegion()
+	if multiRegion {
+		regions := make([]repositories.Region, len(cfg.Region.Regions))
+		for i, region := range cfg.Region.Regions {
+			regions[i] = repositories.Region(region)
+		}
+		shortenerRepo = repositories.NewRegionalShortenerRepo(shortenerRepo, repositories.Region(homeRegion), regions, cfg.CodeCase == config.CodeCaseInsensitive)
+		log.Printf("Region %s of %d: new codes start with '%s', links of other regions are read-only", homeRegion.Name, len(regions), homeRegion.Prefix)
+	}
+	if cfg.Metrics.Enabled || cfg.DBSlowQueryThreshold > 0 {
+		shortenerRepo = repositories.NewInstrumentedShortenerRepo(shortenerRepo, registry, cfg.DBSlowQueryThreshold)
+	}
+	// Outside the instrumentation, so the metrics count the queries that
+	// reach the database.
+	shortenerRepo = repositories.NewCoalescingShortenerRepo(shortenerRepo)
+	var linkCache *repositories.CachedShortenerRepo
+	if cfg.LinkCacheSize > 0 {
+		linkCache = repositories.NewCachedShortenerRepo(shortenerRepo, cfg.LinkCacheSize, cfg.LinkCacheTTL, cfg.LinkCacheMissTTL, cfg.CodeCase == config.CodeCaseInsensitive)
+		linkCache.SetShards(min(cfg.LinkCacheShards, cfg.LinkCacheSize))
+		if cfg.Metrics.Enabled {
+			linkCache.EnableMetrics(registry)
+		}
+		shortenerRepo = linkCache
+		log.Printf("Caching up to %d links for %s and as many missing codes for %s, in %d shard(s)", cfg.LinkCacheSize, cfg.LinkCacheTTL, cfg.LinkCacheMissTTL, min(cfg.LinkCacheShards, cfg.LinkCacheSize))
+		if cfg.LinkCacheStaleTTL > 0 {
+			linkCache.EnableStale(cfg.LinkCacheStaleTTL)
+		}
+	}
 	if err := shortenerRepo.InitSchema(); err != nil {
-		log.Fatalf("Failed to initialize database schema: %v", err)
+		return fmt.Errorf("failed to initialize database schema: %w", err)
+	}
+	slackRepo := repositories.NewSQLiteSlackWorkspaceRepo(db)
+	if cipher != nil {
+		slackRepo.EnableEncryption(cipher)
+	}
+	if err := slackRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize slack schema: %w", err)
+	}
+	clickRepo := repositories.NewSQLiteClickRepo(db)
+	if err := clickRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize clicks schema: %w", err)
+	}
+	hookRepo := repositories.NewSQLiteHookRepo(db)
+	if err := hookRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize hooks schema: %w", err)
+	}
+	bundleRepo := repositories.NewSQLiteBundleRepo(db)
+	if err := bundleRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize bundle schema: %w", err)
+	}
+	pasteRepo := repositories.NewSQLitePasteRepo(db)
+	if cipher != nil {
+		pasteRepo.EnableEncryption(cipher)
+	}
+	if err := pasteRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize pastes schema: %w", err)
+	}
+	fileRepo := repositories.NewSQLiteFileRepo(db)
+	if err := fileRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize files schema: %w", err)
+	}
+	fileStore, err := newObjectStore(cfg.Files)
+	if err != nil {
+		return fmt.Errorf("failed to configure file storage: %w", err)
+	}
+	revisionRepo := repositories.NewSQLiteRevisionRepo(db)
+	if cipher != nil {
+		revisionRepo.EnableEncryption(cipher)
+	}
+	if err := revisionRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize link revisions schema: %w", err)
+	}
+	// Deleted links wait in the trash of the main database, whichever
+	// database holds the links.
+	var trashRepo repositories.TrashRepository
+	if cfg.Jobs.TrashRetention > 0 {
+		sqliteTrash := repositories.NewSQLiteTrashRepo(db)
+		if cipher != nil {
+			sqliteTrash.EnableEncryption(cipher)
+		}
+		if err := sqliteTrash.InitSchema(); err != nil {
+			return fmt.Errorf("failed to initialize link trash schema: %w", err)
+		}
+		trashRepo = sqliteTrash
+	}
+	scheduleRepo := repositories.NewSQLiteScheduleRepo(db)
+	if err := scheduleRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize scheduled changes schema: %w", err)
+	}
+	reportRepo := repositories.NewSQLiteReportRepo(db)
+	if err := reportRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize report subscriptions schema: %w", err)
+	}
+	anomalyRepo := repositories.NewSQLiteAnomalyRepo(db)
+	if err := anomalyRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize click anomalies schema: %w", err)
+	}
+	honeypotRepo := repositories.NewSQLiteHoneypotRepo(db)
+	if err := honeypotRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize honeypots schema: %w", err)
+	}
+	profileRepo := repositories.NewSQLiteProfileRepo(db)
+	if err := profileRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize profiles schema: %w", err)
+	}
+	settingsRepo := repositories.NewSQLiteSettingsRepo(db)
+	if err := settingsRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize settings schema: %w", err)
+	}
+	statsRepo := repositories.NewSQLiteStatsRepo(db)
+	if cipher != nil {
+		statsRepo.EnableEncryption(cipher)
+	}
+	if err := statsRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize stats schema: %w", err)
+	}
+	if linkCache != nil && cfg.LinkCacheWarmup > 0 {
+		warmLinkCache(linkCache, statsRepo, min(cfg.LinkCacheWarmup, cfg.LinkCacheSize))
+	}
+	pixelRepo := repositories.NewSQLitePixelRepo(db)
+	if err := pixelRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize pixels schema: %w", err)
+	}
+	blockRepo := repositories.NewSQLiteRedirectBlockRepo(db)
+	if err := blockRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize redirect blocks schema: %w", err)
+	}
+	claimRepo := repositories.NewSQLiteDomainClaimRepo(db)
+	if err := claimRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize domain claims schema: %w", err)
+	}
+	apiKeyRepo := repositories.NewSQLiteAPIKeyRepo(db)
+	if err := apiKeyRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize API keys schema: %w", err)
+	}
+	flagRepo := repositories.NewSQLiteFlagRepo(db)
+	if err := flagRepo.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize feature flags schema: %w", err)
+	}
+	flags := featureflags.New(cfg.Environment, cfg.FeatureFlags)
+	flagService := services.NewFlagService(flagRepo, flags)
+	if err := flagService.Refresh(); err != nil {
+		return fmt.Errorf("failed to load feature flags: %w", err)
 	}
-	shortenerService := services.NewShortenerService(shortenerRepo)
-	shortenerHandler := httpHandlers.NewShortenerHandler(shortenerService, shortenerRepo, baseURL)
+
+	dynamic := config.NewDynamicStore(cfg.ConfigFile, cfg.Dynamic)
+	taskOptions := tasks.Options{
+		Workers:     cfg.Tasks.Workers,
+		QueueSize:   cfg.Tasks.QueueSize,
+		MaxAttempts: cfg.Tasks.MaxAttempts,
+	}
+	hookPool := tasks.New("hooks", taskOptions)
+	a.onStop("hook tasks", hookPool.Stop)
+	var clickLog *wal.Log
+	if cfg.Analytics.ClickLogDir != "" {
+		if clickLog, err = wal.Open(cfg.Analytics.ClickLogDir); err != nil {
+			return fmt.Errorf("failed to open click log: %w", err)
+		}
+		// Closed after the click pool, so the clicks it stores are
+		// acknowledged.
+		a.onStop("click log", func() {
+			if err := clickLog.Close(); err != nil {
+				log.Printf("Failed to close click log: %v", err)
+			}
+		})
+		log.Printf("Logging clicks ahead of storing them in %s", cfg.Analytics.ClickLogDir)
+	}
+	clickPool := tasks.New("clicks", taskOptions)
+	a.onStop("click tasks", clickPool.Stop)
+	mailPool := tasks.New("mail", taskOptions)
+	a.onStop("mail tasks", mailPool.Stop)
+	outboundClient := outbound.New(outbound.Options{
+		Timeout:         cfg.Outbound.Timeout,
+		MaxRedirects:    cfg.Outbound.MaxRedirects,
+		MaxBodyBytes:    cfg.Outbound.MaxBodyBytes,
+		UserAgent:       "url-shortener (+" + cfg.BaseURL + ")",
+		AllowPrivate:    cfg.Outbound.AllowPrivate,
+		AllowedNetworks: cfg.Outbound.AllowedNetworks,
+	}, registry)
+	if cfg.Outbound.AllowPrivate {
+		log.Println("OUTBOUND_ALLOW_PRIVATE set, outbound requests may reach private networks")
+	}
+	var certs *acmedns.Manager
+	if len(cfg.TLS.Domains) > 0 {
+		certs, err = acmedns.NewManager(acmedns.Config{
+			Domains:          cfg.TLS.Domains,
+			DirectoryURL:     cfg.TLS.DirectoryURL,
+			Email:            cfg.TLS.Email,
+			CacheDir:         cfg.TLS.CacheDir,
+			RenewBefore:      cfg.TLS.RenewBefore,
+			PropagationDelay: cfg.TLS.PropagationDelay,
+			Provider:         newDNSProvider(cfg.TLS, outboundClient),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to configure TLS certificates: %w", err)
+		}
+		log.Printf("Serving HTTPS for %s with certificates from %s", strings.Join(cfg.TLS.Domains, ", "), cfg.TLS.DirectoryURL)
+	}
+	hookService := services.NewHookService(hookRepo, shortenerRepo, outboundClient, hookPool)
+	shortenerService := services.NewShortenerService(shortenerRepo, revisionRepo, trashRepo, hookService, flags)
+	shortenerService.SetOutboundClient(outboundClient)
+	dynamic.OnChange(func(d config.DynamicConfig) {
+		shortenerService.SetPolicy(services.LinkPolicy{
+			BlockedDomains:      d.BlockedDomains,
+			ReservedCodes:       d.ReservedCodes,
+			PrivateDestinations: d.PrivateDestinations,
+			MaxURLLength:        cfg.Limits.MaxURLLength,
+			CodeChecksum:        cfg.CodeChecksum,
+			ChainedLinks:        cfg.Chains.Mode,
+			BaseURL:             cfg.BaseURL,
+			ShortenerDomains:    cfg.Chains.ShortenerDomains,
+			MaxChainDepth:       cfg.Chains.MaxDepth,
+			CodeLength:          cfg.CodeLength,
+			CodePrefix:          homeRegion.Prefix,
+			DefaultRedirectType: cfg.DefaultRedirectType,
+			DefaultTTL:          cfg.DefaultLinkTTL,
+		})
+	})
+	analyticsService := services.NewAnalyticsService(clickRepo, hookService, flags, clickPool, services.AnalyticsOptions{
+		DedupWindow:     cfg.Analytics.ClickDedupWindow,
+		CountPrefetches: cfg.Analytics.CountPrefetches,
+		BatchSize:       cfg.Analytics.ClickBatchSize,
+		FlushInterval:   cfg.Analytics.ClickFlushInterval,
+		BufferSize:      cfg.Analytics.ClickBufferSize,
+		BufferRetry:     cfg.Analytics.ClickBufferRetry,
+		Log:             clickLog,
+	})
+	// Stopped before the click pool, so the last batch still gets written.
+	a.onStop("click batches", analyticsService.Stop)
+	scheduleService := services.NewScheduleService(shortenerService, scheduleRepo)
+	mail := newMailer(cfg.SMTP)
+	reportService := services.NewReportService(reportRepo, shortenerService, analyticsService, mail, outboundClient, cfg.BaseURL)
+	anomalyService := services.NewAnomalyService(anomalyRepo, shortenerService, analyticsService, hookService, mail, mailPool, cfg.BaseURL, services.AnomalyOptions{
+		Window:      cfg.Anomaly.Window,
+		Baseline:    cfg.Anomaly.Baseline,
+		Cooldown:    cfg.Anomaly.Cooldown,
+		Factor:      cfg.Anomaly.Factor,
+		MinClicks:   cfg.Anomaly.MinClicks,
+		AlertEmails: cfg.Anomaly.AlertEmails,
+	})
+	adminService := services.NewAdminService(statsRepo)
+	duplicateService := services.NewDuplicateService(shortenerService, statsRepo, cfg.BaseURL)
+	redirectPolicy := services.NewRedirectPolicyService(blockRepo, shortenerService, cfg.Redirect.PolicyCacheTTL)
+	dynamic.OnChange(func(d config.DynamicConfig) {
+		redirectPolicy.SetBlockedDomains(d.BlockedDomains)
+	})
+	// Clients caught requesting honeypot codes are blocked by the probe
+	// protection, when it is on.
+	var probes *ratelimit.ProbeGuard
+	var blocker services.ClientBlocker
+	if cfg.Probe.Threshold > 0 || cfg.Probe.BlockAfter > 0 {
+		probes = ratelimit.NewProbeGuard(ratelimit.ProbeOptions{
+			Window:     cfg.Probe.Window,
+			Threshold:  cfg.Probe.Threshold,
+			BaseDelay:  cfg.Probe.BaseDelay,
+			MaxDelay:   cfg.Probe.MaxDelay,
+			BlockAfter: cfg.Probe.BlockAfter,
+			BlockFor:   cfg.Probe.BlockDuration,
+		})
+		blocker = probes
+	}
+	honeypotService := services.NewHoneypotService(honeypotRepo, shortenerService, blocker, cfg.Redirect.PolicyCacheTTL)
+	shortenerService.SetHoneypots(honeypotService)
+	claimService := services.NewDomainClaimService(claimRepo, shortenerService, redirectPolicy, outboundClient)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo)
+	bundleService := services.NewBundleService(shortenerService, bundleRepo)
+	profileService := services.NewProfileService(shortenerService, profileRepo)
+	brandingService := services.NewBrandingService(settingsRepo, cfg.Redirect.PolicyCacheTTL)
+	maintenanceMode := services.NewMaintenanceModeService(settingsRepo, cfg.MaintenanceMode, cfg.MaintenanceRetryAfter, cfg.Redirect.PolicyCacheTTL)
+	if cfg.MaintenanceMode {
+		log.Println("MAINTENANCE_MODE set, requests that change state are refused")
+	}
+	pasteService := services.NewPasteService(shortenerService, pasteRepo, services.PasteLimits{
+		MaxBytes:   cfg.Paste.MaxBytes,
+		DefaultTTL: cfg.Paste.DefaultTTL,
+		MaxTTL:     cfg.Paste.MaxTTL,
+	})
+	shortenerHandler := httpHandlers.NewShortenerHandler(shortenerService, analyticsService, shortenerRepo, cfg.BaseURL, httpHandlers.RedirectOptions{
+		Headers:               cfg.Redirect.Headers,
+		CacheControlTemporary: cfg.Redirect.CacheControlTemporary,
+		CacheControlPermanent: cfg.Redirect.CacheControlPermanent,
+		PreviewNoRedirect:     cfg.Redirect.PreviewNoRedirect,
+		QueryPassthrough:      cfg.Redirect.QueryPassthrough,
+	})
+	pixelService := services.NewPixelService(pixelRepo)
+	shortenerHandler.EnableRetargeting(pixelService, cfg.Redirect.InterstitialBudget)
+	shortenerHandler.SetFeatureFlags(flags)
+	shortenerHandler.SetAdminToken(cfg.AdminToken)
+	shortenerHandler.EnableRedirectPolicy(redirectPolicy)
+	shortenerHandler.EnableHoneypots(honeypotService)
+	if cfg.Captcha.Provider != "" {
+		verifier, err := captcha.New(cfg.Captcha.Provider, cfg.Captcha.Secret, cfg.Captcha.MinScore, outboundClient)
+		if err != nil {
+			return err
+		}
+		shortenerHandler.EnableCaptcha(verifier, cfg.AdminToken)
+		log.Printf("Anonymous link creation requires a %s CAPTCHA", cfg.Captcha.Provider)
+	}
+	shortenerHandler.EnableSocialPreviews(services.NewSocialPreviewService(outboundClient, cfg.Redirect.SocialPreviewTTL))
+	ipResolver, err := clientip.NewResolver(cfg.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("failed to configure trusted proxies: %w", err)
+	}
+	if err := enableGeoRestrictions(shortenerHandler, cfg.Geo, ipResolver); err != nil {
+		return err
+	}
+	statsService := services.NewStatsService(shortenerService, analyticsService, cfg.AdminToken)
+	shortenerHandler.EnablePreviews(statsService)
+	var signingService services.SigningService
+	if keys := cfg.LinkSigningKeys(); len(keys) > 0 {
+		signer, err := linksign.NewKeyring(keys, cfg.CodeCase == config.CodeCaseInsensitive)
+		if err != nil {
+			return fmt.Errorf("invalid link signing keys: %w", err)
+		}
+		signingService = services.NewSigningService(shortenerService, signer)
+		shortenerHandler.EnableSigning(signingService)
+		log.Printf("Signed links enabled: redirects require a signature made with one of %d key(s)", len(keys))
+	}
+	pixelHandler := httpHandlers.NewPixelHandler(pixelService)
+	linkHandler := httpHandlers.NewLinkHandler(shortenerService, scheduleService, statsService)
+	if signingService != nil {
+		linkHandler.EnableSigning(signingService, cfg.AdminToken, cfg.BaseURL)
+	}
+	var smsSender sms.Sender
+	if cfg.Share.SMSAccountSID != "" {
+		smsSender = sms.NewTwilioSender(cfg.Share.SMSAPIURL, cfg.Share.SMSAccountSID, cfg.Share.SMSAuthToken, cfg.Share.SMSFrom, outboundClient)
+	} else {
+		log.Println("SMS_ACCOUNT_SID not set, links cannot be shared by SMS")
+	}
+	shareService := services.NewShareService(shortenerService, mail, smsSender, mailPool, cfg.BaseURL)
+	linkHandler.EnableSharing(shareService, ratelimit.New(cfg.Share.RateLimit, cfg.Share.RateWindow))
+	reportHandler := httpHandlers.NewReportHandler(reportService)
+	bundleHandler := httpHandlers.NewBundleHandler(bundleService, analyticsService, cfg.BaseURL)
+	shortenerHandler.RegisterRenderer(shortner.KindBundle, bundleHandler)
+	profileHandler := httpHandlers.NewProfileHandler(profileService, cfg.BaseURL, cfg.AdminToken)
+	shortenerHandler.EnableProfiles(profileHandler)
+	fileService := services.NewFileService(shortenerService, fileRepo, fileStore, services.FileLimits{
+		MaxBytes:     cfg.Files.MaxBytes,
+		AllowedTypes: cfg.Files.AllowedTypes,
+		DefaultTTL:   cfg.Files.DefaultTTL,
+		MaxTTL:       cfg.Files.MaxTTL,
+	})
+	fileHandler := httpHandlers.NewFileHandler(fileService, analyticsService, cfg.BaseURL, cfg.Files.Stream, cfg.Files.MaxBytes)
+	shortenerHandler.RegisterRenderer(shortner.KindFile, fileHandler)
+	pasteHandler := httpHandlers.NewPasteHandler(pasteService, shortenerService, analyticsService, cfg.BaseURL, cfg.Paste.MaxBytes)
+	shortenerHandler.RegisterRenderer(shortner.KindPaste, pasteHandler)
+
+	maintenanceService := services.NewMaintenanceService(shortenerRepo, repositories.NewSQLiteMaintenanceRepo(db), cfg.Jobs.ExpiredRetention, services.BackupOptions{
+		Dir:  cfg.Jobs.BackupDir,
+		Keep: cfg.Jobs.BackupKeep,
+	})
+	maintenanceService.RegisterCleaner(shortner.KindPaste, pasteService)
+	maintenanceService.RegisterCleaner(shortner.KindFile, fileService)
+	maintenanceService.RegisterCleaner(shortner.KindBundle, bundleService)
+	var trashService services.TrashService
+	if trashRepo != nil {
+		trashService = services.NewTrashService(shortenerRepo, trashRepo, maintenanceService, cfg.Jobs.TrashRetention)
+		log.Printf("Deleted links kept in the trash for %s", cfg.Jobs.TrashRetention)
+	}
+	every := "@every " + cfg.SchedulerInterval.String()
+	scheduler, err := newJobScheduler(cfg.Jobs, []backgroundJob{
+		{name: "scheduled_changes", schedule: every, run: func(now time.Time) error {
+			_, err := scheduleService.RunDue(now)
+			return err
+		}},
+		{name: "report_emails", schedule: every, run: func(now time.Time) error {
+			_, err := reportService.RunDue(now)
+			return err
+		}},
+		{name: "click_anomalies", schedule: every, run: func(now time.Time) error {
+			_, err := anomalyService.Detect(now)
+			return err
+		}},
+		{name: "stats_rollups", schedule: every, run: func(time.Time) error { return adminService.RefreshRollups() }},
+		{name: "feature_flags", schedule: every, run: func(time.Time) error { return flagService.Refresh() }},
+		{name: "expiry_reaper", schedule: "@hourly", run: func(now time.Time) error {
+			_, err := maintenanceService.ReapExpired(now)
+			return err
+		}},
+		{name: "trash_purge", schedule: "@hourly", disabled: trashService == nil, run: func(now time.Time) error {
+			_, err := trashService.PurgeExpired(now)
+			return err
+		}},
+		{name: "health_check", schedule: "@every 1m", run: func(time.Time) error { return maintenanceService.CheckHealth() }},
+		{name: "backup", schedule: "@daily", disabled: cfg.Jobs.BackupDir == "", run: func(now time.Time) error {
+			_, err := maintenanceService.Backup(now)
+			return err
+		}},
+		{name: "certificates", schedule: "@every 12h", disabled: certs == nil, run: func(now time.Time) error { return certs.Renew(now) }},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to configure background jobs: %w", err)
+	}
+	addHealthChecks(maintenanceService, cfg, fileStore, scheduler, extraDBs)
+
+	adminHandler := httpHandlers.NewAdminHandler(adminService, flagService, duplicateService, redirectPolicy, scheduler, cfg.AdminToken)
+	adminHandler.EnableAnomalies(anomalyService)
+	if probes != nil {
+		adminHandler.EnableProbes(probes)
+	}
+	adminHandler.EnableHoneypots(honeypotService)
+	adminHandler.EnableBranding(brandingService)
+	adminHandler.EnableMaintenanceMode(maintenanceMode)
+	adminHandler.EnableSlackWorkspaces(services.NewSlackWorkspaceService(slackRepo))
+	bulkHandler := httpHandlers.NewBulkHandler(shortenerService, pixelService, cfg.AdminToken)
+	linksHandler := httpHandlers.NewLinksHandler(shortenerService, cfg.AdminToken)
+	if cfg.AdminToken == "" {
+		log.Println("ADMIN_TOKEN not set, admin API is disabled")
+	}
+	automationHandler := httpHandlers.NewAutomationHandler(shortenerService, analyticsService, statsService, hookService, cfg.BaseURL, cfg.AdminToken)
+	slackHandler := httpHandlers.NewSlackHandler(shortenerService, slackRepo, cfg.Slack.SigningSecret, cfg.BaseURL)
+	emailHandler := httpHandlers.NewEmailHandler(shortenerService, mail, mailPool, cfg.Email.InboundAddress, cfg.Email.WebhookToken, cfg.BaseURL)
+	healthHandler := httpHandlers.NewHealthHandler(maintenanceService)
+	domainHandler := httpHandlers.NewDomainHandler(claimService)
+	provisioningHandler := httpHandlers.NewProvisioningHandler(apiKeyService, claimService, redirectPolicy, cfg.AdminToken)
 
 	log.Println("Setting up HTTP router...")
 	mux := http.NewServeMux()
-	shortenerHandler.RegisterRoutes(mux)
+	routes := httpHandlers.NewRouteTable()
+	handlers := []routedHandler{
+		shortenerHandler, slackHandler, emailHandler, automationHandler, bundleHandler, pasteHandler,
+		fileHandler, pixelHandler, linkHandler, linksHandler, bulkHandler, reportHandler, adminHandler, healthHandler,
+		domainHandler, profileHandler, provisioningHandler,
+	}
+	if trashService != nil {
+		handlers = append(handlers, httpHandlers.NewTrashHandler(trashService, cfg.AdminToken))
+	}
+	for _, h := range handlers {
+		h.RegisterRoutes(mux)
+		routes.Add(h.Routes()...)
+	}
+
+	var rootHandler http.Handler = mux
+	if cfg.Metrics.Enabled {
+		mux.Handle("/metrics", registry.Handler())
+		routes.Add(httpHandlers.Route{Pattern: "/metrics", Methods: []string{http.MethodGet}})
+		log.Println("Metrics exposed on GET /metrics")
+	}
+	rootHandler = httpHandlers.NewBranding(brandingService).Middleware(rootHandler)
+	rootHandler = httpHandlers.NewAPIKeyAuth(apiKeyService).Middleware(rootHandler)
+	// The route table answers OPTIONS and wrong methods with the Allow
+	// header before a handler sees the request.
+	rootHandler = routes.Middleware(rootHandler)
+	rootHandler = httpHandlers.NewMaintenanceGuard(maintenanceMode).Middleware(rootHandler)
+	if cfg.Metrics.Enabled {
+		rootHandler = httpHandlers.NewHTTPMetrics(registry, routes).Middleware(rootHandler)
+	}
+
+	// Pastes, file uploads and inbound email check their own, larger limits.
+	rootHandler = httpHandlers.NewBodyLimit(cfg.Limits.MaxBodyBytes, "/api/v1/pastes", "/api/v1/files/", "/integrations/email").Middleware(rootHandler)
 
-	log.Println("Configuring CORS...")
-	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"null", "http://localhost:*", "http://127.0.0.1:*"},
-		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
-		AllowedHeaders: []string{"Content-Type", "Authorization"},
+	limiter := ratelimit.New(0, cfg.Dynamic.RateLimit.Window)
+	rootHandler = httpHandlers.NewRateLimit(limiter).Middleware(rootHandler)
+	if probes != nil {
+		rootHandler = httpHandlers.NewProbeGuard(probes, registry, routes).Middleware(rootHandler)
+	}
+	if cfg.ResponseEnvelope {
+		rootHandler = httpHandlers.NewEnvelope().Middleware(rootHandler)
+		log.Println("JSON responses wrapped in {\"data\", \"error\"} envelopes")
+	}
+
+	corsHandler := &swappableHandler{}
+	dynamic.OnChange(func(d config.DynamicConfig) {
+		log.Printf("Configuring CORS (profile: %s)...", d.CORS.Profile)
+		corsHandler.Swap(newCORSHandler(d.CORS, rootHandler))
+		limiter.SetLimit(d.RateLimit.Requests, d.RateLimit.Window)
 	})
-	handler := c.Handler(mux)
+	var handler http.Handler = corsHandler
+	if cfg.AccessLog.Enabled {
+		handler = httpHandlers.NewAccessLog(os.Stdout, cfg.AccessLog.SampleRates, routes).Middleware(handler)
+		log.Println("Access log written to stdout")
+	}
 
-	log.Printf("Starting HTTP server on %s", listenAddr)
-	server := &http.Server{
-		Addr:         listenAddr,
+	handler = ipResolver.Middleware(handler)
+
+	a.cfg = cfg
+	a.health = healthHandler
+	a.scheduler = scheduler
+	a.dynamic = dynamic
+	a.certs = certs
+	a.server = &http.Server{
+		Addr:         cfg.ListenAddr(),
 		Handler:      handler,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
+	if certs != nil {
+		a.server.TLSConfig = &tls.Config{GetCertificate: certs.GetCertificate, MinVersion: tls.VersionTLS12}
+	}
+	return nil
+}
 
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+// start launches the background jobs and the config reloaders.
+func (a *App) start() error {
+	a.onStop("background jobs", a.scheduler.Start())
+	a.onStop("SIGHUP reload", reloadOnSIGHUP(a.dynamic))
+	if a.certs != nil {
+		// Missing certificates are obtained right away rather than at
+		// the first run of the certificates job; until then handshakes
+		// for their names fail.
+		go a.certs.Renew(time.Now())
+	}
+	if a.cfg.ConfigFile != "" && a.cfg.ConfigWatchInterval > 0 {
+		a.onStop("config watch", a.dynamic.Watch(a.cfg.ConfigWatchInterval))
+		log.Printf("Watching %s for config changes every %s", a.cfg.ConfigFile, a.cfg.ConfigWatchInterval)
+	}
+	return nil
+}
+
+// serve answers HTTP requests until the process gets SIGINT or SIGTERM,
+// then stops reporting ready, keeps serving for the drain period while
+// load balancers take the instance out, and lets the requests in flight
+// finish. A second signal cuts the drain short.
+func (a *App) serve() error {
+	listeners, err := a.listen()
+	if err != nil {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
+	run := a.server.Serve
+	scheme := "HTTP"
+	if a.server.TLSConfig != nil {
+		run = func(l net.Listener) error { return a.server.ServeTLS(l, "", "") }
+		scheme = "HTTPS"
+	}
+	for _, listener := range listeners {
+		log.Printf("Starting %s server on %s", scheme, listener.Addr())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func() { errs <- run(listener) }()
+	}
+	a.health.SetReady(true)
 
+	select {
+	case err := <-errs:
+		a.health.SetReady(false)
+		return fmt.Errorf("server failed: %w", err)
+	case sig := <-signals:
+		log.Printf("Received %s, shutting down...", sig)
+	}
+	a.health.SetReady(false)
+	// Clients holding a connection open are told to reconnect, which
+	// lands them on another instance.
+	a.server.SetKeepAlivesEnabled(false)
+	if drain := a.cfg.ShutdownDrain; drain > 0 {
+		log.Printf("Draining for %s before shutting down", drain)
+		timer := time.NewTimer(drain)
+		select {
+		case <-timer.C:
+		case sig := <-signals:
+			timer.Stop()
+			log.Printf("Received %s, ending the drain early", sig)
+		case err := <-errs:
+			timer.Stop()
+			return fmt.Errorf("server failed: %w", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.ShutdownTimeout)
+	defer cancel()
+	if err := a.server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
 	log.Println("Server stopped gracefully.")
 	return nil
 }
+
+// listen returns the sockets systemd passed when the service is socket
+// activated, all of which are served, and otherwise listens on the
+// configured unix socket or address.
+func (a *App) listen() ([]net.Listener, error) {
+	listeners, names, err := sdlisten.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(listeners) > 0 {
+		log.Printf("Socket activated, serving %s instead of %s", strings.Join(names, ", "), a.server.Addr)
+		return listeners, nil
+	}
+	if a.cfg.ListenSocket != "" {
+		listener, err := listenUnix(a.cfg.ListenSocket, a.cfg.ListenSocketMode)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{listener}, nil
+	}
+	listener, err := net.Listen("tcp", a.server.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return []net.Listener{listener}, nil
+}
+
+// listenUnix listens on a unix socket at path, replacing the socket left
+// by a run that did not stop cleanly, and gives it mode. The socket is
+// removed when the listener is closed.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func closeAll(dbs []*sql.DB) {
+	for _, db := range dbs {
+		if err := db.Close(); err != nil {
+			log.Printf("Error closing database: %v", err)
+		}
+	}
+}
+
+// routedHandler is an HTTP handler that registers its routes on the mux and
+// lists them for the route table.
+type routedHandler interface {
+	RegisterRoutes(mux *http.ServeMux)
+	Routes() []httpHandlers.Route
+}
+
+func newMailer(cfg config.SMTPConfig) mailer.Mailer {
+	if cfg.Host == "" {
+		log.Println("SMTP_HOST not set, outgoing mail will only be logged")
+		return mailer.NewLogMailer()
+	}
+	return mailer.NewSMTPMailer(cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.From)
+}
+
+// warmLinkCache loads the n most clicked links into the cache, so that a
+// restart at peak traffic does not send every visitor to the database at
+// once. A failure only leaves the cache colder.
+func warmLinkCache(cache *repositories.CachedShortenerRepo, stats repositories.StatsRepository, n int) {
+	start := time.Now()
+	top, err := stats.TopLinks(n)
+	if err != nil {
+		log.Printf("Error listing the most clicked links to warm the link cache: %v", err)
+		return
+	}
+	codes := make([]string, len(top))
+	for i, link := range top {
+		codes[i] = link.ShortCode
+	}
+	loaded, err := cache.Warm(codes)
+	if err != nil {
+		log.Printf("Error warming the link cache: %v", err)
+	}
+	log.Printf("Warmed the link cache with %d of the most clicked links in %s", loaded, time.Since(start).Round(time.Millisecond))
+}
+
+func newDNSProvider(cfg config.TLSConfig, client *outbound.Client) acmedns.DNSProvider {
+	if cfg.DNSProvider == "webhook" {
+		return acmedns.NewWebhook(cfg.WebhookURL, cfg.WebhookToken, client)
+	}
+	return acmedns.NewCloudflare(acmedns.CloudflareURL, cfg.CloudflareToken, client)
+}
+
+func newObjectStore(cfg config.FileConfig) (objectstore.Store, error) {
+	if cfg.Storage == config.FileStorageS3 {
+		log.Printf("Storing files in S3 bucket '%s'", cfg.S3.Bucket)
+		return objectstore.NewS3Store(objectstore.S3Config{
+			Endpoint:        cfg.S3.Endpoint,
+			Bucket:          cfg.S3.Bucket,
+			Region:          cfg.S3.Region,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+		})
+	}
+	log.Printf("Storing files in directory '%s'", cfg.Dir)
+	return objectstore.NewFSStore(cfg.Dir)
+}
+
+// enableGeoRestrictions locates visitors by the proxy's country header,
+// then by the IP database, as configured.
+func enableGeoRestrictions(h *httpHandlers.ShortenerHandler, cfg config.GeoConfig, proxies *clientip.Resolver) error {
+	var locator geo.Chain
+	if cfg.CountryHeader != "" {
+		locator = append(locator, geo.Header{Name: cfg.CountryHeader, Trusted: proxies.FromTrustedProxy})
+	}
+	if cfg.IPDatabase != "" {
+		ranges, err := geo.LoadRanges(cfg.IPDatabase)
+		if err != nil {
+			return fmt.Errorf("failed to load GEO_IP_DATABASE: %w", err)
+		}
+		log.Printf("Loaded %d IP ranges for country lookups", ranges.Len())
+		locator = append(locator, ranges)
+	}
+	if len(locator) == 0 {
+		log.Println("GEO_COUNTRY_HEADER and GEO_IP_DATABASE not set, links limited to some countries are unavailable")
+	}
+	var page []byte
+	if cfg.BlockedPage != "" {
+		var err error
+		if page, err = os.ReadFile(cfg.BlockedPage); err != nil {
+			return fmt.Errorf("failed to read GEO_BLOCKED_PAGE: %w", err)
+		}
+	}
+	h.EnableGeoRestrictions(locator, page)
+	return nil
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"time"
+
+	"template/internal/config"
+	"template/internal/pkg/cron"
+	"template/internal/pkg/objectstore"
+	"template/internal/services"
+)
+
+// healthCheckObjectKey is looked up by the object_store health check; the
+// object does not need to exist, the store only has to answer.
+const healthCheckObjectKey = "healthcheck"
+
+// smtpDialTimeout bounds the smtp health check's connection attempt.
+const smtpDialTimeout = 3 * time.Second
+
+// dbComponent is a database other than the main one, reported by name.
+type dbComponent struct {
+	name     string
+	db       *sql.DB
+	critical bool
+}
+
+// addHealthChecks registers the components shown by /readyz besides the
+// main database, which the maintenance service always checks. Only the
+// databases holding links are critical: without the others redirects keep
+// working, so the instance stays ready and reports itself degraded.
+func addHealthChecks(maintenance services.MaintenanceService, cfg *config.Config, fileStore objectstore.Store,
+	scheduler *cron.Scheduler, dbs []dbComponent) {
+	for _, c := range dbs {
+		maintenance.AddHealthCheck(c.name, c.critical, c.db.Ping)
+	}
+	maintenance.AddHealthCheck("object_store", false, func() error {
+		_, err := fileStore.Stat(healthCheckObjectKey)
+		if errors.Is(err, objectstore.ErrNotFound) {
+			return nil
+		}
+		return err
+	})
+	maintenance.AddHealthCheck("scheduler", false, func() error {
+		if !scheduler.Running() {
+			return errors.New("background jobs are not running")
+		}
+		return nil
+	})
+	maintenance.AddHealthCheck("smtp", false, func() error {
+		if cfg.SMTP.Host == "" {
+			return services.ErrComponentDisabled
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(cfg.SMTP.Host, cfg.SMTP.Port), smtpDialTimeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+	maintenance.AddHealthCheck("slack", false, func() error {
+		if cfg.Slack.SigningSecret == "" {
+			return services.ErrComponentDisabled
+		}
+		return nil
+	})
+	maintenance.AddHealthCheck("inbound_email", false, func() error {
+		if cfg.Email.WebhookToken == "" {
+			return services.ErrComponentDisabled
+		}
+		return nil
+	})
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"template/internal/config"
+	"template/internal/pkg/cron"
+)
+
+// backgroundJob is one periodic task. Jobs with disabled set stay off
+// whatever the configuration says, for example backups without BACKUP_DIR.
+type backgroundJob struct {
+	name     string
+	schedule string
+	disabled bool
+	run      cron.JobFunc
+}
+
+// newJobScheduler registers jobs with their configured schedules and
+// disables the ones listed in JOBS_DISABLED. Schedules or disabled entries
+// naming a job that does not exist are configuration errors.
+func newJobScheduler(cfg config.JobsConfig, jobs []backgroundJob) (*cron.Scheduler, error) {
+	scheduler := cron.New(cfg.Jitter)
+	names := make([]string, 0, len(jobs))
+	for _, j := range jobs {
+		names = append(names, j.name)
+	}
+	for name := range cfg.Schedules {
+		if !slices.Contains(names, name) {
+			return nil, fmt.Errorf("invalid JOB_SCHEDULES: unknown job %q (known jobs: %v)", name, names)
+		}
+	}
+	for _, name := range cfg.Disabled {
+		if !slices.Contains(names, name) {
+			return nil, fmt.Errorf("invalid JOBS_DISABLED: unknown job %q (known jobs: %v)", name, names)
+		}
+	}
+
+	for _, j := range jobs {
+		schedule := j.schedule
+		if s, ok := cfg.Schedules[j.name]; ok {
+			schedule = s
+		}
+		if err := scheduler.Add(j.name, schedule, j.run); err != nil {
+			return nil, err
+		}
+		if j.disabled || slices.Contains(cfg.Disabled, j.name) {
+			if err := scheduler.Disable(j.name); err != nil {
+				return nil, err
+			}
+			log.Printf("Job %s disabled", j.name)
+			continue
+		}
+		log.Printf("Job %s scheduled: %s", j.name, schedule)
+	}
+	return scheduler, nil
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/rs/cors"
+	"template/internal/config"
+)
+
+// swappableHandler forwards to a handler that can be replaced while requests
+// are in flight; each request uses the handler current when it arrived.
+type swappableHandler struct {
+	current atomic.Pointer[http.Handler]
+}
+
+func (h *swappableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*h.current.Load()).ServeHTTP(w, r)
+}
+
+func (h *swappableHandler) Swap(next http.Handler) {
+	h.current.Store(&next)
+}
+
+func newCORSHandler(cfg config.CORSConfig, next http.Handler) http.Handler {
+	return cors.New(cors.Options{
+		AllowedOrigins: cfg.AllowedOrigins,
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+	}).Handler(next)
+}
+
+// reloadOnSIGHUP reloads the dynamic settings every time the process gets
+// SIGHUP, until the returned stop function is called.
+func reloadOnSIGHUP(store *config.DynamicStore) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				if err := store.Reload(); err != nil {
+					log.Printf("Config reload on SIGHUP failed, keeping previous settings: %v", err)
+				} else {
+					log.Println("Config reloaded on SIGHUP")
+				}
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
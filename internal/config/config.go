@@ -0,0 +1,1305 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"template/internal/pkg/cron"
+	"template/internal/pkg/featureflags"
+	"template/internal/pkg/fieldcrypt"
+	"template/internal/pkg/linksign"
+	"template/internal/pkg/secrets"
+	"template/internal/pkg/utils"
+)
+
+const (
+	CodeCaseSensitive   = "sensitive"
+	CodeCaseInsensitive = "insensitive"
+)
+
+const (
+	CORSProfileStrict = "strict"
+	CORSProfileOpen   = "open"
+	CORSProfileCustom = "custom"
+)
+
+// SHORT_CODE_LENGTH bounds: shorter codes are quickly exhausted and easy to
+// enumerate, longer ones defeat the purpose of a short link.
+const (
+	minCodeLength = 4
+	maxCodeLength = 32
+)
+
+// minSigningKeyLength keeps LINK_SIGNING_KEY from being short enough to
+// guess.
+const minSigningKeyLength = 32
+
+// signingKeyIDPattern is what the IDs of LINK_SIGNING_KEYS may look like;
+// they are carried in signed URLs.
+var signingKeyIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,32}$`)
+
+// defaultStrictOrigins are the origins allowed by the strict CORS profile:
+// local development pages and file:// documents (which send Origin: null).
+var defaultStrictOrigins = []string{"null", "http://localhost:*", "http://127.0.0.1:*"}
+
+type Config struct {
+	DBPath string
+	// DBConnectAttempts is how many times a database connection is tried
+	// at startup, waiting DBConnectBackoff after the first failure and
+	// doubling the wait after each further one.
+	DBConnectAttempts int
+	DBConnectBackoff  time.Duration
+	// DBSlowQueryThreshold is the duration above which a repository call
+	// is logged as a slow query; 0 disables the log.
+	DBSlowQueryThreshold time.Duration
+	// DBReplicaPath, when set, is a read replica of the database that link
+	// lookups and listings are served from. Codes written less than
+	// DBReplicaStaleness ago are still read from the primary.
+	DBReplicaPath      string
+	DBReplicaStaleness time.Duration
+	// DBShardPaths, when set, lists the SQLite files the links table is
+	// partitioned across by short code. The other tables stay in DBPath.
+	DBShardPaths []string
+	// DBDualWritePaths, when set, is a second copy of the links table (one
+	// file or shards) that every change is mirrored to while cmd/migrate
+	// moves links there.
+	DBDualWritePaths []string
+	// LinkCacheSize is how many links are kept in memory, each for at
+	// most LinkCacheTTL; 0 disables the cache. At startup the
+	// LinkCacheWarmup most clicked links are loaded into it. Codes not
+	// found are remembered for LinkCacheMissTTL, 0 for not at all. While
+	// the database is unavailable, expired links keep being served for up
+	// to LinkCacheStaleTTL past their expiry; 0 never serves them. The
+	// cache is split into LinkCacheShards shards, each locked separately.
+	LinkCacheSize     int
+	LinkCacheTTL      time.Duration
+	LinkCacheMissTTL  time.Duration
+	LinkCacheWarmup   int
+	LinkCacheStaleTTL time.Duration
+	LinkCacheShards   int
+	BaseURL           string
+	ServerPort        string
+	// ListenSocket is the path of a unix socket to listen on instead of
+	// ServerPort, created with ListenSocketMode, for a proxy on the same
+	// machine.
+	ListenSocket     string
+	ListenSocketMode os.FileMode
+	// ShutdownDrain is how long the server keeps serving, while /readyz
+	// fails, after a shutdown signal, so that load balancers stop sending
+	// it requests first. ShutdownTimeout then bounds the wait for the
+	// requests in flight.
+	ShutdownDrain   time.Duration
+	ShutdownTimeout time.Duration
+	// CodeCase is "sensitive" (abc and ABC are different links) or
+	// "insensitive" (both open the same link).
+	CodeCase string
+	// CodeChecksum adds a check character to generated codes so that
+	// mistyped codes are caught before a database lookup.
+	CodeChecksum bool
+	// Region places the instance in a multi-region deployment.
+	Region RegionConfig
+	// CodeLength is the length of generated codes, before the check
+	// character.
+	CodeLength int
+	// DefaultRedirectType is stored on new links that do not choose a
+	// redirect type; 0 leaves them at the handler's 302.
+	DefaultRedirectType int
+	// DefaultLinkTTL makes new links without an expiry expire this long
+	// after creation; 0 means they never do.
+	DefaultLinkTTL time.Duration
+	// ResponseEnvelope wraps the JSON bodies of the API in
+	// {"data": ..., "error": ...}.
+	ResponseEnvelope bool
+	// MaintenanceMode holds maintenance mode on, whatever the admin API
+	// saved; MaintenanceRetryAfter is the default Retry-After of the 503
+	// answers to mutations.
+	MaintenanceMode       bool
+	MaintenanceRetryAfter time.Duration
+	Slack                 SlackConfig
+	SMTP                  SMTPConfig
+	Email                 EmailConfig
+	Metrics               MetricsConfig
+	AccessLog             AccessLogConfig
+	Redirect              RedirectConfig
+	Geo                   GeoConfig
+	Chains                ChainConfig
+	Paste                 PasteConfig
+	Files                 FileConfig
+	// SchedulerInterval is how often the polling jobs (scheduled changes,
+	// report emails, stats rollups, feature flags) run unless Jobs gives
+	// them another schedule.
+	SchedulerInterval time.Duration
+	Jobs              JobsConfig
+	Tasks             TasksConfig
+	Outbound          OutboundConfig
+	Limits            LimitsConfig
+	Analytics         AnalyticsConfig
+	Anomaly           AnomalyConfig
+	Probe             ProbeConfig
+	Captcha           CaptchaConfig
+	Share             ShareConfig
+	TLS               TLSConfig
+	Encryption        EncryptionConfig
+	// Dynamic holds the settings that can be reloaded without a restart.
+	// ConfigFile, when set, is the JSON file they are reloaded from and is
+	// checked for changes every ConfigWatchInterval (0 means only on SIGHUP).
+	Dynamic             DynamicConfig
+	ConfigFile          string
+	ConfigWatchInterval time.Duration
+	// Environment names the deployment (prod, staging, ...) for feature
+	// flags limited to some environments. FeatureFlags are the deployment's
+	// flag settings from FEATURE_FLAGS.
+	Environment  string
+	FeatureFlags []featureflags.Flag
+	// AdminToken is the bearer token required by the /api/v1/admin routes.
+	// They are disabled while it is empty. It also identifies the owner,
+	// who may see the stats of every link.
+	AdminToken string
+	// TrustedProxies lists the CIDRs of reverse proxies whose forwarding
+	// headers (X-Forwarded-For, X-Real-IP, Forwarded) are believed.
+	TrustedProxies []string
+}
+
+type CORSConfig struct {
+	Profile        string
+	AllowedOrigins []string
+}
+
+// SlackConfig holds the fallback signing secret used for workspaces that have
+// no dedicated row in the slack_workspaces table.
+type SlackConfig struct {
+	SigningSecret string
+}
+
+// SMTPConfig configures outgoing mail. When Host is empty, mail is only
+// written to the log.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// EmailConfig configures the inbound email gateway. InboundAddress is the
+// address users send links to; WebhookToken must be passed as the "token"
+// query parameter by the email provider.
+type EmailConfig struct {
+	InboundAddress string
+	WebhookToken   string
+}
+
+// MetricsConfig controls the Prometheus endpoint. When Environment is set,
+// every series carries an env label so one alerting rule set can serve
+// several deployments.
+type MetricsConfig struct {
+	Enabled     bool
+	Environment string
+}
+
+// RegionConfig places the instance in a multi-region deployment, where the
+// instances of every region serve all links from a regional replica but
+// each link is created and changed only in its home region. Regions lists
+// every region, the first one also owning the codes of none (links created
+// before the deployment had regions); Home names the instance's own. An
+// empty Home means a single region.
+type RegionConfig struct {
+	Home    string
+	Regions []Region
+}
+
+// Region is one region of a multi-region deployment: the codes created
+// there start with Prefix, and its instances answer at BaseURL.
+type Region struct {
+	Name    string
+	Prefix  string
+	BaseURL string
+}
+
+// HomeRegion returns the instance's region; ok is false with a single
+// region.
+func (c RegionConfig) HomeRegion() (home Region, ok bool) {
+	for _, region := range c.Regions {
+		if region.Name == c.Home {
+			return region, true
+		}
+	}
+	return Region{}, false
+}
+
+// AccessLogConfig controls the per-request log written to stdout.
+// SampleRates maps a route template (such as "/{code}", or "*" for every
+// other route) to the fraction of its successful requests that is logged.
+type AccessLogConfig struct {
+	Enabled     bool
+	SampleRates map[string]float64
+}
+
+// JobsConfig controls the background job scheduler. Schedules maps a job
+// name to the cron expression that replaces its default; Disabled jobs never
+// run. Every run starts up to Jitter late. Expired links are deleted once
+// they have been expired for ExpiredRetention, deleted links are purged
+// from the trash after TrashRetention (zero disables the trash), and
+// BackupKeep database backups are kept in BackupDir (no backups when it is
+// empty).
+type JobsConfig struct {
+	Schedules        map[string]string
+	Disabled         []string
+	Jitter           time.Duration
+	ExpiredRetention time.Duration
+	TrashRetention   time.Duration
+	BackupDir        string
+	BackupKeep       int
+}
+
+// TasksConfig sizes each background task pool (webhook deliveries, click
+// recording, email replies): Workers goroutines share a queue of QueueSize
+// tasks, and a failed task is tried up to MaxAttempts times.
+type TasksConfig struct {
+	Workers     int
+	QueueSize   int
+	MaxAttempts int
+}
+
+// OutboundConfig configures the HTTP client for requests to user-supplied
+// URLs (webhooks, link checks). Addresses in private ranges are refused
+// unless AllowPrivate is set or they fall in one of AllowedNetworks.
+type OutboundConfig struct {
+	Timeout         time.Duration
+	MaxRedirects    int
+	MaxBodyBytes    int64
+	AllowPrivate    bool
+	AllowedNetworks []netip.Prefix
+}
+
+// LimitsConfig bounds client input: destination URLs longer than
+// MaxURLLength bytes (after normalization) are refused, and request bodies
+// are cut off after MaxBodyBytes. Pastes, file uploads and inbound email have
+// their own, larger limits.
+type LimitsConfig struct {
+	MaxURLLength int
+	MaxBodyBytes int64
+}
+
+// AnalyticsConfig controls click counting. Clicks from the same IP and user
+// agent on the same link within ClickDedupWindow of a counted click are
+// dropped; 0 counts every click. Browser prefetches and link preview bots
+// are only counted with CountPrefetches. Clicks are written in batches of
+// up to ClickBatchSize at least every ClickFlushInterval; a zero interval
+// writes every click on its own. While the database is unavailable, up to
+// ClickBufferSize clicks are kept in memory and written again every
+// ClickBufferRetry; 0 drops them. With ClickLogDir, clicks are written to
+// a write-ahead log in that directory before they are stored, and replayed
+// from it after a crash or an outage.
+type AnalyticsConfig struct {
+	ClickDedupWindow   time.Duration
+	CountPrefetches    bool
+	ClickBatchSize     int
+	ClickFlushInterval time.Duration
+	ClickBufferSize    int
+	ClickBufferRetry   time.Duration
+	ClickLogDir        string
+}
+
+// AnomalyConfig sets the default click spike thresholds. A link's clicks
+// in the last Window are compared with its rate over the Baseline before
+// it; with at least MinClicks clicks, Factor times or more that rate, it
+// is flagged and alerts go to webhooks and AlertEmails, then not again
+// for Cooldown. A Factor of 0 only checks links with their own threshold.
+type AnomalyConfig struct {
+	Window      time.Duration
+	Baseline    time.Duration
+	Cooldown    time.Duration
+	Factor      float64
+	MinClicks   int64
+	AlertEmails []string
+}
+
+// ProbeConfig protects the code space from scanning. Short link lookups
+// that answer 404 are counted per client IP over Window: from Threshold
+// misses on, each lookup waits BaseDelay, doubled per further miss up to
+// MaxDelay, and at BlockAfter misses the client is refused for
+// BlockDuration. Zero Threshold and BlockAfter turn the protection off.
+type ProbeConfig struct {
+	Window        time.Duration
+	Threshold     int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	BlockAfter    int
+	BlockDuration time.Duration
+}
+
+// CaptchaConfig turns on the CAPTCHA check of anonymous POST /shorten
+// requests when Provider (hcaptcha, turnstile or recaptcha) is set. Secret
+// is the provider's secret key; reCAPTCHA v3 responses pass from MinScore
+// on.
+type CaptchaConfig struct {
+	Provider string
+	Secret   string
+	MinScore float64
+}
+
+// ShareConfig controls POST /api/v1/links/{code}/share: each client IP,
+// and each recipient, may get RateLimit shares per RateWindow. SMS is sent
+// through a provider with Twilio's Messages API at SMSAPIURL, and only when
+// SMSAccountSID is set.
+type ShareConfig struct {
+	RateLimit     int
+	RateWindow    time.Duration
+	SMSAPIURL     string
+	SMSAccountSID string
+	SMSAuthToken  string
+	SMSFrom       string
+}
+
+// TLSConfig turns on HTTPS with certificates from an ACME CA (Let's Encrypt
+// by default) for Domains, which may include wildcards such as *.sho.rt.
+// The CA's DNS-01 challenges are answered through DNSProvider ("cloudflare"
+// or "webhook"), so port 80 need not be reachable. Without Domains the
+// server speaks plain HTTP.
+type TLSConfig struct {
+	Domains          []string
+	DirectoryURL     string
+	Email            string
+	CacheDir         string
+	RenewBefore      time.Duration
+	DNSProvider      string
+	PropagationDelay time.Duration
+	CloudflareToken  string
+	WebhookURL       string
+	WebhookToken     string
+}
+
+// EncryptionConfig holds the keys destinations and notes are encrypted with
+// at rest. Key encrypts new values; OldKeys only decrypt, so that values
+// written before a key rotation stay readable until cmd/reencrypt rewrites
+// them. Without Key nothing is encrypted.
+type EncryptionConfig struct {
+	Key     []byte
+	OldKeys [][]byte
+}
+
+// Cipher returns the cipher for the configured keys, or nil when
+// encryption is off.
+func (c EncryptionConfig) Cipher() (*fieldcrypt.Cipher, error) {
+	if c.Key == nil {
+		return nil, nil
+	}
+	return fieldcrypt.New(c.Key, c.OldKeys...)
+}
+
+// RedirectConfig holds operator-wide redirect settings. Headers is parsed
+// from REDIRECT_HEADERS, a JSON object of header name to value.
+// InterstitialBudget is the longest a retargeting interstitial waits for
+// its pixels before redirecting. When SigningKey or SigningKeys are set,
+// links only open with a signature made with one of them; SigningKey is the
+// key without an ID. With PreviewNoRedirect, link preview bots
+// get an empty 200 response instead of the redirect. PolicyCacheTTL is how
+// long redirect blocks and the decisions made with them are cached.
+// SocialPreviewTTL is how long the tags fetched from destinations for
+// social preview pages are cached. QueryPassthrough is what redirects do
+// with the query of the short URL unless the link says otherwise: off,
+// merge or override.
+type RedirectConfig struct {
+	Headers               map[string]string
+	CacheControlTemporary string
+	CacheControlPermanent string
+	InterstitialBudget    time.Duration
+	SigningKey            string
+	SigningKeys           []linksign.Key
+	PreviewNoRedirect     bool
+	PolicyCacheTTL        time.Duration
+	SocialPreviewTTL      time.Duration
+	QueryPassthrough      string
+}
+
+// GeoConfig locates visitors for links limited to some countries.
+// CountryHeader names a header with the visitor's country set by a proxy in
+// TrustedProxies, such as CF-IPCountry behind Cloudflare. IPDatabase is a
+// CSV file of IP ranges and their countries, consulted when the header is
+// missing. BlockedPage is an HTML file shown to visitors a link keeps out,
+// instead of the built-in page.
+type GeoConfig struct {
+	CountryHeader string
+	IPDatabase    string
+	BlockedPage   string
+}
+
+// ChainConfig decides what happens to new destinations that are themselves
+// short links, on BaseURL or on one of ShortenerDomains (or a subdomain):
+// Mode "flag" logs them, "reject" refuses them and "resolve" stores where
+// the chain ends instead, following at most MaxDepth links.
+type ChainConfig struct {
+	Mode             string
+	ShortenerDomains []string
+	MaxDepth         int
+}
+
+// Chained link modes.
+const (
+	ChainedLinksFlag    = "flag"
+	ChainedLinksReject  = "reject"
+	ChainedLinksResolve = "resolve"
+)
+
+// defaultShortenerDomains are well-known public link shorteners.
+const defaultShortenerDomains = "bit.ly,bitly.com,t.co,tinyurl.com,goo.gl,ow.ly,is.gd,buff.ly,rebrand.ly,cutt.ly,shorturl.at,tiny.cc,rb.gy,t.ly,s.id,lnkd.in"
+
+// PasteConfig bounds paste links. Every paste expires: DefaultTTL applies
+// when the client does not ask for one and MaxTTL caps what it may ask for.
+type PasteConfig struct {
+	MaxBytes   int
+	DefaultTTL time.Duration
+	MaxTTL     time.Duration
+}
+
+const (
+	FileStorageFS = "fs"
+	FileStorageS3 = "s3"
+)
+
+// FileConfig configures file links. Storage selects the backend: "fs" keeps
+// files under Dir and always streams them; "s3" uses an S3-compatible bucket
+// with presigned uploads and, unless Stream is set, presigned downloads.
+type FileConfig struct {
+	Storage      string
+	Dir          string
+	S3           S3Config
+	Stream       bool
+	MaxBytes     int64
+	AllowedTypes []string
+	DefaultTTL   time.Duration
+	MaxTTL       time.Duration
+}
+
+type S3Config struct {
+	Endpoint        string
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+func Load() (*Config, error) {
+	provider, err := secrets.FromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure secrets: %w", err)
+	}
+	secret := &secretReader{provider: provider}
+
+	cfg := &Config{
+		DBPath:     getEnv("DB_PATH", "./data/shortener.db"),
+		BaseURL:    getEnv("BASE_URL", "http://localhost:8080"),
+		ServerPort: getEnv("PORT", "8080"),
+
+		TrustedProxies:   splitList(os.Getenv("TRUSTED_PROXIES")),
+		ResponseEnvelope: getEnv("RESPONSE_ENVELOPE", "false") == "true",
+		MaintenanceMode:  getEnv("MAINTENANCE_MODE", "false") == "true",
+		AdminToken:       secret.get("ADMIN_TOKEN"),
+		Slack: SlackConfig{
+			SigningSecret: secret.get("SLACK_SIGNING_SECRET"),
+		},
+		SMTP: SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     getEnv("SMTP_PORT", "587"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: secret.get("SMTP_PASSWORD"),
+			From:     getEnv("SMTP_FROM", "no-reply@localhost"),
+		},
+		Email: EmailConfig{
+			InboundAddress: os.Getenv("INBOUND_EMAIL_ADDRESS"),
+			WebhookToken:   secret.get("INBOUND_EMAIL_TOKEN"),
+		},
+		Redirect: RedirectConfig{
+			CacheControlTemporary: getEnv("REDIRECT_CACHE_CONTROL_TEMPORARY", "no-store"),
+			CacheControlPermanent: getEnv("REDIRECT_CACHE_CONTROL_PERMANENT", "public, max-age=31536000"),
+			SigningKey:            secret.get("LINK_SIGNING_KEY"),
+			PreviewNoRedirect:     getEnv("PREVIEW_NO_REDIRECT", "false") == "true",
+			QueryPassthrough:      getEnv("QUERY_PASSTHROUGH", "off"),
+		},
+		Geo: GeoConfig{
+			CountryHeader: os.Getenv("GEO_COUNTRY_HEADER"),
+			IPDatabase:    os.Getenv("GEO_IP_DATABASE"),
+			BlockedPage:   os.Getenv("GEO_BLOCKED_PAGE"),
+		},
+		Chains: ChainConfig{
+			Mode:             getEnv("CHAINED_LINKS", ChainedLinksFlag),
+			ShortenerDomains: splitList(getEnv("SHORTENER_DOMAINS", defaultShortenerDomains)),
+		},
+		Metrics: MetricsConfig{
+			Enabled:     getEnv("METRICS_ENABLED", "true") == "true",
+			Environment: os.Getenv("METRICS_ENVIRONMENT"),
+		},
+	}
+
+	if secret.err != nil {
+		return nil, secret.err
+	}
+
+	cfg.CodeCase = strings.ToLower(getEnv("SHORT_CODE_CASE", CodeCaseSensitive))
+	if cfg.CodeCase != CodeCaseSensitive && cfg.CodeCase != CodeCaseInsensitive {
+		return nil, fmt.Errorf("invalid SHORT_CODE_CASE %q (expected sensitive or insensitive)", cfg.CodeCase)
+	}
+	cfg.CodeChecksum = getEnv("SHORT_CODE_CHECKSUM", "false") == "true"
+	if cfg.CodeChecksum && cfg.CodeCase == CodeCaseInsensitive {
+		// The check character depends on case, so a code typed in the
+		// wrong case would be refused before the case-insensitive lookup.
+		return nil, fmt.Errorf("SHORT_CODE_CHECKSUM cannot be combined with SHORT_CODE_CASE=insensitive")
+	}
+	if err := loadLinkDefaults(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Region, err = loadRegions(); err != nil {
+		return nil, err
+	}
+
+	cfg.Environment = getEnv("APP_ENV", cfg.Metrics.Environment)
+	flags, err := featureflags.ParseConfig(os.Getenv("FEATURE_FLAGS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid FEATURE_FLAGS: %w", err)
+	}
+	cfg.FeatureFlags = flags
+
+	cfg.ConfigFile = os.Getenv("CONFIG_FILE")
+	dynamicCfg, err := LoadDynamic(cfg.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Dynamic = dynamicCfg
+	cfg.ConfigWatchInterval, err = time.ParseDuration(getEnv("CONFIG_WATCH_INTERVAL", "10s"))
+	if err != nil || cfg.ConfigWatchInterval < 0 {
+		return nil, fmt.Errorf("invalid CONFIG_WATCH_INTERVAL %q", os.Getenv("CONFIG_WATCH_INTERVAL"))
+	}
+
+	pasteCfg, err := loadPaste()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Paste = pasteCfg
+
+	accessLogCfg, err := loadAccessLog()
+	if err != nil {
+		return nil, err
+	}
+	cfg.AccessLog = accessLogCfg
+
+	fileCfg, err := loadFiles(secret)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Files = fileCfg
+
+	cfg.DBConnectAttempts, err = strconv.Atoi(getEnv("DB_CONNECT_ATTEMPTS", "5"))
+	if err != nil || cfg.DBConnectAttempts < 1 {
+		return nil, fmt.Errorf("invalid DB_CONNECT_ATTEMPTS %q", os.Getenv("DB_CONNECT_ATTEMPTS"))
+	}
+	cfg.DBConnectBackoff, err = time.ParseDuration(getEnv("DB_CONNECT_BACKOFF", "500ms"))
+	if err != nil || cfg.DBConnectBackoff < 0 {
+		return nil, fmt.Errorf("invalid DB_CONNECT_BACKOFF %q", os.Getenv("DB_CONNECT_BACKOFF"))
+	}
+
+	cfg.DBSlowQueryThreshold, err = time.ParseDuration(getEnv("DB_SLOW_QUERY_THRESHOLD", "200ms"))
+	if err != nil || cfg.DBSlowQueryThreshold < 0 {
+		return nil, fmt.Errorf("invalid DB_SLOW_QUERY_THRESHOLD %q", os.Getenv("DB_SLOW_QUERY_THRESHOLD"))
+	}
+
+	cfg.DBReplicaPath = os.Getenv("DB_REPLICA_PATH")
+	cfg.DBReplicaStaleness, err = time.ParseDuration(getEnv("DB_REPLICA_STALENESS", "10s"))
+	if err != nil || cfg.DBReplicaStaleness <= 0 {
+		return nil, fmt.Errorf("invalid DB_REPLICA_STALENESS %q", os.Getenv("DB_REPLICA_STALENESS"))
+	}
+
+	if cfg.MaintenanceRetryAfter, err = time.ParseDuration(getEnv("MAINTENANCE_RETRY_AFTER", "5m")); err != nil || cfg.MaintenanceRetryAfter < 0 {
+		return nil, fmt.Errorf("invalid MAINTENANCE_RETRY_AFTER %q", os.Getenv("MAINTENANCE_RETRY_AFTER"))
+	}
+
+	cfg.DBShardPaths = splitList(os.Getenv("DB_SHARD_PATHS"))
+	if len(cfg.DBShardPaths) > 0 && cfg.DBReplicaPath != "" {
+		return nil, fmt.Errorf("DB_SHARD_PATHS cannot be combined with DB_REPLICA_PATH")
+	}
+	cfg.DBDualWritePaths = splitList(os.Getenv("DB_DUAL_WRITE_PATHS"))
+
+	if cfg.LinkCacheSize, err = strconv.Atoi(getEnv("LINK_CACHE_SIZE", "0")); err != nil || cfg.LinkCacheSize < 0 {
+		return nil, fmt.Errorf("invalid LINK_CACHE_SIZE %q", os.Getenv("LINK_CACHE_SIZE"))
+	}
+	if cfg.LinkCacheTTL, err = time.ParseDuration(getEnv("LINK_CACHE_TTL", "1m")); err != nil || cfg.LinkCacheTTL <= 0 {
+		return nil, fmt.Errorf("invalid LINK_CACHE_TTL %q", os.Getenv("LINK_CACHE_TTL"))
+	}
+	if cfg.LinkCacheMissTTL, err = time.ParseDuration(getEnv("LINK_CACHE_MISS_TTL", "5s")); err != nil || cfg.LinkCacheMissTTL < 0 {
+		return nil, fmt.Errorf("invalid LINK_CACHE_MISS_TTL %q", os.Getenv("LINK_CACHE_MISS_TTL"))
+	}
+	if cfg.LinkCacheWarmup, err = strconv.Atoi(getEnv("LINK_CACHE_WARMUP", "1000")); err != nil || cfg.LinkCacheWarmup < 0 {
+		return nil, fmt.Errorf("invalid LINK_CACHE_WARMUP %q", os.Getenv("LINK_CACHE_WARMUP"))
+	}
+	if cfg.LinkCacheStaleTTL, err = time.ParseDuration(getEnv("LINK_CACHE_STALE_TTL", "1h")); err != nil || cfg.LinkCacheStaleTTL < 0 {
+		return nil, fmt.Errorf("invalid LINK_CACHE_STALE_TTL %q", os.Getenv("LINK_CACHE_STALE_TTL"))
+	}
+	cfg.ListenSocket = os.Getenv("LISTEN_SOCKET")
+	mode, err := strconv.ParseUint(getEnv("LISTEN_SOCKET_MODE", "0660"), 8, 32)
+	if err != nil || mode > 0o777 {
+		return nil, fmt.Errorf("invalid LISTEN_SOCKET_MODE %q", os.Getenv("LISTEN_SOCKET_MODE"))
+	}
+	cfg.ListenSocketMode = os.FileMode(mode)
+	if cfg.ShutdownDrain, err = time.ParseDuration(getEnv("SHUTDOWN_DRAIN", "0s")); err != nil || cfg.ShutdownDrain < 0 {
+		return nil, fmt.Errorf("invalid SHUTDOWN_DRAIN %q", os.Getenv("SHUTDOWN_DRAIN"))
+	}
+	if cfg.ShutdownTimeout, err = time.ParseDuration(getEnv("SHUTDOWN_TIMEOUT", "15s")); err != nil || cfg.ShutdownTimeout <= 0 {
+		return nil, fmt.Errorf("invalid SHUTDOWN_TIMEOUT %q", os.Getenv("SHUTDOWN_TIMEOUT"))
+	}
+	if cfg.LinkCacheShards, err = strconv.Atoi(getEnv("LINK_CACHE_SHARDS", "16")); err != nil || cfg.LinkCacheShards < 1 || cfg.LinkCacheShards > 1024 {
+		return nil, fmt.Errorf("invalid LINK_CACHE_SHARDS %q", os.Getenv("LINK_CACHE_SHARDS"))
+	}
+
+	cfg.SchedulerInterval, err = time.ParseDuration(getEnv("SCHEDULER_INTERVAL", "30s"))
+	if err != nil || cfg.SchedulerInterval <= 0 {
+		return nil, fmt.Errorf("invalid SCHEDULER_INTERVAL %q", os.Getenv("SCHEDULER_INTERVAL"))
+	}
+	jobsCfg, err := loadJobs()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Jobs = jobsCfg
+	tasksCfg, err := loadTasks()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Tasks = tasksCfg
+	outboundCfg, err := loadOutbound()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Outbound = outboundCfg
+	limitsCfg, err := loadLimits()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Limits = limitsCfg
+	analyticsCfg, err := loadAnalytics()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Analytics = analyticsCfg
+	anomalyCfg, err := loadAnomaly()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Anomaly = anomalyCfg
+	probeCfg, err := loadProbe()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Probe = probeCfg
+	encryptionCfg, err := loadEncryption(secret)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Encryption = encryptionCfg
+	captchaCfg, err := loadCaptcha(secret)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Captcha = captchaCfg
+	shareCfg, err := loadShare(secret)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Share = shareCfg
+	tlsCfg, err := loadTLS(secret)
+	if err != nil {
+		return nil, err
+	}
+	cfg.TLS = tlsCfg
+
+	budget, err := time.ParseDuration(getEnv("RETARGET_TIME_BUDGET", "1s"))
+	if err != nil || budget <= 0 || budget > 5*time.Second {
+		return nil, fmt.Errorf("invalid RETARGET_TIME_BUDGET %q (must be between 0 and 5s)", os.Getenv("RETARGET_TIME_BUDGET"))
+	}
+	cfg.Redirect.InterstitialBudget = budget
+	policyTTL, err := time.ParseDuration(getEnv("REDIRECT_POLICY_CACHE_TTL", "30s"))
+	if err != nil || policyTTL <= 0 {
+		return nil, fmt.Errorf("invalid REDIRECT_POLICY_CACHE_TTL %q", os.Getenv("REDIRECT_POLICY_CACHE_TTL"))
+	}
+	cfg.Redirect.PolicyCacheTTL = policyTTL
+	socialTTL, err := time.ParseDuration(getEnv("SOCIAL_PREVIEW_CACHE_TTL", "1h"))
+	if err != nil || socialTTL <= 0 {
+		return nil, fmt.Errorf("invalid SOCIAL_PREVIEW_CACHE_TTL %q", os.Getenv("SOCIAL_PREVIEW_CACHE_TTL"))
+	}
+	cfg.Redirect.SocialPreviewTTL = socialTTL
+	switch cfg.Redirect.QueryPassthrough {
+	case "off", "merge", "override":
+	default:
+		return nil, fmt.Errorf("invalid QUERY_PASSTHROUGH %q (expected off, merge or override)", cfg.Redirect.QueryPassthrough)
+	}
+	switch cfg.Chains.Mode {
+	case ChainedLinksFlag, ChainedLinksReject, ChainedLinksResolve:
+	default:
+		return nil, fmt.Errorf("invalid CHAINED_LINKS %q (expected flag, reject or resolve)", cfg.Chains.Mode)
+	}
+	cfg.Chains.MaxDepth, err = strconv.Atoi(getEnv("CHAIN_MAX_DEPTH", "5"))
+	if err != nil || cfg.Chains.MaxDepth <= 0 {
+		return nil, fmt.Errorf("invalid CHAIN_MAX_DEPTH %q", os.Getenv("CHAIN_MAX_DEPTH"))
+	}
+	if key := cfg.Redirect.SigningKey; key != "" && len(key) < minSigningKeyLength {
+		return nil, fmt.Errorf("LINK_SIGNING_KEY must be at least %d characters long", minSigningKeyLength)
+	}
+	if cfg.Redirect.SigningKeys, err = loadSigningKeys(secret); err != nil {
+		return nil, err
+	}
+	if len(cfg.Redirect.SigningKeys) > 0 {
+		if _, err := linksign.NewKeyring(cfg.LinkSigningKeys(), false); err != nil {
+			return nil, fmt.Errorf("invalid LINK_SIGNING_KEYS: %w", err)
+		}
+	}
+
+	if raw := os.Getenv("REDIRECT_HEADERS"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &cfg.Redirect.Headers); err != nil {
+			return nil, fmt.Errorf("invalid REDIRECT_HEADERS: %w", err)
+		}
+		if err := utils.ValidateResponseHeaders(cfg.Redirect.Headers); err != nil {
+			return nil, fmt.Errorf("invalid REDIRECT_HEADERS: %w", err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// LinkSigningKeys returns the keys links are signed with: LINK_SIGNING_KEY,
+// without an ID, and LINK_SIGNING_KEYS. It is empty when links are not
+// signed.
+func (c *Config) LinkSigningKeys() []linksign.Key {
+	var keys []linksign.Key
+	if c.Redirect.SigningKey != "" {
+		keys = append(keys, linksign.Key{Secret: c.Redirect.SigningKey})
+	}
+	return append(keys, c.Redirect.SigningKeys...)
+}
+
+func (c *Config) ListenAddr() string {
+	return ":" + c.ServerPort
+}
+
+func buildCORS(profile string, origins []string) (CORSConfig, error) {
+	profile = strings.ToLower(profile)
+	switch profile {
+	case CORSProfileStrict:
+		return CORSConfig{Profile: profile, AllowedOrigins: defaultStrictOrigins}, nil
+	case CORSProfileOpen:
+		return CORSConfig{Profile: profile, AllowedOrigins: []string{"*"}}, nil
+	case CORSProfileCustom:
+		if len(origins) == 0 {
+			return CORSConfig{}, fmt.Errorf("CORS profile custom requires allowed origins")
+		}
+		return CORSConfig{Profile: profile, AllowedOrigins: origins}, nil
+	default:
+		return CORSConfig{}, fmt.Errorf("unknown CORS_PROFILE %q (expected strict, open or custom)", profile)
+	}
+}
+
+func loadPaste() (PasteConfig, error) {
+	maxBytes, err := strconv.Atoi(getEnv("PASTE_MAX_BYTES", "524288"))
+	if err != nil || maxBytes <= 0 {
+		return PasteConfig{}, fmt.Errorf("invalid PASTE_MAX_BYTES %q", os.Getenv("PASTE_MAX_BYTES"))
+	}
+	defaultTTL, err := time.ParseDuration(getEnv("PASTE_DEFAULT_TTL", "168h"))
+	if err != nil || defaultTTL <= 0 {
+		return PasteConfig{}, fmt.Errorf("invalid PASTE_DEFAULT_TTL %q", os.Getenv("PASTE_DEFAULT_TTL"))
+	}
+	maxTTL, err := time.ParseDuration(getEnv("PASTE_MAX_TTL", "720h"))
+	if err != nil || maxTTL < defaultTTL {
+		return PasteConfig{}, fmt.Errorf("invalid PASTE_MAX_TTL %q (must be at least PASTE_DEFAULT_TTL)", os.Getenv("PASTE_MAX_TTL"))
+	}
+	return PasteConfig{MaxBytes: maxBytes, DefaultTTL: defaultTTL, MaxTTL: maxTTL}, nil
+}
+
+// loadAccessLog parses ACCESS_LOG_SAMPLING, a comma-separated list of
+// route=rate pairs such as "/{code}=0.01,*=0.5".
+func loadAccessLog() (AccessLogConfig, error) {
+	cfg := AccessLogConfig{
+		Enabled:     getEnv("ACCESS_LOG_ENABLED", "true") == "true",
+		SampleRates: map[string]float64{},
+	}
+	for _, pair := range splitList(os.Getenv("ACCESS_LOG_SAMPLING")) {
+		route, raw, ok := strings.Cut(pair, "=")
+		route = strings.TrimSpace(route)
+		rate, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if !ok || route == "" || err != nil || rate < 0 || rate > 1 {
+			return AccessLogConfig{}, fmt.Errorf("invalid ACCESS_LOG_SAMPLING entry %q (expected route=rate with rate between 0 and 1)", pair)
+		}
+		cfg.SampleRates[route] = rate
+	}
+	return cfg, nil
+}
+
+// loadJobs parses JOB_SCHEDULES, a semicolon-separated list of name=spec
+// pairs such as "backup=30 3 * * *;health_check=@every 5m" (cron
+// expressions contain commas, hence the semicolons).
+func loadJobs() (JobsConfig, error) {
+	cfg := JobsConfig{
+		Schedules: map[string]string{},
+		Disabled:  splitList(os.Getenv("JOBS_DISABLED")),
+		BackupDir: os.Getenv("BACKUP_DIR"),
+	}
+	for _, pair := range strings.Split(os.Getenv("JOB_SCHEDULES"), ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(pair, "=")
+		name, spec = strings.TrimSpace(name), strings.TrimSpace(spec)
+		if !ok || name == "" {
+			return JobsConfig{}, fmt.Errorf("invalid JOB_SCHEDULES entry %q (expected name=spec)", pair)
+		}
+		if _, err := cron.Parse(spec); err != nil {
+			return JobsConfig{}, fmt.Errorf("invalid JOB_SCHEDULES entry %q: %w", pair, err)
+		}
+		cfg.Schedules[name] = spec
+	}
+
+	var err error
+	cfg.Jitter, err = time.ParseDuration(getEnv("JOB_JITTER", "0s"))
+	if err != nil || cfg.Jitter < 0 {
+		return JobsConfig{}, fmt.Errorf("invalid JOB_JITTER %q", os.Getenv("JOB_JITTER"))
+	}
+	cfg.ExpiredRetention, err = time.ParseDuration(getEnv("EXPIRED_LINK_RETENTION", "168h"))
+	if err != nil || cfg.ExpiredRetention < 0 {
+		return JobsConfig{}, fmt.Errorf("invalid EXPIRED_LINK_RETENTION %q", os.Getenv("EXPIRED_LINK_RETENTION"))
+	}
+	cfg.TrashRetention, err = time.ParseDuration(getEnv("TRASH_RETENTION", "720h"))
+	if err != nil || cfg.TrashRetention < 0 {
+		return JobsConfig{}, fmt.Errorf("invalid TRASH_RETENTION %q", os.Getenv("TRASH_RETENTION"))
+	}
+	cfg.BackupKeep, err = strconv.Atoi(getEnv("BACKUP_KEEP", "7"))
+	if err != nil || cfg.BackupKeep < 1 {
+		return JobsConfig{}, fmt.Errorf("invalid BACKUP_KEEP %q (must be at least 1)", os.Getenv("BACKUP_KEEP"))
+	}
+	return cfg, nil
+}
+
+// loadRegions parses REGION_PREFIXES and REGION_URLS, comma-separated lists
+// of region=prefix and region=URL pairs such as "eu=e,us=u" and
+// "eu=https://eu.sho.rt,us=https://us.sho.rt", and REGION.
+func loadRegions() (RegionConfig, error) {
+	cfg := RegionConfig{Home: strings.TrimSpace(os.Getenv("REGION"))}
+	urls := map[string]string{}
+	for _, pair := range splitList(os.Getenv("REGION_URLS")) {
+		name, raw, ok := strings.Cut(pair, "=")
+		name, raw = strings.TrimSpace(name), strings.TrimSpace(raw)
+		u, err := url.Parse(raw)
+		if !ok || name == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return RegionConfig{}, fmt.Errorf("invalid REGION_URLS entry %q (expected region=URL)", pair)
+		}
+		urls[name] = strings.TrimSuffix(raw, "/")
+	}
+	for _, pair := range splitList(os.Getenv("REGION_PREFIXES")) {
+		name, prefix, ok := strings.Cut(pair, "=")
+		name, prefix = strings.TrimSpace(name), strings.TrimSpace(prefix)
+		if !ok || name == "" || prefix == "" || !utils.IsReadable(prefix) {
+			return RegionConfig{}, fmt.Errorf("invalid REGION_PREFIXES entry %q (expected region=prefix, the prefix made of letters and digits other than 0, 1, i, l and o)", pair)
+		}
+		for _, other := range cfg.Regions {
+			if other.Name == name {
+				return RegionConfig{}, fmt.Errorf("region %s is listed twice in REGION_PREFIXES", name)
+			}
+			// Compared without case, so that the owner of a code does
+			// not depend on SHORT_CODE_CASE.
+			a, b := strings.ToLower(prefix), strings.ToLower(other.Prefix)
+			if strings.HasPrefix(a, b) || strings.HasPrefix(b, a) {
+				return RegionConfig{}, fmt.Errorf("REGION_PREFIXES of regions %s and %s overlap", other.Name, name)
+			}
+		}
+		if urls[name] == "" {
+			return RegionConfig{}, fmt.Errorf("REGION_URLS has no URL for region %s", name)
+		}
+		cfg.Regions = append(cfg.Regions, Region{Name: name, Prefix: prefix, BaseURL: urls[name]})
+	}
+	if cfg.Home == "" {
+		if len(cfg.Regions) > 0 {
+			return RegionConfig{}, fmt.Errorf("REGION_PREFIXES requires REGION")
+		}
+		return cfg, nil
+	}
+	if _, ok := cfg.HomeRegion(); !ok {
+		return RegionConfig{}, fmt.Errorf("REGION %q is not listed in REGION_PREFIXES", cfg.Home)
+	}
+	return cfg, nil
+}
+
+func loadTasks() (TasksConfig, error) {
+	var cfg TasksConfig
+	settings := []struct {
+		name, fallback string
+		target         *int
+	}{
+		{"TASK_WORKERS", "4", &cfg.Workers},
+		{"TASK_QUEUE_SIZE", "1000", &cfg.QueueSize},
+		{"TASK_MAX_ATTEMPTS", "3", &cfg.MaxAttempts},
+	}
+	for _, s := range settings {
+		n, err := strconv.Atoi(getEnv(s.name, s.fallback))
+		if err != nil || n < 1 {
+			return TasksConfig{}, fmt.Errorf("invalid %s %q (must be a positive integer)", s.name, os.Getenv(s.name))
+		}
+		*s.target = n
+	}
+	return cfg, nil
+}
+
+func loadOutbound() (OutboundConfig, error) {
+	cfg := OutboundConfig{AllowPrivate: getEnv("OUTBOUND_ALLOW_PRIVATE", "false") == "true"}
+	var err error
+	cfg.Timeout, err = time.ParseDuration(getEnv("OUTBOUND_TIMEOUT", "5s"))
+	if err != nil || cfg.Timeout <= 0 {
+		return OutboundConfig{}, fmt.Errorf("invalid OUTBOUND_TIMEOUT %q", os.Getenv("OUTBOUND_TIMEOUT"))
+	}
+	cfg.MaxRedirects, err = strconv.Atoi(getEnv("OUTBOUND_MAX_REDIRECTS", "5"))
+	if err != nil || cfg.MaxRedirects < 0 {
+		return OutboundConfig{}, fmt.Errorf("invalid OUTBOUND_MAX_REDIRECTS %q", os.Getenv("OUTBOUND_MAX_REDIRECTS"))
+	}
+	cfg.MaxBodyBytes, err = strconv.ParseInt(getEnv("OUTBOUND_MAX_BODY_BYTES", "1048576"), 10, 64)
+	if err != nil || cfg.MaxBodyBytes <= 0 {
+		return OutboundConfig{}, fmt.Errorf("invalid OUTBOUND_MAX_BODY_BYTES %q", os.Getenv("OUTBOUND_MAX_BODY_BYTES"))
+	}
+	for _, raw := range splitList(os.Getenv("OUTBOUND_ALLOWED_NETWORKS")) {
+		prefix, err := netip.ParsePrefix(raw)
+		if err != nil {
+			return OutboundConfig{}, fmt.Errorf("invalid OUTBOUND_ALLOWED_NETWORKS entry %q: %w", raw, err)
+		}
+		cfg.AllowedNetworks = append(cfg.AllowedNetworks, prefix)
+	}
+	return cfg, nil
+}
+
+func loadLimits() (LimitsConfig, error) {
+	var cfg LimitsConfig
+	var err error
+	cfg.MaxURLLength, err = strconv.Atoi(getEnv("MAX_URL_LENGTH", "2048"))
+	if err != nil || cfg.MaxURLLength <= 0 {
+		return LimitsConfig{}, fmt.Errorf("invalid MAX_URL_LENGTH %q", os.Getenv("MAX_URL_LENGTH"))
+	}
+	cfg.MaxBodyBytes, err = strconv.ParseInt(getEnv("MAX_REQUEST_BODY_BYTES", "65536"), 10, 64)
+	if err != nil || cfg.MaxBodyBytes < int64(cfg.MaxURLLength) {
+		return LimitsConfig{}, fmt.Errorf("invalid MAX_REQUEST_BODY_BYTES %q (must be at least MAX_URL_LENGTH)", os.Getenv("MAX_REQUEST_BODY_BYTES"))
+	}
+	return cfg, nil
+}
+
+// loadLinkDefaults reads the defaults applied to new links.
+func loadLinkDefaults(cfg *Config) error {
+	var err error
+	cfg.CodeLength, err = strconv.Atoi(getEnv("SHORT_CODE_LENGTH", "7"))
+	if err != nil || cfg.CodeLength < minCodeLength || cfg.CodeLength > maxCodeLength {
+		return fmt.Errorf("invalid SHORT_CODE_LENGTH %q (expected %d to %d)", os.Getenv("SHORT_CODE_LENGTH"), minCodeLength, maxCodeLength)
+	}
+	if raw := os.Getenv("DEFAULT_REDIRECT_TYPE"); raw != "" {
+		status, err := strconv.Atoi(raw)
+		if err != nil || (status != 301 && status != 302 && status != 307 && status != 308) {
+			return fmt.Errorf("invalid DEFAULT_REDIRECT_TYPE %q (expected 301, 302, 307 or 308)", raw)
+		}
+		cfg.DefaultRedirectType = status
+	}
+	cfg.DefaultLinkTTL, err = time.ParseDuration(getEnv("DEFAULT_LINK_TTL", "0s"))
+	if err != nil || cfg.DefaultLinkTTL < 0 {
+		return fmt.Errorf("invalid DEFAULT_LINK_TTL %q", os.Getenv("DEFAULT_LINK_TTL"))
+	}
+	return nil
+}
+
+func loadAnalytics() (AnalyticsConfig, error) {
+	window, err := time.ParseDuration(getEnv("CLICK_DEDUP_WINDOW", "0s"))
+	if err != nil || window < 0 {
+		return AnalyticsConfig{}, fmt.Errorf("invalid CLICK_DEDUP_WINDOW %q", os.Getenv("CLICK_DEDUP_WINDOW"))
+	}
+	batchSize, err := strconv.Atoi(getEnv("CLICK_BATCH_SIZE", "100"))
+	if err != nil || batchSize < 1 {
+		return AnalyticsConfig{}, fmt.Errorf("invalid CLICK_BATCH_SIZE %q", os.Getenv("CLICK_BATCH_SIZE"))
+	}
+	flushInterval, err := time.ParseDuration(getEnv("CLICK_FLUSH_INTERVAL", "1s"))
+	if err != nil || flushInterval < 0 {
+		return AnalyticsConfig{}, fmt.Errorf("invalid CLICK_FLUSH_INTERVAL %q", os.Getenv("CLICK_FLUSH_INTERVAL"))
+	}
+	bufferSize, err := strconv.Atoi(getEnv("CLICK_BUFFER_SIZE", "10000"))
+	if err != nil || bufferSize < 0 {
+		return AnalyticsConfig{}, fmt.Errorf("invalid CLICK_BUFFER_SIZE %q", os.Getenv("CLICK_BUFFER_SIZE"))
+	}
+	bufferRetry, err := time.ParseDuration(getEnv("CLICK_BUFFER_RETRY", "5s"))
+	if err != nil || bufferRetry <= 0 {
+		return AnalyticsConfig{}, fmt.Errorf("invalid CLICK_BUFFER_RETRY %q", os.Getenv("CLICK_BUFFER_RETRY"))
+	}
+	return AnalyticsConfig{
+		ClickDedupWindow:   window,
+		CountPrefetches:    getEnv("COUNT_PREFETCH_CLICKS", "false") == "true",
+		ClickBatchSize:     batchSize,
+		ClickFlushInterval: flushInterval,
+		ClickBufferSize:    bufferSize,
+		ClickBufferRetry:   bufferRetry,
+		ClickLogDir:        os.Getenv("CLICK_LOG_DIR"),
+	}, nil
+}
+
+func loadAnomaly() (AnomalyConfig, error) {
+	cfg := AnomalyConfig{AlertEmails: splitList(os.Getenv("ANOMALY_ALERT_EMAILS"))}
+	var err error
+	if cfg.Window, err = time.ParseDuration(getEnv("ANOMALY_WINDOW", "1h")); err != nil || cfg.Window <= 0 {
+		return AnomalyConfig{}, fmt.Errorf("invalid ANOMALY_WINDOW %q", os.Getenv("ANOMALY_WINDOW"))
+	}
+	if cfg.Baseline, err = time.ParseDuration(getEnv("ANOMALY_BASELINE", "168h")); err != nil || cfg.Baseline < cfg.Window {
+		return AnomalyConfig{}, fmt.Errorf("invalid ANOMALY_BASELINE %q (must be at least ANOMALY_WINDOW)", os.Getenv("ANOMALY_BASELINE"))
+	}
+	if cfg.Cooldown, err = time.ParseDuration(getEnv("ANOMALY_COOLDOWN", "24h")); err != nil || cfg.Cooldown < 0 {
+		return AnomalyConfig{}, fmt.Errorf("invalid ANOMALY_COOLDOWN %q", os.Getenv("ANOMALY_COOLDOWN"))
+	}
+	if cfg.Factor, err = strconv.ParseFloat(getEnv("ANOMALY_FACTOR", "5"), 64); err != nil || !(cfg.Factor == 0 || cfg.Factor > 1) {
+		return AnomalyConfig{}, fmt.Errorf("invalid ANOMALY_FACTOR %q (must be greater than 1, or 0 to turn the default off)", os.Getenv("ANOMALY_FACTOR"))
+	}
+	if cfg.MinClicks, err = strconv.ParseInt(getEnv("ANOMALY_MIN_CLICKS", "50"), 10, 64); err != nil || cfg.MinClicks < 0 {
+		return AnomalyConfig{}, fmt.Errorf("invalid ANOMALY_MIN_CLICKS %q", os.Getenv("ANOMALY_MIN_CLICKS"))
+	}
+	return cfg, nil
+}
+
+func loadProbe() (ProbeConfig, error) {
+	var cfg ProbeConfig
+	var err error
+	if cfg.Window, err = time.ParseDuration(getEnv("PROBE_WINDOW", "10m")); err != nil || cfg.Window <= 0 {
+		return ProbeConfig{}, fmt.Errorf("invalid PROBE_WINDOW %q", os.Getenv("PROBE_WINDOW"))
+	}
+	if cfg.Threshold, err = strconv.Atoi(getEnv("PROBE_THRESHOLD", "20")); err != nil || cfg.Threshold < 0 {
+		return ProbeConfig{}, fmt.Errorf("invalid PROBE_THRESHOLD %q", os.Getenv("PROBE_THRESHOLD"))
+	}
+	if cfg.BaseDelay, err = time.ParseDuration(getEnv("PROBE_BASE_DELAY", "100ms")); err != nil || cfg.BaseDelay < 0 {
+		return ProbeConfig{}, fmt.Errorf("invalid PROBE_BASE_DELAY %q", os.Getenv("PROBE_BASE_DELAY"))
+	}
+	if cfg.MaxDelay, err = time.ParseDuration(getEnv("PROBE_MAX_DELAY", "5s")); err != nil || cfg.MaxDelay < cfg.BaseDelay {
+		return ProbeConfig{}, fmt.Errorf("invalid PROBE_MAX_DELAY %q (must be at least PROBE_BASE_DELAY)", os.Getenv("PROBE_MAX_DELAY"))
+	}
+	if cfg.BlockAfter, err = strconv.Atoi(getEnv("PROBE_BLOCK_AFTER", "100")); err != nil || cfg.BlockAfter < 0 {
+		return ProbeConfig{}, fmt.Errorf("invalid PROBE_BLOCK_AFTER %q", os.Getenv("PROBE_BLOCK_AFTER"))
+	}
+	if cfg.BlockDuration, err = time.ParseDuration(getEnv("PROBE_BLOCK_DURATION", "15m")); err != nil || cfg.BlockDuration <= 0 {
+		return ProbeConfig{}, fmt.Errorf("invalid PROBE_BLOCK_DURATION %q", os.Getenv("PROBE_BLOCK_DURATION"))
+	}
+	return cfg, nil
+}
+
+func loadCaptcha(secret *secretReader) (CaptchaConfig, error) {
+	cfg := CaptchaConfig{Provider: strings.ToLower(os.Getenv("CAPTCHA_PROVIDER"))}
+	if cfg.Provider == "" {
+		return cfg, nil
+	}
+	switch cfg.Provider {
+	case "hcaptcha", "turnstile", "recaptcha":
+	default:
+		return CaptchaConfig{}, fmt.Errorf("invalid CAPTCHA_PROVIDER %q (must be hcaptcha, turnstile or recaptcha)", os.Getenv("CAPTCHA_PROVIDER"))
+	}
+	cfg.Secret = secret.get("CAPTCHA_SECRET")
+	if secret.err != nil {
+		return CaptchaConfig{}, secret.err
+	}
+	if cfg.Secret == "" {
+		return CaptchaConfig{}, fmt.Errorf("CAPTCHA_SECRET is required when CAPTCHA_PROVIDER is %q", cfg.Provider)
+	}
+	var err error
+	if cfg.MinScore, err = strconv.ParseFloat(getEnv("CAPTCHA_MIN_SCORE", "0.5"), 64); err != nil || cfg.MinScore < 0 || cfg.MinScore > 1 {
+		return CaptchaConfig{}, fmt.Errorf("invalid CAPTCHA_MIN_SCORE %q (must be between 0 and 1)", os.Getenv("CAPTCHA_MIN_SCORE"))
+	}
+	return cfg, nil
+}
+
+func loadShare(secret *secretReader) (ShareConfig, error) {
+	cfg := ShareConfig{
+		SMSAPIURL:     getEnv("SMS_API_URL", "https://api.twilio.com"),
+		SMSAccountSID: os.Getenv("SMS_ACCOUNT_SID"),
+		SMSAuthToken:  secret.get("SMS_AUTH_TOKEN"),
+		SMSFrom:       os.Getenv("SMS_FROM"),
+	}
+	if secret.err != nil {
+		return ShareConfig{}, secret.err
+	}
+	var err error
+	if cfg.RateLimit, err = strconv.Atoi(getEnv("SHARE_RATE_LIMIT", "10")); err != nil || cfg.RateLimit < 0 {
+		return ShareConfig{}, fmt.Errorf("invalid SHARE_RATE_LIMIT %q", os.Getenv("SHARE_RATE_LIMIT"))
+	}
+	if cfg.RateWindow, err = time.ParseDuration(getEnv("SHARE_RATE_WINDOW", "1h")); err != nil || cfg.RateWindow <= 0 {
+		return ShareConfig{}, fmt.Errorf("invalid SHARE_RATE_WINDOW %q", os.Getenv("SHARE_RATE_WINDOW"))
+	}
+	if cfg.SMSAccountSID != "" && (cfg.SMSAuthToken == "" || cfg.SMSFrom == "") {
+		return ShareConfig{}, fmt.Errorf("SMS_AUTH_TOKEN and SMS_FROM are required when SMS_ACCOUNT_SID is set")
+	}
+	return cfg, nil
+}
+
+func loadTLS(secret *secretReader) (TLSConfig, error) {
+	cfg := TLSConfig{
+		Domains:         splitList(strings.ToLower(os.Getenv("TLS_DOMAINS"))),
+		DirectoryURL:    getEnv("ACME_DIRECTORY_URL", "https://acme-v02.api.letsencrypt.org/directory"),
+		Email:           os.Getenv("ACME_EMAIL"),
+		CacheDir:        getEnv("ACME_CACHE_DIR", "./data/acme"),
+		DNSProvider:     os.Getenv("ACME_DNS_PROVIDER"),
+		CloudflareToken: secret.get("CLOUDFLARE_API_TOKEN"),
+		WebhookURL:      os.Getenv("ACME_DNS_WEBHOOK_URL"),
+		WebhookToken:    secret.get("ACME_DNS_WEBHOOK_TOKEN"),
+	}
+	if secret.err != nil {
+		return TLSConfig{}, secret.err
+	}
+	var err error
+	if cfg.RenewBefore, err = time.ParseDuration(getEnv("ACME_RENEW_BEFORE", "720h")); err != nil || cfg.RenewBefore <= 0 {
+		return TLSConfig{}, fmt.Errorf("invalid ACME_RENEW_BEFORE %q", os.Getenv("ACME_RENEW_BEFORE"))
+	}
+	if cfg.PropagationDelay, err = time.ParseDuration(getEnv("ACME_DNS_PROPAGATION_DELAY", "30s")); err != nil || cfg.PropagationDelay < 0 {
+		return TLSConfig{}, fmt.Errorf("invalid ACME_DNS_PROPAGATION_DELAY %q", os.Getenv("ACME_DNS_PROPAGATION_DELAY"))
+	}
+	if len(cfg.Domains) == 0 {
+		return cfg, nil
+	}
+	for _, domain := range cfg.Domains {
+		name := strings.TrimPrefix(domain, "*.")
+		if strings.ContainsAny(name, "*/:@ ") || !strings.Contains(name, ".") {
+			return TLSConfig{}, fmt.Errorf("invalid TLS_DOMAINS entry %q", domain)
+		}
+	}
+	switch cfg.DNSProvider {
+	case "cloudflare":
+		if cfg.CloudflareToken == "" {
+			return TLSConfig{}, fmt.Errorf("CLOUDFLARE_API_TOKEN is required when ACME_DNS_PROVIDER is cloudflare")
+		}
+	case "webhook":
+		if cfg.WebhookURL == "" {
+			return TLSConfig{}, fmt.Errorf("ACME_DNS_WEBHOOK_URL is required when ACME_DNS_PROVIDER is webhook")
+		}
+	default:
+		return TLSConfig{}, fmt.Errorf("invalid ACME_DNS_PROVIDER %q (expected cloudflare or webhook)", cfg.DNSProvider)
+	}
+	return cfg, nil
+}
+
+func loadEncryption(secret *secretReader) (EncryptionConfig, error) {
+	var cfg EncryptionConfig
+	if raw := secret.get("DATA_ENCRYPTION_KEY"); raw != "" {
+		key, err := fieldcrypt.ParseKey(raw)
+		if err != nil {
+			return EncryptionConfig{}, fmt.Errorf("invalid DATA_ENCRYPTION_KEY: %w", err)
+		}
+		cfg.Key = key
+	}
+	for _, raw := range splitList(secret.get("DATA_ENCRYPTION_OLD_KEYS")) {
+		key, err := fieldcrypt.ParseKey(raw)
+		if err != nil {
+			return EncryptionConfig{}, fmt.Errorf("invalid DATA_ENCRYPTION_OLD_KEYS: %w", err)
+		}
+		cfg.OldKeys = append(cfg.OldKeys, key)
+	}
+	if secret.err != nil {
+		return EncryptionConfig{}, secret.err
+	}
+	if cfg.Key == nil && len(cfg.OldKeys) > 0 {
+		return EncryptionConfig{}, fmt.Errorf("DATA_ENCRYPTION_OLD_KEYS requires DATA_ENCRYPTION_KEY")
+	}
+	return cfg, nil
+}
+
+// loadSigningKeys parses LINK_SIGNING_KEYS, a JSON array of
+// {"kid": ..., "key": ..., "not_before": ...} objects.
+func loadSigningKeys(secret *secretReader) ([]linksign.Key, error) {
+	raw := secret.get("LINK_SIGNING_KEYS")
+	if secret.err != nil {
+		return nil, secret.err
+	}
+	if raw == "" {
+		return nil, nil
+	}
+	var entries []struct {
+		ID        string    `json:"kid"`
+		Key       string    `json:"key"`
+		NotBefore time.Time `json:"not_before"`
+	}
+	if err := json.Unmarshal([]byte(raw), &entries); err != nil {
+		return nil, fmt.Errorf("invalid LINK_SIGNING_KEYS: %w", err)
+	}
+	keys := make([]linksign.Key, 0, len(entries))
+	for _, entry := range entries {
+		if !signingKeyIDPattern.MatchString(entry.ID) {
+			return nil, fmt.Errorf("invalid LINK_SIGNING_KEYS: kid %q must be 1 to 32 letters, digits, dots, dashes or underscores", entry.ID)
+		}
+		if len(entry.Key) < minSigningKeyLength {
+			return nil, fmt.Errorf("invalid LINK_SIGNING_KEYS: key %q must be at least %d characters long", entry.ID, minSigningKeyLength)
+		}
+		keys = append(keys, linksign.Key{ID: entry.ID, Secret: entry.Key, NotBefore: entry.NotBefore})
+	}
+	return keys, nil
+}
+
+func loadFiles(secret *secretReader) (FileConfig, error) {
+	cfg := FileConfig{
+		Storage: strings.ToLower(getEnv("FILE_STORAGE", FileStorageFS)),
+		Dir:     getEnv("FILE_STORAGE_DIR", "./data/files"),
+		S3: S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			Region:          getEnv("S3_REGION", "us-east-1"),
+			AccessKeyID:     secret.get("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: secret.get("S3_SECRET_ACCESS_KEY"),
+		},
+		Stream:       getEnv("FILE_DELIVERY", "redirect") == "stream",
+		AllowedTypes: splitList(getEnv("FILE_ALLOWED_TYPES", "application/pdf,image/png,image/jpeg,image/gif,image/webp,text/plain,application/zip")),
+	}
+	if secret.err != nil {
+		return FileConfig{}, secret.err
+	}
+	if cfg.Storage != FileStorageFS && cfg.Storage != FileStorageS3 {
+		return FileConfig{}, fmt.Errorf("unknown FILE_STORAGE %q (expected fs or s3)", cfg.Storage)
+	}
+
+	maxBytes, err := strconv.ParseInt(getEnv("FILE_MAX_BYTES", "10485760"), 10, 64)
+	if err != nil || maxBytes <= 0 {
+		return FileConfig{}, fmt.Errorf("invalid FILE_MAX_BYTES %q", os.Getenv("FILE_MAX_BYTES"))
+	}
+	cfg.MaxBytes = maxBytes
+	cfg.DefaultTTL, err = time.ParseDuration(getEnv("FILE_DEFAULT_TTL", "168h"))
+	if err != nil || cfg.DefaultTTL <= 0 {
+		return FileConfig{}, fmt.Errorf("invalid FILE_DEFAULT_TTL %q", os.Getenv("FILE_DEFAULT_TTL"))
+	}
+	cfg.MaxTTL, err = time.ParseDuration(getEnv("FILE_MAX_TTL", "720h"))
+	if err != nil || cfg.MaxTTL < cfg.DefaultTTL {
+		return FileConfig{}, fmt.Errorf("invalid FILE_MAX_TTL %q (must be at least FILE_DEFAULT_TTL)", os.Getenv("FILE_MAX_TTL"))
+	}
+	return cfg, nil
+}
+
+// secretReader looks up secrets for Load and keeps the first error, so a
+// whole group of settings can be read before it is checked.
+type secretReader struct {
+	provider secrets.Provider
+	err      error
+}
+
+func (r *secretReader) get(name string) string {
+	v, _, err := r.provider.Lookup(name)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+	return v
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func splitList(raw string) []string {
+	var out []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DynamicConfig holds the settings that can change while the server runs.
+// They start from the environment; when CONFIG_FILE is set, the JSON file
+// overrides them and is read again on SIGHUP or when it changes on disk.
+type DynamicConfig struct {
+	CORS           CORSConfig
+	RateLimit      RateLimitConfig
+	BlockedDomains []string
+	ReservedCodes  []string
+	// PrivateDestinations decides what happens to destinations that resolve
+	// to private, loopback or link-local addresses: reject, flag (accept
+	// and log) or allow.
+	PrivateDestinations string
+}
+
+const (
+	PrivateDestinationsReject = "reject"
+	PrivateDestinationsFlag   = "flag"
+	PrivateDestinationsAllow  = "allow"
+)
+
+// RateLimitConfig allows every client IP Requests mutating requests per
+// Window. Zero Requests disables the limit.
+type RateLimitConfig struct {
+	Requests int
+	Window   time.Duration
+}
+
+// dynamicFile is the layout of CONFIG_FILE. Absent keys keep the value from
+// the environment; an empty list clears it.
+type dynamicFile struct {
+	CORSProfile         *string   `json:"cors_profile"`
+	CORSAllowedOrigins  *[]string `json:"cors_allowed_origins"`
+	RateLimitRequests   *int      `json:"rate_limit_requests"`
+	RateLimitWindow     *string   `json:"rate_limit_window"`
+	BlockedDomains      *[]string `json:"blocked_domains"`
+	ReservedCodes       *[]string `json:"reserved_codes"`
+	PrivateDestinations *string   `json:"private_destinations"`
+}
+
+// LoadDynamic reads the dynamic settings from the environment and then from
+// path, if it is not empty. Nothing is returned unless every setting is valid.
+func LoadDynamic(path string) (DynamicConfig, error) {
+	profile := getEnv("CORS_PROFILE", CORSProfileStrict)
+	origins := splitList(os.Getenv("CORS_ALLOWED_ORIGINS"))
+	window := getEnv("RATE_LIMIT_WINDOW", "1m")
+	blocked := splitList(os.Getenv("BLOCKED_DOMAINS"))
+	reserved := splitList(os.Getenv("RESERVED_CODES"))
+	private := getEnv("PRIVATE_DESTINATIONS", PrivateDestinationsReject)
+	requests, err := strconv.Atoi(getEnv("RATE_LIMIT_REQUESTS", "0"))
+	if err != nil {
+		return DynamicConfig{}, fmt.Errorf("invalid RATE_LIMIT_REQUESTS %q", os.Getenv("RATE_LIMIT_REQUESTS"))
+	}
+
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return DynamicConfig{}, fmt.Errorf("failed to read CONFIG_FILE: %w", err)
+		}
+		var file dynamicFile
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&file); err != nil {
+			return DynamicConfig{}, fmt.Errorf("invalid CONFIG_FILE %s: %w", path, err)
+		}
+		if file.CORSProfile != nil {
+			profile = *file.CORSProfile
+		}
+		if file.CORSAllowedOrigins != nil {
+			origins = *file.CORSAllowedOrigins
+		}
+		if file.RateLimitRequests != nil {
+			requests = *file.RateLimitRequests
+		}
+		if file.RateLimitWindow != nil {
+			window = *file.RateLimitWindow
+		}
+		if file.BlockedDomains != nil {
+			blocked = *file.BlockedDomains
+		}
+		if file.ReservedCodes != nil {
+			reserved = *file.ReservedCodes
+		}
+		if file.PrivateDestinations != nil {
+			private = *file.PrivateDestinations
+		}
+	}
+
+	cfg := DynamicConfig{}
+	if cfg.CORS, err = buildCORS(profile, origins); err != nil {
+		return DynamicConfig{}, err
+	}
+	cfg.RateLimit.Requests = requests
+	cfg.RateLimit.Window, err = time.ParseDuration(window)
+	if err != nil || requests < 0 || cfg.RateLimit.Window <= 0 {
+		return DynamicConfig{}, fmt.Errorf("invalid rate limit %d per %q", requests, window)
+	}
+	for _, domain := range blocked {
+		domain = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "*"), "."), ".")
+		if domain == "" || strings.ContainsAny(domain, "/:@ ") {
+			return DynamicConfig{}, fmt.Errorf("invalid blocked domain %q", domain)
+		}
+		cfg.BlockedDomains = append(cfg.BlockedDomains, domain)
+	}
+	for _, code := range reserved {
+		if code = strings.TrimSpace(code); code != "" {
+			cfg.ReservedCodes = append(cfg.ReservedCodes, code)
+		}
+	}
+	switch private {
+	case PrivateDestinationsReject, PrivateDestinationsFlag, PrivateDestinationsAllow:
+		cfg.PrivateDestinations = private
+	default:
+		return DynamicConfig{}, fmt.Errorf("invalid private destinations policy %q (expected reject, flag or allow)", private)
+	}
+	return cfg, nil
+}
+
+// DynamicStore holds the current DynamicConfig snapshot. Readers get the
+// snapshot without locking; Reload validates a new one completely before
+// swapping it in, so a broken file never takes effect.
+type DynamicStore struct {
+	path    string
+	current atomic.Pointer[DynamicConfig]
+
+	mu        sync.Mutex
+	listeners []func(DynamicConfig)
+	modTime   time.Time
+}
+
+func NewDynamicStore(path string, initial DynamicConfig) *DynamicStore {
+	s := &DynamicStore{path: path}
+	s.current.Store(&initial)
+	if path != "" {
+		if info, err := os.Stat(path); err == nil {
+			s.modTime = info.ModTime()
+		}
+	}
+	return s
+}
+
+func (s *DynamicStore) Current() DynamicConfig {
+	return *s.current.Load()
+}
+
+// OnChange calls fn with the current snapshot now and with every snapshot
+// that a later Reload swaps in.
+func (s *DynamicStore) OnChange(fn func(DynamicConfig)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+	fn(*s.current.Load())
+}
+
+func (s *DynamicStore) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path != "" {
+		if info, err := os.Stat(s.path); err == nil {
+			s.modTime = info.ModTime()
+		}
+	}
+	cfg, err := LoadDynamic(s.path)
+	if err != nil {
+		return err
+	}
+	s.current.Store(&cfg)
+	for _, fn := range s.listeners {
+		fn(cfg)
+	}
+	return nil
+}
+
+// Watch reloads whenever the modification time of the config file changes,
+// checking every interval, until the returned stop function is called.
+func (s *DynamicStore) Watch(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !s.changedOnDisk() {
+					continue
+				}
+				if err := s.Reload(); err != nil {
+					log.Printf("Config reload failed, keeping previous settings: %v", err)
+				} else {
+					log.Printf("Config reloaded from %s", s.path)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (s *DynamicStore) changedOnDisk() bool {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !info.ModTime().Equal(s.modTime)
+}
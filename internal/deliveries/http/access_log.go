@@ -0,0 +1,65 @@
+package http
+
+import (
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"template/internal/pkg/clientip"
+)
+
+// AccessLog writes one JSON line per request. Routes (as labeled by the
+// route table, with "*" for the rest) can be sampled so that the redirect
+// route does not flood the log; responses with a 4xx or 5xx status are
+// always logged. Every line carries the sample_rate it was kept at, so
+// counts can be scaled back up.
+type AccessLog struct {
+	logger *slog.Logger
+	rates  map[string]float64
+	routes *RouteTable
+}
+
+func NewAccessLog(w io.Writer, rates map[string]float64, routes *RouteTable) *AccessLog {
+	return &AccessLog{logger: slog.New(slog.NewJSONHandler(w, nil)), rates: rates, routes: routes}
+}
+
+func (a *AccessLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route := a.routes.Label(r.URL.Path)
+		rate := 1.0
+		if rec.status < 400 {
+			rate = a.sampleRate(route)
+			if rate < 1 && rand.Float64() >= rate {
+				return
+			}
+		}
+		a.logger.LogAttrs(r.Context(), slog.LevelInfo, "request",
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int64("bytes", rec.bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", clientip.FromRequest(r)),
+			slog.String("user_agent", r.UserAgent()),
+			slog.String("request_id", r.Header.Get("X-Request-ID")),
+			slog.Float64("sample_rate", rate),
+		)
+	})
+}
+
+func (a *AccessLog) sampleRate(route string) float64 {
+	if rate, ok := a.rates[route]; ok {
+		return rate
+	}
+	if rate, ok := a.rates["*"]; ok {
+		return rate
+	}
+	return 1
+}
@@ -0,0 +1,795 @@
+package http
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"template/internal/pkg/cron"
+	"template/internal/pkg/featureflags"
+	"template/internal/pkg/ratelimit"
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// SetFlagRequest is the body of PUT /api/v1/admin/flags/{name}. Rollout
+// defaults to 100 percent.
+type SetFlagRequest struct {
+	Enabled      bool     `json:"enabled"`
+	Rollout      *int     `json:"rollout"`
+	Environments []string `json:"environments"`
+}
+
+// MergeDuplicatesRequest is the body of POST /api/v1/admin/duplicates/merge:
+// codes become 301 redirects to canonical.
+type MergeDuplicatesRequest struct {
+	Canonical string   `json:"canonical"`
+	Codes     []string `json:"codes"`
+}
+
+// AddBlockRequest is the body of POST /api/v1/admin/blocks. Kind is "code",
+// "destination" or "domain".
+type AddBlockRequest struct {
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// AnomalyListResponse is a page of GET /api/v1/admin/anomalies, newest
+// first; NextCursor is empty on the last page.
+type AnomalyListResponse struct {
+	Items      []shortner.ClickAnomaly `json:"items"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
+// AddHoneypotRequest is the body of POST /api/v1/admin/honeypots.
+type AddHoneypotRequest struct {
+	Code string `json:"code"`
+	Note string `json:"note"`
+}
+
+type BrandingRequest struct {
+	LogoURL         string `json:"logo_url"`
+	PrimaryColor    string `json:"primary_color"`
+	BackgroundColor string `json:"background_color"`
+	TextColor       string `json:"text_color"`
+	Footer          string `json:"footer"`
+	CSS             string `json:"css"`
+}
+
+// MaintenanceRequest is the body of PUT /api/v1/admin/maintenance;
+// RetryAfter is in seconds.
+type MaintenanceRequest struct {
+	Enabled    bool   `json:"enabled"`
+	Message    string `json:"message"`
+	RetryAfter int    `json:"retry_after"`
+}
+
+// PutSlackWorkspaceRequest is the body of PUT
+// /api/v1/admin/slack-workspaces/{team_id}.
+type PutSlackWorkspaceRequest struct {
+	TeamName      string `json:"team_name"`
+	SigningSecret string `json:"signing_secret"`
+}
+
+// HoneypotHitListResponse is a page of GET /api/v1/admin/honeypot-hits,
+// newest first; NextCursor is empty on the last page.
+type HoneypotHitListResponse struct {
+	Items      []shortner.HoneypotHit `json:"items"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+const (
+	defaultAnomalyLimit = 50
+	maxAnomalyLimit     = 100
+
+	cursorPrefixAnomalies    = "anomalies:"
+	cursorPrefixHoneypotHits = "honeypot-hits:"
+)
+
+// ProbeOffenders lists and releases the clients held back for probing
+// for short codes.
+type ProbeOffenders interface {
+	Offenders(now time.Time) []ratelimit.Offender
+	Unblock(key string) bool
+}
+
+// JobScheduler reports the state of the background jobs.
+type JobScheduler interface {
+	Status() []cron.JobStatus
+}
+
+// AdminHandler serves the operator-only API. Every request must carry
+// "Authorization: Bearer <ADMIN_TOKEN>"; with no token configured the routes
+// reject everything.
+type AdminHandler struct {
+	admin      services.AdminService
+	flags      services.FlagService
+	duplicates services.DuplicateService
+	blocks     services.RedirectPolicyService
+	jobs       JobScheduler
+	anomalies  services.AnomalyService
+	probes     ProbeOffenders
+	honeypots  services.HoneypotService
+	branding   services.BrandingService
+	maint      services.MaintenanceModeService
+	slack      services.SlackWorkspaceService
+	token      string
+}
+
+func NewAdminHandler(admin services.AdminService, flags services.FlagService, duplicates services.DuplicateService, blocks services.RedirectPolicyService, jobs JobScheduler, token string) *AdminHandler {
+	return &AdminHandler{admin: admin, flags: flags, duplicates: duplicates, blocks: blocks, jobs: jobs, token: token}
+}
+
+// EnableAnomalies adds GET /api/v1/admin/anomalies, the click spikes
+// anomalies flagged.
+func (h *AdminHandler) EnableAnomalies(anomalies services.AnomalyService) {
+	h.anomalies = anomalies
+}
+
+// EnableProbes adds GET /api/v1/admin/probes, which lists the clients
+// held back for probing for codes, and DELETE /api/v1/admin/probes/{ip},
+// which releases one.
+func (h *AdminHandler) EnableProbes(probes ProbeOffenders) {
+	h.probes = probes
+}
+
+// EnableHoneypots adds GET and POST /api/v1/admin/honeypots and DELETE
+// /api/v1/admin/honeypots/{code}, which manage the honeypot codes, and GET
+// /api/v1/admin/honeypot-hits, the requests made for them.
+func (h *AdminHandler) EnableHoneypots(honeypots services.HoneypotService) {
+	h.honeypots = honeypots
+}
+
+// EnableBranding adds GET, PUT and DELETE /api/v1/admin/branding, the
+// branding of the public pages.
+func (h *AdminHandler) EnableBranding(branding services.BrandingService) {
+	h.branding = branding
+}
+
+// EnableMaintenanceMode adds GET and PUT /api/v1/admin/maintenance, which
+// read and switch maintenance mode.
+func (h *AdminHandler) EnableMaintenanceMode(maintenance services.MaintenanceModeService) {
+	h.maint = maintenance
+}
+
+// EnableSlackWorkspaces adds GET /api/v1/admin/slack-workspaces and PUT
+// and DELETE /api/v1/admin/slack-workspaces/{team_id}, which manage the
+// per-workspace signing secrets of the Slack integration.
+func (h *AdminHandler) EnableSlackWorkspaces(slack services.SlackWorkspaceService) {
+	h.slack = slack
+}
+
+func (h *AdminHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/admin/overview", h.requireToken(h.handleOverview))
+	mux.HandleFunc("/api/v1/admin/flags", h.requireToken(h.handleFlags))
+	mux.HandleFunc("/api/v1/admin/flags/", h.requireToken(h.handleFlag))
+	mux.HandleFunc("/api/v1/admin/jobs", h.requireToken(h.handleJobs))
+	mux.HandleFunc("/api/v1/admin/duplicates", h.requireToken(h.handleDuplicates))
+	mux.HandleFunc("/api/v1/admin/duplicates/merge", h.requireToken(h.handleMergeDuplicates))
+	mux.HandleFunc("/api/v1/admin/blocks", h.requireToken(h.handleBlocks))
+	mux.HandleFunc("/api/v1/admin/blocks/", h.requireToken(h.handleBlock))
+	if h.anomalies != nil {
+		mux.HandleFunc("/api/v1/admin/anomalies", h.requireToken(h.handleAnomalies))
+	}
+	if h.probes != nil {
+		mux.HandleFunc("/api/v1/admin/probes", h.requireToken(h.handleProbes))
+		mux.HandleFunc("/api/v1/admin/probes/", h.requireToken(h.handleProbe))
+	}
+	if h.honeypots != nil {
+		mux.HandleFunc("/api/v1/admin/honeypots", h.requireToken(h.handleHoneypots))
+		mux.HandleFunc("/api/v1/admin/honeypots/", h.requireToken(h.handleHoneypot))
+		mux.HandleFunc("/api/v1/admin/honeypot-hits", h.requireToken(h.handleHoneypotHits))
+	}
+	if h.branding != nil {
+		mux.HandleFunc("/api/v1/admin/branding", h.requireToken(h.handleBranding))
+	}
+	if h.maint != nil {
+		mux.HandleFunc(maintenancePath, h.requireToken(h.handleMaintenance))
+	}
+	if h.slack != nil {
+		mux.HandleFunc("/api/v1/admin/slack-workspaces", h.requireToken(h.handleSlackWorkspaces))
+		mux.HandleFunc("/api/v1/admin/slack-workspaces/", h.requireToken(h.handleSlackWorkspace))
+	}
+
+	logRoutes("Admin", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *AdminHandler) Routes() []Route {
+	routes := []Route{
+		route("/api/v1/admin/overview", http.MethodGet),
+		route("/api/v1/admin/flags", http.MethodGet),
+		route("/api/v1/admin/flags/{name}", http.MethodPut, http.MethodDelete),
+		route("/api/v1/admin/jobs", http.MethodGet),
+		route("/api/v1/admin/duplicates", http.MethodGet),
+		route("/api/v1/admin/duplicates/merge", http.MethodPost),
+		route("/api/v1/admin/blocks", http.MethodGet, http.MethodPost),
+		route("/api/v1/admin/blocks/{id}", http.MethodDelete),
+	}
+	if h.anomalies != nil {
+		routes = append(routes, route("/api/v1/admin/anomalies", http.MethodGet))
+	}
+	if h.probes != nil {
+		routes = append(routes, route("/api/v1/admin/probes", http.MethodGet), route("/api/v1/admin/probes/{ip}", http.MethodDelete))
+	}
+	if h.honeypots != nil {
+		routes = append(routes,
+			route("/api/v1/admin/honeypots", http.MethodGet, http.MethodPost),
+			route("/api/v1/admin/honeypots/{code}", http.MethodDelete),
+			route("/api/v1/admin/honeypot-hits", http.MethodGet))
+	}
+	if h.branding != nil {
+		routes = append(routes, route("/api/v1/admin/branding", http.MethodGet, http.MethodPut, http.MethodDelete))
+	}
+	if h.maint != nil {
+		routes = append(routes, route(maintenancePath, http.MethodGet, http.MethodPut))
+	}
+	if h.slack != nil {
+		routes = append(routes,
+			route("/api/v1/admin/slack-workspaces", http.MethodGet),
+			route("/api/v1/admin/slack-workspaces/{team_id}", http.MethodPut, http.MethodDelete))
+	}
+	return routes
+}
+
+func (h *AdminHandler) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return requireAdminToken(h.token, next)
+}
+
+// requireAdminToken answers 401 to requests not authorized with token, the
+// ADMIN_TOKEN, or an API key before they reach next, and 403 to those
+// authorized with a key without the admin scope.
+func requireAdminToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return requireScope(token, shortner.ScopeAdmin, next)
+}
+
+// requireScope is requireAdminToken for API keys with scope.
+func requireScope(token, scope string, next http.HandlerFunc) http.HandlerFunc {
+	return requireScopes(token, scope, scope, next)
+}
+
+// requireLinkScope is requireScope for links:read on GET and HEAD requests
+// and links:write on the others.
+func requireLinkScope(token string, next http.HandlerFunc) http.HandlerFunc {
+	return requireScopes(token, shortner.ScopeLinksRead, shortner.ScopeLinksWrite, next)
+}
+
+func requireScopes(token, readScope, writeScope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope := writeScope
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			scope = readScope
+		}
+		if authorizeScope(w, r, token, scope) {
+			next(w, r)
+		}
+	}
+}
+
+// authorizeScope reports whether r is authorized with token or an API key
+// with scope, and answers 401 or 403 when it is not.
+func authorizeScope(w http.ResponseWriter, r *http.Request, token, scope string) bool {
+	if hasBearerToken(r, token) {
+		return true
+	}
+	key := requestAPIKey(r)
+	if key == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		respondWithError(w, r, http.StatusUnauthorized, "Invalid admin token")
+		return false
+	}
+	if !key.HasScope(scope) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin", error="insufficient_scope", scope="`+scope+`"`)
+		respondWithError(w, r, http.StatusForbidden, "The API key lacks the "+scope+" scope")
+		return false
+	}
+	return true
+}
+
+// requireAdminTokenOnly is requireAdminToken without API keys, for the
+// routes that manage them.
+func requireAdminTokenOnly(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hasBearerToken(r, token) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			respondWithError(w, r, http.StatusUnauthorized, "Invalid admin token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// hasBearerToken reports whether r is authorized with token, which must be
+// set.
+func hasBearerToken(r *http.Request, token string) bool {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token != "" && ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// handleOverview accepts ?days= (length of links_per_day) and ?top= (size of
+// the top links and top domains lists).
+func (h *AdminHandler) handleOverview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	days, ok := queryInt(w, r, "days")
+	if !ok {
+		return
+	}
+	top, ok := queryInt(w, r, "top")
+	if !ok {
+		return
+	}
+
+	overview, err := h.admin.Overview(days, top)
+	if err != nil {
+		log.Printf("Handler error from service Overview: %v", err)
+		respondWithServiceError(w, r, err, "Failed to build overview")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, overview)
+}
+
+// handleAnomalies lists the flagged click spikes newest first, ?limit= at
+// a time (50 by default, at most 100), from ?cursor=.
+func (h *AdminHandler) handleAnomalies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	limit, ok := queryInt(w, r, "limit")
+	if !ok {
+		return
+	}
+	if limit <= 0 {
+		limit = defaultAnomalyLimit
+	}
+	limit = min(limit, maxAnomalyLimit)
+	beforeID, err := decodeCursor(cursorPrefixAnomalies, r.URL.Query().Get("cursor"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid cursor parameter")
+		return
+	}
+
+	anomalies, err := h.anomalies.ListAnomalies(beforeID, limit)
+	if err != nil {
+		log.Printf("Handler error from service ListAnomalies: %v", err)
+		respondWithServiceError(w, r, err, "Failed to list anomalies")
+		return
+	}
+	resp := AnomalyListResponse{Items: anomalies}
+	if resp.Items == nil {
+		resp.Items = []shortner.ClickAnomaly{}
+	}
+	if len(anomalies) == limit {
+		resp.NextCursor = encodeCursor(cursorPrefixAnomalies, anomalies[len(anomalies)-1].ID)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (h *AdminHandler) handleProbes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	offenders := h.probes.Offenders(time.Now())
+	if offenders == nil {
+		offenders = []ratelimit.Offender{}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, offenders)
+}
+
+func (h *AdminHandler) handleProbe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	ip := strings.TrimPrefix(r.URL.Path, "/api/v1/admin/probes/")
+	if ip == "" || !h.probes.Unblock(ip) {
+		respondWithError(w, r, http.StatusNotFound, "Client is not held back")
+		return
+	}
+	log.Printf("Admin released %s from probe protection", ip)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) handleHoneypots(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		honeypots, err := h.honeypots.ListHoneypots()
+		if err != nil {
+			log.Printf("Handler error from service ListHoneypots: %v", err)
+			respondWithServiceError(w, r, err, "Failed to list honeypots")
+			return
+		}
+		if honeypots == nil {
+			honeypots = []shortner.Honeypot{}
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		respondWithJSON(w, http.StatusOK, honeypots)
+	case http.MethodPost:
+		var req AddHoneypotRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("Handler error decoding honeypot: %v", err)
+			respondWithBodyError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		honeypot, err := h.honeypots.AddHoneypot(req.Code, req.Note)
+		if err != nil {
+			log.Printf("Handler error from service AddHoneypot for '%s': %v", req.Code, err)
+			respondWithServiceError(w, r, err, "Failed to add honeypot")
+			return
+		}
+		respondWithJSON(w, http.StatusCreated, honeypot)
+	default:
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (h *AdminHandler) handleHoneypot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	code := strings.TrimPrefix(r.URL.Path, "/api/v1/admin/honeypots/")
+	if err := h.honeypots.RemoveHoneypot(code); err != nil {
+		log.Printf("Handler error from service RemoveHoneypot for '%s': %v", code, err)
+		respondWithServiceError(w, r, err, "Failed to remove honeypot")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) handleHoneypotHits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	limit, ok := queryInt(w, r, "limit")
+	if !ok {
+		return
+	}
+	if limit <= 0 {
+		limit = defaultAnomalyLimit
+	}
+	limit = min(limit, maxAnomalyLimit)
+	beforeID, err := decodeCursor(cursorPrefixHoneypotHits, r.URL.Query().Get("cursor"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid cursor parameter")
+		return
+	}
+
+	hits, err := h.honeypots.ListHits(beforeID, limit)
+	if err != nil {
+		log.Printf("Handler error from service ListHits: %v", err)
+		respondWithServiceError(w, r, err, "Failed to list honeypot hits")
+		return
+	}
+	resp := HoneypotHitListResponse{Items: hits}
+	if resp.Items == nil {
+		resp.Items = []shortner.HoneypotHit{}
+	}
+	if len(hits) == limit {
+		resp.NextCursor = encodeCursor(cursorPrefixHoneypotHits, hits[len(hits)-1].ID)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// queryInt parses an optional integer query parameter, answering 400 itself
+// when it is malformed. A missing parameter is 0.
+func queryInt(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid "+name+" parameter")
+		return 0, false
+	}
+	return n, true
+}
+
+func (h *AdminHandler) handleBranding(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		branding, err := h.branding.GetBranding()
+		if err != nil {
+			respondWithServiceError(w, r, err, "Failed to load branding")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		respondWithJSON(w, http.StatusOK, branding)
+	case http.MethodPut:
+		var req BrandingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("Handler error decoding branding: %v", err)
+			respondWithBodyError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		branding, err := h.branding.SaveBranding(shortner.Branding{
+			LogoURL:         req.LogoURL,
+			PrimaryColor:    req.PrimaryColor,
+			BackgroundColor: req.BackgroundColor,
+			TextColor:       req.TextColor,
+			Footer:          req.Footer,
+			CSS:             req.CSS,
+		})
+		if err != nil {
+			log.Printf("Handler error from service SaveBranding: %v", err)
+			respondWithServiceError(w, r, err, "Failed to save branding")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, branding)
+	case http.MethodDelete:
+		if err := h.branding.ResetBranding(); err != nil {
+			log.Printf("Handler error from service ResetBranding: %v", err)
+			respondWithServiceError(w, r, err, "Failed to reset branding")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (h *AdminHandler) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		m, err := h.maint.GetMaintenance()
+		if err != nil {
+			respondWithServiceError(w, r, err, "Failed to load maintenance mode")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		respondWithJSON(w, http.StatusOK, m)
+	case http.MethodPut:
+		var req MaintenanceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("Handler error decoding maintenance mode: %v", err)
+			respondWithBodyError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		m, err := h.maint.SetMaintenance(shortner.Maintenance{Enabled: req.Enabled, Message: req.Message, RetryAfter: req.RetryAfter})
+		if err != nil {
+			log.Printf("Handler error from service SetMaintenance: %v", err)
+			respondWithServiceError(w, r, err, "Failed to save maintenance mode")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, m)
+	default:
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (h *AdminHandler) handleFlags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, h.flags.ListFlags())
+}
+
+func (h *AdminHandler) handleFlag(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/admin/flags/")
+	if name == "" || strings.Contains(name, "/") {
+		respondWithError(w, r, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var req SetFlagRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("Handler error decoding feature flag: %v", err)
+			respondWithBodyError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		flag := featureflags.Flag{Name: name, Enabled: req.Enabled, Rollout: 100, Environments: req.Environments}
+		if req.Rollout != nil {
+			flag.Rollout = *req.Rollout
+		}
+		saved, err := h.flags.SetFlag(flag)
+		if err != nil {
+			log.Printf("Handler error from service SetFlag for '%s': %v", name, err)
+			respondWithServiceError(w, r, err, "Failed to set feature flag")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, saved)
+	case http.MethodDelete:
+		if err := h.flags.ResetFlag(name); err != nil {
+			log.Printf("Handler error from service ResetFlag for '%s': %v", name, err)
+			respondWithServiceError(w, r, err, "Failed to reset feature flag")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (h *AdminHandler) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, h.jobs.Status())
+}
+
+// handleDuplicates accepts ?limit= (how many destinations to report).
+func (h *AdminHandler) handleDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	limit, ok := queryInt(w, r, "limit")
+	if !ok {
+		return
+	}
+	groups, err := h.duplicates.FindDuplicates(limit)
+	if err != nil {
+		log.Printf("Handler error from service FindDuplicates: %v", err)
+		respondWithServiceError(w, r, err, "Failed to find duplicate links")
+		return
+	}
+	if groups == nil {
+		groups = []shortner.DuplicateGroup{}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, groups)
+}
+
+func (h *AdminHandler) handleMergeDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	var req MergeDuplicatesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Handler error decoding merge request: %v", err)
+		respondWithBodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.duplicates.Merge(req.Canonical, req.Codes)
+	if err != nil {
+		log.Printf("Handler error from service Merge into '%s': %v", req.Canonical, err)
+		respondWithServiceError(w, r, err, "Failed to merge links")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+func (h *AdminHandler) handleBlocks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		blocks, err := h.blocks.ListBlocks()
+		if err != nil {
+			log.Printf("Handler error from service ListBlocks: %v", err)
+			respondWithServiceError(w, r, err, "Failed to list redirect blocks")
+			return
+		}
+		if blocks == nil {
+			blocks = []shortner.RedirectBlock{}
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		respondWithJSON(w, http.StatusOK, blocks)
+	case http.MethodPost:
+		var req AddBlockRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("Handler error decoding redirect block: %v", err)
+			respondWithBodyError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		block, err := h.blocks.AddBlock(shortner.RedirectBlock{Kind: req.Kind, Value: req.Value, Reason: req.Reason})
+		if err != nil {
+			log.Printf("Handler error from service AddBlock for %s '%s': %v", req.Kind, req.Value, err)
+			respondWithServiceError(w, r, err, "Failed to add redirect block")
+			return
+		}
+		respondWithJSON(w, http.StatusCreated, block)
+	default:
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (h *AdminHandler) handleBlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/blocks/"), 10, 64)
+	if err != nil {
+		respondWithError(w, r, http.StatusNotFound, "Not Found")
+		return
+	}
+	if err := h.blocks.RemoveBlock(id); err != nil {
+		log.Printf("Handler error from service RemoveBlock for %d: %v", id, err)
+		respondWithServiceError(w, r, err, "Failed to remove redirect block")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) handleSlackWorkspaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	workspaces, err := h.slack.ListWorkspaces()
+	if err != nil {
+		log.Printf("Handler error from service ListWorkspaces: %v", err)
+		respondWithServiceError(w, r, err, "Failed to list Slack workspaces")
+		return
+	}
+	if workspaces == nil {
+		workspaces = []shortner.SlackWorkspace{}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, workspaces)
+}
+
+// handleSlackWorkspace stores or deletes a workspace. The signing secret is
+// write-only: no response carries it.
+func (h *AdminHandler) handleSlackWorkspace(w http.ResponseWriter, r *http.Request) {
+	teamID := strings.TrimPrefix(r.URL.Path, "/api/v1/admin/slack-workspaces/")
+	if teamID == "" || strings.Contains(teamID, "/") {
+		respondWithError(w, r, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var req PutSlackWorkspaceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("Handler error decoding Slack workspace: %v", err)
+			respondWithBodyError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		workspace, created, err := h.slack.SaveWorkspace(teamID, req.TeamName, req.SigningSecret)
+		if err != nil {
+			log.Printf("Handler error from service SaveWorkspace for '%s': %v", teamID, err)
+			respondWithServiceError(w, r, err, "Failed to save Slack workspace")
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		respondWithJSON(w, status, workspace)
+	case http.MethodDelete:
+		if err := h.slack.DeleteWorkspace(teamID); err != nil {
+			log.Printf("Handler error from service DeleteWorkspace for '%s': %v", teamID, err)
+			respondWithServiceError(w, r, err, "Failed to delete Slack workspace")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
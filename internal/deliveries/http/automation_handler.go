@@ -0,0 +1,258 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	defaultTriggerLimit = 50
+	maxTriggerLimit     = 500
+
+	cursorPrefixLinks  = "links:"
+	cursorPrefixClicks = "clicks:"
+)
+
+type SubscribeHookRequest struct {
+	Event     string `json:"event"`
+	TargetURL string `json:"target_url"`
+}
+
+type TriggerResponse struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"next_cursor"`
+}
+
+// AutomationHandler exposes polling triggers and REST hook subscriptions for
+// no-code automation platforms such as Zapier and IFTTT. Polling endpoints
+// return items in ascending ID order together with an opaque cursor that the
+// client passes back to receive only newer items.
+//
+// Every route needs the ADMIN_TOKEN or an API key: the links trigger with
+// the links:read scope, the clicks trigger with stats:read, and the hooks,
+// which deliver links and clicks to any URL, with admin. The clicks
+// trigger still only lists clicks on links whose stats the caller may see.
+type AutomationHandler struct {
+	shortener services.ShortenerService
+	analytics services.AnalyticsService
+	stats     services.StatsService
+	hooks     services.HookService
+	baseURL   string
+	token     string
+}
+
+func NewAutomationHandler(shortener services.ShortenerService, analytics services.AnalyticsService, stats services.StatsService, hooks services.HookService, baseURL, token string) *AutomationHandler {
+	return &AutomationHandler{
+		shortener: shortener,
+		analytics: analytics,
+		stats:     stats,
+		hooks:     hooks,
+		baseURL:   baseURL,
+		token:     token,
+	}
+}
+
+func (h *AutomationHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/triggers/links", requireScope(h.token, shortner.ScopeLinksRead, h.handleNewLinks))
+	mux.HandleFunc("/api/v1/triggers/clicks", requireScope(h.token, shortner.ScopeStatsRead, h.handleNewClicks))
+	mux.HandleFunc("/api/v1/hooks", requireAdminToken(h.token, h.handleHooks))
+	mux.HandleFunc("/api/v1/hooks/", requireAdminToken(h.token, h.handleHookByID))
+
+	logRoutes("Automation", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *AutomationHandler) Routes() []Route {
+	return []Route{
+		route("/api/v1/triggers/links", http.MethodGet),
+		route("/api/v1/triggers/clicks", http.MethodGet),
+		route("/api/v1/hooks", http.MethodGet, http.MethodPost),
+		route("/api/v1/hooks/{id}", http.MethodDelete),
+	}
+}
+
+type triggerLink struct {
+	ID        int64  `json:"id"`
+	ShortCode string `json:"short_code"`
+	ShortURL  string `json:"short_url"`
+	LongURL   string `json:"long_url"`
+	CreatedAt string `json:"created_at"`
+}
+
+func (h *AutomationHandler) handleNewLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	afterID, limit, err := parseTriggerParams(r, cursorPrefixLinks)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mappings, err := h.shortener.ListLinksSince(afterID, limit)
+	if err != nil {
+		log.Printf("Handler error from service ListLinksSince: %v", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to list links")
+		return
+	}
+
+	items := make([]triggerLink, 0, len(mappings))
+	lastID := afterID
+	for _, m := range mappings {
+		items = append(items, triggerLink{
+			ID:        m.ID,
+			ShortCode: m.ShortCode,
+			ShortURL:  buildShortURL(h.baseURL, m.ShortCode),
+			LongURL:   m.LongURL,
+			CreatedAt: m.CreatedAt.UTC().Format(time.RFC3339),
+		})
+		lastID = m.ID
+	}
+
+	respondWithJSON(w, http.StatusOK, TriggerResponse{Items: items, NextCursor: encodeCursor(cursorPrefixLinks, lastID)})
+}
+
+func (h *AutomationHandler) handleNewClicks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	afterID, limit, err := parseTriggerParams(r, cursorPrefixClicks)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	clicks, err := h.analytics.ListClicksSince(afterID, limit)
+	if err != nil {
+		log.Printf("Handler error from service ListClicksSince: %v", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to list clicks")
+		return
+	}
+
+	lastID := afterID
+	if len(clicks) > 0 {
+		lastID = clicks[len(clicks)-1].ID
+	}
+	// The cursor moves past hidden clicks too, so a page may hold fewer
+	// items than limit while more remain.
+	clicks, err = h.stats.VisibleClicks(clicks, statsAccess(r))
+	if err != nil {
+		log.Printf("Handler error from service VisibleClicks: %v", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to list clicks")
+		return
+	}
+	var items interface{} = clicks
+	if clicks == nil {
+		items = []struct{}{}
+	}
+
+	respondWithJSON(w, http.StatusOK, TriggerResponse{Items: items, NextCursor: encodeCursor(cursorPrefixClicks, lastID)})
+}
+
+func (h *AutomationHandler) handleHooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		hooks, err := h.hooks.ListHooks()
+		if err != nil {
+			log.Printf("Handler error from service ListHooks: %v", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Failed to list hooks")
+			return
+		}
+		var items interface{} = hooks
+		if hooks == nil {
+			items = []struct{}{}
+		}
+		respondWithJSON(w, http.StatusOK, items)
+	case http.MethodPost:
+		var req SubscribeHookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("Handler error decoding hook subscription: %v", err)
+			respondWithBodyError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		hook, err := h.hooks.Subscribe(req.Event, req.TargetURL)
+		if err != nil {
+			log.Printf("Handler error from service Subscribe: %v", err)
+			respondWithServiceError(w, r, err, "Failed to subscribe hook")
+			return
+		}
+		respondWithJSON(w, http.StatusCreated, hook)
+	default:
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (h *AutomationHandler) handleHookByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/v1/hooks/"), 10, 64)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid hook id in URL path")
+		return
+	}
+
+	if err := h.hooks.Unsubscribe(id); err != nil {
+		log.Printf("Handler error from service Unsubscribe for hook %d: %v", id, err)
+		respondWithServiceError(w, r, err, "Failed to delete hook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseTriggerParams(r *http.Request, prefix string) (int64, int, error) {
+	limit := defaultTriggerLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return 0, 0, errors.New("invalid limit")
+		}
+		if n > maxTriggerLimit {
+			n = maxTriggerLimit
+		}
+		limit = n
+	}
+
+	afterID, err := decodeCursor(prefix, r.URL.Query().Get("cursor"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return afterID, limit, nil
+}
+
+func encodeCursor(prefix string, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(prefix + strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(prefix, cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), prefix) {
+		return 0, errors.New("invalid cursor")
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(string(raw), prefix), 10, 64)
+	if err != nil || id < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return id, nil
+}
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+func TestAutomationRoutesNeedCredentials(t *testing.T) {
+	keys := services.NewAPIKeyService(&fakeAPIKeyRepo{keys: map[string]shortner.APIKey{}})
+	reader, _, err := keys.PutAPIKey("reader", shortner.APIKey{Name: "Zapier", Scopes: []string{shortner.ScopeLinksRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := newFakeShortenerService(newFakeShortenerRepo(shortner.URLMapping{ID: 1, ShortCode: "abc", LongURL: "https://example.com"}))
+	mux := http.NewServeMux()
+	NewAutomationHandler(links, nil, nil, nil, "http://sho.rt", testAdminToken).RegisterRoutes(mux)
+	handler := NewAPIKeyAuth(keys).Middleware(mux)
+
+	for _, tt := range []struct {
+		method, target, secret string
+		status                 int
+		code                   string
+	}{
+		{http.MethodGet, "/api/v1/hooks", "", http.StatusUnauthorized, codeUnauthorized},
+		{http.MethodPost, "/api/v1/hooks", "", http.StatusUnauthorized, codeUnauthorized},
+		{http.MethodDelete, "/api/v1/hooks/1", "", http.StatusUnauthorized, codeUnauthorized},
+		{http.MethodGet, "/api/v1/triggers/links", "", http.StatusUnauthorized, codeUnauthorized},
+		{http.MethodGet, "/api/v1/triggers/clicks", "", http.StatusUnauthorized, codeUnauthorized},
+		{http.MethodGet, "/api/v1/triggers/clicks", "nope", http.StatusUnauthorized, codeUnauthorized},
+		{http.MethodPost, "/api/v1/hooks", reader.Key, http.StatusForbidden, codeForbidden},
+		{http.MethodGet, "/api/v1/triggers/clicks", reader.Key, http.StatusForbidden, codeForbidden},
+	} {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		if tt.secret != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.secret)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		expectError(t, rec, tt.status, tt.code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/triggers/links", nil)
+	req.Header.Set("Authorization", "Bearer "+reader.Key)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !links.called("ListLinksSince") {
+		t.Errorf("links trigger with links:read: status = %d, body %s", rec.Code, rec.Body)
+	}
+}
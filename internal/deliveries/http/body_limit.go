@@ -0,0 +1,46 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// BodyLimit caps the size of request bodies. Requests that announce a
+// larger Content-Length are answered with 413 straight away; for the rest
+// the body stops with an *http.MaxBytesError at the limit, which handlers
+// turn into a 413 with respondWithBodyError. Routes under one of the exempt
+// path prefixes enforce their own limits (pastes, file uploads, inbound
+// email).
+type BodyLimit struct {
+	maxBytes int64
+	exempt   []string
+}
+
+func NewBodyLimit(maxBytes int64, exempt ...string) *BodyLimit {
+	return &BodyLimit{maxBytes: maxBytes, exempt: exempt}
+}
+
+func (l *BodyLimit) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody || l.isExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.ContentLength > l.maxBytes {
+			respondWithError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body is too large (limit %d bytes)", l.maxBytes))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, l.maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *BodyLimit) isExempt(path string) bool {
+	for _, prefix := range l.exempt {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
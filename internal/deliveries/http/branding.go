@@ -0,0 +1,75 @@
+package http
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+type brandingKey struct{}
+
+// Branding gives the pages rendered for each request the branding of the
+// service. The branding is only loaded when a page is rendered.
+type Branding struct {
+	branding services.BrandingService
+}
+
+func NewBranding(branding services.BrandingService) *Branding {
+	return &Branding{branding: branding}
+}
+
+func (b *Branding) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), brandingKey{}, b.branding)))
+	})
+}
+
+// pageBranding returns the branding of the pages answering r; it is zero
+// without the Branding middleware.
+func pageBranding(r *http.Request) shortner.Branding {
+	if branding, ok := r.Context().Value(brandingKey{}).(services.BrandingService); ok {
+		return branding.Branding()
+	}
+	return shortner.Branding{}
+}
+
+// pageBrand is the branding as the page templates use it, nil for the
+// built-in look. The branding service validated the colors and CSS.
+type pageBrand struct {
+	LogoURL         string
+	PrimaryColor    template.CSS
+	BackgroundColor template.CSS
+	TextColor       template.CSS
+	Footer          string
+	CSS             template.CSS
+}
+
+func newPageBrand(b shortner.Branding) *pageBrand {
+	b.UpdatedAt = time.Time{}
+	if b == (shortner.Branding{}) {
+		return nil
+	}
+	return &pageBrand{
+		LogoURL:         b.LogoURL,
+		PrimaryColor:    template.CSS(b.PrimaryColor),
+		BackgroundColor: template.CSS(b.BackgroundColor),
+		TextColor:       template.CSS(b.TextColor),
+		Footer:          b.Footer,
+		CSS:             template.CSS(b.CSS),
+	}
+}
+
+// allowLogo adds the origin of the branding logo to csp, a policy that
+// otherwise loads no images.
+func allowLogo(csp string, b shortner.Branding) string {
+	u, err := url.Parse(b.LogoURL)
+	if b.LogoURL == "" || err != nil {
+		return csp
+	}
+	return csp + "; img-src " + u.Scheme + "://" + u.Host
+}
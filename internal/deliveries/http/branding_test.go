@@ -0,0 +1,68 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// stubBranding serves a fixed branding; only Branding is used.
+type stubBranding struct {
+	services.BrandingService
+	branding shortner.Branding
+}
+
+func (b *stubBranding) Branding() shortner.Branding { return b.branding }
+
+func TestBrandedPages(t *testing.T) {
+	f, _ := newProfileFixture()
+	branding := &stubBranding{}
+	handler := NewBranding(branding).Middleware(f.mux)
+	get := func() string {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/@ann", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+		}
+		return rec.Body.String()
+	}
+
+	if body := get(); strings.Contains(body, "brand-") {
+		t.Errorf("page without branding has branding markup:\n%s", body)
+	}
+
+	branding.branding = shortner.Branding{
+		LogoURL:      "https://cdn.example.com/logo.png",
+		PrimaryColor: "#1a73e8",
+		Footer:       "© Example <Inc>",
+		CSS:          "h1{letter-spacing:.1em}",
+	}
+	body := get()
+	for _, want := range []string{
+		`<img class="brand-logo" src="https://cdn.example.com/logo.png" alt="">`,
+		"a{color:#1a73e8}",
+		"h1{letter-spacing:.1em}",
+		`<footer class="brand-footer">© Example &lt;Inc&gt;</footer>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("branded page lacks %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "body{background") {
+		t.Error("unset background color is in the page")
+	}
+}
+
+func TestAllowLogo(t *testing.T) {
+	if got := allowLogo(pasteCSP, shortner.Branding{}); got != pasteCSP {
+		t.Errorf("without a logo: %q", got)
+	}
+	want := pasteCSP + "; img-src https://cdn.example.com"
+	if got := allowLogo(pasteCSP, shortner.Branding{LogoURL: "https://cdn.example.com/a/logo.png?v=2"}); got != want {
+		t.Errorf("allowLogo = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// BulkDeleteRequest is the body of POST /api/v1/links/bulk-delete: either
+// codes or destination_prefix picks the links.
+type BulkDeleteRequest struct {
+	shortner.BulkSelection
+}
+
+// BulkUpdateRequest is the body of POST /api/v1/links/bulk-update; update
+// takes the fields of PUT /update/{code}.
+type BulkUpdateRequest struct {
+	shortner.BulkSelection
+	Update UpdateRequest `json:"update"`
+}
+
+// BulkHandler serves the bulk link operations. Like the admin API they
+// require "Authorization: Bearer <ADMIN_TOKEN>". The response reports every
+// link; when the operation was refused because of one of them, it carries
+// status 422 and nothing was changed.
+type BulkHandler struct {
+	links  services.ShortenerService
+	pixels services.PixelService
+	token  string
+}
+
+// NewBulkHandler creates the handler; pixels may be nil when retargeting
+// is disabled.
+func NewBulkHandler(links services.ShortenerService, pixels services.PixelService, token string) *BulkHandler {
+	return &BulkHandler{links: links, pixels: pixels, token: token}
+}
+
+func (h *BulkHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/links/bulk-delete", requireScope(h.token, shortner.ScopeLinksWrite, h.handleBulkDelete))
+	mux.HandleFunc("/api/v1/links/bulk-update", requireScope(h.token, shortner.ScopeLinksWrite, h.handleBulkUpdate))
+
+	logRoutes("Bulk", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *BulkHandler) Routes() []Route {
+	return []Route{
+		route("/api/v1/links/bulk-delete", http.MethodPost),
+		route("/api/v1/links/bulk-update", http.MethodPost),
+	}
+}
+
+func (h *BulkHandler) handleBulkDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	var req BulkDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Handler error decoding bulk delete request: %v", err)
+		respondWithBodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.links.BulkDelete(req.BulkSelection)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Failed to delete links")
+		return
+	}
+	respondWithBulkResult(w, result)
+}
+
+func (h *BulkHandler) handleBulkUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	var req BulkUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Handler error decoding bulk update request: %v", err)
+		respondWithBodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Update.empty() {
+		respondWithError(w, r, http.StatusBadRequest, "Missing 'update' in request body")
+		return
+	}
+	update, ok := linkUpdate(w, r, req.Update, h.pixels)
+	if !ok {
+		return
+	}
+	result, err := h.links.BulkUpdate(req.BulkSelection, update)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Failed to update links")
+		return
+	}
+	respondWithBulkResult(w, result)
+}
+
+func respondWithBulkResult(w http.ResponseWriter, result *shortner.BulkResult) {
+	status := http.StatusOK
+	if !result.Applied {
+		status = http.StatusUnprocessableEntity
+	}
+	respondWithJSON(w, status, result)
+}
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"template/internal/usecases/shortner"
+)
+
+const testAdminToken = "admin-secret"
+
+// newBulkFixture serves the bulk routes next to the shortener routes, over
+// links abc and def.
+func newBulkFixture() *shortenerFixture {
+	f := newShortenerFixture(
+		shortner.URLMapping{ShortCode: "abc", LongURL: "https://example.com/a"},
+		shortner.URLMapping{ShortCode: "def", LongURL: "https://example.com/d"},
+	)
+	NewBulkHandler(f.service, nil, testAdminToken).RegisterRoutes(f.mux)
+	return f
+}
+
+func decodeBulkResult(t *testing.T, body []byte) shortner.BulkResult {
+	t.Helper()
+	var result shortner.BulkResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("bulk result %q is not JSON: %v", body, err)
+	}
+	return result
+}
+
+func TestBulkDelete(t *testing.T) {
+	f := newBulkFixture()
+	rec := f.do(http.MethodPost, "/api/v1/links/bulk-delete", "application/json", `{"codes":["abc","def"]}`, "Authorization", "Bearer "+testAdminToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if result := decodeBulkResult(t, rec.Body.Bytes()); !result.Applied || result.Changed != 2 {
+		t.Errorf("result = %+v, want both links deleted", result)
+	}
+	if _, err := f.repo.GetMapping("abc"); err == nil {
+		t.Error("abc still exists")
+	}
+}
+
+func TestBulkUpdateRefused(t *testing.T) {
+	f := newBulkFixture()
+	rec := f.do(http.MethodPost, "/api/v1/links/bulk-update", "application/json", `{"codes":["abc","zzz"],"update":{"redirect_type":301}}`, "Authorization", "Bearer "+testAdminToken)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422, body %s", rec.Code, rec.Body)
+	}
+	result := decodeBulkResult(t, rec.Body.Bytes())
+	if result.Applied || len(result.Results) != 2 {
+		t.Errorf("result = %+v, want zzz not found and abc skipped", result)
+	}
+	if m, _ := f.repo.GetMapping("abc"); m.RedirectType == 301 {
+		t.Error("a refused bulk update changed abc")
+	}
+}
+
+func TestBulkErrors(t *testing.T) {
+	f := newBulkFixture()
+	auth := []string{"Authorization", "Bearer " + testAdminToken}
+	tests := []struct {
+		name    string
+		target  string
+		body    string
+		headers []string
+		status  int
+		code    string
+	}{
+		{"no token", "/api/v1/links/bulk-delete", `{"codes":["abc"]}`, nil, http.StatusUnauthorized, codeUnauthorized},
+		{"wrong token", "/api/v1/links/bulk-delete", `{"codes":["abc"]}`, []string{"Authorization", "Bearer nope"}, http.StatusUnauthorized, codeUnauthorized},
+		{"bad json", "/api/v1/links/bulk-delete", `{`, auth, http.StatusBadRequest, codeInvalidRequest},
+		{"empty update", "/api/v1/links/bulk-update", `{"codes":["abc"]}`, auth, http.StatusBadRequest, codeInvalidRequest},
+		{"bad expiry", "/api/v1/links/bulk-update", `{"codes":["abc"],"update":{"expires_at":"tomorrow"}}`, auth, http.StatusBadRequest, codeInvalidRequest},
+		{"pixels disabled", "/api/v1/links/bulk-update", `{"codes":["abc"],"update":{"pixel_ids":[1]}}`, auth, http.StatusBadRequest, codeInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectError(t, f.do(http.MethodPost, tt.target, "application/json", tt.body, tt.headers...), tt.status, tt.code)
+		})
+	}
+	if f.service.called("BulkDelete") || f.service.called("BulkUpdate") {
+		t.Error("a rejected request reached the service")
+	}
+}
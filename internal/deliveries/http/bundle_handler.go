@@ -0,0 +1,227 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+type BundleItemRequest struct {
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	Position int    `json:"position"`
+}
+
+type CreateBundleRequest struct {
+	Title string              `json:"title"`
+	Items []BundleItemRequest `json:"items"`
+}
+
+type CreateBundleResponse struct {
+	ShortCode string `json:"short_code"`
+	ShortURL  string `json:"short_url"`
+}
+
+// BundleHandler manages bundle links: one short code serving a landing page
+// that lists several destinations. Each destination is reached through
+// /{code}/i/{itemID} so that clicks are tracked per item.
+type BundleHandler struct {
+	bundles   services.BundleService
+	analytics services.AnalyticsService
+	baseURL   string
+}
+
+func NewBundleHandler(bundles services.BundleService, analytics services.AnalyticsService, baseURL string) *BundleHandler {
+	return &BundleHandler{
+		bundles:   bundles,
+		analytics: analytics,
+		baseURL:   baseURL,
+	}
+}
+
+func (h *BundleHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/bundles", h.handleCreateBundle)
+	mux.HandleFunc("/api/v1/bundles/", h.handleBundleItems)
+
+	logRoutes("Bundle", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *BundleHandler) Routes() []Route {
+	return []Route{
+		route("/api/v1/bundles", http.MethodPost),
+		route("/api/v1/bundles/{code}/items", http.MethodGet, http.MethodPost),
+		route("/api/v1/bundles/{code}/items/{id}", http.MethodPut, http.MethodDelete),
+	}
+}
+
+func (h *BundleHandler) handleCreateBundle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	var req CreateBundleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Handler error decoding bundle request: %v", err)
+		respondWithBodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	items := make([]shortner.BundleItem, 0, len(req.Items))
+	for _, item := range req.Items {
+		items = append(items, shortner.BundleItem{Title: item.Title, URL: item.URL})
+	}
+
+	code, err := h.bundles.CreateBundle(req.Title, items)
+	if err != nil {
+		log.Printf("Handler error from service CreateBundle: %v", err)
+		respondWithServiceError(w, r, err, "Failed to create bundle")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, CreateBundleResponse{ShortCode: code, ShortURL: buildShortURL(h.baseURL, code)})
+}
+
+// handleBundleItems serves /api/v1/bundles/{code}/items[/{id}].
+func (h *BundleHandler) handleBundleItems(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/bundles/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] != "items" || len(parts) > 3 {
+		respondWithError(w, r, http.StatusNotFound, "Not Found")
+		return
+	}
+	shortCode := parts[0]
+
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			h.listItems(w, r, shortCode)
+		case http.MethodPost:
+			h.addItem(w, r, shortCode)
+		default:
+			respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		}
+		return
+	}
+
+	itemID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid item id in URL path")
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		h.updateItem(w, r, shortCode, itemID)
+	case http.MethodDelete:
+		if err := h.bundles.DeleteItem(shortCode, itemID); err != nil {
+			log.Printf("Handler error from service DeleteItem for %s/%d: %v", shortCode, itemID, err)
+			respondWithServiceError(w, r, err, "Failed to delete bundle item")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (h *BundleHandler) listItems(w http.ResponseWriter, r *http.Request, shortCode string) {
+	items, err := h.bundles.ListItems(shortCode)
+	if err != nil {
+		log.Printf("Handler error from service ListItems for %s: %v", shortCode, err)
+		respondWithServiceError(w, r, err, "Failed to list bundle items")
+		return
+	}
+	if items == nil {
+		items = []shortner.BundleItem{}
+	}
+	respondWithJSON(w, http.StatusOK, items)
+}
+
+func (h *BundleHandler) addItem(w http.ResponseWriter, r *http.Request, shortCode string) {
+	var req BundleItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithBodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	item, err := h.bundles.AddItem(shortCode, shortner.BundleItem{Title: req.Title, URL: req.URL, Position: req.Position})
+	if err != nil {
+		log.Printf("Handler error from service AddItem for %s: %v", shortCode, err)
+		respondWithServiceError(w, r, err, "Failed to add bundle item")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, item)
+}
+
+func (h *BundleHandler) updateItem(w http.ResponseWriter, r *http.Request, shortCode string, itemID int64) {
+	var req BundleItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithBodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	item := shortner.BundleItem{ID: itemID, Title: req.Title, URL: req.URL, Position: req.Position}
+	if err := h.bundles.UpdateItem(shortCode, item); err != nil {
+		log.Printf("Handler error from service UpdateItem for %s/%d: %v", shortCode, itemID, err)
+		respondWithServiceError(w, r, err, "Failed to update bundle item")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Bundle item updated successfully"})
+}
+
+type bundleLink struct {
+	Title string
+	Href  string
+}
+
+// ServeLink implements LinkRenderer: /{code} renders the landing page and
+// /{code}/i/{id} records a click on the item and redirects to it.
+func (h *BundleHandler) ServeLink(w http.ResponseWriter, r *http.Request, mapping *shortner.URLMapping, rest string) {
+	if rest != "" {
+		idPart, ok := strings.CutPrefix(rest, "i/")
+		itemID, err := strconv.ParseInt(idPart, 10, 64)
+		if !ok || err != nil {
+			respondWithServiceError(w, r, services.ErrLinkNotFound, "")
+			return
+		}
+		item, err := h.bundles.GetItem(mapping.ShortCode, itemID)
+		if err != nil {
+			respondWithServiceError(w, r, err, "Error looking up bundle item")
+			return
+		}
+		recordClick(h.analytics, r, mapping.ShortCode, item.ID)
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, nextHop(r, h.baseURL, item.URL), http.StatusFound)
+		return
+	}
+
+	items, err := h.bundles.ListItems(mapping.ShortCode)
+	if err != nil {
+		log.Printf("Handler error listing items for bundle %s: %v", mapping.ShortCode, err)
+		respondWithServiceError(w, r, err, "Error loading bundle")
+		return
+	}
+
+	links := make([]bundleLink, 0, len(items))
+	for _, item := range items {
+		links = append(links, bundleLink{
+			Title: item.Title,
+			Href:  buildShortURL(h.baseURL, mapping.ShortCode+"/i/"+strconv.FormatInt(item.ID, 10)) + signatureQuery(r),
+		})
+	}
+
+	recordClick(h.analytics, r, mapping.ShortCode, 0)
+	w.Header().Set("Cache-Control", "no-cache")
+	renderPage(w, r, http.StatusOK, "bundle.html", pageLanguage(r, mapping), map[string]interface{}{
+		"Title": mapping.Title,
+		"Items": links,
+	})
+}
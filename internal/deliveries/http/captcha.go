@@ -0,0 +1,37 @@
+package http
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"template/internal/pkg/captcha"
+)
+
+// EnableCaptcha makes POST /shorten require a solved CAPTCHA, checked with
+// verifier before the link is created, unless the request carries
+// adminToken.
+func (h *ShortenerHandler) EnableCaptcha(verifier captcha.Verifier, adminToken string) {
+	h.captcha = verifier
+	h.captchaBypassToken = adminToken
+}
+
+// checkCaptcha answers the request and returns false when token does not
+// pass. The check fails closed: when the provider cannot be asked, nothing
+// is created.
+func (h *ShortenerHandler) checkCaptcha(w http.ResponseWriter, r *http.Request, token string) bool {
+	if h.captcha == nil || hasBearerToken(r, h.captchaBypassToken) {
+		return true
+	}
+	err := h.captcha.Verify(r.Context(), token, clientIP(r))
+	if err == nil {
+		return true
+	}
+	log.Printf("Handler: CAPTCHA check failed: %v", err)
+	if errors.Is(err, captcha.ErrFailed) {
+		writeError(w, r, http.StatusForbidden, ErrorResponse{Error: "CAPTCHA verification failed", Code: codeCaptchaFailed})
+	} else {
+		respondWithError(w, r, http.StatusServiceUnavailable, "CAPTCHA verification is unavailable, try again later")
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// CreateClaimRequest is the body of POST /api/v1/domain-claims.
+type CreateClaimRequest struct {
+	Domain string `json:"domain"`
+}
+
+// DomainClaimResponse is a claim with what to publish on the domain to
+// verify it: the meta tag or the well-known file with the token.
+type DomainClaimResponse struct {
+	*shortner.DomainClaim
+	MetaTag      string `json:"meta_tag"`
+	WellKnownURL string `json:"well_known_url"`
+}
+
+// TakedownRequest is the body of POST /api/v1/domain-claims/takedown.
+type TakedownRequest struct {
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+type ClaimedLinkListResponse struct {
+	Items      []shortner.ClaimedLink `json:"items"`
+	NextCursor string                 `json:"next_cursor"`
+}
+
+// DomainHandler serves the domain owner API. Apart from creating a claim,
+// requests carry "Authorization: Bearer <claim key>".
+type DomainHandler struct {
+	claims services.DomainClaimService
+}
+
+func NewDomainHandler(claims services.DomainClaimService) *DomainHandler {
+	return &DomainHandler{claims: claims}
+}
+
+func (h *DomainHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/domain-claims", h.handleCreate)
+	mux.HandleFunc("/api/v1/domain-claims/verify", h.handleVerify)
+	mux.HandleFunc("/api/v1/domain-claims/links", h.handleLinks)
+	mux.HandleFunc("/api/v1/domain-claims/takedown", h.handleTakedown)
+
+	logRoutes("Domains", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *DomainHandler) Routes() []Route {
+	return []Route{
+		route("/api/v1/domain-claims", http.MethodPost),
+		route("/api/v1/domain-claims/verify", http.MethodPost),
+		route("/api/v1/domain-claims/links", http.MethodGet),
+		route("/api/v1/domain-claims/takedown", http.MethodPost),
+	}
+}
+
+// claimKey returns the bearer key of r, empty when there is none; the
+// service rejects an empty key like a wrong one.
+func claimKey(r *http.Request) string {
+	key, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return key
+}
+
+func (h *DomainHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	var req CreateClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Handler error decoding domain claim: %v", err)
+		respondWithBodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	claim, err := h.claims.CreateClaim(req.Domain)
+	if err != nil {
+		log.Printf("Handler error from service CreateClaim for '%s': %v", req.Domain, err)
+		respondWithServiceError(w, r, err, "Failed to create domain claim")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusCreated, DomainClaimResponse{
+		DomainClaim:  claim,
+		MetaTag:      fmt.Sprintf(`<meta name="%s" content="%s">`, services.VerificationMetaName, claim.VerificationToken),
+		WellKnownURL: "https://" + claim.Domain + services.VerificationPath,
+	})
+}
+
+func (h *DomainHandler) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	claim, err := h.claims.Verify(r.Context(), claimKey(r))
+	if err != nil {
+		log.Printf("Handler error from service Verify: %v", err)
+		respondWithServiceError(w, r, err, "Failed to verify domain")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, claim)
+}
+
+// handleLinks accepts ?limit= (50 by default, at most 100) and the ?cursor=
+// of the previous page; next_cursor is empty on the last page.
+func (h *DomainHandler) handleLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	limit, ok := queryInt(w, r, "limit")
+	if !ok {
+		return
+	}
+	afterID, err := decodeCursor(cursorPrefixLinks, r.URL.Query().Get("cursor"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid cursor parameter")
+		return
+	}
+
+	links, next, err := h.claims.ListLinks(claimKey(r), afterID, limit)
+	if err != nil {
+		log.Printf("Handler error from service ListLinks: %v", err)
+		respondWithServiceError(w, r, err, "Failed to list links")
+		return
+	}
+	resp := ClaimedLinkListResponse{Items: links}
+	if resp.Items == nil {
+		resp.Items = []shortner.ClaimedLink{}
+	}
+	if next != 0 {
+		resp.NextCursor = encodeCursor(cursorPrefixLinks, next)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (h *DomainHandler) handleTakedown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	var req TakedownRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Handler error decoding takedown: %v", err)
+		respondWithBodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	block, err := h.claims.Takedown(claimKey(r), req.Code, req.Reason)
+	if err != nil {
+		log.Printf("Handler error from service Takedown for '%s': %v", req.Code, err)
+		respondWithServiceError(w, r, err, "Failed to take down link")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, block)
+}
@@ -1,14 +1,58 @@
 package http
 
+import "template/internal/services"
+
+// ShortenRequest with SingleUse creates a link that opens only once. With
+// Wildcard, the link also redirects /{code}/{path...} to the destination
+// with the path appended.
 type ShortenRequest struct {
-	URL string `json:"url" binding:"required,url"`
+	URL       string `json:"url" binding:"required,url"`
+	SingleUse bool   `json:"single_use"`
+	Wildcard  bool   `json:"wildcard"`
+	// CaptchaToken is the response of the CAPTCHA widget, required from
+	// anonymous clients when CAPTCHA_PROVIDER is set.
+	CaptchaToken string `json:"captcha_token,omitempty"`
 }
 
+// ShortenResponse names its fields the way shortner.URLMapping does:
+// ShortCode and LongURL, the destination as stored. OriginalURL shows the
+// destination in its human-readable form, with an internationalized domain
+// decoded from punycode. Warnings flags destinations that look like
+// homograph (look-alike) domains.
 type ShortenResponse struct {
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	ShortCode   string   `json:"short_code"`
+	ShortURL    string   `json:"short_url"`
+	LongURL     string   `json:"long_url"`
+	OriginalURL string   `json:"original_url"`
+	Warnings    []string `json:"warnings,omitempty"`
+}
+
+// ResponseEnvelope is the body of every JSON response when
+// RESPONSE_ENVELOPE is on: Data holds the payload of a success, Error the
+// ErrorResponse of a failure, and the other member is null.
+type ResponseEnvelope struct {
+	Data  interface{}    `json:"data"`
+	Error *ErrorResponse `json:"error"`
 }
 
+// ErrorResponse is the body of every error response. Error is the human
+// readable message, Code a stable identifier (e.g. LINK_NOT_FOUND) and
+// Fields lists per-field validation problems when there are any.
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error  string                `json:"error"`
+	Code   string                `json:"code"`
+	Fields []services.FieldError `json:"fields,omitempty"`
+}
+
+// ProblemDetails is the RFC 7807 representation of ErrorResponse, sent when
+// the client accepts application/problem+json. Code and Errors are extension
+// members carrying the same values as ErrorResponse.Code and Fields.
+type ProblemDetails struct {
+	Type     string                `json:"type"`
+	Title    string                `json:"title"`
+	Status   int                   `json:"status"`
+	Detail   string                `json:"detail,omitempty"`
+	Instance string                `json:"instance,omitempty"`
+	Code     string                `json:"code"`
+	Errors   []services.FieldError `json:"errors,omitempty"`
 }
@@ -0,0 +1,172 @@
+package http
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"template/internal/pkg/mailer"
+	"template/internal/pkg/tasks"
+	"template/internal/pkg/utils"
+	"template/internal/services"
+)
+
+const (
+	inboundEmailMaxBytes = 10 << 20
+	inboundEmailMaxURLs  = 20
+)
+
+// EmailHandler accepts inbound-parse webhooks from SendGrid or Mailgun,
+// shortens every URL found in the message and mails the links back to the
+// sender.
+type EmailHandler struct {
+	service        services.ShortenerService
+	mailer         mailer.Mailer
+	pool           *tasks.Pool
+	inboundAddress string
+	webhookToken   string
+	baseURL        string
+}
+
+// NewEmailHandler sends the replies on pool, which retries failed sends.
+func NewEmailHandler(svc services.ShortenerService, m mailer.Mailer, pool *tasks.Pool, inboundAddress, webhookToken, baseURL string) *EmailHandler {
+	return &EmailHandler{
+		service:        svc,
+		mailer:         m,
+		pool:           pool,
+		inboundAddress: strings.ToLower(inboundAddress),
+		webhookToken:   webhookToken,
+		baseURL:        baseURL,
+	}
+}
+
+func (h *EmailHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/integrations/email", h.handleInbound)
+
+	logRoutes("Email", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *EmailHandler) Routes() []Route {
+	return []Route{
+		route("/integrations/email", http.MethodPost),
+	}
+}
+
+type inboundEmail struct {
+	Sender    string
+	Recipient string
+	Subject   string
+	Text      string
+}
+
+func (h *EmailHandler) handleInbound(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	if h.webhookToken == "" || subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(h.webhookToken)) != 1 {
+		respondWithError(w, r, http.StatusUnauthorized, "Invalid webhook token")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, inboundEmailMaxBytes)
+	if err := r.ParseMultipartForm(inboundEmailMaxBytes); err != nil && err != http.ErrNotMultipart {
+		log.Printf("Email handler error parsing inbound payload: %v", err)
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if r.Form == nil {
+		if err := r.ParseForm(); err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	msg := parseInboundEmail(r)
+	if msg.Sender == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Missing sender")
+		return
+	}
+	if h.inboundAddress != "" && !addressedTo(msg.Recipient, h.inboundAddress) {
+		// Acknowledge so the provider doesn't retry, but don't act on mail
+		// that wasn't addressed to the shortening gateway.
+		log.Printf("Email handler ignoring message to '%s'", msg.Recipient)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	urls := utils.ExtractURLs(msg.Text, inboundEmailMaxURLs)
+	reply := h.buildReply(urls)
+
+	h.pool.Submit("email reply to "+msg.Sender, func() error {
+		return h.mailer.Send(msg.Sender, "Re: "+msg.Subject, reply)
+	})
+
+	w.WriteHeader(http.StatusOK)
+	log.Printf("Email handler processed message from %s with %d URL(s)", msg.Sender, len(urls))
+}
+
+func (h *EmailHandler) buildReply(urls []string) string {
+	if len(urls) == 0 {
+		return "We couldn't find any http(s) links in your message.\n"
+	}
+
+	var b strings.Builder
+	b.WriteString("Here are your short links:\n\n")
+	for _, longURL := range urls {
+		shortCode, err := h.service.CreateShortURL(longURL)
+		if err != nil {
+			log.Printf("Email handler error from service CreateShortURL for %s: %v", longURL, err)
+			fmt.Fprintf(&b, "%s\n  -> could not be shortened\n\n", longURL)
+			continue
+		}
+		fmt.Fprintf(&b, "%s\n  -> %s\n\n", longURL, buildShortURL(h.baseURL, shortCode))
+	}
+	return b.String()
+}
+
+// addressedTo reports whether the recipient list, as in a To header, holds
+// address, ignoring case. A list that does not parse holds nothing.
+func addressedTo(recipients, address string) bool {
+	list, err := mail.ParseAddressList(recipients)
+	if err != nil {
+		return false
+	}
+	for _, recipient := range list {
+		if strings.EqualFold(recipient.Address, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseInboundEmail normalizes the SendGrid Inbound Parse and Mailgun Routes
+// field names into a single structure.
+func parseInboundEmail(r *http.Request) inboundEmail {
+	var msg inboundEmail
+	msg.Subject = r.FormValue("subject")
+
+	if r.FormValue("body-plain") != "" || r.FormValue("sender") != "" {
+		// Mailgun
+		msg.Sender = r.FormValue("sender")
+		msg.Recipient = r.FormValue("recipient")
+		msg.Text = r.FormValue("body-plain")
+	} else {
+		// SendGrid
+		msg.Sender = r.FormValue("from")
+		msg.Recipient = r.FormValue("to")
+		msg.Text = r.FormValue("text")
+		if msg.Text == "" {
+			msg.Text = r.FormValue("html")
+		}
+	}
+
+	if addr, err := mail.ParseAddress(msg.Sender); err == nil {
+		msg.Sender = addr.Address
+	}
+	return msg
+}
@@ -0,0 +1,26 @@
+package http
+
+import "testing"
+
+func TestAddressedTo(t *testing.T) {
+	const inbound = "shorten@links.example.com"
+	for _, tt := range []struct {
+		recipients string
+		want       bool
+	}{
+		{"shorten@links.example.com", true},
+		{"Shorten@Links.Example.com", true},
+		{"Link Bot <shorten@links.example.com>", true},
+		{"someone@example.com, Link Bot <shorten@links.example.com>", true},
+		{"evilshorten@links.example.com", false},
+		{"shorten@links.example.com.evil.test", false},
+		{`"shorten@links.example.com" <attacker@evil.test>`, false},
+		{"someone@example.com", false},
+		{"not an address", false},
+		{"", false},
+	} {
+		if got := addressedTo(tt.recipients, inbound); got != tt.want {
+			t.Errorf("addressedTo(%q) = %v, want %v", tt.recipients, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"template/internal/repositories"
+	"template/internal/services"
+)
+
+// Error codes for failures detected by the HTTP layer itself, before a
+// service is called. Service failures carry their own services.ErrorCode.
+const (
+	codeInvalidRequest     = "INVALID_REQUEST"
+	codeUnauthorized       = "UNAUTHORIZED"
+	codeForbidden          = "FORBIDDEN"
+	codeNotFound           = "NOT_FOUND"
+	codeMethodNotAllowed   = "METHOD_NOT_ALLOWED"
+	codeConflict           = "CONFLICT"
+	codeGone               = "GONE"
+	codeLengthRequired     = "LENGTH_REQUIRED"
+	codePreconditionFailed = "PRECONDITION_FAILED"
+	codePayloadTooLarge    = "PAYLOAD_TOO_LARGE"
+	codeUnprocessable      = "UNPROCESSABLE_ENTITY"
+	codeRateLimited        = "RATE_LIMITED"
+	codeLoopDetected       = "LOOP_DETECTED"
+	codeInternal           = "INTERNAL_ERROR"
+	codeServiceUnavailable = "SERVICE_UNAVAILABLE"
+	codeMaintenance        = "MAINTENANCE"
+	codeCaptchaFailed      = "CAPTCHA_FAILED"
+	codeWrongRegion        = "WRONG_REGION"
+)
+
+// unavailableRetryAfter is the Retry-After, in seconds, of the 503 answers
+// given while the database is unavailable.
+const unavailableRetryAfter = 30
+
+const (
+	contentTypeProblemJSON = "application/problem+json"
+	problemTypePrefix      = "urn:shortener:problem:"
+)
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            codeInvalidRequest,
+	http.StatusUnauthorized:          codeUnauthorized,
+	http.StatusForbidden:             codeForbidden,
+	http.StatusNotFound:              codeNotFound,
+	http.StatusMethodNotAllowed:      codeMethodNotAllowed,
+	http.StatusConflict:              codeConflict,
+	http.StatusGone:                  codeGone,
+	http.StatusLengthRequired:        codeLengthRequired,
+	http.StatusPreconditionFailed:    codePreconditionFailed,
+	http.StatusRequestEntityTooLarge: codePayloadTooLarge,
+	http.StatusUnprocessableEntity:   codeUnprocessable,
+	http.StatusTooManyRequests:       codeRateLimited,
+	http.StatusLoopDetected:          codeLoopDetected,
+	http.StatusServiceUnavailable:    codeServiceUnavailable,
+	http.StatusMisdirectedRequest:    codeWrongRegion,
+}
+
+var serviceErrorStatus = map[services.ErrorCode]int{
+	services.CodeInvalidURL:           http.StatusBadRequest,
+	services.CodeURLTooLong:           http.StatusUnprocessableEntity,
+	services.CodeValidationFailed:     http.StatusBadRequest,
+	services.CodeLinkNotFound:         http.StatusNotFound,
+	services.CodeCodeMistyped:         http.StatusNotFound,
+	services.CodeHookNotFound:         http.StatusNotFound,
+	services.CodeBundleItemNotFound:   http.StatusNotFound,
+	services.CodeLinkExpired:          http.StatusGone,
+	services.CodeLinkConsumed:         http.StatusGone,
+	services.CodePayloadTooLarge:      http.StatusRequestEntityTooLarge,
+	services.CodeFileNotUploaded:      http.StatusNotFound,
+	services.CodeUploadForbidden:      http.StatusForbidden,
+	services.CodePixelNotFound:        http.StatusNotFound,
+	services.CodeScheduleNotFound:     http.StatusNotFound,
+	services.CodeSubscriptionNotFound: http.StatusNotFound,
+	services.CodeDestinationBlocked:   http.StatusForbidden,
+	services.CodeDestinationPrivate:   http.StatusForbidden,
+	services.CodeFlagNotFound:         http.StatusNotFound,
+	services.CodeStatsPrivate:         http.StatusForbidden,
+	services.CodeSignatureInvalid:     http.StatusForbidden,
+	services.CodeSignatureExpired:     http.StatusGone,
+	services.CodeCodeTaken:            http.StatusConflict,
+	services.CodeTrashItemNotFound:    http.StatusNotFound,
+	services.CodeSearchUnavailable:    http.StatusNotImplemented,
+	services.CodeListingUnavailable:   http.StatusNotImplemented,
+	services.CodeLinkBlocked:          http.StatusForbidden,
+	services.CodeBlockNotFound:        http.StatusNotFound,
+	services.CodeHoneypotNotFound:     http.StatusNotFound,
+	services.CodeWorkspaceNotFound:    http.StatusNotFound,
+	services.CodeProfileNotFound:      http.StatusNotFound,
+	services.CodeProfileItemNotFound:  http.StatusNotFound,
+	services.CodeClaimKeyInvalid:      http.StatusUnauthorized,
+	services.CodeDomainNotVerified:    http.StatusForbidden,
+	services.CodeChainedLink:          http.StatusUnprocessableEntity,
+	services.CodeRedirectLoop:         http.StatusUnprocessableEntity,
+	services.CodeAPIKeyNotFound:       http.StatusNotFound,
+	services.CodeDomainNotFound:       http.StatusNotFound,
+	services.CodeBlockTaken:           http.StatusConflict,
+	services.CodeInternal:             http.StatusInternalServerError,
+}
+
+// respondWithError writes an error detected by the handler itself; the
+// machine-readable code is derived from the status.
+func respondWithError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = codeInternal
+	}
+	log.Printf("Responding with error: %d %s - %s", status, code, message)
+	writeError(w, r, status, ErrorResponse{Error: message, Code: code})
+}
+
+// respondWithBodyError answers a request whose body could not be read or
+// decoded: 413 when it went past the limit set by BodyLimit, 400 otherwise.
+func respondWithBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body is too large (limit %d bytes)", tooLarge.Limit))
+		return
+	}
+	respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+}
+
+// respondWithServiceError is the single mapping from service errors to HTTP
+// responses. Typed services.Error values keep their code, message and field
+// errors; anything else is an internal error answered with fallbackMessage so
+// that database details never leak to clients.
+func respondWithServiceError(w http.ResponseWriter, r *http.Request, err error, fallbackMessage string) {
+	var svcErr *services.Error
+	if !errors.As(err, &svcErr) && repositories.Unavailable(err) {
+		// The request can succeed once the database is back, unlike
+		// after an internal error.
+		log.Printf("Responding with unavailable database: %v", err)
+		w.Header().Set("Retry-After", strconv.Itoa(unavailableRetryAfter))
+		writeError(w, r, http.StatusServiceUnavailable, ErrorResponse{Error: "The service is temporarily unavailable, try again later", Code: codeServiceUnavailable})
+		return
+	}
+	var wrongRegion *repositories.WrongRegionError
+	if svcErr == nil && errors.As(err, &wrongRegion) {
+		log.Printf("Responding with wrong region: %v", err)
+		writeError(w, r, http.StatusMisdirectedRequest, ErrorResponse{
+			Error: "The link can only be changed in its home region",
+			Code:  codeWrongRegion,
+			Fields: []services.FieldError{{
+				Field:   "short_code",
+				Message: fmt.Sprintf("belongs to region %s, at %s", wrongRegion.Region.Name, wrongRegion.Region.BaseURL),
+			}},
+		})
+		return
+	}
+	if svcErr == nil || svcErr.Code == services.CodeInternal {
+		log.Printf("Responding with internal error: %v", err)
+		writeError(w, r, http.StatusInternalServerError, ErrorResponse{Error: fallbackMessage, Code: codeInternal})
+		return
+	}
+
+	status, ok := serviceErrorStatus[svcErr.Code]
+	if !ok {
+		status = http.StatusBadRequest
+	}
+	log.Printf("Responding with error: %d %s - %s", status, svcErr.Code, svcErr.Message)
+	writeError(w, r, status, ErrorResponse{
+		Error:  svcErr.Message,
+		Code:   string(svcErr.Code),
+		Fields: svcErr.Fields,
+	})
+}
+
+// writeError localizes the message and renders the error as
+// application/problem+json (RFC 7807) when the client asks for it, and in the
+// default ErrorResponse shape otherwise.
+func writeError(w http.ResponseWriter, r *http.Request, status int, body ErrorResponse) {
+	body = localizeError(r, body)
+	w.Header().Set("Content-Language", requestLanguage(r))
+	w.Header().Add("Vary", "Accept-Language")
+
+	if !wantsProblemJSON(r) {
+		respondWithJSON(w, status, body)
+		return
+	}
+
+	problem := ProblemDetails{
+		Type:     problemTypePrefix + strings.ToLower(strings.ReplaceAll(body.Code, "_", "-")),
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   body.Error,
+		Instance: r.URL.Path,
+		Code:     body.Code,
+		Errors:   body.Fields,
+	}
+	payload, err := json.Marshal(problem)
+	if err != nil {
+		log.Printf("Error marshalling problem response: %v", err)
+		respondWithJSON(w, status, body)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeProblemJSON)
+	w.WriteHeader(status)
+	if _, err := w.Write(payload); err != nil {
+		log.Printf("Error writing problem response: %v", err)
+	}
+}
+
+func wantsProblemJSON(r *http.Request) bool {
+	return r != nil && strings.Contains(r.Header.Get("Accept"), contentTypeProblemJSON)
+}
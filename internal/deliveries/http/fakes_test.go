@@ -0,0 +1,594 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"template/internal/pkg/outbound"
+	"template/internal/repositories"
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// fakeShortenerRepo is an in-memory ShortenerRepository. Setting errs[method]
+// makes that method fail with the error instead of touching the map.
+type fakeShortenerRepo struct {
+	mu     sync.Mutex
+	links  map[string]shortner.URLMapping
+	nextID int64
+	errs   map[string]error
+}
+
+var _ repositories.ShortenerRepository = (*fakeShortenerRepo)(nil)
+
+func newFakeShortenerRepo(links ...shortner.URLMapping) *fakeShortenerRepo {
+	r := &fakeShortenerRepo{links: make(map[string]shortner.URLMapping), errs: make(map[string]error)}
+	for _, m := range links {
+		r.put(m)
+	}
+	return r
+}
+
+func (r *fakeShortenerRepo) put(m shortner.URLMapping) int64 {
+	r.nextID++
+	m.ID = r.nextID
+	if m.Kind == "" {
+		m.Kind = shortner.KindRedirect
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	r.links[m.ShortCode] = m
+	return m.ID
+}
+
+func (r *fakeShortenerRepo) fail(method string) error {
+	return r.errs[method]
+}
+
+func (r *fakeShortenerRepo) InitSchema() error { return r.fail("InitSchema") }
+
+func (r *fakeShortenerRepo) SaveMapping(shortCode, longURL string) (int64, error) {
+	return r.CreateMapping(shortner.URLMapping{ShortCode: shortCode, LongURL: longURL})
+}
+
+func (r *fakeShortenerRepo) CreateMapping(mapping shortner.URLMapping) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail("CreateMapping"); err != nil {
+		return 0, err
+	}
+	if _, ok := r.links[mapping.ShortCode]; ok {
+		return 0, fmt.Errorf("UNIQUE constraint failed: urls.short_code")
+	}
+	return r.put(mapping), nil
+}
+
+func (r *fakeShortenerRepo) FindByShortCode(shortCode string) (string, error) {
+	m, err := r.GetMapping(shortCode)
+	if err != nil {
+		return "", err
+	}
+	return m.LongURL, nil
+}
+
+func (r *fakeShortenerRepo) GetMapping(shortCode string) (*shortner.URLMapping, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail("GetMapping"); err != nil {
+		return nil, err
+	}
+	m, ok := r.links[shortCode]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	return &m, nil
+}
+
+func (r *fakeShortenerRepo) FindByLongURL(longURL string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail("FindByLongURL"); err != nil {
+		return "", err
+	}
+	for code, m := range r.links {
+		if m.LongURL == longURL {
+			return code, nil
+		}
+	}
+	return "", nil
+}
+
+func (r *fakeShortenerRepo) UpdateLongURL(shortCode, newLongURL string) error {
+	return r.update(shortCode, "UpdateLongURL", func(m *shortner.URLMapping) { m.LongURL = newLongURL })
+}
+
+func (r *fakeShortenerRepo) UpdateMapping(mapping shortner.URLMapping) error {
+	return r.update(mapping.ShortCode, "UpdateMapping", func(m *shortner.URLMapping) {
+		id := m.ID
+		*m = mapping
+		m.ID = id
+	})
+}
+
+func (r *fakeShortenerRepo) ConsumeMapping(shortCode string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail("ConsumeMapping"); err != nil {
+		return err
+	}
+	m, ok := r.links[shortCode]
+	if !ok || !m.SingleUse || m.ConsumedAt != nil {
+		return repositories.ErrNotFound
+	}
+	m.ConsumedAt = &now
+	r.links[shortCode] = m
+	return nil
+}
+
+func (r *fakeShortenerRepo) update(shortCode, method string, apply func(*shortner.URLMapping)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail(method); err != nil {
+		return err
+	}
+	m, ok := r.links[shortCode]
+	if !ok {
+		return repositories.ErrNotFound
+	}
+	apply(&m)
+	r.links[shortCode] = m
+	return nil
+}
+
+func (r *fakeShortenerRepo) DeleteMapping(shortCode string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail("DeleteMapping"); err != nil {
+		return err
+	}
+	if _, ok := r.links[shortCode]; !ok {
+		return repositories.ErrNotFound
+	}
+	delete(r.links, shortCode)
+	return nil
+}
+
+func (r *fakeShortenerRepo) sorted(keep func(shortner.URLMapping) bool) []shortner.URLMapping {
+	var out []shortner.URLMapping
+	for _, m := range r.links {
+		if keep(m) {
+			out = append(out, m)
+		}
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ID < out[b].ID })
+	return out
+}
+
+func (r *fakeShortenerRepo) ListSince(afterID int64, limit int) ([]shortner.URLMapping, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail("ListSince"); err != nil {
+		return nil, err
+	}
+	out := r.sorted(func(m shortner.URLMapping) bool { return m.ID > afterID })
+	return out[:min(limit, len(out))], nil
+}
+
+func (r *fakeShortenerRepo) ListExpired(before time.Time, limit int) ([]shortner.URLMapping, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail("ListExpired"); err != nil {
+		return nil, err
+	}
+	out := r.sorted(func(m shortner.URLMapping) bool { return m.ExpiresAt != nil && m.ExpiresAt.Before(before) })
+	return out[:min(limit, len(out))], nil
+}
+
+// fakeShortenerService is a ShortenerService over a fakeShortenerRepo that
+// hands out the codes code1, code2, ... and records the methods called.
+// Setting errs[method] makes that method fail with the error.
+type fakeShortenerService struct {
+	repo *fakeShortenerRepo
+
+	mu     sync.Mutex
+	next   int
+	calls  []string
+	errs   map[string]error
+	policy services.LinkPolicy
+}
+
+var _ services.ShortenerService = (*fakeShortenerService)(nil)
+
+func newFakeShortenerService(repo *fakeShortenerRepo) *fakeShortenerService {
+	return &fakeShortenerService{repo: repo, errs: make(map[string]error)}
+}
+
+func (s *fakeShortenerService) call(method string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, method)
+	return s.errs[method]
+}
+
+func (s *fakeShortenerService) called(method string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.calls {
+		if c == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *fakeShortenerService) create(mapping shortner.URLMapping) (string, error) {
+	if !s.ValidateURL(mapping.LongURL) {
+		return "", services.ErrInvalidURL
+	}
+	s.mu.Lock()
+	s.next++
+	mapping.ShortCode = fmt.Sprintf("code%d", s.next)
+	s.mu.Unlock()
+	if _, err := s.repo.CreateMapping(mapping); err != nil {
+		return "", err
+	}
+	return mapping.ShortCode, nil
+}
+
+func (s *fakeShortenerService) CreateShortURL(longURL string) (string, error) {
+	if err := s.call("CreateShortURL"); err != nil {
+		return "", err
+	}
+	return s.create(shortner.URLMapping{LongURL: longURL})
+}
+
+func (s *fakeShortenerService) CreateSingleUseURL(longURL string) (string, error) {
+	if err := s.call("CreateSingleUseURL"); err != nil {
+		return "", err
+	}
+	return s.create(shortner.URLMapping{LongURL: longURL, SingleUse: true})
+}
+
+func (s *fakeShortenerService) CreateWildcardURL(longURL string) (string, error) {
+	if err := s.call("CreateWildcardURL"); err != nil {
+		return "", err
+	}
+	return s.create(shortner.URLMapping{LongURL: longURL, Wildcard: true})
+}
+
+func (s *fakeShortenerService) CreateLink(mapping shortner.URLMapping) (string, error) {
+	if err := s.call("CreateLink"); err != nil {
+		return "", err
+	}
+	return s.create(mapping)
+}
+
+func (s *fakeShortenerService) GetLink(shortCode string) (*shortner.URLMapping, error) {
+	if err := s.call("GetLink"); err != nil {
+		return nil, err
+	}
+	return s.notFound(s.repo.GetMapping(shortCode))
+}
+
+func (s *fakeShortenerService) notFound(m *shortner.URLMapping, err error) (*shortner.URLMapping, error) {
+	if err == repositories.ErrNotFound {
+		return nil, services.ErrLinkNotFound
+	}
+	return m, err
+}
+
+func (s *fakeShortenerService) ConsumeLink(shortCode string) error {
+	if err := s.call("ConsumeLink"); err != nil {
+		return err
+	}
+	if err := s.repo.ConsumeMapping(shortCode, time.Now()); err == repositories.ErrNotFound {
+		return services.ErrLinkConsumed
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *fakeShortenerService) ValidateURL(inputURL string) bool {
+	return strings.HasPrefix(inputURL, "http://") || strings.HasPrefix(inputURL, "https://")
+}
+
+func (s *fakeShortenerService) CheckCode(shortCode string) error {
+	return s.call("CheckCode")
+}
+
+func (s *fakeShortenerService) NormalizeDestination(field, rawURL string) (string, error) {
+	if err := s.call("NormalizeDestination"); err != nil {
+		return "", err
+	}
+	return rawURL, nil
+}
+
+func (s *fakeShortenerService) SetPolicy(policy services.LinkPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = policy
+}
+
+func (s *fakeShortenerService) SetOutboundClient(*outbound.Client) {}
+
+func (s *fakeShortenerService) SetHoneypots(services.HoneypotService) {}
+
+func (s *fakeShortenerService) UpdateLongURL(shortCode, newLongURL string) error {
+	if err := s.call("UpdateLongURL"); err != nil {
+		return err
+	}
+	return s.UpdateLink(shortCode, shortner.LinkUpdate{LongURL: &newLongURL})
+}
+
+func (s *fakeShortenerService) UpdateLink(shortCode string, update shortner.LinkUpdate) error {
+	if err := s.call("UpdateLink"); err != nil {
+		return err
+	}
+	err := s.repo.update(shortCode, "UpdateMapping", func(m *shortner.URLMapping) {
+		if update.LongURL != nil {
+			m.LongURL = *update.LongURL
+		}
+		if update.RedirectType != nil {
+			m.RedirectType = *update.RedirectType
+		}
+		if update.StatsVisibility != nil {
+			m.StatsVisibility = *update.StatsVisibility
+			if m.StatsVisibility == shortner.StatsToken {
+				m.StatsToken = "stats-token"
+			}
+		}
+		if update.ExpiresAt != nil {
+			m.ExpiresAt = update.ExpiresAt
+		}
+	})
+	if err == repositories.ErrNotFound {
+		return services.ErrLinkNotFound
+	}
+	return err
+}
+
+func (s *fakeShortenerService) DeleteMapping(shortCode string) error {
+	if err := s.call("DeleteMapping"); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteMapping(shortCode); err == repositories.ErrNotFound {
+		return services.ErrLinkNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// BulkDelete and BulkUpdate only support selection by codes: a missing
+// code stops the operation unless SkipMissing is set.
+func (s *fakeShortenerService) BulkDelete(selection shortner.BulkSelection) (*shortner.BulkResult, error) {
+	if err := s.call("BulkDelete"); err != nil {
+		return nil, err
+	}
+	return s.bulk(selection, shortner.BulkItemDeleted, func(code string) error {
+		return s.repo.DeleteMapping(code)
+	})
+}
+
+func (s *fakeShortenerService) BulkUpdate(selection shortner.BulkSelection, update shortner.LinkUpdate) (*shortner.BulkResult, error) {
+	if err := s.call("BulkUpdate"); err != nil {
+		return nil, err
+	}
+	return s.bulk(selection, shortner.BulkItemUpdated, func(code string) error {
+		return s.UpdateLink(code, update)
+	})
+}
+
+func (s *fakeShortenerService) bulk(selection shortner.BulkSelection, status string, apply func(code string) error) (*shortner.BulkResult, error) {
+	result := &shortner.BulkResult{Applied: true, Transactional: true, Results: []shortner.BulkItemResult{}}
+	var found []string
+	for _, code := range selection.Codes {
+		if _, err := s.repo.GetMapping(code); err != nil {
+			result.Results = append(result.Results, shortner.BulkItemResult{ShortCode: code, Status: shortner.BulkItemNotFound})
+			result.Applied = result.Applied && selection.SkipMissing
+			continue
+		}
+		found = append(found, code)
+	}
+	result.Matched = len(found)
+	for _, code := range found {
+		if !result.Applied {
+			result.Results = append(result.Results, shortner.BulkItemResult{ShortCode: code, Status: shortner.BulkItemSkipped})
+			continue
+		}
+		if err := apply(code); err != nil {
+			return nil, err
+		}
+		result.Changed++
+		result.Results = append(result.Results, shortner.BulkItemResult{ShortCode: code, Status: status})
+	}
+	return result, nil
+}
+
+func (s *fakeShortenerService) ListLinksSince(afterID int64, limit int) ([]shortner.URLMapping, error) {
+	if err := s.call("ListLinksSince"); err != nil {
+		return nil, err
+	}
+	return s.repo.ListSince(afterID, limit)
+}
+
+func (s *fakeShortenerService) SearchLinks(ctx context.Context, query string, page shortner.SearchPage) ([]shortner.URLMapping, error) {
+	if err := s.call("SearchLinks"); err != nil {
+		return nil, err
+	}
+	all, err := s.repo.ListSince(0, len(s.repo.links))
+	if err != nil {
+		return nil, err
+	}
+	var matches []shortner.URLMapping
+	for _, m := range all {
+		if strings.Contains(m.LongURL, query) || strings.Contains(m.Title, query) {
+			matches = append(matches, m)
+		}
+	}
+	matches = matches[min(page.Offset, len(matches)):]
+	return matches[:min(page.Limit, len(matches))], nil
+}
+
+// FindLinksByDestination matches exactly, or by prefix for MatchPrefix;
+// the real normalization and domain matching are tested with the service.
+func (s *fakeShortenerService) FindLinksByDestination(ctx context.Context, destination, match string, afterID int64, limit int) ([]shortner.URLMapping, error) {
+	if err := s.call("FindLinksByDestination"); err != nil {
+		return nil, err
+	}
+	all, err := s.repo.ListSince(afterID, len(s.repo.links))
+	if err != nil {
+		return nil, err
+	}
+	var matches []shortner.URLMapping
+	for _, m := range all {
+		if m.LongURL == destination || (match == services.MatchPrefix && strings.HasPrefix(m.LongURL, destination)) {
+			matches = append(matches, m)
+		}
+	}
+	return matches[:min(limit, len(matches))], nil
+}
+
+func (s *fakeShortenerService) ListRevisions(shortCode string) ([]shortner.LinkRevision, error) {
+	if err := s.call("ListRevisions"); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// fakeAnalytics records the clicks handlers enqueue.
+type fakeAnalytics struct {
+	mu     sync.Mutex
+	clicks []shortner.Click
+}
+
+var _ services.AnalyticsService = (*fakeAnalytics)(nil)
+
+func (a *fakeAnalytics) RecordClick(click shortner.Click) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.clicks = append(a.clicks, click)
+	return nil
+}
+
+func (a *fakeAnalytics) EnqueueClick(click shortner.Click) {
+	a.RecordClick(click)
+}
+
+func (a *fakeAnalytics) Stop() {}
+
+func (a *fakeAnalytics) recorded() []shortner.Click {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]shortner.Click(nil), a.clicks...)
+}
+
+func (a *fakeAnalytics) ListClicksSince(afterID int64, limit int) ([]shortner.Click, error) {
+	return nil, nil
+}
+
+func (a *fakeAnalytics) ListLinkClicks(shortCode string, afterID int64, limit int) ([]shortner.Click, error) {
+	return nil, nil
+}
+
+// ListClicksBetween lists the recorded clicks with their position as ID.
+func (a *fakeAnalytics) ListClicksBetween(codes []string, from, to time.Time, afterID int64, limit int) ([]shortner.Click, error) {
+	var clicks []shortner.Click
+	for i, click := range a.recorded() {
+		click.ID = int64(i + 1)
+		if click.ID <= afterID || !slices.Contains(codes, click.ShortCode) || click.ClickedAt.Before(from) || !click.ClickedAt.Before(to) {
+			continue
+		}
+		if clicks = append(clicks, click); len(clicks) == limit {
+			break
+		}
+	}
+	return clicks, nil
+}
+
+func (a *fakeAnalytics) TopLinks(codes []string, from, to time.Time, limit int) ([]shortner.LinkClicks, int64, error) {
+	return nil, 0, nil
+}
+
+// CountPerPeriod counts the recorded clicks per UTC day or hour.
+func (a *fakeAnalytics) CountPerPeriod(codes []string, from, to time.Time, interval string) ([]shortner.PeriodClicks, error) {
+	period := 24 * time.Hour
+	if interval == shortner.IntervalHour {
+		period = time.Hour
+	}
+	var counts []shortner.PeriodClicks
+	index := map[shortner.PeriodClicks]int{}
+	for _, click := range a.recorded() {
+		if !slices.Contains(codes, click.ShortCode) || click.ClickedAt.Before(from) || !click.ClickedAt.Before(to) {
+			continue
+		}
+		key := shortner.PeriodClicks{ShortCode: click.ShortCode, Start: click.ClickedAt.UTC().Truncate(period)}
+		if i, ok := index[key]; ok {
+			counts[i].Clicks++
+			continue
+		}
+		index[key] = len(counts)
+		key.Clicks = 1
+		counts = append(counts, key)
+	}
+	return counts, nil
+}
+
+// fakeClock is a services.Clock that only moves when told to.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+// fakeTrashService holds trashed links in memory; Restore puts them into
+// repo.
+type fakeTrashService struct {
+	repo  *fakeShortenerRepo
+	items []shortner.TrashedLink
+}
+
+var _ services.TrashService = (*fakeTrashService)(nil)
+
+func (s *fakeTrashService) ListTrash(beforeID int64, limit int) ([]shortner.TrashedLink, error) {
+	var page []shortner.TrashedLink
+	for i := len(s.items) - 1; i >= 0 && len(page) < limit; i-- {
+		if beforeID == 0 || s.items[i].ID < beforeID {
+			page = append(page, s.items[i])
+		}
+	}
+	return page, nil
+}
+
+func (s *fakeTrashService) take(shortCode string) (shortner.TrashedLink, error) {
+	for i, item := range s.items {
+		if item.Link.ShortCode == shortCode {
+			s.items = append(s.items[:i], s.items[i+1:]...)
+			return item, nil
+		}
+	}
+	return shortner.TrashedLink{}, &services.Error{Code: services.CodeTrashItemNotFound, Message: "short code is not in the trash"}
+}
+
+func (s *fakeTrashService) Restore(shortCode string) (*shortner.URLMapping, error) {
+	item, err := s.take(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	s.repo.mu.Lock()
+	defer s.repo.mu.Unlock()
+	item.Link.ID = s.repo.put(item.Link)
+	return &item.Link, nil
+}
+
+func (s *fakeTrashService) Purge(shortCode string) error {
+	_, err := s.take(shortCode)
+	return err
+}
+
+func (s *fakeTrashService) PurgeExpired(now time.Time) (int, error) { return 0, nil }
@@ -0,0 +1,238 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"template/internal/pkg/objectstore"
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+type CreateFileRequest struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// ExpiresIn is the lifetime in seconds; zero uses the server default.
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+type CreateFileResponse struct {
+	ShortCode string    `json:"short_code"`
+	ShortURL  string    `json:"short_url"`
+	UploadURL string    `json:"upload_url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Uploads and downloads through the server get fileTransferTime plus a
+// second per fileTransferRate bytes of the file, instead of the server's
+// read and write timeouts, which would cut large files off on slow links.
+const (
+	fileTransferTime = 10 * time.Second
+	fileTransferRate = 64 << 10
+)
+
+// FileHandler manages file links. A client declares the file with POST
+// /api/v1/files and then PUTs the content to the returned upload_url, which
+// is either presigned for the object store or points back at this server.
+type FileHandler struct {
+	files     services.FileService
+	analytics services.AnalyticsService
+	baseURL   string
+	// stream serves downloads through the server even when the store can
+	// presign download URLs.
+	stream bool
+	// maxBytes is FILE_MAX_BYTES, which bounds the time a transfer is
+	// given whatever size the client claims.
+	maxBytes int64
+
+	transferTime time.Duration
+	transferRate int64
+}
+
+func NewFileHandler(files services.FileService, analytics services.AnalyticsService, baseURL string, stream bool, maxBytes int64) *FileHandler {
+	return &FileHandler{
+		files:        files,
+		analytics:    analytics,
+		baseURL:      baseURL,
+		stream:       stream,
+		maxBytes:     maxBytes,
+		transferTime: fileTransferTime,
+		transferRate: fileTransferRate,
+	}
+}
+
+// transferDeadline is when a transfer of size bytes that starts now must
+// be done.
+func (h *FileHandler) transferDeadline(size int64) time.Time {
+	size = min(max(size, 0), h.maxBytes)
+	return time.Now().Add(h.transferTime + time.Duration(size)*time.Second/time.Duration(h.transferRate))
+}
+
+func (h *FileHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/files", h.handleCreateFile)
+	mux.HandleFunc("/api/v1/files/", h.handleUpload)
+
+	logRoutes("File", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *FileHandler) Routes() []Route {
+	return []Route{
+		route("/api/v1/files", http.MethodPost),
+		route("/api/v1/files/{code}/content", http.MethodPut),
+	}
+}
+
+func (h *FileHandler) handleCreateFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	var req CreateFileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Handler error decoding file request: %v", err)
+		respondWithBodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	drop, err := h.files.CreateFile(services.FileUpload{
+		Filename:    req.Filename,
+		ContentType: req.ContentType,
+		Size:        req.Size,
+	}, time.Duration(req.ExpiresIn)*time.Second)
+	if err != nil {
+		log.Printf("Handler error from service CreateFile: %v", err)
+		respondWithServiceError(w, r, err, "Failed to create file link")
+		return
+	}
+
+	uploadURL := drop.UploadURL
+	if uploadURL == "" {
+		uploadURL = buildShortURL(h.baseURL, "api/v1/files/"+drop.File.ShortCode+"/content?token="+url.QueryEscape(drop.File.UploadToken))
+	}
+	respondWithJSON(w, http.StatusCreated, CreateFileResponse{
+		ShortCode: drop.File.ShortCode,
+		ShortURL:  buildShortURL(h.baseURL, drop.File.ShortCode),
+		UploadURL: uploadURL,
+		ExpiresAt: drop.ExpiresAt,
+	})
+}
+
+// handleUpload serves PUT /api/v1/files/{code}/content?token=..., the upload
+// target used when the object store cannot presign uploads.
+func (h *FileHandler) handleUpload(w http.ResponseWriter, r *http.Request) {
+	shortCode, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/files/"), "/content")
+	if !ok || shortCode == "" || strings.Contains(shortCode, "/") {
+		respondWithError(w, r, http.StatusNotFound, "Not Found")
+		return
+	}
+	if r.Method != http.MethodPut {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	if r.ContentLength < 0 {
+		respondWithError(w, r, http.StatusLengthRequired, "Content-Length is required")
+		return
+	}
+
+	// Servers without deadlines, such as tests, do not support them;
+	// nothing is cut off there.
+	deadline := h.transferDeadline(r.ContentLength)
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(deadline)
+	_ = rc.SetWriteDeadline(deadline)
+
+	r.Body = http.MaxBytesReader(w, r.Body, r.ContentLength)
+	defer r.Body.Close()
+
+	err := h.files.Upload(shortCode, r.URL.Query().Get("token"), r.Body, r.ContentLength, r.Header.Get("Content-Type"))
+	if err != nil {
+		log.Printf("Handler error from service Upload for %s: %v", shortCode, err)
+		respondWithServiceError(w, r, err, "Failed to upload file")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "File uploaded successfully"})
+}
+
+// ServeLink implements LinkRenderer: the file is downloaded through a
+// presigned redirect when possible and streamed otherwise.
+func (h *FileHandler) ServeLink(w http.ResponseWriter, r *http.Request, mapping *shortner.URLMapping, rest string) {
+	if rest != "" {
+		respondWithServiceError(w, r, services.ErrLinkNotFound, "")
+		return
+	}
+
+	if !h.stream {
+		file, err := h.files.GetFile(mapping.ShortCode)
+		if err != nil {
+			log.Printf("Handler error loading file %s: %v", mapping.ShortCode, err)
+			respondWithServiceError(w, r, err, "Error loading file")
+			return
+		}
+		downloadURL, err := h.files.DownloadURL(file)
+		if err == nil {
+			recordClick(h.analytics, r, mapping.ShortCode, 0)
+			w.Header().Set("Cache-Control", "no-store")
+			http.Redirect(w, r, downloadURL, http.StatusFound)
+			return
+		}
+		if !errors.Is(err, objectstore.ErrPresignUnsupported) {
+			log.Printf("Handler error presigning download for %s: %v", mapping.ShortCode, err)
+			respondWithServiceError(w, r, err, "Error loading file")
+			return
+		}
+	}
+
+	body, file, err := h.files.Open(mapping.ShortCode)
+	if err != nil {
+		log.Printf("Handler error opening file %s: %v", mapping.ShortCode, err)
+		respondWithServiceError(w, r, err, "Error loading file")
+		return
+	}
+	defer body.Close()
+
+	recordClick(h.analytics, r, mapping.ShortCode, 0)
+	_ = http.NewResponseController(w).SetWriteDeadline(h.transferDeadline(file.Size))
+	disposition := "attachment"
+	if inlineContentType(file.ContentType) {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", file.CreatedAt, seeker)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("Handler error streaming file %s: %v", mapping.ShortCode, err)
+	}
+}
+
+// inlineContentType reports whether browsers may display the file instead
+// of downloading it. Anything that could run script is always an attachment.
+func inlineContentType(contentType string) bool {
+	switch {
+	case contentType == "application/pdf", contentType == "text/plain":
+		return true
+	case strings.HasPrefix(contentType, "image/"):
+		return contentType != "image/svg+xml"
+	default:
+		return false
+	}
+}
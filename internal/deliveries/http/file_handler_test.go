@@ -0,0 +1,76 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"template/internal/services"
+)
+
+// fakeFileService accepts any upload and remembers its size.
+type fakeFileService struct {
+	services.FileService
+	uploaded int64
+}
+
+func (s *fakeFileService) Upload(shortCode, token string, body io.Reader, size int64, contentType string) error {
+	n, err := io.Copy(io.Discard, body)
+	s.uploaded = n
+	return err
+}
+
+// slowReader hands out size bytes a chunk at a time, pausing before each.
+type slowReader struct {
+	remaining int
+	chunk     int
+	pause     time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.pause)
+	n := min(len(p), r.chunk, r.remaining)
+	for i := range p[:n] {
+		p[i] = 'x'
+	}
+	r.remaining -= n
+	return n, nil
+}
+
+func TestSlowUploadOutlastsServerTimeouts(t *testing.T) {
+	const maxBytes = 64 << 10
+	files := &fakeFileService{}
+	h := NewFileHandler(files, nil, testBaseURL, false, maxBytes)
+	// The full size gets 100ms plus 1s; the upload takes about 0.5s, five
+	// times the server's timeouts.
+	h.transferTime = 100 * time.Millisecond
+	h.transferRate = maxBytes
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	server := httptest.NewUnstartedServer(mux)
+	server.Config.ReadTimeout = 100 * time.Millisecond
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	body := &slowReader{remaining: maxBytes, chunk: maxBytes / 8, pause: 60 * time.Millisecond}
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/api/v1/files/abc/content?token=t", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.ContentLength = maxBytes
+	req.Header.Set("Content-Type", "application/pdf")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("upload cut off: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || files.uploaded != maxBytes {
+		t.Errorf("status = %d, uploaded %d bytes, want 200 and %d", resp.StatusCode, files.uploaded, maxBytes)
+	}
+}
@@ -0,0 +1,46 @@
+package http
+
+import (
+	"log"
+	"net/http"
+
+	"template/internal/pkg/geo"
+	"template/internal/usecases/shortner"
+)
+
+// EnableGeoRestrictions makes links with country rules answer visitors
+// they keep out with 451 and a page: blockedPage when set, otherwise the
+// built-in one. Without it, or when locator finds no country, links
+// limited to some countries are unavailable to everyone.
+func (h *ShortenerHandler) EnableGeoRestrictions(locator geo.Locator, blockedPage []byte) {
+	h.geo = locator
+	h.geoBlockedPage = blockedPage
+}
+
+// checkCountry answers the request and returns false when mapping keeps
+// out the visitor's country.
+func (h *ShortenerHandler) checkCountry(w http.ResponseWriter, r *http.Request, mapping *shortner.URLMapping) bool {
+	if len(mapping.AllowedCountries) == 0 && len(mapping.BlockedCountries) == 0 {
+		return true
+	}
+	var country string
+	if h.geo != nil {
+		country = h.geo.Country(r)
+	}
+	if mapping.CountryAllowed(country) {
+		return true
+	}
+
+	log.Printf("Handler: Code %s not available in country %q", mapping.ShortCode, country)
+	w.Header().Set("Cache-Control", "no-store")
+	if h.geoBlockedPage != nil {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusUnavailableForLegalReasons)
+		if _, err := w.Write(h.geoBlockedPage); err != nil {
+			log.Printf("Error writing geo blocked page: %v", err)
+		}
+		return false
+	}
+	renderPage(w, r, http.StatusUnavailableForLegalReasons, "geo_blocked.html", pageLanguage(r, mapping), nil)
+	return false
+}
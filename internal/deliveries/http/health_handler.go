@@ -0,0 +1,67 @@
+package http
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"template/internal/services"
+)
+
+// ReadinessResponse is the body of GET /readyz.
+type ReadinessResponse struct {
+	Ready bool `json:"ready"`
+	services.HealthReport
+}
+
+// HealthHandler serves the probes of orchestrators and load balancers.
+// /healthz only tells that the process answers; /readyz tells whether it
+// should get traffic: not before startup has finished, not once shutdown
+// has begun, and not while a critical component is down.
+type HealthHandler struct {
+	maintenance services.MaintenanceService
+	ready       atomic.Bool
+}
+
+func NewHealthHandler(maintenance services.MaintenanceService) *HealthHandler {
+	return &HealthHandler{maintenance: maintenance}
+}
+
+// SetReady marks the application as started (true) or shutting down
+// (false).
+func (h *HealthHandler) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+func (h *HealthHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", h.handleLiveness)
+	mux.HandleFunc("/readyz", h.handleReadiness)
+
+	logRoutes("Health", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *HealthHandler) Routes() []Route {
+	return []Route{
+		route("/healthz", http.MethodGet, http.MethodHead),
+		route("/readyz", http.MethodGet, http.MethodHead),
+	}
+}
+
+func (h *HealthHandler) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": services.HealthUp})
+}
+
+func (h *HealthHandler) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	report := h.maintenance.Health()
+	resp := ReadinessResponse{
+		Ready:        h.ready.Load() && report.Status != services.HealthDown,
+		HealthReport: report,
+	}
+	status := http.StatusOK
+	if !resp.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, status, resp)
+}
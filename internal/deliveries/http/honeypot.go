@@ -0,0 +1,33 @@
+package http
+
+import (
+	"log"
+	"net/http"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// EnableHoneypots makes requests for honeypot codes be answered like
+// requests for unknown codes, and reported to honeypots instead of being
+// counted as clicks.
+func (h *ShortenerHandler) EnableHoneypots(honeypots services.HoneypotService) {
+	h.honeypots = honeypots
+}
+
+// checkHoneypot answers the request and returns false when code is a
+// honeypot.
+func (h *ShortenerHandler) checkHoneypot(w http.ResponseWriter, r *http.Request, code string) bool {
+	if h.honeypots == nil || !h.honeypots.IsHoneypot(code) {
+		return true
+	}
+	log.Printf("Handler: Honeypot code requested: %s", code)
+	h.honeypots.RecordHit(shortner.HoneypotHit{
+		Code:      code,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		Referer:   r.Referer(),
+	})
+	respondWithServiceError(w, r, services.ErrLinkNotFound, "")
+	return false
+}
@@ -0,0 +1,38 @@
+package http
+
+import (
+	"net/http"
+
+	"template/internal/pkg/i18n"
+	"template/internal/usecases/shortner"
+)
+
+// requestLanguage negotiates the response language from Accept-Language.
+func requestLanguage(r *http.Request) string {
+	if r == nil {
+		return i18n.DefaultLanguage
+	}
+	return i18n.Default().Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// pageLanguage is the language for pages rendered on behalf of a link: the
+// link's own language setting wins over the visitor's browser preference.
+func pageLanguage(r *http.Request, mapping *shortner.URLMapping) string {
+	if mapping != nil && mapping.Language != "" && i18n.Default().Supports(mapping.Language) {
+		return mapping.Language
+	}
+	return requestLanguage(r)
+}
+
+// localizeError replaces the message with the catalog translation of the
+// error code for the negotiated language, when one exists.
+func localizeError(r *http.Request, body ErrorResponse) ErrorResponse {
+	lang := requestLanguage(r)
+	if lang == i18n.DefaultLanguage {
+		return body
+	}
+	if msg, ok := i18n.Default().Lookup(lang, "error."+body.Code); ok {
+		body.Error = msg
+	}
+	return body
+}
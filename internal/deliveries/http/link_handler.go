@@ -0,0 +1,327 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"template/internal/pkg/ratelimit"
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+type SignLinkRequest struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type SignLinkResponse struct {
+	URL string `json:"url"`
+	*shortner.SignedLink
+}
+
+type ScheduleChangeRequest struct {
+	NewURL      string    `json:"new_url"`
+	EffectiveAt time.Time `json:"effective_at"`
+}
+
+// LinkHandler serves per-link resources under /api/v1/links/{code}/:
+// the revision history, scheduled destination changes, stats and clicks,
+// the comparison of the stats of several links and their export.
+type LinkHandler struct {
+	links     services.ShortenerService
+	schedules services.ScheduleService
+	stats     services.StatsService
+
+	signing    services.SigningService
+	ownerToken string
+	baseURL    string
+
+	share        services.ShareService
+	shareLimiter *ratelimit.Limiter
+}
+
+func NewLinkHandler(links services.ShortenerService, schedules services.ScheduleService, stats services.StatsService) *LinkHandler {
+	return &LinkHandler{links: links, schedules: schedules, stats: stats}
+}
+
+// EnableSigning adds POST /api/v1/links/{code}/sign, which issues signed
+// URLs under baseURL to requests authorized with ownerToken.
+func (h *LinkHandler) EnableSigning(signing services.SigningService, ownerToken, baseURL string) {
+	h.signing = signing
+	h.ownerToken = ownerToken
+	h.baseURL = baseURL
+}
+
+func (h *LinkHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/links/", h.handleLinkResource)
+	mux.HandleFunc("/api/v1/stats/compare", h.handleCompare)
+	mux.HandleFunc("/api/v1/stats/export", h.handleCampaignExport)
+
+	logRoutes("Link", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *LinkHandler) Routes() []Route {
+	routes := []Route{
+		route("/api/v1/links/{code}/revisions", http.MethodGet),
+		route("/api/v1/links/{code}/schedule", http.MethodGet, http.MethodPost),
+		route("/api/v1/links/{code}/schedule/{id}", http.MethodDelete),
+		route("/api/v1/links/{code}/stats", http.MethodGet),
+		route("/api/v1/links/{code}/clicks", http.MethodGet),
+		route("/api/v1/links/{code}/export", http.MethodGet),
+		route("/api/v1/stats/compare", http.MethodGet),
+		route("/api/v1/stats/export", http.MethodGet),
+	}
+	if h.signing != nil {
+		routes = append(routes, route("/api/v1/links/{code}/sign", http.MethodPost))
+	}
+	if h.share != nil {
+		routes = append(routes, route("/api/v1/links/{code}/share", http.MethodPost))
+	}
+	return routes
+}
+
+func (h *LinkHandler) handleLinkResource(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/links/"), "/")
+	if len(parts) < 2 || parts[0] == "" {
+		respondWithError(w, r, http.StatusNotFound, "Not Found")
+		return
+	}
+	shortCode := parts[0]
+
+	switch {
+	case parts[1] == "revisions" && len(parts) == 2:
+		h.handleRevisions(w, r, shortCode)
+	case parts[1] == "schedule" && len(parts) == 2:
+		h.handleSchedule(w, r, shortCode)
+	case parts[1] == "schedule" && len(parts) == 3:
+		h.handleScheduledChange(w, r, shortCode, parts[2])
+	case parts[1] == "stats" && len(parts) == 2:
+		h.handleStats(w, r, shortCode)
+	case parts[1] == "clicks" && len(parts) == 2:
+		h.handleClicks(w, r, shortCode)
+	case parts[1] == "export" && len(parts) == 2:
+		h.handleLinkExport(w, r, shortCode)
+	case parts[1] == "sign" && len(parts) == 2 && h.signing != nil:
+		h.handleSign(w, r, shortCode)
+	case parts[1] == "share" && len(parts) == 2 && h.share != nil:
+		h.handleShare(w, r, shortCode)
+	default:
+		respondWithError(w, r, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (h *LinkHandler) handleRevisions(w http.ResponseWriter, r *http.Request, shortCode string) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	revisions, err := h.links.ListRevisions(shortCode)
+	if err != nil {
+		log.Printf("Handler error from service ListRevisions for %s: %v", shortCode, err)
+		respondWithServiceError(w, r, err, "Failed to list revisions")
+		return
+	}
+	if revisions == nil {
+		revisions = []shortner.LinkRevision{}
+	}
+	respondWithJSON(w, http.StatusOK, revisions)
+}
+
+func (h *LinkHandler) handleSchedule(w http.ResponseWriter, r *http.Request, shortCode string) {
+	switch r.Method {
+	case http.MethodGet:
+		changes, err := h.schedules.ListChanges(shortCode)
+		if err != nil {
+			log.Printf("Handler error from service ListChanges for %s: %v", shortCode, err)
+			respondWithServiceError(w, r, err, "Failed to list scheduled changes")
+			return
+		}
+		if changes == nil {
+			changes = []shortner.ScheduledChange{}
+		}
+		respondWithJSON(w, http.StatusOK, changes)
+	case http.MethodPost:
+		var req ScheduleChangeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("Handler error decoding schedule request for %s: %v", shortCode, err)
+			respondWithBodyError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		change, err := h.schedules.ScheduleChange(shortCode, req.NewURL, req.EffectiveAt)
+		if err != nil {
+			log.Printf("Handler error from service ScheduleChange for %s: %v", shortCode, err)
+			respondWithServiceError(w, r, err, "Failed to schedule change")
+			return
+		}
+		respondWithJSON(w, http.StatusCreated, change)
+	default:
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (h *LinkHandler) handleScheduledChange(w http.ResponseWriter, r *http.Request, shortCode, rawID string) {
+	if r.Method != http.MethodDelete {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid scheduled change id in URL path")
+		return
+	}
+
+	if err := h.schedules.CancelChange(shortCode, id); err != nil {
+		log.Printf("Handler error from service CancelChange for %s/%d: %v", shortCode, id, err)
+		respondWithServiceError(w, r, err, "Failed to cancel scheduled change")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *LinkHandler) handleStats(w http.ResponseWriter, r *http.Request, shortCode string) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	preview, err := h.stats.Preview(shortCode, statsAccess(r), time.Now())
+	if err != nil {
+		log.Printf("Handler error from service Preview for %s: %v", shortCode, err)
+		respondWithServiceError(w, r, err, "Failed to load link stats")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, preview)
+}
+
+// Default ranges of /api/v1/stats/compare without ?from=.
+const (
+	defaultCompareDays  = 30
+	defaultCompareHours = 48
+)
+
+// handleCompare answers ?codes=a,b,c with the clicks of each link per
+// ?interval= (day, the default, or hour) between ?from= and ?to=, RFC 3339
+// timestamps or YYYY-MM-DD dates. to defaults to now and from to 30 days
+// (48 hours for hourly counts) before it.
+func (h *LinkHandler) handleCompare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	q := r.URL.Query()
+	var codes []string
+	for _, code := range strings.Split(q.Get("codes"), ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	to, ok := parseStatsTime(w, r, "to", time.Now())
+	if !ok {
+		return
+	}
+	from := to.AddDate(0, 0, -defaultCompareDays)
+	if q.Get("interval") == shortner.IntervalHour {
+		from = to.Add(-defaultCompareHours * time.Hour)
+	}
+	if from, ok = parseStatsTime(w, r, "from", from); !ok {
+		return
+	}
+
+	comparison, err := h.stats.Compare(codes, statsAccess(r), from, to, q.Get("interval"))
+	if err != nil {
+		log.Printf("Handler error from service Compare for %v: %v", codes, err)
+		respondWithServiceError(w, r, err, "Failed to compare link stats")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, comparison)
+}
+
+// parseStatsTime reads the query parameter name as an RFC 3339 timestamp
+// or a date, returning fallback when it is absent. It answers the request
+// and returns false when the value is neither.
+func parseStatsTime(w http.ResponseWriter, r *http.Request, name string, fallback time.Time) (time.Time, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return fallback, true
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return t, true
+	}
+	respondWithError(w, r, http.StatusBadRequest, "Invalid "+name+" parameter (expected an RFC 3339 timestamp or YYYY-MM-DD)")
+	return time.Time{}, false
+}
+
+// handleClicks exports the link's clicks page by page, with the same cursor
+// and limit parameters as /api/v1/triggers/clicks.
+func (h *LinkHandler) handleClicks(w http.ResponseWriter, r *http.Request, shortCode string) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	afterID, limit, err := parseTriggerParams(r, cursorPrefixClicks)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	clicks, err := h.stats.ListClicks(shortCode, statsAccess(r), afterID, limit)
+	if err != nil {
+		log.Printf("Handler error from service ListClicks for %s: %v", shortCode, err)
+		respondWithServiceError(w, r, err, "Failed to list clicks")
+		return
+	}
+
+	lastID := afterID
+	if len(clicks) > 0 {
+		lastID = clicks[len(clicks)-1].ID
+	}
+	if clicks == nil {
+		clicks = []shortner.Click{}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, TriggerResponse{Items: clicks, NextCursor: encodeCursor(cursorPrefixClicks, lastID)})
+}
+
+func (h *LinkHandler) handleSign(w http.ResponseWriter, r *http.Request, shortCode string) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	if !hasBearerToken(r, h.ownerToken) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		respondWithError(w, r, http.StatusUnauthorized, "Invalid admin token")
+		return
+	}
+
+	var req SignLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Handler error decoding sign request for %s: %v", shortCode, err)
+		respondWithBodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	link, err := h.signing.Sign(shortCode, req.ExpiresAt)
+	if err != nil {
+		log.Printf("Handler error from service Sign for %s: %v", shortCode, err)
+		respondWithServiceError(w, r, err, "Failed to sign link")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, SignLinkResponse{
+		URL:        signedURL(buildShortURL(h.baseURL, link.ShortCode), link),
+		SignedLink: link,
+	})
+}
@@ -0,0 +1,117 @@
+package http
+
+import (
+	"log"
+	"net/http"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	defaultLinkListLimit = 50
+	maxLinkListLimit     = 100
+
+	cursorPrefixSearch      = "search:"
+	cursorPrefixDestination = "destination:"
+)
+
+type LinkListResponse struct {
+	Items      []shortner.URLMapping `json:"items"`
+	NextCursor string                `json:"next_cursor"`
+}
+
+// LinksHandler serves GET /api/v1/links, the list of all links, which ?q=
+// turns into a full-text search over destinations and titles and
+// ?long_url= into a lookup of the links to a destination. Like the admin
+// API it requires "Authorization: Bearer <ADMIN_TOKEN>".
+type LinksHandler struct {
+	links services.ShortenerService
+	token string
+}
+
+func NewLinksHandler(links services.ShortenerService, token string) *LinksHandler {
+	return &LinksHandler{links: links, token: token}
+}
+
+func (h *LinksHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/links", requireScope(h.token, shortner.ScopeLinksRead, h.handleList))
+
+	logRoutes("Links", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *LinksHandler) Routes() []Route {
+	return []Route{
+		route("/api/v1/links", http.MethodGet),
+	}
+}
+
+// handleList accepts ?limit= (50 by default, at most 100) and the ?cursor= of
+// the previous page; next_cursor is empty on the last page. Without ?q= links
+// are listed oldest first, with it best match first. ?long_url= lists the
+// links to that destination oldest first, matched as ?match= says: exact
+// (the default), prefix or domain.
+func (h *LinksHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	limit, ok := queryInt(w, r, "limit")
+	if !ok {
+		return
+	}
+	if limit <= 0 {
+		limit = defaultLinkListLimit
+	}
+	limit = min(limit, maxLinkListLimit)
+
+	query := r.URL.Query().Get("q")
+	destination := r.URL.Query().Get("long_url")
+	if query != "" && destination != "" {
+		respondWithError(w, r, http.StatusBadRequest, "Use either q or long_url, not both")
+		return
+	}
+	prefix := cursorPrefixLinks
+	switch {
+	case query != "":
+		prefix = cursorPrefixSearch
+	case destination != "":
+		prefix = cursorPrefixDestination
+	}
+	position, err := decodeCursor(prefix, r.URL.Query().Get("cursor"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid cursor parameter")
+		return
+	}
+
+	var items []shortner.URLMapping
+	var next int64
+	switch {
+	case query != "":
+		items, err = h.links.SearchLinks(r.Context(), query, shortner.SearchPage{Offset: int(position), Limit: limit})
+		next = position + int64(len(items))
+	case destination != "":
+		items, err = h.links.FindLinksByDestination(r.Context(), destination, r.URL.Query().Get("match"), position, limit)
+	default:
+		items, err = h.links.ListLinksSince(position, limit)
+	}
+	if query == "" && len(items) > 0 {
+		next = items[len(items)-1].ID
+	}
+	if err != nil {
+		log.Printf("Handler error listing links: %v", err)
+		respondWithServiceError(w, r, err, "Failed to list links")
+		return
+	}
+
+	resp := LinkListResponse{Items: items}
+	if resp.Items == nil {
+		resp.Items = []shortner.URLMapping{}
+	}
+	if len(items) == limit {
+		resp.NextCursor = encodeCursor(prefix, next)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,87 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// newLinksFixture serves GET /api/v1/links over five links, three of them
+// titled "Docs".
+func newLinksFixture() *shortenerFixture {
+	var links []shortner.URLMapping
+	for i := 1; i <= 5; i++ {
+		link := shortner.URLMapping{ShortCode: fmt.Sprintf("l%d", i), LongURL: fmt.Sprintf("https://example.com/%d", i)}
+		if i%2 == 1 {
+			link.Title = "Docs"
+		}
+		links = append(links, link)
+	}
+	f := newShortenerFixture(links...)
+	NewLinksHandler(f.service, testAdminToken).RegisterRoutes(f.mux)
+	return f
+}
+
+// listAll follows next_cursor from target and returns the codes listed.
+func listAll(t *testing.T, f *shortenerFixture, target string) []string {
+	t.Helper()
+	var codes []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("paging did not end")
+		}
+		rec := f.do(http.MethodGet, target+"&cursor="+cursor, "", "", "Authorization", "Bearer "+testAdminToken)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+		}
+		var resp LinkListResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range resp.Items {
+			codes = append(codes, item.ShortCode)
+		}
+		if resp.NextCursor == "" {
+			return codes
+		}
+		cursor = resp.NextCursor
+	}
+}
+
+func TestListLinks(t *testing.T) {
+	f := newLinksFixture()
+	if codes := listAll(t, f, "/api/v1/links?limit=2"); fmt.Sprint(codes) != "[l1 l2 l3 l4 l5]" {
+		t.Errorf("listed %v, want every link oldest first", codes)
+	}
+	if codes := listAll(t, f, "/api/v1/links?limit=2&q=Docs"); fmt.Sprint(codes) != "[l1 l3 l5]" {
+		t.Errorf("searched %v, want the three links titled Docs", codes)
+	}
+	if codes := listAll(t, f, "/api/v1/links?limit=2&long_url=https://example.com/&match=prefix"); fmt.Sprint(codes) != "[l1 l2 l3 l4 l5]" {
+		t.Errorf("looked up %v by prefix, want every link", codes)
+	}
+	if codes := listAll(t, f, "/api/v1/links?long_url=https://example.com/3"); fmt.Sprint(codes) != "[l3]" {
+		t.Errorf("looked up %v, want l3", codes)
+	}
+	if !f.service.called("ListLinksSince") || !f.service.called("SearchLinks") || !f.service.called("FindLinksByDestination") {
+		t.Error("the list, the search and the lookup did not reach their service methods")
+	}
+}
+
+func TestListLinksErrors(t *testing.T) {
+	f := newLinksFixture()
+	auth := []string{"Authorization", "Bearer " + testAdminToken}
+	expectError(t, f.do(http.MethodGet, "/api/v1/links", "", ""), http.StatusUnauthorized, codeUnauthorized)
+	expectError(t, f.do(http.MethodGet, "/api/v1/links?cursor=nope", "", "", auth...), http.StatusBadRequest, codeInvalidRequest)
+	// A list cursor does not continue a search.
+	listCursor := encodeCursor(cursorPrefixLinks, 2)
+	expectError(t, f.do(http.MethodGet, "/api/v1/links?q=Docs&cursor="+listCursor, "", "", auth...), http.StatusBadRequest, codeInvalidRequest)
+	expectError(t, f.do(http.MethodGet, "/api/v1/links?q=Docs&long_url=https://example.com/1", "", "", auth...), http.StatusBadRequest, codeInvalidRequest)
+
+	f.service.errs["SearchLinks"] = services.ErrSearchUnavailable
+	expectError(t, f.do(http.MethodGet, "/api/v1/links?q=Docs", "", "", auth...), http.StatusNotImplemented, string(services.CodeSearchUnavailable))
+}
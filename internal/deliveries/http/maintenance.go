@@ -0,0 +1,50 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"template/internal/services"
+)
+
+const maintenancePath = "/api/v1/admin/maintenance"
+
+// MaintenanceGuard refuses requests that change state (anything but GET,
+// HEAD and OPTIONS) with 503 and Retry-After while maintenance mode is on.
+// Redirects and other reads go on, and so does the route that turns the
+// mode off.
+type MaintenanceGuard struct {
+	maintenance services.MaintenanceModeService
+}
+
+func NewMaintenanceGuard(maintenance services.MaintenanceModeService) *MaintenanceGuard {
+	return &MaintenanceGuard{maintenance: maintenance}
+}
+
+func (g *MaintenanceGuard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == maintenancePath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		m := g.maintenance.Maintenance()
+		if !m.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if m.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(m.RetryAfter))
+		}
+		message := m.Message
+		if message == "" {
+			message = "The service is in maintenance, changes are unavailable"
+		}
+		writeError(w, r, http.StatusServiceUnavailable, ErrorResponse{Error: message, Code: codeMaintenance})
+	})
+}
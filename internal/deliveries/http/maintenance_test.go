@@ -0,0 +1,42 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// stubMaintenance serves a fixed maintenance state; only Maintenance is
+// used.
+type stubMaintenance struct {
+	services.MaintenanceModeService
+	maintenance shortner.Maintenance
+}
+
+func (m *stubMaintenance) Maintenance() shortner.Maintenance { return m.maintenance }
+
+func TestMaintenanceGuard(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "abc", LongURL: "https://example.com/a"})
+	maintenance := &stubMaintenance{maintenance: shortner.Maintenance{Enabled: true, RetryAfter: 120}}
+	guarded := &shortenerFixture{mux: http.NewServeMux()}
+	guarded.mux.Handle("/", NewMaintenanceGuard(maintenance).Middleware(f.mux))
+
+	rec := guarded.do(http.MethodPost, "/shorten", "application/json", `{"url":"https://example.com/b"}`)
+	expectError(t, rec, http.StatusServiceUnavailable, codeMaintenance)
+	if got := rec.Header().Get("Retry-After"); got != "120" {
+		t.Errorf("Retry-After = %q, want 120", got)
+	}
+
+	rec = guarded.do(http.MethodGet, "/abc", "", "")
+	if rec.Code != http.StatusFound {
+		t.Errorf("redirect during maintenance: status = %d, want 302", rec.Code)
+	}
+
+	maintenance.maintenance.Enabled = false
+	rec = guarded.do(http.MethodPost, "/shorten", "application/json", `{"url":"https://example.com/b"}`)
+	if rec.Code != http.StatusCreated && rec.Code != http.StatusOK {
+		t.Errorf("shorten after maintenance: status = %d, body %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"template/internal/pkg/metrics"
+	"template/internal/pkg/utils"
+)
+
+const (
+	routeRedirect = "/{code}"
+	routeWildcard = "/{code}/{rest...}"
+	routeOther    = "other"
+
+	redirectOutcomeRedirected = "redirected"
+	redirectOutcomeNotFound   = "not_found"
+	redirectOutcomeError      = "error"
+)
+
+// HTTPMetrics records the request-level SLIs: request counts and latency per
+// route and the redirect outcome ratio used for the availability SLO. Routes
+// are labeled by their pattern in routes.
+type HTTPMetrics struct {
+	routes    *RouteTable
+	requests  *metrics.CounterVec
+	duration  *metrics.HistogramVec
+	redirects *metrics.CounterVec
+}
+
+func NewHTTPMetrics(reg *metrics.Registry, routes *RouteTable) *HTTPMetrics {
+	return &HTTPMetrics{
+		routes: routes,
+		requests: reg.NewCounterVec("shortener_http_requests_total",
+			"HTTP requests handled, by route, method and status code.", "route", "method", "code"),
+		duration: reg.NewHistogramVec("shortener_http_request_duration_seconds",
+			"HTTP request latency in seconds, by route.", metrics.DefaultLatencyBuckets, "route"),
+		redirects: reg.NewCounterVec("shortener_redirects_total",
+			"Redirect lookups by outcome (redirected, not_found, error).", "outcome"),
+	}
+}
+
+func (m *HTTPMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		elapsed := time.Since(start).Seconds()
+
+		route := m.routes.Label(r.URL.Path)
+		m.requests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		m.duration.WithLabelValues(route).ObserveWithExemplar(elapsed, map[string]string{"request_id": requestID(r)})
+
+		if route == routeRedirect && r.Method == http.MethodGet {
+			m.redirects.WithLabelValues(redirectOutcome(rec.status)).Inc()
+		}
+	})
+}
+
+func redirectOutcome(status int) string {
+	switch {
+	case status >= 300 && status < 400:
+		return redirectOutcomeRedirected
+	case status == http.StatusNotFound:
+		return redirectOutcomeNotFound
+	default:
+		return redirectOutcomeError
+	}
+}
+
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); id != "" {
+		return id
+	}
+	id, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	bytes       int64
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
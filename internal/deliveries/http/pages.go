@@ -0,0 +1,41 @@
+package http
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+
+	"template/internal/pkg/i18n"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+// pageTemplates are the HTML pages rendered by the service. Templates call
+// {{t "key"}} to look up the page language's catalog entry.
+var pageTemplates = template.Must(template.New("pages").Funcs(template.FuncMap{
+	"t": func(lang, key string, args ...interface{}) string {
+		return i18n.Default().T(lang, key, args...)
+	},
+}).ParseFS(templateFS, "templates/*.html"))
+
+// renderPage renders the named template, with the branding of r, into a
+// buffer first so that a template error produces a clean 500 instead of a
+// half-written page.
+func renderPage(w http.ResponseWriter, r *http.Request, status int, name, lang string, data interface{}) {
+	var buf bytes.Buffer
+	page := map[string]interface{}{"Lang": lang, "Data": data, "Brand": newPageBrand(pageBranding(r))}
+	if err := pageTemplates.ExecuteTemplate(&buf, name, page); err != nil {
+		log.Printf("Error rendering page %s: %v", name, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Language", lang)
+	w.WriteHeader(status)
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Printf("Error writing page %s: %v", name, err)
+	}
+}
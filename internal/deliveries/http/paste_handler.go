@@ -0,0 +1,181 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"template/internal/pkg/markdown"
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// pasteCSP forbids scripts and every external resource on rendered pastes;
+// only the page's own inline stylesheet is allowed.
+const pasteCSP = "default-src 'none'; style-src 'unsafe-inline'; base-uri 'none'; form-action 'none'"
+
+type CreatePasteRequest struct {
+	Content string `json:"content"`
+	Format  string `json:"format"`
+	// ExpiresIn is the lifetime in seconds; zero uses the server default.
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+type CreatePasteResponse struct {
+	ShortCode string    `json:"short_code"`
+	ShortURL  string    `json:"short_url"`
+	RawURL    string    `json:"raw_url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PasteHandler creates paste links and serves them: /{code} renders the
+// content as HTML and /{code}/raw returns it verbatim as plain text.
+type PasteHandler struct {
+	pastes    services.PasteService
+	links     services.ShortenerService
+	analytics services.AnalyticsService
+	baseURL   string
+	maxBytes  int
+}
+
+func NewPasteHandler(pastes services.PasteService, links services.ShortenerService, analytics services.AnalyticsService, baseURL string, maxBytes int) *PasteHandler {
+	return &PasteHandler{
+		pastes:    pastes,
+		links:     links,
+		analytics: analytics,
+		baseURL:   baseURL,
+		maxBytes:  maxBytes,
+	}
+}
+
+func (h *PasteHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/pastes", h.handleCreatePaste)
+
+	logRoutes("Paste", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *PasteHandler) Routes() []Route {
+	return []Route{
+		route("/api/v1/pastes", http.MethodPost),
+	}
+}
+
+// handleCreatePaste accepts either a JSON CreatePasteRequest or the raw
+// content as the request body, with format and expires_in as query
+// parameters, so that `curl --data-binary @notes.md` works.
+func (h *PasteHandler) handleCreatePaste(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	// JSON escaping can more than double the size of the content, so the
+	// body limit leaves room for it; the service enforces the real limit.
+	r.Body = http.MaxBytesReader(w, r.Body, int64(2*h.maxBytes+4096))
+	defer r.Body.Close()
+
+	var req CreatePasteRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.respondWithBodyError(w, r, err)
+			return
+		}
+	} else {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.respondWithBodyError(w, r, err)
+			return
+		}
+		req.Content = string(body)
+		req.Format = r.URL.Query().Get("format")
+		if raw := r.URL.Query().Get("expires_in"); raw != "" {
+			seconds, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				respondWithError(w, r, http.StatusBadRequest, "Invalid 'expires_in', expected a number of seconds")
+				return
+			}
+			req.ExpiresIn = seconds
+		}
+	}
+
+	code, err := h.pastes.CreatePaste(req.Content, req.Format, time.Duration(req.ExpiresIn)*time.Second)
+	if err != nil {
+		log.Printf("Handler error from service CreatePaste: %v", err)
+		respondWithServiceError(w, r, err, "Failed to create paste")
+		return
+	}
+
+	resp := CreatePasteResponse{
+		ShortCode: code,
+		ShortURL:  buildShortURL(h.baseURL, code),
+		RawURL:    buildShortURL(h.baseURL, code+"/raw"),
+	}
+	if mapping, err := h.links.GetLink(code); err == nil && mapping.ExpiresAt != nil {
+		resp.ExpiresAt = *mapping.ExpiresAt
+	}
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+func (h *PasteHandler) respondWithBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithError(w, r, http.StatusRequestEntityTooLarge, "Paste is too large")
+		return
+	}
+	log.Printf("Handler error reading paste request: %v", err)
+	respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+}
+
+// ServeLink implements LinkRenderer.
+func (h *PasteHandler) ServeLink(w http.ResponseWriter, r *http.Request, mapping *shortner.URLMapping, rest string) {
+	if rest != "" && rest != "raw" {
+		respondWithServiceError(w, r, services.ErrLinkNotFound, "")
+		return
+	}
+
+	paste, err := h.pastes.GetPaste(mapping.ShortCode)
+	if err != nil {
+		log.Printf("Handler error loading paste %s: %v", mapping.ShortCode, err)
+		respondWithServiceError(w, r, err, "Error loading paste")
+		return
+	}
+
+	recordClick(h.analytics, r, mapping.ShortCode, 0)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if rest == "raw" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+		w.WriteHeader(http.StatusOK)
+		if _, err := io.WriteString(w, paste.Content); err != nil {
+			log.Printf("Handler error writing raw paste %s: %v", mapping.ShortCode, err)
+		}
+		return
+	}
+
+	data := map[string]interface{}{
+		"Code":     mapping.ShortCode,
+		"Title":    mapping.Title,
+		"RawURL":   buildShortURL(h.baseURL, mapping.ShortCode+"/raw") + signatureQuery(r),
+		"Markdown": paste.Format == shortner.PasteFormatMarkdown,
+		"Text":     paste.Content,
+	}
+	if paste.Format == shortner.PasteFormatMarkdown {
+		// markdown.Render escapes all input, so its output is safe to embed.
+		data["HTML"] = template.HTML(markdown.Render(paste.Content))
+	}
+	if mapping.ExpiresAt != nil {
+		data["ExpiresAt"] = mapping.ExpiresAt.UTC().Format("2006-01-02 15:04 MST")
+	}
+
+	w.Header().Set("Content-Security-Policy", allowLogo(pasteCSP, pageBranding(r)))
+	renderPage(w, r, http.StatusOK, "paste.html", pageLanguage(r, mapping), data)
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"template/internal/services"
+)
+
+type CreatePixelRequest struct {
+	Provider string `json:"provider"`
+	TagID    string `json:"tag_id"`
+	Name     string `json:"name"`
+}
+
+// PixelHandler manages the retargeting pixels that links can reference
+// through their pixel_ids setting.
+type PixelHandler struct {
+	pixels services.PixelService
+}
+
+func NewPixelHandler(pixels services.PixelService) *PixelHandler {
+	return &PixelHandler{pixels: pixels}
+}
+
+func (h *PixelHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/pixels", h.handlePixels)
+	mux.HandleFunc("/api/v1/pixels/", h.handlePixelByID)
+
+	logRoutes("Pixel", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *PixelHandler) Routes() []Route {
+	return []Route{
+		route("/api/v1/pixels", http.MethodGet, http.MethodPost),
+		route("/api/v1/pixels/{id}", http.MethodDelete),
+	}
+}
+
+func (h *PixelHandler) handlePixels(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		pixels, err := h.pixels.ListPixels()
+		if err != nil {
+			log.Printf("Handler error from service ListPixels: %v", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Failed to list pixels")
+			return
+		}
+		var items interface{} = pixels
+		if pixels == nil {
+			items = []struct{}{}
+		}
+		respondWithJSON(w, http.StatusOK, items)
+	case http.MethodPost:
+		var req CreatePixelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("Handler error decoding pixel request: %v", err)
+			respondWithBodyError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		pixel, err := h.pixels.CreatePixel(req.Provider, req.TagID, req.Name)
+		if err != nil {
+			log.Printf("Handler error from service CreatePixel: %v", err)
+			respondWithServiceError(w, r, err, "Failed to create pixel")
+			return
+		}
+		respondWithJSON(w, http.StatusCreated, pixel)
+	default:
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (h *PixelHandler) handlePixelByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/v1/pixels/"), 10, 64)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid pixel id in URL path")
+		return
+	}
+
+	if err := h.pixels.DeletePixel(id); err != nil {
+		log.Printf("Handler error from service DeletePixel for pixel %d: %v", id, err)
+		respondWithServiceError(w, r, err, "Failed to delete pixel")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// EnablePreviews makes /{code}+ show the link's preview page instead of
+// redirecting.
+func (h *ShortenerHandler) EnablePreviews(stats services.StatsService) {
+	h.stats = stats
+}
+
+// servePreview answers /{code}+ with the link's destination and click
+// counts, as JSON when the client asks for it and as an HTML page
+// otherwise. Links whose stats the request may not see answer 403.
+func (h *ShortenerHandler) servePreview(w http.ResponseWriter, r *http.Request, shortCode string) {
+	preview, err := h.stats.Preview(shortCode, statsAccess(r), h.clock.Now())
+	if err != nil {
+		log.Printf("Handler error from service Preview for code %s: %v", shortCode, err)
+		respondWithServiceError(w, r, err, "Failed to load link preview")
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Cache-Control", "no-store")
+	if prefersJSON(r) {
+		respondWithJSON(w, http.StatusOK, preview)
+		return
+	}
+	renderPage(w, r, http.StatusOK, "preview.html", requestLanguage(r), map[string]interface{}{
+		"Preview":  preview,
+		"ShortURL": h.buildShortURL(preview.ShortCode),
+	})
+}
+
+// statsAccess collects the credentials r presents for a link's stats: the
+// owner's bearer token or an API key with the stats:read scope, and a stats
+// token passed as ?token= or in the X-Stats-Token header.
+func statsAccess(r *http.Request) services.StatsAccess {
+	bearer, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = r.Header.Get("X-Stats-Token")
+	}
+	key := requestAPIKey(r)
+	return services.StatsAccess{BearerToken: bearer, StatsToken: token, AllLinks: key != nil && key.HasScope(shortner.ScopeStatsRead)}
+}
+
+// prefersJSON reports whether the Accept header asks for JSON rather than
+// HTML.
+func prefersJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"template/internal/pkg/clientip"
+	"template/internal/pkg/metrics"
+	"template/internal/pkg/ratelimit"
+)
+
+// ProbeGuard makes scanning the code space impractical: every short link
+// lookup that answers 404 counts against the client IP, and clients that
+// keep missing wait longer and longer for each lookup and are then refused
+// with 429 for a while. Lookups of existing links do not count.
+type ProbeGuard struct {
+	guard   *ratelimit.ProbeGuard
+	routes  *RouteTable
+	actions *metrics.CounterVec
+	sleep   func(r *http.Request, d time.Duration)
+}
+
+// NewProbeGuard guards the lookups routes labels as the redirect route.
+func NewProbeGuard(guard *ratelimit.ProbeGuard, reg *metrics.Registry, routes *RouteTable) *ProbeGuard {
+	return &ProbeGuard{
+		guard:  guard,
+		routes: routes,
+		actions: reg.NewCounterVec("shortener_code_probe_actions_total",
+			"Short link lookups held back from clients probing for codes, by action (delayed, rejected, blocked).", "action"),
+		sleep: sleepRequest,
+	}
+}
+
+func (p *ProbeGuard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || p.routes.Label(r.URL.Path) != routeRedirect {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := clientip.FromRequest(r)
+		delay, blocked := p.guard.Check(key, time.Now())
+		if blocked > 0 {
+			p.actions.WithLabelValues("rejected").Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(blocked.Seconds()))))
+			respondWithError(w, r, http.StatusTooManyRequests, "Too many requests for unknown links, try again later")
+			return
+		}
+		if delay > 0 {
+			p.actions.WithLabelValues("delayed").Inc()
+			p.sleep(r, delay)
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.status == http.StatusNotFound && p.guard.Fail(key, time.Now()) {
+			p.actions.WithLabelValues("blocked").Inc()
+		}
+	})
+}
+
+// sleepRequest waits d, or less if the client goes away.
+func sleepRequest(r *http.Request, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+}
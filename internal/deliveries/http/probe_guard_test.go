@@ -0,0 +1,68 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"template/internal/pkg/metrics"
+	"template/internal/pkg/ratelimit"
+	"template/internal/usecases/shortner"
+)
+
+func TestProbeGuard(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "known", LongURL: "https://example.com/a"})
+	guard := ratelimit.NewProbeGuard(ratelimit.ProbeOptions{
+		Window:     time.Hour,
+		Threshold:  2,
+		BaseDelay:  time.Second,
+		MaxDelay:   3 * time.Second,
+		BlockAfter: 5,
+		BlockFor:   time.Minute,
+	})
+	routes := NewRouteTable()
+	routes.Add(f.handler.Routes()...)
+	routes.Add(route("/api/v1/links/{code}/stats", http.MethodGet))
+	probes := NewProbeGuard(guard, metrics.NewRegistry(nil), routes)
+	var slept []time.Duration
+	probes.sleep = func(r *http.Request, d time.Duration) { slept = append(slept, d) }
+	handler := probes.Middleware(f.mux)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	for i := 0; i < 4; i++ {
+		if rec := get("/missing"); rec.Code != http.StatusNotFound {
+			t.Fatalf("probe %d: status = %d, want 404", i, rec.Code)
+		}
+	}
+	if rec := get("/known"); rec.Code != http.StatusFound {
+		t.Errorf("a known link while delayed: status = %d, want 302", rec.Code)
+	}
+	if got, want := slept, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("delays = %v, want %v", got, want)
+	}
+
+	get("/missing")
+	rec := get("/known")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("blocked client: status = %d, Retry-After %q, want 429 and 60", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := get("/api/v1/links/known"); rec.Code == http.StatusTooManyRequests {
+		t.Errorf("a blocked client was refused the API")
+	}
+
+	offenders := guard.Offenders(time.Now())
+	if len(offenders) != 1 || offenders[0].Key != "192.0.2.1" || offenders[0].BlockedUntil == nil {
+		t.Fatalf("offenders = %+v, want 192.0.2.1 blocked", offenders)
+	}
+	if !guard.Unblock("192.0.2.1") {
+		t.Fatal("Unblock found nothing to lift")
+	}
+	if rec := get("/known"); rec.Code != http.StatusFound {
+		t.Errorf("after Unblock: status = %d, want 302", rec.Code)
+	}
+}
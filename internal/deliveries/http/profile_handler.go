@@ -0,0 +1,276 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+type SaveProfileRequest struct {
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+}
+
+type ProfileItemRequest struct {
+	ShortCode string `json:"short_code"`
+	Title     string `json:"title"`
+	Position  int    `json:"position"`
+}
+
+type ProfileResponse struct {
+	shortner.Profile
+	URL   string                 `json:"url"`
+	Items []shortner.ProfileItem `json:"items"`
+}
+
+// ProfileHandler manages link-in-bio profiles under /api/v1/profiles, which
+// like the admin API requires "Authorization: Bearer <ADMIN_TOKEN>", and
+// serves their public pages at /@{username} through the ShortenerHandler
+// (see EnableProfiles). Each link on a page goes through
+// /@{username}/i/{itemID} so that clicks are counted per item.
+type ProfileHandler struct {
+	profiles services.ProfileService
+	baseURL  string
+	token    string
+}
+
+func NewProfileHandler(profiles services.ProfileService, baseURL, token string) *ProfileHandler {
+	return &ProfileHandler{profiles: profiles, baseURL: baseURL, token: token}
+}
+
+func (h *ProfileHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/profiles", requireLinkScope(h.token, h.handleList))
+	mux.HandleFunc("/api/v1/profiles/", requireLinkScope(h.token, h.handleProfile))
+
+	logRoutes("Profile", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *ProfileHandler) Routes() []Route {
+	return []Route{
+		route("/api/v1/profiles", http.MethodGet),
+		route("/api/v1/profiles/{username}", http.MethodGet, http.MethodPut, http.MethodDelete),
+		route("/api/v1/profiles/{username}/items", http.MethodGet, http.MethodPost),
+		route("/api/v1/profiles/{username}/items/{id}", http.MethodPut, http.MethodDelete),
+	}
+}
+
+func (h *ProfileHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	profiles, err := h.profiles.ListProfiles()
+	if err != nil {
+		respondWithServiceError(w, r, err, "Failed to list profiles")
+		return
+	}
+	if profiles == nil {
+		profiles = []shortner.Profile{}
+	}
+	respondWithJSON(w, http.StatusOK, profiles)
+}
+
+// handleProfile serves /api/v1/profiles/{username}[/items[/{id}]].
+func (h *ProfileHandler) handleProfile(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/profiles/"), "/")
+	if parts[0] == "" || len(parts) > 3 || (len(parts) > 1 && parts[1] != "items") {
+		respondWithError(w, r, http.StatusNotFound, "Not Found")
+		return
+	}
+	username := parts[0]
+
+	switch len(parts) {
+	case 1:
+		switch r.Method {
+		case http.MethodGet:
+			h.getProfile(w, r, username)
+		case http.MethodPut:
+			h.saveProfile(w, r, username)
+		case http.MethodDelete:
+			if err := h.profiles.DeleteProfile(username); err != nil {
+				log.Printf("Handler error from service DeleteProfile for %s: %v", username, err)
+				respondWithServiceError(w, r, err, "Failed to delete profile")
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		}
+		return
+	case 2:
+		switch r.Method {
+		case http.MethodGet:
+			h.listItems(w, r, username)
+		case http.MethodPost:
+			h.addItem(w, r, username)
+		default:
+			respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		}
+		return
+	}
+
+	itemID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid item id in URL path")
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		h.updateItem(w, r, username, itemID)
+	case http.MethodDelete:
+		if err := h.profiles.DeleteItem(username, itemID); err != nil {
+			log.Printf("Handler error from service DeleteItem for %s/%d: %v", username, itemID, err)
+			respondWithServiceError(w, r, err, "Failed to delete profile item")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (h *ProfileHandler) getProfile(w http.ResponseWriter, r *http.Request, username string) {
+	profile, err := h.profiles.GetProfile(username)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Failed to load profile")
+		return
+	}
+	h.respondWithProfile(w, r, http.StatusOK, profile)
+}
+
+func (h *ProfileHandler) saveProfile(w http.ResponseWriter, r *http.Request, username string) {
+	var req SaveProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Handler error decoding profile request: %v", err)
+		respondWithBodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	profile, err := h.profiles.SaveProfile(shortner.Profile{Username: username, DisplayName: req.DisplayName, Bio: req.Bio})
+	if err != nil {
+		log.Printf("Handler error from service SaveProfile for %s: %v", username, err)
+		respondWithServiceError(w, r, err, "Failed to save profile")
+		return
+	}
+	h.respondWithProfile(w, r, http.StatusOK, profile)
+}
+
+func (h *ProfileHandler) respondWithProfile(w http.ResponseWriter, r *http.Request, status int, profile *shortner.Profile) {
+	items, err := h.profiles.ListItems(profile.Username)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Failed to list profile items")
+		return
+	}
+	if items == nil {
+		items = []shortner.ProfileItem{}
+	}
+	respondWithJSON(w, status, ProfileResponse{Profile: *profile, URL: buildShortURL(h.baseURL, "@"+profile.Username), Items: items})
+}
+
+func (h *ProfileHandler) listItems(w http.ResponseWriter, r *http.Request, username string) {
+	items, err := h.profiles.ListItems(username)
+	if err != nil {
+		log.Printf("Handler error from service ListItems for profile %s: %v", username, err)
+		respondWithServiceError(w, r, err, "Failed to list profile items")
+		return
+	}
+	if items == nil {
+		items = []shortner.ProfileItem{}
+	}
+	respondWithJSON(w, http.StatusOK, items)
+}
+
+func (h *ProfileHandler) addItem(w http.ResponseWriter, r *http.Request, username string) {
+	var req ProfileItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithBodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	item, err := h.profiles.AddItem(username, shortner.ProfileItem{ShortCode: req.ShortCode, Title: req.Title, Position: req.Position})
+	if err != nil {
+		log.Printf("Handler error from service AddItem for profile %s: %v", username, err)
+		respondWithServiceError(w, r, err, "Failed to add profile item")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, item)
+}
+
+func (h *ProfileHandler) updateItem(w http.ResponseWriter, r *http.Request, username string, itemID int64) {
+	var req ProfileItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithBodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	item := shortner.ProfileItem{ID: itemID, ShortCode: req.ShortCode, Title: req.Title, Position: req.Position}
+	if err := h.profiles.UpdateItem(username, item); err != nil {
+		log.Printf("Handler error from service UpdateItem for profile %s/%d: %v", username, itemID, err)
+		respondWithServiceError(w, r, err, "Failed to update profile item")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Profile item updated successfully"})
+}
+
+// EnableProfiles serves the profile pages of profiles at /@{username}.
+func (h *ShortenerHandler) EnableProfiles(profiles *ProfileHandler) {
+	h.profiles = profiles
+}
+
+// ServeProfile answers /@{username} with the profile page and
+// /@{username}/i/{id} by counting a click on the item and redirecting to
+// its short link, which records the click on the link as usual.
+func (h *ProfileHandler) ServeProfile(w http.ResponseWriter, r *http.Request, username, rest string) {
+	if rest != "" {
+		idPart, ok := strings.CutPrefix(rest, "i/")
+		itemID, err := strconv.ParseInt(idPart, 10, 64)
+		if !ok || err != nil {
+			respondWithServiceError(w, r, services.ErrLinkNotFound, "")
+			return
+		}
+		code, err := h.profiles.FollowItem(username, itemID)
+		if err != nil {
+			respondWithServiceError(w, r, err, "Error looking up profile item")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, nextHop(r, h.baseURL, buildShortURL(h.baseURL, code)), http.StatusFound)
+		return
+	}
+
+	profile, items, err := h.profiles.Page(username)
+	if err != nil {
+		log.Printf("Handler error loading profile page %s: %v", username, err)
+		respondWithServiceError(w, r, err, "Error loading profile")
+		return
+	}
+
+	links := make([]bundleLink, 0, len(items))
+	for _, item := range items {
+		links = append(links, bundleLink{
+			Title: item.Title,
+			Href:  buildShortURL(h.baseURL, "@"+profile.Username+"/i/"+strconv.FormatInt(item.ID, 10)),
+		})
+	}
+	name := profile.DisplayName
+	if name == "" {
+		name = "@" + profile.Username
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	renderPage(w, r, http.StatusOK, "profile.html", requestLanguage(r), map[string]interface{}{
+		"Name":     name,
+		"Username": profile.Username,
+		"Bio":      profile.Bio,
+		"Items":    links,
+	})
+}
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// stubProfiles serves the profile "ann" with two items and remembers the
+// followed items; only the methods the tests call are implemented.
+type stubProfiles struct {
+	services.ProfileService
+	followed []int64
+	saved    []shortner.Profile
+}
+
+var stubProfileItems = []shortner.ProfileItem{
+	{ID: 7, Username: "ann", ShortCode: "shop", Title: "My <shop>"},
+	{ID: 3, Username: "ann", ShortCode: "blog", Title: "Blog", Clicks: 2},
+}
+
+func (s *stubProfiles) GetProfile(username string) (*shortner.Profile, error) {
+	if strings.ToLower(username) != "ann" {
+		return nil, &services.Error{Code: services.CodeProfileNotFound, Message: "profile not found"}
+	}
+	return &shortner.Profile{Username: "ann", DisplayName: "Ann", Bio: "I make things"}, nil
+}
+
+func (s *stubProfiles) SaveProfile(profile shortner.Profile) (*shortner.Profile, error) {
+	s.saved = append(s.saved, profile)
+	return &profile, nil
+}
+
+func (s *stubProfiles) ListItems(username string) ([]shortner.ProfileItem, error) {
+	if _, err := s.GetProfile(username); err != nil {
+		return nil, err
+	}
+	return stubProfileItems, nil
+}
+
+func (s *stubProfiles) Page(username string) (*shortner.Profile, []shortner.ProfileItem, error) {
+	profile, err := s.GetProfile(username)
+	if err != nil {
+		return nil, nil, err
+	}
+	return profile, stubProfileItems, nil
+}
+
+func (s *stubProfiles) FollowItem(username string, itemID int64) (string, error) {
+	for _, item := range stubProfileItems {
+		if item.ID == itemID && username == item.Username {
+			s.followed = append(s.followed, itemID)
+			return item.ShortCode, nil
+		}
+	}
+	return "", &services.Error{Code: services.CodeProfileItemNotFound, Message: "profile item not found"}
+}
+
+func newProfileFixture() (*shortenerFixture, *stubProfiles) {
+	f := newShortenerFixture()
+	profiles := &stubProfiles{}
+	h := NewProfileHandler(profiles, testBaseURL, testAdminToken)
+	h.RegisterRoutes(f.mux)
+	f.handler.EnableProfiles(h)
+	return f, profiles
+}
+
+func TestProfilePage(t *testing.T) {
+	f, profiles := newProfileFixture()
+
+	rec := f.do(http.MethodGet, "/@ann", "", "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("status = %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"<h1>Ann</h1>", "I make things", `href="https://sho.rt/@ann/i/7"`, "My &lt;shop&gt;", `href="https://sho.rt/@ann/i/3"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page lacks %q:\n%s", want, body)
+		}
+	}
+	if strings.Index(body, "/i/7") > strings.Index(body, "/i/3") {
+		t.Error("items are not in the order of the service")
+	}
+
+	rec = f.do(http.MethodGet, "/@ann/i/3", "", "")
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "https://sho.rt/blog?hop=1" {
+		t.Errorf("following an item: status = %d, Location %q, want 302 to the short link", rec.Code, rec.Header().Get("Location"))
+	}
+	if len(profiles.followed) != 1 || profiles.followed[0] != 3 {
+		t.Errorf("followed = %v, want [3]", profiles.followed)
+	}
+	// The short link records the click itself, after the redirect.
+	if len(f.analytics.recorded()) != 0 {
+		t.Error("the profile recorded a click on the link")
+	}
+
+	expectError(t, f.do(http.MethodGet, "/@bob", "", ""), http.StatusNotFound, string(services.CodeProfileNotFound))
+	expectError(t, f.do(http.MethodGet, "/@ann/i/99", "", ""), http.StatusNotFound, string(services.CodeProfileItemNotFound))
+	expectError(t, f.do(http.MethodGet, "/@ann/x", "", ""), http.StatusNotFound, string(services.CodeLinkNotFound))
+}
+
+func TestProfileAPI(t *testing.T) {
+	f, profiles := newProfileFixture()
+	auth := []string{"Authorization", "Bearer " + testAdminToken}
+
+	expectError(t, f.do(http.MethodGet, "/api/v1/profiles/ann", "", ""), http.StatusUnauthorized, "UNAUTHORIZED")
+
+	rec := f.do(http.MethodPut, "/api/v1/profiles/ann", "application/json", `{"display_name":"Ann","bio":"Hi"}`, auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d, body %s", rec.Code, rec.Body)
+	}
+	if want := (shortner.Profile{Username: "ann", DisplayName: "Ann", Bio: "Hi"}); len(profiles.saved) != 1 || profiles.saved[0] != want {
+		t.Errorf("saved = %+v, want %+v", profiles.saved, want)
+	}
+	for _, want := range []string{`"url":"https://sho.rt/@ann"`, `"short_code":"shop"`, `"clicks":2`} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("response lacks %s: %s", want, rec.Body)
+		}
+	}
+
+	expectError(t, f.do(http.MethodGet, "/api/v1/profiles/bob/items", "", "", auth...), http.StatusNotFound, string(services.CodeProfileNotFound))
+	expectError(t, f.do(http.MethodPut, "/api/v1/profiles/ann/items/x", "application/json", "{}", auth...), http.StatusBadRequest, "INVALID_REQUEST")
+	expectError(t, f.do(http.MethodGet, "/api/v1/profiles/ann/links", "", "", auth...), http.StatusNotFound, "NOT_FOUND")
+}
@@ -0,0 +1,396 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+const provisioningPrefix = "/api/v1/admin/provisioning/"
+
+// PutAPIKeyRequest is the body of PUT /api/v1/admin/provisioning/api-keys/{id}.
+// Without Scopes, an existing key keeps its scopes and a new one gets the
+// admin scope. Without ExpiresAt, the key does not expire.
+type PutAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	CreatedBy string     `json:"created_by"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// RotateAPIKeyRequest is the optional body of POST
+// /api/v1/admin/provisioning/api-keys/{id}/rotate. GraceSeconds is how long
+// the replaced secret keeps working, a day when left out; ExpiresAt, when
+// set, replaces the expiry of the key.
+type RotateAPIKeyRequest struct {
+	GraceSeconds *int       `json:"grace_seconds"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+}
+
+// PutDomainRequest is the body of PUT /api/v1/admin/provisioning/domains/{id}.
+type PutDomainRequest struct {
+	Domain string `json:"domain"`
+}
+
+// ProvisioningListResponse is the body of the provisioning list endpoints;
+// Items are ordered by ID.
+type ProvisioningListResponse struct {
+	Items interface{} `json:"items"`
+}
+
+// provisionedKind is one kind of resource of the provisioning API, as
+// served under provisioningPrefix + path. put decodes the request body with
+// decode. stable, when set, returns a resource or list without the fields
+// that change by themselves, which the ETags leave out so that they do not
+// look like drift. actions are served by POST under the path of a resource,
+// keyed by their last path segment.
+type provisionedKind struct {
+	path    string
+	list    func() (interface{}, error)
+	get     func(id string) (interface{}, error)
+	put     func(id string, decode func(v interface{}) error) (resource interface{}, created bool, err error)
+	remove  func(id string) error
+	stable  func(v interface{}) interface{}
+	actions map[string]func(id string, decode func(v interface{}) error) (interface{}, error)
+}
+
+// etag is the ETag of the resource or list v.
+func (k provisionedKind) etag(v interface{}) (string, error) {
+	if k.stable != nil {
+		v = k.stable(v)
+	}
+	return etagOf(v)
+}
+
+// bodyError marks a request body put could not decode.
+type bodyError struct {
+	err error
+}
+
+func (e *bodyError) Error() string { return e.err.Error() }
+func (e *bodyError) Unwrap() error { return e.err }
+
+// ProvisioningHandler serves the API infrastructure-as-code tools manage
+// API keys, domains and redirect blocks through. Resources live under IDs
+// the client chooses: PUT creates or updates one and is idempotent, GET
+// reads it and the lists, ordered by ID, and DELETE removes it. Every
+// response carries an ETag; GET answers If-None-Match with 304, and PUT
+// and DELETE refuse a stale If-Match with 412, so drift can be detected
+// without diffing bodies. Only ADMIN_TOKEN is accepted, not API keys.
+type ProvisioningHandler struct {
+	kinds []provisionedKind
+	token string
+}
+
+func NewProvisioningHandler(keys services.APIKeyService, claims services.DomainClaimService, blocks services.RedirectPolicyService, token string) *ProvisioningHandler {
+	h := &ProvisioningHandler{token: token}
+	h.kinds = []provisionedKind{
+		{
+			path: "api-keys",
+			list: func() (interface{}, error) { return emptyIfNil(keys.ListAPIKeys()) },
+			get:  func(id string) (interface{}, error) { return keys.GetAPIKey(id) },
+			put: func(id string, decode func(v interface{}) error) (interface{}, bool, error) {
+				var req PutAPIKeyRequest
+				if err := decode(&req); err != nil {
+					return nil, false, err
+				}
+				return keys.PutAPIKey(id, shortner.APIKey{Name: req.Name, Scopes: req.Scopes, CreatedBy: req.CreatedBy, ExpiresAt: req.ExpiresAt})
+			},
+			remove: func(id string) error { return keys.DeleteAPIKey(id) },
+			stable: withoutKeyUsage,
+			actions: map[string]func(string, func(v interface{}) error) (interface{}, error){
+				"rotate": func(id string, decode func(v interface{}) error) (interface{}, error) {
+					var req RotateAPIKeyRequest
+					if err := decode(&req); err != nil && !errors.Is(err, io.EOF) {
+						return nil, err
+					}
+					grace := services.DefaultAPIKeyGracePeriod
+					if req.GraceSeconds != nil {
+						grace = time.Duration(*req.GraceSeconds) * time.Second
+					}
+					return keys.RotateAPIKey(id, grace, req.ExpiresAt)
+				},
+			},
+		},
+		{
+			path: "domains",
+			list: func() (interface{}, error) { return emptyIfNil(claims.ListProvisionedClaims()) },
+			get:  func(id string) (interface{}, error) { return claims.GetProvisionedClaim(id) },
+			put: func(id string, decode func(v interface{}) error) (interface{}, bool, error) {
+				var req PutDomainRequest
+				if err := decode(&req); err != nil {
+					return nil, false, err
+				}
+				return claims.PutProvisionedClaim(id, req.Domain)
+			},
+			remove: func(id string) error { return claims.RemoveProvisionedClaim(id) },
+		},
+		{
+			path: "blocks",
+			list: func() (interface{}, error) { return emptyIfNil(blocks.ListNamedBlocks()) },
+			get:  func(id string) (interface{}, error) { return blocks.GetNamedBlock(id) },
+			put: func(id string, decode func(v interface{}) error) (interface{}, bool, error) {
+				var req AddBlockRequest
+				if err := decode(&req); err != nil {
+					return nil, false, err
+				}
+				return blocks.PutNamedBlock(shortner.RedirectBlock{Name: id, Kind: req.Kind, Value: req.Value, Reason: req.Reason})
+			},
+			remove: func(id string) error { return blocks.RemoveNamedBlock(id) },
+		},
+	}
+	return h
+}
+
+// withoutKeyUsage leaves the last use out of API keys.
+func withoutKeyUsage(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *shortner.APIKey:
+		key := *v
+		key.LastUsedAt = nil
+		return &key
+	case []shortner.APIKey:
+		keys := make([]shortner.APIKey, len(v))
+		for i, key := range v {
+			key.LastUsedAt = nil
+			keys[i] = key
+		}
+		return keys
+	}
+	return v
+}
+
+// emptyIfNil makes an empty list render as [] rather than null.
+func emptyIfNil[T any](items []T, err error) (interface{}, error) {
+	if items == nil {
+		items = []T{}
+	}
+	return items, err
+}
+
+func (h *ProvisioningHandler) RegisterRoutes(mux *http.ServeMux) {
+	for _, kind := range h.kinds {
+		kind := kind
+		mux.HandleFunc(provisioningPrefix+kind.path, requireAdminTokenOnly(h.token, func(w http.ResponseWriter, r *http.Request) {
+			h.handleList(w, r, kind)
+		}))
+		mux.HandleFunc(provisioningPrefix+kind.path+"/", requireAdminTokenOnly(h.token, func(w http.ResponseWriter, r *http.Request) {
+			h.handleItem(w, r, kind)
+		}))
+	}
+
+	logRoutes("Provisioning", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *ProvisioningHandler) Routes() []Route {
+	var routes []Route
+	for _, kind := range h.kinds {
+		routes = append(routes,
+			route(provisioningPrefix+kind.path, http.MethodGet),
+			route(provisioningPrefix+kind.path+"/{id}", http.MethodGet, http.MethodPut, http.MethodDelete))
+		for _, action := range slices.Sorted(maps.Keys(kind.actions)) {
+			routes = append(routes, route(provisioningPrefix+kind.path+"/{id}/"+action, http.MethodPost))
+		}
+	}
+	return routes
+}
+
+func (h *ProvisioningHandler) handleList(w http.ResponseWriter, r *http.Request, kind provisionedKind) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	items, err := kind.list()
+	if err != nil {
+		log.Printf("Handler error listing provisioned %s: %v", kind.path, err)
+		respondWithServiceError(w, r, err, "Failed to list "+kind.path)
+		return
+	}
+	tag, err := kind.etag(items)
+	respondWithETag(w, r, http.StatusOK, ProvisioningListResponse{Items: items}, tag, err)
+}
+
+func (h *ProvisioningHandler) handleItem(w http.ResponseWriter, r *http.Request, kind provisionedKind) {
+	id := strings.TrimPrefix(r.URL.Path, provisioningPrefix+kind.path+"/")
+	if id, name, ok := strings.Cut(id, "/"); ok && id != "" && kind.actions[name] != nil {
+		h.handleAction(w, r, kind, id, name)
+		return
+	}
+	if id == "" || strings.Contains(id, "/") {
+		respondWithError(w, r, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		resource, err := kind.get(id)
+		if err != nil {
+			respondWithServiceError(w, r, err, "Failed to get "+kind.path)
+			return
+		}
+		tag, err := kind.etag(resource)
+		respondWithETag(w, r, http.StatusOK, resource, tag, err)
+	case http.MethodPut:
+		if !h.checkIfMatch(w, r, kind, id) {
+			return
+		}
+		defer r.Body.Close()
+		resource, created, err := kind.put(id, func(v interface{}) error {
+			if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+				return &bodyError{err: err}
+			}
+			return nil
+		})
+		var bodyErr *bodyError
+		if errors.As(err, &bodyErr) {
+			log.Printf("Handler error decoding provisioned %s '%s': %v", kind.path, id, err)
+			respondWithBodyError(w, r, bodyErr.err)
+			return
+		}
+		if err != nil {
+			log.Printf("Handler error putting provisioned %s '%s': %v", kind.path, id, err)
+			respondWithServiceError(w, r, err, "Failed to put "+kind.path)
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		// The ETag is that of the resource as GET shows it, without the
+		// secrets only a creation returns.
+		if current, err := kind.get(id); err == nil {
+			if tag, err := kind.etag(current); err == nil {
+				w.Header().Set("ETag", tag)
+			}
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		respondWithJSON(w, status, resource)
+	case http.MethodDelete:
+		if !h.checkIfMatch(w, r, kind, id) {
+			return
+		}
+		if err := kind.remove(id); err != nil {
+			log.Printf("Handler error deleting provisioned %s '%s': %v", kind.path, id, err)
+			respondWithServiceError(w, r, err, "Failed to delete "+kind.path)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// handleAction runs the action name on the resource id. Its response, like
+// that of a creation, may carry secrets and is not cached.
+func (h *ProvisioningHandler) handleAction(w http.ResponseWriter, r *http.Request, kind provisionedKind, id, name string) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	if !h.checkIfMatch(w, r, kind, id) {
+		return
+	}
+	defer r.Body.Close()
+	resource, err := kind.actions[name](id, func(v interface{}) error {
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			return &bodyError{err: err}
+		}
+		return nil
+	})
+	var bodyErr *bodyError
+	if errors.As(err, &bodyErr) {
+		log.Printf("Handler error decoding %s of provisioned %s '%s': %v", name, kind.path, id, err)
+		respondWithBodyError(w, r, bodyErr.err)
+		return
+	}
+	if err != nil {
+		log.Printf("Handler error on %s of provisioned %s '%s': %v", name, kind.path, id, err)
+		respondWithServiceError(w, r, err, "Failed to "+name+" "+kind.path)
+		return
+	}
+	if current, err := kind.get(id); err == nil {
+		if tag, err := kind.etag(current); err == nil {
+			w.Header().Set("ETag", tag)
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, resource)
+}
+
+// checkIfMatch answers 412 when r has an If-Match header the current
+// resource does not match. "*" matches any existing resource.
+func (h *ProvisioningHandler) checkIfMatch(w http.ResponseWriter, r *http.Request, kind provisionedKind, id string) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return true
+	}
+	current, err := kind.get(id)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		respondWithServiceError(w, r, err, "Failed to get "+kind.path)
+		return false
+	}
+	if err == nil {
+		tag, err := kind.etag(current)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Failed to compute ETag")
+			return false
+		}
+		if etagMatches(ifMatch, tag) {
+			return true
+		}
+	}
+	respondWithError(w, r, http.StatusPreconditionFailed, "The resource does not match If-Match")
+	return false
+}
+
+// respondWithETag writes payload with its ETag tag, or 304 when r already
+// holds that version in If-None-Match. err is that of computing tag.
+func respondWithETag(w http.ResponseWriter, r *http.Request, status int, payload interface{}, tag string, err error) {
+	if err != nil {
+		log.Printf("Error computing ETag: %v", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to compute ETag")
+		return
+	}
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	respondWithJSON(w, status, payload)
+}
+
+// etagOf is a strong ETag of the JSON form of payload.
+func etagOf(payload interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// etagMatches reports whether the If-Match or If-None-Match header value
+// header lists tag, or is "*".
+func etagMatches(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,312 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// fakeAPIKeyRepo keeps API keys in memory.
+type fakeAPIKeyRepo struct {
+	keys map[string]shortner.APIKey
+}
+
+func (r *fakeAPIKeyRepo) InitSchema() error { return nil }
+
+func (r *fakeAPIKeyRepo) ListAPIKeys() ([]shortner.APIKey, error) {
+	var keys []shortner.APIKey
+	for _, k := range r.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (r *fakeAPIKeyRepo) GetAPIKey(id string) (*shortner.APIKey, error) {
+	k, ok := r.keys[id]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	return &k, nil
+}
+
+func (r *fakeAPIKeyRepo) GetAPIKeyByHash(hash string) (*shortner.APIKey, error) {
+	for _, k := range r.keys {
+		if k.KeyHash == hash || k.PreviousKeyHash == hash {
+			return &k, nil
+		}
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (r *fakeAPIKeyRepo) PutAPIKey(key shortner.APIKey) (*shortner.APIKey, bool, error) {
+	stored, ok := r.keys[key.ID]
+	if !ok {
+		r.keys[key.ID] = key
+		return &key, true, nil
+	}
+	if stored.Name != key.Name || strings.Join(stored.Scopes, " ") != strings.Join(key.Scopes, " ") || !reflect.DeepEqual(stored.ExpiresAt, key.ExpiresAt) {
+		stored.Name, stored.Scopes, stored.ExpiresAt, stored.UpdatedAt = key.Name, key.Scopes, key.ExpiresAt, key.UpdatedAt
+		r.keys[key.ID] = stored
+	}
+	return &stored, false, nil
+}
+
+func (r *fakeAPIKeyRepo) RotateAPIKey(id, hash string, previousExpiresAt, now time.Time) (*shortner.APIKey, error) {
+	k, ok := r.keys[id]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	k.PreviousKeyHash, k.PreviousKeyExpiresAt, k.KeyHash, k.UpdatedAt = k.KeyHash, &previousExpiresAt, hash, now
+	r.keys[id] = k
+	return &k, nil
+}
+
+func (r *fakeAPIKeyRepo) TouchAPIKey(id string, usedAt time.Time) error {
+	k, ok := r.keys[id]
+	if !ok {
+		return repositories.ErrNotFound
+	}
+	k.LastUsedAt = &usedAt
+	r.keys[id] = k
+	return nil
+}
+
+func (r *fakeAPIKeyRepo) DeleteAPIKey(id string) error {
+	if _, ok := r.keys[id]; !ok {
+		return repositories.ErrNotFound
+	}
+	delete(r.keys, id)
+	return nil
+}
+
+// provisioningFixture serves the provisioning routes and, at /admin, a
+// route guarded by requireAdminToken and at /links one guarded by
+// requireLinkScope, behind the API key middleware.
+type provisioningFixture struct {
+	handler http.Handler
+	keys    services.APIKeyService
+}
+
+func newProvisioningFixture() *provisioningFixture {
+	keys := services.NewAPIKeyService(&fakeAPIKeyRepo{keys: map[string]shortner.APIKey{}})
+	mux := http.NewServeMux()
+	NewProvisioningHandler(keys, nil, nil, testAdminToken).RegisterRoutes(mux)
+	mux.HandleFunc("/admin", requireAdminToken(testAdminToken, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("/links", requireLinkScope(testAdminToken, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return &provisioningFixture{handler: NewAPIKeyAuth(keys).Middleware(mux), keys: keys}
+}
+
+func (f *provisioningFixture) do(method, target, contentType, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	f.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestProvisioningPutIsIdempotent(t *testing.T) {
+	f := newProvisioningFixture()
+	auth := []string{"Authorization", "Bearer " + testAdminToken}
+
+	rec := f.do(http.MethodPut, "/api/v1/admin/provisioning/api-keys/ci", "application/json", `{"name":"CI"}`, auth...)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("first PUT status = %d, body %s", rec.Code, rec.Body)
+	}
+	var created shortner.APIKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Key == "" {
+		t.Fatal("created key has no secret")
+	}
+	tag := rec.Header().Get("ETag")
+
+	rec = f.do(http.MethodPut, "/api/v1/admin/provisioning/api-keys/ci", "application/json", `{"name":"CI"}`, auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("second PUT status = %d, body %s", rec.Code, rec.Body)
+	}
+	var again shortner.APIKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &again); err != nil {
+		t.Fatal(err)
+	}
+	if again.Key != "" {
+		t.Error("second PUT showed the secret again")
+	}
+	if got := rec.Header().Get("ETag"); got != tag {
+		t.Errorf("ETag changed from %s to %s without a change", tag, got)
+	}
+
+	rec = f.do(http.MethodGet, "/api/v1/admin/provisioning/api-keys/ci", "", "", auth...)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != tag {
+		t.Errorf("GET status = %d, ETag %s, want 200 and %s", rec.Code, rec.Header().Get("ETag"), tag)
+	}
+	rec = f.do(http.MethodGet, "/api/v1/admin/provisioning/api-keys/ci", "", "", append(auth, "If-None-Match", tag)...)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("conditional GET status = %d, want 304", rec.Code)
+	}
+
+	// The key is accepted by the other admin routes, not by provisioning.
+	keyAuth := []string{"Authorization", "Bearer " + created.Key}
+	if rec = f.do(http.MethodGet, "/admin", "", "", keyAuth...); rec.Code != http.StatusNoContent {
+		t.Errorf("admin route with the key: status = %d, want 204", rec.Code)
+	}
+	rec = f.do(http.MethodGet, "/api/v1/admin/provisioning/api-keys", "", "", keyAuth...)
+	expectError(t, rec, http.StatusUnauthorized, codeUnauthorized)
+}
+
+func TestProvisioningIfMatch(t *testing.T) {
+	f := newProvisioningFixture()
+	auth := []string{"Authorization", "Bearer " + testAdminToken}
+
+	rec := f.do(http.MethodPut, "/api/v1/admin/provisioning/api-keys/ci", "application/json", `{"name":"CI"}`, auth...)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("PUT status = %d, body %s", rec.Code, rec.Body)
+	}
+	tag := rec.Header().Get("ETag")
+
+	rec = f.do(http.MethodPut, "/api/v1/admin/provisioning/api-keys/ci", "application/json", `{"name":"Deploys"}`, append(auth, "If-Match", tag)...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rename status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	// tag is stale now.
+	rec = f.do(http.MethodDelete, "/api/v1/admin/provisioning/api-keys/ci", "", "", append(auth, "If-Match", tag)...)
+	expectError(t, rec, http.StatusPreconditionFailed, codePreconditionFailed)
+
+	rec = f.do(http.MethodDelete, "/api/v1/admin/provisioning/api-keys/ci", "", "", auth...)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE status = %d, body %s", rec.Code, rec.Body)
+	}
+	rec = f.do(http.MethodGet, "/api/v1/admin/provisioning/api-keys/ci", "", "", auth...)
+	expectError(t, rec, http.StatusNotFound, string(services.CodeAPIKeyNotFound))
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	f := newProvisioningFixture()
+	auth := []string{"Authorization", "Bearer " + testAdminToken}
+
+	rec := f.do(http.MethodPut, "/api/v1/admin/provisioning/api-keys/reader", "application/json", `{"name":"Dashboards","scopes":["stats:read","links:read","links:read"],"created_by":"ops"}`, auth...)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("PUT status = %d, body %s", rec.Code, rec.Body)
+	}
+	var created shortner.APIKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(created.Scopes, " "); got != "links:read stats:read" {
+		t.Errorf("scopes = %q, want them ordered without repeats", got)
+	}
+	if created.CreatedBy != "ops" || created.LastUsedAt != nil {
+		t.Errorf("created_by = %q, last_used_at = %v, want ops and none", created.CreatedBy, created.LastUsedAt)
+	}
+	tag := rec.Header().Get("ETag")
+
+	keyAuth := []string{"Authorization", "Bearer " + created.Key}
+	if rec = f.do(http.MethodGet, "/links", "", "", keyAuth...); rec.Code != http.StatusNoContent {
+		t.Errorf("GET with links:read: status = %d, want 204", rec.Code)
+	}
+	rec = f.do(http.MethodPost, "/links", "", "", keyAuth...)
+	expectError(t, rec, http.StatusForbidden, codeForbidden)
+	rec = f.do(http.MethodGet, "/admin", "", "", keyAuth...)
+	expectError(t, rec, http.StatusForbidden, codeForbidden)
+
+	// The use is recorded but is not drift.
+	rec = f.do(http.MethodGet, "/api/v1/admin/provisioning/api-keys/reader", "", "", auth...)
+	var used shortner.APIKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &used); err != nil {
+		t.Fatal(err)
+	}
+	if used.LastUsedAt == nil {
+		t.Error("last_used_at was not recorded")
+	}
+	if got := rec.Header().Get("ETag"); got != tag {
+		t.Errorf("ETag changed from %s to %s by a use of the key", tag, got)
+	}
+
+	// Putting scopes replaces them; leaving them out keeps them.
+	rec = f.do(http.MethodPut, "/api/v1/admin/provisioning/api-keys/reader", "application/json", `{"name":"Dashboards","scopes":["links:write"]}`, auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("scope change status = %d, body %s", rec.Code, rec.Body)
+	}
+	rec = f.do(http.MethodPut, "/api/v1/admin/provisioning/api-keys/reader", "application/json", `{"name":"Dashboards"}`, auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rename status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec = f.do(http.MethodPost, "/links", "", "", keyAuth...); rec.Code != http.StatusNoContent {
+		t.Errorf("POST with links:write: status = %d, want 204", rec.Code)
+	}
+
+	rec = f.do(http.MethodPut, "/api/v1/admin/provisioning/api-keys/reader", "application/json", `{"scopes":["links:delete"]}`, auth...)
+	expectError(t, rec, http.StatusBadRequest, string(services.CodeValidationFailed))
+}
+
+func TestAPIKeyRotationAndExpiry(t *testing.T) {
+	f := newProvisioningFixture()
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	f.keys.(services.Deterministic).SetClock(clock)
+	auth := []string{"Authorization", "Bearer " + testAdminToken}
+
+	rec := f.do(http.MethodPut, "/api/v1/admin/provisioning/api-keys/ci", "application/json", `{"name":"CI","expires_at":"2030-03-01T00:00:00Z"}`, auth...)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("PUT status = %d, body %s", rec.Code, rec.Body)
+	}
+	var first shortner.APIKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &first); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = f.do(http.MethodPost, "/api/v1/admin/provisioning/api-keys/ci/rotate", "application/json", `{"grace_seconds":3600}`, auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rotate status = %d, body %s", rec.Code, rec.Body)
+	}
+	var second shortner.APIKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &second); err != nil {
+		t.Fatal(err)
+	}
+	if second.Key == "" || second.Key == first.Key {
+		t.Fatal("rotation did not return a new secret")
+	}
+	if second.PreviousKeyExpiresAt == nil || !second.PreviousKeyExpiresAt.Equal(clock.now.Add(time.Hour)) {
+		t.Errorf("previous_key_expires_at = %v, want an hour from now", second.PreviousKeyExpiresAt)
+	}
+
+	// Both secrets work during the grace period, then only the new one.
+	for _, secret := range []string{first.Key, second.Key} {
+		if rec = f.do(http.MethodGet, "/admin", "", "", "Authorization", "Bearer "+secret); rec.Code != http.StatusNoContent {
+			t.Errorf("during the grace period: status = %d, want 204", rec.Code)
+		}
+	}
+	clock.now = clock.now.Add(time.Hour)
+	rec = f.do(http.MethodGet, "/admin", "", "", "Authorization", "Bearer "+first.Key)
+	expectError(t, rec, http.StatusUnauthorized, codeUnauthorized)
+	if rec = f.do(http.MethodGet, "/admin", "", "", "Authorization", "Bearer "+second.Key); rec.Code != http.StatusNoContent {
+		t.Errorf("new secret after the grace period: status = %d, want 204", rec.Code)
+	}
+
+	// The key itself expires.
+	clock.now = time.Date(2030, 3, 1, 0, 0, 0, 0, time.UTC)
+	rec = f.do(http.MethodGet, "/admin", "", "", "Authorization", "Bearer "+second.Key)
+	expectError(t, rec, http.StatusUnauthorized, codeUnauthorized)
+
+	rec = f.do(http.MethodPost, "/api/v1/admin/provisioning/api-keys/gone/rotate", "", "", auth...)
+	expectError(t, rec, http.StatusNotFound, string(services.CodeAPIKeyNotFound))
+}
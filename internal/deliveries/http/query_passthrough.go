@@ -0,0 +1,62 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"template/internal/pkg/linksign"
+	"template/internal/usecases/shortner"
+)
+
+// ownParams are the query parameters the service reads itself; they are
+// never passed on to destinations.
+var ownParams = []string{hopParam, linksign.ParamExpires, linksign.ParamSignature, linksign.ParamKeyID}
+
+// passQuery returns destination with the query parameters of r added as
+// the link's passthrough mode, or the operator default, says. The
+// destination's own query is kept as written, except for the parameters
+// QueryOverride replaces.
+func (h *ShortenerHandler) passQuery(r *http.Request, mapping *shortner.URLMapping, destination string) string {
+	mode := mapping.QueryPassthrough
+	if mode == "" {
+		mode = h.redirect.QueryPassthrough
+	}
+	if (mode != shortner.QueryMerge && mode != shortner.QueryOverride) || r.URL.RawQuery == "" {
+		return destination
+	}
+	incoming := r.URL.Query()
+	for _, name := range ownParams {
+		delete(incoming, name)
+	}
+	if len(incoming) == 0 {
+		return destination
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+
+	var kept []string
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if _, clash := incoming[name]; clash {
+			if mode == shortner.QueryOverride {
+				continue
+			}
+			delete(incoming, name)
+		}
+		kept = append(kept, pair)
+	}
+	if len(incoming) > 0 {
+		kept = append(kept, incoming.Encode())
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	return u.String()
+}
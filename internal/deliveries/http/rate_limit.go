@@ -0,0 +1,39 @@
+package http
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"template/internal/pkg/clientip"
+	"template/internal/pkg/ratelimit"
+)
+
+// RateLimit throttles requests that change state (anything but GET, HEAD
+// and OPTIONS) per client IP. Redirects and other reads are never limited.
+type RateLimit struct {
+	limiter *ratelimit.Limiter
+}
+
+func NewRateLimit(limiter *ratelimit.Limiter) *RateLimit {
+	return &RateLimit{limiter: limiter}
+}
+
+func (l *RateLimit) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ok, wait := l.limiter.Allow(clientip.FromRequest(r), time.Now())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			respondWithError(w, r, http.StatusTooManyRequests, "Too many requests, try again later")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
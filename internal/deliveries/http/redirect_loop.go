@@ -0,0 +1,49 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Redirects from this service back to itself carry the number of such
+// redirects in a row in hopParam, so that loops the link checks cannot
+// see, such as through bundles or links changed since, end with an error
+// instead of redirecting forever.
+const (
+	hopParam        = "hop"
+	maxRedirectHops = 10
+)
+
+// checkHops answers 508 and returns false once r has come through too
+// many of our own redirects.
+func checkHops(w http.ResponseWriter, r *http.Request) bool {
+	hops, _ := strconv.Atoi(r.URL.Query().Get(hopParam))
+	if hops < maxRedirectHops {
+		return true
+	}
+	log.Printf("Handler: Redirect loop detected at %s after %d hops", r.URL.Path, hops)
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithError(w, r, http.StatusLoopDetected, "Redirect loop detected")
+	return false
+}
+
+// nextHop returns destination with the hop count of r plus one when it
+// leads back to baseURL, and unchanged otherwise.
+func nextHop(r *http.Request, baseURL, destination string) string {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return destination
+	}
+	u, err := url.Parse(destination)
+	if err != nil || !strings.EqualFold(u.Host, base.Host) {
+		return destination
+	}
+	hops, _ := strconv.Atoi(r.URL.Query().Get(hopParam))
+	query := u.Query()
+	query.Set(hopParam, strconv.Itoa(hops+1))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
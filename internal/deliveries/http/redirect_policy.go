@@ -0,0 +1,31 @@
+package http
+
+import (
+	"log"
+	"net/http"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// EnableRedirectPolicy makes every link be checked against the redirect
+// blocks before it is served.
+func (h *ShortenerHandler) EnableRedirectPolicy(policy services.RedirectPolicyService) {
+	h.policy = policy
+}
+
+// checkRedirectPolicy answers the request and returns false when mapping
+// is blocked. The answer is not cacheable, so lifting
+// a block takes effect for visitors at once.
+func (h *ShortenerHandler) checkRedirectPolicy(w http.ResponseWriter, r *http.Request, mapping *shortner.URLMapping) bool {
+	if h.policy == nil {
+		return true
+	}
+	if err := h.policy.Check(mapping); err != nil {
+		log.Printf("Handler: Short code blocked: %s", mapping.ShortCode)
+		w.Header().Set("Cache-Control", "no-store")
+		respondWithServiceError(w, r, err, "Failed to check link")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+type SubscribeReportRequest struct {
+	Email      string   `json:"email"`
+	Frequency  string   `json:"frequency"`
+	ShortCodes []string `json:"short_codes"`
+}
+
+// ReportHandler manages subscriptions to the periodic email reports.
+type ReportHandler struct {
+	reports services.ReportService
+}
+
+func NewReportHandler(reports services.ReportService) *ReportHandler {
+	return &ReportHandler{reports: reports}
+}
+
+func (h *ReportHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/reports/subscriptions", h.handleSubscriptions)
+	mux.HandleFunc("/api/v1/reports/subscriptions/", h.handleSubscriptionByID)
+	mux.HandleFunc("/api/v1/reports/unsubscribe", h.handleUnsubscribe)
+
+	logRoutes("Report", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *ReportHandler) Routes() []Route {
+	return []Route{
+		route("/api/v1/reports/subscriptions", http.MethodGet, http.MethodPost),
+		route("/api/v1/reports/subscriptions/{id}", http.MethodDelete),
+		route("/api/v1/reports/unsubscribe", http.MethodGet, http.MethodPost),
+	}
+}
+
+func (h *ReportHandler) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		subs, err := h.reports.ListSubscriptions(r.URL.Query().Get("email"))
+		if err != nil {
+			log.Printf("Handler error from service ListSubscriptions: %v", err)
+			respondWithServiceError(w, r, err, "Failed to list report subscriptions")
+			return
+		}
+		if subs == nil {
+			subs = []shortner.ReportSubscription{}
+		}
+		respondWithJSON(w, http.StatusOK, subs)
+	case http.MethodPost:
+		var req SubscribeReportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("Handler error decoding report subscription: %v", err)
+			respondWithBodyError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		sub, err := h.reports.Subscribe(req.Email, req.Frequency, req.ShortCodes)
+		if err != nil {
+			log.Printf("Handler error from service Subscribe: %v", err)
+			respondWithServiceError(w, r, err, "Failed to subscribe to reports")
+			return
+		}
+		respondWithJSON(w, http.StatusCreated, sub)
+	default:
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (h *ReportHandler) handleSubscriptionByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/v1/reports/subscriptions/"), 10, 64)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid subscription id in URL path")
+		return
+	}
+
+	if err := h.reports.Unsubscribe(id); err != nil {
+		log.Printf("Handler error from service Unsubscribe for report subscription %d: %v", id, err)
+		respondWithServiceError(w, r, err, "Failed to delete report subscription")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleUnsubscribe is the link included in every report email. It accepts
+// POST as well so that mail clients can use one-click unsubscribe.
+func (h *ReportHandler) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	if err := h.reports.UnsubscribeByToken(r.URL.Query().Get("token")); err != nil {
+		log.Printf("Handler error from service UnsubscribeByToken: %v", err)
+		respondWithServiceError(w, r, err, "Failed to unsubscribe")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "You have been unsubscribed from link reports"})
+}
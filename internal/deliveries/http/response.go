@@ -0,0 +1,79 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Envelope wraps the JSON bodies of the responses it serves in a
+// ResponseEnvelope, so that successes and errors share one top-level shape.
+// application/problem+json errors and non-JSON bodies are left as they are.
+type Envelope struct{}
+
+func NewEnvelope() *Envelope {
+	return &Envelope{}
+}
+
+func (e *Envelope) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&envelopeWriter{ResponseWriter: w}, r)
+	})
+}
+
+// envelopeWriter marks a response as enveloped for respondWithJSON.
+type envelopeWriter struct {
+	http.ResponseWriter
+}
+
+func (w *envelopeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// enveloped reports whether w is, or wraps, an envelopeWriter.
+func enveloped(w http.ResponseWriter) bool {
+	for {
+		switch v := w.(type) {
+		case *envelopeWriter:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+// envelop puts payload in the data or the error member of an envelope.
+func envelop(payload interface{}) ResponseEnvelope {
+	switch body := payload.(type) {
+	case ErrorResponse:
+		return ResponseEnvelope{Error: &body}
+	case *ErrorResponse:
+		return ResponseEnvelope{Error: body}
+	}
+	return ResponseEnvelope{Data: payload}
+}
+
+// respondWithJSON is the single place JSON response bodies are serialized.
+func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	fallback := `{"error":"Internal server error marshalling response","code":"INTERNAL_ERROR"}`
+	if enveloped(w) {
+		payload = envelop(payload)
+		fallback = `{"data":null,"error":` + fallback + `}`
+	}
+	response, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshalling JSON response: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(fallback))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, err = w.Write(response)
+	if err != nil {
+		log.Printf("Error writing JSON response: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// retargetCSPFormat allows only the providers' tag scripts and the page's
+// own nonce-tagged inline script.
+const retargetCSPFormat = "default-src 'none'; script-src 'nonce-%s' https://connect.facebook.net https://www.googletagmanager.com; " +
+	"img-src https:; connect-src https:; frame-src https://www.googletagmanager.com; style-src 'unsafe-inline'; base-uri 'none'"
+
+// EnableRetargeting makes links with pixel_ids answer with an interstitial
+// page that loads the pixels and then redirects, waiting at most budget.
+func (h *ShortenerHandler) EnableRetargeting(pixels services.PixelService, budget time.Duration) {
+	h.pixels = pixels
+	h.interstitialBudget = budget
+}
+
+// serveInterstitial renders the retargeting page for a redirect to
+// destination. Without pixels to fire it falls back to a plain redirect.
+func (h *ShortenerHandler) serveInterstitial(w http.ResponseWriter, r *http.Request, mapping *shortner.URLMapping, destination string) bool {
+	pixels, err := h.pixels.ResolvePixels(mapping.PixelIDs)
+	if err != nil {
+		log.Printf("Handler: Failed to load pixels for code %s, redirecting directly: %v", mapping.ShortCode, err)
+		return false
+	}
+	if len(pixels) == 0 {
+		return false
+	}
+
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		log.Printf("Handler: Failed to generate CSP nonce for code %s, redirecting directly: %v", mapping.ShortCode, err)
+		return false
+	}
+	nonce := base64.StdEncoding.EncodeToString(nonceBytes)
+
+	var facebook, google []string
+	for _, p := range pixels {
+		switch p.Provider {
+		case shortner.PixelProviderFacebook:
+			facebook = append(facebook, p.TagID)
+		case shortner.PixelProviderGoogle:
+			google = append(google, p.TagID)
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer-when-downgrade")
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf(retargetCSPFormat, nonce))
+	renderPage(w, r, http.StatusOK, "retarget.html", pageLanguage(r, mapping), map[string]interface{}{
+		"Destination": destination,
+		"Nonce":       nonce,
+		"Facebook":    facebook,
+		"Google":      google,
+		"BudgetMs":    h.interstitialBudget.Milliseconds(),
+	})
+	return true
+}
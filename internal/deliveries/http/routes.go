@@ -0,0 +1,200 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Route is a path template and the methods it accepts. A template segment
+// in braces, such as {code}, matches any one path segment; a final
+// {name...} segment matches the rest of the path.
+type Route struct {
+	Pattern string
+	Methods []string
+}
+
+func route(pattern string, methods ...string) Route {
+	return Route{Pattern: pattern, Methods: methods}
+}
+
+// String renders the route the way the registration log lines show it,
+// e.g. "GET|POST /api/v1/hooks".
+func (rt Route) String() string {
+	return strings.Join(rt.Methods, "|") + " " + rt.Pattern
+}
+
+// logRoutes logs the routes a handler registered.
+func logRoutes(name string, routes []Route) {
+	parts := make([]string, len(routes))
+	for i, rt := range routes {
+		parts[i] = rt.String()
+	}
+	log.Printf("%s routes registered: %s", name, strings.Join(parts, ", "))
+}
+
+// RouteTable knows which methods every route accepts. Its middleware answers
+// OPTIONS requests and requests with a method the route does not accept, so
+// the Allow header of both always matches what the handlers serve.
+type RouteTable struct {
+	routes []compiledRoute
+}
+
+type compiledRoute struct {
+	Route
+	segments []string
+	// prefix is the number of literal segments the pattern starts with.
+	prefix int
+}
+
+func NewRouteTable() *RouteTable {
+	return &RouteTable{}
+}
+
+// Add records routes; later additions of the same pattern add methods.
+func (t *RouteTable) Add(routes ...Route) {
+	for _, rt := range routes {
+		segments := splitPath(rt.Pattern)
+		prefix := 0
+		for prefix < len(segments) && !strings.HasPrefix(segments[prefix], "{") {
+			prefix++
+		}
+		t.routes = append(t.routes, compiledRoute{Route: rt, segments: segments, prefix: prefix})
+	}
+}
+
+// Allowed returns the methods accepted at path, plus OPTIONS, or nil when
+// no route matches. A path belongs to the routes with the longest literal
+// prefix it starts with, so /api/v1/links/{code}/unknown matches nothing
+// rather than the /{code}/{rest...} redirect route.
+func (t *RouteTable) Allowed(path string) []string {
+	segments := splitPath(path)
+	owner := -1
+	for _, rt := range t.routes {
+		if rt.prefix > owner && rt.hasPrefix(segments) {
+			owner = rt.prefix
+		}
+	}
+	var methods []string
+	for _, rt := range t.routes {
+		if rt.prefix != owner || !rt.hasPrefix(segments) || !rt.matches(segments) {
+			continue
+		}
+		for _, m := range rt.Methods {
+			if !containsMethod(methods, m) {
+				methods = append(methods, m)
+			}
+		}
+	}
+	if methods == nil {
+		return nil
+	}
+	return append(methods, http.MethodOptions)
+}
+
+// Label returns the pattern of the route path belongs to, for metric labels
+// and log fields: a value from a fixed set, however many codes or probing
+// paths there are. Subpaths of wildcard links are labeled as the redirect
+// route, and paths no route matches as routeOther.
+func (t *RouteTable) Label(path string) string {
+	segments := splitPath(path)
+	owner := -1
+	for _, rt := range t.routes {
+		if rt.prefix > owner && rt.hasPrefix(segments) {
+			owner = rt.prefix
+		}
+	}
+	label, literals := routeOther, -1
+	for _, rt := range t.routes {
+		if rt.prefix != owner || !rt.hasPrefix(segments) || !rt.matches(segments) {
+			continue
+		}
+		// Of the routes that match, the most specific one names the path:
+		// /api/v1/links/{code}/stats rather than a pattern ending in {rest...}.
+		if n := rt.literals(); n > literals {
+			label, literals = rt.Pattern, n
+		}
+	}
+	if label == routeWildcard {
+		return routeRedirect
+	}
+	return label
+}
+
+func (rt compiledRoute) literals() int {
+	n := 0
+	for _, s := range rt.segments {
+		if !strings.HasPrefix(s, "{") {
+			n++
+		}
+	}
+	return n
+}
+
+func (rt compiledRoute) hasPrefix(segments []string) bool {
+	if len(segments) < rt.prefix {
+		return false
+	}
+	for i := 0; i < rt.prefix; i++ {
+		if rt.segments[i] != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (rt compiledRoute) matches(segments []string) bool {
+	for i, s := range rt.segments {
+		if strings.HasSuffix(s, "...}") {
+			return len(segments) > i
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if !strings.HasPrefix(s, "{") && s != segments[i] {
+			return false
+		}
+	}
+	return len(segments) == len(rt.segments)
+}
+
+// Middleware answers OPTIONS with 204 and the Allow header, and a method the
+// route does not accept with 405 and the Allow header. CORS preflight
+// requests and paths no route matches go on to next.
+func (t *RouteTable) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := t.Allowed(r.URL.Path)
+		if allowed == nil || containsMethod(allowed, r.Method) && r.Method != http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+	})
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
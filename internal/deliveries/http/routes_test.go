@@ -0,0 +1,39 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRouteTableLabel(t *testing.T) {
+	routes := NewRouteTable()
+	routes.Add((&ShortenerHandler{}).Routes()...)
+	routes.Add(
+		route("/api/v1/links/bulk-delete", http.MethodPost),
+		route("/api/v1/links/{code}/stats", http.MethodGet),
+		route("/api/v1/trash", http.MethodGet),
+		route("/api/v1/trash/{code}", http.MethodDelete),
+		route("/integrations/slack", http.MethodPost),
+		route("/metrics", http.MethodGet),
+	)
+	for _, tt := range []struct{ path, want string }{
+		{"/", "/"},
+		{"/abc123", routeRedirect},
+		{"/abc123+", routeRedirect},
+		{"/abc123/docs/page", routeRedirect},
+		{"/update/abc123", "/update/{code}"},
+		{"/api/v1/links/bulk-delete", "/api/v1/links/bulk-delete"},
+		{"/api/v1/links/abc123/stats", "/api/v1/links/{code}/stats"},
+		{"/api/v1/trash/abc123", "/api/v1/trash/{code}"},
+		{"/integrations/slack", "/integrations/slack"},
+		{"/metrics", "/metrics"},
+		// Probes for paths no handler serves must not become labels.
+		{"/api/v1/trash/abc123/wp-login.php", routeOther},
+		{"/api/v1/links/abc123/unknown", routeOther},
+		{"/integrations/slack/../../etc/passwd", routeOther},
+	} {
+		if got := routes.Label(tt.path); got != tt.want {
+			t.Errorf("Label(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
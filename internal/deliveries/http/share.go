@@ -0,0 +1,69 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"template/internal/pkg/ratelimit"
+	"template/internal/services"
+)
+
+// ShareLinkRequest is the body of POST /api/v1/links/{code}/share. Channel
+// is "email" or "sms"; To is an email address or a phone number in
+// international form.
+type ShareLinkRequest struct {
+	Channel    string `json:"channel"`
+	To         string `json:"to"`
+	SenderName string `json:"sender_name"`
+	Message    string `json:"message"`
+}
+
+// EnableSharing adds POST /api/v1/links/{code}/share, which sends the short
+// link by email or SMS. limiter caps the shares of each client IP and to
+// each recipient.
+func (h *LinkHandler) EnableSharing(share services.ShareService, limiter *ratelimit.Limiter) {
+	h.share = share
+	h.shareLimiter = limiter
+}
+
+func (h *LinkHandler) handleShare(w http.ResponseWriter, r *http.Request, shortCode string) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	var req ShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Handler error decoding share request for %s: %v", shortCode, err)
+		respondWithBodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	now := time.Now()
+	for _, key := range []string{clientIP(r), "to:" + strings.ToLower(strings.TrimSpace(req.To))} {
+		if ok, wait := h.shareLimiter.Allow(key, now); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			respondWithError(w, r, http.StatusTooManyRequests, "Too many shares, try again later")
+			return
+		}
+	}
+
+	err := h.share.Share(shortCode, services.Share{
+		Channel:    req.Channel,
+		To:         req.To,
+		SenderName: req.SenderName,
+		Message:    req.Message,
+	})
+	if err != nil {
+		log.Printf("Handler error from service Share for %s: %v", shortCode, err)
+		respondWithServiceError(w, r, err, "Failed to share link")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,70 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"template/internal/pkg/ratelimit"
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// stubShare records the shares it was asked to send and answers err.
+type stubShare struct {
+	shares []services.Share
+	err    error
+}
+
+func (s *stubShare) Share(code string, share services.Share) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.shares = append(s.shares, share)
+	return nil
+}
+
+func TestShareLink(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "promo", LongURL: "https://example.com/sale"})
+	share := &stubShare{}
+	h := NewLinkHandler(f.service, nil, nil)
+	h.EnableSharing(share, ratelimit.New(1, time.Hour))
+	h.RegisterRoutes(f.mux)
+
+	body := `{"channel":"email","to":"ann@example.com","sender_name":"Bob","message":"Look"}`
+	rec := f.do(http.MethodPost, "/api/v1/links/promo/share", "application/json", body)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	want := services.Share{Channel: "email", To: "ann@example.com", SenderName: "Bob", Message: "Look"}
+	if len(share.shares) != 1 || share.shares[0] != want {
+		t.Errorf("shares = %+v, want %+v", share.shares, want)
+	}
+
+	// The same client may share only once an hour.
+	rec = f.do(http.MethodPost, "/api/v1/links/promo/share", "application/json", `{"channel":"email","to":"bob@example.com"}`)
+	expectError(t, rec, http.StatusTooManyRequests, "RATE_LIMITED")
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+	// So may the same recipient, from any client.
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/links/promo/share", strings.NewReader(body))
+	req.RemoteAddr = "198.51.100.7:4000"
+	rec = httptest.NewRecorder()
+	f.mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second share to ann@example.com: status = %d, want 429", rec.Code)
+	}
+
+	share.err = services.ErrValidationFailed
+	h.EnableSharing(share, ratelimit.New(0, time.Hour))
+	rec = f.do(http.MethodPost, "/api/v1/links/promo/share", "application/json", `{"channel":"fax","to":"x"}`)
+	expectError(t, rec, http.StatusBadRequest, "VALIDATION_FAILED")
+
+	rec = f.do(http.MethodGet, "/api/v1/links/promo/share", "", "")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want 405", rec.Code)
+	}
+}
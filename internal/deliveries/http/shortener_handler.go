@@ -4,134 +4,422 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"template/internal/pkg/captcha"
+	"template/internal/pkg/clientip"
+	"template/internal/pkg/featureflags"
+	"template/internal/pkg/geo"
+	"template/internal/pkg/i18n"
+	"template/internal/pkg/idn"
+	"template/internal/pkg/prefetch"
+	"template/internal/pkg/utils"
 	"template/internal/repositories"
 	"template/internal/services"
+	"template/internal/usecases/shortner"
 )
 
 type UpdateRequest struct {
-	NewURL string `json:"new_url"`
+	NewURL       string            `json:"new_url"`
+	Headers      map[string]string `json:"headers"`
+	RedirectType *int              `json:"redirect_type"`
+	CacheControl *string           `json:"cache_control"`
+	Language     *string           `json:"language"`
+	// ExpiresAt is an RFC 3339 timestamp; an empty string removes the expiry.
+	ExpiresAt       *string           `json:"expires_at"`
+	LanguageTargets map[string]string `json:"language_targets"`
+	PixelIDs        []int64           `json:"pixel_ids"`
+	StatsVisibility *string           `json:"stats_visibility"`
+	SingleUse       *bool             `json:"single_use"`
+	// AllowedCountries and BlockedCountries are ISO 3166-1 alpha-2 codes;
+	// an empty list removes the rule.
+	AllowedCountries []string `json:"allowed_countries"`
+	BlockedCountries []string `json:"blocked_countries"`
+	// TimeRules replaces the ordered time rules; an empty list removes
+	// them.
+	TimeRules        []shortner.TimeRule `json:"time_rules"`
+	SocialPreview    *bool               `json:"social_preview"`
+	QueryPassthrough *string             `json:"query_passthrough"`
+	// SpikeFactor and SpikeMinClicks are the link's click spike alert
+	// thresholds; 0 restores the default and a negative factor turns the
+	// alerts off.
+	SpikeFactor    *float64 `json:"spike_factor"`
+	SpikeMinClicks *int64   `json:"spike_min_clicks"`
+}
+
+// empty reports whether req changes nothing.
+func (req UpdateRequest) empty() bool {
+	return req.NewURL == "" && req.Headers == nil && req.RedirectType == nil && req.CacheControl == nil && req.Language == nil && req.ExpiresAt == nil && req.LanguageTargets == nil && req.PixelIDs == nil && req.StatsVisibility == nil && req.SingleUse == nil && req.AllowedCountries == nil && req.BlockedCountries == nil && req.TimeRules == nil && req.SocialPreview == nil && req.QueryPassthrough == nil && req.SpikeFactor == nil && req.SpikeMinClicks == nil
+}
+
+// linkUpdate converts req for the service, checking the pixels it names
+// against pixels (nil when retargeting is disabled). On failure it has
+// written the error response and returns false.
+func linkUpdate(w http.ResponseWriter, r *http.Request, req UpdateRequest, pixels services.PixelService) (shortner.LinkUpdate, bool) {
+	update := shortner.LinkUpdate{
+		Headers:      req.Headers,
+		RedirectType: req.RedirectType,
+		CacheControl: req.CacheControl,
+		Language:     req.Language,
+	}
+	update.StatsVisibility = req.StatsVisibility
+	update.SingleUse = req.SingleUse
+	update.LanguageTargets = req.LanguageTargets
+	update.AllowedCountries = req.AllowedCountries
+	update.BlockedCountries = req.BlockedCountries
+	update.TimeRules = req.TimeRules
+	update.SocialPreview = req.SocialPreview
+	update.QueryPassthrough = req.QueryPassthrough
+	update.SpikeFactor = req.SpikeFactor
+	update.SpikeMinClicks = req.SpikeMinClicks
+	if req.PixelIDs != nil {
+		if pixels == nil {
+			respondWithError(w, r, http.StatusBadRequest, "Retargeting pixels are not enabled")
+			return update, false
+		}
+		if err := pixels.CheckPixels(req.PixelIDs); err != nil {
+			respondWithServiceError(w, r, err, "Failed to check pixels")
+			return update, false
+		}
+		update.PixelIDs = req.PixelIDs
+	}
+	if req.NewURL != "" {
+		update.LongURL = &req.NewURL
+	}
+	if req.ExpiresAt != nil {
+		var expiresAt time.Time
+		if *req.ExpiresAt != "" {
+			parsed, err := time.Parse(time.RFC3339, *req.ExpiresAt)
+			if err != nil {
+				respondWithError(w, r, http.StatusBadRequest, "Invalid 'expires_at', expected an RFC 3339 timestamp")
+				return update, false
+			}
+			expiresAt = parsed
+		}
+		update.ExpiresAt = &expiresAt
+	}
+	return update, true
+}
+
+// RedirectOptions are the operator-wide settings applied to every redirect.
+type RedirectOptions struct {
+	// Headers are added to every redirect response; per-link headers with
+	// the same name take precedence.
+	Headers map[string]string
+	// CacheControlTemporary and CacheControlPermanent are the default
+	// Cache-Control values for 302/307 and 301/308 redirects respectively.
+	CacheControlTemporary string
+	CacheControlPermanent string
+	// PreviewNoRedirect answers link preview bots with an empty 200
+	// instead of the redirect.
+	PreviewNoRedirect bool
+	// QueryPassthrough is the query passthrough mode of links without
+	// their own; empty means shortner.QueryOff.
+	QueryPassthrough string
+}
+
+// LinkRenderer serves links whose kind is not a plain redirect. rest is the
+// remainder of the path after "/{code}/", empty for the link itself.
+type LinkRenderer interface {
+	ServeLink(w http.ResponseWriter, r *http.Request, mapping *shortner.URLMapping, rest string)
 }
 
 type ShortenerHandler struct {
-	service services.ShortenerService
-	repo    repositories.ShortenerRepository
-	baseURL string
+	service   services.ShortenerService
+	analytics services.AnalyticsService
+	repo      repositories.ShortenerRepository
+	baseURL   string
+	redirect  RedirectOptions
+	renderers map[string]LinkRenderer
+
+	pixels             services.PixelService
+	interstitialBudget time.Duration
+	flags              *featureflags.Set
+	stats              services.StatsService
+	signing            services.SigningService
+	policy             services.RedirectPolicyService
+	geo                geo.Locator
+	geoBlockedPage     []byte
+	social             services.SocialPreviewService
+	honeypots          services.HoneypotService
+	profiles           *ProfileHandler
+	captcha            captcha.Verifier
+	captchaBypassToken string
+	adminToken         string
+	clock              services.Clock
 }
 
-func NewShortenerHandler(svc services.ShortenerService, repo repositories.ShortenerRepository, baseURL string) *ShortenerHandler {
+func NewShortenerHandler(svc services.ShortenerService, analytics services.AnalyticsService, repo repositories.ShortenerRepository, baseURL string, redirect RedirectOptions) *ShortenerHandler {
 	return &ShortenerHandler{
-		service: svc,
-		repo:    repo,
-		baseURL: baseURL,
+		service:   svc,
+		analytics: analytics,
+		repo:      repo,
+		baseURL:   baseURL,
+		redirect:  redirect,
+		renderers: make(map[string]LinkRenderer),
+		clock:     services.SystemClock,
 	}
 }
 
+// RegisterRenderer makes links of the given kind be served by renderer
+// instead of being redirected.
+func (h *ShortenerHandler) RegisterRenderer(kind string, renderer LinkRenderer) {
+	h.renderers[kind] = renderer
+}
+
+// SetFeatureFlags makes the handler honor runtime feature flags; without
+// them the built-in defaults apply.
+func (h *ShortenerHandler) SetFeatureFlags(flags *featureflags.Set) {
+	h.flags = flags
+}
+
+// SetClock replaces the clock redirects check expiry, signed-link
+// deadlines and time rules against, for tests; give the services the same
+// one.
+func (h *ShortenerHandler) SetClock(clock services.Clock) {
+	h.clock = clock
+}
+
+// SetAdminToken sets the ADMIN_TOKEN that, like an API key with the
+// links:write scope, authorizes changing who may see a link's stats.
+func (h *ShortenerHandler) SetAdminToken(token string) {
+	h.adminToken = token
+}
+
 func (h *ShortenerHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/shorten", h.handleShorten)
+	mux.HandleFunc("/quick", h.handleQuick)
 	mux.HandleFunc("/update/", h.handleUpdate)
 	mux.HandleFunc("/delete/", h.handleDelete)
 	mux.HandleFunc("/", h.handleRedirectOrRoot)
 
-	log.Println("Shortener routes registered: POST /shorten, PUT /update/, DELETE /delete/, GET /")
+	logRoutes("Shortener", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods. Links
+// are served at /{code}; bundles and pastes have pages below it.
+func (h *ShortenerHandler) Routes() []Route {
+	return []Route{
+		route("/shorten", http.MethodPost),
+		route("/quick", http.MethodPost),
+		route("/update/{code}", http.MethodPut),
+		route("/delete/{code}", http.MethodDelete),
+		route("/", http.MethodGet),
+		route("/{code}", http.MethodGet),
+		route("/{code}/{rest...}", http.MethodGet),
+	}
 }
 
 func (h *ShortenerHandler) handleShorten(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		respondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
 		return
 	}
 
 	var req ShortenRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Handler error decoding shorten request: %v", err)
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		respondWithBodyError(w, r, err)
 		return
 	}
 	defer r.Body.Close()
 
-	shortCode, err := h.service.CreateShortURL(req.URL)
+	if !h.checkCaptcha(w, r, req.CaptchaToken) {
+		return
+	}
+
+	create := h.service.CreateShortURL
+	switch {
+	case req.SingleUse && req.Wildcard:
+		respondWithError(w, r, http.StatusBadRequest, "A link cannot be both single_use and wildcard")
+		return
+	case req.SingleUse:
+		create = h.service.CreateSingleUseURL
+	case req.Wildcard:
+		create = h.service.CreateWildcardURL
+	}
+	shortCode, err := create(req.URL)
 	if err != nil {
 		log.Printf("Handler error from service CreateShortURL: %v", err)
-		if strings.Contains(err.Error(), "invalid URL format") {
-			respondWithError(w, http.StatusBadRequest, err.Error())
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "Failed to create short URL")
-		}
+		respondWithServiceError(w, r, err, "Failed to create short URL")
 		return
 	}
 
-	fullShortURL := fmt.Sprintf("%s/%s", strings.TrimSuffix(h.baseURL, "/"), shortCode)
-	resp := ShortenResponse{ShortURL: fullShortURL, OriginalURL: req.URL}
+	fullShortURL := h.buildShortURL(shortCode)
+	longURL, err := idn.NormalizeURL(req.URL)
+	if err != nil {
+		longURL = req.URL
+	}
+	resp := ShortenResponse{
+		ShortCode:   shortCode,
+		ShortURL:    fullShortURL,
+		LongURL:     longURL,
+		OriginalURL: idn.DisplayURL(req.URL),
+		Warnings:    idn.MixedScripts(req.URL),
+	}
 	respondWithJSON(w, http.StatusCreated, resp)
 	log.Printf("Handler successfully handled shorten request for %s -> %s", req.URL, fullShortURL)
 }
 
+// handleQuick is a minimal variant of /shorten for browser extensions and
+// scripts: the URL may be sent as a "url" form/query parameter, a JSON body
+// or the raw request body, and the response is the bare short URL as text.
+func (h *ShortenerHandler) handleQuick(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer r.Body.Close()
+
+	longURL, err := readQuickURL(r)
+	if err != nil {
+		log.Printf("Handler error reading quick request: %v", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body is too large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		}
+		return
+	}
+	if longURL == "" {
+		http.Error(w, "Missing URL", http.StatusBadRequest)
+		return
+	}
+
+	shortCode, err := h.service.CreateShortURL(longURL)
+	if err != nil {
+		log.Printf("Handler error from service CreateShortURL (quick): %v", err)
+		switch {
+		case errors.Is(err, services.ErrInvalidURL):
+			http.Error(w, "Invalid URL", http.StatusBadRequest)
+		case errors.Is(err, services.ErrURLTooLong):
+			http.Error(w, "URL is too long", http.StatusUnprocessableEntity)
+		default:
+			http.Error(w, "Failed to create short URL", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	fullShortURL := h.buildShortURL(shortCode)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	if _, err := io.WriteString(w, fullShortURL); err != nil {
+		log.Printf("Error writing quick response: %v", err)
+	}
+	log.Printf("Handler successfully handled quick request for %s -> %s", longURL, fullShortURL)
+}
+
+func readQuickURL(r *http.Request) (string, error) {
+	if v := r.URL.Query().Get("url"); v != "" {
+		return strings.TrimSpace(v), nil
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "application/json"):
+		var req ShortenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(req.URL), nil
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"),
+		strings.HasPrefix(contentType, "multipart/form-data"):
+		return strings.TrimSpace(r.FormValue("url")), nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func (h *ShortenerHandler) buildShortURL(shortCode string) string {
+	return buildShortURL(h.baseURL, shortCode)
+}
+
+func buildShortURL(baseURL, shortCode string) string {
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(baseURL, "/"), shortCode)
+}
+
 func (h *ShortenerHandler) handleUpdate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
-		respondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
 		return
 	}
 
 	shortCode := strings.TrimPrefix(r.URL.Path, "/update/")
 	if shortCode == "" || strings.Contains(shortCode, "/") {
-		respondWithError(w, http.StatusBadRequest, "Invalid short code in URL path")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid short code in URL path")
 		return
 	}
 
 	var req UpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Handler error decoding update request for code %s: %v", shortCode, err)
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		respondWithBodyError(w, r, err)
 		return
 	}
 	defer r.Body.Close()
 
-	if req.NewURL == "" {
-		respondWithError(w, http.StatusBadRequest, "Missing 'new_url' in request body")
+	if req.empty() {
+		respondWithError(w, r, http.StatusBadRequest, "Missing 'new_url' in request body")
+		return
+	}
+	// Opening the stats, or issuing a token for them, would show anyone
+	// the link's clicks.
+	if req.StatsVisibility != nil && !authorizeScope(w, r, h.adminToken, shortner.ScopeLinksWrite) {
+		return
+	}
+	update, ok := linkUpdate(w, r, req, h.pixels)
+	if !ok {
 		return
 	}
 
-	err := h.service.UpdateLongURL(shortCode, req.NewURL)
+	err := h.service.UpdateLink(shortCode, update)
 	if err != nil {
-		log.Printf("Handler error from service UpdateLongURL for code %s: %v", shortCode, err)
-		if errors.Is(err, repositories.ErrNotFound) {
-			respondWithError(w, http.StatusNotFound, "Short code not found")
-		} else if strings.Contains(err.Error(), "invalid new URL format") {
-			respondWithError(w, http.StatusBadRequest, err.Error())
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "Failed to update mapping")
-		}
+		log.Printf("Handler error from service UpdateLink for code %s: %v", shortCode, err)
+		respondWithServiceError(w, r, err, "Failed to update mapping")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{"message": "URL updated successfully"})
+	resp := map[string]string{"message": "URL updated successfully"}
+	if req.StatsVisibility != nil && *req.StatsVisibility == shortner.StatsToken {
+		// The new stats token is only ever shown in this response.
+		mapping, err := h.service.GetLink(shortCode)
+		if err != nil {
+			respondWithServiceError(w, r, err, "Failed to load stats token")
+			return
+		}
+		resp["stats_token"] = mapping.StatsToken
+	}
+	respondWithJSON(w, http.StatusOK, resp)
 	log.Printf("Handler successfully updated short code %s", shortCode)
 }
 
 func (h *ShortenerHandler) handleDelete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
-		respondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
 		return
 	}
 
 	shortCode := strings.TrimPrefix(r.URL.Path, "/delete/")
 	if shortCode == "" || strings.Contains(shortCode, "/") {
-		respondWithError(w, http.StatusBadRequest, "Invalid short code in URL path")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid short code in URL path")
 		return
 	}
 
 	err := h.service.DeleteMapping(shortCode)
 	if err != nil {
 		log.Printf("Handler error from service DeleteMapping for code %s: %v", shortCode, err)
-		if errors.Is(err, repositories.ErrNotFound) {
-			respondWithError(w, http.StatusNotFound, "Short code not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "Failed to delete mapping")
-		}
+		respondWithServiceError(w, r, err, "Failed to delete mapping")
 		return
 	}
 
@@ -141,16 +429,20 @@ func (h *ShortenerHandler) handleDelete(w http.ResponseWriter, r *http.Request)
 
 func (h *ShortenerHandler) handleRedirectOrRoot(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		respondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
 		return
 	}
 
 	if r.URL.Path == "/" {
-		respondWithJSON(w, http.StatusOK, map[string]string{"message": "URL Shortener API. Use POST /shorten, PUT /update/{code}, DELETE /delete/{code}, or GET /{code}"})
+		w.Header().Set("Content-Language", requestLanguage(r))
+		respondWithJSON(w, http.StatusOK, map[string]string{"message": i18n.Default().T(requestLanguage(r), "api.welcome")})
 		return
 	}
 
-	shortCode := strings.TrimPrefix(r.URL.Path, "/")
+	// Trailing slashes are ignored, so /abc/ and /abc/raw/ work like /abc
+	// and /abc/raw; the mux already collapses duplicate slashes.
+	shortCode, rest, _ := strings.Cut(strings.TrimLeft(r.URL.Path, "/"), "/")
+	rest = strings.TrimRight(rest, "/")
 	if shortCode == "" {
 		http.NotFound(w, r)
 		return
@@ -161,40 +453,253 @@ func (h *ShortenerHandler) handleRedirectOrRoot(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	longURL, err := h.repo.FindByShortCode(shortCode)
+	if !checkHops(w, r) || !h.checkHoneypot(w, r, strings.TrimSuffix(shortCode, "+")) {
+		return
+	}
+
+	if username, ok := strings.CutPrefix(shortCode, "@"); ok && h.profiles != nil {
+		h.profiles.ServeProfile(w, r, username, rest)
+		return
+	}
+
+	// A preview shows the destination, so it needs the link's signature
+	// as much as the redirect does.
+	code, preview := strings.CutSuffix(shortCode, "+")
+	preview = preview && code != "" && rest == "" && h.stats != nil
+	if !preview {
+		code = shortCode
+	}
+	if !h.verifySignature(w, r, code) {
+		log.Printf("Handler: Short code without valid signature: %s", shortCode)
+		return
+	}
+
+	if preview {
+		h.servePreview(w, r, code)
+		return
+	}
+
+	if err := h.service.CheckCode(shortCode); err != nil {
+		log.Printf("Handler: Short code failed checksum: %s", shortCode)
+		respondWithServiceError(w, r, err, "")
+		return
+	}
+
+	mapping, err := h.repo.GetMapping(shortCode)
 	if err != nil {
 		if errors.Is(err, repositories.ErrNotFound) {
 			log.Printf("Handler: Short code not found: %s", shortCode)
-			respondWithError(w, http.StatusNotFound, "Short code not found")
+			respondWithServiceError(w, r, services.ErrLinkNotFound, "")
 		} else {
 			log.Printf("Handler: Database error during redirect lookup for code %s: %v", shortCode, err)
-			respondWithError(w, http.StatusInternalServerError, "Error looking up short code")
+			respondWithServiceError(w, r, err, "Error looking up short code")
 		}
 		return
 	}
 
-	log.Printf("Handler: Redirecting code %s to %s", shortCode, longURL)
-	http.Redirect(w, r, longURL, http.StatusFound)
+	// With case-insensitive codes the request may differ in case from the
+	// stored code; clicks and flags use the stored one.
+	shortCode = mapping.ShortCode
+
+	if mapping.Expired(h.clock.Now()) {
+		log.Printf("Handler: Short code expired: %s", shortCode)
+		respondWithServiceError(w, r, services.ErrLinkExpired, "")
+		return
+	}
+
+	if !h.checkRedirectPolicy(w, r, mapping) || !h.checkCountry(w, r, mapping) {
+		return
+	}
+
+	// Prefetches and preview bots must not use up a single-use link, so
+	// they never get past this point for one.
+	fetch := prefetch.Detect(r)
+	redirects := mapping.Kind == shortner.KindRedirect || mapping.Kind == shortner.KindFile
+	if rest == "" && redirects && ((mapping.SingleUse && fetch != "") || (fetch == prefetch.KindPreview && h.redirect.PreviewNoRedirect)) {
+		log.Printf("Handler: Answered %s of code %s without redirect", fetch, shortCode)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if mapping.SingleUse && rest == "" {
+		// Consuming before serving means a link can be lost to a failed
+		// response, but never served twice.
+		if mapping.ConsumedAt == nil {
+			err = h.service.ConsumeLink(shortCode)
+		} else {
+			err = services.ErrLinkConsumed
+		}
+		var wrongRegion *repositories.WrongRegionError
+		if errors.As(err, &wrongRegion) {
+			// Only the home region can tell whether the link was opened.
+			redirectToRegion(w, r, wrongRegion.Region)
+			return
+		}
+		if err != nil {
+			log.Printf("Handler: Single-use link not available: %s: %v", shortCode, err)
+			respondWithServiceError(w, r, err, "Error opening link")
+			return
+		}
+	}
+
+	if renderer, ok := h.renderers[mapping.Kind]; ok {
+		renderer.ServeLink(w, r, mapping, rest)
+		return
+	}
+	if rest != "" && !mapping.Wildcard {
+		respondWithServiceError(w, r, services.ErrLinkNotFound, "")
+		return
+	}
+
+	if len(mapping.LanguageTargets) > 0 {
+		w.Header().Add("Vary", "Accept-Language")
+	}
+	destination, timed := h.timeDestination(mapping)
+	if !timed {
+		destination = languageDestination(r, mapping)
+	}
+	if rest != "" {
+		suffixed, ok := appendPath(r, destination)
+		if !ok {
+			log.Printf("Handler: Path %s leaves the destination of code %s", r.URL.Path, shortCode)
+			respondWithServiceError(w, r, services.ErrLinkNotFound, "")
+			return
+		}
+		destination = suffixed
+	}
+	destination = nextHop(r, h.baseURL, h.passQuery(r, mapping, destination))
+	if mapping.SocialPreview && h.social != nil {
+		h.serveSocialPreview(w, r, mapping, destination)
+		log.Printf("Handler: Served social preview for code %s to %s", shortCode, destination)
+		recordClick(h.analytics, r, shortCode, 0)
+		return
+	}
+	if len(mapping.PixelIDs) > 0 && h.pixels != nil && h.flags.Enabled(featureflags.Interstitials, shortCode) &&
+		h.serveInterstitial(w, r, mapping, destination) {
+		log.Printf("Handler: Served retargeting interstitial for code %s to %s", shortCode, destination)
+		recordClick(h.analytics, r, shortCode, 0)
+		return
+	}
+
+	status := mapping.RedirectType
+	if status == 0 {
+		status = http.StatusFound
+	}
+	h.applyRedirectHeaders(w, mapping, status)
+
+	log.Printf("Handler: Redirecting code %s to %s (%d)", shortCode, destination, status)
+	http.Redirect(w, r, destination, status)
+
+	recordClick(h.analytics, r, shortCode, 0)
 }
 
-func respondWithError(w http.ResponseWriter, code int, message string) {
-	log.Printf("Responding with error: %d - %s", code, message)
-	respondWithJSON(w, code, ErrorResponse{Error: message})
+// languageDestination picks the link's destination for the visitor's
+// Accept-Language: the first preferred tag with an exact target wins, then
+// its primary subtag, falling back to LongURL.
+func languageDestination(r *http.Request, mapping *shortner.URLMapping) string {
+	if len(mapping.LanguageTargets) == 0 {
+		return mapping.LongURL
+	}
+	for _, tag := range i18n.ParseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		if target, ok := mapping.LanguageTargets[tag]; ok {
+			return target
+		}
+		primary, _, _ := strings.Cut(tag, "-")
+		if target, ok := mapping.LanguageTargets[primary]; ok {
+			return target
+		}
+	}
+	return mapping.LongURL
+}
+
+// recordClick queues the click for the analytics workers so analytics never
+// delay the response.
+func recordClick(analytics services.AnalyticsService, r *http.Request, shortCode string, itemID int64) {
+	analytics.EnqueueClick(shortner.Click{
+		ShortCode: shortCode,
+		ItemID:    itemID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		Referer:   r.Referer(),
+		Prefetch:  prefetch.Detect(r) != "",
+	})
+}
+
+// applyRedirectHeaders sets, in increasing order of precedence: the default
+// cache policy for the redirect status, the global headers, the per-link
+// headers and finally the per-link cache policy.
+func (h *ShortenerHandler) applyRedirectHeaders(w http.ResponseWriter, mapping *shortner.URLMapping, status int) {
+	cacheControl := h.redirect.CacheControlTemporary
+	if status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect {
+		cacheControl = h.redirect.CacheControlPermanent
+	}
+	setCacheControl(w, cacheControl)
+
+	for name, value := range h.redirect.Headers {
+		w.Header().Set(name, value)
+	}
+	for name, value := range mapping.Headers {
+		// Links may hold headers saved before the allowlist.
+		if utils.AllowedResponseHeader(name) {
+			w.Header().Set(name, value)
+		}
+	}
+
+	if mapping.CacheControl != "" {
+		setCacheControl(w, mapping.CacheControl)
+	}
+	// Where a link with country rules leads depends on the visitor, and
+	// with time rules on the time, so no cache may keep the redirect.
+	if len(mapping.AllowedCountries) > 0 || len(mapping.BlockedCountries) > 0 || len(mapping.TimeRules) > 0 {
+		setCacheControl(w, "no-store")
+	}
+	// A link served stale during a database outage may have changed.
+	if mapping.Stale {
+		setCacheControl(w, "no-store")
+		w.Header().Set("Warning", `110 - "Response is Stale"`)
+	}
 }
 
-func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
-	response, err := json.Marshal(payload)
+// redirectToRegion sends the request on to the same path in region, whose
+// instances can change the link this one cannot.
+func redirectToRegion(w http.ResponseWriter, r *http.Request, region repositories.Region) {
+	target, err := url.Parse(region.BaseURL)
 	if err != nil {
-		log.Printf("Error marshalling JSON response: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(`{"error":"Internal server error marshalling response"}`))
+		respondWithError(w, r, http.StatusInternalServerError, "Error opening link")
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	_, err = w.Write(response)
-	if err != nil {
-		log.Printf("Error writing JSON response: %v", err)
+	target.Path = strings.TrimSuffix(target.Path, "/") + r.URL.Path
+	target.RawQuery = r.URL.RawQuery
+	setCacheControl(w, "no-store")
+	http.Redirect(w, r, target.String(), http.StatusTemporaryRedirect)
+}
+
+// setCacheControl sets Cache-Control and a matching Expires header for
+// HTTP/1.0 caches that ignore Cache-Control.
+func setCacheControl(w http.ResponseWriter, value string) {
+	if value == "" {
+		return
+	}
+	w.Header().Set("Cache-Control", value)
+
+	lower := strings.ToLower(value)
+	if strings.Contains(lower, "no-store") || strings.Contains(lower, "no-cache") {
+		w.Header().Set("Expires", "0")
+		return
+	}
+	for _, directive := range strings.Split(lower, ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		if seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil {
+			w.Header().Set("Expires", time.Now().Add(time.Duration(seconds)*time.Second).UTC().Format(http.TimeFormat))
+		}
+		return
 	}
 }
+
+func clientIP(r *http.Request) string {
+	return clientip.FromRequest(r)
+}
@@ -0,0 +1,972 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"template/internal/pkg/captcha"
+	"template/internal/pkg/geo"
+	"template/internal/pkg/linksign"
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+const testBaseURL = "https://sho.rt"
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+type shortenerFixture struct {
+	mux       *http.ServeMux
+	handler   *ShortenerHandler
+	service   *fakeShortenerService
+	repo      *fakeShortenerRepo
+	analytics *fakeAnalytics
+}
+
+func newShortenerFixture(links ...shortner.URLMapping) *shortenerFixture {
+	f := &shortenerFixture{repo: newFakeShortenerRepo(links...), analytics: &fakeAnalytics{}, mux: http.NewServeMux()}
+	f.service = newFakeShortenerService(f.repo)
+	f.handler = NewShortenerHandler(f.service, f.analytics, f.repo, testBaseURL, RedirectOptions{
+		Headers:               map[string]string{"X-Robots-Tag": "noindex"},
+		CacheControlTemporary: "no-store",
+		CacheControlPermanent: "public, max-age=60",
+	})
+	f.handler.SetAdminToken(testAdminToken)
+	f.handler.RegisterRoutes(f.mux)
+	return f
+}
+
+func (f *shortenerFixture) do(method, target, contentType, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	f.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) ErrorResponse {
+	t.Helper()
+	var body ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body %q is not JSON: %v", rec.Body.String(), err)
+	}
+	return body
+}
+
+// expectError checks the status and machine-readable code of an error.
+func expectError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d (body %s)", rec.Code, status, rec.Body.String())
+	}
+	if got := decodeError(t, rec).Code; got != code {
+		t.Errorf("code = %q, want %q", got, code)
+	}
+}
+
+func TestShortenCreatesLink(t *testing.T) {
+	f := newShortenerFixture()
+	rec := f.do(http.MethodPost, "/shorten", "application/json", `{"url":"https://example.com/page"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201 (body %s)", rec.Code, rec.Body.String())
+	}
+	var resp ShortenResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ShortURL != testBaseURL+"/code1" || resp.OriginalURL != "https://example.com/page" {
+		t.Errorf("response = %+v", resp)
+	}
+	if !f.service.called("CreateShortURL") {
+		t.Error("CreateShortURL was not called")
+	}
+}
+
+func TestEnvelopeWrapsSuccessAndError(t *testing.T) {
+	f := newShortenerFixture()
+	handler := NewEnvelope().Middleware(f.mux)
+	do := func(body string) (*httptest.ResponseRecorder, map[string]json.RawMessage) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body)))
+		var envelope map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+			t.Fatalf("body %q is not JSON: %v", rec.Body.String(), err)
+		}
+		return rec, envelope
+	}
+
+	rec, envelope := do(`{"url":"https://example.com/page"}`)
+	var resp ShortenResponse
+	if err := json.Unmarshal(envelope["data"], &resp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusCreated || resp.ShortCode != "code1" || resp.LongURL != "https://example.com/page" || string(envelope["error"]) != "null" {
+		t.Errorf("success = %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec, envelope = do(`{`)
+	var errResp ErrorResponse
+	if err := json.Unmarshal(envelope["error"], &errResp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusBadRequest || errResp.Code != codeInvalidRequest || string(envelope["data"]) != "null" {
+		t.Errorf("error = %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// siteVerifyStub answers captcha siteverify requests: tokens in valid pass,
+// and with down set the provider cannot be reached.
+type siteVerifyStub struct {
+	valid map[string]bool
+	down  bool
+	forms []url.Values
+}
+
+func (s *siteVerifyStub) Post(ctx context.Context, purpose, target, contentType string, body io.Reader) (*http.Response, error) {
+	if s.down {
+		return nil, errors.New("connection refused")
+	}
+	raw, _ := io.ReadAll(body)
+	form, _ := url.ParseQuery(string(raw))
+	s.forms = append(s.forms, form)
+	answer := `{"success":false,"error-codes":["invalid-input-response"]}`
+	if s.valid[form.Get("response")] {
+		answer = `{"success":true}`
+	}
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: io.NopCloser(strings.NewReader(answer))}, nil
+}
+
+func TestShortenCaptcha(t *testing.T) {
+	f := newShortenerFixture()
+	provider := &siteVerifyStub{valid: map[string]bool{"solved": true}}
+	verifier, err := captcha.New(captcha.ProviderTurnstile, "s3cret", 0.5, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.handler.EnableCaptcha(verifier, testAdminToken)
+
+	expectError(t, f.do(http.MethodPost, "/shorten", "application/json", `{"url":"https://example.com"}`), http.StatusForbidden, codeCaptchaFailed)
+	expectError(t, f.do(http.MethodPost, "/shorten", "application/json", `{"url":"https://example.com","captcha_token":"bot"}`), http.StatusForbidden, codeCaptchaFailed)
+	if f.service.called("CreateShortURL") {
+		t.Fatal("a link was created without a solved CAPTCHA")
+	}
+	if rec := f.do(http.MethodPost, "/shorten", "application/json", `{"url":"https://example.com","captcha_token":"solved"}`); rec.Code != http.StatusCreated {
+		t.Errorf("solved CAPTCHA: status = %d, want 201", rec.Code)
+	}
+	if last := provider.forms[len(provider.forms)-1]; last.Get("secret") != "s3cret" || last.Get("remoteip") != "192.0.2.1" {
+		t.Errorf("verification form = %v", last)
+	}
+	// The admin token skips the check.
+	if rec := f.do(http.MethodPost, "/shorten", "application/json", `{"url":"https://example.org"}`, "Authorization", "Bearer "+testAdminToken); rec.Code != http.StatusCreated {
+		t.Errorf("admin without CAPTCHA: status = %d, want 201", rec.Code)
+	}
+
+	provider.down = true
+	expectError(t, f.do(http.MethodPost, "/shorten", "application/json", `{"url":"https://example.net","captcha_token":"solved"}`), http.StatusServiceUnavailable, codeServiceUnavailable)
+}
+
+func TestShortenSingleUse(t *testing.T) {
+	f := newShortenerFixture()
+	rec := f.do(http.MethodPost, "/shorten", "application/json", `{"url":"https://example.com","single_use":true}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201", rec.Code)
+	}
+	if !f.service.called("CreateSingleUseURL") || f.service.called("CreateShortURL") {
+		t.Errorf("calls = %v, want CreateSingleUseURL only", f.service.calls)
+	}
+	if m, _ := f.repo.GetMapping("code1"); m == nil || !m.SingleUse {
+		t.Errorf("stored mapping = %+v, want single-use", m)
+	}
+}
+
+func TestShortenWildcard(t *testing.T) {
+	f := newShortenerFixture()
+	rec := f.do(http.MethodPost, "/shorten", "application/json", `{"url":"https://example.com/docs","wildcard":true}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201", rec.Code)
+	}
+	if m, _ := f.repo.GetMapping("code1"); m == nil || !m.Wildcard {
+		t.Errorf("stored mapping = %+v, want a wildcard link", m)
+	}
+	rec = f.do(http.MethodPost, "/shorten", "application/json", `{"url":"https://example.com","wildcard":true,"single_use":true}`)
+	expectError(t, rec, http.StatusBadRequest, codeInvalidRequest)
+}
+
+func TestShortenErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		errs    map[string]error
+		status  int
+		code    string
+		message string
+	}{
+		{name: "wrong method", method: http.MethodGet, status: http.StatusMethodNotAllowed, code: codeMethodNotAllowed},
+		{name: "malformed JSON", method: http.MethodPost, body: `{"url":`, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "invalid URL", method: http.MethodPost, body: `{"url":"ftp://x"}`, status: http.StatusBadRequest, code: string(services.CodeInvalidURL)},
+		{name: "too long", method: http.MethodPost, body: `{"url":"https://example.com"}`,
+			errs: map[string]error{"CreateShortURL": services.ErrURLTooLong}, status: http.StatusUnprocessableEntity, code: string(services.CodeURLTooLong)},
+		{name: "blocked", method: http.MethodPost, body: `{"url":"https://example.com"}`,
+			errs:   map[string]error{"CreateShortURL": &services.Error{Code: services.CodeDestinationBlocked, Message: "blocked"}},
+			status: http.StatusForbidden, code: string(services.CodeDestinationBlocked)},
+		{name: "internal", method: http.MethodPost, body: `{"url":"https://example.com"}`,
+			errs:   map[string]error{"CreateShortURL": errors.New("database is locked")},
+			status: http.StatusInternalServerError, code: codeInternal, message: "Failed to create short URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newShortenerFixture()
+			for method, err := range tt.errs {
+				f.service.errs[method] = err
+			}
+			rec := f.do(tt.method, "/shorten", "application/json", tt.body)
+			expectError(t, rec, tt.status, tt.code)
+			if tt.message != "" {
+				if got := decodeError(t, rec).Error; got != tt.message {
+					t.Errorf("message = %q, want %q", got, tt.message)
+				}
+			}
+			if strings.Contains(rec.Body.String(), "database is locked") {
+				t.Error("internal error details leaked to the client")
+			}
+		})
+	}
+}
+
+func TestShortenBodyTooLarge(t *testing.T) {
+	f := newShortenerFixture()
+	limited := NewBodyLimit(16).Middleware(f.mux)
+	req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"url":"https://example.com/a/long/path"}`))
+	rec := httptest.NewRecorder()
+	limited.ServeHTTP(rec, req)
+	expectError(t, rec, http.StatusRequestEntityTooLarge, codePayloadTooLarge)
+}
+
+func TestShortenProblemJSON(t *testing.T) {
+	f := newShortenerFixture()
+	rec := f.do(http.MethodPost, "/shorten", "application/json", `{"url":"nope"}`, "Accept", contentTypeProblemJSON)
+	if ct := rec.Header().Get("Content-Type"); ct != contentTypeProblemJSON {
+		t.Fatalf("Content-Type = %q, want %q", ct, contentTypeProblemJSON)
+	}
+	var problem ProblemDetails
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Status != http.StatusBadRequest || problem.Code != string(services.CodeInvalidURL) || problem.Instance != "/shorten" {
+		t.Errorf("problem = %+v", problem)
+	}
+}
+
+func TestQuickInputs(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+	}{
+		{name: "query parameter", target: "/quick?url=https://example.com/q"},
+		{name: "JSON", target: "/quick", contentType: "application/json", body: `{"url":" https://example.com/q "}`},
+		{name: "form", target: "/quick", contentType: "application/x-www-form-urlencoded", body: "url=https%3A%2F%2Fexample.com%2Fq"},
+		{name: "raw body", target: "/quick", contentType: "text/plain", body: "https://example.com/q\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newShortenerFixture()
+			rec := f.do(http.MethodPost, tt.target, tt.contentType, tt.body)
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("status = %d, want 201 (body %s)", rec.Code, rec.Body.String())
+			}
+			if rec.Body.String() != testBaseURL+"/code1" {
+				t.Errorf("body = %q", rec.Body.String())
+			}
+			if m, _ := f.repo.GetMapping("code1"); m == nil || m.LongURL != "https://example.com/q" {
+				t.Errorf("stored mapping = %+v", m)
+			}
+		})
+	}
+}
+
+func TestQuickErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		err         error
+		status      int
+	}{
+		{name: "wrong method", method: http.MethodGet, status: http.StatusMethodNotAllowed},
+		{name: "malformed JSON", method: http.MethodPost, contentType: "application/json", body: "{", status: http.StatusBadRequest},
+		{name: "missing URL", method: http.MethodPost, body: "  ", status: http.StatusBadRequest},
+		{name: "invalid URL", method: http.MethodPost, body: "not a url", status: http.StatusBadRequest},
+		{name: "too long", method: http.MethodPost, body: "https://example.com", err: services.ErrURLTooLong, status: http.StatusUnprocessableEntity},
+		{name: "internal", method: http.MethodPost, body: "https://example.com", err: errors.New("disk full"), status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newShortenerFixture()
+			if tt.err != nil {
+				f.service.errs["CreateShortURL"] = tt.err
+			}
+			rec := f.do(tt.method, "/quick", tt.contentType, tt.body)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d (body %q)", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestQuickBodyTooLarge(t *testing.T) {
+	f := newShortenerFixture()
+	limited := NewBodyLimit(8).Middleware(f.mux)
+	req := httptest.NewRequest(http.MethodPost, "/quick", strings.NewReader("https://example.com/long"))
+	rec := httptest.NewRecorder()
+	limited.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", rec.Code)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "abc", LongURL: "https://old.example.com"})
+	rec := f.do(http.MethodPut, "/update/abc", "application/json", `{"new_url":"https://new.example.com","redirect_type":301}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", rec.Code, rec.Body.String())
+	}
+	m, _ := f.repo.GetMapping("abc")
+	if m.LongURL != "https://new.example.com" || m.RedirectType != http.StatusMovedPermanently {
+		t.Errorf("mapping after update = %+v", m)
+	}
+	if strings.Contains(rec.Body.String(), "stats_token") {
+		t.Error("stats token returned without a change of visibility")
+	}
+}
+
+func TestUpdateReturnsNewStatsToken(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "abc", LongURL: "https://example.com"})
+	rec := f.do(http.MethodPut, "/update/abc", "application/json", `{"stats_visibility":"token"}`, "Authorization", "Bearer "+testAdminToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", rec.Code, rec.Body.String())
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["stats_token"] != "stats-token" {
+		t.Errorf("body = %v, want the new stats token", body)
+	}
+}
+
+func TestUpdateStatsVisibilityNeedsLinksWrite(t *testing.T) {
+	keys := services.NewAPIKeyService(&fakeAPIKeyRepo{keys: map[string]shortner.APIKey{}})
+	reader, _, err := keys.PutAPIKey("reader", shortner.APIKey{Name: "Dashboard", Scopes: []string{shortner.ScopeLinksRead, shortner.ScopeStatsRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, _, err := keys.PutAPIKey("writer", shortner.APIKey{Name: "CMS", Scopes: []string{shortner.ScopeLinksWrite}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "abc", LongURL: "https://example.com"})
+	handler := NewAPIKeyAuth(keys).Middleware(f.mux)
+	put := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/update/abc", strings.NewReader(`{"stats_visibility":"public"}`))
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	expectError(t, put(reader.Key), http.StatusForbidden, codeForbidden)
+	if m, _ := f.repo.GetMapping("abc"); m.StatsVisibility == shortner.StatsPublic {
+		t.Error("stats made public with a links:read key")
+	}
+	if rec := put(writer.Key); rec.Code != http.StatusOK {
+		t.Errorf("update with a links:write key: status = %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestUpdateExpiry(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "abc", LongURL: "https://example.com"})
+	rec := f.do(http.MethodPut, "/update/abc", "application/json", `{"expires_at":"2030-01-02T03:04:05Z"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", rec.Code, rec.Body.String())
+	}
+	m, _ := f.repo.GetMapping("abc")
+	if want := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC); m.ExpiresAt == nil || !m.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt = %v, want %v", m.ExpiresAt, want)
+	}
+}
+
+func TestUpdateErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		errs   map[string]error
+		token  string
+		status int
+		code   string
+	}{
+		{name: "wrong method", method: http.MethodPost, target: "/update/abc", status: http.StatusMethodNotAllowed, code: codeMethodNotAllowed},
+		{name: "missing code", method: http.MethodPut, target: "/update/", body: `{}`, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "nested path", method: http.MethodPut, target: "/update/abc/def", body: `{}`, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "malformed JSON", method: http.MethodPut, target: "/update/abc", body: `{`, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "nothing to change", method: http.MethodPut, target: "/update/abc", body: `{}`, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "pixels disabled", method: http.MethodPut, target: "/update/abc", body: `{"pixel_ids":[1]}`, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "bad expiry", method: http.MethodPut, target: "/update/abc", body: `{"expires_at":"tomorrow"}`, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "unknown code", method: http.MethodPut, target: "/update/zzz", body: `{"new_url":"https://example.com"}`, status: http.StatusNotFound, code: string(services.CodeLinkNotFound)},
+		{name: "validation", method: http.MethodPut, target: "/update/abc", body: `{"new_url":"https://example.com"}`,
+			errs: map[string]error{"UpdateLink": services.ErrInvalidURL}, status: http.StatusBadRequest, code: string(services.CodeInvalidURL)},
+		{name: "internal", method: http.MethodPut, target: "/update/abc", body: `{"new_url":"https://example.com"}`,
+			errs: map[string]error{"UpdateLink": errors.New("boom")}, status: http.StatusInternalServerError, code: codeInternal},
+		{name: "stats token lookup fails", method: http.MethodPut, target: "/update/abc", body: `{"stats_visibility":"token"}`,
+			errs: map[string]error{"GetLink": errors.New("boom")}, token: testAdminToken, status: http.StatusInternalServerError, code: codeInternal},
+		{name: "visibility without credentials", method: http.MethodPut, target: "/update/abc", body: `{"stats_visibility":"public"}`,
+			status: http.StatusUnauthorized, code: codeUnauthorized},
+		{name: "visibility with a wrong token", method: http.MethodPut, target: "/update/abc", body: `{"stats_visibility":"token"}`,
+			token: "guess", status: http.StatusUnauthorized, code: codeUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newShortenerFixture(shortner.URLMapping{ShortCode: "abc", LongURL: "https://example.com"})
+			for method, err := range tt.errs {
+				f.service.errs[method] = err
+			}
+			var headers []string
+			if tt.token != "" {
+				headers = []string{"Authorization", "Bearer " + tt.token}
+			}
+			expectError(t, f.do(tt.method, tt.target, "application/json", tt.body, headers...), tt.status, tt.code)
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "abc", LongURL: "https://example.com"})
+	rec := f.do(http.MethodDelete, "/delete/abc", "", "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", rec.Code)
+	}
+	if _, err := f.repo.GetMapping("abc"); err == nil {
+		t.Error("link still stored after delete")
+	}
+}
+
+func TestDeleteErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		err    error
+		status int
+		code   string
+	}{
+		{name: "wrong method", method: http.MethodGet, target: "/delete/abc", status: http.StatusMethodNotAllowed, code: codeMethodNotAllowed},
+		{name: "missing code", method: http.MethodDelete, target: "/delete/", status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "nested path", method: http.MethodDelete, target: "/delete/a/b", status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "unknown code", method: http.MethodDelete, target: "/delete/zzz", status: http.StatusNotFound, code: string(services.CodeLinkNotFound)},
+		{name: "internal", method: http.MethodDelete, target: "/delete/abc", err: errors.New("boom"), status: http.StatusInternalServerError, code: codeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newShortenerFixture(shortner.URLMapping{ShortCode: "abc", LongURL: "https://example.com"})
+			if tt.err != nil {
+				f.service.errs["DeleteMapping"] = tt.err
+			}
+			expectError(t, f.do(tt.method, tt.target, "", ""), tt.status, tt.code)
+		})
+	}
+}
+
+func TestRoot(t *testing.T) {
+	f := newShortenerFixture()
+	rec := f.do(http.MethodGet, "/", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["message"] == "" {
+		t.Errorf("body = %s, want a welcome message", rec.Body.String())
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "abc", LongURL: "https://example.com/dest"})
+	rec := f.do(http.MethodGet, "/abc/", "", "", "User-Agent", "test-agent")
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d, want 302 (body %s)", rec.Code, rec.Body.String())
+	}
+	if loc := rec.Header().Get("Location"); loc != "https://example.com/dest" {
+		t.Errorf("Location = %q", loc)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q, want the temporary default", cc)
+	}
+	if h := rec.Header().Get("X-Robots-Tag"); h != "noindex" {
+		t.Errorf("X-Robots-Tag = %q, want the global redirect header", h)
+	}
+	clicks := f.analytics.recorded()
+	if len(clicks) != 1 || clicks[0].ShortCode != "abc" || clicks[0].UserAgent != "test-agent" {
+		t.Errorf("clicks = %+v, want one click on abc", clicks)
+	}
+}
+
+func TestRedirectPerLinkSettings(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{
+		ShortCode:       "abc",
+		LongURL:         "https://example.com",
+		RedirectType:    http.StatusMovedPermanently,
+		Headers:         map[string]string{"X-Robots-Tag": "all"},
+		LanguageTargets: map[string]string{"fr": "https://example.com/fr"},
+	})
+	rec := f.do(http.MethodGet, "/abc", "", "", "Accept-Language", "fr-CA,en;q=0.5")
+	if rec.Code != http.StatusMovedPermanently {
+		t.Fatalf("status = %d, want 301", rec.Code)
+	}
+	if loc := rec.Header().Get("Location"); loc != "https://example.com/fr" {
+		t.Errorf("Location = %q, want the French target", loc)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=60" {
+		t.Errorf("Cache-Control = %q, want the permanent default", cc)
+	}
+	if h := rec.Header().Get("X-Robots-Tag"); h != "all" {
+		t.Errorf("X-Robots-Tag = %q, want the per-link header", h)
+	}
+	if !strings.Contains(strings.Join(rec.Header().Values("Vary"), ","), "Accept-Language") {
+		t.Error("Vary does not include Accept-Language")
+	}
+}
+
+func TestRedirectExpiryFollowsClock(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "soon", LongURL: "https://example.com", ExpiresAt: &expiresAt})
+	clock := &fakeClock{now: expiresAt.Add(-time.Second)}
+	f.handler.SetClock(clock)
+
+	if rec := f.do(http.MethodGet, "/soon", "", ""); rec.Code != http.StatusFound {
+		t.Fatalf("before expiry: status = %d, want 302", rec.Code)
+	}
+	clock.now = expiresAt.Add(time.Second)
+	expectError(t, f.do(http.MethodGet, "/soon", "", ""), http.StatusGone, string(services.CodeLinkExpired))
+}
+
+func TestRedirectTimeRules(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{
+		ShortCode:       "shop",
+		LongURL:         "https://example.com/open",
+		LanguageTargets: map[string]string{"de": "https://example.com/de"},
+		TimeRules: []shortner.TimeRule{
+			{Days: []string{"sat", "sun"}, TimeZone: "Europe/Berlin", URL: "https://example.com/weekend"},
+			{From: "18:00", To: "09:00", TimeZone: "Europe/Berlin", URL: "https://example.com/closed"},
+		},
+	})
+	clock := &fakeClock{}
+	f.handler.SetClock(clock)
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want string
+	}{
+		// 2030-01-02 is a Wednesday; Berlin is UTC+1 in January.
+		{"business hours", time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC), "https://example.com/de"},
+		{"evening", time.Date(2030, 1, 2, 17, 0, 0, 0, time.UTC), "https://example.com/closed"},
+		{"after midnight", time.Date(2030, 1, 3, 7, 59, 0, 0, time.UTC), "https://example.com/closed"},
+		{"opening", time.Date(2030, 1, 3, 8, 0, 0, 0, time.UTC), "https://example.com/de"},
+		{"weekend first", time.Date(2030, 1, 5, 20, 0, 0, 0, time.UTC), "https://example.com/weekend"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.now = tt.now
+			rec := f.do(http.MethodGet, "/shop", "", "", "Accept-Language", "de")
+			if rec.Code != http.StatusFound || rec.Header().Get("Location") != tt.want {
+				t.Errorf("got %d to %q, want 302 to %q", rec.Code, rec.Header().Get("Location"), tt.want)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", got)
+			}
+		})
+	}
+}
+
+func TestRedirectHopCounter(t *testing.T) {
+	f := newShortenerFixture(
+		shortner.URLMapping{ShortCode: "self", LongURL: testBaseURL + "/self?x=1"},
+		shortner.URLMapping{ShortCode: "out", LongURL: "https://example.com/?hop=7"},
+	)
+	rec := f.do(http.MethodGet, "/self?hop=3", "", "")
+	if got := rec.Header().Get("Location"); rec.Code != http.StatusFound || got != testBaseURL+"/self?hop=4&x=1" {
+		t.Errorf("own destination: %d to %q, want the hop count raised to 4", rec.Code, got)
+	}
+	rec = f.do(http.MethodGet, "/out?hop=3", "", "")
+	if got := rec.Header().Get("Location"); got != "https://example.com/?hop=7" {
+		t.Errorf("other destination: Location = %q, want it unchanged", got)
+	}
+	expectError(t, f.do(http.MethodGet, "/self?hop=10", "", ""), http.StatusLoopDetected, "LOOP_DETECTED")
+}
+
+func TestRedirectWildcard(t *testing.T) {
+	f := newShortenerFixture(
+		shortner.URLMapping{ShortCode: "docs", LongURL: "https://example.com/docs/?v=2", Wildcard: true},
+		shortner.URLMapping{ShortCode: "plain", LongURL: "https://example.com/docs"},
+	)
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/docs", "https://example.com/docs/?v=2"},
+		{"/docs/guide/install", "https://example.com/docs/guide/install?v=2"},
+		{"/docs/guide/", "https://example.com/docs/guide/?v=2"},
+		{"/docs/a%2Fb", "https://example.com/docs/a%2Fb?v=2"},
+	}
+	for _, tt := range tests {
+		rec := f.do(http.MethodGet, tt.target, "", "")
+		if got := rec.Header().Get("Location"); rec.Code != http.StatusFound || got != tt.want {
+			t.Errorf("%s: got %d to %q, want 302 to %q", tt.target, rec.Code, got, tt.want)
+		}
+	}
+	expectError(t, f.do(http.MethodGet, "/plain/guide", "", ""), http.StatusNotFound, string(services.CodeLinkNotFound))
+}
+
+func TestRedirectQueryPassthrough(t *testing.T) {
+	tests := []struct {
+		name   string
+		global string
+		link   string
+		target string
+		want   string
+	}{
+		{"off by default", "", "", "/go?utm_source=x", "https://example.com/p?ref=a&utm_source=mail"},
+		{"merge keeps destination values", shortner.QueryMerge, "", "/go?utm_source=x&q=1",
+			"https://example.com/p?ref=a&utm_source=mail&q=1"},
+		{"override replaces them", shortner.QueryMerge, shortner.QueryOverride, "/go?utm_source=x&q=1",
+			"https://example.com/p?ref=a&q=1&utm_source=x"},
+		{"link turns it off", shortner.QueryOverride, shortner.QueryOff, "/go?q=1", "https://example.com/p?ref=a&utm_source=mail"},
+		{"own parameters stay", shortner.QueryOverride, "", "/go?hop=2&q=1", "https://example.com/p?ref=a&utm_source=mail&q=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newShortenerFixture(shortner.URLMapping{
+				ShortCode:        "go",
+				LongURL:          "https://example.com/p?ref=a&utm_source=mail",
+				QueryPassthrough: tt.link,
+			})
+			f.handler.redirect.QueryPassthrough = tt.global
+			rec := f.do(http.MethodGet, tt.target, "", "")
+			if got := rec.Header().Get("Location"); rec.Code != http.StatusFound || got != tt.want {
+				t.Errorf("got %d to %q, want 302 to %q", rec.Code, got, tt.want)
+			}
+		})
+	}
+}
+
+// stubSocialPreviews answers every destination with the same tags.
+type stubSocialPreviews struct {
+	meta         shortner.PageMeta
+	destinations []string
+}
+
+func (s *stubSocialPreviews) PageMeta(_ context.Context, destination string) shortner.PageMeta {
+	s.destinations = append(s.destinations, destination)
+	return s.meta
+}
+
+func TestRedirectSocialPreview(t *testing.T) {
+	f := newShortenerFixture(
+		shortner.URLMapping{ShortCode: "card", LongURL: "https://example.com/post", SocialPreview: true},
+		shortner.URLMapping{ShortCode: "plain", LongURL: "https://example.com/other"},
+	)
+	social := &stubSocialPreviews{meta: shortner.PageMeta{
+		Title: "A <post>",
+		Tags:  []shortner.MetaTag{{Property: "og:image", Content: "https://example.com/cover.png"}},
+	}}
+	f.handler.EnableSocialPreviews(social)
+
+	rec := f.do(http.MethodGet, "/card", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`<link rel="canonical" href="https://example.com/post">`,
+		`<meta http-equiv="refresh" content="0;url=https://example.com/post">`,
+		`<meta property="og:image" content="https://example.com/cover.png">`,
+		`<meta property="og:title" content="A &lt;post&gt;">`,
+		`"@type":"WebPage"`,
+		`"url":"https://example.com/post"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page lacks %s:\n%s", want, body)
+		}
+	}
+	if len(social.destinations) != 1 || social.destinations[0] != "https://example.com/post" {
+		t.Errorf("tags fetched for %v, want the destination", social.destinations)
+	}
+	if len(f.analytics.clicks) != 1 {
+		t.Errorf("clicks = %d, want 1", len(f.analytics.clicks))
+	}
+
+	if rec := f.do(http.MethodGet, "/plain", "", ""); rec.Code != http.StatusFound {
+		t.Errorf("link without social_preview: status = %d, want 302", rec.Code)
+	}
+}
+
+func TestRedirectErrors(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		repoErr  error
+		checkErr error
+		status   int
+		code     string
+	}{
+		{name: "wrong method", method: http.MethodPost, target: "/abc", status: http.StatusMethodNotAllowed, code: codeMethodNotAllowed},
+		{name: "unknown code", method: http.MethodGet, target: "/zzz", status: http.StatusNotFound, code: string(services.CodeLinkNotFound)},
+		{name: "mistyped code", method: http.MethodGet, target: "/abc",
+			checkErr: &services.Error{Code: services.CodeCodeMistyped, Message: "mistyped"}, status: http.StatusNotFound, code: string(services.CodeCodeMistyped)},
+		{name: "lookup fails", method: http.MethodGet, target: "/abc", repoErr: errors.New("boom"), status: http.StatusInternalServerError, code: codeInternal},
+		{name: "expired", method: http.MethodGet, target: "/old", status: http.StatusGone, code: string(services.CodeLinkExpired)},
+		{name: "subpath of a redirect", method: http.MethodGet, target: "/abc/raw", status: http.StatusNotFound, code: string(services.CodeLinkNotFound)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newShortenerFixture(
+				shortner.URLMapping{ShortCode: "abc", LongURL: "https://example.com"},
+				shortner.URLMapping{ShortCode: "old", LongURL: "https://example.com", ExpiresAt: &past},
+			)
+			if tt.repoErr != nil {
+				f.repo.errs["GetMapping"] = tt.repoErr
+			}
+			if tt.checkErr != nil {
+				f.service.errs["CheckCode"] = tt.checkErr
+			}
+			expectError(t, f.do(tt.method, tt.target, "", ""), tt.status, tt.code)
+			if clicks := f.analytics.recorded(); len(clicks) != 0 {
+				t.Errorf("clicks = %+v, want none for a failed redirect", clicks)
+			}
+		})
+	}
+}
+
+func TestRedirectSingleUse(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "once", LongURL: "https://example.com", SingleUse: true})
+
+	// A prefetch must not use the link up.
+	rec := f.do(http.MethodGet, "/once", "", "", "Sec-Purpose", "prefetch")
+	if rec.Code != http.StatusOK || rec.Header().Get("Location") != "" {
+		t.Fatalf("prefetch: status = %d, Location = %q, want 200 without redirect", rec.Code, rec.Header().Get("Location"))
+	}
+
+	if rec := f.do(http.MethodGet, "/once", "", ""); rec.Code != http.StatusFound {
+		t.Fatalf("first open: status = %d, want 302", rec.Code)
+	}
+	expectError(t, f.do(http.MethodGet, "/once", "", ""), http.StatusGone, string(services.CodeLinkConsumed))
+}
+
+func TestRedirectSingleUseConsumeFails(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "once", LongURL: "https://example.com", SingleUse: true})
+	f.service.errs["ConsumeLink"] = errors.New("boom")
+	expectError(t, f.do(http.MethodGet, "/once", "", ""), http.StatusInternalServerError, codeInternal)
+}
+
+// stubPolicy blocks the codes in blocked; only Check is used.
+type stubPolicy struct {
+	services.RedirectPolicyService
+	blocked map[string]bool
+}
+
+func (p stubPolicy) Check(mapping *shortner.URLMapping) error {
+	if p.blocked[mapping.ShortCode] {
+		return services.ErrLinkBlocked
+	}
+	return nil
+}
+
+func TestRedirectBlocked(t *testing.T) {
+	f := newShortenerFixture(
+		shortner.URLMapping{ShortCode: "bad", LongURL: "https://example.com", SingleUse: true},
+		shortner.URLMapping{ShortCode: "ok", LongURL: "https://example.org"},
+	)
+	f.handler.EnableRedirectPolicy(stubPolicy{blocked: map[string]bool{"bad": true}})
+
+	rec := f.do(http.MethodGet, "/bad", "", "")
+	expectError(t, rec, http.StatusForbidden, string(services.CodeLinkBlocked))
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", got)
+	}
+	if f.service.called("ConsumeLink") || len(f.analytics.clicks) != 0 {
+		t.Error("a blocked link was consumed or counted")
+	}
+	if rec := f.do(http.MethodGet, "/ok", "", ""); rec.Code != http.StatusFound {
+		t.Errorf("unblocked link: status = %d, want 302", rec.Code)
+	}
+}
+
+// stubHoneypots treats the codes in codes as honeypots and remembers the
+// hits; only IsHoneypot and RecordHit are used.
+type stubHoneypots struct {
+	services.HoneypotService
+	codes map[string]bool
+	hits  []shortner.HoneypotHit
+}
+
+func (h *stubHoneypots) IsHoneypot(code string) bool { return h.codes[code] }
+
+func (h *stubHoneypots) RecordHit(hit shortner.HoneypotHit) { h.hits = append(h.hits, hit) }
+
+func TestRedirectHoneypot(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "ok", LongURL: "https://example.org"})
+	honeypots := &stubHoneypots{codes: map[string]bool{"trap": true}}
+	f.handler.EnableHoneypots(honeypots)
+
+	// A honeypot looks like any unknown code.
+	expectError(t, f.do(http.MethodGet, "/trap", "", "", "User-Agent", "scanner/1.0"), http.StatusNotFound, string(services.CodeLinkNotFound))
+	expectError(t, f.do(http.MethodGet, "/trap+", "", ""), http.StatusNotFound, string(services.CodeLinkNotFound))
+	if len(honeypots.hits) != 2 || honeypots.hits[0].Code != "trap" || honeypots.hits[0].IP != "192.0.2.1" || honeypots.hits[0].UserAgent != "scanner/1.0" {
+		t.Errorf("hits = %+v, want two on trap from 192.0.2.1", honeypots.hits)
+	}
+	if len(f.analytics.recorded()) != 0 {
+		t.Error("a honeypot hit was counted as a click")
+	}
+	if rec := f.do(http.MethodGet, "/ok", "", ""); rec.Code != http.StatusFound || len(honeypots.hits) != 2 {
+		t.Errorf("other link: status = %d, %d hits, want 302 and no new hit", rec.Code, len(honeypots.hits))
+	}
+}
+
+func TestRedirectCountries(t *testing.T) {
+	f := newShortenerFixture(
+		shortner.URLMapping{ShortCode: "de", LongURL: "https://example.com", AllowedCountries: []string{"DE"}},
+		shortner.URLMapping{ShortCode: "notfr", LongURL: "https://example.org", BlockedCountries: []string{"FR"}},
+	)
+
+	// Without a locator the country is unknown, which an allow-list keeps
+	// out and a block-list lets in.
+	if rec := f.do(http.MethodGet, "/de", "", ""); rec.Code != http.StatusUnavailableForLegalReasons {
+		t.Errorf("allow-listed link without a locator: status = %d, want 451", rec.Code)
+	}
+	if rec := f.do(http.MethodGet, "/notfr", "", ""); rec.Code != http.StatusFound {
+		t.Errorf("block-listed link without a locator: status = %d, want 302", rec.Code)
+	}
+
+	f.handler.EnableGeoRestrictions(geo.Header{Name: "CF-IPCountry"}, nil)
+	rec := f.do(http.MethodGet, "/de", "", "", "CF-IPCountry", "de")
+	if rec.Code != http.StatusFound {
+		t.Errorf("allowed country: status = %d, want 302", rec.Code)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("allowed country: Cache-Control = %q, want no-store", got)
+	}
+	rec = f.do(http.MethodGet, "/notfr", "", "", "CF-IPCountry", "FR")
+	if rec.Code != http.StatusUnavailableForLegalReasons || !strings.Contains(rec.Body.String(), "<html") {
+		t.Errorf("blocked country: status = %d, want 451 with the built-in page", rec.Code)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("blocked country: Cache-Control = %q, want no-store", got)
+	}
+	if len(f.analytics.clicks) != 2 {
+		t.Errorf("clicks = %d, want only the two redirects counted", len(f.analytics.clicks))
+	}
+
+	f.handler.EnableGeoRestrictions(geo.Header{Name: "CF-IPCountry"}, []byte("not here"))
+	rec = f.do(http.MethodGet, "/de", "", "", "CF-IPCountry", "US")
+	if rec.Code != http.StatusUnavailableForLegalReasons || rec.Body.String() != "not here" {
+		t.Errorf("custom page: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRedirectPreviewBot(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "abc", LongURL: "https://example.com"})
+	f.handler.redirect.PreviewNoRedirect = true
+	rec := f.do(http.MethodGet, "/abc", "", "", "User-Agent", "Slackbot-LinkExpanding 1.0")
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 for a preview bot", rec.Code)
+	}
+}
+
+// stubRenderer records the links it was asked to serve.
+type stubRenderer struct {
+	served []string
+}
+
+func (s *stubRenderer) ServeLink(w http.ResponseWriter, r *http.Request, mapping *shortner.URLMapping, rest string) {
+	s.served = append(s.served, mapping.ShortCode+"|"+rest)
+	w.WriteHeader(http.StatusTeapot)
+}
+
+func TestSignedPreview(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "abc", LongURL: "https://example.com", StatsVisibility: shortner.StatsPublic})
+	f.handler.EnablePreviews(services.NewStatsService(f.service, f.analytics, testAdminToken))
+	signing := services.NewSigningService(f.service, linksign.New("signing-key", false))
+	f.handler.EnableSigning(signing)
+	link, err := signing.Sign("abc", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	kid, exp, sig := linksign.New("signing-key", false).Sign("abc", past, past.Add(-time.Hour))
+	expired := signatureValues(kid, exp, sig).Encode()
+
+	expectError(t, f.do(http.MethodGet, "/abc+", "", "", "Accept", "application/json"), http.StatusForbidden, string(services.CodeSignatureInvalid))
+	expectError(t, f.do(http.MethodGet, "/abc+?"+expired, "", "", "Accept", "application/json"), http.StatusGone, string(services.CodeSignatureExpired))
+	rec := f.do(http.MethodGet, signedURL("/abc+", link), "", "", "Accept", "application/json")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "https://example.com") {
+		t.Errorf("signed preview: status = %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRedirectRenderer(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "p", Kind: shortner.KindPaste})
+	renderer := &stubRenderer{}
+	f.handler.RegisterRenderer(shortner.KindPaste, renderer)
+
+	if rec := f.do(http.MethodGet, "/p/raw/", "", ""); rec.Code != http.StatusTeapot {
+		t.Fatalf("status = %d, want the renderer's 418", rec.Code)
+	}
+	if len(renderer.served) != 1 || renderer.served[0] != "p|raw" {
+		t.Errorf("renderer served %v, want [p|raw]", renderer.served)
+	}
+}
+
+func TestShortenerRoutesMatchMux(t *testing.T) {
+	f := newShortenerFixture(shortner.URLMapping{ShortCode: "abc", LongURL: "https://example.com"})
+	table := NewRouteTable()
+	table.Add(f.handler.Routes()...)
+	for _, tt := range []struct {
+		path  string
+		allow string
+	}{
+		{"/shorten", "POST, OPTIONS"},
+		{"/quick", "POST, OPTIONS"},
+		{"/update/abc", "PUT, OPTIONS"},
+		{"/delete/abc", "DELETE, OPTIONS"},
+		{"/abc", "GET, OPTIONS"},
+		{"/abc/raw", "GET, OPTIONS"},
+	} {
+		if got := strings.Join(table.Allowed(tt.path), ", "); got != tt.allow {
+			t.Errorf("Allowed(%q) = %q, want %q", tt.path, got, tt.allow)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+
+	"template/internal/pkg/linksign"
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// EnableSigning makes every redirect require a valid signature in the exp
+// and sig query parameters, made with the key named by kid.
+func (h *ShortenerHandler) EnableSigning(signing services.SigningService) {
+	h.signing = signing
+}
+
+// verifySignature answers the request and returns false unless it carries
+// a valid signature for shortCode or signing is off.
+func (h *ShortenerHandler) verifySignature(w http.ResponseWriter, r *http.Request, shortCode string) bool {
+	if h.signing == nil {
+		return true
+	}
+	q := r.URL.Query()
+	if err := h.signing.Verify(shortCode, q.Get(linksign.ParamKeyID), q.Get(linksign.ParamExpires), q.Get(linksign.ParamSignature), h.clock.Now()); err != nil {
+		respondWithServiceError(w, r, err, "Failed to verify link signature")
+		return false
+	}
+	return true
+}
+
+// signatureQuery returns the signature parameters of r as a query string,
+// for the links a bundle or paste page makes to its own sub-pages, which
+// are checked against the same signature. It is empty for unsigned
+// requests.
+func signatureQuery(r *http.Request) string {
+	q := r.URL.Query()
+	exp, sig := q.Get(linksign.ParamExpires), q.Get(linksign.ParamSignature)
+	if exp == "" || sig == "" {
+		return ""
+	}
+	return "?" + signatureValues(q.Get(linksign.ParamKeyID), exp, sig).Encode()
+}
+
+// signedURL is shortURL with the parameters of link.
+func signedURL(shortURL string, link *shortner.SignedLink) string {
+	return shortURL + "?" + signatureValues(link.KeyID, link.Expires, link.Signature).Encode()
+}
+
+// signatureValues are the signature parameters; kid is left out for the
+// key without an ID.
+func signatureValues(kid, exp, sig string) url.Values {
+	values := url.Values{linksign.ParamExpires: {exp}, linksign.ParamSignature: {sig}}
+	if kid != "" {
+		values.Set(linksign.ParamKeyID, kid)
+	}
+	return values
+}
@@ -0,0 +1,170 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/services"
+)
+
+const (
+	slackMaxBodyBytes     = 16 << 10
+	slackMaxRequestSkew   = 5 * time.Minute
+	slackSignatureVersion = "v0"
+)
+
+type SlackCommandResponse struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// SlackHandler serves the Slack slash-command integration. Requests are
+// authenticated with Slack's signing secret: the per-workspace secret stored
+// in the database takes precedence over the global fallback from config.
+type SlackHandler struct {
+	service       services.ShortenerService
+	workspaces    repositories.SlackWorkspaceRepository
+	signingSecret string
+	baseURL       string
+}
+
+func NewSlackHandler(svc services.ShortenerService, workspaces repositories.SlackWorkspaceRepository, signingSecret, baseURL string) *SlackHandler {
+	return &SlackHandler{
+		service:       svc,
+		workspaces:    workspaces,
+		signingSecret: signingSecret,
+		baseURL:       baseURL,
+	}
+}
+
+func (h *SlackHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/integrations/slack", h.handleSlashCommand)
+
+	logRoutes("Slack", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *SlackHandler) Routes() []Route {
+	return []Route{
+		route("/integrations/slack", http.MethodPost),
+	}
+}
+
+func (h *SlackHandler) handleSlashCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, slackMaxBodyBytes))
+	if err != nil {
+		log.Printf("Slack handler error reading body: %v", err)
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		log.Printf("Slack handler error parsing payload: %v", err)
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	teamID := form.Get("team_id")
+	secret, err := h.lookupSigningSecret(teamID)
+	if err != nil {
+		log.Printf("Slack handler error looking up workspace '%s': %v", teamID, err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to verify request")
+		return
+	}
+	if secret == "" {
+		log.Printf("Slack handler: no signing secret configured for workspace '%s'", teamID)
+		respondWithError(w, r, http.StatusUnauthorized, "Unknown Slack workspace")
+		return
+	}
+
+	if err := verifySlackSignature(r.Header, body, secret, time.Now()); err != nil {
+		log.Printf("Slack handler signature verification failed for workspace '%s': %v", teamID, err)
+		respondWithError(w, r, http.StatusUnauthorized, "Invalid Slack signature")
+		return
+	}
+
+	longURL := strings.Trim(strings.TrimSpace(form.Get("text")), "<>")
+	if longURL == "" {
+		respondWithJSON(w, http.StatusOK, SlackCommandResponse{
+			ResponseType: "ephemeral",
+			Text:         "Usage: " + form.Get("command") + " https://example.com/some/long/page",
+		})
+		return
+	}
+
+	shortCode, err := h.service.CreateShortURL(longURL)
+	if err != nil {
+		log.Printf("Slack handler error from service CreateShortURL: %v", err)
+		text := "Sorry, the short link could not be created."
+		if errors.Is(err, services.ErrInvalidURL) {
+			text = "That doesn't look like a valid http(s) URL: " + longURL
+		}
+		// Slack only displays message bodies for 200 responses.
+		respondWithJSON(w, http.StatusOK, SlackCommandResponse{ResponseType: "ephemeral", Text: text})
+		return
+	}
+
+	fullShortURL := buildShortURL(h.baseURL, shortCode)
+	respondWithJSON(w, http.StatusOK, SlackCommandResponse{
+		ResponseType: "in_channel",
+		Text:         fullShortURL,
+	})
+	log.Printf("Slack handler shortened %s -> %s for workspace '%s'", longURL, fullShortURL, teamID)
+}
+
+func (h *SlackHandler) lookupSigningSecret(teamID string) (string, error) {
+	if teamID != "" {
+		secret, err := h.workspaces.FindSigningSecret(teamID)
+		if err == nil {
+			return secret, nil
+		}
+		if !errors.Is(err, repositories.ErrNotFound) {
+			return "", err
+		}
+	}
+	return h.signingSecret, nil
+}
+
+// verifySlackSignature checks the X-Slack-Signature header as described in
+// https://api.slack.com/authentication/verifying-requests-from-slack.
+func verifySlackSignature(header http.Header, body []byte, secret string, now time.Time) error {
+	tsHeader := header.Get("X-Slack-Request-Timestamp")
+	signature := header.Get("X-Slack-Signature")
+	if tsHeader == "" || signature == "" {
+		return errors.New("missing signature headers")
+	}
+
+	ts, err := strconv.ParseInt(tsHeader, 10, 64)
+	if err != nil {
+		return errors.New("malformed request timestamp")
+	}
+	if skew := now.Sub(time.Unix(ts, 0)); skew > slackMaxRequestSkew || skew < -slackMaxRequestSkew {
+		return errors.New("request timestamp outside allowed window")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(slackSignatureVersion + ":" + tsHeader + ":"))
+	mac.Write(body)
+	expected := slackSignatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signSlackRequest(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(slackSignatureVersion + ":" + ts + ":"))
+	mac.Write(body)
+	return slackSignatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte("command=%2Fshorten&text=https%3A%2F%2Fexample.com")
+	at := func(d time.Duration) string { return strconv.FormatInt(now.Add(d).Unix(), 10) }
+
+	for _, tt := range []struct {
+		name      string
+		ts        string
+		signedTs  string
+		secret    string
+		signature string
+		ok        bool
+	}{
+		{name: "current", ts: at(0), ok: true},
+		{name: "within skew in the past", ts: at(-slackMaxRequestSkew), ok: true},
+		{name: "within skew in the future", ts: at(slackMaxRequestSkew), ok: true},
+		{name: "replayed too late", ts: at(-slackMaxRequestSkew - time.Second)},
+		{name: "too far in the future", ts: at(slackMaxRequestSkew + time.Second)},
+		{name: "timestamp changed after signing", ts: at(0), signedTs: at(-time.Hour)},
+		{name: "malformed timestamp", ts: "yesterday"},
+		{name: "missing timestamp", ts: ""},
+		{name: "wrong secret", ts: at(0), secret: "other-secret"},
+		{name: "missing signature", ts: at(0), signature: "-"},
+		{name: "tampered signature", ts: at(0), signature: "v0=00"},
+	} {
+		signedTs, secret := tt.signedTs, tt.secret
+		if signedTs == "" {
+			signedTs = tt.ts
+		}
+		if secret == "" {
+			secret = "signing-secret"
+		}
+		header := http.Header{}
+		if tt.ts != "" {
+			header.Set("X-Slack-Request-Timestamp", tt.ts)
+		}
+		switch tt.signature {
+		case "":
+			header.Set("X-Slack-Signature", signSlackRequest(secret, signedTs, body))
+		case "-":
+		default:
+			header.Set("X-Slack-Signature", tt.signature)
+		}
+		err := verifySlackSignature(header, body, "signing-secret", now)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: verifySlackSignature = %v", tt.name, err)
+		}
+	}
+}
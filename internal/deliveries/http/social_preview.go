@@ -0,0 +1,51 @@
+package http
+
+import (
+	"net/http"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// EnableSocialPreviews makes links with SocialPreview set answer with a
+// page carrying their destination's Open Graph tags, which then redirects.
+// Without it such links redirect like any other.
+func (h *ShortenerHandler) EnableSocialPreviews(social services.SocialPreviewService) {
+	h.social = social
+}
+
+// serveSocialPreview renders the preview page for a redirect to
+// destination. Platforms that build previews read the tags and do not
+// follow the refresh; browsers follow it at once.
+func (h *ShortenerHandler) serveSocialPreview(w http.ResponseWriter, r *http.Request, mapping *shortner.URLMapping, destination string) {
+	meta := h.social.PageMeta(r.Context(), destination)
+	tags := meta.Tags
+	if meta.Title != "" && !hasTag(tags, "og:title") {
+		tags = append(tags, shortner.MetaTag{Property: "og:title", Content: meta.Title})
+	}
+	jsonLD := map[string]string{
+		"@context": "https://schema.org",
+		"@type":    "WebPage",
+		"url":      destination,
+	}
+	if meta.Title != "" {
+		jsonLD["name"] = meta.Title
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	renderPage(w, r, http.StatusOK, "social.html", pageLanguage(r, mapping), map[string]interface{}{
+		"Destination": destination,
+		"Title":       meta.Title,
+		"Tags":        tags,
+		"JSONLD":      jsonLD,
+	})
+}
+
+func hasTag(tags []shortner.MetaTag, property string) bool {
+	for _, tag := range tags {
+		if tag.Property == property {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package http
+
+import (
+	"encoding/csv"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"template/internal/pkg/xlsx"
+	"template/internal/usecases/shortner"
+)
+
+// Reports and formats of the stats exports.
+const (
+	reportClicks = "clicks"
+	reportDaily  = "daily"
+
+	formatCSV  = "csv"
+	formatXLSX = "xlsx"
+)
+
+// rowWriter writes the table of an export as CSV or XLSX.
+type rowWriter interface {
+	WriteRow(cells []string) error
+	Close() error
+}
+
+type csvRows struct{ w *csv.Writer }
+
+// WriteRow guards cells a spreadsheet would read as a formula, since
+// referers and user agents are whatever the visitor sent.
+func (c csvRows) WriteRow(cells []string) error {
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cells[i] = "'" + cell
+		}
+	}
+	return c.w.Write(cells)
+}
+
+func (c csvRows) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+var (
+	clickExportHeader = []string{"id", "short_code", "clicked_at", "item_id", "ip", "user_agent", "referer"}
+	dailyExportHeader = []string{"date", "short_code", "clicks"}
+)
+
+// handleLinkExport exports the stats of one link; see handleExport.
+func (h *LinkHandler) handleLinkExport(w http.ResponseWriter, r *http.Request, shortCode string) {
+	h.handleExport(w, r, []string{shortCode}, shortCode)
+}
+
+// handleCampaignExport exports the stats of a campaign, the links in
+// ?codes=a,b,c, as one table; ?name= names the downloaded file.
+func (h *LinkHandler) handleCampaignExport(w http.ResponseWriter, r *http.Request) {
+	var codes []string
+	for _, code := range strings.Split(r.URL.Query().Get("codes"), ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "campaign"
+	}
+	h.handleExport(w, r, codes, name)
+}
+
+// handleExport streams ?report=clicks (the default), one row per click, or
+// ?report=daily, the clicks per link and UTC day, as ?format=csv (the
+// default) or xlsx, for download. ?from= and ?to= take RFC 3339 timestamps
+// or YYYY-MM-DD dates; to defaults to now and from to 30 days before it.
+func (h *LinkHandler) handleExport(w http.ResponseWriter, r *http.Request, codes []string, name string) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	q := r.URL.Query()
+	report := q.Get("report")
+	switch report {
+	case "":
+		report = reportClicks
+	case reportClicks, reportDaily:
+	default:
+		respondWithError(w, r, http.StatusBadRequest, "Invalid report parameter (expected clicks or daily)")
+		return
+	}
+	format := q.Get("format")
+	switch format {
+	case "":
+		format = formatCSV
+	case formatCSV, formatXLSX:
+	default:
+		respondWithError(w, r, http.StatusBadRequest, "Invalid format parameter (expected csv or xlsx)")
+		return
+	}
+	to, ok := parseStatsTime(w, r, "to", time.Now())
+	if !ok {
+		return
+	}
+	from, ok := parseStatsTime(w, r, "from", to.AddDate(0, 0, -defaultCompareDays))
+	if !ok {
+		return
+	}
+
+	var table rowWriter
+	started := false
+	// start sends the headers and the header row once the export is known
+	// to succeed, or at least to have begun.
+	start := func(header []string) error {
+		if started {
+			return nil
+		}
+		started = true
+		filename := exportFilename(name, report, from, to, format)
+		if format == formatXLSX {
+			w.Header().Set("Content-Type", xlsx.ContentType)
+		} else {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		}
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		if format == formatXLSX {
+			sheet, err := xlsx.NewWriter(w, report)
+			if err != nil {
+				return err
+			}
+			table = sheet
+		} else {
+			table = csvRows{csv.NewWriter(w)}
+		}
+		return table.WriteRow(header)
+	}
+
+	var err error
+	if report == reportDaily {
+		var counts []shortner.PeriodClicks
+		if counts, err = h.stats.DailyClicks(codes, statsAccess(r), from, to); err == nil {
+			err = start(dailyExportHeader)
+			for _, count := range counts {
+				if err != nil {
+					break
+				}
+				err = table.WriteRow([]string{count.Start.Format(time.DateOnly), count.ShortCode, strconv.FormatInt(count.Clicks, 10)})
+			}
+		}
+	} else {
+		err = h.stats.ExportClicks(codes, statsAccess(r), from, to, func(click shortner.Click) error {
+			if err := start(clickExportHeader); err != nil {
+				return err
+			}
+			return table.WriteRow([]string{
+				strconv.FormatInt(click.ID, 10), click.ShortCode, click.ClickedAt.UTC().Format(time.RFC3339),
+				strconv.FormatInt(click.ItemID, 10), click.IP, click.UserAgent, click.Referer,
+			})
+		})
+		if err == nil {
+			err = start(clickExportHeader)
+		}
+	}
+	if err == nil {
+		err = table.Close()
+	}
+	if err != nil {
+		log.Printf("Handler error exporting %s of %v: %v", report, codes, err)
+		if !started {
+			respondWithServiceError(w, r, err, "Failed to export link stats")
+		}
+		// Otherwise the download has begun; it ends short, and an XLSX
+		// without its closing parts does not open.
+	}
+}
+
+// exportFilename names an export after the link or campaign, the report
+// and the dates it covers, keeping only letters, digits, '-' and '_' of
+// name.
+func exportFilename(name, report string, from, to time.Time, format string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, name)
+	if name == "" {
+		name = "export"
+	}
+	return name + "-" + report + "-" + from.UTC().Format(time.DateOnly) + "-" + to.UTC().Format(time.DateOnly) + "." + format
+}
@@ -0,0 +1,123 @@
+package http
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"template/internal/pkg/xlsx"
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+func newExportFixture(t *testing.T) *shortenerFixture {
+	t.Helper()
+	f := newShortenerFixture(
+		shortner.URLMapping{ShortCode: "spring", LongURL: "https://example.com/a", StatsVisibility: shortner.StatsPublic},
+		shortner.URLMapping{ShortCode: "summer", LongURL: "https://example.com/b", StatsVisibility: shortner.StatsPublic},
+		shortner.URLMapping{ShortCode: "secret", LongURL: "https://example.com/s", StatsVisibility: shortner.StatsPrivate},
+	)
+	day := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, click := range []shortner.Click{
+		{ShortCode: "spring", ClickedAt: day.Add(time.Hour), IP: "192.0.2.1", UserAgent: "Mozilla/5.0", Referer: "=HYPERLINK(\"https://evil.example\")"},
+		{ShortCode: "summer", ClickedAt: day.Add(25 * time.Hour), IP: "192.0.2.2", UserAgent: "curl/8.0"},
+		{ShortCode: "spring", ClickedAt: day.Add(26 * time.Hour), IP: "192.0.2.3", UserAgent: "curl/8.0"},
+		// Outside the range.
+		{ShortCode: "spring", ClickedAt: day.AddDate(0, 1, 0)},
+	} {
+		f.analytics.RecordClick(click)
+	}
+	stats := services.NewStatsService(f.service, f.analytics, testAdminToken)
+	NewLinkHandler(f.service, nil, stats).RegisterRoutes(f.mux)
+	return f
+}
+
+func TestExportLinkClicksCSV(t *testing.T) {
+	f := newExportFixture(t)
+	rec := f.do(http.MethodGet, "/api/v1/links/spring/export?from=2030-01-01&to=2030-01-03", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != "attachment; filename=spring-clicks-2030-01-01-2030-01-03.csv" {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	want := "id,short_code,clicked_at,item_id,ip,user_agent,referer\n" +
+		"1,spring,2030-01-01T01:00:00Z,0,192.0.2.1,Mozilla/5.0,\"'=HYPERLINK(\"\"https://evil.example\"\")\"\n" +
+		"3,spring,2030-01-02T02:00:00Z,0,192.0.2.3,curl/8.0,\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("body =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExportCampaignDaily(t *testing.T) {
+	f := newExportFixture(t)
+	rec := f.do(http.MethodGet, "/api/v1/stats/export?codes=summer,spring&name=New+year&report=daily&from=2030-01-01&to=2030-01-03", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != "attachment; filename=Newyear-daily-2030-01-01-2030-01-03.csv" {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	want := "date,short_code,clicks\n2030-01-01,spring,1\n2030-01-02,spring,1\n2030-01-02,summer,1\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("body =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExportXLSX(t *testing.T) {
+	f := newExportFixture(t)
+	rec := f.do(http.MethodGet, "/api/v1/stats/export?codes=spring,summer&format=xlsx&from=2030-01-01&to=2030-01-03", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != xlsx.ContentType {
+		t.Errorf("Content-Type = %q", got)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("the export is not a zip archive: %v", err)
+	}
+	var sheet string
+	for _, file := range archive.File {
+		if file.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(r)
+		sheet = string(body)
+	}
+	for _, want := range []string{
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">id</t></is></c>`,
+		`<c r="A4"><v>3</v></c>`,
+		`<t xml:space="preserve">=HYPERLINK(&#34;https://evil.example&#34;)</t>`,
+		`</sheetData></worksheet>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet lacks %s:\n%s", want, sheet)
+		}
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	f := newExportFixture(t)
+	expectError(t, f.do(http.MethodGet, "/api/v1/links/secret/export", "", ""), http.StatusForbidden, string(services.CodeStatsPrivate))
+	expectError(t, f.do(http.MethodGet, "/api/v1/stats/export?codes=spring,secret", "", ""), http.StatusForbidden, string(services.CodeStatsPrivate))
+	expectError(t, f.do(http.MethodGet, "/api/v1/links/missing/export", "", ""), http.StatusNotFound, string(services.CodeLinkNotFound))
+	expectError(t, f.do(http.MethodGet, "/api/v1/stats/export", "", ""), http.StatusBadRequest, string(services.CodeValidationFailed))
+	if rec := f.do(http.MethodGet, "/api/v1/links/spring/export?format=pdf", "", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("format=pdf: status = %d, want 400", rec.Code)
+	}
+	if rec := f.do(http.MethodGet, "/api/v1/links/secret/export", "", "", "Authorization", "Bearer "+testAdminToken); rec.Code != http.StatusOK {
+		t.Errorf("the owner was refused: status = %d, body %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,50 @@
+package http
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// locations caches the time zones of time rules, which would otherwise be
+// read from the zone database on every redirect.
+var locations sync.Map
+
+// timeDestination returns the URL of the first of the link's time rules
+// active now, and false when none is.
+func (h *ShortenerHandler) timeDestination(mapping *shortner.URLMapping) (string, bool) {
+	if len(mapping.TimeRules) == 0 {
+		return "", false
+	}
+	now := h.clock.Now()
+	for i := range mapping.TimeRules {
+		rule := &mapping.TimeRules[i]
+		loc, err := location(rule.TimeZone)
+		if err != nil {
+			log.Printf("Handler: Skipping time rule %d of code %s: %v", i+1, mapping.ShortCode, err)
+			continue
+		}
+		if rule.Active(now.In(loc)) {
+			return rule.URL, true
+		}
+	}
+	return "", false
+}
+
+// location loads the named time zone; "" is the server's.
+func location(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
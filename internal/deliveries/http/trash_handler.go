@@ -0,0 +1,117 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	defaultTrashLimit = 50
+	maxTrashLimit     = 100
+
+	cursorPrefixTrash = "trash:"
+)
+
+type TrashResponse struct {
+	Items      []shortner.TrashedLink `json:"items"`
+	NextCursor string                 `json:"next_cursor"`
+}
+
+// TrashHandler serves the trash of deleted links: GET /api/v1/trash lists
+// it newest first, POST /api/v1/trash/{code}/restore brings a link back and
+// DELETE /api/v1/trash/{code} purges it for good. Like the admin API it
+// requires "Authorization: Bearer <ADMIN_TOKEN>".
+type TrashHandler struct {
+	trash services.TrashService
+	token string
+}
+
+func NewTrashHandler(trash services.TrashService, token string) *TrashHandler {
+	return &TrashHandler{trash: trash, token: token}
+}
+
+func (h *TrashHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/trash", requireScope(h.token, shortner.ScopeLinksRead, h.handleList))
+	mux.HandleFunc("/api/v1/trash/", requireScope(h.token, shortner.ScopeLinksWrite, h.handleItem))
+
+	logRoutes("Trash", h.Routes())
+}
+
+// Routes lists the routes RegisterRoutes serves and their methods.
+func (h *TrashHandler) Routes() []Route {
+	return []Route{
+		route("/api/v1/trash", http.MethodGet),
+		route("/api/v1/trash/{code}", http.MethodDelete),
+		route("/api/v1/trash/{code}/restore", http.MethodPost),
+	}
+}
+
+// handleList accepts ?limit= (50 by default, at most 100) and the ?cursor= of the previous
+// page; next_cursor is empty on the last page.
+func (h *TrashHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	limit, ok := queryInt(w, r, "limit")
+	if !ok {
+		return
+	}
+	if limit <= 0 {
+		limit = defaultTrashLimit
+	}
+	limit = min(limit, maxTrashLimit)
+	beforeID, err := decodeCursor(cursorPrefixTrash, r.URL.Query().Get("cursor"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid cursor parameter")
+		return
+	}
+
+	items, err := h.trash.ListTrash(beforeID, limit)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Failed to list the trash")
+		return
+	}
+	resp := TrashResponse{Items: items}
+	if resp.Items == nil {
+		resp.Items = []shortner.TrashedLink{}
+	}
+	if len(items) == limit {
+		resp.NextCursor = encodeCursor(cursorPrefixTrash, items[len(items)-1].ID)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (h *TrashHandler) handleItem(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/trash/"), "/")
+	shortCode := parts[0]
+	if shortCode == "" || len(parts) > 2 || len(parts) == 2 && parts[1] != "restore" {
+		respondWithError(w, r, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		mapping, err := h.trash.Restore(shortCode)
+		if err != nil {
+			log.Printf("Handler error from service Restore for code %s: %v", shortCode, err)
+			respondWithServiceError(w, r, err, "Failed to restore link")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, mapping)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if err := h.trash.Purge(shortCode); err != nil {
+			log.Printf("Handler error from service Purge for code %s: %v", shortCode, err)
+			respondWithServiceError(w, r, err, "Failed to purge link")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
@@ -0,0 +1,79 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+// newTrashFixture serves the trash routes over three trashed links, a1 the
+// oldest.
+func newTrashFixture() (*shortenerFixture, *fakeTrashService) {
+	f := newShortenerFixture()
+	trash := &fakeTrashService{repo: f.repo}
+	for i := 1; i <= 3; i++ {
+		code := fmt.Sprintf("a%d", i)
+		trash.items = append(trash.items, shortner.TrashedLink{ID: int64(i), Link: shortner.URLMapping{ShortCode: code, LongURL: "https://example.com/" + code}})
+	}
+	NewTrashHandler(trash, testAdminToken).RegisterRoutes(f.mux)
+	return f, trash
+}
+
+func TestTrashListPages(t *testing.T) {
+	f, _ := newTrashFixture()
+	auth := []string{"Authorization", "Bearer " + testAdminToken}
+
+	var codes []string
+	target := "/api/v1/trash?limit=2"
+	for pages := 0; target != ""; pages++ {
+		if pages > 2 {
+			t.Fatal("paging did not end")
+		}
+		rec := f.do(http.MethodGet, target, "", "", auth...)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+		}
+		var resp TrashResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range resp.Items {
+			codes = append(codes, item.Link.ShortCode)
+		}
+		target = ""
+		if resp.NextCursor != "" {
+			target = "/api/v1/trash?limit=2&cursor=" + resp.NextCursor
+		}
+	}
+	if fmt.Sprint(codes) != "[a3 a2 a1]" {
+		t.Errorf("listed %v, want newest first", codes)
+	}
+}
+
+func TestTrashRestoreAndPurge(t *testing.T) {
+	f, trash := newTrashFixture()
+	auth := []string{"Authorization", "Bearer " + testAdminToken}
+
+	if rec := f.do(http.MethodPost, "/api/v1/trash/a1/restore", "", "", auth...); rec.Code != http.StatusOK {
+		t.Fatalf("restore status = %d, body %s", rec.Code, rec.Body)
+	}
+	if _, err := f.repo.GetMapping("a1"); err != nil {
+		t.Errorf("a1 was not restored: %v", err)
+	}
+	if rec := f.do(http.MethodDelete, "/api/v1/trash/a2", "", "", auth...); rec.Code != http.StatusNoContent {
+		t.Fatalf("purge status = %d, body %s", rec.Code, rec.Body)
+	}
+	if len(trash.items) != 1 {
+		t.Errorf("trash holds %d links, want 1", len(trash.items))
+	}
+
+	expectError(t, f.do(http.MethodPost, "/api/v1/trash/a1/restore", "", "", auth...), http.StatusNotFound, string(services.CodeTrashItemNotFound))
+	expectError(t, f.do(http.MethodGet, "/api/v1/trash/a3/restore", "", "", auth...), http.StatusMethodNotAllowed, codeMethodNotAllowed)
+	expectError(t, f.do(http.MethodPost, "/api/v1/trash/a3/other", "", "", auth...), http.StatusNotFound, codeNotFound)
+	expectError(t, f.do(http.MethodGet, "/api/v1/trash?cursor=bogus", "", "", auth...), http.StatusBadRequest, codeInvalidRequest)
+	expectError(t, f.do(http.MethodDelete, "/api/v1/trash/a3", "", ""), http.StatusUnauthorized, codeUnauthorized)
+}
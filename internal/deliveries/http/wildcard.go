@@ -0,0 +1,25 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// appendPath returns destination with the path of r after the short code
+// appended, as wildcard links redirect. Trailing slashes and escaping are
+// kept as requested. It returns false when the path would climb out of
+// the destination's own path.
+func appendPath(r *http.Request, destination string) (string, bool) {
+	_, suffix, _ := strings.Cut(strings.TrimLeft(r.URL.EscapedPath(), "/"), "/")
+	u, err := url.Parse(destination)
+	if err != nil {
+		return destination, false
+	}
+	base := strings.TrimSuffix(u.EscapedPath(), "/")
+	joined := u.JoinPath(suffix)
+	if !strings.HasPrefix(joined.EscapedPath(), base+"/") {
+		return destination, false
+	}
+	return joined.String(), true
+}
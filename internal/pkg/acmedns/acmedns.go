@@ -0,0 +1,331 @@
+// Package acmedns obtains and renews TLS certificates from an ACME CA such
+// as Let's Encrypt, answering the CA's DNS-01 challenges with TXT records
+// through a DNSProvider. DNS-01 is the only challenge that can prove control
+// of a wildcard name such as *.sho.rt, and it needs no inbound port 80.
+package acmedns
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// LetsEncryptURL is the directory of Let's Encrypt's production CA.
+const LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+// obtainTimeout bounds the ACME exchange for one certificate, DNS
+// propagation included.
+const obtainTimeout = 10 * time.Minute
+
+// DNSProvider publishes the TXT records that answer DNS-01 challenges. fqdn
+// is the record name, such as _acme-challenge.sho.rt, without a trailing
+// dot.
+type DNSProvider interface {
+	Present(ctx context.Context, fqdn, value string) error
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// Config configures a Manager.
+type Config struct {
+	// Domains are the names to get certificates for, one certificate
+	// each; a name may be a wildcard such as *.sho.rt.
+	Domains      []string
+	DirectoryURL string
+	// Email is the contact of the ACME account, optional.
+	Email string
+	// CacheDir keeps the account key and the certificates across
+	// restarts.
+	CacheDir string
+	// RenewBefore is how long before expiry a certificate is renewed.
+	RenewBefore time.Duration
+	// PropagationDelay is how long to wait after publishing a record
+	// before asking the CA to check it.
+	PropagationDelay time.Duration
+	Provider         DNSProvider
+}
+
+// Manager keeps a certificate for each domain and serves them through
+// GetCertificate. Certificates are only obtained or renewed by Renew, so
+// a handshake never waits on the CA.
+type Manager struct {
+	cfg    Config
+	client *acme.Client
+
+	mu    sync.RWMutex
+	certs map[string]*tls.Certificate
+
+	// renewMu serializes Renew; registered is set once the account
+	// exists.
+	renewMu    sync.Mutex
+	registered bool
+}
+
+// NewManager loads the account key and the certificates already in
+// cfg.CacheDir, creating the key on first use.
+func NewManager(cfg Config) (*Manager, error) {
+	if len(cfg.Domains) == 0 {
+		return nil, errors.New("no domains to get certificates for")
+	}
+	if cfg.Provider == nil {
+		return nil, errors.New("no DNS provider")
+	}
+	if cfg.DirectoryURL == "" {
+		cfg.DirectoryURL = LetsEncryptURL
+	}
+	if err := os.MkdirAll(cfg.CacheDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create certificate cache: %w", err)
+	}
+	key, err := loadAccountKey(filepath.Join(cfg.CacheDir, "account.key"))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		cfg:    cfg,
+		client: &acme.Client{Key: key, DirectoryURL: cfg.DirectoryURL, UserAgent: "url-shortener"},
+		certs:  make(map[string]*tls.Certificate),
+	}
+	for _, domain := range cfg.Domains {
+		data, err := os.ReadFile(m.certPath(domain))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate for %s: %w", domain, err)
+		}
+		cert, err := tls.X509KeyPair(data, data)
+		if err != nil {
+			log.Printf("Ignoring unreadable cached certificate for %s: %v", domain, err)
+			continue
+		}
+		m.certs[domain] = &cert
+	}
+	return m, nil
+}
+
+// GetCertificate picks the certificate for the name the client asked for:
+// the one for that name, else the wildcard covering it. Clients that send
+// no name get the certificate of the first domain. It fits
+// tls.Config.GetCertificate.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if name == "" {
+		name = m.cfg.Domains[0]
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if cert, ok := m.certs[name]; ok {
+		return cert, nil
+	}
+	if _, parent, ok := strings.Cut(name, "."); ok {
+		if cert, ok := m.certs["*."+parent]; ok {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("no certificate for %q", name)
+}
+
+// Renew obtains the certificates that are missing or expire within
+// RenewBefore of now. A domain that fails does not keep the others from
+// renewing; the errors are joined.
+func (m *Manager) Renew(now time.Time) error {
+	m.renewMu.Lock()
+	defer m.renewMu.Unlock()
+
+	var errs []error
+	for _, domain := range m.cfg.Domains {
+		m.mu.RLock()
+		cert := m.certs[domain]
+		m.mu.RUnlock()
+		if cert != nil && cert.Leaf != nil && now.Before(cert.Leaf.NotAfter.Add(-m.cfg.RenewBefore)) {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), obtainTimeout)
+		err := m.obtain(ctx, domain)
+		cancel()
+		if err != nil {
+			log.Printf("Error obtaining certificate for %s: %v", domain, err)
+			errs = append(errs, fmt.Errorf("%s: %w", domain, err))
+			continue
+		}
+		log.Printf("Obtained certificate for %s", domain)
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Manager) obtain(ctx context.Context, domain string) error {
+	if !m.registered {
+		account := &acme.Account{}
+		if m.cfg.Email != "" {
+			account.Contact = []string{"mailto:" + m.cfg.Email}
+		}
+		if _, err := m.client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+			return fmt.Errorf("failed to register ACME account: %w", err)
+		}
+		m.registered = true
+	}
+
+	order, err := m.client.AuthorizeOrder(ctx, acme.DomainIDs(domain))
+	if err != nil {
+		return fmt.Errorf("failed to create order: %w", err)
+	}
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.authorize(ctx, authzURL); err != nil {
+			return err
+		}
+	}
+	order, err = m.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return fmt.Errorf("order failed: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{domain}}, key)
+	if err != nil {
+		return err
+	}
+	chain, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("failed to finalize order: %w", err)
+	}
+	return m.store(domain, key, chain)
+}
+
+// authorize answers the DNS-01 challenge of one authorization. The TXT
+// record of a wildcard goes on its base name.
+func (m *Manager) authorize(ctx context.Context, authzURL string) error {
+	authz, err := m.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("failed to get authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("CA offered no dns-01 challenge for %s", authz.Identifier.Value)
+	}
+	value, err := m.client.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return err
+	}
+
+	fqdn := "_acme-challenge." + authz.Identifier.Value
+	if err := m.cfg.Provider.Present(ctx, fqdn, value); err != nil {
+		return fmt.Errorf("failed to publish %s: %w", fqdn, err)
+	}
+	defer func() {
+		// The order may have timed out; the record is removed anyway.
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := m.cfg.Provider.CleanUp(cleanupCtx, fqdn, value); err != nil {
+			log.Printf("Error removing %s: %v", fqdn, err)
+		}
+	}()
+
+	select {
+	case <-time.After(m.cfg.PropagationDelay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if _, err := m.client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("failed to accept challenge: %w", err)
+	}
+	if _, err := m.client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("authorization of %s failed: %w", authz.Identifier.Value, err)
+	}
+	return nil
+}
+
+// store writes the key and chain to the cache and starts serving them.
+func (m *Manager) store(domain string, key *ecdsa.PrivateKey, chain [][]byte) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	for _, c := range chain {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c})...)
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return fmt.Errorf("CA returned an unusable certificate: %w", err)
+	}
+	if err := writeFile(m.certPath(domain), data); err != nil {
+		return fmt.Errorf("failed to cache certificate: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.certs[domain] = &cert
+	return nil
+}
+
+// certPath is the cache file of the domain's key and chain; "*" does not
+// belong in file names.
+func (m *Manager) certPath(domain string) string {
+	return filepath.Join(m.cfg.CacheDir, strings.ReplaceAll(domain, "*", "_")+".pem")
+}
+
+func loadAccountKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid ACME account key in %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read ACME account key: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, fmt.Errorf("failed to save ACME account key: %w", err)
+	}
+	return key, nil
+}
+
+// writeFile replaces path with data through a temporary file, so a crash
+// never leaves half a key behind.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,180 @@
+package acmedns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Doer sends the provider API requests; *outbound.Client is one.
+type Doer interface {
+	Do(purpose string, req *http.Request) (*http.Response, error)
+}
+
+// CloudflareURL is the base of Cloudflare's v4 API.
+const CloudflareURL = "https://api.cloudflare.com/client/v4"
+
+// Cloudflare publishes the records in the Cloudflare zone that holds them,
+// with an API token allowed to edit DNS in that zone.
+type Cloudflare struct {
+	baseURL string
+	token   string
+	client  Doer
+}
+
+// NewCloudflare creates the provider; baseURL is CloudflareURL for
+// Cloudflare itself.
+func NewCloudflare(baseURL, token string, client Doer) *Cloudflare {
+	return &Cloudflare{baseURL: strings.TrimRight(baseURL, "/"), token: token, client: client}
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+func (p *Cloudflare) Present(ctx context.Context, fqdn, value string) error {
+	zoneID, err := p.zoneID(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	record := cloudflareRecord{Type: "TXT", Name: fqdn, Content: value, TTL: 120}
+	return p.call(ctx, http.MethodPost, "/zones/"+zoneID+"/dns_records", record, nil)
+}
+
+func (p *Cloudflare) CleanUp(ctx context.Context, fqdn, value string) error {
+	zoneID, err := p.zoneID(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"type": {"TXT"}, "name": {fqdn}, "content": {value}}
+	var records []cloudflareRecord
+	if err := p.call(ctx, http.MethodGet, "/zones/"+zoneID+"/dns_records?"+query.Encode(), nil, &records); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := p.call(ctx, http.MethodDelete, "/zones/"+zoneID+"/dns_records/"+record.ID, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zoneID finds the zone of fqdn by trying its parent names, longest
+// first.
+func (p *Cloudflare) zoneID(ctx context.Context, fqdn string) (string, error) {
+	labels := strings.Split(fqdn, ".")
+	for i := 1; i < len(labels)-1; i++ {
+		var zones []struct {
+			ID string `json:"id"`
+		}
+		name := strings.Join(labels[i:], ".")
+		if err := p.call(ctx, http.MethodGet, "/zones?"+url.Values{"name": {name}}.Encode(), nil, &zones); err != nil {
+			return "", err
+		}
+		if len(zones) > 0 {
+			return zones[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("no Cloudflare zone holds %s", fqdn)
+}
+
+// call sends one API request and decodes the result of the response
+// envelope into out when it is not nil.
+func (p *Cloudflare) call(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.client.Do("acme_dns", req)
+	if err != nil {
+		return fmt.Errorf("cloudflare %s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	var envelope struct {
+		Success bool            `json:"success"`
+		Result  json.RawMessage `json:"result"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil || !envelope.Success {
+		message := resp.Status
+		for _, e := range envelope.Errors {
+			message += ": " + e.Message
+		}
+		return fmt.Errorf("cloudflare %s %s failed: %s", method, path, message)
+	}
+	if out != nil {
+		return json.Unmarshal(envelope.Result, out)
+	}
+	return nil
+}
+
+// Webhook leaves the records to a service of the operator's: it posts
+// {"fqdn": ..., "value": ...} to {URL}/present and {URL}/cleanup, with
+// "Authorization: Bearer <token>" when a token is set, and expects a 2xx
+// answer once the record is published or removed.
+type Webhook struct {
+	url    string
+	token  string
+	client Doer
+}
+
+func NewWebhook(url, token string, client Doer) *Webhook {
+	return &Webhook{url: strings.TrimRight(url, "/"), token: token, client: client}
+}
+
+func (p *Webhook) Present(ctx context.Context, fqdn, value string) error {
+	return p.post(ctx, "/present", fqdn, value)
+}
+
+func (p *Webhook) CleanUp(ctx context.Context, fqdn, value string) error {
+	return p.post(ctx, "/cleanup", fqdn, value)
+}
+
+func (p *Webhook) post(ctx context.Context, path, fqdn, value string) error {
+	data, err := json.Marshal(map[string]string{"fqdn": fqdn, "value": value})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do("acme_dns", req)
+	if err != nil {
+		return fmt.Errorf("dns webhook %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("dns webhook %s failed: %s", path, resp.Status)
+	}
+	return nil
+}
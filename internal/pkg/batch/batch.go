@@ -0,0 +1,101 @@
+// Package batch coalesces many small writes into a few large ones: items
+// are gathered in memory and handed over together once enough have arrived
+// or a flush interval has passed, whichever comes first.
+package batch
+
+import (
+	"sync"
+	"time"
+)
+
+// Batcher gathers items and passes them to its flush function in batches.
+// flush runs on the goroutine that filled the batch or on the batcher's
+// timer, so it should hand the work off rather than block.
+type Batcher[T any] struct {
+	size  int
+	flush func([]T)
+
+	mu      sync.Mutex
+	items   []T
+	stopped bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New starts a batcher that flushes every size items and every interval;
+// size and interval must be positive.
+func New[T any](size int, interval time.Duration, flush func([]T)) *Batcher[T] {
+	b := &Batcher[T]{size: size, flush: flush, done: make(chan struct{})}
+	b.wg.Add(1)
+	go b.tick(interval)
+	return b
+}
+
+func (b *Batcher[T]) tick(interval time.Duration) {
+	defer b.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.Flush()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// Add queues item, flushing the batch when it is full. After Stop the item
+// is flushed on its own so that nothing is lost.
+func (b *Batcher[T]) Add(item T) {
+	b.mu.Lock()
+	if b.stopped {
+		b.mu.Unlock()
+		b.flush([]T{item})
+		return
+	}
+	b.items = append(b.items, item)
+	var full []T
+	if len(b.items) >= b.size {
+		full = b.take()
+	}
+	b.mu.Unlock()
+	if full != nil {
+		b.flush(full)
+	}
+}
+
+// Flush hands over the items gathered so far, if any.
+func (b *Batcher[T]) Flush() {
+	b.mu.Lock()
+	items := b.take()
+	b.mu.Unlock()
+	if items != nil {
+		b.flush(items)
+	}
+}
+
+// take empties the batch; b.mu must be held.
+func (b *Batcher[T]) take() []T {
+	if len(b.items) == 0 {
+		return nil
+	}
+	items := b.items
+	b.items = nil
+	return items
+}
+
+// Stop ends the timer and flushes what is left. It is safe to call more
+// than once.
+func (b *Batcher[T]) Stop() {
+	b.mu.Lock()
+	if b.stopped {
+		b.mu.Unlock()
+		return
+	}
+	b.stopped = true
+	close(b.done)
+	b.mu.Unlock()
+	b.wg.Wait()
+	b.Flush()
+}
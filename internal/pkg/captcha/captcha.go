@@ -0,0 +1,98 @@
+// Package captcha checks the responses of CAPTCHA widgets with the provider
+// that served them. hCaptcha, Cloudflare Turnstile and reCAPTCHA share the
+// same siteverify protocol: the secret and the widget's response are
+// posted as a form and the answer is JSON with a success flag.
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Providers, as CAPTCHA_PROVIDER names them.
+const (
+	ProviderHCaptcha  = "hcaptcha"
+	ProviderTurnstile = "turnstile"
+	ProviderReCAPTCHA = "recaptcha"
+)
+
+var verifyURLs = map[string]string{
+	ProviderHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	ProviderTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+	ProviderReCAPTCHA: "https://www.google.com/recaptcha/api/siteverify",
+}
+
+// ErrFailed is returned for a missing, invalid, expired or reused
+// response, and for a reCAPTCHA v3 score below the minimum.
+var ErrFailed = errors.New("captcha verification failed")
+
+// Verifier checks the response token of a CAPTCHA widget. Errors other than
+// ErrFailed mean the provider could not be asked.
+type Verifier interface {
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+// Poster sends the verification request; *outbound.Client is one.
+type Poster interface {
+	Post(ctx context.Context, purpose, url, contentType string, body io.Reader) (*http.Response, error)
+}
+
+// SiteVerify is a Verifier for the siteverify protocol. Responses with a
+// score (reCAPTCHA v3) pass only from MinScore on.
+type SiteVerify struct {
+	URL      string
+	Secret   string
+	MinScore float64
+	Client   Poster
+}
+
+// New returns the Verifier of provider, one of the Provider constants.
+func New(provider, secret string, minScore float64, client Poster) (*SiteVerify, error) {
+	verifyURL, ok := verifyURLs[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown captcha provider %q", provider)
+	}
+	return &SiteVerify{URL: verifyURL, Secret: secret, MinScore: minScore, Client: client}, nil
+}
+
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	Score      *float64 `json:"score"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+func (v *SiteVerify) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return fmt.Errorf("%w: no response token", ErrFailed)
+	}
+	form := url.Values{"secret": {v.Secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	resp, err := v.Client.Post(ctx, "captcha", v.URL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("captcha verification request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha verification answered %s", resp.Status)
+	}
+
+	var result siteVerifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("captcha verification response: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%w: %s", ErrFailed, strings.Join(result.ErrorCodes, ", "))
+	}
+	if result.Score != nil && *result.Score < v.MinScore {
+		return fmt.Errorf("%w: score %.1f below %.1f", ErrFailed, *result.Score, v.MinScore)
+	}
+	return nil
+}
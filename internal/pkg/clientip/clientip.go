@@ -0,0 +1,169 @@
+// Package clientip determines the address of the client that originated a
+// request, honouring forwarding headers only when they were added by a
+// trusted proxy.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type contextKey struct{}
+
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+// NewResolver parses a list of trusted proxy CIDRs. Bare IP addresses are
+// accepted and treated as single-host networks.
+func NewResolver(cidrs []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, raw := range cidrs {
+		if !strings.Contains(raw, "/") {
+			if ip := net.ParseIP(raw); ip != nil && ip.To4() != nil {
+				raw += "/32"
+			} else {
+				raw += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", raw, err)
+		}
+		r.trusted = append(r.trusted, network)
+	}
+	return r, nil
+}
+
+// unixPeer is the address of the peer of a connection over a unix socket.
+// Only processes on this machine that the socket's permissions let in can
+// connect, so such a peer is the local proxy and is trusted like one.
+const unixPeer = "@"
+
+func (r *Resolver) isTrusted(ip net.IP) bool {
+	for _, network := range r.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the client IP for the request. Forwarding headers are only
+// consulted when the direct peer is a trusted proxy; X-Forwarded-For is
+// walked from the right, skipping trusted hops, so a client cannot spoof its
+// address by sending the header itself.
+func (r *Resolver) Resolve(req *http.Request) string {
+	peer := remoteHost(req.RemoteAddr)
+	if !r.trustedPeer(peer) {
+		return peer
+	}
+
+	if ip := r.fromChain(splitForwardedFor(req.Header.Values("X-Forwarded-For"))); ip != "" {
+		return ip
+	}
+	if ip := net.ParseIP(strings.TrimSpace(req.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	if ip := r.fromChain(parseForwarded(req.Header.Values("Forwarded"))); ip != "" {
+		return ip
+	}
+	return peer
+}
+
+// FromTrustedProxy reports whether the direct peer of req is a trusted
+// proxy, so headers that proxy sets can be believed.
+func (r *Resolver) FromTrustedProxy(req *http.Request) bool {
+	return r.trustedPeer(remoteHost(req.RemoteAddr))
+}
+
+func (r *Resolver) trustedPeer(peer string) bool {
+	if peer == unixPeer {
+		return true
+	}
+	ip := net.ParseIP(peer)
+	return ip != nil && r.isTrusted(ip)
+}
+
+func (r *Resolver) fromChain(hops []string) string {
+	var leftmost string
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			// An unparseable hop means the chain can't be trusted any further.
+			break
+		}
+		leftmost = ip.String()
+		if !r.isTrusted(ip) {
+			return leftmost
+		}
+	}
+	return leftmost
+}
+
+// Middleware resolves the client IP once per request and stores it in the
+// request context for handlers, rate limiting, analytics and audit logging.
+func (r *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), contextKey{}, r.Resolve(req))
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// FromRequest returns the IP stored by Middleware, falling back to the
+// direct peer address when the middleware is not installed.
+func FromRequest(req *http.Request) string {
+	if ip, ok := req.Context().Value(contextKey{}).(string); ok && ip != "" {
+		return ip
+	}
+	return remoteHost(req.RemoteAddr)
+}
+
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+func splitForwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, hop := range strings.Split(v, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+// parseForwarded extracts the for= parameters of RFC 7239 Forwarded headers.
+func parseForwarded(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(key, "for") {
+					continue
+				}
+				value = strings.Trim(value, `"`)
+				if strings.HasPrefix(value, "[") {
+					// [2001:db8::1]:4711
+					if end := strings.Index(value, "]"); end > 0 {
+						value = value[1:end]
+					}
+				} else if host, _, err := net.SplitHostPort(value); err == nil {
+					value = host
+				}
+				hops = append(hops, value)
+			}
+		}
+	}
+	return hops
+}
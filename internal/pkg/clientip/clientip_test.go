@@ -0,0 +1,69 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	resolver, err := NewResolver([]string{"10.0.0.0/8", "192.0.2.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name      string
+		peer      string
+		forwarded []string
+		realIP    string
+		want      string
+	}{
+		{"direct client", "198.51.100.1:1234", nil, "", "198.51.100.1"},
+		{"header from untrusted peer", "198.51.100.1:1234", []string{"203.0.113.9"}, "", "198.51.100.1"},
+		{"real ip from untrusted peer", "198.51.100.1:1234", nil, "203.0.113.9", "198.51.100.1"},
+		{"trusted proxy", "10.0.0.2:80", []string{"203.0.113.9"}, "", "203.0.113.9"},
+		{"spoofed hop before the client", "10.0.0.2:80", []string{"1.2.3.4, 203.0.113.9"}, "", "203.0.113.9"},
+		{"spoofed hop in a separate header", "10.0.0.2:80", []string{"1.2.3.4", "203.0.113.9"}, "", "203.0.113.9"},
+		{"chain of trusted proxies", "10.0.0.2:80", []string{"1.2.3.4, 203.0.113.9, 192.0.2.7, 10.0.0.3"}, "", "203.0.113.9"},
+		{"spoofed trusted address", "10.0.0.2:80", []string{"10.9.9.9, 203.0.113.9"}, "", "203.0.113.9"},
+		{"garbage hop", "10.0.0.2:80", []string{"203.0.113.9, not-an-ip, 10.0.0.3"}, "", "10.0.0.3"},
+		{"only trusted hops", "10.0.0.2:80", []string{"10.0.0.3"}, "", "10.0.0.3"},
+		{"real ip from trusted peer", "10.0.0.2:80", nil, "203.0.113.9", "203.0.113.9"},
+		{"bad real ip", "10.0.0.2:80", nil, "evil", "10.0.0.2"},
+		{"unix socket peer", "@", []string{"1.2.3.4, 203.0.113.9"}, "", "203.0.113.9"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.peer
+		for _, v := range tt.forwarded {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		if tt.realIP != "" {
+			req.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := resolver.Resolve(req); got != tt.want {
+			t.Errorf("%s: Resolve = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveForwarded(t *testing.T) {
+	resolver, err := NewResolver([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		forwarded, want string
+	}{
+		{`for=203.0.113.9`, "203.0.113.9"},
+		{`for=1.2.3.4, for="203.0.113.9:4711";proto=https`, "203.0.113.9"},
+		{`for="[2001:db8::1]:4711"`, "2001:db8::1"},
+		{`for=1.2.3.4, for=_hidden`, "10.0.0.2"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.2:80"
+		req.Header.Set("Forwarded", tt.forwarded)
+		if got := resolver.Resolve(req); got != tt.want {
+			t.Errorf("Resolve with Forwarded: %s = %q, want %q", tt.forwarded, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package cron
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobFunc is the work of one run. now is the scheduled time of the run,
+// without jitter.
+type JobFunc func(now time.Time) error
+
+// JobStatus describes a job and the outcome of its last run.
+type JobStatus struct {
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	Enabled      bool       `json:"enabled"`
+	Running      bool       `json:"running"`
+	LastStart    *time.Time `json:"last_start,omitempty"`
+	LastDuration string     `json:"last_duration,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	NextRun      *time.Time `json:"next_run,omitempty"`
+	Runs         int64      `json:"runs"`
+	Failures     int64      `json:"failures"`
+	Skipped      int64      `json:"skipped"`
+}
+
+type job struct {
+	name     string
+	spec     string
+	schedule Schedule
+	fn       JobFunc
+	enabled  bool
+
+	running      bool
+	lastStart    time.Time
+	lastDuration time.Duration
+	lastError    string
+	nextRun      time.Time
+	runs         int64
+	failures     int64
+	skipped      int64
+}
+
+// Scheduler runs named jobs on their schedules. A run that is still going
+// when the next one is due makes the scheduler skip that run, so a job never
+// overlaps itself. Each run may be delayed by a random jitter up to the
+// configured maximum to spread load across instances.
+type Scheduler struct {
+	jitter time.Duration
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	started bool
+	stopped bool
+}
+
+func New(jitter time.Duration) *Scheduler {
+	return &Scheduler{jitter: jitter, jobs: make(map[string]*job)}
+}
+
+// Add registers a job. It must be called before Start.
+func (s *Scheduler) Add(name, spec string, fn JobFunc) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return fmt.Errorf("job %s: scheduler already started", name)
+	}
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("job %s: already registered", name)
+	}
+	s.jobs[name] = &job{name: name, spec: spec, schedule: schedule, fn: fn, enabled: true}
+	return nil
+}
+
+// Disable keeps a registered job from running; it is still listed by
+// Status. Unknown names are reported as an error.
+func (s *Scheduler) Disable(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[name]
+	if !ok {
+		return fmt.Errorf("unknown job %s", name)
+	}
+	j.enabled = false
+	return nil
+}
+
+// Start runs every enabled job until stop is called. stop waits for the
+// runs in progress to finish.
+func (s *Scheduler) Start() (stop func()) {
+	s.mu.Lock()
+	s.started = true
+	var jobs []*job
+	for _, j := range s.jobs {
+		if j.enabled {
+			jobs = append(jobs, j)
+		}
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	var loops, runs sync.WaitGroup
+	for _, j := range jobs {
+		loops.Add(1)
+		go func() {
+			defer loops.Done()
+			s.loop(j, done, &runs)
+		}()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			s.stopped = true
+			s.mu.Unlock()
+			close(done)
+			loops.Wait()
+			runs.Wait()
+		})
+	}
+}
+
+// Running reports whether Start has been called and its stop has not.
+func (s *Scheduler) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started && !s.stopped
+}
+
+func (s *Scheduler) loop(j *job, done <-chan struct{}, runs *sync.WaitGroup) {
+	for {
+		next := j.schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("Scheduler job %s has no upcoming runs", j.name)
+			return
+		}
+		s.mu.Lock()
+		j.nextRun = next
+		s.mu.Unlock()
+
+		delay := time.Until(next)
+		if s.jitter > 0 {
+			delay += rand.N(s.jitter)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.mu.Lock()
+		if j.running {
+			j.skipped++
+			s.mu.Unlock()
+			log.Printf("Scheduler skipped job %s: previous run still in progress", j.name)
+			continue
+		}
+		j.running = true
+		s.mu.Unlock()
+
+		runs.Add(1)
+		go func() {
+			defer runs.Done()
+			s.run(j, next)
+		}()
+	}
+}
+
+func (s *Scheduler) run(j *job, scheduled time.Time) {
+	start := time.Now()
+	err := func() (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("panic: %v", p)
+			}
+		}()
+		return j.fn(scheduled)
+	}()
+	elapsed := time.Since(start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.running = false
+	j.lastStart = start
+	j.lastDuration = elapsed
+	j.runs++
+	j.lastError = ""
+	if err != nil {
+		j.failures++
+		j.lastError = err.Error()
+		log.Printf("Scheduler job %s failed after %s: %v", j.name, elapsed.Round(time.Millisecond), err)
+	}
+}
+
+// Status returns the state of every registered job, sorted by name.
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		st := JobStatus{
+			Name:      j.name,
+			Schedule:  j.spec,
+			Enabled:   j.enabled,
+			Running:   j.running,
+			LastError: j.lastError,
+			Runs:      j.runs,
+			Failures:  j.failures,
+			Skipped:   j.skipped,
+		}
+		if !j.lastStart.IsZero() {
+			t := j.lastStart.UTC()
+			st.LastStart = &t
+			st.LastDuration = j.lastDuration.Round(time.Millisecond).String()
+		}
+		if j.enabled && s.started && !j.nextRun.IsZero() {
+			t := j.nextRun.UTC()
+			st.NextRun = &t
+		}
+		statuses = append(statuses, st)
+	}
+	sort.Slice(statuses, func(i, k int) bool { return statuses[i].Name < statuses[k].Name })
+	return statuses
+}
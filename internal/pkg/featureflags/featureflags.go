@@ -0,0 +1,208 @@
+// Package featureflags evaluates the switches that gate experimental
+// behavior. Every flag has a built-in default, which FEATURE_FLAGS can
+// change for a deployment and the admin API can override at runtime.
+package featureflags
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ReadableCodes generates short codes without look-alike characters
+	// (0/O, 1/l/I), for links that are read aloud or printed.
+	ReadableCodes = "readable_codes"
+	// AnalyticsV2 stores only the origin of the referrer with each click,
+	// keeping paths and query strings (and the personal data in them) out
+	// of the click log.
+	AnalyticsV2 = "analytics_v2"
+	// Interstitials serves the retargeting page for links with pixels;
+	// when off those links redirect directly.
+	Interstitials = "interstitials"
+)
+
+const (
+	SourceDefault  = "default"
+	SourceConfig   = "config"
+	SourceDatabase = "database"
+)
+
+// Flag is the state of one flag. Enabled flags are on for Rollout percent of
+// keys, and only in Environments when that list is not empty.
+type Flag struct {
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	Enabled      bool       `json:"enabled"`
+	Rollout      int        `json:"rollout"`
+	Environments []string   `json:"environments,omitempty"`
+	Source       string     `json:"source"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+}
+
+var known = []Flag{
+	{Name: ReadableCodes, Description: "Generate short codes without look-alike characters", Rollout: 100, Source: SourceDefault},
+	{Name: AnalyticsV2, Description: "Store only the referrer origin with each click", Rollout: 100, Source: SourceDefault},
+	{Name: Interstitials, Description: "Serve the retargeting interstitial for links with pixels", Enabled: true, Rollout: 100, Source: SourceDefault},
+}
+
+// Known reports whether name is a flag the code checks.
+func Known(name string) bool {
+	return slices.ContainsFunc(known, func(f Flag) bool { return f.Name == name })
+}
+
+// Validate checks the fields of a flag set through the admin API.
+func Validate(flag Flag) error {
+	if !Known(flag.Name) {
+		return fmt.Errorf("unknown flag %q", flag.Name)
+	}
+	if flag.Rollout < 0 || flag.Rollout > 100 {
+		return fmt.Errorf("rollout must be between 0 and 100")
+	}
+	for _, env := range flag.Environments {
+		if strings.TrimSpace(env) == "" {
+			return fmt.Errorf("environments must not contain empty names")
+		}
+	}
+	return nil
+}
+
+// ParseConfig reads FEATURE_FLAGS: comma-separated name=on, name=off or
+// name=NN% entries, where a percentage turns the flag on for that rollout.
+func ParseConfig(raw string) ([]Flag, error) {
+	var flags []Flag
+	for _, entry := range strings.Split(raw, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		value = strings.ToLower(strings.TrimSpace(value))
+		if !ok || !Known(name) {
+			return nil, fmt.Errorf("invalid feature flag %q", entry)
+		}
+		flag := Flag{Name: name, Source: SourceConfig}
+		switch {
+		case value == "on" || value == "true":
+			flag.Enabled, flag.Rollout = true, 100
+		case value == "off" || value == "false":
+		case strings.HasSuffix(value, "%"):
+			pct, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+			if err != nil || pct < 0 || pct > 100 {
+				return nil, fmt.Errorf("invalid rollout in feature flag %q", entry)
+			}
+			flag.Enabled, flag.Rollout = true, pct
+		default:
+			return nil, fmt.Errorf("invalid feature flag %q (expected on, off or a percentage)", entry)
+		}
+		flags = append(flags, flag)
+	}
+	return flags, nil
+}
+
+// Set is the flag state of one process. The zero value and a nil *Set
+// answer with the built-in defaults.
+type Set struct {
+	environment string
+	base        map[string]Flag
+	current     atomic.Pointer[map[string]Flag]
+}
+
+// New builds a Set for environment from the built-in defaults with config
+// applied on top.
+func New(environment string, config []Flag) *Set {
+	base := make(map[string]Flag, len(known))
+	for _, f := range known {
+		base[f.Name] = f
+	}
+	for _, f := range config {
+		f.Description = base[f.Name].Description
+		base[f.Name] = f
+	}
+	s := &Set{environment: environment, base: base}
+	s.Override(nil)
+	return s
+}
+
+// Override replaces the runtime overrides (the database rows) in one step.
+// Flags without an override fall back to their config or default state.
+func (s *Set) Override(overrides []Flag) {
+	flags := make(map[string]Flag, len(s.base))
+	for name, f := range s.base {
+		flags[name] = f
+	}
+	for _, f := range overrides {
+		if base, ok := s.base[f.Name]; ok {
+			f.Description = base.Description
+			f.Source = SourceDatabase
+			flags[f.Name] = f
+		}
+	}
+	s.current.Store(&flags)
+}
+
+func (s *Set) flag(name string) (Flag, bool) {
+	if s == nil || s.current.Load() == nil {
+		for _, f := range known {
+			if f.Name == name {
+				return f, true
+			}
+		}
+		return Flag{}, false
+	}
+	f, ok := (*s.current.Load())[name]
+	return f, ok
+}
+
+// Enabled reports whether the flag is on for key. The same key always lands
+// on the same side of a partial rollout; an empty key is bucketed at random
+// on every call.
+func (s *Set) Enabled(name, key string) bool {
+	f, ok := s.flag(name)
+	if !ok || !f.Enabled {
+		return false
+	}
+	if len(f.Environments) > 0 && (s == nil || !slices.Contains(f.Environments, s.environment)) {
+		return false
+	}
+	if f.Rollout >= 100 {
+		return true
+	}
+	if f.Rollout <= 0 {
+		return false
+	}
+	return bucket(name, key) < f.Rollout
+}
+
+func bucket(name, key string) int {
+	if key == "" {
+		return rand.IntN(100)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name + "/" + key))
+	return int(h.Sum32() % 100)
+}
+
+// List returns every flag's effective state, sorted by name.
+func (s *Set) List() []Flag {
+	flags := make([]Flag, 0, len(known))
+	for _, k := range known {
+		f, _ := s.flag(k.Name)
+		flags = append(flags, f)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags
+}
+
+func (s *Set) Environment() string {
+	if s == nil {
+		return ""
+	}
+	return s.environment
+}
@@ -0,0 +1,165 @@
+// Package fieldcrypt encrypts individual database values with AES-256-GCM.
+// An encrypted value is stored as "enc:v1:<key id>:<base64 nonce and
+// ciphertext>", so values written before encryption was enabled, which lack
+// the prefix, are still read as they are, and values written under an older
+// key are found by its id while keys are rotated.
+//
+// Random nonces make equal plaintexts encrypt differently. Columns that are
+// searched by value keep a blind index next to them: an HMAC of the
+// plaintext under a key derived from the encryption key.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the length of an AES-256 key in bytes.
+const KeySize = 32
+
+const prefix = "enc:v1:"
+
+var (
+	ErrUnknownKey = errors.New("value is encrypted with an unknown key")
+	ErrCorrupt    = errors.New("encrypted value is corrupt")
+)
+
+type key struct {
+	id   string
+	aead cipher.AEAD
+	// index is the key of the blind index HMAC.
+	index []byte
+}
+
+// Cipher encrypts with its primary key and decrypts with any of its keys.
+type Cipher struct {
+	primary *key
+	keys    map[string]*key
+}
+
+// New returns a Cipher that encrypts with primary and can still decrypt
+// values encrypted with any of old. Keys are KeySize raw bytes.
+func New(primary []byte, old ...[]byte) (*Cipher, error) {
+	c := &Cipher{keys: make(map[string]*key)}
+	for i, raw := range append([][]byte{primary}, old...) {
+		k, err := newKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			c.primary = k
+		}
+		c.keys[k.id] = k
+	}
+	return c, nil
+}
+
+// ParseKey decodes a base64 (standard or URL alphabet) or hex encoded key.
+func ParseKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	for _, decode := range []func(string) ([]byte, error){
+		base64.StdEncoding.DecodeString,
+		base64.URLEncoding.DecodeString,
+		base64.RawStdEncoding.DecodeString,
+		base64.RawURLEncoding.DecodeString,
+		hex.DecodeString,
+	} {
+		if raw, err := decode(encoded); err == nil && len(raw) == KeySize {
+			return raw, nil
+		}
+	}
+	return nil, fmt.Errorf("encryption key must be %d bytes encoded in base64 or hex", KeySize)
+}
+
+func newKey(raw []byte) (*key, error) {
+	if len(raw) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(raw))
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	index := hmac.New(sha256.New, raw)
+	index.Write([]byte("fieldcrypt blind index"))
+	return &key{id: hex.EncodeToString(sum[:4]), aead: aead, index: index.Sum(nil)}, nil
+}
+
+// Encrypt returns the stored form of plaintext under the primary key.
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, c.primary.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.primary.aead.Seal(nonce, nonce, []byte(plaintext), []byte(c.primary.id))
+	return prefix + c.primary.id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of a stored value. Values without the
+// encryption prefix are returned unchanged.
+func (c *Cipher) Decrypt(stored string) (string, error) {
+	rest, ok := strings.CutPrefix(stored, prefix)
+	if !ok {
+		return stored, nil
+	}
+	id, data, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", ErrCorrupt
+	}
+	k := c.keys[id]
+	if k == nil {
+		return "", fmt.Errorf("%w %s", ErrUnknownKey, id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil || len(sealed) < k.aead.NonceSize() {
+		return "", ErrCorrupt
+	}
+	nonce, ciphertext := sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():]
+	plaintext, err := k.aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	return string(plaintext), nil
+}
+
+// Current reports whether stored is encrypted with the primary key, that
+// is, whether re-encryption would leave it alone.
+func (c *Cipher) Current(stored string) bool {
+	return strings.HasPrefix(stored, prefix+c.primary.id+":")
+}
+
+// BlindIndex returns the blind index of plaintext under the primary key.
+func (c *Cipher) BlindIndex(plaintext string) string {
+	return blindIndex(c.primary, plaintext)
+}
+
+// BlindIndexes returns the blind index of plaintext under every key,
+// primary first, to find values whose index has not been rewritten since
+// the keys were rotated.
+func (c *Cipher) BlindIndexes(plaintext string) []string {
+	indexes := []string{c.BlindIndex(plaintext)}
+	for id, k := range c.keys {
+		if id != c.primary.id {
+			indexes = append(indexes, blindIndex(k, plaintext))
+		}
+	}
+	return indexes
+}
+
+func blindIndex(k *key, plaintext string) string {
+	m := hmac.New(sha256.New, k.index)
+	m.Write([]byte(plaintext))
+	return base64.RawStdEncoding.EncodeToString(m.Sum(nil))
+}
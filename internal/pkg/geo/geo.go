@@ -0,0 +1,157 @@
+// Package geo tells which country a request comes from, for links that are
+// only available in some countries. Countries are ISO 3166-1 alpha-2 codes
+// in upper case; an empty string means the country is unknown.
+package geo
+
+import (
+	"bufio"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	"template/internal/pkg/clientip"
+)
+
+// Locator finds the country of a request.
+type Locator interface {
+	Country(r *http.Request) string
+}
+
+// Chain asks each locator in turn and returns the first country found.
+type Chain []Locator
+
+func (c Chain) Country(r *http.Request) string {
+	for _, locator := range c {
+		if country := locator.Country(r); country != "" {
+			return country
+		}
+	}
+	return ""
+}
+
+// Header reads the country from a request header set by a proxy or CDN in
+// front of the service, such as Cloudflare's CF-IPCountry. The header is
+// only believed when trusted reports that the request came through that
+// proxy, since clients can send it themselves.
+type Header struct {
+	Name    string
+	Trusted func(r *http.Request) bool
+}
+
+func (h Header) Country(r *http.Request) string {
+	if h.Trusted != nil && !h.Trusted(r) {
+		return ""
+	}
+	return Normalize(r.Header.Get(h.Name))
+}
+
+// Normalize returns code in upper case if it is two ASCII letters, and ""
+// otherwise. Codes proxies use for unknown or anonymous clients, such as
+// XX and T1, are returned as they are and simply match no rule.
+func Normalize(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return ""
+	}
+	return code
+}
+
+type ipRange struct {
+	first, last netip.Addr
+	country     string
+}
+
+// Ranges is an IP to country database loaded from a CSV file.
+type Ranges struct {
+	ranges []ipRange
+}
+
+// LoadRanges reads a CSV file whose rows start with the first address,
+// the last address and the country of a range, as in the free DB-IP and
+// IP2Location LITE country databases. Addresses may be written as IPv4 or
+// IPv6 addresses or as decimal numbers; further columns are ignored.
+func LoadRanges(path string) (*Ranges, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	db := &Ranges{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) < 3 {
+			continue
+		}
+		first, err1 := parseAddr(fields[0])
+		last, err2 := parseAddr(fields[1])
+		if err1 != nil || err2 != nil {
+			if line == 1 {
+				// A header row.
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: invalid address range", path, line)
+		}
+		if first.Is4() != last.Is4() || last.Less(first) {
+			return nil, fmt.Errorf("%s:%d: invalid address range", path, line)
+		}
+		if country := Normalize(strings.Trim(fields[2], `" `)); country != "" {
+			db.ranges = append(db.ranges, ipRange{first: first, last: last, country: country})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(db.ranges, func(i, j int) bool { return db.ranges[i].first.Less(db.ranges[j].first) })
+	return db, nil
+}
+
+// parseAddr parses an address or a decimal number, which is an IPv4
+// address when it fits in 32 bits and an IPv6 address otherwise.
+func parseAddr(field string) (netip.Addr, error) {
+	field = strings.Trim(field, `" `)
+	if addr, err := netip.ParseAddr(field); err == nil {
+		return addr.Unmap(), nil
+	}
+	n, ok := new(big.Int).SetString(field, 10)
+	if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+		return netip.Addr{}, fmt.Errorf("invalid address %q", field)
+	}
+	if n.BitLen() <= 32 {
+		v := n.Uint64()
+		return netip.AddrFrom4([4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}), nil
+	}
+	var b [16]byte
+	n.FillBytes(b[:])
+	return netip.AddrFrom16(b).Unmap(), nil
+}
+
+// Len returns the number of ranges loaded.
+func (db *Ranges) Len() int {
+	return len(db.ranges)
+}
+
+// Lookup returns the country of addr, or "" when no range holds it.
+func (db *Ranges) Lookup(addr netip.Addr) string {
+	addr = addr.Unmap()
+	// The last range starting at or before addr is the only candidate.
+	i := sort.Search(len(db.ranges), func(i int) bool { return addr.Less(db.ranges[i].first) }) - 1
+	if i < 0 || db.ranges[i].last.Less(addr) || db.ranges[i].first.Is4() != addr.Is4() {
+		return ""
+	}
+	return db.ranges[i].country
+}
+
+// Country looks up the client address of r (see clientip).
+func (db *Ranges) Country(r *http.Request) string {
+	addr, err := netip.ParseAddr(clientip.FromRequest(r))
+	if err != nil {
+		return ""
+	}
+	return db.Lookup(addr)
+}
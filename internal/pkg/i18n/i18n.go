@@ -0,0 +1,144 @@
+// Package i18n provides message catalogs embedded in the binary and
+// Accept-Language negotiation. English is the fallback for missing keys.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+type Catalog struct {
+	messages map[string]map[string]string
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultCatalog *Catalog
+)
+
+// Default returns the catalog built from the embedded locale files. The
+// files are part of the binary, so a parse failure is a programming error.
+func Default() *Catalog {
+	defaultOnce.Do(func() {
+		c, err := load()
+		if err != nil {
+			panic(err)
+		}
+		defaultCatalog = c
+	})
+	return defaultCatalog
+}
+
+func load() (*Catalog, error) {
+	entries, err := localeFS.ReadDir("locales")
+	if err != nil {
+		return nil, err
+	}
+	c := &Catalog{messages: make(map[string]map[string]string)}
+	for _, entry := range entries {
+		raw, err := localeFS.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(raw, &messages); err != nil {
+			return nil, fmt.Errorf("i18n: invalid catalog %s: %w", entry.Name(), err)
+		}
+		c.messages[strings.TrimSuffix(entry.Name(), ".json")] = messages
+	}
+	return c, nil
+}
+
+// Languages lists the languages that have a catalog.
+func (c *Catalog) Languages() []string {
+	langs := make([]string, 0, len(c.messages))
+	for lang := range c.messages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+func (c *Catalog) Supports(lang string) bool {
+	_, ok := c.messages[lang]
+	return ok
+}
+
+// Lookup returns the message for key in lang, falling back to English.
+func (c *Catalog) Lookup(lang, key string) (string, bool) {
+	if msg, ok := c.messages[lang][key]; ok {
+		return msg, true
+	}
+	msg, ok := c.messages[DefaultLanguage][key]
+	return msg, ok
+}
+
+// T formats the message for key in lang; the key itself is returned when no
+// catalog has it so a missing translation is visible but harmless.
+func (c *Catalog) T(lang, key string, args ...interface{}) string {
+	msg, ok := c.Lookup(lang, key)
+	if !ok {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// Negotiate picks the best supported language from an Accept-Language
+// header. Only the primary subtag is compared ("ru-RU" matches "ru").
+func (c *Catalog) Negotiate(acceptLanguage string) string {
+	for _, tag := range ParseAcceptLanguage(acceptLanguage) {
+		primary, _, _ := strings.Cut(tag, "-")
+		if c.Supports(primary) {
+			return primary
+		}
+	}
+	return DefaultLanguage
+}
+
+// ParseAcceptLanguage returns the lower-cased language tags of an
+// Accept-Language header in order of preference, dropping those with q=0
+// and the "*" wildcard.
+func ParseAcceptLanguage(acceptLanguage string) []string {
+	type candidate struct {
+		tag string
+		q   float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{tag, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	tags := make([]string, len(candidates))
+	for i, cand := range candidates {
+		tags[i] = cand.tag
+	}
+	return tags
+}
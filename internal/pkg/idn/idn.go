@@ -0,0 +1,286 @@
+// Package idn handles internationalized URLs. Destinations are stored in
+// their ASCII form, with the host in punycode and non-ASCII path, query and
+// fragment characters percent-encoded, so that equal URLs compare equal and
+// Location headers stay ASCII. DisplayURL turns them back into the form a
+// person would type, and MixedScripts finds host labels that combine
+// scripts the way homograph (look-alike) domains do.
+package idn
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// NormalizeURL returns rawURL with its host converted to lower-case
+// punycode and every non-ASCII character elsewhere percent-encoded. IP
+// literals are left as they are. It fails for hosts that are not valid
+// internationalized domain names.
+func NormalizeURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	host, err := hostToASCII(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+	u.RawQuery = escapeNonASCII(u.RawQuery)
+	// String percent-encodes the path and fragment.
+	return u.String(), nil
+}
+
+func hostToASCII(host string) (string, error) {
+	if host == "" || net.ParseIP(host) != nil {
+		return host, nil
+	}
+	if isASCII(host) && !strings.Contains(strings.ToLower(host), "xn--") {
+		// Plain ASCII names skip the IDNA rules, which would refuse
+		// underscores and other characters DNS itself accepts.
+		return strings.ToLower(host), nil
+	}
+	if !utf8.ValidString(host) {
+		// ToASCII would encode the bytes as U+FFFD, giving a punycode
+		// label it refuses itself on the next pass.
+		return "", fmt.Errorf("invalid internationalized domain name %q: not valid UTF-8", host)
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid internationalized domain name %q: %w", host, err)
+	}
+	if ascii == "" {
+		return "", fmt.Errorf("invalid internationalized domain name %q", host)
+	}
+	return ascii, nil
+}
+
+// DisplayURL returns the human-readable form of a URL: punycode host labels
+// are decoded and percent-encoded UTF-8 is unescaped. Labels that mix
+// scripts are shown in punycode, as browsers show them, so a look-alike
+// domain is not disguised. Anything that cannot be decoded is returned
+// unchanged.
+func DisplayURL(rawURL string) string {
+	if normalized, err := NormalizeURL(rawURL); err == nil {
+		rawURL = normalized
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	host := u.Hostname()
+	display := rawURL
+	if unicodeHost := displayHost(host); unicodeHost != host {
+		display = strings.Replace(display, host, unicodeHost, 1)
+	}
+	return unescapeUTF8(display)
+}
+
+func displayHost(host string) string {
+	if !strings.Contains(host, "xn--") {
+		return host
+	}
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if !strings.HasPrefix(label, "xn--") {
+			continue
+		}
+		decoded, err := idna.Display.ToUnicode(label)
+		if err != nil {
+			continue
+		}
+		if scripts := labelScripts(decoded); len(scripts) > 1 && !allowedCombination(scripts) {
+			continue
+		}
+		labels[i] = decoded
+	}
+	return strings.Join(labels, ".")
+}
+
+// MixedScripts describes every label of rawURL's host that combines
+// letters from more than one script, such as Latin and Cyrillic in
+// "pаypal" with a Cyrillic "а". Latin mixed with Han, Hiragana, Katakana
+// or Hangul is common in East Asian names and is not reported.
+func MixedScripts(rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	var warnings []string
+	for _, label := range strings.Split(u.Hostname(), ".") {
+		if strings.HasPrefix(label, "xn--") {
+			decoded, err := idna.Punycode.ToUnicode(label)
+			if err != nil {
+				continue
+			}
+			label = decoded
+		}
+		scripts := labelScripts(label)
+		if len(scripts) > 1 && !allowedCombination(scripts) {
+			warnings = append(warnings, fmt.Sprintf("domain label %q mixes %s scripts", label, strings.Join(scripts, " and ")))
+		}
+	}
+	return warnings
+}
+
+// scripts are the scripts labelScripts tells apart; letters from any other
+// script count as "Other".
+var scripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Greek", unicode.Greek},
+	{"Armenian", unicode.Armenian},
+	{"Georgian", unicode.Georgian},
+	{"Cherokee", unicode.Cherokee},
+	{"Arabic", unicode.Arabic},
+	{"Hebrew", unicode.Hebrew},
+	{"Devanagari", unicode.Devanagari},
+	{"Thai", unicode.Thai},
+	{"Han", unicode.Han},
+	{"Hiragana", unicode.Hiragana},
+	{"Katakana", unicode.Katakana},
+	{"Hangul", unicode.Hangul},
+}
+
+// labelScripts lists the scripts of the letters in label, in the order of
+// the scripts table. Digits, hyphens and marks belong to no script.
+func labelScripts(label string) []string {
+	seen := make(map[string]bool)
+	for _, r := range label {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		name := "Other"
+		for _, s := range scripts {
+			if unicode.Is(s.table, r) {
+				name = s.name
+				break
+			}
+		}
+		seen[name] = true
+	}
+	var names []string
+	for _, s := range scripts {
+		if seen[s.name] {
+			names = append(names, s.name)
+		}
+	}
+	if seen["Other"] {
+		names = append(names, "Other")
+	}
+	return names
+}
+
+// allowedCombination reports whether scripts is one of the combinations
+// that Unicode's "highly restrictive" profile (UTS #39) accepts: Latin with
+// Japanese (Han, Hiragana, Katakana) or with Korean (Han, Hangul).
+func allowedCombination(scripts []string) bool {
+	japanese := map[string]bool{"Latin": true, "Han": true, "Hiragana": true, "Katakana": true}
+	korean := map[string]bool{"Latin": true, "Han": true, "Hangul": true}
+	inJapanese, inKorean := true, true
+	for _, s := range scripts {
+		inJapanese = inJapanese && japanese[s]
+		inKorean = inKorean && korean[s]
+	}
+	return inJapanese || inKorean
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// escapeNonASCII percent-encodes the bytes of s that are not printable
+// ASCII, leaving existing escapes and delimiters alone.
+func escapeNonASCII(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// unescapeUTF8 decodes the percent-escapes in s that form printable
+// non-ASCII characters. ASCII escapes such as %2F or %20 are kept, since
+// decoding them could change the meaning of the URL.
+func unescapeUTF8(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		// Collect a run of escaped bytes with the high bit set.
+		var raw []byte
+		j := i
+		for j+2 < len(s) && s[j] == '%' {
+			c, ok := unhex(s[j+1], s[j+2])
+			if !ok || c < utf8.RuneSelf {
+				break
+			}
+			raw = append(raw, c)
+			j += 3
+		}
+		if len(raw) == 0 {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		if utf8.Valid(raw) && printable(raw) {
+			b.Write(raw)
+		} else {
+			b.WriteString(s[i:j])
+		}
+		i = j
+	}
+	return b.String()
+}
+
+func printable(raw []byte) bool {
+	for _, r := range string(raw) {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func unhex(hi, lo byte) (byte, bool) {
+	h, ok1 := fromHex(hi)
+	l, ok2 := fromHex(lo)
+	return h<<4 | l, ok1 && ok2
+}
+
+func fromHex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
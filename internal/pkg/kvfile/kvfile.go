@@ -0,0 +1,342 @@
+// Package kvfile is a key-value store in a single file, written in pure Go
+// so that programs using it build without cgo. Every key and its value are
+// held in memory; the file is an append-only log of the writes, replayed
+// when it is opened and rewritten without the overwritten and deleted
+// entries once those make up most of it.
+//
+// Each write is synced to disk before it returns, so a write that returned
+// survives a crash of the machine. A record cut short by a crash, which
+// can only be the last one, is dropped, and the file truncated before it,
+// when the file is next opened; a damaged record followed by others makes
+// Open fail with ErrCorrupt instead, so that they are not lost with it.
+// Only one process may have the file open.
+package kvfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	// ErrNotFound is returned for a key the store does not hold.
+	ErrNotFound = errors.New("kvfile: key not found")
+	// ErrExists is returned by Insert for a key the store holds.
+	ErrExists = errors.New("kvfile: key exists")
+	// ErrChanged is returned by Swap when the key holds another value.
+	ErrChanged = errors.New("kvfile: value changed")
+	// ErrClosed is returned after Close.
+	ErrClosed = errors.New("kvfile: store closed")
+	// ErrCorrupt is returned by Open for a damaged record that is not the
+	// last one in the file.
+	ErrCorrupt = errors.New("kvfile: corrupt record")
+)
+
+const (
+	opPut byte = 1
+	opDel byte = 2
+)
+
+// compactMinBytes is the size of dead records below which the file is not
+// compacted, however large a share they are.
+const compactMinBytes = 1 << 20
+
+// DB is a store in a file. It is safe for concurrent use.
+type DB struct {
+	path string
+
+	mu     sync.Mutex
+	file   *os.File
+	values map[string][]byte
+	// size is the length of the file and live the length of the records
+	// a compaction would keep.
+	size   int64
+	live   int64
+	closed bool
+}
+
+// Open opens the store in the file at path, creating it if needed.
+func Open(path string) (*DB, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{path: path, file: file, values: make(map[string][]byte)}
+	if err := db.load(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("kvfile: reading %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// load replays the records of the file and truncates a torn last one.
+func (db *DB) load() error {
+	data, err := io.ReadAll(db.file)
+	if err != nil {
+		return err
+	}
+	var offset int64
+	for offset < int64(len(data)) {
+		op, key, value, n, err := decodeRecord(data[offset:])
+		if err != nil {
+			if recordAfter(data[offset+1:]) {
+				return fmt.Errorf("%w at offset %d", ErrCorrupt, offset)
+			}
+			if err := db.file.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		offset += n
+		db.apply(op, key, value)
+	}
+	db.size = offset
+	db.live = 0
+	for key, value := range db.values {
+		db.live += recordSize(key, value)
+	}
+	return nil
+}
+
+// recordAfter reports whether a whole record starts anywhere in data, the
+// bytes after a damaged one: a torn record is the last write, so anything
+// after it means the file was damaged some other way.
+func recordAfter(data []byte) bool {
+	for i := range data {
+		if _, _, _, _, err := decodeRecord(data[i:]); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *DB) apply(op byte, key string, value []byte) {
+	if op == opDel {
+		delete(db.values, key)
+		return
+	}
+	db.values[key] = value
+}
+
+// Get returns a copy of the value of key.
+func (db *DB) Get(key string) ([]byte, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	value, ok := db.values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return bytes.Clone(value), nil
+}
+
+// Insert stores value under key unless key is taken.
+func (db *DB) Insert(key string, value []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	if _, ok := db.values[key]; ok {
+		return ErrExists
+	}
+	return db.write(opPut, key, value)
+}
+
+// Swap replaces the value of key with value if it still is old.
+func (db *DB) Swap(key string, old, value []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	current, ok := db.values[key]
+	if !ok {
+		return ErrNotFound
+	}
+	if !bytes.Equal(current, old) {
+		return ErrChanged
+	}
+	return db.write(opPut, key, value)
+}
+
+// Delete removes key.
+func (db *DB) Delete(key string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	if _, ok := db.values[key]; !ok {
+		return ErrNotFound
+	}
+	return db.write(opDel, key, nil)
+}
+
+// write appends a record, syncs it and applies it; db.mu must be held.
+func (db *DB) write(op byte, key string, value []byte) error {
+	record := encodeRecord(op, key, value)
+	_, err := db.file.Write(record)
+	if err == nil {
+		err = db.file.Sync()
+	}
+	if err != nil {
+		// Drop what was written of the record, so that the records
+		// written after it are not lost behind a torn one.
+		db.file.Truncate(db.size)
+		return err
+	}
+	db.size += int64(len(record))
+	if previous, ok := db.values[key]; ok {
+		db.live -= recordSize(key, previous)
+	}
+	if op == opPut {
+		value = bytes.Clone(value)
+		db.live += int64(len(record))
+	}
+	db.apply(op, key, value)
+	if dead := db.size - db.live; dead > compactMinBytes && dead > db.live {
+		// The write is stored either way; a failed compaction is retried
+		// on the next write.
+		_ = db.compact()
+	}
+	return nil
+}
+
+// compact rewrites the file with one record per key, through a rename so
+// that a crash leaves either file whole; db.mu must be held.
+func (db *DB) compact() error {
+	tmpPath := db.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	var size int64
+	for key, value := range db.values {
+		n, err := w.Write(encodeRecord(opPut, key, value))
+		size += int64(n)
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, db.path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	file, err := os.OpenFile(db.path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		// The old handle writes to the unlinked file; fail loudly rather
+		// than lose writes.
+		db.closed = true
+		return err
+	}
+	db.file.Close()
+	db.file, db.size, db.live = file, size, size
+	// The rename only survives a crash of the machine once the directory
+	// is synced.
+	return syncDir(filepath.Dir(db.path))
+}
+
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = dir.Sync()
+	if closeErr := dir.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Len returns the number of keys.
+func (db *DB) Len() int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return len(db.values)
+}
+
+// Close closes the file.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	return db.file.Close()
+}
+
+// A record is the op, the key and value lengths as uvarints, the key, the
+// value and the CRC-32 of all of these.
+
+var errBadRecord = errors.New("bad record")
+
+func encodeRecord(op byte, key string, value []byte) []byte {
+	record := make([]byte, 0, recordSize(key, value))
+	record = append(record, op)
+	record = binary.AppendUvarint(record, uint64(len(key)))
+	record = binary.AppendUvarint(record, uint64(len(value)))
+	record = append(record, key...)
+	record = append(record, value...)
+	return binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(record))
+}
+
+func recordSize(key string, value []byte) int64 {
+	var buf [binary.MaxVarintLen64]byte
+	return int64(1 + binary.PutUvarint(buf[:], uint64(len(key))) + binary.PutUvarint(buf[:], uint64(len(value))) + len(key) + len(value) + 4)
+}
+
+// decodeRecord decodes the record at the start of data and returns its
+// size. It returns errBadRecord for a record cut short or corrupted.
+func decodeRecord(data []byte) (op byte, key string, value []byte, n int64, err error) {
+	if len(data) == 0 {
+		return 0, "", nil, 0, errBadRecord
+	}
+	op = data[0]
+	if op != opPut && op != opDel {
+		return 0, "", nil, 0, errBadRecord
+	}
+	keyLen, k := binary.Uvarint(data[1:])
+	if k <= 0 {
+		return 0, "", nil, 0, errBadRecord
+	}
+	valueLen, v := binary.Uvarint(data[1+k:])
+	if v <= 0 || keyLen > 1<<20 || valueLen > 1<<30 {
+		return 0, "", nil, 0, errBadRecord
+	}
+	header := 1 + k + v
+	end := uint64(header) + keyLen + valueLen
+	if uint64(len(data)) < end+4 {
+		return 0, "", nil, 0, errBadRecord
+	}
+	if crc32.ChecksumIEEE(data[:end]) != binary.BigEndian.Uint32(data[end:end+4]) {
+		return 0, "", nil, 0, errBadRecord
+	}
+	key = string(data[header : uint64(header)+keyLen])
+	value = bytes.Clone(data[uint64(header)+keyLen : end])
+	return op, key, value, int64(end + 4), nil
+}
@@ -0,0 +1,192 @@
+package kvfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTest(t *testing.T, path string) *DB {
+	t.Helper()
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func expectValue(t *testing.T, db *DB, key, want string) {
+	t.Helper()
+	got, err := db.Get(key)
+	if err != nil || string(got) != want {
+		t.Errorf("Get(%q) = %q, %v, want %q", key, got, err, want)
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.kv")
+	db := openTest(t, path)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := db.Insert(key, []byte("v-"+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Swap("a", []byte("v-a"), []byte("v-a2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db = openTest(t, path)
+	if db.Len() != 2 {
+		t.Errorf("Len = %d, want 2", db.Len())
+	}
+	expectValue(t, db, "a", "v-a2")
+	expectValue(t, db, "c", "v-c")
+	if _, err := db.Get("b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a deleted key: %v", err)
+	}
+}
+
+func TestTornTail(t *testing.T) {
+	whole := encodeRecord(opPut, "c", []byte("v-c"))
+	for _, tt := range []struct {
+		name string
+		tail []byte
+	}{
+		{"op only", whole[:1]},
+		{"header only", whole[:3]},
+		{"cut in the value", whole[:len(whole)-5]},
+		{"checksum missing", whole[:len(whole)-4]},
+		{"bad checksum", append(bytes.Clone(whole[:len(whole)-1]), whole[len(whole)-1]^0xff)},
+		{"garbage byte", []byte{0xee}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "links.kv")
+			db := openTest(t, path)
+			for _, key := range []string{"a", "b"} {
+				if err := db.Insert(key, []byte("v-"+key)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			db.Close()
+			size := fileSize(t, path)
+			appendBytes(t, path, tt.tail)
+
+			db = openTest(t, path)
+			expectValue(t, db, "a", "v-a")
+			expectValue(t, db, "b", "v-b")
+			if _, err := db.Get("c"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get of the torn record: %v", err)
+			}
+			if got := fileSize(t, path); got != size {
+				t.Errorf("file size after recovery = %d, want %d", got, size)
+			}
+			// Writes after the recovery are not lost behind the torn record.
+			if err := db.Insert("d", []byte("v-d")); err != nil {
+				t.Fatal(err)
+			}
+			db.Close()
+			expectValue(t, openTest(t, path), "d", "v-d")
+		})
+	}
+}
+
+func TestCorruptRecordInTheMiddle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.kv")
+	db := openTest(t, path)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := db.Insert(key, []byte("value of "+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(data, []byte("value of b"))
+	data[i] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err := Open(path); !errors.Is(err, ErrCorrupt) {
+		if err == nil {
+			db.Close()
+		}
+		t.Fatalf("Open = %v, want ErrCorrupt", err)
+	}
+	if got := fileSize(t, path); got != int64(len(data)) {
+		t.Errorf("file size after a failed open = %d, want %d", got, len(data))
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.kv")
+	db := openTest(t, path)
+	if err := db.Insert("kept", []byte("kept value")); err != nil {
+		t.Fatal(err)
+	}
+	value := bytes.Repeat([]byte("x"), 64<<10)
+	if err := db.Insert("big", value); err != nil {
+		t.Fatal(err)
+	}
+	// Each overwrite leaves a dead record behind; past compactMinBytes of
+	// them, more than the live ones, the file is rewritten.
+	written := int64(0)
+	for i := 0; i < 40; i++ {
+		next := append(bytes.Clone(value), fmt.Sprint(i)...)
+		if err := db.Swap("big", value, next); err != nil {
+			t.Fatal(err)
+		}
+		value = next
+		written += int64(len(next))
+	}
+	if size := fileSize(t, path); size > compactMinBytes+2*int64(len(value)) {
+		t.Errorf("file size after %d bytes of overwrites = %d, want it compacted", written, size)
+	}
+	if _, err := os.Stat(path + ".compact"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temporary file left after compaction: %v", err)
+	}
+	// The handle follows the compacted file.
+	if err := db.Insert("after", []byte("after value")); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db = openTest(t, path)
+	if db.Len() != 3 {
+		t.Errorf("Len after reopening = %d, want 3", db.Len())
+	}
+	expectValue(t, db, "kept", "kept value")
+	expectValue(t, db, "big", string(value))
+	expectValue(t, db, "after", "after value")
+}
+
+func appendBytes(t *testing.T, path string, data []byte) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,120 @@
+// Package latency records how long operations take and summarizes them as
+// throughput and percentiles. cmd/loadgen and the benchmarks of the
+// service and repository layers report their numbers through it, so the
+// two are read the same way.
+package latency
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Recorder collects durations. It keeps every sample, which is fine for
+// the millions of operations a load test or benchmark runs. It is safe for
+// concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	samples []time.Duration
+}
+
+// Record adds one operation's duration.
+func (r *Recorder) Record(d time.Duration) {
+	r.mu.Lock()
+	r.samples = append(r.samples, d)
+	r.mu.Unlock()
+}
+
+// Since records the time elapsed since start, for use as
+// defer rec.Since(time.Now()).
+func (r *Recorder) Since(start time.Time) {
+	r.Record(time.Since(start))
+}
+
+// Reset drops the samples recorded so far.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.samples = r.samples[:0]
+	r.mu.Unlock()
+}
+
+// Summary describes the samples of a Recorder.
+type Summary struct {
+	Count                    int
+	Min, Mean, Max           time.Duration
+	P50, P90, P95, P99, P999 time.Duration
+}
+
+// Summary sorts a copy of the samples and returns their percentiles, using
+// the nearest-rank method. The zero Summary is returned when nothing has
+// been recorded.
+func (r *Recorder) Summary() Summary {
+	r.mu.Lock()
+	samples := append([]time.Duration(nil), r.samples...)
+	r.mu.Unlock()
+	if len(samples) == 0 {
+		return Summary{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	var total time.Duration
+	for _, d := range samples {
+		total += d
+	}
+	return Summary{
+		Count: len(samples),
+		Min:   samples[0],
+		Mean:  total / time.Duration(len(samples)),
+		Max:   samples[len(samples)-1],
+		P50:   percentile(samples, 50),
+		P90:   percentile(samples, 90),
+		P95:   percentile(samples, 95),
+		P99:   percentile(samples, 99),
+		P999:  percentile(samples, 99.9),
+	}
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p/100*float64(len(sorted)) + 0.999999)
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// Throughput returns the operations per second of s over elapsed.
+func (s Summary) Throughput(elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Count) / elapsed.Seconds()
+}
+
+// Metrics returns the percentiles in nanoseconds keyed by the units
+// testing.B.ReportMetric expects, such as "p99-ns/op".
+func (s Summary) Metrics() map[string]float64 {
+	return map[string]float64{
+		"p50-ns/op": float64(s.P50.Nanoseconds()),
+		"p90-ns/op": float64(s.P90.Nanoseconds()),
+		"p99-ns/op": float64(s.P99.Nanoseconds()),
+	}
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("n=%d min=%s mean=%s p50=%s p90=%s p95=%s p99=%s p99.9=%s max=%s",
+		s.Count, round(s.Min), round(s.Mean), round(s.P50), round(s.P90), round(s.P95), round(s.P99), round(s.P999), round(s.Max))
+}
+
+// round keeps durations readable: microseconds below a millisecond,
+// otherwise tenths of a millisecond.
+func round(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(100 * time.Microsecond)
+}
@@ -0,0 +1,138 @@
+// Package linksign signs short links with an expiry. A signature is an
+// HMAC-SHA256 of the code and the expiry time under a server key, so a
+// signed URL cannot be extended or moved to another code without the key,
+// however long the link itself lives in the database.
+//
+// A Signer may hold several keys, each under an ID that signed URLs carry,
+// so that keys can be rotated without revoking the signatures made with
+// the previous one: new signatures are made with the newest key in effect,
+// and signatures are checked with the key they name until it is removed.
+package linksign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query parameters that carry the expiry (Unix seconds), the signature and
+// the ID of the key that made it.
+const (
+	ParamExpires   = "exp"
+	ParamSignature = "sig"
+	ParamKeyID     = "kid"
+)
+
+// signatureBytes is how much of the HMAC is kept; 128 bits keep URLs short
+// and are far beyond guessing.
+const signatureBytes = 16
+
+var (
+	ErrMissing = errors.New("link signature is missing")
+	ErrInvalid = errors.New("link signature is invalid")
+	ErrExpired = errors.New("link signature has expired")
+)
+
+// Key is a signing key. Signatures made with a key with an empty ID carry
+// no kid parameter, as those made before keys had IDs. A key signs from
+// NotBefore on, so that a rotation can be scheduled.
+type Key struct {
+	ID        string
+	Secret    string
+	NotBefore time.Time
+}
+
+// Signer signs and verifies codes. With foldCase, codes are signed in lower
+// case so that a signature stays valid for every spelling of a
+// case-insensitive code.
+type Signer struct {
+	keys     []Key
+	byID     map[string]Key
+	foldCase bool
+}
+
+// New returns a Signer with the single key key, without an ID.
+func New(key string, foldCase bool) *Signer {
+	signer, _ := NewKeyring([]Key{{Secret: key}}, foldCase)
+	return signer
+}
+
+// NewKeyring returns a Signer with keys, whose IDs must differ. One of them
+// must be in effect from the start, with a zero NotBefore.
+func NewKeyring(keys []Key, foldCase bool) (*Signer, error) {
+	s := &Signer{keys: keys, byID: make(map[string]Key), foldCase: foldCase}
+	initial := false
+	for _, key := range keys {
+		if _, ok := s.byID[key.ID]; ok {
+			return nil, fmt.Errorf("linksign: duplicate key ID %q", key.ID)
+		}
+		s.byID[key.ID] = key
+		initial = initial || key.NotBefore.IsZero()
+	}
+	if !initial {
+		return nil, errors.New("linksign: no key is in effect from the start")
+	}
+	return s, nil
+}
+
+// Current returns the key signatures are made with at now: of the keys in
+// effect, the one with the latest NotBefore, the first listed on a tie.
+func (s *Signer) Current(now time.Time) Key {
+	var current Key
+	found := false
+	for _, key := range s.keys {
+		if key.NotBefore.After(now) {
+			continue
+		}
+		if !found || key.NotBefore.After(current.NotBefore) {
+			current, found = key, true
+		}
+	}
+	return current
+}
+
+// Sign returns the key ID, expiry and signature parameters for code, made
+// with the key current at now.
+func (s *Signer) Sign(code string, expires, now time.Time) (kid, exp, sig string) {
+	key := s.Current(now)
+	exp = strconv.FormatInt(expires.Unix(), 10)
+	return key.ID, exp, base64.RawURLEncoding.EncodeToString(s.mac(key, code, exp))
+}
+
+// Verify checks sig against code and exp with the key kid and that exp has
+// not passed.
+func (s *Signer) Verify(code, kid, exp, sig string, now time.Time) error {
+	if exp == "" || sig == "" {
+		return ErrMissing
+	}
+	key, ok := s.byID[kid]
+	if !ok {
+		return ErrInvalid
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrInvalid
+	}
+	given, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(given, s.mac(key, code, exp)) {
+		return ErrInvalid
+	}
+	if now.Unix() >= expires {
+		return ErrExpired
+	}
+	return nil
+}
+
+func (s *Signer) mac(key Key, code, exp string) []byte {
+	if s.foldCase {
+		code = strings.ToLower(code)
+	}
+	m := hmac.New(sha256.New, []byte(key.Secret))
+	m.Write([]byte(code + "\n" + exp))
+	return m.Sum(nil)[:signatureBytes]
+}
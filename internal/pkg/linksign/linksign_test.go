@@ -0,0 +1,69 @@
+package linksign
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	rotation := now.Add(-time.Hour)
+	signer, err := NewKeyring([]Key{
+		{ID: "k1", Secret: "old-secret"},
+		{ID: "k2", Secret: "new-secret", NotBefore: rotation},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, exp, sig := signer.Sign("abc", now.Add(time.Hour), now)
+	if kid != "k2" {
+		t.Fatalf("Sign used key %q, want k2", kid)
+	}
+	oldKid, oldExp, oldSig := signer.Sign("abc", now.Add(time.Hour), rotation.Add(-time.Minute))
+	other, _ := NewKeyring([]Key{{ID: "k2", Secret: "other-secret"}}, false)
+	_, _, foreignSig := other.Sign("abc", now.Add(time.Hour), now)
+
+	for _, tt := range []struct {
+		name                string
+		code, kid, exp, sig string
+		at                  time.Time
+		want                error
+	}{
+		{"valid", "abc", kid, exp, sig, now, nil},
+		{"made with the previous key", "abc", oldKid, oldExp, oldSig, now, nil},
+		{"just before expiry", "abc", kid, exp, sig, now.Add(time.Hour - time.Second), nil},
+		{"at expiry", "abc", kid, exp, sig, now.Add(time.Hour), ErrExpired},
+		{"long expired", "abc", kid, exp, sig, now.Add(48 * time.Hour), ErrExpired},
+		{"missing signature", "abc", kid, exp, "", now, ErrMissing},
+		{"missing expiry", "abc", kid, "", sig, now, ErrMissing},
+		{"unknown kid", "abc", "k3", exp, sig, now, ErrInvalid},
+		{"wrong kid", "abc", "k1", exp, sig, now, ErrInvalid},
+		{"no kid", "abc", "", exp, sig, now, ErrInvalid},
+		{"other server's key", "abc", kid, exp, foreignSig, now, ErrInvalid},
+		{"other code", "abd", kid, exp, sig, now, ErrInvalid},
+		{"extended expiry", "abc", kid, strconv.FormatInt(now.Add(48*time.Hour).Unix(), 10), sig, now, ErrInvalid},
+		// Checking the signature first keeps a forged expiry from telling
+		// whether it has passed.
+		{"forged past expiry", "abc", kid, strconv.FormatInt(now.Add(-time.Hour).Unix(), 10), sig, now, ErrInvalid},
+		{"malformed expiry", "abc", kid, "soon", sig, now, ErrInvalid},
+		{"malformed signature", "abc", kid, exp, "!!!", now, ErrInvalid},
+	} {
+		if err := signer.Verify(tt.code, tt.kid, tt.exp, tt.sig, tt.at); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Verify = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestVerifyFoldCase(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	signer := New("secret", true)
+	kid, exp, sig := signer.Sign("AbC", now.Add(time.Hour), now)
+	if err := signer.Verify("abc", kid, exp, sig, now); err != nil {
+		t.Errorf("Verify with another spelling of a case-insensitive code: %v", err)
+	}
+	if err := New("secret", false).Verify("ABC", kid, exp, sig, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify of a case-sensitive code = %v, want ErrInvalid", err)
+	}
+}
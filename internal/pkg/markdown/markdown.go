@@ -0,0 +1,141 @@
+// Package markdown renders a small, safe subset of Markdown to HTML:
+// headings, paragraphs, fenced code blocks, block quotes, bullet and numbered
+// lists, emphasis, inline code and links. All input text is HTML-escaped and
+// only http(s) and mailto link targets are emitted, so the output can be
+// served for untrusted content.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	headingRe   = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	orderedRe   = regexp.MustCompile(`^\d+[.)]\s+(.*)$`)
+	unorderedRe = regexp.MustCompile(`^[-*+]\s+(.*)$`)
+	codeSpanRe  = regexp.MustCompile("`([^`]+)`")
+	linkRe      = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	boldRe      = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italicRe    = regexp.MustCompile(`\*([^*]+)\*`)
+)
+
+func Render(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var (
+		out       strings.Builder
+		paragraph []string
+		listTag   string
+		inCode    bool
+	)
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + inline(strings.Join(paragraph, " ")) + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if listTag != "" {
+			out.WriteString("</" + listTag + ">\n")
+			listTag = ""
+		}
+	}
+	openList := func(tag string) {
+		if listTag != tag {
+			closeList()
+			out.WriteString("<" + tag + ">\n")
+			listTag = tag
+		}
+	}
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") {
+			if inCode {
+				out.WriteString("</code></pre>\n")
+				inCode = false
+			} else {
+				flushParagraph()
+				closeList()
+				out.WriteString("<pre><code>")
+				inCode = true
+			}
+			continue
+		}
+		if inCode {
+			out.WriteString(html.EscapeString(line) + "\n")
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			flushParagraph()
+			closeList()
+		case headingRe.MatchString(trimmed):
+			flushParagraph()
+			closeList()
+			m := headingRe.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(m[1])))
+			out.WriteString("<h" + level + ">" + inline(m[2]) + "</h" + level + ">\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			closeList()
+			out.WriteString("<blockquote>" + inline(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))) + "</blockquote>\n")
+		case unorderedRe.MatchString(trimmed):
+			flushParagraph()
+			openList("ul")
+			out.WriteString("<li>" + inline(unorderedRe.FindStringSubmatch(trimmed)[1]) + "</li>\n")
+		case orderedRe.MatchString(trimmed):
+			flushParagraph()
+			openList("ol")
+			out.WriteString("<li>" + inline(orderedRe.FindStringSubmatch(trimmed)[1]) + "</li>\n")
+		default:
+			closeList()
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+
+	if inCode {
+		out.WriteString("</code></pre>\n")
+	}
+	flushParagraph()
+	closeList()
+	return out.String()
+}
+
+// inline escapes text and applies span-level formatting. Code spans are
+// swapped out first so their content is not formatted further.
+func inline(text string) string {
+	var spans []string
+	text = codeSpanRe.ReplaceAllStringFunc(text, func(m string) string {
+		spans = append(spans, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return "\x00" + strconv.Itoa(len(spans)-1) + "\x00"
+	})
+
+	text = html.EscapeString(text)
+	text = linkRe.ReplaceAllStringFunc(text, func(m string) string {
+		parts := linkRe.FindStringSubmatch(m)
+		label, target := parts[1], html.UnescapeString(parts[2])
+		if !safeLinkTarget(target) {
+			return m
+		}
+		return `<a href="` + html.EscapeString(target) + `" rel="nofollow noopener">` + label + `</a>`
+	})
+	text = boldRe.ReplaceAllString(text, "<strong>$1</strong>")
+	text = italicRe.ReplaceAllString(text, "<em>$1</em>")
+
+	for i, span := range spans {
+		text = strings.Replace(text, "\x00"+strconv.Itoa(i)+"\x00", span, 1)
+	}
+	return text
+}
+
+func safeLinkTarget(target string) bool {
+	lower := strings.ToLower(target)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "mailto:")
+}
@@ -0,0 +1,322 @@
+// Package metrics is a small, dependency-free implementation of Prometheus
+// counters and histograms with exposition in both the classic text format and
+// OpenMetrics (which is required for exemplars).
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are tuned for the redirect path: fine-grained below
+// 100ms so that p99 can be estimated precisely for latency SLOs.
+var DefaultLatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+const (
+	contentTypeText        = "text/plain; version=0.0.4; charset=utf-8"
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+type collector interface {
+	write(w io.Writer, constLabels []labelPair, openMetrics bool)
+}
+
+// Registry holds all metric families and renders them for scraping. Constant
+// labels (e.g. the deployment environment) are attached to every series.
+type Registry struct {
+	mu          sync.Mutex
+	constLabels []labelPair
+	names       map[string]bool
+	collectors  []collector
+}
+
+func NewRegistry(constLabels map[string]string) *Registry {
+	r := &Registry{names: make(map[string]bool)}
+	for k, v := range constLabels {
+		if v != "" {
+			r.constLabels = append(r.constLabels, labelPair{k, v})
+		}
+	}
+	sort.Slice(r.constLabels, func(i, j int) bool { return r.constLabels[i].name < r.constLabels[j].name })
+	return r
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate registration of " + name)
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// Handler serves the registry, using OpenMetrics when the scraper asks for it.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		openMetrics := strings.Contains(req.Header.Get("Accept"), "application/openmetrics-text")
+		if openMetrics {
+			w.Header().Set("Content-Type", contentTypeOpenMetrics)
+		} else {
+			w.Header().Set("Content-Type", contentTypeText)
+		}
+		r.Write(w, openMetrics)
+	})
+}
+
+func (r *Registry) Write(w io.Writer, openMetrics bool) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w, r.constLabels, openMetrics)
+	}
+	if openMetrics {
+		io.WriteString(w, "# EOF\n")
+	}
+}
+
+type labelPair struct {
+	name  string
+	value string
+}
+
+type family struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mu     sync.Mutex
+	series map[string][]string
+}
+
+func newFamily(name, help string, labelNames []string) family {
+	return family{name: name, help: help, labelNames: labelNames, series: make(map[string][]string)}
+}
+
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labelNames), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (f *family) sortedKeys() []string {
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *family) labels(constLabels []labelPair, values []string, extra ...labelPair) string {
+	pairs := append([]labelPair(nil), constLabels...)
+	for i, name := range f.labelNames {
+		pairs = append(pairs, labelPair{name, values[i]})
+	}
+	pairs = append(pairs, extra...)
+	return formatLabels(pairs)
+}
+
+// CounterVec is a monotonically increasing counter partitioned by labels.
+type CounterVec struct {
+	family
+	values map[string]*Counter
+}
+
+type Counter struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{family: newFamily(name, help, labelNames), values: make(map[string]*Counter)}
+	r.register(name, c)
+	return c
+}
+
+func (c *CounterVec) WithLabelValues(values ...string) *Counter {
+	key := c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counter, ok := c.values[key]
+	if !ok {
+		counter = &Counter{}
+		c.values[key] = counter
+		c.series[key] = append([]string(nil), values...)
+	}
+	return counter
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.value += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+func (c *CounterVec) write(w io.Writer, constLabels []labelPair, openMetrics bool) {
+	familyName := c.name
+	if openMetrics {
+		familyName = strings.TrimSuffix(c.name, "_total")
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", familyName, escapeHelp(c.help), familyName)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range c.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labels(constLabels, c.series[key]), formatFloat(c.values[key].Value()))
+	}
+}
+
+// HistogramVec tracks observations in cumulative buckets. Each bucket keeps
+// the most recent exemplar, exposed when scraped in OpenMetrics format.
+type HistogramVec struct {
+	family
+	buckets []float64
+	values  map[string]*Histogram
+}
+
+type Histogram struct {
+	mu        sync.Mutex
+	buckets   []float64
+	counts    []uint64
+	exemplars []*exemplar
+	count     uint64
+	sum       float64
+}
+
+type exemplar struct {
+	labels []labelPair
+	value  float64
+	ts     time.Time
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	h := &HistogramVec{family: newFamily(name, help, labelNames), buckets: sorted, values: make(map[string]*Histogram)}
+	r.register(name, h)
+	return h
+}
+
+func (h *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	key := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &Histogram{
+			buckets:   h.buckets,
+			counts:    make([]uint64, len(h.buckets)+1),
+			exemplars: make([]*exemplar, len(h.buckets)+1),
+		}
+		h.values[key] = hist
+		h.series[key] = append([]string(nil), values...)
+	}
+	return hist
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.ObserveWithExemplar(v, nil)
+}
+
+func (h *Histogram) ObserveWithExemplar(v float64, exemplarLabels map[string]string) {
+	idx := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[idx]++
+	h.count++
+	h.sum += v
+	if len(exemplarLabels) > 0 {
+		ex := &exemplar{value: v, ts: time.Now()}
+		for k, val := range exemplarLabels {
+			ex.labels = append(ex.labels, labelPair{k, val})
+		}
+		sort.Slice(ex.labels, func(i, j int) bool { return ex.labels[i].name < ex.labels[j].name })
+		h.exemplars[idx] = ex
+	}
+}
+
+func (h *HistogramVec) write(w io.Writer, constLabels []labelPair, openMetrics bool) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, escapeHelp(h.help), h.name)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range h.sortedKeys() {
+		values := h.series[key]
+		hist := h.values[key]
+
+		hist.mu.Lock()
+		var cumulative uint64
+		for i := 0; i <= len(hist.buckets); i++ {
+			cumulative += hist.counts[i]
+			le := "+Inf"
+			if i < len(hist.buckets) {
+				le = formatFloat(hist.buckets[i])
+			}
+			line := fmt.Sprintf("%s_bucket%s %d", h.name, h.labels(constLabels, values, labelPair{"le", le}), cumulative)
+			if openMetrics && hist.exemplars[i] != nil {
+				ex := hist.exemplars[i]
+				line += fmt.Sprintf(" # %s %s %.3f", formatLabels(ex.labels), formatFloat(ex.value), float64(ex.ts.UnixNano())/1e9)
+			}
+			fmt.Fprintln(w, line)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labels(constLabels, values), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labels(constLabels, values), hist.count)
+		hist.mu.Unlock()
+	}
+}
+
+func formatLabels(pairs []labelPair) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	parts := make([]string, len(pairs))
+	for i, p := range pairs {
+		parts[i] = p.name + `="` + escapeLabelValue(p.value) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func escapeHelp(v string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(v)
+}
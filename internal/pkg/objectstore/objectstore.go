@@ -0,0 +1,37 @@
+// Package objectstore stores uploaded files. Two backends are provided: a
+// local directory and an S3-compatible bucket. Only the S3 backend can hand
+// out presigned URLs; callers fall back to streaming through the server when
+// a store returns ErrPresignUnsupported.
+package objectstore
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotFound           = errors.New("object not found")
+	ErrPresignUnsupported = errors.New("store does not support presigned URLs")
+)
+
+// Object describes a stored object.
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+type Store interface {
+	Put(key string, body io.Reader, size int64, contentType string) error
+	Open(key string) (io.ReadCloser, *Object, error)
+	Stat(key string) (*Object, error)
+	Delete(key string) error
+	// PresignPut returns a URL the client can PUT exactly size bytes of
+	// contentType to, valid for ttl.
+	PresignPut(key, contentType string, size int64, ttl time.Duration) (string, error)
+	// PresignGet returns a download URL valid for ttl. A non-empty filename
+	// is sent back as the Content-Disposition of the download.
+	PresignGet(key, filename string, ttl time.Duration) (string, error)
+}
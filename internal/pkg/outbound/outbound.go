@@ -0,0 +1,264 @@
+// Package outbound is the single HTTP client for requests the service makes
+// to URLs it does not control: webhook targets and link destinations. It
+// enforces timeouts, a redirect limit and a response size limit, refuses to
+// connect to private networks, and counts every request.
+package outbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"template/internal/pkg/metrics"
+)
+
+var (
+	// ErrBlockedAddress is returned when a request (or one of its redirects)
+	// would connect to a private, loopback or otherwise internal address.
+	ErrBlockedAddress = errors.New("destination address is not allowed")
+	// ErrBodyTooLarge is returned by reads past Options.MaxBodyBytes.
+	ErrBodyTooLarge = errors.New("response body too large")
+)
+
+// Options configures a Client. AllowedNetworks are CIDRs exempt from the
+// private address block, for example an internal webhook receiver;
+// AllowPrivate turns the block off entirely (local development only).
+type Options struct {
+	Timeout         time.Duration
+	MaxRedirects    int
+	MaxBodyBytes    int64
+	UserAgent       string
+	AllowPrivate    bool
+	AllowedNetworks []netip.Prefix
+}
+
+// Client wraps an http.Client built from Options.
+type Client struct {
+	client   *http.Client
+	opts     Options
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+// New builds a Client that records its requests in reg.
+func New(opts Options, reg *metrics.Registry) *Client {
+	c := &Client{
+		opts: opts,
+		requests: reg.NewCounterVec("shortener_outbound_requests_total",
+			"Outbound HTTP requests, by purpose and outcome (status class, blocked or error).", "purpose", "outcome"),
+		duration: reg.NewHistogramVec("shortener_outbound_request_duration_seconds",
+			"Outbound HTTP request latency in seconds, by purpose.", metrics.DefaultLatencyBuckets, "purpose"),
+	}
+
+	dialer := &net.Dialer{
+		Timeout: opts.Timeout,
+		// Control runs after DNS resolution, for every address tried, so a
+		// hostname cannot be pointed at an internal address between a check
+		// and the connection.
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !c.allowed(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		// No proxy: through one, the dial check would only see the
+		// proxy's address.
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   opts.Timeout,
+		ResponseHeaderTimeout: opts.Timeout,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	c.client = &http.Client{
+		Transport: transport,
+		Timeout:   opts.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.Context().Value(noRedirectsKey{}) != nil {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > opts.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", opts.MaxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+	return c
+}
+
+type noRedirectsKey struct{}
+
+// NoRedirects makes requests sent with the returned context answer with
+// the first redirect response instead of following it.
+func NoRedirects(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRedirectsKey{}, true)
+}
+
+func (c *Client) allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if c.opts.AllowPrivate || !IsInternal(addr) {
+		return true
+	}
+	for _, prefix := range c.opts.AllowedNetworks {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Do sends req; purpose labels the request in the metrics ("webhook",
+// "link_check", ...). The response body stops with ErrBodyTooLarge after
+// MaxBodyBytes.
+func (c *Client) Do(purpose string, req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		c.requests.WithLabelValues(purpose, "error").Inc()
+		return nil, fmt.Errorf("unsupported scheme %q", req.URL.Scheme)
+	}
+	if c.opts.UserAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.opts.UserAgent)
+	}
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	c.duration.WithLabelValues(purpose).Observe(time.Since(start).Seconds())
+	if err != nil {
+		outcome := "error"
+		if errors.Is(err, ErrBlockedAddress) {
+			outcome = "blocked"
+		}
+		c.requests.WithLabelValues(purpose, outcome).Inc()
+		return nil, err
+	}
+	c.requests.WithLabelValues(purpose, fmt.Sprintf("%dxx", resp.StatusCode/100)).Inc()
+	if c.opts.MaxBodyBytes > 0 {
+		resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: c.opts.MaxBodyBytes}
+	}
+	return resp, nil
+}
+
+// Get, Head and Post are shorthands for Do with a new request.
+func (c *Client) Get(ctx context.Context, purpose, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(purpose, req)
+}
+
+func (c *Client) Head(ctx context.Context, purpose, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(purpose, req)
+}
+
+func (c *Client) Post(ctx context.Context, purpose, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.Do(purpose, req)
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Tell a body that ends exactly at the limit from a larger one.
+		var one [1]byte
+		if n, _ := b.ReadCloser.Read(one[:]); n > 0 {
+			return 0, ErrBodyTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// internalPrefixes are the ranges a public destination never resolves to.
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("10.0.0.0/8"),      // private
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("127.0.0.0/8"),     // loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // link-local, cloud metadata
+	netip.MustParsePrefix("172.16.0.0/12"),   // private
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("192.88.99.0/24"),  // 6to4 relay anycast
+	netip.MustParsePrefix("192.168.0.0/16"),  // private
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("224.0.0.0/4"),     // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, broadcast
+	netip.MustParsePrefix("::/128"),          // unspecified
+	netip.MustParsePrefix("::1/128"),         // loopback
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("100::/64"),        // discard
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("fc00::/7"),        // unique local
+	netip.MustParsePrefix("fe80::/10"),       // link-local
+	netip.MustParsePrefix("ff00::/8"),        // multicast
+}
+
+// Ranges that carry an IPv4 address inside an IPv6 one: on a network with
+// NAT64 or a 6to4 relay, connecting to them reaches that IPv4 address.
+var (
+	nat64Prefix = netip.MustParsePrefix("64:ff9b::/96") // well-known NAT64, address in the last 32 bits
+	sixToFour   = netip.MustParsePrefix("2002::/16")    // 6to4, address in bits 16 to 48
+)
+
+// IsInternal reports whether addr belongs to a private, loopback,
+// link-local or otherwise non-public range, or embeds an IPv4 address
+// that does.
+func IsInternal(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range internalPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	if embedded, ok := embeddedIPv4(addr); ok {
+		return IsInternal(embedded)
+	}
+	return false
+}
+
+// embeddedIPv4 returns the IPv4 address a NAT64 or 6to4 address leads to.
+func embeddedIPv4(addr netip.Addr) (netip.Addr, bool) {
+	b := addr.As16()
+	switch {
+	case nat64Prefix.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[12:16])), true
+	case sixToFour.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[2:6])), true
+	}
+	return netip.Addr{}, false
+}
@@ -0,0 +1,90 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"template/internal/pkg/metrics"
+)
+
+func TestAllowed(t *testing.T) {
+	guarded := &Client{}
+	exempt := &Client{opts: Options{AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}}}
+	open := &Client{opts: Options{AllowPrivate: true}}
+
+	for _, tt := range []struct {
+		client *Client
+		addr   string
+		want   bool
+	}{
+		{guarded, "93.184.216.34", true},
+		{guarded, "2606:2800:220:1::1", true},
+		{guarded, "10.0.0.1", false},
+		{guarded, "172.16.5.4", false},
+		{guarded, "192.168.1.1", false},
+		{guarded, "100.64.0.1", false},
+		{guarded, "127.0.0.1", false},
+		{guarded, "127.255.255.254", false},
+		{guarded, "0.0.0.0", false},
+		{guarded, "169.254.169.254", false},
+		{guarded, "::1", false},
+		{guarded, "::", false},
+		{guarded, "fd00::1", false},
+		{guarded, "fe80::1", false},
+		// IPv4-mapped IPv6 addresses reach the IPv4 host they embed.
+		{guarded, "::ffff:127.0.0.1", false},
+		{guarded, "::ffff:10.0.0.1", false},
+		{guarded, "::ffff:169.254.169.254", false},
+		{guarded, "::ffff:93.184.216.34", true},
+		// So do NAT64 and 6to4 addresses, through a gateway or relay.
+		{guarded, "64:ff9b::7f00:1", false},
+		{guarded, "64:ff9b::a00:1", false},
+		{guarded, "64:ff9b::a9fe:a9fe", false},
+		{guarded, "64:ff9b::5db8:d822", true},
+		{guarded, "64:ff9b:1::5db8:d822", false},
+		{guarded, "2002:7f00:1::", false},
+		{guarded, "2002:c0a8:101::1", false},
+		{guarded, "2002:a9fe:a9fe::", false},
+		{guarded, "2002:5db8:d822::1", true},
+		{exempt, "10.1.2.3", true},
+		{exempt, "::ffff:10.1.2.3", true},
+		{exempt, "10.2.0.1", false},
+		{exempt, "127.0.0.1", false},
+		{open, "127.0.0.1", true},
+	} {
+		if got := tt.client.allowed(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("allowed(%s) with %+v = %v, want %v", tt.addr, tt.client.opts, got, tt.want)
+		}
+	}
+}
+
+func TestDoBlocksLoopback(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	opts := Options{Timeout: time.Second, MaxRedirects: 3}
+	client := New(opts, metrics.NewRegistry(nil))
+	for _, url := range []string{target.URL, redirect.URL} {
+		if _, err := client.Get(context.Background(), "test", url); !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("Get(%s) error = %v, want ErrBlockedAddress", url, err)
+		}
+	}
+
+	// Addresses in AllowedNetworks are reached, through redirects too.
+	opts.AllowedNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}
+	client = New(opts, metrics.NewRegistry(nil))
+	resp, err := client.Get(context.Background(), "test", redirect.URL)
+	if err != nil {
+		t.Fatalf("Get with the loopback network allowed: %v", err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,60 @@
+// Package prefetch recognizes requests that fetch a link without a person
+// following it: browser prefetches and prerenders announced by the Purpose,
+// Sec-Purpose or X-Moz headers, and the bots that chat apps and social
+// networks send to build link previews.
+package prefetch
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Kinds of non-human fetches.
+const (
+	// KindPrefetch is a browser fetching the link ahead of a possible
+	// navigation.
+	KindPrefetch = "prefetch"
+	// KindPreview is a bot fetching the link to show a preview of it.
+	KindPreview = "preview"
+)
+
+// previewAgents are substrings of the User-Agent of link preview bots.
+var previewAgents = []string{
+	"slackbot-linkexpanding",
+	"slack-imgproxy",
+	"facebookexternalhit",
+	"facebot",
+	"twitterbot",
+	"whatsapp",
+	"telegrambot",
+	"discordbot",
+	"linkedinbot",
+	"skypeuripreview",
+	"microsoftpreview",
+	"embedly",
+	"vkshare",
+	"pinterestbot",
+	"redditbot",
+	"mattermost-bot",
+	"bitlybot",
+	"google-pagerenderer",
+	"iframely",
+}
+
+// Detect returns KindPrefetch or KindPreview for requests made without a
+// person following the link, and "" for everything else.
+func Detect(r *http.Request) string {
+	for _, header := range []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"} {
+		value := strings.ToLower(r.Header.Get(header))
+		if strings.Contains(value, "prefetch") || strings.Contains(value, "prerender") || strings.Contains(value, "preview") {
+			return KindPrefetch
+		}
+	}
+	ua := strings.ToLower(r.UserAgent())
+	for _, agent := range previewAgents {
+		if strings.Contains(ua, agent) {
+			return KindPreview
+		}
+	}
+	return ""
+}
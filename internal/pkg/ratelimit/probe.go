@@ -0,0 +1,180 @@
+package ratelimit
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProbeOptions configure a ProbeGuard. Failures are counted per key over a
+// Window that starts with the first one. From Threshold failures on, each
+// request waits BaseDelay, doubled for every further failure up to
+// MaxDelay; at BlockAfter failures the key is refused for BlockFor and its
+// count starts over. A zero BlockAfter never blocks.
+type ProbeOptions struct {
+	Window     time.Duration
+	Threshold  int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	BlockAfter int
+	BlockFor   time.Duration
+}
+
+// Offender is a key that is being delayed or is blocked.
+type Offender struct {
+	Key          string     `json:"key"`
+	Failures     int        `json:"failures"`
+	Since        time.Time  `json:"since"`
+	Delay        string     `json:"delay,omitempty"`
+	BlockedUntil *time.Time `json:"blocked_until,omitempty"`
+}
+
+type probeState struct {
+	failures     int
+	since        time.Time
+	blockedUntil time.Time
+}
+
+// ProbeGuard slows down and then blocks the keys (client IPs) whose
+// requests keep failing, such as clients probing for codes that do not
+// exist, so that scanning is impractical while a visitor who mistypes a
+// link a few times notices nothing.
+type ProbeGuard struct {
+	mu        sync.Mutex
+	opts      ProbeOptions
+	states    map[string]*probeState
+	lastSweep time.Time
+}
+
+func NewProbeGuard(opts ProbeOptions) *ProbeGuard {
+	return &ProbeGuard{opts: opts, states: make(map[string]*probeState)}
+}
+
+// Check reports how long a request from key must wait before it is served,
+// or, when key is blocked, how long until it may try again.
+func (g *ProbeGuard) Check(key string, now time.Time) (delay, blocked time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.sweep(now)
+	s := g.state(key, now)
+	if s == nil {
+		return 0, 0
+	}
+	if now.Before(s.blockedUntil) {
+		return 0, s.blockedUntil.Sub(now)
+	}
+	return g.delay(s), 0
+}
+
+// Fail counts a failed request from key and reports whether it got key
+// blocked.
+func (g *ProbeGuard) Fail(key string, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s := g.state(key, now)
+	if s == nil {
+		s = &probeState{since: now}
+		g.states[key] = s
+	}
+	s.failures++
+	if g.opts.BlockAfter > 0 && s.failures >= g.opts.BlockAfter {
+		s.blockedUntil = now.Add(g.opts.BlockFor)
+		s.failures, s.since = 0, s.blockedUntil
+		return true
+	}
+	return false
+}
+
+// Block refuses key for BlockFor from now on, whatever its failures, for
+// clients caught some other way, such as requesting a honeypot.
+func (g *ProbeGuard) Block(key string, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	until := now.Add(g.opts.BlockFor)
+	if s, ok := g.states[key]; ok && s.blockedUntil.After(until) {
+		return
+	}
+	g.states[key] = &probeState{since: until, blockedUntil: until}
+}
+
+// Offenders lists the keys being delayed or blocked, the most failures
+// first.
+func (g *ProbeGuard) Offenders(now time.Time) []Offender {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var offenders []Offender
+	for key := range g.states {
+		s := g.state(key, now)
+		if s == nil {
+			continue
+		}
+		offender := Offender{Key: key, Failures: s.failures, Since: s.since}
+		if now.Before(s.blockedUntil) {
+			until := s.blockedUntil
+			offender.BlockedUntil = &until
+		} else if delay := g.delay(s); delay > 0 {
+			offender.Delay = delay.String()
+		} else {
+			continue
+		}
+		offenders = append(offenders, offender)
+	}
+	sort.Slice(offenders, func(i, j int) bool {
+		if offenders[i].Failures != offenders[j].Failures {
+			return offenders[i].Failures > offenders[j].Failures
+		}
+		return offenders[i].Key < offenders[j].Key
+	})
+	return offenders
+}
+
+// Unblock forgets the failures of key, lifting its delay or block, and
+// reports whether there were any.
+func (g *ProbeGuard) Unblock(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	_, ok := g.states[key]
+	delete(g.states, key)
+	return ok
+}
+
+// state returns the state of key, dropping it once its window has passed
+// and it is not blocked.
+func (g *ProbeGuard) state(key string, now time.Time) *probeState {
+	s, ok := g.states[key]
+	if !ok {
+		return nil
+	}
+	if !now.Before(s.blockedUntil) && now.Sub(s.since) >= g.opts.Window {
+		delete(g.states, key)
+		return nil
+	}
+	return s
+}
+
+func (g *ProbeGuard) delay(s *probeState) time.Duration {
+	if g.opts.Threshold <= 0 || s.failures < g.opts.Threshold {
+		return 0
+	}
+	delay := g.opts.BaseDelay
+	for i := g.opts.Threshold; i < s.failures && delay < g.opts.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, g.opts.MaxDelay)
+}
+
+// sweep drops the keys whose window has passed, at most once per window.
+func (g *ProbeGuard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < g.opts.Window {
+		return
+	}
+	g.lastSweep = now
+	for key := range g.states {
+		g.state(key, now)
+	}
+}
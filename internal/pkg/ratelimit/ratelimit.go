@@ -0,0 +1,86 @@
+// Package ratelimit implements a per-key token bucket whose limit can be
+// changed while it is in use.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter allows each key up to limit events per window, refilled
+// continuously, with bursts of up to limit events.
+type Limiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{limit: limit, window: window, buckets: make(map[string]*bucket)}
+}
+
+// SetLimit changes the limit for every key. Existing buckets keep their
+// tokens, capped at the new limit. A limit of zero or less disables limiting.
+func (l *Limiter) SetLimit(limit int, window time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.window = window
+	for _, b := range l.buckets {
+		if b.tokens > float64(limit) {
+			b.tokens = float64(limit)
+		}
+	}
+}
+
+// Allow takes a token for key. When none is left it reports how long until
+// the next one is available.
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit <= 0 {
+		return true, 0
+	}
+	l.sweep(now)
+
+	perSecond := float64(l.limit) / l.window.Seconds()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit), updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.updated).Seconds() * perSecond
+	if b.tokens > float64(l.limit) {
+		b.tokens = float64(l.limit)
+	}
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops the buckets that have been idle for a whole window, since they
+// are full again and equivalent to a missing one.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.window {
+			delete(l.buckets, key)
+		}
+	}
+}
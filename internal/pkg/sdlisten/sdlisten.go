@@ -0,0 +1,60 @@
+// Package sdlisten takes over the listening sockets systemd passes to a
+// socket-activated service. With socket activation systemd binds the socket
+// itself, so a service can listen on a privileged port without running as
+// root, and keeps it open across restarts of the service, so connections
+// arriving during a restart wait in the backlog instead of being refused.
+package sdlisten
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// firstFD is the first descriptor passed by systemd; the others follow it.
+const firstFD = 3
+
+// Listeners returns the sockets passed to the process, in the order of the
+// ListenStream= lines of the socket unit, along with their names from
+// FileDescriptorName=. It returns none when the process was not socket
+// activated. The environment variables are unset, so that child processes
+// do not take the sockets for theirs.
+func Listeners() ([]net.Listener, []string, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		// Meant for another process, or not set at all.
+		return nil, nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return nil, nil, fmt.Errorf("sdlisten: invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	listeners := make([]net.Listener, 0, n)
+	listenerNames := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(firstFD+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(firstFD+i), name)
+		listener, err := net.FileListener(file)
+		// FileListener duplicates the descriptor.
+		file.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, nil, fmt.Errorf("sdlisten: socket %s: %w", name, err)
+		}
+		listeners = append(listeners, listener)
+		listenerNames = append(listenerNames, name)
+	}
+	return listeners, listenerNames, nil
+}
@@ -0,0 +1,97 @@
+// Package secrets looks up credentials by name from pluggable sources:
+// environment variables, files mounted by Docker or Kubernetes, and
+// HashiCorp Vault. Secrets are looked up by the name of the environment
+// variable they would otherwise come from, such as SMTP_PASSWORD.
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Provider is a source of secrets. Lookup reports whether the source has a
+// value for name; an error means the source should have one but it could
+// not be read.
+type Provider interface {
+	Lookup(name string) (string, bool, error)
+}
+
+// Env reads secrets from environment variables.
+type Env struct{}
+
+func (Env) Lookup(name string) (string, bool, error) {
+	v := os.Getenv(name)
+	return v, v != "", nil
+}
+
+// File reads a secret from the file named by the NAME_FILE environment
+// variable, the convention of the official Docker images, or from a file
+// called NAME (or name in lower case) in Dir, such as /run/secrets. A
+// trailing newline is removed.
+type File struct {
+	Dir string
+}
+
+func (f File) Lookup(name string) (string, bool, error) {
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		v, err := readSecretFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return v, true, nil
+	}
+	if f.Dir == "" {
+		return "", false, nil
+	}
+	for _, candidate := range []string{name, strings.ToLower(name)} {
+		path := filepath.Join(f.Dir, candidate)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		v, err := readSecretFile(path)
+		if err != nil {
+			return "", false, err
+		}
+		return v, true, nil
+	}
+	return "", false, nil
+}
+
+func readSecretFile(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(raw), "\r\n"), nil
+}
+
+// Chain asks its providers in order and returns the first value found.
+type Chain []Provider
+
+func (c Chain) Lookup(name string) (string, bool, error) {
+	for _, p := range c {
+		v, ok, err := p.Lookup(name)
+		if err != nil || ok {
+			return v, ok, err
+		}
+	}
+	return "", false, nil
+}
+
+// FromEnv builds the provider chain the environment asks for: secret files
+// first, then plain environment variables, then Vault when VAULT_ADDR is
+// set. Files come first so that a mounted secret overrides a leftover
+// variable of the same name.
+func FromEnv() (Provider, error) {
+	chain := Chain{File{Dir: os.Getenv("SECRETS_DIR")}, Env{}}
+	if os.Getenv("VAULT_ADDR") != "" {
+		vault, err := NewVaultFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, vault)
+	}
+	return chain, nil
+}
@@ -0,0 +1,97 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// vaultTimeout bounds the request that loads the secrets at startup.
+const vaultTimeout = 10 * time.Second
+
+// Vault serves secrets from one HashiCorp Vault KV secret, read once when
+// it is created. Each key of the secret is a secret name, so a KV secret
+// with the keys SMTP_PASSWORD and ADMIN_TOKEN supplies both.
+type Vault struct {
+	values map[string]string
+}
+
+// NewVaultFromEnv reads the secret at VAULT_SECRET_PATH (for example
+// secret/data/shortener for a KV version 2 engine mounted at secret/) from
+// VAULT_ADDR, authenticating with VAULT_TOKEN or the token in the file
+// named by VAULT_TOKEN_FILE. VAULT_NAMESPACE is sent when set.
+func NewVaultFromEnv() (*Vault, error) {
+	token := os.Getenv("VAULT_TOKEN")
+	if path := os.Getenv("VAULT_TOKEN_FILE"); path != "" {
+		v, err := readSecretFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("VAULT_TOKEN_FILE: %w", err)
+		}
+		token = v
+	}
+	path := os.Getenv("VAULT_SECRET_PATH")
+	if token == "" || path == "" {
+		return nil, fmt.Errorf("VAULT_ADDR requires VAULT_TOKEN (or VAULT_TOKEN_FILE) and VAULT_SECRET_PATH")
+	}
+	client := &http.Client{Timeout: vaultTimeout}
+	return NewVault(client, os.Getenv("VAULT_ADDR"), token, os.Getenv("VAULT_NAMESPACE"), path)
+}
+
+// NewVault reads the KV secret at path. Both KV engine versions are
+// understood: version 2 nests the values under data.data.
+func NewVault(client *http.Client, addr, token, namespace, path string) (*Vault, error) {
+	url := strings.TrimRight(addr, "/") + "/v1/" + strings.TrimLeft(path, "/")
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("vault answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var payload struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("invalid vault response: %w", err)
+	}
+	data := payload.Data
+	if nested, ok := data["data"]; ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = nil
+			if err := json.Unmarshal(nested, &data); err != nil {
+				return nil, fmt.Errorf("invalid vault KV v2 data: %w", err)
+			}
+		}
+	}
+
+	values := make(map[string]string, len(data))
+	for key, raw := range data {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			// Non-string values keep their JSON form.
+			s = string(raw)
+		}
+		values[key] = s
+	}
+	return &Vault{values: values}, nil
+}
+
+func (v *Vault) Lookup(name string) (string, bool, error) {
+	value, ok := v.values[name]
+	return value, ok && value != "", nil
+}
@@ -0,0 +1,66 @@
+// Package singleflight coalesces concurrent calls for the same key into
+// one: while a call is in flight, callers asking for the same key wait for
+// it and share its result instead of starting their own.
+package singleflight
+
+import (
+	"errors"
+	"sync"
+)
+
+// errPanicked is what waiters get when the call they wait for panics; the
+// panic itself goes on in the caller that ran it.
+var errPanicked = errors.New("singleflight: call panicked")
+
+type call[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+	dups  int
+}
+
+// Group runs calls keyed by string. The zero Group is ready to use.
+type Group[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*call[T]
+}
+
+// Do runs fn for key unless a call for key is already in flight, in which
+// case it waits for that call and returns its result. shared reports
+// whether the result went to more than one caller.
+func (g *Group[T]) Do(key string, fn func() (T, error)) (value T, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call[T])
+	}
+	if c, ok := g.calls[key]; ok {
+		c.dups++
+		g.mu.Unlock()
+		<-c.done
+		return c.value, c.err, true
+	}
+	c := &call[T]{done: make(chan struct{}), err: errPanicked}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		shared = c.dups > 0
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.value, c.err = fn()
+	return c.value, c.err, false
+}
+
+// Forget makes the next Do for key start a new call even if one is in
+// flight; callers already waiting still get the old call's result. It is
+// for results that a write has just made stale.
+func (g *Group[T]) Forget(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.calls, key)
+}
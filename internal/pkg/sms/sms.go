@@ -0,0 +1,71 @@
+// Package sms sends text messages through a provider with Twilio's
+// Messages API, which several other providers also offer.
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Sender sends text messages. to is a phone number in E.164 form, such as
+// +15551234567.
+type Sender interface {
+	Send(to, body string) error
+}
+
+// Doer sends the API requests; *outbound.Client is one.
+type Doer interface {
+	Do(purpose string, req *http.Request) (*http.Response, error)
+}
+
+// TwilioSender posts messages to
+// {BaseURL}/2010-04-01/Accounts/{AccountSID}/Messages.json, authenticated
+// with the account SID and auth token, from the number From.
+type TwilioSender struct {
+	baseURL    string
+	accountSID string
+	authToken  string
+	from       string
+	client     Doer
+}
+
+// NewTwilioSender creates the sender; baseURL is https://api.twilio.com
+// for Twilio itself.
+func NewTwilioSender(baseURL, accountSID, authToken, from string, client Doer) *TwilioSender {
+	return &TwilioSender{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		accountSID: accountSID,
+		authToken:  authToken,
+		from:       from,
+		client:     client,
+	}
+}
+
+func (s *TwilioSender) Send(to, body string) error {
+	form := url.Values{"To": {to}, "From": {s.from}, "Body": {body}}
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", s.baseURL, url.PathEscape(s.accountSID))
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(s.accountSID, s.authToken)
+
+	resp, err := s.client.Do("sms", req)
+	if err != nil {
+		return fmt.Errorf("sms to %s failed: %w", to, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("sms to %s failed: %s %s", to, resp.Status, apiErr.Message)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Package tasks runs background work on a bounded pool of workers, so that
+// request handlers never start goroutines of their own. Failed tasks are
+// retried with exponential backoff; tasks that run out of attempts, or do
+// not fit in the queue, are written to the log as dead letters.
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Options sizes a Pool. Zero fields take the defaults below.
+type Options struct {
+	Workers     int
+	QueueSize   int
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+const (
+	defaultWorkers     = 4
+	defaultQueueSize   = 1000
+	defaultMaxAttempts = 3
+	defaultBaseBackoff = time.Second
+	defaultMaxBackoff  = time.Minute
+)
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error that retrying cannot fix, such as a 4xx answer;
+// the task goes to the dead-letter log at once.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+type task struct {
+	name    string
+	fn      func() error
+	attempt int
+}
+
+// Pool is a fixed set of workers reading from a bounded queue.
+type Pool struct {
+	name string
+	opts Options
+
+	queue  chan task
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// New starts a pool; name prefixes its log lines.
+func New(name string, opts Options) *Pool {
+	if opts.Workers <= 0 {
+		opts.Workers = defaultWorkers
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = defaultBaseBackoff
+	}
+	if opts.MaxBackoff < opts.BaseBackoff {
+		opts.MaxBackoff = max(defaultMaxBackoff, opts.BaseBackoff)
+	}
+
+	p := &Pool{name: name, opts: opts, queue: make(chan task, opts.QueueSize)}
+	for i := 0; i < opts.Workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues fn without blocking. It returns false, after logging the
+// task as a dead letter, when the queue is full or the pool is stopped.
+func (p *Pool) Submit(name string, fn func() error) bool {
+	return p.enqueue(task{name: name, fn: fn, attempt: 1})
+}
+
+func (p *Pool) enqueue(t task) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		p.deadLetter(t, t.attempt-1, errors.New("pool stopped"))
+		return false
+	}
+	select {
+	case p.queue <- t:
+		return true
+	default:
+		p.deadLetter(t, t.attempt-1, errors.New("queue full"))
+		return false
+	}
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for t := range p.queue {
+		p.run(t)
+	}
+}
+
+func (p *Pool) run(t task) {
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = Permanent(fmt.Errorf("panic: %v", r))
+			}
+		}()
+		return t.fn()
+	}()
+	if err == nil {
+		return
+	}
+
+	var permanent permanentError
+	if errors.As(err, &permanent) || t.attempt >= p.opts.MaxAttempts {
+		p.deadLetter(t, t.attempt, err)
+		return
+	}
+
+	delay := p.backoff(t.attempt)
+	log.Printf("Task pool %s: %s failed (attempt %d of %d), retrying in %s: %v", p.name, t.name, t.attempt, p.opts.MaxAttempts, delay.Round(time.Millisecond), err)
+	t.attempt++
+	time.AfterFunc(delay, func() { p.enqueue(t) })
+}
+
+// backoff doubles the delay with every attempt, capped at MaxBackoff, and
+// spreads retries with up to 50% random jitter.
+func (p *Pool) backoff(attempt int) time.Duration {
+	d := p.opts.BaseBackoff << (attempt - 1)
+	if d <= 0 || d > p.opts.MaxBackoff {
+		d = p.opts.MaxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func (p *Pool) deadLetter(t task, attempts int, err error) {
+	log.Printf("Task pool %s: dead letter: %s dropped after %d attempt(s): %v", p.name, t.name, attempts, err)
+}
+
+// Stop stops accepting tasks and waits for the queued ones to finish.
+// Retries that come due afterwards are dead-lettered.
+func (p *Pool) Stop() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.queue)
+	p.mu.Unlock()
+	p.wg.Wait()
+}
@@ -0,0 +1,116 @@
+package utils
+
+import "strings"
+
+// base64URLAlphabet is the alphabet of GenerateRandomString.
+const base64URLAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// AddChecksum appends a Luhn mod N check character to code, computed over
+// the alphabet the code was generated from (readableAlphabet when readable
+// is set), so the check character is as easy to read as the rest. The
+// check catches every single mistyped character and most swaps of two
+// neighbouring ones.
+func AddChecksum(code string, readable bool) string {
+	alphabet := base64URLAlphabet
+	if readable {
+		alphabet = readableAlphabet
+	}
+	n := len(alphabet)
+	sum, factor := 0, 2
+	for i := len(code) - 1; i >= 0; i-- {
+		sum += luhnAddend(strings.IndexByte(alphabet, code[i]), factor, n)
+		factor = 3 - factor
+	}
+	return code + string(alphabet[(n-sum%n)%n])
+}
+
+// ValidChecksum reports whether the last character of code is the check
+// character AddChecksum would append to the rest, for either alphabet.
+func ValidChecksum(code string) bool {
+	if len(code) < 2 {
+		return false
+	}
+	if validLuhn(code, base64URLAlphabet) {
+		return true
+	}
+	return validLuhn(code, readableAlphabet)
+}
+
+func validLuhn(code, alphabet string) bool {
+	n := len(alphabet)
+	sum, factor := 0, 1
+	for i := len(code) - 1; i >= 0; i-- {
+		index := strings.IndexByte(alphabet, code[i])
+		if index < 0 {
+			return false
+		}
+		sum += luhnAddend(index, factor, n)
+		factor = 3 - factor
+	}
+	return sum%n == 0
+}
+
+func luhnAddend(index, factor, n int) int {
+	addend := factor * index
+	return addend/n + addend%n
+}
+
+// confusables groups characters that are commonly mistaken for each other
+// when a code is copied from print or read aloud.
+var confusables = []string{"0Oo", "1lIi", "5Ss", "2Zz", "8B", "6G", "9gq", "uvUV", "-_"}
+
+// ChecksumCorrections returns up to limit codes that differ from code by one
+// commonly confused character, a case change or a swap of two neighbouring
+// characters and that have a valid checksum.
+func ChecksumCorrections(code string, limit int) []string {
+	var corrections []string
+	seen := map[string]bool{code: true}
+	add := func(candidate string) bool {
+		if !seen[candidate] && ValidChecksum(candidate) {
+			seen[candidate] = true
+			corrections = append(corrections, candidate)
+		}
+		return len(corrections) >= limit
+	}
+
+	b := []byte(code)
+	for i := range b {
+		original := b[i]
+		for _, alt := range alternatives(original) {
+			b[i] = alt
+			if add(string(b)) {
+				return corrections
+			}
+		}
+		b[i] = original
+	}
+	for i := 0; i+1 < len(b); i++ {
+		b[i], b[i+1] = b[i+1], b[i]
+		done := add(string(b))
+		b[i], b[i+1] = b[i+1], b[i]
+		if done {
+			return corrections
+		}
+	}
+	return corrections
+}
+
+func alternatives(c byte) []byte {
+	var alts []byte
+	for _, group := range confusables {
+		if strings.IndexByte(group, c) >= 0 {
+			for i := 0; i < len(group); i++ {
+				if group[i] != c {
+					alts = append(alts, group[i])
+				}
+			}
+		}
+	}
+	switch {
+	case 'a' <= c && c <= 'z':
+		alts = append(alts, c-'a'+'A')
+	case 'A' <= c && c <= 'Z':
+		alts = append(alts, c-'A'+'a')
+	}
+	return alts
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"'\)\]]+`)
+
+// ExtractURLs returns the distinct http(s) URLs found in free text, in order
+// of first appearance, with trailing sentence punctuation stripped.
+func ExtractURLs(text string, limit int) []string {
+	seen := make(map[string]bool)
+	var urls []string
+	for _, match := range urlPattern.FindAllString(text, -1) {
+		match = strings.TrimRight(match, ".,;:!?")
+		if seen[match] {
+			continue
+		}
+		seen[match] = true
+		urls = append(urls, match)
+		if limit > 0 && len(urls) >= limit {
+			break
+		}
+	}
+	return urls
+}
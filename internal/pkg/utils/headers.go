@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const maxCustomHeaders = 20
+
+// CustomHeaderPrefix starts the names of free-form headers, such as
+// X-Link-Campaign, which no browser or proxy gives a meaning to.
+const CustomHeaderPrefix = "X-Link-"
+
+// allowedHeaders are the headers operators and link owners may add to
+// redirects besides custom ones: they describe or restrict the response
+// and cannot redirect elsewhere, set state on the service's origin or open
+// it to other origins, as Refresh, Strict-Transport-Security,
+// Clear-Site-Data, Alt-Svc or Access-Control-* headers would.
+var allowedHeaders = map[string]bool{
+	"Referrer-Policy":        true,
+	"X-Robots-Tag":           true,
+	"X-Content-Type-Options": true,
+	"X-Frame-Options":        true,
+	"Content-Language":       true,
+}
+
+// AllowedResponseHeader reports whether the header name may be added to
+// redirects.
+func AllowedResponseHeader(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	return allowedHeaders[name] || strings.HasPrefix(name, CustomHeaderPrefix) && len(name) > len(CustomHeaderPrefix)
+}
+
+// ValidateResponseHeaders checks custom response headers configured for
+// redirects: names must be valid HTTP tokens allowed by
+// AllowedResponseHeader, and values must not contain line breaks.
+func ValidateResponseHeaders(headers map[string]string) error {
+	if len(headers) > maxCustomHeaders {
+		return fmt.Errorf("too many headers (max %d)", maxCustomHeaders)
+	}
+	for name, value := range headers {
+		if name == "" || strings.IndexFunc(name, func(r rune) bool { return !isTokenRune(r) }) >= 0 {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if !AllowedResponseHeader(name) {
+			return fmt.Errorf("header %q is not allowed, use Referrer-Policy, X-Robots-Tag, X-Content-Type-Options, X-Frame-Options, Content-Language or a header starting with %s", name, CustomHeaderPrefix)
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return fmt.Errorf("invalid value for header %q", name)
+		}
+	}
+	return nil
+}
+
+func isTokenRune(r rune) bool {
+	if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+}
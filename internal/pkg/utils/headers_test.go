@@ -0,0 +1,31 @@
+package utils
+
+import "testing"
+
+func TestValidateResponseHeaders(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		headers map[string]string
+		ok      bool
+	}{
+		{"safe headers", map[string]string{"Referrer-Policy": "no-referrer", "x-robots-tag": "noindex"}, true},
+		{"custom header", map[string]string{"X-Link-Campaign": "spring"}, true},
+		{"bare custom prefix", map[string]string{"X-Link-": "spring"}, false},
+		{"location", map[string]string{"Location": "https://evil.example"}, false},
+		{"cookie", map[string]string{"Set-Cookie": "session=x"}, false},
+		{"refresh", map[string]string{"Refresh": "0; url=https://evil.example"}, false},
+		{"sts", map[string]string{"Strict-Transport-Security": "max-age=0"}, false},
+		{"clear site data", map[string]string{"Clear-Site-Data": `"*"`}, false},
+		{"alt-svc", map[string]string{"Alt-Svc": `h2="evil.example:443"`}, false},
+		{"cors", map[string]string{"Access-Control-Allow-Origin": "*"}, false},
+		{"csp", map[string]string{"Content-Security-Policy": "default-src *"}, false},
+		{"proxy internal redirect", map[string]string{"X-Accel-Redirect": "/internal"}, false},
+		{"invalid name", map[string]string{"X-Link-Bad Name": "x"}, false},
+		{"line break in value", map[string]string{"X-Link-Campaign": "a\r\nSet-Cookie: x"}, false},
+	} {
+		err := ValidateResponseHeaders(tt.headers)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: ValidateResponseHeaders(%v) = %v", tt.name, tt.headers, err)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"math/big"
+	"strings"
 )
 
 func GenerateRandomString(length int) (string, error) {
@@ -18,3 +20,32 @@ func GenerateRandomString(length int) (string, error) {
 	}
 	return randomString, nil
 }
+
+// readableAlphabet leaves out characters that are easily confused when a
+// code is read aloud or typed from print: 0/O/o and 1/I/i/l.
+const readableAlphabet = "23456789abcdefghjkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// GenerateReadableString returns a random string over readableAlphabet.
+func GenerateReadableString(length int) (string, error) {
+	out := make([]byte, length)
+	max := big.NewInt(int64(len(readableAlphabet)))
+	for i := range out {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		out[i] = readableAlphabet[n.Int64()]
+	}
+	return string(out), nil
+}
+
+// IsReadable reports whether s is made only of the characters of
+// readableAlphabet.
+func IsReadable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(readableAlphabet, s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
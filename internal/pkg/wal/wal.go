@@ -0,0 +1,271 @@
+// Package wal is an append-only log on local disk. Work is recorded in it
+// before it is done, so that the work can be done again after the process
+// crashes or while what it writes to is unavailable.
+//
+// The log is split into segment files. Every record appended is pending
+// until it is acknowledged: Ack when its work is done, Nack when it failed
+// and must be replayed. A segment is deleted once it is full and all its
+// records were acknowledged; segments left by an earlier run, and those
+// holding failed records, are returned by Backlog for replay.
+//
+// Records are handed to the operating system on every Append, so they
+// survive a crash of the process, and synced to disk when a segment is
+// closed; a crash of the machine can lose the latest ones.
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// segmentBytes is the size past which a new segment is started.
+const segmentBytes = 4 << 20
+
+const segmentExt = ".wal"
+
+// Log is a write-ahead log in a directory. It is safe for concurrent use.
+type Log struct {
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	file     *os.File
+	current  uint64
+	size     int64
+	segments map[uint64]*segment
+	closed   bool
+}
+
+// segment is the state of a segment file: how many of its records are
+// pending, whether one of them failed, and whether it is still written to.
+type segment struct {
+	pending int
+	failed  bool
+	open    bool
+}
+
+// Open opens the log in dir, creating the directory if needed. Segments
+// found there are kept for Backlog; new records go to a new segment.
+func Open(dir string) (*Log, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	l := &Log{dir: dir, maxBytes: segmentBytes, segments: map[uint64]*segment{}}
+	existing, err := l.list()
+	if err != nil {
+		return nil, err
+	}
+	for _, seq := range existing {
+		l.segments[seq] = &segment{failed: true}
+		l.current = seq
+	}
+	if err := l.rotate(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// list returns the sequence numbers of the segment files, oldest first.
+func (l *Log) list() ([]uint64, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+func (l *Log) path(seq uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%016d%s", seq, segmentExt))
+}
+
+// rotate closes the current segment and starts the next; l.mu must be
+// held, except from Open.
+func (l *Log) rotate() error {
+	if l.file != nil {
+		if err := l.file.Sync(); err != nil {
+			return err
+		}
+		if err := l.file.Close(); err != nil {
+			return err
+		}
+		l.file = nil
+		if seg := l.segments[l.current]; seg != nil {
+			seg.open = false
+			l.release(l.current, seg)
+		}
+	}
+	next := l.current + 1
+	file, err := os.OpenFile(l.path(next), os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	l.file, l.current, l.size = file, next, 0
+	l.segments[next] = &segment{open: true}
+	return nil
+}
+
+// release deletes seq once nothing in it is left to do; l.mu must be held.
+func (l *Log) release(seq uint64, seg *segment) {
+	if seg.open || seg.failed || seg.pending > 0 {
+		return
+	}
+	delete(l.segments, seq)
+	os.Remove(l.path(seq))
+}
+
+// Append writes record, which must not contain a newline, and returns the
+// segment it is in, to acknowledge it with.
+func (l *Log) Append(record []byte) (uint64, error) {
+	if bytes.IndexByte(record, '\n') >= 0 {
+		return 0, errors.New("wal: record contains a newline")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return 0, errors.New("wal: log closed")
+	}
+	if l.size >= l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	line := make([]byte, len(record)+1)
+	copy(line, record)
+	line[len(record)] = '\n'
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	l.segments[l.current].pending++
+	return l.current, nil
+}
+
+// Ack marks a record of segment as done.
+func (l *Log) Ack(segment uint64) {
+	l.settle(segment, false)
+}
+
+// Nack marks a record of segment as failed: the segment is kept and
+// returned by Backlog.
+func (l *Log) Nack(segment uint64) {
+	l.settle(segment, true)
+}
+
+func (l *Log) settle(seq uint64, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	seg := l.segments[seq]
+	// A segment replayed while its records were pending is gone.
+	if seg == nil || l.closed {
+		return
+	}
+	seg.pending--
+	seg.failed = seg.failed || failed
+	l.release(seq, seg)
+}
+
+// Backlog returns the segments to replay, oldest first: those found by
+// Open and those with a failed record. The current segment is closed first
+// when it has one.
+func (l *Log) Backlog() ([]uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, nil
+	}
+	if seg := l.segments[l.current]; seg.failed {
+		if err := l.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	var seqs []uint64
+	for seq, seg := range l.segments {
+		if seg.failed && !seg.open {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+// Replay reads the records of a segment returned by Backlog and passes them
+// to fn, then deletes the segment when fn succeeds. A record cut short by a
+// crash is left out.
+func (l *Log) Replay(segment uint64, fn func(records [][]byte) error) error {
+	file, err := os.Open(l.path(segment))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var records [][]byte
+	r := bufio.NewReader(file)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(line) > 1 {
+			records = append(records, line[:len(line)-1])
+		}
+	}
+	if err := fn(records); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.segments, segment)
+	return os.Remove(l.path(segment))
+}
+
+// Close closes the current segment, deleting it when all its records were
+// acknowledged. Segments with records pending are kept for the next Open.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	if err := l.file.Sync(); err != nil {
+		l.file.Close()
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	seg := l.segments[l.current]
+	seg.open = false
+	l.release(l.current, seg)
+	return nil
+}
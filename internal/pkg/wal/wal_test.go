@@ -0,0 +1,136 @@
+package wal
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func replayAll(t *testing.T, l *Log) []string {
+	t.Helper()
+	backlog, err := l.Backlog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, seq := range backlog {
+		err := l.Replay(seq, func(records [][]byte) error {
+			for _, r := range records {
+				got = append(got, string(r))
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return got
+}
+
+func TestReplay(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		settle func(l *Log, seq uint64)
+		want   []string
+	}{
+		{"acknowledged", (*Log).Ack, nil},
+		{"failed", (*Log).Nack, []string{"a", "b"}},
+	} {
+		l, err := Open(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range []string{"a", "b"} {
+			seq, err := l.Append([]byte(record))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.settle(l, seq)
+		}
+		if got := replayAll(t, l); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: replayed %q, want %q", tt.name, got, tt.want)
+		}
+		// A replayed segment is gone and not replayed again.
+		if got := replayAll(t, l); got != nil {
+			t.Errorf("%s: replayed %q a second time", tt.name, got)
+		}
+		l.Close()
+	}
+}
+
+func TestReplayAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, err := l.Append([]byte("done"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Ack(seq)
+	for _, record := range []string{"pending-1", "pending-2"} {
+		if _, err := l.Append([]byte(record)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := l.path(seq)
+	l.Close()
+
+	// A crash in the middle of a write leaves a record without its newline.
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("pend")
+	file.Close()
+
+	l, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	want := []string{"done", "pending-1", "pending-2"}
+	if got := replayAll(t, l); !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed %q, want %q", got, want)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("replayed segment still exists: %v", err)
+	}
+}
+
+func TestReplayFailureKeepsSegment(t *testing.T) {
+	l, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	seq, err := l.Append([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Nack(seq)
+	backlog, err := l.Backlog()
+	if err != nil || len(backlog) != 1 {
+		t.Fatalf("Backlog = %v, %v", backlog, err)
+	}
+	unavailable := errors.New("unavailable")
+	if err := l.Replay(backlog[0], func([][]byte) error { return unavailable }); !errors.Is(err, unavailable) {
+		t.Fatalf("Replay error = %v", err)
+	}
+	if got := replayAll(t, l); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("replayed %q after a failed replay, want [a]", got)
+	}
+}
+
+func TestAppendRejectsNewline(t *testing.T) {
+	l, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.Append([]byte("a\nforged")); err == nil {
+		t.Error("Append accepted a record with a newline")
+	}
+}
@@ -0,0 +1,167 @@
+// Package xlsx streams a single-sheet Office Open XML workbook (.xlsx).
+// Rows are written to the sheet as they come, so a workbook of any size
+// is produced without holding it in memory. It covers what a data export
+// needs: text and whole numbers, no styles or formulas.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of the workbooks a Writer produces.
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// maxCellChars is the most characters a cell may hold; longer text is
+// cut, since spreadsheet applications refuse the workbook otherwise.
+const maxCellChars = 32767
+
+// maxSheetName is the longest sheet name spreadsheet applications accept.
+const maxSheetName = 31
+
+const (
+	contentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	packageRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	workbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+	workbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	sheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	sheetEnd = `</sheetData></worksheet>`
+)
+
+// Writer writes the rows of one sheet. Close must be called to finish the
+// workbook; it does not close the underlying writer.
+type Writer struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+	err   error
+}
+
+// NewWriter starts a workbook on w with one sheet called sheet.
+func NewWriter(w io.Writer, sheet string) (*Writer, error) {
+	z := zip.NewWriter(w)
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", packageRels},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+		{"xl/workbook.xml", fmt.Sprintf(workbook, escape(sheetName(sheet)))},
+	}
+	for _, part := range parts {
+		f, err := z.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return nil, err
+		}
+	}
+	f, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	x := &Writer{zip: z, sheet: bufio.NewWriter(f)}
+	x.sheet.WriteString(sheetStart)
+	return x, nil
+}
+
+// WriteRow appends a row. Cells that hold a whole number without leading
+// zeros are stored as numbers, everything else as text.
+func (x *Writer) WriteRow(cells []string) error {
+	if x.err != nil {
+		return x.err
+	}
+	x.rows++
+	row := strconv.Itoa(x.rows)
+	x.sheet.WriteString(`<row r="` + row + `">`)
+	for i, cell := range cells {
+		ref := column(i) + row
+		if isNumber(cell) {
+			x.sheet.WriteString(`<c r="` + ref + `"><v>` + cell + `</v></c>`)
+			continue
+		}
+		x.sheet.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">` + escape(truncate(cell)) + `</t></is></c>`)
+	}
+	_, x.err = x.sheet.WriteString(`</row>`)
+	return x.err
+}
+
+// Close finishes the sheet and the workbook.
+func (x *Writer) Close() error {
+	if x.err != nil {
+		return x.err
+	}
+	x.sheet.WriteString(sheetEnd)
+	if x.err = x.sheet.Flush(); x.err != nil {
+		return x.err
+	}
+	x.err = x.zip.Close()
+	return x.err
+}
+
+// column names the i-th column, counting from 0: A, B, ..., Z, AA, AB, ...
+func column(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// isNumber reports whether cell is a whole number a spreadsheet keeps
+// exactly: at most 15 digits and no leading zero, so codes like "007"
+// stay text.
+func isNumber(cell string) bool {
+	if cell == "" || len(cell) > 15 || (len(cell) > 1 && cell[0] == '0') {
+		return false
+	}
+	for _, c := range cell {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func truncate(cell string) string {
+	if len(cell) <= maxCellChars || utf8.RuneCountInString(cell) <= maxCellChars {
+		return cell
+	}
+	return string([]rune(cell)[:maxCellChars])
+}
+
+// sheetName drops the characters sheet names may not contain and cuts the
+// name to the length spreadsheet applications accept.
+func sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return -1
+		}
+		return r
+	}, name)
+	if utf8.RuneCountInString(name) > maxSheetName {
+		name = string([]rune(name)[:maxSheetName])
+	}
+	if name == "" {
+		name = "Sheet1"
+	}
+	return name
+}
+
+// escape makes s safe as XML text or an attribute value. Characters XML
+// cannot carry at all are replaced with U+FFFD.
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
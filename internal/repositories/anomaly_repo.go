@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// AnomalyRepository stores the click spikes the anomaly detector flagged.
+type AnomalyRepository interface {
+	InitSchema() error
+	RecordAnomaly(anomaly shortner.ClickAnomaly) (int64, error)
+	// LastDetected returns when a spike was last flagged on each of codes
+	// that ever had one.
+	LastDetected(codes []string) (map[string]time.Time, error)
+	// ListAnomalies lists the flagged spikes newest first, from before
+	// beforeID unless it is 0.
+	ListAnomalies(beforeID int64, limit int) ([]shortner.ClickAnomaly, error)
+}
+
+type SQLiteAnomalyRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteAnomalyRepo(db *sql.DB) *SQLiteAnomalyRepo {
+	return &SQLiteAnomalyRepo{db: db}
+}
+
+func (r *SQLiteAnomalyRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS click_anomalies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		short_code TEXT NOT NULL,
+		clicks INTEGER NOT NULL,
+		expected REAL NOT NULL,
+		factor REAL NOT NULL,
+		window_start TIMESTAMP NOT NULL,
+		detected_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_click_anomalies_short_code ON click_anomalies(short_code, detected_at);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing click anomalies schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLiteAnomalyRepo) RecordAnomaly(anomaly shortner.ClickAnomaly) (int64, error) {
+	res, err := r.db.Exec("INSERT INTO click_anomalies(short_code, clicks, expected, factor, window_start, detected_at) VALUES(?, ?, ?, ?, ?, ?)",
+		anomaly.ShortCode, anomaly.Clicks, anomaly.Expected, anomaly.Factor, anomaly.WindowStart.UTC(), anomaly.DetectedAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *SQLiteAnomalyRepo) LastDetected(codes []string) (map[string]time.Time, error) {
+	last := make(map[string]time.Time)
+	if len(codes) == 0 {
+		return last, nil
+	}
+	args := make([]interface{}, len(codes))
+	for i, code := range codes {
+		args[i] = code
+	}
+	rows, err := r.db.Query("SELECT short_code, detected_at FROM click_anomalies WHERE short_code IN ("+
+		strings.TrimSuffix(strings.Repeat("?, ", len(codes)), ", ")+") ORDER BY detected_at ASC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code string
+		var detectedAt time.Time
+		if err := rows.Scan(&code, &detectedAt); err != nil {
+			return nil, err
+		}
+		last[code] = detectedAt
+	}
+	return last, rows.Err()
+}
+
+func (r *SQLiteAnomalyRepo) ListAnomalies(beforeID int64, limit int) ([]shortner.ClickAnomaly, error) {
+	query, args := "SELECT id, short_code, clicks, expected, factor, window_start, detected_at FROM click_anomalies", []interface{}{}
+	if beforeID > 0 {
+		query += " WHERE id < ?"
+		args = append(args, beforeID)
+	}
+	rows, err := r.db.Query(query+" ORDER BY id DESC LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var anomalies []shortner.ClickAnomaly
+	for rows.Next() {
+		var a shortner.ClickAnomaly
+		if err := rows.Scan(&a.ID, &a.ShortCode, &a.Clicks, &a.Expected, &a.Factor, &a.WindowStart, &a.DetectedAt); err != nil {
+			return nil, err
+		}
+		anomalies = append(anomalies, a)
+	}
+	return anomalies, rows.Err()
+}
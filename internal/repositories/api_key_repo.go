@@ -0,0 +1,221 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// APIKeyRepository stores the API keys provisioned through the admin API,
+// by the ID the client chose. Only the hash of a key is stored.
+type APIKeyRepository interface {
+	InitSchema() error
+	// ListAPIKeys returns the keys by ID.
+	ListAPIKeys() ([]shortner.APIKey, error)
+	GetAPIKey(id string) (*shortner.APIKey, error)
+	// GetAPIKeyByHash returns the key whose secret or previous secret has
+	// the hash hash, whether they expired or not.
+	GetAPIKeyByHash(hash string) (*shortner.APIKey, error)
+	// PutAPIKey inserts key, or updates the name, scopes and expiry of the
+	// key with its ID and keeps its hashes and creator. created reports
+	// whether it was inserted.
+	PutAPIKey(key shortner.APIKey) (stored *shortner.APIKey, created bool, err error)
+	// RotateAPIKey gives the key id the secret with the hash hash, and
+	// keeps its current secret as the previous one until previousExpiresAt.
+	RotateAPIKey(id, hash string, previousExpiresAt, now time.Time) (*shortner.APIKey, error)
+	DeleteAPIKey(id string) error
+	// TouchAPIKey records that the key id was used at usedAt.
+	TouchAPIKey(id string, usedAt time.Time) error
+}
+
+type SQLiteAPIKeyRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteAPIKeyRepo(db *sql.DB) *SQLiteAPIKeyRepo {
+	return &SQLiteAPIKeyRepo{db: db}
+}
+
+func (r *SQLiteAPIKeyRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL DEFAULT '',
+		key_hash TEXT NOT NULL UNIQUE,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		scopes TEXT NOT NULL DEFAULT 'admin',
+		created_by TEXT NOT NULL DEFAULT '',
+		last_used_at TIMESTAMP NULL,
+		expires_at TIMESTAMP NULL,
+		previous_key_hash TEXT NULL,
+		previous_key_expires_at TIMESTAMP NULL
+	);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing API keys schema: %v", err)
+		return err
+	}
+	// Keys created before scopes existed keep the access they had.
+	if err := ensureColumn(r.db, "api_keys", "scopes", "TEXT NOT NULL DEFAULT 'admin'"); err != nil {
+		return err
+	}
+	if err := ensureColumn(r.db, "api_keys", "created_by", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	for _, column := range []string{"last_used_at", "expires_at", "previous_key_expires_at"} {
+		if err := ensureColumn(r.db, "api_keys", column, "TIMESTAMP NULL"); err != nil {
+			return err
+		}
+	}
+	if err := ensureColumn(r.db, "api_keys", "previous_key_hash", "TEXT NULL"); err != nil {
+		return err
+	}
+	_, err = r.db.Exec("CREATE INDEX IF NOT EXISTS idx_api_keys_previous_key_hash ON api_keys(previous_key_hash) WHERE previous_key_hash IS NOT NULL")
+	return err
+}
+
+const apiKeyColumns = "id, name, key_hash, created_at, updated_at, scopes, created_by, last_used_at, expires_at, previous_key_hash, previous_key_expires_at"
+
+// Scopes are stored separated by spaces, as in OAuth.
+func scanAPIKey(row rowScanner) (*shortner.APIKey, error) {
+	var (
+		k                                        shortner.APIKey
+		scopes                                   string
+		previousHash                             sql.NullString
+		lastUsedAt, expiresAt, previousExpiresAt sql.NullTime
+	)
+	if err := row.Scan(&k.ID, &k.Name, &k.KeyHash, &k.CreatedAt, &k.UpdatedAt, &scopes, &k.CreatedBy, &lastUsedAt, &expiresAt, &previousHash, &previousExpiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	k.Scopes = strings.Fields(scopes)
+	k.PreviousKeyHash = previousHash.String
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
+	if previousExpiresAt.Valid {
+		k.PreviousKeyExpiresAt = &previousExpiresAt.Time
+	}
+	return &k, nil
+}
+
+func sameExpiry(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func (r *SQLiteAPIKeyRepo) ListAPIKeys() ([]shortner.APIKey, error) {
+	rows, err := r.db.Query("SELECT " + apiKeyColumns + " FROM api_keys ORDER BY id ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []shortner.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+func (r *SQLiteAPIKeyRepo) GetAPIKey(id string) (*shortner.APIKey, error) {
+	return scanAPIKey(r.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id))
+}
+
+func (r *SQLiteAPIKeyRepo) GetAPIKeyByHash(hash string) (*shortner.APIKey, error) {
+	return scanAPIKey(r.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ? OR previous_key_hash = ?", hash, hash))
+}
+
+func (r *SQLiteAPIKeyRepo) PutAPIKey(key shortner.APIKey) (*shortner.APIKey, bool, error) {
+	scopes := strings.Join(key.Scopes, " ")
+	res, err := r.db.Exec("INSERT INTO api_keys(id, name, key_hash, created_at, updated_at, scopes, created_by, expires_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT(id) DO NOTHING",
+		key.ID, key.Name, key.KeyHash, key.CreatedAt.UTC(), key.UpdatedAt.UTC(), scopes, key.CreatedBy, utcTime(key.ExpiresAt))
+	if err != nil {
+		return nil, false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+	created := n == 1
+	if !created {
+		stored, err := r.GetAPIKey(key.ID)
+		if err != nil {
+			return nil, false, err
+		}
+		if stored.Name != key.Name || strings.Join(stored.Scopes, " ") != scopes || !sameExpiry(stored.ExpiresAt, key.ExpiresAt) {
+			if _, err := r.db.Exec("UPDATE api_keys SET name = ?, scopes = ?, expires_at = ?, updated_at = ? WHERE id = ?",
+				key.Name, scopes, utcTime(key.ExpiresAt), key.UpdatedAt.UTC(), key.ID); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+	stored, err := r.GetAPIKey(key.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	return stored, created, nil
+}
+
+func (r *SQLiteAPIKeyRepo) DeleteAPIKey(id string) error {
+	res, err := r.db.Exec("DELETE FROM api_keys WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteAPIKeyRepo) RotateAPIKey(id, hash string, previousExpiresAt, now time.Time) (*shortner.APIKey, error) {
+	res, err := r.db.Exec("UPDATE api_keys SET previous_key_hash = key_hash, previous_key_expires_at = ?, key_hash = ?, updated_at = ? WHERE id = ?",
+		previousExpiresAt.UTC(), hash, now.UTC(), id)
+	if err != nil {
+		return nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrNotFound
+	}
+	return r.GetAPIKey(id)
+}
+
+func (r *SQLiteAPIKeyRepo) TouchAPIKey(id string, usedAt time.Time) error {
+	res, err := r.db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", usedAt.UTC(), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+type BundleRepository interface {
+	InitSchema() error
+	AddItem(item shortner.BundleItem) (int64, error)
+	GetItem(shortCode string, id int64) (*shortner.BundleItem, error)
+	ListItems(shortCode string) ([]shortner.BundleItem, error)
+	UpdateItem(item shortner.BundleItem) error
+	DeleteItem(shortCode string, id int64) error
+	DeleteItems(shortCode string) error
+}
+
+type SQLiteBundleRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteBundleRepo(db *sql.DB) *SQLiteBundleRepo {
+	return &SQLiteBundleRepo{db: db}
+}
+
+func (r *SQLiteBundleRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS bundle_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		short_code TEXT NOT NULL,
+		title TEXT NOT NULL DEFAULT '',
+		url TEXT NOT NULL,
+		position INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_bundle_items_short_code ON bundle_items(short_code);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing bundle_items schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLiteBundleRepo) AddItem(item shortner.BundleItem) (int64, error) {
+	if item.CreatedAt.IsZero() {
+		item.CreatedAt = time.Now()
+	}
+	res, err := r.db.Exec("INSERT INTO bundle_items(short_code, title, url, position, created_at) VALUES(?, ?, ?, ?, ?)",
+		item.ShortCode, item.Title, item.URL, item.Position, item.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *SQLiteBundleRepo) GetItem(shortCode string, id int64) (*shortner.BundleItem, error) {
+	var item shortner.BundleItem
+	err := r.db.QueryRow("SELECT id, short_code, title, url, position, created_at FROM bundle_items WHERE short_code = ? AND id = ?", shortCode, id).
+		Scan(&item.ID, &item.ShortCode, &item.Title, &item.URL, &item.Position, &item.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *SQLiteBundleRepo) ListItems(shortCode string) ([]shortner.BundleItem, error) {
+	rows, err := r.db.Query("SELECT id, short_code, title, url, position, created_at FROM bundle_items WHERE short_code = ? ORDER BY position ASC, id ASC", shortCode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []shortner.BundleItem
+	for rows.Next() {
+		var item shortner.BundleItem
+		if err := rows.Scan(&item.ID, &item.ShortCode, &item.Title, &item.URL, &item.Position, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *SQLiteBundleRepo) UpdateItem(item shortner.BundleItem) error {
+	res, err := r.db.Exec("UPDATE bundle_items SET title = ?, url = ?, position = ? WHERE short_code = ? AND id = ?",
+		item.Title, item.URL, item.Position, item.ShortCode, item.ID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *SQLiteBundleRepo) DeleteItem(shortCode string, id int64) error {
+	res, err := r.db.Exec("DELETE FROM bundle_items WHERE short_code = ? AND id = ?", shortCode, id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *SQLiteBundleRepo) DeleteItems(shortCode string) error {
+	_, err := r.db.Exec("DELETE FROM bundle_items WHERE short_code = ?", shortCode)
+	return err
+}
+
+// expectAffected turns an UPDATE or DELETE that matched no row into
+// ErrNotFound.
+func expectAffected(res sql.Result) error {
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+package repositories
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"template/internal/pkg/metrics"
+	"template/internal/usecases/shortner"
+)
+
+// CachedShortenerRepo keeps the most recently looked up links in memory, at
+// most size of them, each for at most ttl. With a missTTL it also
+// remembers, for that long, the codes that were looked up and not found
+// (again at most size of them, apart from the links), so that a client
+// repeating a bogus code does not reach the database each time. Changes
+// made through it, creating a link included, drop the changed codes from
+// the cache at once; changes made by other instances are seen once the
+// cached entry expires. Only GetMapping is served from the cache: the other
+// lookups decide whether links are created and always reach the database.
+//
+// With EnableStale, expired links are kept a while longer and served,
+// marked Stale, when the database cannot be reached, so that redirects
+// survive an outage.
+//
+// The entries are split across shards by a hash of the code, each with its
+// own lock and an equal part of size, so that lookups of different codes
+// do not wait on each other; SetShards picks how many.
+type CachedShortenerRepo struct {
+	next            ShortenerRepository
+	size            int
+	ttl             time.Duration
+	missTTL         time.Duration
+	caseInsensitive bool
+
+	shards []*cacheShard
+}
+
+// cacheShard is the part of the cache holding the codes that hash to it.
+type cacheShard struct {
+	mu     sync.Mutex
+	links  *lru
+	misses *lru
+	// writes counts the changes made through the repository, so that a
+	// lookup racing a change does not cache what it read before it.
+	writes uint64
+
+	// hits, missed and evictions are nil until EnableMetrics.
+	hits      *metrics.Counter
+	missed    *metrics.Counter
+	evictions *metrics.Counter
+}
+
+// NewCachedShortenerRepo creates the cache; a zero missTTL caches no
+// misses. caseInsensitive must match the repository's, so that a change to
+// one spelling of a code drops the others.
+func NewCachedShortenerRepo(next ShortenerRepository, size int, ttl, missTTL time.Duration, caseInsensitive bool) *CachedShortenerRepo {
+	r := &CachedShortenerRepo{
+		next:            next,
+		size:            size,
+		ttl:             ttl,
+		missTTL:         missTTL,
+		caseInsensitive: caseInsensitive,
+	}
+	r.SetShards(1)
+	return r
+}
+
+// SetShards splits the cache into n shards, emptying it; it must be called
+// before the cache is used, and before EnableStale and EnableMetrics.
+func (r *CachedShortenerRepo) SetShards(n int) {
+	n = max(n, 1)
+	perShard := (r.size + n - 1) / n
+	r.shards = make([]*cacheShard, n)
+	for i := range r.shards {
+		r.shards[i] = &cacheShard{links: newLRU(perShard), misses: newLRU(perShard)}
+	}
+}
+
+// EnableStale keeps links for staleTTL past their TTL, to serve when
+// looking them up again fails because the database is unavailable.
+func (r *CachedShortenerRepo) EnableStale(staleTTL time.Duration) {
+	for _, shard := range r.shards {
+		shard.mu.Lock()
+		shard.links.grace = staleTTL
+		shard.mu.Unlock()
+	}
+}
+
+// EnableMetrics counts, per shard, the lookups answered from the cache
+// (a link or a code known to be missing), those that reached the
+// repository, and the entries evicted to make room.
+func (r *CachedShortenerRepo) EnableMetrics(reg *metrics.Registry) {
+	hits := reg.NewCounterVec("shortener_link_cache_hits_total",
+		"Link lookups answered from the cache, by shard.", "shard")
+	misses := reg.NewCounterVec("shortener_link_cache_misses_total",
+		"Link lookups that were not cached and reached the database, by shard.", "shard")
+	evictions := reg.NewCounterVec("shortener_link_cache_evictions_total",
+		"Cache entries evicted to make room for others, by shard.", "shard")
+	for i, shard := range r.shards {
+		label := strconv.Itoa(i)
+		shard.mu.Lock()
+		shard.hits = hits.WithLabelValues(label)
+		shard.missed = misses.WithLabelValues(label)
+		shard.evictions = evictions.WithLabelValues(label)
+		shard.mu.Unlock()
+	}
+}
+
+// shard returns the shard of key.
+func (r *CachedShortenerRepo) shard(key string) *cacheShard {
+	if len(r.shards) == 1 {
+		return r.shards[0]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return r.shards[h.Sum32()%uint32(len(r.shards))]
+}
+
+// count adds n to counter, when metrics are enabled.
+func count(counter *metrics.Counter, n int) {
+	if counter != nil && n > 0 {
+		counter.Add(float64(n))
+	}
+}
+
+func (r *CachedShortenerRepo) key(shortCode string) string {
+	if r.caseInsensitive {
+		return strings.ToLower(shortCode)
+	}
+	return shortCode
+}
+
+// Warm loads the links with codes, most wanted first, into the cache,
+// skipping the ones that no longer exist, and returns how many it loaded.
+// They are loaded in reverse so that the first code is the last evicted.
+func (r *CachedShortenerRepo) Warm(codes []string) (int, error) {
+	loaded := 0
+	for i := len(codes) - 1; i >= 0; i-- {
+		if _, err := r.load(codes[i]); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return loaded, err
+		}
+		loaded++
+	}
+	return loaded, nil
+}
+
+// load reads the link from the repository and caches it, or its absence,
+// unless a change was made while it was read.
+func (r *CachedShortenerRepo) load(shortCode string) (*shortner.URLMapping, error) {
+	key := r.key(shortCode)
+	shard := r.shard(key)
+	shard.mu.Lock()
+	writes := shard.writes
+	count(shard.missed, 1)
+	shard.mu.Unlock()
+
+	mapping, err := r.next.GetMapping(shortCode)
+	if Unavailable(err) {
+		shard.mu.Lock()
+		stale := shard.links.stale(key, time.Now())
+		shard.mu.Unlock()
+		if stale != nil {
+			stale.Stale = true
+			return stale, nil
+		}
+	}
+	if err != nil && (!errors.Is(err, ErrNotFound) || r.missTTL <= 0) {
+		return nil, err
+	}
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if shard.writes != writes {
+		return mapping, err
+	}
+	now := time.Now()
+	if err != nil {
+		count(shard.evictions, shard.misses.put(key, nil, now.Add(r.missTTL)))
+		return nil, err
+	}
+	count(shard.evictions, shard.links.put(key, mapping, now.Add(r.ttl)))
+	return mapping, nil
+}
+
+// wrote drops the changed codes from the cache.
+func (r *CachedShortenerRepo) wrote(shortCodes ...string) {
+	for _, shortCode := range shortCodes {
+		key := r.key(shortCode)
+		shard := r.shard(key)
+		shard.mu.Lock()
+		shard.writes++
+		shard.links.remove(key)
+		shard.misses.remove(key)
+		shard.mu.Unlock()
+	}
+}
+
+// lru holds up to size entries, evicting the least recently used first.
+// Expired entries are kept for grace more, for stale. Callers lock.
+type lru struct {
+	size    int
+	grace   time.Duration
+	entries map[string]*list.Element
+	// order holds the entries, most recently used first.
+	order *list.List
+}
+
+type lruEntry struct {
+	key     string
+	mapping shortner.URLMapping
+	expires time.Time
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// get returns a copy of the entry's mapping, nil for a cached miss.
+func (c *lru) get(key string, now time.Time) (mapping *shortner.URLMapping, ok bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if !now.Before(entry.expires) {
+		if !now.Before(entry.expires.Add(c.grace)) {
+			c.remove(key)
+		}
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	if entry.mapping.ShortCode == "" {
+		return nil, true
+	}
+	copied := entry.mapping
+	return &copied, true
+}
+
+// stale returns a copy of the entry's mapping, expired or not, while it is
+// within its grace; nil for a miss or when there is none.
+func (c *lru) stale(key string, now time.Time) *shortner.URLMapping {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*lruEntry)
+	if entry.mapping.ShortCode == "" || !now.Before(entry.expires.Add(c.grace)) {
+		return nil
+	}
+	copied := entry.mapping
+	return &copied
+}
+
+// put stores a copy of mapping, or a miss when it is nil, and returns how
+// many entries it evicted to make room.
+func (c *lru) put(key string, mapping *shortner.URLMapping, expires time.Time) (evicted int) {
+	entry := &lruEntry{key: key, expires: expires}
+	if mapping != nil {
+		entry.mapping = *mapping
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return 0
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back().Value.(*lruEntry).key)
+		evicted++
+	}
+	return evicted
+}
+
+func (c *lru) remove(key string) {
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+func (r *CachedShortenerRepo) InitSchema() error {
+	return r.next.InitSchema()
+}
+
+func (r *CachedShortenerRepo) SaveMapping(shortCode, longURL string) (int64, error) {
+	defer r.wrote(shortCode)
+	return r.next.SaveMapping(shortCode, longURL)
+}
+
+func (r *CachedShortenerRepo) CreateMapping(mapping shortner.URLMapping) (int64, error) {
+	defer r.wrote(mapping.ShortCode)
+	return r.next.CreateMapping(mapping)
+}
+
+func (r *CachedShortenerRepo) FindByShortCode(shortCode string) (string, error) {
+	return r.next.FindByShortCode(shortCode)
+}
+
+// GetMapping returns a copy of the cached link; the maps and slices in it
+// are shared with the cache and must not be changed.
+func (r *CachedShortenerRepo) GetMapping(shortCode string) (*shortner.URLMapping, error) {
+	key := r.key(shortCode)
+	shard := r.shard(key)
+	now := time.Now()
+	shard.mu.Lock()
+	mapping, ok := shard.links.get(key, now)
+	if !ok {
+		_, ok = shard.misses.get(key, now)
+	}
+	if ok {
+		count(shard.hits, 1)
+	}
+	shard.mu.Unlock()
+	switch {
+	case mapping != nil:
+		return mapping, nil
+	case ok:
+		return nil, ErrNotFound
+	}
+	return r.load(shortCode)
+}
+
+func (r *CachedShortenerRepo) FindByLongURL(longURL string) (string, error) {
+	return findByLongURL(r.next, longURL)
+}
+
+func (r *CachedShortenerRepo) UpdateLongURL(shortCode, newLongURL string) error {
+	defer r.wrote(shortCode)
+	return r.next.UpdateLongURL(shortCode, newLongURL)
+}
+
+func (r *CachedShortenerRepo) UpdateMapping(mapping shortner.URLMapping) error {
+	defer r.wrote(mapping.ShortCode)
+	return r.next.UpdateMapping(mapping)
+}
+
+func (r *CachedShortenerRepo) ConsumeMapping(shortCode string, now time.Time) error {
+	defer r.wrote(shortCode)
+	return r.next.ConsumeMapping(shortCode, now)
+}
+
+func (r *CachedShortenerRepo) DeleteMapping(shortCode string) error {
+	defer r.wrote(shortCode)
+	return r.next.DeleteMapping(shortCode)
+}
+
+func (r *CachedShortenerRepo) ApplyBulk(updates []shortner.URLMapping, deletes []string) error {
+	codes := append([]string(nil), deletes...)
+	for _, mapping := range updates {
+		codes = append(codes, mapping.ShortCode)
+	}
+	defer r.wrote(codes...)
+	return applyBulk(r.next, updates, deletes)
+}
+
+func (r *CachedShortenerRepo) Search(ctx context.Context, query string, page shortner.SearchPage) ([]shortner.URLMapping, error) {
+	return searchLinks(ctx, r.next, query, page)
+}
+
+func (r *CachedShortenerRepo) ListSince(afterID int64, limit int) ([]shortner.URLMapping, error) {
+	return listSince(r.next, afterID, limit)
+}
+
+func (r *CachedShortenerRepo) ListExpired(before time.Time, limit int) ([]shortner.URLMapping, error) {
+	return listExpired(r.next, before, limit)
+}
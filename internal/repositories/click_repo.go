@@ -0,0 +1,239 @@
+package repositories
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+type ClickRepository interface {
+	InitSchema() error
+	// RecordClick stores click and returns its ID, or 0 when a click with
+	// the same EventID is already stored.
+	RecordClick(click shortner.Click) (int64, error)
+	ListSince(afterID int64, limit int) ([]shortner.Click, error)
+	ListForLink(shortCode string, afterID int64, limit int) ([]shortner.Click, error)
+	// ListBetween lists the clicks on codes made in [from, to), by ID
+	// after afterID.
+	ListBetween(codes []string, from, to time.Time, afterID int64, limit int) ([]shortner.Click, error)
+	// TopLinks counts the clicks in [from, to) per link, restricted to codes
+	// unless it is empty, and returns the busiest links and the total.
+	TopLinks(codes []string, from, to time.Time, limit int) ([]shortner.LinkClicks, int64, error)
+	// CountPerPeriod counts the clicks in [from, to) on each of codes per
+	// hour or day (shortner.IntervalHour or IntervalDay), in UTC. Periods
+	// without clicks are left out.
+	CountPerPeriod(codes []string, from, to time.Time, interval string) ([]shortner.PeriodClicks, error)
+}
+
+// ClickBatchWriter is implemented by click repositories that can store
+// many clicks in one transaction. RecordClicks returns the IDs of the
+// clicks in order, 0 for those whose EventID is already stored; on error
+// none of them is stored.
+type ClickBatchWriter interface {
+	RecordClicks(clicks []shortner.Click) ([]int64, error)
+}
+
+type SQLiteClickRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteClickRepo(db *sql.DB) *SQLiteClickRepo {
+	return &SQLiteClickRepo{db: db}
+}
+
+func (r *SQLiteClickRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS clicks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		short_code TEXT NOT NULL,
+		clicked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		ip TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		referer TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_clicks_short_code ON clicks(short_code);
+	CREATE INDEX IF NOT EXISTS idx_clicks_clicked_at ON clicks(clicked_at);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing clicks schema: %v", err)
+		return err
+	}
+	if err := ensureColumn(r.db, "clicks", "item_id", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		log.Printf("Error migrating clicks schema: %v", err)
+		return err
+	}
+	if err := ensureColumn(r.db, "clicks", "event_id", "TEXT NULL"); err != nil {
+		log.Printf("Error migrating clicks schema: %v", err)
+		return err
+	}
+	_, err = r.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_clicks_event_id ON clicks(event_id) WHERE event_id IS NOT NULL")
+	if err != nil {
+		log.Printf("Error initializing clicks schema: %v", err)
+	}
+	return err
+}
+
+// insertClick skips a click whose event_id is already stored, so that
+// replaying logged clicks does not count them twice.
+const insertClick = "INSERT OR IGNORE INTO clicks(short_code, item_id, clicked_at, ip, user_agent, referer, event_id) VALUES(?, ?, ?, ?, ?, ?, NULLIF(?, ''))"
+
+// RecordClick stores clicked_at in UTC so that time range queries compare
+// timestamps with the same offset.
+func (r *SQLiteClickRepo) RecordClick(click shortner.Click) (int64, error) {
+	res, err := r.db.Exec(insertClick, click.ShortCode, click.ItemID, click.ClickedAt.UTC(), click.IP, click.UserAgent, click.Referer, click.EventID)
+	if err != nil {
+		return 0, err
+	}
+	return insertedID(res)
+}
+
+// insertedID is the ID of the row res inserted, or 0 when it was ignored.
+func insertedID(res sql.Result) (int64, error) {
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// RecordClicks stores the clicks in one transaction, so SQLite syncs the
+// database once per batch rather than once per click.
+func (r *SQLiteClickRepo) RecordClicks(clicks []shortner.Click) ([]int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(insertClick)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	ids := make([]int64, len(clicks))
+	for i, click := range clicks {
+		res, err := stmt.Exec(click.ShortCode, click.ItemID, click.ClickedAt.UTC(), click.IP, click.UserAgent, click.Referer, click.EventID)
+		if err != nil {
+			return nil, err
+		}
+		if ids[i], err = insertedID(res); err != nil {
+			return nil, err
+		}
+	}
+	return ids, tx.Commit()
+}
+
+func (r *SQLiteClickRepo) ListSince(afterID int64, limit int) ([]shortner.Click, error) {
+	rows, err := r.db.Query("SELECT id, short_code, item_id, clicked_at, ip, user_agent, referer FROM clicks WHERE id > ? ORDER BY id ASC LIMIT ?", afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanClicks(rows)
+}
+
+func (r *SQLiteClickRepo) ListForLink(shortCode string, afterID int64, limit int) ([]shortner.Click, error) {
+	rows, err := r.db.Query("SELECT id, short_code, item_id, clicked_at, ip, user_agent, referer FROM clicks WHERE short_code = ? AND id > ? ORDER BY id ASC LIMIT ?", shortCode, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanClicks(rows)
+}
+
+func (r *SQLiteClickRepo) ListBetween(codes []string, from, to time.Time, afterID int64, limit int) ([]shortner.Click, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	args := []interface{}{afterID, from.UTC(), to.UTC()}
+	for _, code := range codes {
+		args = append(args, code)
+	}
+	rows, err := r.db.Query("SELECT id, short_code, item_id, clicked_at, ip, user_agent, referer FROM clicks WHERE id > ? AND clicked_at >= ? AND clicked_at < ? AND short_code IN ("+
+		strings.TrimSuffix(strings.Repeat("?, ", len(codes)), ", ")+") ORDER BY id ASC LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanClicks(rows)
+}
+
+func scanClicks(rows *sql.Rows) ([]shortner.Click, error) {
+	defer rows.Close()
+
+	var clicks []shortner.Click
+	for rows.Next() {
+		var c shortner.Click
+		if err := rows.Scan(&c.ID, &c.ShortCode, &c.ItemID, &c.ClickedAt, &c.IP, &c.UserAgent, &c.Referer); err != nil {
+			return nil, err
+		}
+		clicks = append(clicks, c)
+	}
+	return clicks, rows.Err()
+}
+
+func (r *SQLiteClickRepo) TopLinks(codes []string, from, to time.Time, limit int) ([]shortner.LinkClicks, int64, error) {
+	where := "clicked_at >= ? AND clicked_at < ?"
+	args := []interface{}{from.UTC(), to.UTC()}
+	if len(codes) > 0 {
+		where += " AND short_code IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(codes)), ", ") + ")"
+		for _, code := range codes {
+			args = append(args, code)
+		}
+	}
+
+	var total int64
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM clicks WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query("SELECT short_code, COUNT(*) AS n FROM clicks WHERE "+where+" GROUP BY short_code ORDER BY n DESC, short_code ASC LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var top []shortner.LinkClicks
+	for rows.Next() {
+		var lc shortner.LinkClicks
+		if err := rows.Scan(&lc.ShortCode, &lc.Clicks); err != nil {
+			return nil, 0, err
+		}
+		top = append(top, lc)
+	}
+	return top, total, rows.Err()
+}
+
+func (r *SQLiteClickRepo) CountPerPeriod(codes []string, from, to time.Time, interval string) ([]shortner.PeriodClicks, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	period := "%Y-%m-%dT00:00:00Z"
+	if interval == shortner.IntervalHour {
+		period = "%Y-%m-%dT%H:00:00Z"
+	}
+	args := []interface{}{period, from.UTC(), to.UTC()}
+	for _, code := range codes {
+		args = append(args, code)
+	}
+	rows, err := r.db.Query("SELECT short_code, strftime(?, clicked_at) AS period, COUNT(*) FROM clicks WHERE clicked_at >= ? AND clicked_at < ? AND short_code IN ("+
+		strings.TrimSuffix(strings.Repeat("?, ", len(codes)), ", ")+") GROUP BY short_code, period ORDER BY period", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []shortner.PeriodClicks
+	for rows.Next() {
+		var pc shortner.PeriodClicks
+		var start string
+		if err := rows.Scan(&pc.ShortCode, &start, &pc.Clicks); err != nil {
+			return nil, err
+		}
+		if pc.Start, err = time.Parse(time.RFC3339, start); err != nil {
+			return nil, err
+		}
+		counts = append(counts, pc)
+	}
+	return counts, rows.Err()
+}
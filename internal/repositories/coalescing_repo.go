@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"template/internal/pkg/singleflight"
+	"template/internal/usecases/shortner"
+)
+
+// CoalescingShortenerRepo runs concurrent lookups of the same code as one
+// query: while FindByShortCode or GetMapping for a code is in flight, the
+// callers asking for it wait and share its result, a miss included. A link
+// going viral, or a scanner hammering one missing code, then costs one
+// query per round trip rather than one per request. A change to a code
+// stops later lookups from joining a query started before it, so they see
+// the change.
+type CoalescingShortenerRepo struct {
+	next     ShortenerRepository
+	longURLs singleflight.Group[string]
+	mappings singleflight.Group[*shortner.URLMapping]
+}
+
+func NewCoalescingShortenerRepo(next ShortenerRepository) *CoalescingShortenerRepo {
+	return &CoalescingShortenerRepo{next: next}
+}
+
+func (r *CoalescingShortenerRepo) wrote(shortCode string) {
+	r.longURLs.Forget(shortCode)
+	r.mappings.Forget(shortCode)
+}
+
+func (r *CoalescingShortenerRepo) InitSchema() error {
+	return r.next.InitSchema()
+}
+
+func (r *CoalescingShortenerRepo) SaveMapping(shortCode, longURL string) (int64, error) {
+	defer r.wrote(shortCode)
+	return r.next.SaveMapping(shortCode, longURL)
+}
+
+func (r *CoalescingShortenerRepo) CreateMapping(mapping shortner.URLMapping) (int64, error) {
+	defer r.wrote(mapping.ShortCode)
+	return r.next.CreateMapping(mapping)
+}
+
+func (r *CoalescingShortenerRepo) FindByShortCode(shortCode string) (string, error) {
+	longURL, err, _ := r.longURLs.Do(shortCode, func() (string, error) {
+		return r.next.FindByShortCode(shortCode)
+	})
+	return longURL, err
+}
+
+// GetMapping gives each caller sharing a result its own copy of the
+// mapping, so one caller setting a field does not affect the others. The
+// maps and slices in the copies are shared and must not be changed.
+func (r *CoalescingShortenerRepo) GetMapping(shortCode string) (*shortner.URLMapping, error) {
+	mapping, err, shared := r.mappings.Do(shortCode, func() (*shortner.URLMapping, error) {
+		return r.next.GetMapping(shortCode)
+	})
+	if err != nil || !shared {
+		return mapping, err
+	}
+	copied := *mapping
+	return &copied, nil
+}
+
+func (r *CoalescingShortenerRepo) FindByLongURL(longURL string) (string, error) {
+	return findByLongURL(r.next, longURL)
+}
+
+func (r *CoalescingShortenerRepo) UpdateLongURL(shortCode, newLongURL string) error {
+	defer r.wrote(shortCode)
+	return r.next.UpdateLongURL(shortCode, newLongURL)
+}
+
+func (r *CoalescingShortenerRepo) UpdateMapping(mapping shortner.URLMapping) error {
+	defer r.wrote(mapping.ShortCode)
+	return r.next.UpdateMapping(mapping)
+}
+
+func (r *CoalescingShortenerRepo) ConsumeMapping(shortCode string, now time.Time) error {
+	defer r.wrote(shortCode)
+	return r.next.ConsumeMapping(shortCode, now)
+}
+
+func (r *CoalescingShortenerRepo) DeleteMapping(shortCode string) error {
+	defer r.wrote(shortCode)
+	return r.next.DeleteMapping(shortCode)
+}
+
+func (r *CoalescingShortenerRepo) ApplyBulk(updates []shortner.URLMapping, deletes []string) error {
+	defer func() {
+		for _, mapping := range updates {
+			r.wrote(mapping.ShortCode)
+		}
+		for _, shortCode := range deletes {
+			r.wrote(shortCode)
+		}
+	}()
+	return applyBulk(r.next, updates, deletes)
+}
+
+func (r *CoalescingShortenerRepo) Search(ctx context.Context, query string, page shortner.SearchPage) ([]shortner.URLMapping, error) {
+	return searchLinks(ctx, r.next, query, page)
+}
+
+func (r *CoalescingShortenerRepo) ListSince(afterID int64, limit int) ([]shortner.URLMapping, error) {
+	return listSince(r.next, afterID, limit)
+}
+
+func (r *CoalescingShortenerRepo) ListExpired(before time.Time, limit int) ([]shortner.URLMapping, error) {
+	return listExpired(r.next, before, limit)
+}
@@ -0,0 +1,133 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// DestinationFinder is implemented by link repositories that can find the
+// links pointing at given destinations through the index on long_url.
+// Destinations encrypted at rest only match exactly, through their blind
+// index; prefixes never match them.
+type DestinationFinder interface {
+	FindByDestination(ctx context.Context, query shortner.DestinationQuery, afterID int64, limit int) ([]shortner.URLMapping, error)
+}
+
+// findByDestination calls FindByDestination on repo, or reports
+// ErrSearchUnsupported when repo is not a DestinationFinder; the wrappers
+// forward through it.
+func findByDestination(ctx context.Context, repo ShortenerRepository, query shortner.DestinationQuery, afterID int64, limit int) ([]shortner.URLMapping, error) {
+	finder, ok := repo.(DestinationFinder)
+	if !ok {
+		return nil, ErrSearchUnsupported
+	}
+	return finder.FindByDestination(ctx, query, afterID, limit)
+}
+
+// FindByDestination returns matching links after afterID, oldest first.
+// Each prefix is a range scan of idx_long_url.
+func (r *SQLiteShortenerRepo) FindByDestination(ctx context.Context, query shortner.DestinationQuery, afterID int64, limit int) ([]shortner.URLMapping, error) {
+	var conditions []string
+	var args []any
+	if len(query.URLs) > 0 {
+		conditions = append(conditions, "(long_url_hash = '' AND long_url IN (?"+strings.Repeat(", ?", len(query.URLs)-1)+"))")
+		for _, u := range query.URLs {
+			args = append(args, u)
+		}
+		if r.cipher != nil {
+			var indexes []any
+			for _, u := range query.URLs {
+				for _, index := range r.cipher.BlindIndexes(u) {
+					indexes = append(indexes, index)
+				}
+			}
+			conditions = append(conditions, "long_url_hash IN (?"+strings.Repeat(", ?", len(indexes)-1)+")")
+			args = append(args, indexes...)
+		}
+	}
+	for _, prefix := range query.Prefixes {
+		// No valid UTF-8 continues a string with 0xFF, so this bounds
+		// every string starting with prefix.
+		conditions = append(conditions, "(long_url_hash = '' AND long_url >= ? AND long_url < ?)")
+		args = append(args, prefix, prefix+"\xff")
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+	args = append(args, afterID, limit)
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+mappingColumns+" FROM urls WHERE ("+strings.Join(conditions, " OR ")+") AND id > ? ORDER BY id ASC LIMIT ?", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mappings []shortner.URLMapping
+	for rows.Next() {
+		m, err := r.scanMapping(rows)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, *m)
+	}
+	return mappings, rows.Err()
+}
+
+// FindByDestination merges the matches of every shard in global ID order,
+// like ListSince.
+func (r *ShardedShortenerRepo) FindByDestination(ctx context.Context, query shortner.DestinationQuery, afterID int64, limit int) ([]shortner.URLMapping, error) {
+	var all []shortner.URLMapping
+	for i, s := range r.shards {
+		mappings, err := findByDestination(ctx, s, query, r.localCursor(afterID, i), limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range mappings {
+			m.ID = r.globalID(m.ID, i)
+			all = append(all, m)
+		}
+	}
+	sort.Slice(all, func(a, b int) bool { return all[a].ID < all[b].ID })
+	if len(all) > limit {
+		all = all[:limit]
+	}
+	return all, nil
+}
+
+func (r *DualWriteShortenerRepo) FindByDestination(ctx context.Context, query shortner.DestinationQuery, afterID int64, limit int) ([]shortner.URLMapping, error) {
+	return findByDestination(ctx, r.primary, query, afterID, limit)
+}
+
+func (r *CachedShortenerRepo) FindByDestination(ctx context.Context, query shortner.DestinationQuery, afterID int64, limit int) ([]shortner.URLMapping, error) {
+	return findByDestination(ctx, r.next, query, afterID, limit)
+}
+
+func (r *CoalescingShortenerRepo) FindByDestination(ctx context.Context, query shortner.DestinationQuery, afterID int64, limit int) ([]shortner.URLMapping, error) {
+	return findByDestination(ctx, r.next, query, afterID, limit)
+}
+
+func (r *RegionalShortenerRepo) FindByDestination(ctx context.Context, query shortner.DestinationQuery, afterID int64, limit int) ([]shortner.URLMapping, error) {
+	return findByDestination(ctx, r.next, query, afterID, limit)
+}
+
+// FindByDestination is a listing, so it reads the replica like ListSince.
+func (r *ReplicatedShortenerRepo) FindByDestination(ctx context.Context, query shortner.DestinationQuery, afterID int64, limit int) ([]shortner.URLMapping, error) {
+	mappings, err := findByDestination(ctx, r.replica, query, afterID, limit)
+	if err == nil {
+		return mappings, nil
+	}
+	r.replicaFailed("FindByDestination", err)
+	return findByDestination(ctx, r.primary, query, afterID, limit)
+}
+
+// FindByDestination logs only how many URLs and prefixes were looked up.
+func (r *InstrumentedShortenerRepo) FindByDestination(ctx context.Context, query shortner.DestinationQuery, afterID int64, limit int) ([]shortner.URLMapping, error) {
+	start := time.Now()
+	mappings, err := findByDestination(ctx, r.next, query, afterID, limit)
+	r.observe("FindByDestination", start, err, len(query.URLs), len(query.Prefixes), afterID, limit)
+	return mappings, err
+}
@@ -0,0 +1,168 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// DomainClaimRepository stores the claims domain owners make to manage the
+// links to their domain.
+type DomainClaimRepository interface {
+	InitSchema() error
+	CreateClaim(claim shortner.DomainClaim) (int64, error)
+	GetClaimByKey(key string) (*shortner.DomainClaim, error)
+	MarkVerified(id int64, at time.Time) error
+	// ListNamedClaims returns the claims provisioned under a name, by name.
+	ListNamedClaims() ([]shortner.DomainClaim, error)
+	GetClaimByName(name string) (*shortner.DomainClaim, error)
+	// PutNamedClaim inserts claim under claim.Name, or moves the claim with
+	// that name to claim.Domain, verified at claim.VerifiedAt. created
+	// reports whether it was inserted.
+	PutNamedClaim(claim shortner.DomainClaim) (stored *shortner.DomainClaim, created bool, err error)
+	DeleteClaimByName(name string) error
+}
+
+const domainClaimColumns = "id, COALESCE(name, ''), domain, verification_token, claim_key, verified_at, created_at"
+
+type SQLiteDomainClaimRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteDomainClaimRepo(db *sql.DB) *SQLiteDomainClaimRepo {
+	return &SQLiteDomainClaimRepo{db: db}
+}
+
+func (r *SQLiteDomainClaimRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS domain_claims (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		domain TEXT NOT NULL,
+		verification_token TEXT NOT NULL,
+		claim_key TEXT NOT NULL UNIQUE,
+		verified_at TIMESTAMP NULL,
+		created_at TIMESTAMP NOT NULL
+	);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing domain claims schema: %v", err)
+		return err
+	}
+	if err := ensureColumn(r.db, "domain_claims", "name", "TEXT NULL"); err != nil {
+		return err
+	}
+	_, err = r.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_domain_claims_name ON domain_claims(name) WHERE name IS NOT NULL")
+	return err
+}
+
+func scanDomainClaim(row rowScanner) (*shortner.DomainClaim, error) {
+	var c shortner.DomainClaim
+	var verifiedAt sql.NullTime
+	if err := row.Scan(&c.ID, &c.Name, &c.Domain, &c.VerificationToken, &c.Key, &verifiedAt, &c.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if verifiedAt.Valid {
+		c.VerifiedAt = &verifiedAt.Time
+	}
+	return &c, nil
+}
+
+func (r *SQLiteDomainClaimRepo) CreateClaim(claim shortner.DomainClaim) (int64, error) {
+	res, err := r.db.Exec("INSERT INTO domain_claims(domain, verification_token, claim_key, created_at) VALUES(?, ?, ?, ?)",
+		claim.Domain, claim.VerificationToken, claim.Key, claim.CreatedAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *SQLiteDomainClaimRepo) GetClaimByKey(key string) (*shortner.DomainClaim, error) {
+	return scanDomainClaim(r.db.QueryRow("SELECT "+domainClaimColumns+" FROM domain_claims WHERE claim_key = ?", key))
+}
+
+func (r *SQLiteDomainClaimRepo) MarkVerified(id int64, at time.Time) error {
+	res, err := r.db.Exec("UPDATE domain_claims SET verified_at = ? WHERE id = ?", at.UTC(), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteDomainClaimRepo) ListNamedClaims() ([]shortner.DomainClaim, error) {
+	rows, err := r.db.Query("SELECT " + domainClaimColumns + " FROM domain_claims WHERE name IS NOT NULL ORDER BY name ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var claims []shortner.DomainClaim
+	for rows.Next() {
+		c, err := scanDomainClaim(rows)
+		if err != nil {
+			return nil, err
+		}
+		claims = append(claims, *c)
+	}
+	return claims, rows.Err()
+}
+
+func (r *SQLiteDomainClaimRepo) GetClaimByName(name string) (*shortner.DomainClaim, error) {
+	return scanDomainClaim(r.db.QueryRow("SELECT "+domainClaimColumns+" FROM domain_claims WHERE name = ?", name))
+}
+
+func (r *SQLiteDomainClaimRepo) PutNamedClaim(claim shortner.DomainClaim) (*shortner.DomainClaim, bool, error) {
+	var verifiedAt interface{}
+	if claim.VerifiedAt != nil {
+		verifiedAt = claim.VerifiedAt.UTC()
+	}
+	res, err := r.db.Exec("UPDATE domain_claims SET domain = ?, verified_at = ? WHERE name = ?", claim.Domain, verifiedAt, claim.Name)
+	if err != nil {
+		return nil, false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+	created := n == 0
+	if created {
+		_, err = r.db.Exec("INSERT INTO domain_claims(name, domain, verification_token, claim_key, verified_at, created_at) VALUES(?, ?, ?, ?, ?, ?)",
+			claim.Name, claim.Domain, claim.VerificationToken, claim.Key, verifiedAt, claim.CreatedAt.UTC())
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	stored, err := r.GetClaimByName(claim.Name)
+	if err != nil {
+		return nil, false, err
+	}
+	return stored, created, nil
+}
+
+func (r *SQLiteDomainClaimRepo) DeleteClaimByName(name string) error {
+	res, err := r.db.Exec("DELETE FROM domain_claims WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
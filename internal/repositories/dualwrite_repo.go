@@ -0,0 +1,131 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// DualWriteShortenerRepo serves every call from the primary and mirrors
+// successful changes to a secondary repository, the target of a migration
+// in progress. A failed mirror write is only logged: the secondary is not
+// authoritative yet, and cmd/migrate copies or corrects the link on its
+// next pass. A change to a link the secondary does not hold yet is skipped
+// the same way.
+type DualWriteShortenerRepo struct {
+	primary   ShortenerRepository
+	secondary ShortenerRepository
+}
+
+func NewDualWriteShortenerRepo(primary, secondary ShortenerRepository) *DualWriteShortenerRepo {
+	return &DualWriteShortenerRepo{primary: primary, secondary: secondary}
+}
+
+func (r *DualWriteShortenerRepo) mirror(method, shortCode string, err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Dual-write %s for '%s' failed on secondary: %v", method, shortCode, err)
+	}
+}
+
+func (r *DualWriteShortenerRepo) InitSchema() error {
+	return r.primary.InitSchema()
+}
+
+func (r *DualWriteShortenerRepo) SaveMapping(shortCode, longURL string) (int64, error) {
+	id, err := r.primary.SaveMapping(shortCode, longURL)
+	if err == nil {
+		_, mirrorErr := r.secondary.SaveMapping(shortCode, longURL)
+		r.mirror("SaveMapping", shortCode, mirrorErr)
+	}
+	return id, err
+}
+
+func (r *DualWriteShortenerRepo) CreateMapping(mapping shortner.URLMapping) (int64, error) {
+	id, err := r.primary.CreateMapping(mapping)
+	if err == nil {
+		_, mirrorErr := r.secondary.CreateMapping(mapping)
+		r.mirror("CreateMapping", mapping.ShortCode, mirrorErr)
+	}
+	return id, err
+}
+
+func (r *DualWriteShortenerRepo) FindByShortCode(shortCode string) (string, error) {
+	return r.primary.FindByShortCode(shortCode)
+}
+
+func (r *DualWriteShortenerRepo) GetMapping(shortCode string) (*shortner.URLMapping, error) {
+	return r.primary.GetMapping(shortCode)
+}
+
+func (r *DualWriteShortenerRepo) FindByLongURL(longURL string) (string, error) {
+	return findByLongURL(r.primary, longURL)
+}
+
+func (r *DualWriteShortenerRepo) UpdateLongURL(shortCode, newLongURL string) error {
+	err := r.primary.UpdateLongURL(shortCode, newLongURL)
+	if err == nil {
+		r.mirror("UpdateLongURL", shortCode, r.secondary.UpdateLongURL(shortCode, newLongURL))
+	}
+	return err
+}
+
+func (r *DualWriteShortenerRepo) UpdateMapping(mapping shortner.URLMapping) error {
+	err := r.primary.UpdateMapping(mapping)
+	if err == nil {
+		r.mirror("UpdateMapping", mapping.ShortCode, r.secondary.UpdateMapping(mapping))
+	}
+	return err
+}
+
+// ConsumeMapping mirrors the consumption as an update of the whole mapping,
+// since the secondary's copy may already count as consumed or not exist.
+func (r *DualWriteShortenerRepo) ConsumeMapping(shortCode string, now time.Time) error {
+	err := r.primary.ConsumeMapping(shortCode, now)
+	if err == nil {
+		mapping, getErr := r.primary.GetMapping(shortCode)
+		if getErr == nil {
+			getErr = r.secondary.UpdateMapping(*mapping)
+		}
+		r.mirror("ConsumeMapping", shortCode, getErr)
+	}
+	return err
+}
+
+func (r *DualWriteShortenerRepo) DeleteMapping(shortCode string) error {
+	err := r.primary.DeleteMapping(shortCode)
+	if err == nil {
+		r.mirror("DeleteMapping", shortCode, r.secondary.DeleteMapping(shortCode))
+	}
+	return err
+}
+
+// ApplyBulk applies the batch atomically to the primary only; the
+// secondary receives the changes one by one, like every other mirrored
+// write.
+func (r *DualWriteShortenerRepo) ApplyBulk(updates []shortner.URLMapping, deletes []string) error {
+	if err := applyBulk(r.primary, updates, deletes); err != nil {
+		return err
+	}
+	for _, mapping := range updates {
+		r.mirror("UpdateMapping", mapping.ShortCode, r.secondary.UpdateMapping(mapping))
+	}
+	for _, shortCode := range deletes {
+		r.mirror("DeleteMapping", shortCode, r.secondary.DeleteMapping(shortCode))
+	}
+	return nil
+}
+
+func (r *DualWriteShortenerRepo) Search(ctx context.Context, query string, page shortner.SearchPage) ([]shortner.URLMapping, error) {
+	return searchLinks(ctx, r.primary, query, page)
+}
+
+func (r *DualWriteShortenerRepo) ListSince(afterID int64, limit int) ([]shortner.URLMapping, error) {
+	return listSince(r.primary, afterID, limit)
+}
+
+func (r *DualWriteShortenerRepo) ListExpired(before time.Time, limit int) ([]shortner.URLMapping, error) {
+	return listExpired(r.primary, before, limit)
+}
@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"template/internal/pkg/fieldcrypt"
+)
+
+// fieldCipher is embedded by the repositories whose columns hold
+// destinations or note text. Until EnableEncryption is called, values are
+// stored and read as they are.
+type fieldCipher struct {
+	cipher *fieldcrypt.Cipher
+}
+
+// EnableEncryption makes the repository encrypt the sensitive columns it
+// writes and decrypt them when reading. Rows written earlier stay readable
+// and are encrypted by Reencrypt.
+func (f *fieldCipher) EnableEncryption(c *fieldcrypt.Cipher) {
+	f.cipher = c
+}
+
+func (f *fieldCipher) seal(plaintext string) (string, error) {
+	if f.cipher == nil {
+		return plaintext, nil
+	}
+	return f.cipher.Encrypt(plaintext)
+}
+
+func (f *fieldCipher) open(stored string) (string, error) {
+	if f.cipher == nil {
+		return stored, nil
+	}
+	return f.cipher.Decrypt(stored)
+}
+
+// Reencrypter rewrites the encrypted columns of a repository under the
+// current primary key, encrypting plaintext rows along the way.
+type Reencrypter interface {
+	Reencrypt(batch int) (int, error)
+}
+
+// reencryptColumns rewrites the given columns of table row by row, in
+// batches ordered by key, skipping values already under the primary key.
+// update receives the new values and the row key and must write them.
+func reencryptColumns(db *sql.DB, c *fieldcrypt.Cipher, table, keyColumn string, columns []string, batch int,
+	update func(key any, plaintexts, sealed []string) error) (int, error) {
+	selectColumns := keyColumn
+	for _, col := range columns {
+		selectColumns += ", " + col
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s > ? ORDER BY %s ASC LIMIT ?", selectColumns, table, keyColumn, keyColumn)
+
+	var after any = ""
+	if keyColumn == "id" {
+		after = 0
+	}
+	rewritten := 0
+	for {
+		rows, err := db.Query(query, after, batch)
+		if err != nil {
+			return rewritten, err
+		}
+		type row struct {
+			key    any
+			values []string
+		}
+		var page []row
+		for rows.Next() {
+			var key any
+			values := make([]string, len(columns))
+			dest := []any{&key}
+			for i := range values {
+				dest = append(dest, &values[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return rewritten, err
+			}
+			if b, ok := key.([]byte); ok {
+				key = string(b)
+			}
+			page = append(page, row{key: key, values: values})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return rewritten, err
+		}
+
+		for _, r := range page {
+			after = r.key
+			current := true
+			for _, v := range r.values {
+				current = current && c.Current(v)
+			}
+			if current {
+				continue
+			}
+			plaintexts := make([]string, len(r.values))
+			sealed := make([]string, len(r.values))
+			for i, v := range r.values {
+				if plaintexts[i], err = c.Decrypt(v); err != nil {
+					return rewritten, fmt.Errorf("%s row %v: %w", table, r.key, err)
+				}
+				if sealed[i], err = c.Encrypt(plaintexts[i]); err != nil {
+					return rewritten, err
+				}
+			}
+			if err := update(r.key, plaintexts, sealed); err != nil {
+				return rewritten, fmt.Errorf("%s row %v: %w", table, r.key, err)
+			}
+			rewritten++
+		}
+		log.Printf("Re-encryption of %s: %d row(s) rewritten so far", table, rewritten)
+		if len(page) < batch {
+			return rewritten, nil
+		}
+	}
+}
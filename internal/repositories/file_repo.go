@@ -0,0 +1,94 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+type FileRepository interface {
+	InitSchema() error
+	SaveFile(file shortner.File) error
+	GetFile(shortCode string) (*shortner.File, error)
+	MarkReady(shortCode string, size int64) error
+	DeleteFile(shortCode string) error
+}
+
+type SQLiteFileRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteFileRepo(db *sql.DB) *SQLiteFileRepo {
+	return &SQLiteFileRepo{db: db}
+}
+
+func (r *SQLiteFileRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS files (
+		short_code TEXT PRIMARY KEY,
+		object_key TEXT NOT NULL,
+		filename TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		upload_token TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing files schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLiteFileRepo) SaveFile(file shortner.File) error {
+	if file.CreatedAt.IsZero() {
+		file.CreatedAt = time.Now()
+	}
+	_, err := r.db.Exec(
+		"INSERT INTO files(short_code, object_key, filename, content_type, size, status, upload_token, created_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?)",
+		file.ShortCode, file.ObjectKey, file.Filename, file.ContentType, file.Size, file.Status, file.UploadToken, file.CreatedAt,
+	)
+	return err
+}
+
+func (r *SQLiteFileRepo) GetFile(shortCode string) (*shortner.File, error) {
+	var f shortner.File
+	err := r.db.QueryRow(
+		"SELECT short_code, object_key, filename, content_type, size, status, upload_token, created_at FROM files WHERE short_code = ?",
+		shortCode,
+	).Scan(&f.ShortCode, &f.ObjectKey, &f.Filename, &f.ContentType, &f.Size, &f.Status, &f.UploadToken, &f.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &f, nil
+}
+
+// MarkReady records the stored size and invalidates the upload token, so a
+// file can only be uploaded once.
+func (r *SQLiteFileRepo) MarkReady(shortCode string, size int64) error {
+	res, err := r.db.Exec(
+		"UPDATE files SET status = ?, size = ?, upload_token = '' WHERE short_code = ?",
+		shortner.FileStatusReady, size, shortCode,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *SQLiteFileRepo) DeleteFile(shortCode string) error {
+	res, err := r.db.Exec("DELETE FROM files WHERE short_code = ?", shortCode)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"template/internal/pkg/featureflags"
+)
+
+// FlagRepository stores the feature flag overrides set through the admin
+// API. A flag without a row keeps its config or built-in state.
+type FlagRepository interface {
+	InitSchema() error
+	ListFlags() ([]featureflags.Flag, error)
+	SaveFlag(flag featureflags.Flag) error
+	DeleteFlag(name string) error
+}
+
+type SQLiteFlagRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteFlagRepo(db *sql.DB) *SQLiteFlagRepo {
+	return &SQLiteFlagRepo{db: db}
+}
+
+func (r *SQLiteFlagRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS feature_flags (
+		name TEXT PRIMARY KEY,
+		enabled INTEGER NOT NULL DEFAULT 0,
+		rollout INTEGER NOT NULL DEFAULT 100,
+		environments TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing feature flags schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLiteFlagRepo) ListFlags() ([]featureflags.Flag, error) {
+	rows, err := r.db.Query("SELECT name, enabled, rollout, environments, updated_at FROM feature_flags ORDER BY name ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flags []featureflags.Flag
+	for rows.Next() {
+		var f featureflags.Flag
+		var environments string
+		var updatedAt time.Time
+		if err := rows.Scan(&f.Name, &f.Enabled, &f.Rollout, &environments, &updatedAt); err != nil {
+			return nil, err
+		}
+		if environments != "" {
+			if err := json.Unmarshal([]byte(environments), &f.Environments); err != nil {
+				return nil, err
+			}
+		}
+		f.UpdatedAt = &updatedAt
+		flags = append(flags, f)
+	}
+	return flags, rows.Err()
+}
+
+// SaveFlag inserts or replaces the override for flag.Name.
+func (r *SQLiteFlagRepo) SaveFlag(flag featureflags.Flag) error {
+	environments := ""
+	if len(flag.Environments) > 0 {
+		raw, err := json.Marshal(flag.Environments)
+		if err != nil {
+			return err
+		}
+		environments = string(raw)
+	}
+	updatedAt := time.Now()
+	if flag.UpdatedAt != nil {
+		updatedAt = *flag.UpdatedAt
+	}
+	_, err := r.db.Exec(`INSERT INTO feature_flags(name, enabled, rollout, environments, updated_at) VALUES(?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET enabled = excluded.enabled, rollout = excluded.rollout, environments = excluded.environments, updated_at = excluded.updated_at`,
+		flag.Name, flag.Enabled, flag.Rollout, environments, updatedAt)
+	return err
+}
+
+func (r *SQLiteFlagRepo) DeleteFlag(name string) error {
+	res, err := r.db.Exec("DELETE FROM feature_flags WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
@@ -0,0 +1,42 @@
+package repositories_test
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"template/internal/pkg/fieldcrypt"
+	"template/internal/repositories"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// openDB connects to a fresh database file that is removed after the test.
+func openDB(t testing.TB, name string) *sql.DB {
+	t.Helper()
+	db, err := repositories.ConnectDB(filepath.Join(t.TempDir(), name))
+	if err != nil {
+		t.Fatalf("connecting to %s: %v", name, err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func testCipher(t testing.TB, seed byte) *fieldcrypt.Cipher {
+	t.Helper()
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = seed + byte(i)
+	}
+	c, err := fieldcrypt.New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
@@ -0,0 +1,144 @@
+package repositories
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// HoneypotRepository stores the honeypot codes set through the admin API
+// and the requests made for them.
+type HoneypotRepository interface {
+	InitSchema() error
+	// ListHoneypots lists the honeypots in code order, with how often and
+	// when last each was hit.
+	ListHoneypots() ([]shortner.Honeypot, error)
+	// AddHoneypot stores honeypot, or updates the note of the honeypot with
+	// the same code.
+	AddHoneypot(honeypot shortner.Honeypot) error
+	DeleteHoneypot(code string) error
+	RecordHit(hit shortner.HoneypotHit) (int64, error)
+	// ListHits lists the hits newest first, from before beforeID unless it
+	// is 0.
+	ListHits(beforeID int64, limit int) ([]shortner.HoneypotHit, error)
+}
+
+type SQLiteHoneypotRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteHoneypotRepo(db *sql.DB) *SQLiteHoneypotRepo {
+	return &SQLiteHoneypotRepo{db: db}
+}
+
+func (r *SQLiteHoneypotRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS honeypots (
+		code TEXT PRIMARY KEY,
+		note TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS honeypot_hits (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code TEXT NOT NULL,
+		ip TEXT NOT NULL,
+		user_agent TEXT NOT NULL DEFAULT '',
+		referer TEXT NOT NULL DEFAULT '',
+		hit_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_honeypot_hits_code ON honeypot_hits(code);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing honeypots schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLiteHoneypotRepo) ListHoneypots() ([]shortner.Honeypot, error) {
+	// The last hit is joined as a row, not taken with MAX(), so that its
+	// time keeps the column type and scans as a time.
+	rows, err := r.db.Query(`SELECT h.code, h.note, h.created_at,
+		(SELECT COUNT(*) FROM honeypot_hits WHERE code = h.code), last.hit_at
+		FROM honeypots h
+		LEFT JOIN honeypot_hits last ON last.id = (SELECT MAX(id) FROM honeypot_hits WHERE code = h.code)
+		ORDER BY h.code ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var honeypots []shortner.Honeypot
+	for rows.Next() {
+		var h shortner.Honeypot
+		var lastHit sql.NullTime
+		if err := rows.Scan(&h.Code, &h.Note, &h.CreatedAt, &h.Hits, &lastHit); err != nil {
+			return nil, err
+		}
+		if lastHit.Valid {
+			h.LastHitAt = &lastHit.Time
+		}
+		honeypots = append(honeypots, h)
+	}
+	return honeypots, rows.Err()
+}
+
+func (r *SQLiteHoneypotRepo) AddHoneypot(honeypot shortner.Honeypot) error {
+	if honeypot.CreatedAt.IsZero() {
+		honeypot.CreatedAt = time.Now()
+	}
+	_, err := r.db.Exec(`INSERT INTO honeypots(code, note, created_at) VALUES(?, ?, ?)
+		ON CONFLICT(code) DO UPDATE SET note = excluded.note`,
+		honeypot.Code, honeypot.Note, honeypot.CreatedAt.UTC())
+	return err
+}
+
+func (r *SQLiteHoneypotRepo) DeleteHoneypot(code string) error {
+	res, err := r.db.Exec("DELETE FROM honeypots WHERE code = ?", code)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteHoneypotRepo) RecordHit(hit shortner.HoneypotHit) (int64, error) {
+	res, err := r.db.Exec("INSERT INTO honeypot_hits(code, ip, user_agent, referer, hit_at) VALUES(?, ?, ?, ?, ?)",
+		hit.Code, hit.IP, hit.UserAgent, hit.Referer, hit.HitAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *SQLiteHoneypotRepo) ListHits(beforeID int64, limit int) ([]shortner.HoneypotHit, error) {
+	query, args := "SELECT id, code, ip, user_agent, referer, hit_at FROM honeypot_hits", []interface{}{}
+	if beforeID > 0 {
+		query += " WHERE id < ?"
+		args = append(args, beforeID)
+	}
+	rows, err := r.db.Query(query+" ORDER BY id DESC LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []shortner.HoneypotHit
+	for rows.Next() {
+		var h shortner.HoneypotHit
+		if err := rows.Scan(&h.ID, &h.Code, &h.IP, &h.UserAgent, &h.Referer, &h.HitAt); err != nil {
+			return nil, err
+		}
+		hits = append(hits, h)
+	}
+	return hits, rows.Err()
+}
@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+type HookRepository interface {
+	InitSchema() error
+	CreateHook(event, targetURL string) (int64, error)
+	ListHooks() ([]shortner.Hook, error)
+	ListHooksByEvent(event string) ([]shortner.Hook, error)
+	DeleteHook(id int64) error
+}
+
+type SQLiteHookRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteHookRepo(db *sql.DB) *SQLiteHookRepo {
+	return &SQLiteHookRepo{db: db}
+}
+
+func (r *SQLiteHookRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS hooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event TEXT NOT NULL,
+		target_url TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_hooks_event ON hooks(event);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing hooks schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLiteHookRepo) CreateHook(event, targetURL string) (int64, error) {
+	res, err := r.db.Exec("INSERT INTO hooks(event, target_url, created_at) VALUES(?, ?, ?)", event, targetURL, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *SQLiteHookRepo) ListHooks() ([]shortner.Hook, error) {
+	return r.queryHooks("SELECT id, event, target_url, created_at FROM hooks ORDER BY id ASC")
+}
+
+func (r *SQLiteHookRepo) ListHooksByEvent(event string) ([]shortner.Hook, error) {
+	return r.queryHooks("SELECT id, event, target_url, created_at FROM hooks WHERE event = ? ORDER BY id ASC", event)
+}
+
+func (r *SQLiteHookRepo) DeleteHook(id int64) error {
+	res, err := r.db.Exec("DELETE FROM hooks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteHookRepo) queryHooks(query string, args ...interface{}) ([]shortner.Hook, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []shortner.Hook
+	for rows.Next() {
+		var h shortner.Hook
+		if err := rows.Scan(&h.ID, &h.Event, &h.TargetURL, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, rows.Err()
+}
@@ -0,0 +1,189 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"template/internal/pkg/metrics"
+	"template/internal/usecases/shortner"
+)
+
+// InstrumentedShortenerRepo decorates a ShortenerRepository with operation
+// and error counters and a latency histogram per method. ErrNotFound is an
+// expected outcome and is not counted as a database error. Calls slower
+// than the slow query threshold are logged with their arguments redacted,
+// so hot spots can be found without destinations leaking into the log.
+type InstrumentedShortenerRepo struct {
+	next       ShortenerRepository
+	operations *metrics.CounterVec
+	errors     *metrics.CounterVec
+	duration   *metrics.HistogramVec
+	// slowThreshold is the duration above which a call is logged; 0
+	// disables the slow query log.
+	slowThreshold time.Duration
+}
+
+func NewInstrumentedShortenerRepo(next ShortenerRepository, reg *metrics.Registry, slowThreshold time.Duration) *InstrumentedShortenerRepo {
+	return &InstrumentedShortenerRepo{
+		next: next,
+		operations: reg.NewCounterVec("shortener_db_operations_total",
+			"Repository operations executed, by method.", "method"),
+		errors: reg.NewCounterVec("shortener_db_errors_total",
+			"Repository operations that failed with a database error, by method.", "method"),
+		duration: reg.NewHistogramVec("shortener_db_operation_duration_seconds",
+			"Repository operation latency in seconds, by method.", metrics.DefaultLatencyBuckets, "method"),
+		slowThreshold: slowThreshold,
+	}
+}
+
+func (r *InstrumentedShortenerRepo) observe(method string, start time.Time, err error, args ...any) {
+	elapsed := time.Since(start)
+	r.operations.WithLabelValues(method).Inc()
+	r.duration.WithLabelValues(method).Observe(elapsed.Seconds())
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		r.errors.WithLabelValues(method).Inc()
+	}
+	if r.slowThreshold > 0 && elapsed >= r.slowThreshold {
+		redacted := make([]string, len(args))
+		for i, arg := range args {
+			redacted[i] = redactArg(arg)
+		}
+		log.Printf("Slow query: %s(%s) took %s (err: %v)", method, strings.Join(redacted, ", "), elapsed.Round(time.Microsecond), err)
+	}
+}
+
+// redactArg formats a repository argument for the slow query log. Short
+// codes, numbers and times are kept because they identify the query;
+// destinations keep only their scheme and host, and other long strings
+// only their length.
+func redactArg(arg any) string {
+	switch v := arg.(type) {
+	case string:
+		return redactString(v)
+	case shortner.URLMapping:
+		return fmt.Sprintf("URLMapping{ShortCode: %q, Kind: %q, LongURL: %s}", v.ShortCode, v.Kind, redactString(v.LongURL))
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func redactString(s string) string {
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" && u.Host != "" {
+		return fmt.Sprintf("%q", u.Scheme+"://"+u.Host+"/[redacted]")
+	}
+	if len(s) <= maxPlainArgLength {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprintf("[redacted %d bytes]", len(s))
+}
+
+// maxPlainArgLength is the length up to which string arguments, such as
+// short codes and aliases, are logged as they are.
+const maxPlainArgLength = 64
+
+func (r *InstrumentedShortenerRepo) InitSchema() error {
+	start := time.Now()
+	err := r.next.InitSchema()
+	r.observe("InitSchema", start, err)
+	return err
+}
+
+func (r *InstrumentedShortenerRepo) SaveMapping(shortCode, longURL string) (int64, error) {
+	start := time.Now()
+	id, err := r.next.SaveMapping(shortCode, longURL)
+	r.observe("SaveMapping", start, err, shortCode, longURL)
+	return id, err
+}
+
+func (r *InstrumentedShortenerRepo) CreateMapping(mapping shortner.URLMapping) (int64, error) {
+	start := time.Now()
+	id, err := r.next.CreateMapping(mapping)
+	r.observe("CreateMapping", start, err, mapping)
+	return id, err
+}
+
+func (r *InstrumentedShortenerRepo) FindByShortCode(shortCode string) (string, error) {
+	start := time.Now()
+	longURL, err := r.next.FindByShortCode(shortCode)
+	r.observe("FindByShortCode", start, err, shortCode)
+	return longURL, err
+}
+
+func (r *InstrumentedShortenerRepo) GetMapping(shortCode string) (*shortner.URLMapping, error) {
+	start := time.Now()
+	mapping, err := r.next.GetMapping(shortCode)
+	r.observe("GetMapping", start, err, shortCode)
+	return mapping, err
+}
+
+func (r *InstrumentedShortenerRepo) FindByLongURL(longURL string) (string, error) {
+	start := time.Now()
+	shortCode, err := findByLongURL(r.next, longURL)
+	r.observe("FindByLongURL", start, err, longURL)
+	return shortCode, err
+}
+
+func (r *InstrumentedShortenerRepo) UpdateLongURL(shortCode, newLongURL string) error {
+	start := time.Now()
+	err := r.next.UpdateLongURL(shortCode, newLongURL)
+	r.observe("UpdateLongURL", start, err, shortCode, newLongURL)
+	return err
+}
+
+func (r *InstrumentedShortenerRepo) UpdateMapping(mapping shortner.URLMapping) error {
+	start := time.Now()
+	err := r.next.UpdateMapping(mapping)
+	r.observe("UpdateMapping", start, err, mapping)
+	return err
+}
+
+func (r *InstrumentedShortenerRepo) ConsumeMapping(shortCode string, now time.Time) error {
+	start := time.Now()
+	err := r.next.ConsumeMapping(shortCode, now)
+	r.observe("ConsumeMapping", start, err, shortCode, now)
+	return err
+}
+
+func (r *InstrumentedShortenerRepo) DeleteMapping(shortCode string) error {
+	start := time.Now()
+	err := r.next.DeleteMapping(shortCode)
+	r.observe("DeleteMapping", start, err, shortCode)
+	return err
+}
+
+func (r *InstrumentedShortenerRepo) ApplyBulk(updates []shortner.URLMapping, deletes []string) error {
+	start := time.Now()
+	err := applyBulk(r.next, updates, deletes)
+	r.observe("ApplyBulk", start, err, len(updates), len(deletes))
+	return err
+}
+
+// Search logs only the length of the query, whose words may be taken from
+// destinations.
+func (r *InstrumentedShortenerRepo) Search(ctx context.Context, query string, page shortner.SearchPage) ([]shortner.URLMapping, error) {
+	start := time.Now()
+	mappings, err := searchLinks(ctx, r.next, query, page)
+	r.observe("Search", start, err, len(query), page.Offset, page.Limit)
+	return mappings, err
+}
+
+func (r *InstrumentedShortenerRepo) ListSince(afterID int64, limit int) ([]shortner.URLMapping, error) {
+	start := time.Now()
+	mappings, err := listSince(r.next, afterID, limit)
+	r.observe("ListSince", start, err, afterID, limit)
+	return mappings, err
+}
+
+func (r *InstrumentedShortenerRepo) ListExpired(before time.Time, limit int) ([]shortner.URLMapping, error) {
+	start := time.Now()
+	mappings, err := listExpired(r.next, before, limit)
+	r.observe("ListExpired", start, err, before, limit)
+	return mappings, err
+}
@@ -0,0 +1,1446 @@
+//go:build integration
+
+// Integration tests run the repositories against real database files and
+// migrate their schemas the way the server does at startup. They are slower
+// than the unit tests and only build with the integration tag:
+//
+//	go test -tags integration ./internal/repositories/...
+package repositories_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"template/internal/pkg/fieldcrypt"
+	"template/internal/pkg/metrics"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+// repoUnderTest builds one implementation of ShortenerRepository on fresh
+// databases, with its schema migrated.
+type repoUnderTest struct {
+	name  string
+	build func(t *testing.T) repositories.ShortenerRepository
+}
+
+func shortenerRepos() []repoUnderTest {
+	sqlite := func(t *testing.T, name string) *repositories.SQLiteShortenerRepo {
+		return repositories.NewSQLiteShortenerRepo(openDB(t, name), false)
+	}
+	return []repoUnderTest{
+		{"sqlite", func(t *testing.T) repositories.ShortenerRepository {
+			return sqlite(t, "links.db")
+		}},
+		{"encrypted", func(t *testing.T) repositories.ShortenerRepository {
+			repo := sqlite(t, "links.db")
+			repo.EnableEncryption(testCipher(t, 1))
+			return repo
+		}},
+		{"sharded", func(t *testing.T) repositories.ShortenerRepository {
+			return repositories.NewShardedShortenerRepo([]repositories.ShortenerRepository{
+				sqlite(t, "s0.db"), sqlite(t, "s1.db"), sqlite(t, "s2.db"),
+			})
+		}},
+		{"replicated", func(t *testing.T) repositories.ShortenerRepository {
+			// The replica is the primary's own file, as with a replica that
+			// never lags; fresh-write routing is exercised either way.
+			db := openDB(t, "links.db")
+			primary := repositories.NewSQLiteShortenerRepo(db, false)
+			replica := repositories.NewSQLiteShortenerRepo(db, false)
+			return repositories.NewReplicatedShortenerRepo(primary, replica, time.Second)
+		}},
+		{"dual-write", func(t *testing.T) repositories.ShortenerRepository {
+			secondary := sqlite(t, "secondary.db")
+			if err := secondary.InitSchema(); err != nil {
+				t.Fatal(err)
+			}
+			return repositories.NewDualWriteShortenerRepo(sqlite(t, "primary.db"), secondary)
+		}},
+		{"instrumented", func(t *testing.T) repositories.ShortenerRepository {
+			return repositories.NewInstrumentedShortenerRepo(sqlite(t, "links.db"), metrics.NewRegistry(nil), time.Millisecond)
+		}},
+		{"coalescing", func(t *testing.T) repositories.ShortenerRepository {
+			return repositories.NewCoalescingShortenerRepo(sqlite(t, "links.db"))
+		}},
+		{"cached", func(t *testing.T) repositories.ShortenerRepository {
+			return repositories.NewCachedShortenerRepo(sqlite(t, "links.db"), 2, time.Minute, time.Minute, false)
+		}},
+		{"cached-sharded", func(t *testing.T) repositories.ShortenerRepository {
+			repo := repositories.NewCachedShortenerRepo(sqlite(t, "links.db"), 8, time.Minute, time.Minute, false)
+			repo.SetShards(4)
+			repo.EnableMetrics(metrics.NewRegistry(nil))
+			return repo
+		}},
+		{"key-value", func(t *testing.T) repositories.ShortenerRepository {
+			return repositories.NewKeyValueShortenerRepo(repositories.NewMemoryKeyValueStore(), false)
+		}},
+		{"key-value-file", func(t *testing.T) repositories.ShortenerRepository {
+			store, err := repositories.OpenFileKeyValueStore(filepath.Join(t.TempDir(), "links.kv"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return repositories.NewKeyValueShortenerRepo(store, true)
+		}},
+		{"cached-key-value", func(t *testing.T) repositories.ShortenerRepository {
+			kv := repositories.NewKeyValueShortenerRepo(repositories.NewMemoryKeyValueStore(), false)
+			return repositories.NewCachedShortenerRepo(repositories.NewCoalescingShortenerRepo(kv), 2, time.Minute, time.Minute, false)
+		}},
+	}
+}
+
+func TestShortenerRepositories(t *testing.T) {
+	for _, impl := range shortenerRepos() {
+		t.Run(impl.name, func(t *testing.T) {
+			newRepo := func(t *testing.T) repositories.ShortenerRepository {
+				repo := impl.build(t)
+				// Migrations run at every startup and must be idempotent.
+				for i := 0; i < 2; i++ {
+					if err := repo.InitSchema(); err != nil {
+						t.Fatalf("InitSchema #%d: %v", i+1, err)
+					}
+				}
+				return repo
+			}
+			t.Run("RoundTrip", func(t *testing.T) { testRoundTrip(t, newRepo(t)) })
+			t.Run("Lookups", func(t *testing.T) { testLookups(t, newRepo(t)) })
+			t.Run("Updates", func(t *testing.T) { testUpdates(t, newRepo(t)) })
+			t.Run("ApplyBulk", func(t *testing.T) { testApplyBulk(t, newRepo(t)) })
+			t.Run("ConsumeOnce", func(t *testing.T) { testConsumeOnce(t, newRepo(t)) })
+			t.Run("ListSincePages", func(t *testing.T) { testListSince(t, newRepo(t)) })
+			t.Run("ListExpired", func(t *testing.T) { testListExpired(t, newRepo(t)) })
+		})
+	}
+}
+
+// longURLIndex returns the LongURLIndex of repo, or nil when it keeps no
+// index of destinations, even behind wrappers.
+func longURLIndex(repo repositories.ShortenerRepository) repositories.LongURLIndex {
+	index, ok := repo.(repositories.LongURLIndex)
+	if !ok {
+		return nil
+	}
+	if _, err := index.FindByLongURL("https://example.com/probe"); errors.Is(err, repositories.ErrIndexUnsupported) {
+		return nil
+	}
+	return index
+}
+
+// linkLister is longURLIndex for LinkLister.
+func linkLister(repo repositories.ShortenerRepository) repositories.LinkLister {
+	lister, ok := repo.(repositories.LinkLister)
+	if !ok {
+		return nil
+	}
+	if _, err := lister.ListSince(0, 1); errors.Is(err, repositories.ErrListUnsupported) {
+		return nil
+	}
+	return lister
+}
+
+func mustCreate(t *testing.T, repo repositories.ShortenerRepository, m shortner.URLMapping) {
+	t.Helper()
+	if _, err := repo.CreateMapping(m); err != nil {
+		t.Fatalf("CreateMapping(%s): %v", m.ShortCode, err)
+	}
+}
+
+func mustGet(t *testing.T, repo repositories.ShortenerRepository, code string) *shortner.URLMapping {
+	t.Helper()
+	m, err := repo.GetMapping(code)
+	if err != nil {
+		t.Fatalf("GetMapping(%s): %v", code, err)
+	}
+	return m
+}
+
+func testRoundTrip(t *testing.T, repo repositories.ShortenerRepository) {
+	expires := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+	want := shortner.URLMapping{
+		ShortCode:       "full",
+		Kind:            shortner.KindRedirect,
+		Title:           "Everything set",
+		LongURL:         "https://example.com/path?q=1",
+		Headers:         map[string]string{"X-Robots-Tag": "noindex"},
+		RedirectType:    308,
+		CacheControl:    "max-age=60",
+		Language:        "ru",
+		ExpiresAt:       &expires,
+		LanguageTargets: map[string]string{"fr": "https://example.com/fr"},
+		PixelIDs:        []int64{3, 5},
+		StatsVisibility: shortner.StatsToken,
+		StatsToken:      "secret",
+		SingleUse:       true,
+		// The service never sets both, but each has its own column.
+		AllowedCountries: []string{"DE", "AT"},
+		BlockedCountries: []string{"RU"},
+		TimeRules:        []shortner.TimeRule{{Days: []string{"sat"}, From: "18:00", To: "09:00", TimeZone: "Europe/Berlin", URL: "https://example.com/closed"}},
+		SocialPreview:    true,
+		QueryPassthrough: shortner.QueryMerge,
+		Wildcard:         true,
+		SpikeFactor:      7.5,
+		SpikeMinClicks:   20,
+	}
+	mustCreate(t, repo, want)
+
+	got := mustGet(t, repo, "full")
+	if got.ID == 0 || got.CreatedAt.IsZero() {
+		t.Errorf("ID = %d, CreatedAt = %v, want both set", got.ID, got.CreatedAt)
+	}
+	got.ID, got.CreatedAt = 0, time.Time{}
+	if got.ExpiresAt == nil || !got.ExpiresAt.Equal(expires) {
+		t.Errorf("ExpiresAt = %v, want %v", got.ExpiresAt, expires)
+	}
+	got.ExpiresAt = want.ExpiresAt
+	if fmt.Sprintf("%+v", *got) != fmt.Sprintf("%+v", want) {
+		t.Errorf("GetMapping = %+v\nwant          %+v", *got, want)
+	}
+
+	longURL, err := repo.FindByShortCode("full")
+	if err != nil || longURL != want.LongURL {
+		t.Errorf("FindByShortCode = %q, %v", longURL, err)
+	}
+
+	if _, err := repo.CreateMapping(shortner.URLMapping{ShortCode: "full", LongURL: "https://other.example.com"}); err == nil {
+		t.Error("CreateMapping accepted a duplicate code")
+	}
+}
+
+func testLookups(t *testing.T, repo repositories.ShortenerRepository) {
+	if _, err := repo.SaveMapping("saved", "https://example.com/saved"); err != nil {
+		t.Fatal(err)
+	}
+	m := mustGet(t, repo, "saved")
+	if m.Kind != shortner.KindRedirect || m.RedirectType != 302 || m.StatsVisibility != shortner.StatsPrivate {
+		t.Errorf("defaults of a saved mapping = %+v", m)
+	}
+
+	if index := longURLIndex(repo); index != nil {
+		code, err := index.FindByLongURL("https://example.com/saved")
+		if err != nil || code != "saved" {
+			t.Errorf("FindByLongURL = %q, %v, want saved", code, err)
+		}
+		// A miss is an empty code, not an error.
+		if code, err := index.FindByLongURL("https://example.com/missing"); err != nil || code != "" {
+			t.Errorf("FindByLongURL(missing) = %q, %v", code, err)
+		}
+	}
+	if _, err := repo.GetMapping("missing"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("GetMapping(missing) error = %v, want ErrNotFound", err)
+	}
+	if _, err := repo.FindByShortCode("missing"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("FindByShortCode(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testUpdates(t *testing.T, repo repositories.ShortenerRepository) {
+	mustCreate(t, repo, shortner.URLMapping{ShortCode: "upd", LongURL: "https://example.com/old"})
+
+	if err := repo.UpdateLongURL("upd", "https://example.com/new"); err != nil {
+		t.Fatal(err)
+	}
+	if index := longURLIndex(repo); index != nil {
+		if code, _ := index.FindByLongURL("https://example.com/new"); code != "upd" {
+			t.Errorf("FindByLongURL(new) = %q after UpdateLongURL, want upd", code)
+		}
+		if code, _ := index.FindByLongURL("https://example.com/old"); code != "" {
+			t.Errorf("FindByLongURL(old) = %q after UpdateLongURL, want none", code)
+		}
+	} else if got := mustGet(t, repo, "upd"); got.LongURL != "https://example.com/new" {
+		t.Errorf("LongURL after UpdateLongURL = %q", got.LongURL)
+	}
+
+	m := mustGet(t, repo, "upd")
+	m.Title = "Renamed"
+	m.RedirectType = 301
+	m.Headers = map[string]string{"X-A": "1"}
+	if err := repo.UpdateMapping(*m); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, repo, "upd"); got.Title != "Renamed" || got.RedirectType != 301 || got.Headers["X-A"] != "1" {
+		t.Errorf("after UpdateMapping = %+v", got)
+	}
+
+	if err := repo.DeleteMapping("upd"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetMapping("upd"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("GetMapping after delete error = %v, want ErrNotFound", err)
+	}
+	for name, err := range map[string]error{
+		"UpdateLongURL": repo.UpdateLongURL("upd", "https://example.com"),
+		"UpdateMapping": repo.UpdateMapping(*m),
+		"DeleteMapping": repo.DeleteMapping("upd"),
+	} {
+		if !errors.Is(err, repositories.ErrNotFound) {
+			t.Errorf("%s of a deleted code error = %v, want ErrNotFound", name, err)
+		}
+	}
+}
+
+func testApplyBulk(t *testing.T, repo repositories.ShortenerRepository) {
+	bulk, ok := repo.(repositories.BulkWriter)
+	if !ok {
+		t.Skip("not a BulkWriter")
+	}
+	mustCreate(t, repo, shortner.URLMapping{ShortCode: "bulk1", LongURL: "https://example.com/1"})
+	mustCreate(t, repo, shortner.URLMapping{ShortCode: "bulk2", LongURL: "https://example.com/2"})
+	update := *mustGet(t, repo, "bulk1")
+	update.RedirectType = 301
+
+	// A missing code fails the whole batch.
+	err := bulk.ApplyBulk([]shortner.URLMapping{update}, []string{"bulk2", "missing"})
+	if errors.Is(err, repositories.ErrBulkUnsupported) {
+		t.Skip("the codes are not stored together")
+	}
+	if !errors.Is(err, repositories.ErrNotFound) {
+		t.Fatalf("ApplyBulk with a missing code error = %v, want ErrNotFound", err)
+	}
+	if got := mustGet(t, repo, "bulk1"); got.RedirectType == 301 {
+		t.Error("a failed batch updated bulk1")
+	}
+	mustGet(t, repo, "bulk2")
+
+	if err := bulk.ApplyBulk([]shortner.URLMapping{update}, []string{"bulk2"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, repo, "bulk1"); got.RedirectType != 301 {
+		t.Errorf("bulk1 redirect type = %d after ApplyBulk, want 301", got.RedirectType)
+	}
+	if _, err := repo.GetMapping("bulk2"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("GetMapping(bulk2) after ApplyBulk error = %v, want ErrNotFound", err)
+	}
+}
+
+func testConsumeOnce(t *testing.T, repo repositories.ShortenerRepository) {
+	mustCreate(t, repo, shortner.URLMapping{ShortCode: "once", LongURL: "https://example.com", SingleUse: true})
+	mustCreate(t, repo, shortner.URLMapping{ShortCode: "many", LongURL: "https://example.com/many"})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := repo.ConsumeMapping("once", now); err != nil {
+		t.Fatalf("first ConsumeMapping: %v", err)
+	}
+	if err := repo.ConsumeMapping("once", now); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("second ConsumeMapping error = %v, want ErrNotFound", err)
+	}
+	if err := repo.ConsumeMapping("many", now); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("ConsumeMapping of a reusable link error = %v, want ErrNotFound", err)
+	}
+	if m := mustGet(t, repo, "once"); m.ConsumedAt == nil || !m.ConsumedAt.Equal(now) {
+		t.Errorf("ConsumedAt = %v, want %v", m.ConsumedAt, now)
+	}
+}
+
+func testListSince(t *testing.T, repo repositories.ShortenerRepository) {
+	lister := linkLister(repo)
+	if lister == nil {
+		t.Skip("not a LinkLister")
+	}
+	const total = 25
+	for i := 0; i < total; i++ {
+		code := fmt.Sprintf("c%02d", i)
+		mustCreate(t, repo, shortner.URLMapping{ShortCode: code, LongURL: "https://example.com/" + code})
+	}
+	seen := make(map[string]bool)
+	var afterID int64
+	for pages := 0; ; pages++ {
+		if pages > total {
+			t.Fatal("ListSince does not advance")
+		}
+		page, err := lister.ListSince(afterID, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range page {
+			if m.ID <= afterID {
+				t.Fatalf("ListSince(%d) returned id %d", afterID, m.ID)
+			}
+			if seen[m.ShortCode] {
+				t.Fatalf("%s listed twice", m.ShortCode)
+			}
+			seen[m.ShortCode] = true
+			if m.LongURL != "https://example.com/"+m.ShortCode {
+				t.Errorf("%s lists destination %q", m.ShortCode, m.LongURL)
+			}
+			afterID = m.ID
+		}
+		if len(page) < 7 {
+			break
+		}
+	}
+	if len(seen) != total {
+		t.Errorf("ListSince listed %d links, want %d", len(seen), total)
+	}
+}
+
+func testListExpired(t *testing.T, repo repositories.ShortenerRepository) {
+	lister := linkLister(repo)
+	if lister == nil {
+		t.Skip("not a LinkLister")
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, offset := range []time.Duration{-3 * time.Hour, -time.Hour, time.Hour} {
+		expires := now.Add(offset)
+		mustCreate(t, repo, shortner.URLMapping{ShortCode: fmt.Sprintf("e%d", i), LongURL: "https://example.com/e", ExpiresAt: &expires})
+	}
+	mustCreate(t, repo, shortner.URLMapping{ShortCode: "forever", LongURL: "https://example.com/f"})
+
+	expired, err := lister.ListExpired(now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for _, m := range expired {
+		codes = append(codes, m.ShortCode)
+	}
+	if strings.Join(codes, ",") != "e0,e1" {
+		t.Errorf("ListExpired = %v, want [e0 e1] oldest first", codes)
+	}
+	if limited, _ := lister.ListExpired(now, 1); len(limited) != 1 || limited[0].ShortCode != "e0" {
+		t.Errorf("ListExpired with limit 1 = %+v", limited)
+	}
+}
+
+func TestFileKeyValueStoreReopens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.kv")
+	store, err := repositories.OpenFileKeyValueStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := repositories.NewKeyValueShortenerRepo(store, false)
+	mustCreate(t, repo, shortner.URLMapping{ShortCode: "kept", LongURL: "https://example.com/kept", StatsVisibility: shortner.StatsToken, StatsToken: "secret"})
+	mustCreate(t, repo, shortner.URLMapping{ShortCode: "gone", LongURL: "https://example.com/gone"})
+	if err := repo.UpdateLongURL("kept", "https://example.com/changed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteMapping("gone"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// A crash in the middle of a write leaves a torn record behind.
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{1, 5, 200})
+	file.Close()
+
+	store, err = repositories.OpenFileKeyValueStore(path)
+	if err != nil {
+		t.Fatalf("reopening after a torn write: %v", err)
+	}
+	defer store.Close()
+	repo = repositories.NewKeyValueShortenerRepo(store, false)
+	if m := mustGet(t, repo, "kept"); m.LongURL != "https://example.com/changed" || m.StatsToken != "secret" {
+		t.Errorf("kept after reopening = %+v", m)
+	}
+	if _, err := repo.GetMapping("gone"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("GetMapping(gone) after reopening error = %v, want ErrNotFound", err)
+	}
+	id, err := repo.CreateMapping(shortner.URLMapping{ShortCode: "next", LongURL: "https://example.com/next"})
+	if err != nil || id != 3 {
+		t.Errorf("CreateMapping after reopening = %d, %v, want id 3", id, err)
+	}
+}
+
+func TestLegacySchemaUpgrade(t *testing.T) {
+	db := openDB(t, "legacy.db")
+	// The table as the first release created it.
+	if _, err := db.Exec(`CREATE TABLE urls (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		short_code TEXT NOT NULL UNIQUE,
+		long_url TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO urls(short_code, long_url) VALUES ('legacy', 'https://example.com/legacy');`); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := repositories.NewSQLiteShortenerRepo(db, false)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatalf("upgrading legacy schema: %v", err)
+	}
+	m := mustGet(t, repo, "legacy")
+	if m.LongURL != "https://example.com/legacy" || m.Kind != shortner.KindRedirect || m.RedirectType != 302 || m.StatsVisibility != shortner.StatsPrivate {
+		t.Errorf("legacy row after upgrade = %+v", m)
+	}
+	if code, err := repo.FindByLongURL("https://example.com/legacy"); err != nil || code != "legacy" {
+		t.Errorf("FindByLongURL of legacy row = %q, %v", code, err)
+	}
+}
+
+func TestCaseInsensitiveCodes(t *testing.T) {
+	db := openDB(t, "links.db")
+	mixed := repositories.NewSQLiteShortenerRepo(db, false)
+	if err := mixed.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	mustCreate(t, mixed, shortner.URLMapping{ShortCode: "AbC", LongURL: "https://example.com/1"})
+	mustCreate(t, mixed, shortner.URLMapping{ShortCode: "abc", LongURL: "https://example.com/2"})
+
+	// Codes differing only in case cannot be made case-insensitive.
+	if err := repositories.NewSQLiteShortenerRepo(db, true).InitSchema(); err == nil {
+		t.Fatal("InitSchema accepted codes that differ only in case")
+	}
+	if err := mixed.DeleteMapping("abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := repositories.NewSQLiteShortenerRepo(db, true)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	if m := mustGet(t, repo, "abc"); m.ShortCode != "AbC" {
+		t.Errorf("lookup ignoring case returned %q, want the stored AbC", m.ShortCode)
+	}
+	if _, err := repo.CreateMapping(shortner.URLMapping{ShortCode: "ABC", LongURL: "https://example.com/3"}); err == nil {
+		t.Error("CreateMapping accepted a code differing only in case")
+	}
+}
+
+func TestEncryptionAtRest(t *testing.T) {
+	db := openDB(t, "links.db")
+	plain := repositories.NewSQLiteShortenerRepo(db, false)
+	if err := plain.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	mustCreate(t, plain, shortner.URLMapping{ShortCode: "before", LongURL: "https://example.com/before"})
+
+	oldKey := testCipher(t, 1)
+	repo := repositories.NewSQLiteShortenerRepo(db, false)
+	repo.EnableEncryption(oldKey)
+	mustCreate(t, repo, shortner.URLMapping{ShortCode: "after", LongURL: "https://example.com/after"})
+
+	var stored string
+	if err := db.QueryRow("SELECT long_url FROM urls WHERE short_code = 'after'").Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored, "example.com") {
+		t.Fatalf("destination stored in plaintext: %q", stored)
+	}
+	// Rows written before encryption was enabled stay readable.
+	if m := mustGet(t, repo, "before"); m.LongURL != "https://example.com/before" {
+		t.Errorf("plaintext row reads as %q", m.LongURL)
+	}
+	if code, _ := repo.FindByLongURL("https://example.com/after"); code != "after" {
+		t.Errorf("FindByLongURL of an encrypted row = %q, want after", code)
+	}
+
+	// Rotate: the new key encrypts, the old one still decrypts.
+	newKeyBytes := make([]byte, 32)
+	for i := range newKeyBytes {
+		newKeyBytes[i] = 200 - byte(i)
+	}
+	oldKeyBytes := make([]byte, 32)
+	for i := range oldKeyBytes {
+		oldKeyBytes[i] = 1 + byte(i)
+	}
+	rotated, err := fieldcrypt.New(newKeyBytes, oldKeyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.EnableEncryption(rotated)
+	rewritten, err := repo.Reencrypt(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewritten != 2 {
+		t.Errorf("Reencrypt rewrote %d rows, want 2 (one plaintext, one under the old key)", rewritten)
+	}
+	if again, _ := repo.Reencrypt(10); again != 0 {
+		t.Errorf("second Reencrypt rewrote %d rows, want 0", again)
+	}
+
+	newOnly, err := fieldcrypt.New(newKeyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.EnableEncryption(newOnly)
+	for _, code := range []string{"before", "after"} {
+		if m := mustGet(t, repo, code); m.LongURL != "https://example.com/"+code {
+			t.Errorf("%s reads as %q with only the new key", code, m.LongURL)
+		}
+		if found, _ := repo.FindByLongURL("https://example.com/" + code); found != code {
+			t.Errorf("FindByLongURL(%s) = %q with only the new key", code, found)
+		}
+	}
+}
+
+func TestFindByDestination(t *testing.T) {
+	db := openDB(t, "links.db")
+	repo := repositories.NewSQLiteShortenerRepo(db, false)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	mustCreate(t, repo, shortner.URLMapping{ShortCode: "plain", LongURL: "https://example.com/a"})
+	mustCreate(t, repo, shortner.URLMapping{ShortCode: "other", LongURL: "https://example.com/b"})
+	encrypted := repositories.NewSQLiteShortenerRepo(db, false)
+	encrypted.EnableEncryption(testCipher(t, 1))
+	mustCreate(t, encrypted, shortner.URLMapping{ShortCode: "sealed", LongURL: "https://example.com/a"})
+
+	find := func(query shortner.DestinationQuery) string {
+		t.Helper()
+		mappings, err := encrypted.FindByDestination(context.Background(), query, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var codes []string
+		for _, m := range mappings {
+			codes = append(codes, m.ShortCode)
+		}
+		return strings.Join(codes, ",")
+	}
+	if got := find(shortner.DestinationQuery{URLs: []string{"https://example.com/a"}}); got != "plain,sealed" {
+		t.Errorf("exact match = %s, want plain,sealed", got)
+	}
+	// Encrypted destinations cannot be compared by prefix.
+	if got := find(shortner.DestinationQuery{Prefixes: []string{"https://example.com/"}}); got != "plain,other" {
+		t.Errorf("prefix match = %s, want plain,other", got)
+	}
+	if got := find(shortner.DestinationQuery{}); got != "" {
+		t.Errorf("empty query matched %s", got)
+	}
+}
+
+// TestLinkSearch runs against the full-text index when built with the
+// sqlite_fts5 tag and against the LIKE fallback otherwise; both must give
+// the same matches.
+func TestLinkSearch(t *testing.T) {
+	db := openDB(t, "links.db")
+	repo := repositories.NewSQLiteShortenerRepo(db, false)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	mustCreate(t, repo, shortner.URLMapping{ShortCode: "docs", LongURL: "https://docs.example.com/getting-started", Title: "Guide"})
+	mustCreate(t, repo, shortner.URLMapping{ShortCode: "blog", LongURL: "https://example.org/blog", Title: "Company blog"})
+	encrypted := repositories.NewSQLiteShortenerRepo(db, false)
+	encrypted.EnableEncryption(testCipher(t, 1))
+	mustCreate(t, encrypted, shortner.URLMapping{ShortCode: "secret", LongURL: "https://plans.example.net/", Title: "Secret plans"})
+
+	search := func(query string, page shortner.SearchPage) []string {
+		t.Helper()
+		if page.Limit == 0 {
+			page.Limit = 10
+		}
+		mappings, err := repo.Search(context.Background(), query, page)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", query, err)
+		}
+		var codes []string
+		for _, m := range mappings {
+			codes = append(codes, m.ShortCode)
+		}
+		sort.Strings(codes)
+		return codes
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"example", []string{"blog", "docs"}},
+		{"getting", []string{"docs"}},
+		{"comp blog", []string{"blog"}},
+		{"guide blog", nil},
+		{"plans", []string{"secret"}},
+		{"example.net", nil},
+	}
+	for _, tt := range tests {
+		if got := search(tt.query, shortner.SearchPage{}); !slices.Equal(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+	if got := search("example", shortner.SearchPage{Offset: 1, Limit: 5}); len(got) != 1 {
+		t.Errorf("second page of example = %v, want one link", got)
+	}
+
+	// The index follows updates and deletes, and survives a restart.
+	blog := mustGet(t, repo, "blog")
+	blog.Title = "Changelog"
+	if err := repo.UpdateMapping(*blog); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteMapping("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	if got := search("changelog", shortner.SearchPage{}); !slices.Equal(got, []string{"blog"}) {
+		t.Errorf("Search(changelog) after the update = %v", got)
+	}
+	if got := search("company", shortner.SearchPage{}); got != nil {
+		t.Errorf("Search(company) still finds the old title: %v", got)
+	}
+	if got := search("docs", shortner.SearchPage{}); got != nil {
+		t.Errorf("Search(docs) finds a deleted link: %v", got)
+	}
+
+	sharded := repositories.NewShardedShortenerRepo([]repositories.ShortenerRepository{repo})
+	if _, err := sharded.Search(context.Background(), "example", shortner.SearchPage{Limit: 10}); !errors.Is(err, repositories.ErrSearchUnsupported) {
+		t.Errorf("sharded Search error = %v, want ErrSearchUnsupported", err)
+	}
+}
+
+func TestTrashRepository(t *testing.T) {
+	db := openDB(t, "links.db")
+	repo := repositories.NewSQLiteTrashRepo(db)
+	repo.EnableEncryption(testCipher(t, 1))
+	if err := repo.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	link := shortner.URLMapping{ShortCode: "gone", Kind: shortner.KindRedirect, LongURL: "https://example.com/secret", RedirectType: 301, StatsToken: "tok"}
+	if err := repo.AddTrash(link, base); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.AddTrash(shortner.URLMapping{ShortCode: "later", LongURL: "https://example.com/later"}, base.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored string
+	if err := db.QueryRow("SELECT link FROM link_trash WHERE short_code = 'gone'").Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored, "example.com") {
+		t.Fatalf("trashed link stored in plaintext: %q", stored)
+	}
+	entry, err := repo.GetTrash("gone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Link.LongURL != link.LongURL || entry.Link.RedirectType != 301 || entry.Link.StatsToken != "tok" || !entry.DeletedAt.Equal(base) {
+		t.Errorf("GetTrash = %+v", entry)
+	}
+
+	// Trashing a code again replaces its entry and moves it to the top.
+	if err := repo.AddTrash(link, base.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	page, err := repo.ListTrash(0, 10)
+	if err != nil || len(page) != 2 || page[0].Link.ShortCode != "gone" {
+		t.Fatalf("ListTrash = %+v, %v, want gone then later", page, err)
+	}
+	if rest, _ := repo.ListTrash(page[0].ID, 10); len(rest) != 1 || rest[0].Link.ShortCode != "later" {
+		t.Errorf("ListTrash after the first entry = %+v, want later", rest)
+	}
+	if old, _ := repo.ListTrashedBefore(base.Add(90*time.Minute), 10); len(old) != 1 || old[0].Link.ShortCode != "later" {
+		t.Errorf("ListTrashedBefore = %+v, want later", old)
+	}
+
+	if err := repo.RemoveTrash("gone"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetTrash("gone"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("GetTrash after RemoveTrash error = %v, want ErrNotFound", err)
+	}
+	if err := repo.RemoveTrash("gone"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("second RemoveTrash error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAnomalyRepository(t *testing.T) {
+	db := openDB(t, "links.db")
+	repo := repositories.NewSQLiteAnomalyRepo(db)
+	for i := 0; i < 2; i++ {
+		if err := repo.InitSchema(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, code := range []string{"a", "b", "a"} {
+		anomaly := shortner.ClickAnomaly{ShortCode: code, Clicks: 100, Expected: 2.5, Factor: 5, WindowStart: base.Add(time.Duration(i-1) * time.Hour), DetectedAt: base.Add(time.Duration(i) * time.Hour)}
+		if _, err := repo.RecordAnomaly(anomaly); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	last, err := repo.LastDetected([]string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != 2 || !last["a"].Equal(base.Add(2*time.Hour)) || !last["b"].Equal(base.Add(time.Hour)) {
+		t.Errorf("LastDetected = %v, want a at 02:00 and b at 01:00", last)
+	}
+	page, err := repo.ListAnomalies(0, 2)
+	if err != nil || len(page) != 2 || page[0].ShortCode != "a" || page[1].ShortCode != "b" || page[0].Expected != 2.5 {
+		t.Fatalf("ListAnomalies = %+v, %v, want the newest two", page, err)
+	}
+	if rest, _ := repo.ListAnomalies(page[1].ID, 10); len(rest) != 1 || !rest[0].DetectedAt.Equal(base) {
+		t.Errorf("ListAnomalies after the second = %+v, want the first anomaly", rest)
+	}
+}
+
+func TestHoneypotRepository(t *testing.T) {
+	db := openDB(t, "links.db")
+	repo := repositories.NewSQLiteHoneypotRepo(db)
+	for i := 0; i < 2; i++ {
+		if err := repo.InitSchema(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, code := range []string{"zz", "aa"} {
+		if err := repo.AddHoneypot(shortner.Honeypot{Code: code, CreatedAt: base}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Adding again only updates the note.
+	if err := repo.AddHoneypot(shortner.Honeypot{Code: "zz", Note: "bait", CreatedAt: base.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	for i, code := range []string{"zz", "zz", "xx"} {
+		if _, err := repo.RecordHit(shortner.HoneypotHit{Code: code, IP: "192.0.2.1", HitAt: base.Add(time.Duration(i) * time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	honeypots, err := repo.ListHoneypots()
+	if err != nil || len(honeypots) != 2 {
+		t.Fatalf("ListHoneypots = %+v, %v, want two", honeypots, err)
+	}
+	if aa := honeypots[0]; aa.Code != "aa" || aa.Hits != 0 || aa.LastHitAt != nil {
+		t.Errorf("first honeypot = %+v, want aa without hits", aa)
+	}
+	if zz := honeypots[1]; zz.Note != "bait" || !zz.CreatedAt.Equal(base) || zz.Hits != 2 || zz.LastHitAt == nil || !zz.LastHitAt.Equal(base.Add(time.Minute)) {
+		t.Errorf("second honeypot = %+v, want zz with its note, two hits, the last at 00:01", zz)
+	}
+
+	page, err := repo.ListHits(0, 2)
+	if err != nil || len(page) != 2 || page[0].Code != "xx" {
+		t.Fatalf("ListHits = %+v, %v, want the newest two", page, err)
+	}
+	if rest, _ := repo.ListHits(page[1].ID, 10); len(rest) != 1 || !rest[0].HitAt.Equal(base) {
+		t.Errorf("ListHits after the second = %+v, want the first hit", rest)
+	}
+
+	if err := repo.DeleteHoneypot("zz"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteHoneypot("zz"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("deleting zz again: error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSlackWorkspaceRepository(t *testing.T) {
+	db := openDB(t, "links.db")
+	repo := repositories.NewSQLiteSlackWorkspaceRepo(db)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SaveWorkspace("T0LEGACY", "Legacy", "secret stored before encryption"); err != nil {
+		t.Fatal(err)
+	}
+	repo.EnableEncryption(testCipher(t, 1))
+	if err := repo.SaveWorkspace("T0ACME", "Acme", "acme signing secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored string
+	if err := db.QueryRow("SELECT signing_secret FROM slack_workspaces WHERE team_id = 'T0ACME'").Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored, "acme") {
+		t.Fatalf("signing secret stored in plaintext: %q", stored)
+	}
+	for teamID, want := range map[string]string{"T0ACME": "acme signing secret", "T0LEGACY": "secret stored before encryption"} {
+		if secret, err := repo.FindSigningSecret(teamID); err != nil || secret != want {
+			t.Errorf("FindSigningSecret(%s) = %q, %v, want %q", teamID, secret, err, want)
+		}
+	}
+
+	if rewritten, err := repo.Reencrypt(10); err != nil || rewritten != 1 {
+		t.Errorf("Reencrypt = %d, %v, want the plaintext secret rewritten", rewritten, err)
+	}
+	workspaces, err := repo.ListWorkspaces()
+	if err != nil || len(workspaces) != 2 || workspaces[0].TeamID != "T0ACME" || workspaces[0].TeamName != "Acme" {
+		t.Fatalf("ListWorkspaces = %+v, %v, want Acme first", workspaces, err)
+	}
+
+	if err := repo.DeleteWorkspace("T0ACME"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetWorkspace("T0ACME"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("GetWorkspace after delete: error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestProfileRepository(t *testing.T) {
+	db := openDB(t, "links.db")
+	repo := repositories.NewSQLiteProfileRepo(db)
+	for i := 0; i < 2; i++ {
+		if err := repo.InitSchema(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := repo.SaveProfile(shortner.Profile{Username: "ann", DisplayName: "Ann", CreatedAt: base}); err != nil {
+		t.Fatal(err)
+	}
+	// Saving again keeps the creation time.
+	if err := repo.SaveProfile(shortner.Profile{Username: "ann", Bio: "Maker", CreatedAt: base.Add(time.Hour), UpdatedAt: base.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := repo.GetProfile("ann")
+	if err != nil || profile.DisplayName != "" || profile.Bio != "Maker" || !profile.CreatedAt.Equal(base) || !profile.UpdatedAt.Equal(base.Add(time.Hour)) {
+		t.Fatalf("GetProfile = %+v, %v", profile, err)
+	}
+
+	var ids []int64
+	for i, code := range []string{"second", "first"} {
+		id, err := repo.AddItem(shortner.ProfileItem{Username: "ann", ShortCode: code, Position: 1 - i, CreatedAt: base})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := repo.CountClick("ann", ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CountClick("bob", ids[0]); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("CountClick on another profile's item: error = %v, want ErrNotFound", err)
+	}
+	items, err := repo.ListItems("ann")
+	if err != nil || len(items) != 2 || items[0].ShortCode != "first" || items[1].Clicks != 1 {
+		t.Fatalf("ListItems = %+v, %v, want first, then second with a click", items, err)
+	}
+
+	if err := repo.DeleteProfile("ann"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetItem("ann", ids[1]); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("item after deleting the profile: error = %v, want ErrNotFound", err)
+	}
+	if err := repo.DeleteProfile("ann"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("deleting ann again: error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSettingsRepository(t *testing.T) {
+	db := openDB(t, "links.db")
+	repo := repositories.NewSQLiteSettingsRepo(db)
+	for i := 0; i < 2; i++ {
+		if err := repo.InitSchema(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := repo.GetSetting("branding"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Fatalf("GetSetting before saving: error = %v, want ErrNotFound", err)
+	}
+	base := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, value := range []string{`{"footer":"a"}`, `{"footer":"b"}`} {
+		if err := repo.SaveSetting("branding", value, base.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	value, updatedAt, err := repo.GetSetting("branding")
+	if err != nil || value != `{"footer":"b"}` || !updatedAt.Equal(base.Add(time.Hour)) {
+		t.Errorf("GetSetting = %q, %v, %v, want the second value", value, updatedAt, err)
+	}
+	if err := repo.DeleteSetting("branding"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteSetting("branding"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("deleting again: error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAPIKeyRepository(t *testing.T) {
+	db := openDB(t, "links.db")
+	repo := repositories.NewSQLiteAPIKeyRepo(db)
+	for i := 0; i < 2; i++ {
+		if err := repo.InitSchema(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	key := shortner.APIKey{ID: "ci", Name: "CI", Scopes: []string{shortner.ScopeLinksRead, shortner.ScopeStatsRead}, CreatedBy: "ops", KeyHash: "hash", CreatedAt: base, UpdatedAt: base}
+	if _, created, err := repo.PutAPIKey(key); err != nil || !created {
+		t.Fatalf("PutAPIKey = %t, %v, want created", created, err)
+	}
+
+	key.Scopes, key.CreatedBy, key.UpdatedAt = []string{shortner.ScopeAdmin}, "someone else", base.Add(time.Hour)
+	stored, created, err := repo.PutAPIKey(key)
+	if err != nil || created {
+		t.Fatalf("PutAPIKey again = %t, %v, want an update", created, err)
+	}
+	if strings.Join(stored.Scopes, " ") != shortner.ScopeAdmin || stored.CreatedBy != "ops" {
+		t.Errorf("updated key has scopes %v and creator %q, want admin and ops", stored.Scopes, stored.CreatedBy)
+	}
+
+	if err := repo.TouchAPIKey("ci", base.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = repo.GetAPIKeyByHash("hash")
+	if err != nil || stored.LastUsedAt == nil || !stored.LastUsedAt.Equal(base.Add(2*time.Hour)) {
+		t.Errorf("GetAPIKeyByHash = %+v, %v, want the recorded use", stored, err)
+	}
+	if err := repo.TouchAPIKey("gone", base); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("TouchAPIKey of a missing key: error = %v, want ErrNotFound", err)
+	}
+
+	rotated, err := repo.RotateAPIKey("ci", "new hash", base.Add(24*time.Hour), base.Add(3*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.KeyHash != "new hash" || rotated.PreviousKeyHash != "hash" || rotated.PreviousKeyExpiresAt == nil || !rotated.PreviousKeyExpiresAt.Equal(base.Add(24*time.Hour)) {
+		t.Errorf("rotated key = %+v, want the new hash with the old one until a day later", rotated)
+	}
+	for _, hash := range []string{"hash", "new hash"} {
+		if found, err := repo.GetAPIKeyByHash(hash); err != nil || found.ID != "ci" {
+			t.Errorf("GetAPIKeyByHash(%q) = %+v, %v, want ci", hash, found, err)
+		}
+	}
+	if _, err := repo.RotateAPIKey("gone", "other hash", base, base); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("RotateAPIKey of a missing key: error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestOpenSQLiteShortenerRepoShards(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.db"), filepath.Join(dir, "b.db")}
+	open := func() repositories.ShortenerRepository {
+		repo, dbs, err := repositories.OpenSQLiteShortenerRepo(paths, repositories.ConnectDB, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			for _, db := range dbs {
+				db.Close()
+			}
+		})
+		if err := repo.InitSchema(); err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	}
+
+	repo := open()
+	for i := 0; i < 20; i++ {
+		mustCreate(t, repo, shortner.URLMapping{ShortCode: fmt.Sprintf("k%d", i), LongURL: fmt.Sprintf("https://example.com/%d", i)})
+	}
+	// Reopening the same files finds every link on the shard it was
+	// written to.
+	reopened := open()
+	for i := 0; i < 20; i++ {
+		mustGet(t, reopened, fmt.Sprintf("k%d", i))
+	}
+	for _, path := range paths {
+		db, err := repositories.ConnectDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		db.QueryRow("SELECT COUNT(*) FROM urls").Scan(&n)
+		db.Close()
+		if n == 0 {
+			t.Errorf("shard %s holds no links", filepath.Base(path))
+		}
+	}
+}
+
+func TestDualWriteMirrors(t *testing.T) {
+	primary := repositories.NewSQLiteShortenerRepo(openDB(t, "primary.db"), false)
+	secondary := repositories.NewSQLiteShortenerRepo(openDB(t, "secondary.db"), false)
+	for _, r := range []repositories.ShortenerRepository{primary, secondary} {
+		if err := r.InitSchema(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo := repositories.NewDualWriteShortenerRepo(primary, secondary)
+
+	mustCreate(t, repo, shortner.URLMapping{ShortCode: "x", LongURL: "https://example.com/x", SingleUse: true})
+	if err := repo.UpdateLongURL("x", "https://example.com/y"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.ConsumeMapping("x", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	m := mustGet(t, secondary, "x")
+	if m.LongURL != "https://example.com/y" || m.ConsumedAt == nil {
+		t.Errorf("secondary copy = %+v, want the new destination, consumed", m)
+	}
+	if err := repo.DeleteMapping("x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := secondary.GetMapping("x"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("secondary still has the deleted link (err %v)", err)
+	}
+}
+
+// blockingRepo counts GetMapping calls and holds each until release is
+// closed.
+type blockingRepo struct {
+	repositories.ShortenerRepository
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (r *blockingRepo) GetMapping(shortCode string) (*shortner.URLMapping, error) {
+	r.calls.Add(1)
+	<-r.release
+	return r.ShortenerRepository.GetMapping(shortCode)
+}
+
+func TestCoalescedLookups(t *testing.T) {
+	sqlite := repositories.NewSQLiteShortenerRepo(openDB(t, "links.db"), false)
+	if err := sqlite.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	mustCreate(t, sqlite, shortner.URLMapping{ShortCode: "viral", LongURL: "https://example.com/a"})
+	blocking := &blockingRepo{ShortenerRepository: sqlite, release: make(chan struct{})}
+	repo := repositories.NewCoalescingShortenerRepo(blocking)
+
+	const callers = 20
+	results := make(chan *shortner.URLMapping, callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			m, err := repo.GetMapping("viral")
+			if err != nil {
+				t.Error(err)
+			}
+			results <- m
+		}()
+	}
+	for blocking.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// Give the other callers time to join the query in flight.
+	time.Sleep(50 * time.Millisecond)
+	close(blocking.release)
+
+	seen := make(map[*shortner.URLMapping]bool)
+	for i := 0; i < callers; i++ {
+		m := <-results
+		if m == nil || m.LongURL != "https://example.com/a" {
+			t.Fatalf("GetMapping = %+v", m)
+		}
+		seen[m] = true
+	}
+	if n := blocking.calls.Load(); n != 1 {
+		t.Errorf("%d callers made %d queries, want 1", callers, n)
+	}
+	if len(seen) != callers {
+		t.Errorf("callers got %d distinct mappings, want a copy each", len(seen))
+	}
+
+	if err := repo.UpdateLongURL("viral", "https://example.com/b"); err != nil {
+		t.Fatal(err)
+	}
+	if m := mustGet(t, repo, "viral"); m.LongURL != "https://example.com/b" {
+		t.Errorf("LongURL after update = %q", m.LongURL)
+	}
+}
+
+func TestLinkCache(t *testing.T) {
+	sqlite := repositories.NewSQLiteShortenerRepo(openDB(t, "links.db"), true)
+	if err := sqlite.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"hot", "warm", "cold"} {
+		mustCreate(t, sqlite, shortner.URLMapping{ShortCode: code, LongURL: "https://example.com/" + code})
+	}
+	counting := &blockingRepo{ShortenerRepository: sqlite, release: make(chan struct{})}
+	close(counting.release)
+	repo := repositories.NewCachedShortenerRepo(counting, 2, time.Minute, 0, true)
+
+	loaded, err := repo.Warm([]string{"hot", "gone", "warm"})
+	if err != nil || loaded != 2 {
+		t.Fatalf("Warm = %d, %v; want 2 links", loaded, err)
+	}
+	counting.calls.Store(0)
+	mustGet(t, repo, "HOT")
+	mustGet(t, repo, "warm")
+	if n := counting.calls.Load(); n != 0 {
+		t.Errorf("warmed links made %d queries, want none", n)
+	}
+
+	// The cache holds two links: loading a third evicts the least
+	// recently used one.
+	mustGet(t, repo, "cold")
+	mustGet(t, repo, "hot")
+	if n := counting.calls.Load(); n != 2 {
+		t.Errorf("queries after eviction = %d, want 2", n)
+	}
+
+	if err := repo.UpdateLongURL("Cold", "https://example.com/new"); err != nil {
+		t.Fatal(err)
+	}
+	if m := mustGet(t, repo, "cold"); m.LongURL != "https://example.com/new" {
+		t.Errorf("LongURL after update = %q, want the new destination", m.LongURL)
+	}
+	if err := repo.DeleteMapping("hot"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetMapping("hot"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("deleted link still served from the cache (err %v)", err)
+	}
+}
+
+func TestLinkCacheMisses(t *testing.T) {
+	sqlite := repositories.NewSQLiteShortenerRepo(openDB(t, "links.db"), false)
+	if err := sqlite.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	counting := &blockingRepo{ShortenerRepository: sqlite, release: make(chan struct{})}
+	close(counting.release)
+	repo := repositories.NewCachedShortenerRepo(counting, 10, time.Minute, time.Minute, false)
+
+	for i := 0; i < 3; i++ {
+		if _, err := repo.GetMapping("bogus"); !errors.Is(err, repositories.ErrNotFound) {
+			t.Fatalf("GetMapping #%d: err %v, want ErrNotFound", i+1, err)
+		}
+	}
+	if n := counting.calls.Load(); n != 1 {
+		t.Errorf("repeated misses made %d queries, want 1", n)
+	}
+
+	mustCreate(t, repo, shortner.URLMapping{ShortCode: "bogus", LongURL: "https://example.com/now"})
+	if m := mustGet(t, repo, "bogus"); m.LongURL != "https://example.com/now" {
+		t.Errorf("LongURL after creation = %q", m.LongURL)
+	}
+}
+
+func TestLinkCacheShardMetrics(t *testing.T) {
+	sqlite := repositories.NewSQLiteShortenerRepo(openDB(t, "links.db"), false)
+	if err := sqlite.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	codes := []string{"a", "b", "c", "d", "e", "f"}
+	for _, code := range codes {
+		mustCreate(t, sqlite, shortner.URLMapping{ShortCode: code, LongURL: "https://example.com/" + code})
+	}
+	// Two shards of one link each: every shard evicts once it holds a
+	// second code.
+	repo := repositories.NewCachedShortenerRepo(sqlite, 2, time.Minute, 0, false)
+	repo.SetShards(2)
+	reg := metrics.NewRegistry(nil)
+	repo.EnableMetrics(reg)
+
+	for _, code := range codes {
+		mustGet(t, repo, code)
+	}
+	for _, code := range codes[len(codes)-1:] {
+		mustGet(t, repo, code)
+	}
+
+	var exposition strings.Builder
+	reg.Write(&exposition, false)
+	sum := func(name string) float64 {
+		total := 0.0
+		for _, line := range strings.Split(exposition.String(), "\n") {
+			if series, value, ok := strings.Cut(line, " "); ok && strings.HasPrefix(series, name+"{") {
+				v, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					t.Fatalf("%s: %v", line, err)
+				}
+				total += v
+			}
+		}
+		return total
+	}
+	if hits, misses := sum("shortener_link_cache_hits_total"), sum("shortener_link_cache_misses_total"); hits != 1 || misses != 6 {
+		t.Errorf("hits, misses = %v, %v; want 1, 6", hits, misses)
+	}
+	if evictions := sum("shortener_link_cache_evictions_total"); evictions != 4 {
+		t.Errorf("evictions = %v, want 4: six codes in two shards of one", evictions)
+	}
+}
+
+func TestClickRepository(t *testing.T) {
+	repo := repositories.NewSQLiteClickRepo(openDB(t, "clicks.db"))
+	for i := 0; i < 2; i++ {
+		if err := repo.InitSchema(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := time.Now().UTC().Truncate(time.Second)
+	for i, code := range []string{"a", "b", "a"} {
+		if _, err := repo.RecordClick(shortner.Click{ShortCode: code, ClickedAt: base.Add(time.Duration(i) * time.Minute), IP: "192.0.2.1", UserAgent: "ua"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	batch := []shortner.Click{
+		{ShortCode: "a", ClickedAt: base.Add(3 * time.Minute), IP: "192.0.2.1", UserAgent: "ua"},
+		{ShortCode: "c", ClickedAt: base.Add(4 * time.Minute), IP: "192.0.2.1", UserAgent: "ua"},
+	}
+	ids, err := repo.RecordClicks(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[1] != ids[0]+1 {
+		t.Errorf("RecordClicks ids = %v, want two consecutive ids", ids)
+	}
+
+	all, err := repo.ListSince(0, 100)
+	if err != nil || len(all) != 5 {
+		t.Fatalf("ListSince = %d clicks, %v, want 5", len(all), err)
+	}
+	if rest, _ := repo.ListSince(all[1].ID, 100); len(rest) != 3 {
+		t.Errorf("ListSince after the second click = %d clicks, want 3", len(rest))
+	}
+	forA, err := repo.ListForLink("a", 0, 100)
+	if err != nil || len(forA) != 3 {
+		t.Errorf("ListForLink(a) = %d clicks, %v, want 3", len(forA), err)
+	}
+	between, err := repo.ListBetween([]string{"a", "c"}, base.Add(time.Minute), base.Add(4*time.Minute), 0, 100)
+	if err != nil || len(between) != 2 || between[0].ID != forA[1].ID || between[1].ID != forA[2].ID {
+		t.Errorf("ListBetween(a, c) = %+v, %v, want the second and third clicks on a", between, err)
+	}
+	if rest, _ := repo.ListBetween([]string{"a", "c"}, base.Add(time.Minute), base.Add(4*time.Minute), between[0].ID, 100); len(rest) != 1 {
+		t.Errorf("ListBetween after the first match = %d clicks, want 1", len(rest))
+	}
+
+	top, total, err := repo.TopLinks(nil, base, base.Add(time.Hour), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 5 || len(top) != 2 || top[0].ShortCode != "a" || top[0].Clicks != 3 {
+		t.Errorf("TopLinks = %+v, total %d", top, total)
+	}
+	if _, total, _ := repo.TopLinks([]string{"b", "c"}, base, base.Add(time.Hour), 10); total != 2 {
+		t.Errorf("TopLinks restricted to b and c counted %d clicks, want 2", total)
+	}
+
+	counts, err := repo.CountPerPeriod([]string{"a", "c"}, base, base.Add(time.Hour), shortner.IntervalDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	perLink := map[string]int64{}
+	for _, count := range counts {
+		if !count.Start.Equal(base.Truncate(24*time.Hour)) && !count.Start.Equal(base.Add(time.Hour).Truncate(24*time.Hour)) {
+			t.Errorf("period of %s starts at %s, not at midnight UTC", count.ShortCode, count.Start)
+		}
+		perLink[count.ShortCode] += count.Clicks
+	}
+	if perLink["a"] != 3 || perLink["c"] != 1 || len(perLink) != 2 {
+		t.Errorf("CountPerPeriod = %+v, want 3 clicks on a and 1 on c", counts)
+	}
+	hourly, err := repo.CountPerPeriod([]string{"b"}, base, base.Add(time.Hour), shortner.IntervalHour)
+	if err != nil || len(hourly) != 1 || hourly[0].Start.Minute() != 0 || hourly[0].Clicks != 1 {
+		t.Errorf("hourly CountPerPeriod(b) = %+v, %v", hourly, err)
+	}
+}
+
+// schemaIniters returns every repository that migrates its own tables at
+// startup, in the order the application initializes them.
+func schemaIniters(db *sql.DB) map[string]interface{ InitSchema() error } {
+	return map[string]interface{ InitSchema() error }{
+		"links":     repositories.NewSQLiteShortenerRepo(db, false),
+		"slack":     repositories.NewSQLiteSlackWorkspaceRepo(db),
+		"clicks":    repositories.NewSQLiteClickRepo(db),
+		"hooks":     repositories.NewSQLiteHookRepo(db),
+		"bundles":   repositories.NewSQLiteBundleRepo(db),
+		"pastes":    repositories.NewSQLitePasteRepo(db),
+		"files":     repositories.NewSQLiteFileRepo(db),
+		"revisions": repositories.NewSQLiteRevisionRepo(db),
+		"schedules": repositories.NewSQLiteScheduleRepo(db),
+		"reports":   repositories.NewSQLiteReportRepo(db),
+		"stats":     repositories.NewSQLiteStatsRepo(db),
+		"pixels":    repositories.NewSQLitePixelRepo(db),
+		"flags":     repositories.NewSQLiteFlagRepo(db),
+		"trash":     repositories.NewSQLiteTrashRepo(db),
+		"blocks":    repositories.NewSQLiteRedirectBlockRepo(db),
+		"claims":    repositories.NewSQLiteDomainClaimRepo(db),
+		"anomalies": repositories.NewSQLiteAnomalyRepo(db),
+		"honeypots": repositories.NewSQLiteHoneypotRepo(db),
+		"profiles":  repositories.NewSQLiteProfileRepo(db),
+		"settings":  repositories.NewSQLiteSettingsRepo(db),
+		"api keys":  repositories.NewSQLiteAPIKeyRepo(db),
+	}
+}
+
+// tableColumns lists the columns of every table in db as "table.column".
+func tableColumns(t *testing.T, db *sql.DB) map[string]bool {
+	t.Helper()
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		tables = append(tables, name)
+	}
+	rows.Close()
+
+	columns := make(map[string]bool)
+	for _, table := range tables {
+		if strings.HasPrefix(table, "urls_search") {
+			// The link search index is derived from urls and built at
+			// startup, not by the migrations.
+			continue
+		}
+		rows, err := db.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var name string
+			rows.Scan(&name)
+			columns[table+"."+name] = true
+		}
+		rows.Close()
+	}
+	return columns
+}
+
+// TestMigrationSet applies migration/*.sql in order, as an operator
+// managing the schema by hand would, and checks that it yields the columns
+// the repositories create themselves and that startup accepts the result.
+func TestMigrationSet(t *testing.T) {
+	files, err := filepath.Glob("../../migration/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migration files found (%v)", err)
+	}
+	migrated := openDB(t, "migrated.db")
+	for _, file := range files {
+		script, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrated.Exec(string(script)); err != nil {
+			t.Fatalf("applying %s: %v", filepath.Base(file), err)
+		}
+	}
+
+	initialized := openDB(t, "initialized.db")
+	for name, repo := range schemaIniters(initialized) {
+		if err := repo.InitSchema(); err != nil {
+			t.Fatalf("InitSchema of %s: %v", name, err)
+		}
+	}
+
+	fromMigrations := tableColumns(t, migrated)
+	fromRepos := tableColumns(t, initialized)
+	for column := range fromMigrations {
+		if !fromRepos[column] {
+			t.Errorf("%s is created by the migrations but not by InitSchema", column)
+		}
+	}
+	for column := range fromRepos {
+		if !fromMigrations[column] {
+			t.Errorf("%s is created by InitSchema but missing from the migrations", column)
+		}
+	}
+
+	for name, repo := range schemaIniters(migrated) {
+		if err := repo.InitSchema(); err != nil {
+			t.Errorf("InitSchema of %s on the migrated database: %v", name, err)
+		}
+	}
+}
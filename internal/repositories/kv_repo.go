@@ -0,0 +1,304 @@
+package repositories
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// KeyValueStore is the storage a KeyValueShortenerRepo keeps links in:
+// values by key, with the two atomic writes needed to give a code to one
+// link only and to open a single-use link only once. Embedded stores such
+// as BoltDB and Badger and services such as DynamoDB offer them, as
+// transactions or conditional writes.
+type KeyValueStore interface {
+	// Get returns the value of key, or ErrNotFound.
+	Get(key string) ([]byte, error)
+	// Insert stores value under key unless key is taken, in which case it
+	// fails with ErrKeyExists.
+	Insert(key string, value []byte) error
+	// Swap replaces the value of key with value if it still is old. It
+	// fails with ErrNotFound when key is gone and ErrValueChanged when it
+	// holds something else.
+	Swap(key string, old, value []byte) error
+	// Delete removes key, or fails with ErrNotFound.
+	Delete(key string) error
+}
+
+var (
+	// ErrKeyExists is returned by KeyValueStore.Insert for a taken key.
+	ErrKeyExists = errors.New("key already exists")
+	// ErrValueChanged is returned by KeyValueStore.Swap when the value was
+	// changed by someone else since it was read.
+	ErrValueChanged = errors.New("value changed since it was read")
+)
+
+// Keys of a KeyValueShortenerRepo.
+const (
+	kvLinkPrefix = "link/"
+	kvSequence   = "seq/links"
+)
+
+// kvSwapRetries bounds the read-modify-swap loops, so that a key written
+// continuously by others fails instead of spinning.
+const kvSwapRetries = 100
+
+// KeyValueShortenerRepo stores every link as JSON under its short code in a
+// KeyValueStore, and link IDs in a counter key. It is neither a
+// LongURLIndex nor a LinkLister: a store that holds only keys cannot find
+// links by destination or list them, so shortening a destination twice
+// gives two links, the links API cannot list and expired links are not
+// reaped, though they stop resolving all the same.
+type KeyValueShortenerRepo struct {
+	store           KeyValueStore
+	caseInsensitive bool
+}
+
+// kvLink is the stored form of a link; StatsToken is left out of the JSON
+// of URLMapping.
+type kvLink struct {
+	shortner.URLMapping
+	StatsToken string `json:"stats_token,omitempty"`
+}
+
+// NewKeyValueShortenerRepo stores links in store. With caseInsensitive,
+// codes are stored lower-cased, so abc and ABC are one code; the link keeps
+// the case it was created with.
+func NewKeyValueShortenerRepo(store KeyValueStore, caseInsensitive bool) *KeyValueShortenerRepo {
+	return &KeyValueShortenerRepo{store: store, caseInsensitive: caseInsensitive}
+}
+
+func (r *KeyValueShortenerRepo) key(shortCode string) string {
+	if r.caseInsensitive {
+		shortCode = strings.ToLower(shortCode)
+	}
+	return kvLinkPrefix + shortCode
+}
+
+// InitSchema has nothing to create.
+func (r *KeyValueShortenerRepo) InitSchema() error {
+	return nil
+}
+
+// nextID increments the ID counter.
+func (r *KeyValueShortenerRepo) nextID() (int64, error) {
+	for i := 0; i < kvSwapRetries; i++ {
+		old, err := r.store.Get(kvSequence)
+		if errors.Is(err, ErrNotFound) {
+			err = r.store.Insert(kvSequence, []byte("1"))
+			if errors.Is(err, ErrKeyExists) {
+				continue
+			}
+			return 1, err
+		}
+		if err != nil {
+			return 0, err
+		}
+		last, err := strconv.ParseInt(string(old), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("link ID counter: %w", err)
+		}
+		err = r.store.Swap(kvSequence, old, []byte(strconv.FormatInt(last+1, 10)))
+		if errors.Is(err, ErrValueChanged) || errors.Is(err, ErrNotFound) {
+			continue
+		}
+		return last + 1, err
+	}
+	return 0, errors.New("link ID counter changed too often to increment")
+}
+
+func (r *KeyValueShortenerRepo) SaveMapping(shortCode, longURL string) (int64, error) {
+	return r.CreateMapping(shortner.URLMapping{ShortCode: shortCode, LongURL: longURL})
+}
+
+// CreateMapping applies the defaults SQLiteShortenerRepo does. A taken code
+// fails with an error wrapping ErrKeyExists; its ID is then skipped.
+func (r *KeyValueShortenerRepo) CreateMapping(mapping shortner.URLMapping) (int64, error) {
+	if mapping.Kind == "" {
+		mapping.Kind = shortner.KindRedirect
+	}
+	if mapping.RedirectType == 0 {
+		mapping.RedirectType = 302
+	}
+	if mapping.CreatedAt.IsZero() {
+		mapping.CreatedAt = time.Now()
+	}
+	if mapping.StatsVisibility == "" {
+		mapping.StatsVisibility = shortner.StatsPrivate
+	}
+	// New links are stored unconsumed, as in SQLite.
+	mapping.ConsumedAt = nil
+	id, err := r.nextID()
+	if err != nil {
+		return 0, err
+	}
+	mapping.ID = id
+	value, err := encodeKVLink(mapping)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.store.Insert(r.key(mapping.ShortCode), value); err != nil {
+		return 0, fmt.Errorf("creating '%s': %w", mapping.ShortCode, err)
+	}
+	return id, nil
+}
+
+func (r *KeyValueShortenerRepo) FindByShortCode(shortCode string) (string, error) {
+	mapping, err := r.GetMapping(shortCode)
+	if err != nil {
+		return "", err
+	}
+	return mapping.LongURL, nil
+}
+
+func (r *KeyValueShortenerRepo) GetMapping(shortCode string) (*shortner.URLMapping, error) {
+	value, err := r.store.Get(r.key(shortCode))
+	if err != nil {
+		return nil, err
+	}
+	return decodeKVLink(value)
+}
+
+func (r *KeyValueShortenerRepo) UpdateLongURL(shortCode, newLongURL string) error {
+	return r.change(shortCode, func(mapping *shortner.URLMapping) error {
+		mapping.LongURL = newLongURL
+		return nil
+	})
+}
+
+// UpdateMapping overwrites the mutable fields of an existing mapping, those
+// SQLiteShortenerRepo updates: the code, ID, kind, creation time and
+// wildcard flag are kept.
+func (r *KeyValueShortenerRepo) UpdateMapping(mapping shortner.URLMapping) error {
+	return r.change(mapping.ShortCode, func(stored *shortner.URLMapping) error {
+		updated := mapping
+		updated.ID, updated.ShortCode, updated.Kind = stored.ID, stored.ShortCode, stored.Kind
+		updated.CreatedAt, updated.Wildcard = stored.CreatedAt, stored.Wildcard
+		*stored = updated
+		return nil
+	})
+}
+
+// ConsumeMapping swaps in the consumed link, so that of concurrent calls
+// only the first finds it unconsumed.
+func (r *KeyValueShortenerRepo) ConsumeMapping(shortCode string, now time.Time) error {
+	return r.change(shortCode, func(mapping *shortner.URLMapping) error {
+		if !mapping.SingleUse || mapping.ConsumedAt != nil {
+			return ErrNotFound
+		}
+		consumedAt := now.UTC()
+		mapping.ConsumedAt = &consumedAt
+		return nil
+	})
+}
+
+func (r *KeyValueShortenerRepo) DeleteMapping(shortCode string) error {
+	return r.store.Delete(r.key(shortCode))
+}
+
+// change applies fn to the stored link and swaps the result in, reading the
+// link again when it was changed in between.
+func (r *KeyValueShortenerRepo) change(shortCode string, fn func(mapping *shortner.URLMapping) error) error {
+	key := r.key(shortCode)
+	for i := 0; i < kvSwapRetries; i++ {
+		old, err := r.store.Get(key)
+		if err != nil {
+			return err
+		}
+		mapping, err := decodeKVLink(old)
+		if err != nil {
+			return err
+		}
+		if err := fn(mapping); err != nil {
+			return err
+		}
+		value, err := encodeKVLink(*mapping)
+		if err != nil {
+			return err
+		}
+		err = r.store.Swap(key, old, value)
+		if !errors.Is(err, ErrValueChanged) {
+			return err
+		}
+	}
+	return fmt.Errorf("link '%s' changed too often to update", shortCode)
+}
+
+func encodeKVLink(mapping shortner.URLMapping) ([]byte, error) {
+	if mapping.ExpiresAt != nil {
+		mapping.ExpiresAt = utcTime(mapping.ExpiresAt)
+	}
+	return json.Marshal(kvLink{URLMapping: mapping, StatsToken: mapping.StatsToken})
+}
+
+func decodeKVLink(value []byte) (*shortner.URLMapping, error) {
+	var link kvLink
+	if err := json.Unmarshal(value, &link); err != nil {
+		return nil, fmt.Errorf("decoding stored link: %w", err)
+	}
+	link.URLMapping.StatsToken = link.StatsToken
+	return &link.URLMapping, nil
+}
+
+// MemoryKeyValueStore is a KeyValueStore in memory, for tests and for
+// programs that embed the shortener and keep links elsewhere. It is safe
+// for concurrent use.
+type MemoryKeyValueStore struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func NewMemoryKeyValueStore() *MemoryKeyValueStore {
+	return &MemoryKeyValueStore{values: make(map[string][]byte)}
+}
+
+func (s *MemoryKeyValueStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return bytes.Clone(value), nil
+}
+
+func (s *MemoryKeyValueStore) Insert(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; ok {
+		return ErrKeyExists
+	}
+	s.values[key] = bytes.Clone(value)
+	return nil
+}
+
+func (s *MemoryKeyValueStore) Swap(key string, old, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.values[key]
+	if !ok {
+		return ErrNotFound
+	}
+	if !bytes.Equal(current, old) {
+		return ErrValueChanged
+	}
+	s.values[key] = bytes.Clone(value)
+	return nil
+}
+
+func (s *MemoryKeyValueStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.values, key)
+	return nil
+}
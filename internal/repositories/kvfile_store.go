@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"errors"
+
+	"template/internal/pkg/kvfile"
+)
+
+// FileKeyValueStore is a KeyValueStore in a single file, written in pure
+// Go: links kept in it need neither SQLite nor cgo, so a program storing
+// nothing else builds as a static binary. Every key is held in memory.
+type FileKeyValueStore struct {
+	db *kvfile.DB
+}
+
+// OpenFileKeyValueStore opens the store at path, creating it if needed.
+// Only one process may open it at a time.
+func OpenFileKeyValueStore(path string) (*FileKeyValueStore, error) {
+	db, err := kvfile.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileKeyValueStore{db: db}, nil
+}
+
+func (s *FileKeyValueStore) Get(key string) ([]byte, error) {
+	value, err := s.db.Get(key)
+	return value, kvfileError(err)
+}
+
+func (s *FileKeyValueStore) Insert(key string, value []byte) error {
+	return kvfileError(s.db.Insert(key, value))
+}
+
+func (s *FileKeyValueStore) Swap(key string, old, value []byte) error {
+	return kvfileError(s.db.Swap(key, old, value))
+}
+
+func (s *FileKeyValueStore) Delete(key string) error {
+	return kvfileError(s.db.Delete(key))
+}
+
+func (s *FileKeyValueStore) Close() error {
+	return s.db.Close()
+}
+
+// kvfileError translates the errors of kvfile into those of KeyValueStore.
+func kvfileError(err error) error {
+	switch {
+	case errors.Is(err, kvfile.ErrNotFound):
+		return ErrNotFound
+	case errors.Is(err, kvfile.ErrExists):
+		return ErrKeyExists
+	case errors.Is(err, kvfile.ErrChanged):
+		return ErrValueChanged
+	}
+	return err
+}
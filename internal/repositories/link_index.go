@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// LongURLIndex is implemented by link repositories that can find a link by
+// its destination, which needs an index besides the one on short codes.
+// Without it, shortening a destination twice creates two links.
+type LongURLIndex interface {
+	// FindByLongURL returns the code of a link to longURL, or an empty
+	// code or ErrNotFound when there is none.
+	FindByLongURL(longURL string) (string, error)
+}
+
+// LinkLister is implemented by link repositories that can list links in ID
+// order and by expiry. Without it, the links API cannot list, bulk changes
+// by destination prefix and the duplicate and domain scans do not run, and
+// expired links are not reaped.
+type LinkLister interface {
+	// ListSince returns mappings with an ID greater than afterID in
+	// ascending ID order, which gives pollers a stable cursor.
+	ListSince(afterID int64, limit int) ([]shortner.URLMapping, error)
+	// ListExpired returns mappings that expired before the given time,
+	// oldest expiry first.
+	ListExpired(before time.Time, limit int) ([]shortner.URLMapping, error)
+}
+
+// ErrIndexUnsupported is returned by FindByLongURL when the repository
+// keeps no index of destinations.
+var ErrIndexUnsupported = errors.New("finding links by destination is not supported by this repository")
+
+// ErrListUnsupported is returned by ListSince and ListExpired when the
+// repository cannot list links.
+var ErrListUnsupported = errors.New("listing links is not supported by this repository")
+
+// findByLongURL calls FindByLongURL on repo, or reports ErrIndexUnsupported
+// when repo is not a LongURLIndex; the wrappers forward through it.
+func findByLongURL(repo ShortenerRepository, longURL string) (string, error) {
+	index, ok := repo.(LongURLIndex)
+	if !ok {
+		return "", ErrIndexUnsupported
+	}
+	return index.FindByLongURL(longURL)
+}
+
+// listSince calls ListSince on repo, or reports ErrListUnsupported when repo
+// is not a LinkLister; the wrappers forward through it.
+func listSince(repo ShortenerRepository, afterID int64, limit int) ([]shortner.URLMapping, error) {
+	lister, ok := repo.(LinkLister)
+	if !ok {
+		return nil, ErrListUnsupported
+	}
+	return lister.ListSince(afterID, limit)
+}
+
+// listExpired is listSince for ListExpired.
+func listExpired(repo ShortenerRepository, before time.Time, limit int) ([]shortner.URLMapping, error) {
+	lister, ok := repo.(LinkLister)
+	if !ok {
+		return nil, ErrListUnsupported
+	}
+	return lister.ListExpired(before, limit)
+}
+
+// ListLinks returns the LinkLister of repo, for tools that walk every link,
+// or ErrListUnsupported.
+func ListLinks(repo ShortenerRepository) (LinkLister, error) {
+	lister, ok := repo.(LinkLister)
+	if !ok {
+		return nil, ErrListUnsupported
+	}
+	return lister, nil
+}
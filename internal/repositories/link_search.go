@@ -0,0 +1,152 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+
+	"template/internal/usecases/shortner"
+)
+
+// LinkSearcher is implemented by link repositories that can search links by
+// destination and title. Every word of query must match, as a prefix of a
+// word of the destination or title; results are best match first.
+// Destinations encrypted at rest are not searchable, only titles.
+type LinkSearcher interface {
+	Search(ctx context.Context, query string, page shortner.SearchPage) ([]shortner.URLMapping, error)
+}
+
+// ErrSearchUnsupported is returned by Search when the repository cannot
+// search links, such as a sharded repository whose shards rank their
+// results separately.
+var ErrSearchUnsupported = errors.New("link search is not supported by this repository")
+
+// searchLinks calls Search on repo, or reports ErrSearchUnsupported when
+// repo is not a LinkSearcher; the wrappers forward through it.
+func searchLinks(ctx context.Context, repo ShortenerRepository, query string, page shortner.SearchPage) ([]shortner.URLMapping, error) {
+	searcher, ok := repo.(LinkSearcher)
+	if !ok {
+		return nil, ErrSearchUnsupported
+	}
+	return searcher.Search(ctx, query, page)
+}
+
+// searchIndexTriggers keep urls_search, an FTS5 index of destinations and
+// titles keyed by urls.id, in step with urls. Encrypted destinations (those
+// with a blind index) are indexed as empty so the index holds no plaintext.
+var searchIndexTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS urls_search_insert AFTER INSERT ON urls BEGIN
+		INSERT INTO urls_search(rowid, long_url, title) VALUES (new.id, CASE WHEN new.long_url_hash = '' THEN new.long_url ELSE '' END, new.title);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS urls_search_update AFTER UPDATE OF long_url, long_url_hash, title ON urls BEGIN
+		DELETE FROM urls_search WHERE rowid = old.id;
+		INSERT INTO urls_search(rowid, long_url, title) VALUES (new.id, CASE WHEN new.long_url_hash = '' THEN new.long_url ELSE '' END, new.title);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS urls_search_delete AFTER DELETE ON urls BEGIN
+		DELETE FROM urls_search WHERE rowid = old.id;
+	END`,
+}
+
+// ensureSearchIndex creates the full-text index when SQLite was built with
+// FTS5 (the sqlite_fts5 build tag) and rebuilds it when its triggers are
+// missing, as on first start or after running a build without FTS5. Without
+// FTS5 it drops the triggers, which would otherwise fail every write, and
+// Search falls back to LIKE matching.
+func (r *SQLiteShortenerRepo) ensureSearchIndex() error {
+	_, err := r.db.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS urls_search USING fts5(long_url, title, tokenize = 'unicode61 remove_diacritics 2')")
+	if err != nil {
+		if !strings.Contains(err.Error(), "no such module: fts5") {
+			return err
+		}
+		log.Println("SQLite was built without FTS5, link search falls back to LIKE matching.")
+		for _, name := range []string{"urls_search_insert", "urls_search_update", "urls_search_delete"} {
+			if _, err := r.db.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+				return err
+			}
+		}
+		r.fullText = false
+		return nil
+	}
+	r.fullText = true
+
+	var triggers int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'urls_search_%'").Scan(&triggers); err != nil {
+		return err
+	}
+	if triggers == len(searchIndexTriggers) {
+		return nil
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	statements := append([]string{
+		"DELETE FROM urls_search",
+		"INSERT INTO urls_search(rowid, long_url, title) SELECT id, CASE WHEN long_url_hash = '' THEN long_url ELSE '' END, title FROM urls",
+	}, searchIndexTriggers...)
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	log.Println("Link search index built.")
+	return tx.Commit()
+}
+
+// Search ranks matches with FTS5 when it is available and otherwise
+// returns the newest matches first.
+func (r *SQLiteShortenerRepo) Search(ctx context.Context, query string, page shortner.SearchPage) ([]shortner.URLMapping, error) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	var rows *sql.Rows
+	var err error
+	if r.fullText {
+		rows, err = r.db.QueryContext(ctx, "SELECT "+mappingColumns+" FROM urls JOIN (SELECT rowid AS hit, rank FROM urls_search WHERE urls_search MATCH ?) ON hit = urls.id ORDER BY rank, id DESC LIMIT ? OFFSET ?",
+			fullTextQuery(terms), page.Limit, page.Offset)
+	} else {
+		conditions := make([]string, 0, len(terms))
+		args := make([]any, 0, 2*len(terms)+2)
+		for _, term := range terms {
+			conditions = append(conditions, `(title LIKE ? ESCAPE '\' OR (long_url_hash = '' AND long_url LIKE ? ESCAPE '\'))`)
+			pattern := "%" + escapeLike(term) + "%"
+			args = append(args, pattern, pattern)
+		}
+		args = append(args, page.Limit, page.Offset)
+		rows, err = r.db.QueryContext(ctx, "SELECT "+mappingColumns+" FROM urls WHERE "+strings.Join(conditions, " AND ")+" ORDER BY id DESC LIMIT ? OFFSET ?", args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mappings []shortner.URLMapping
+	for rows.Next() {
+		m, err := r.scanMapping(rows)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, *m)
+	}
+	return mappings, rows.Err()
+}
+
+// fullTextQuery turns each term into a quoted FTS5 prefix phrase, so
+// operators and punctuation in what the user typed are matched literally.
+// "example.com/do" becomes the phrase "example com do*".
+func fullTextQuery(terms []string) string {
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	return strings.Join(phrases, " ")
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// MaintenanceRepository covers operations on the database as a whole.
+type MaintenanceRepository interface {
+	Ping() error
+	// Backup writes a consistent copy of the database to path, which must
+	// not exist yet.
+	Backup(path string) error
+}
+
+type SQLiteMaintenanceRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteMaintenanceRepo(db *sql.DB) *SQLiteMaintenanceRepo {
+	return &SQLiteMaintenanceRepo{db: db}
+}
+
+func (r *SQLiteMaintenanceRepo) Ping() error {
+	return r.db.Ping()
+}
+
+// Backup uses VACUUM INTO, which copies a snapshot of the live database
+// without blocking writers for longer than a read transaction.
+func (r *SQLiteMaintenanceRepo) Backup(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup file %s already exists", path)
+	}
+	_, err := r.db.Exec("VACUUM INTO ?", path)
+	return err
+}
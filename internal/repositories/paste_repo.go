@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"template/internal/usecases/shortner"
+)
+
+type PasteRepository interface {
+	InitSchema() error
+	SavePaste(paste shortner.Paste) error
+	GetPaste(shortCode string) (*shortner.Paste, error)
+	DeletePaste(shortCode string) error
+}
+
+type SQLitePasteRepo struct {
+	fieldCipher
+	db *sql.DB
+}
+
+func NewSQLitePasteRepo(db *sql.DB) *SQLitePasteRepo {
+	return &SQLitePasteRepo{db: db}
+}
+
+func (r *SQLitePasteRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS pastes (
+		short_code TEXT PRIMARY KEY,
+		format TEXT NOT NULL DEFAULT 'text',
+		content TEXT NOT NULL
+	);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing pastes schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLitePasteRepo) SavePaste(paste shortner.Paste) error {
+	content, err := r.seal(paste.Content)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec("INSERT INTO pastes(short_code, format, content) VALUES(?, ?, ?)", paste.ShortCode, paste.Format, content)
+	return err
+}
+
+func (r *SQLitePasteRepo) GetPaste(shortCode string) (*shortner.Paste, error) {
+	var p shortner.Paste
+	err := r.db.QueryRow("SELECT short_code, format, content FROM pastes WHERE short_code = ?", shortCode).Scan(&p.ShortCode, &p.Format, &p.Content)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if p.Content, err = r.open(p.Content); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *SQLitePasteRepo) DeletePaste(shortCode string) error {
+	res, err := r.db.Exec("DELETE FROM pastes WHERE short_code = ?", shortCode)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+// Reencrypt rewrites every note not yet encrypted under the primary key.
+func (r *SQLitePasteRepo) Reencrypt(batch int) (int, error) {
+	if r.cipher == nil {
+		return 0, errors.New("encryption is not enabled")
+	}
+	return reencryptColumns(r.db, r.cipher, "pastes", "short_code", []string{"content"}, batch, func(key any, _, sealed []string) error {
+		_, err := r.db.Exec("UPDATE pastes SET content = ? WHERE short_code = ?", sealed[0], key)
+		return err
+	})
+}
@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+type PixelRepository interface {
+	InitSchema() error
+	CreatePixel(pixel shortner.Pixel) (int64, error)
+	ListPixels() ([]shortner.Pixel, error)
+	GetPixels(ids []int64) ([]shortner.Pixel, error)
+	DeletePixel(id int64) error
+}
+
+type SQLitePixelRepo struct {
+	db *sql.DB
+}
+
+func NewSQLitePixelRepo(db *sql.DB) *SQLitePixelRepo {
+	return &SQLitePixelRepo{db: db}
+}
+
+func (r *SQLitePixelRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS pixels (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		provider TEXT NOT NULL,
+		tag_id TEXT NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing pixels schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLitePixelRepo) CreatePixel(pixel shortner.Pixel) (int64, error) {
+	if pixel.CreatedAt.IsZero() {
+		pixel.CreatedAt = time.Now()
+	}
+	res, err := r.db.Exec("INSERT INTO pixels(provider, tag_id, name, created_at) VALUES(?, ?, ?, ?)",
+		pixel.Provider, pixel.TagID, pixel.Name, pixel.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *SQLitePixelRepo) ListPixels() ([]shortner.Pixel, error) {
+	return r.queryPixels("SELECT id, provider, tag_id, name, created_at FROM pixels ORDER BY id ASC")
+}
+
+// GetPixels returns the pixels with the given ids that exist, in id order.
+func (r *SQLitePixelRepo) GetPixels(ids []int64) ([]shortner.Pixel, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	return r.queryPixels("SELECT id, provider, tag_id, name, created_at FROM pixels WHERE id IN ("+placeholders+") ORDER BY id ASC", args...)
+}
+
+func (r *SQLitePixelRepo) DeletePixel(id int64) error {
+	res, err := r.db.Exec("DELETE FROM pixels WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *SQLitePixelRepo) queryPixels(query string, args ...interface{}) ([]shortner.Pixel, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pixels []shortner.Pixel
+	for rows.Next() {
+		var p shortner.Pixel
+		if err := rows.Scan(&p.ID, &p.Provider, &p.TagID, &p.Name, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		pixels = append(pixels, p)
+	}
+	return pixels, rows.Err()
+}
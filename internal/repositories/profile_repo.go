@@ -0,0 +1,200 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// ProfileRepository stores the link-in-bio profiles and their items.
+// Usernames are stored as given; callers normalize them.
+type ProfileRepository interface {
+	InitSchema() error
+	// ListProfiles lists the profiles in username order.
+	ListProfiles() ([]shortner.Profile, error)
+	GetProfile(username string) (*shortner.Profile, error)
+	// SaveProfile creates profile, or updates the display name and bio of
+	// the profile with its username.
+	SaveProfile(profile shortner.Profile) error
+	// DeleteProfile deletes the profile and its items.
+	DeleteProfile(username string) error
+	AddItem(item shortner.ProfileItem) (int64, error)
+	GetItem(username string, id int64) (*shortner.ProfileItem, error)
+	// ListItems lists the items of a profile in position order.
+	ListItems(username string) ([]shortner.ProfileItem, error)
+	UpdateItem(item shortner.ProfileItem) error
+	DeleteItem(username string, id int64) error
+	// CountClick adds one to the clicks of the item.
+	CountClick(username string, id int64) error
+}
+
+type SQLiteProfileRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteProfileRepo(db *sql.DB) *SQLiteProfileRepo {
+	return &SQLiteProfileRepo{db: db}
+}
+
+func (r *SQLiteProfileRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS profiles (
+		username TEXT PRIMARY KEY,
+		display_name TEXT NOT NULL DEFAULT '',
+		bio TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS profile_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL,
+		short_code TEXT NOT NULL,
+		title TEXT NOT NULL DEFAULT '',
+		position INTEGER NOT NULL DEFAULT 0,
+		clicks INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_profile_items_username ON profile_items(username);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing profiles schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLiteProfileRepo) ListProfiles() ([]shortner.Profile, error) {
+	rows, err := r.db.Query("SELECT username, display_name, bio, created_at, updated_at FROM profiles ORDER BY username ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []shortner.Profile
+	for rows.Next() {
+		var p shortner.Profile
+		if err := rows.Scan(&p.Username, &p.DisplayName, &p.Bio, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+func (r *SQLiteProfileRepo) GetProfile(username string) (*shortner.Profile, error) {
+	var p shortner.Profile
+	err := r.db.QueryRow("SELECT username, display_name, bio, created_at, updated_at FROM profiles WHERE username = ?", username).
+		Scan(&p.Username, &p.DisplayName, &p.Bio, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *SQLiteProfileRepo) SaveProfile(profile shortner.Profile) error {
+	if profile.CreatedAt.IsZero() {
+		profile.CreatedAt = time.Now()
+	}
+	if profile.UpdatedAt.IsZero() {
+		profile.UpdatedAt = profile.CreatedAt
+	}
+	_, err := r.db.Exec(`INSERT INTO profiles(username, display_name, bio, created_at, updated_at) VALUES(?, ?, ?, ?, ?)
+		ON CONFLICT(username) DO UPDATE SET display_name = excluded.display_name, bio = excluded.bio, updated_at = excluded.updated_at`,
+		profile.Username, profile.DisplayName, profile.Bio, profile.CreatedAt.UTC(), profile.UpdatedAt.UTC())
+	return err
+}
+
+func (r *SQLiteProfileRepo) DeleteProfile(username string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM profiles WHERE username = ?", username)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(res); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM profile_items WHERE username = ?", username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteProfileRepo) AddItem(item shortner.ProfileItem) (int64, error) {
+	if item.CreatedAt.IsZero() {
+		item.CreatedAt = time.Now()
+	}
+	res, err := r.db.Exec("INSERT INTO profile_items(username, short_code, title, position, created_at) VALUES(?, ?, ?, ?, ?)",
+		item.Username, item.ShortCode, item.Title, item.Position, item.CreatedAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *SQLiteProfileRepo) GetItem(username string, id int64) (*shortner.ProfileItem, error) {
+	var item shortner.ProfileItem
+	err := r.db.QueryRow("SELECT id, username, short_code, title, position, clicks, created_at FROM profile_items WHERE username = ? AND id = ?", username, id).
+		Scan(&item.ID, &item.Username, &item.ShortCode, &item.Title, &item.Position, &item.Clicks, &item.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *SQLiteProfileRepo) ListItems(username string) ([]shortner.ProfileItem, error) {
+	rows, err := r.db.Query("SELECT id, username, short_code, title, position, clicks, created_at FROM profile_items WHERE username = ? ORDER BY position ASC, id ASC", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []shortner.ProfileItem
+	for rows.Next() {
+		var item shortner.ProfileItem
+		if err := rows.Scan(&item.ID, &item.Username, &item.ShortCode, &item.Title, &item.Position, &item.Clicks, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *SQLiteProfileRepo) UpdateItem(item shortner.ProfileItem) error {
+	res, err := r.db.Exec("UPDATE profile_items SET short_code = ?, title = ?, position = ? WHERE username = ? AND id = ?",
+		item.ShortCode, item.Title, item.Position, item.Username, item.ID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *SQLiteProfileRepo) DeleteItem(username string, id int64) error {
+	res, err := r.db.Exec("DELETE FROM profile_items WHERE username = ? AND id = ?", username, id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *SQLiteProfileRepo) CountClick(username string, id int64) error {
+	res, err := r.db.Exec("UPDATE profile_items SET clicks = clicks + 1 WHERE username = ? AND id = ?", username, id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
@@ -0,0 +1,198 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// RedirectBlockRepository stores the redirect blocks set through the admin
+// API. There is at most one block per kind and value, and per name.
+type RedirectBlockRepository interface {
+	InitSchema() error
+	ListBlocks() ([]shortner.RedirectBlock, error)
+	// AddBlock stores block, or updates the reason of the block with the
+	// same kind and value, and returns the stored block.
+	AddBlock(block shortner.RedirectBlock) (*shortner.RedirectBlock, error)
+	DeleteBlock(id int64) error
+	GetBlockByName(name string) (*shortner.RedirectBlock, error)
+	// PutBlock stores block under block.Name, replacing the kind, value and
+	// reason of the block with that name. An unnamed block with the same
+	// kind and value is given the name; ErrBlockTaken is returned when
+	// another name holds it. created reports whether no block had the name.
+	PutBlock(block shortner.RedirectBlock) (stored *shortner.RedirectBlock, created bool, err error)
+	DeleteBlockByName(name string) error
+}
+
+// ErrBlockTaken is returned by PutBlock for a kind and value already
+// blocked under another name.
+var ErrBlockTaken = errors.New("block exists under another name")
+
+const redirectBlockColumns = "id, COALESCE(name, ''), kind, value, reason, created_at"
+
+type SQLiteRedirectBlockRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteRedirectBlockRepo(db *sql.DB) *SQLiteRedirectBlockRepo {
+	return &SQLiteRedirectBlockRepo{db: db}
+}
+
+func (r *SQLiteRedirectBlockRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS redirect_blocks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		value TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		UNIQUE(kind, value)
+	);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing redirect blocks schema: %v", err)
+		return err
+	}
+	if err := ensureColumn(r.db, "redirect_blocks", "name", "TEXT NULL"); err != nil {
+		return err
+	}
+	_, err = r.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_redirect_blocks_name ON redirect_blocks(name) WHERE name IS NOT NULL")
+	return err
+}
+
+func scanRedirectBlock(row rowScanner) (*shortner.RedirectBlock, error) {
+	var b shortner.RedirectBlock
+	if err := row.Scan(&b.ID, &b.Name, &b.Kind, &b.Value, &b.Reason, &b.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *SQLiteRedirectBlockRepo) ListBlocks() ([]shortner.RedirectBlock, error) {
+	rows, err := r.db.Query("SELECT " + redirectBlockColumns + " FROM redirect_blocks ORDER BY id ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []shortner.RedirectBlock
+	for rows.Next() {
+		b, err := scanRedirectBlock(rows)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, *b)
+	}
+	return blocks, rows.Err()
+}
+
+func (r *SQLiteRedirectBlockRepo) AddBlock(block shortner.RedirectBlock) (*shortner.RedirectBlock, error) {
+	if block.CreatedAt.IsZero() {
+		block.CreatedAt = time.Now()
+	}
+	_, err := r.db.Exec(`INSERT INTO redirect_blocks(kind, value, reason, created_at) VALUES(?, ?, ?, ?)
+		ON CONFLICT(kind, value) DO UPDATE SET reason = excluded.reason`,
+		block.Kind, block.Value, block.Reason, block.CreatedAt.UTC())
+	if err != nil {
+		return nil, err
+	}
+	return scanRedirectBlock(r.db.QueryRow("SELECT "+redirectBlockColumns+" FROM redirect_blocks WHERE kind = ? AND value = ?", block.Kind, block.Value))
+}
+
+func (r *SQLiteRedirectBlockRepo) DeleteBlock(id int64) error {
+	res, err := r.db.Exec("DELETE FROM redirect_blocks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteRedirectBlockRepo) GetBlockByName(name string) (*shortner.RedirectBlock, error) {
+	return scanRedirectBlock(r.db.QueryRow("SELECT "+redirectBlockColumns+" FROM redirect_blocks WHERE name = ?", name))
+}
+
+func (r *SQLiteRedirectBlockRepo) PutBlock(block shortner.RedirectBlock) (*shortner.RedirectBlock, bool, error) {
+	if block.CreatedAt.IsZero() {
+		block.CreatedAt = time.Now()
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	var holder sql.NullString
+	var holderID int64
+	err = tx.QueryRow("SELECT id, name FROM redirect_blocks WHERE kind = ? AND value = ?", block.Kind, block.Value).Scan(&holderID, &holder)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		holderID = 0
+	case err != nil:
+		return nil, false, err
+	case holder.Valid && holder.String != block.Name:
+		return nil, false, ErrBlockTaken
+	}
+
+	var existingID int64
+	err = tx.QueryRow("SELECT id FROM redirect_blocks WHERE name = ?", block.Name).Scan(&existingID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+	created := existingID == 0 && holderID == 0
+
+	switch {
+	case existingID != 0 && holderID != 0 && holderID != existingID:
+		// The kind and value moved to an unnamed block: it takes the name.
+		if _, err := tx.Exec("DELETE FROM redirect_blocks WHERE id = ?", existingID); err != nil {
+			return nil, false, err
+		}
+		_, err = tx.Exec("UPDATE redirect_blocks SET name = ?, reason = ? WHERE id = ?", block.Name, block.Reason, holderID)
+	case existingID != 0:
+		_, err = tx.Exec("UPDATE redirect_blocks SET kind = ?, value = ?, reason = ? WHERE id = ?", block.Kind, block.Value, block.Reason, existingID)
+	case holderID != 0:
+		_, err = tx.Exec("UPDATE redirect_blocks SET name = ?, reason = ? WHERE id = ?", block.Name, block.Reason, holderID)
+	default:
+		_, err = tx.Exec("INSERT INTO redirect_blocks(name, kind, value, reason, created_at) VALUES(?, ?, ?, ?, ?)",
+			block.Name, block.Kind, block.Value, block.Reason, block.CreatedAt.UTC())
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	stored, err := scanRedirectBlock(tx.QueryRow("SELECT "+redirectBlockColumns+" FROM redirect_blocks WHERE name = ?", block.Name))
+	if err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return stored, created, nil
+}
+
+func (r *SQLiteRedirectBlockRepo) DeleteBlockByName(name string) error {
+	res, err := r.db.Exec("DELETE FROM redirect_blocks WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
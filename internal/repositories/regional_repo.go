@@ -0,0 +1,175 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// Region is one region of a multi-region deployment: the codes created
+// there start with Prefix, and its instances answer at BaseURL.
+type Region struct {
+	Name    string
+	Prefix  string
+	BaseURL string
+}
+
+// WrongRegionError is returned for a change to a link that belongs to
+// another region; it has to be made in Region.
+type WrongRegionError struct {
+	ShortCode string
+	Region    Region
+}
+
+func (e *WrongRegionError) Error() string {
+	return fmt.Sprintf("link '%s' belongs to region %s", e.ShortCode, e.Region.Name)
+}
+
+// RegionalShortenerRepo keeps an instance from changing links of other
+// regions. Every link belongs to the region whose prefix its code starts
+// with, or to the first region when none matches (links created before the
+// deployment had regions); writes to links of other regions fail with
+// WrongRegionError before reaching the database. Since each link is only
+// ever written in one region, the regional databases never hold conflicting
+// changes to merge, whatever order replication applies them in.
+//
+// Lookups and listings pass through, so every region serves all links from
+// its replica. ListExpired leaves out other regions' links, which their own
+// region reaps.
+type RegionalShortenerRepo struct {
+	next            ShortenerRepository
+	home            Region
+	regions         []Region
+	caseInsensitive bool
+}
+
+// NewRegionalShortenerRepo wraps next for the instances of home, one of
+// regions. No prefix may be the start of another.
+func NewRegionalShortenerRepo(next ShortenerRepository, home Region, regions []Region, caseInsensitive bool) *RegionalShortenerRepo {
+	return &RegionalShortenerRepo{next: next, home: home, regions: regions, caseInsensitive: caseInsensitive}
+}
+
+// Owner returns the region shortCode belongs to.
+func (r *RegionalShortenerRepo) Owner(shortCode string) Region {
+	for _, region := range r.regions {
+		if len(shortCode) < len(region.Prefix) {
+			continue
+		}
+		start := shortCode[:len(region.Prefix)]
+		if start == region.Prefix || (r.caseInsensitive && strings.EqualFold(start, region.Prefix)) {
+			return region
+		}
+	}
+	if len(r.regions) == 0 {
+		return r.home
+	}
+	return r.regions[0]
+}
+
+func (r *RegionalShortenerRepo) check(shortCode string) error {
+	if owner := r.Owner(shortCode); owner.Name != r.home.Name {
+		return &WrongRegionError{ShortCode: shortCode, Region: owner}
+	}
+	return nil
+}
+
+func (r *RegionalShortenerRepo) InitSchema() error {
+	return r.next.InitSchema()
+}
+
+func (r *RegionalShortenerRepo) SaveMapping(shortCode, longURL string) (int64, error) {
+	if err := r.check(shortCode); err != nil {
+		return 0, err
+	}
+	return r.next.SaveMapping(shortCode, longURL)
+}
+
+func (r *RegionalShortenerRepo) CreateMapping(mapping shortner.URLMapping) (int64, error) {
+	if err := r.check(mapping.ShortCode); err != nil {
+		return 0, err
+	}
+	return r.next.CreateMapping(mapping)
+}
+
+func (r *RegionalShortenerRepo) FindByShortCode(shortCode string) (string, error) {
+	return r.next.FindByShortCode(shortCode)
+}
+
+func (r *RegionalShortenerRepo) GetMapping(shortCode string) (*shortner.URLMapping, error) {
+	return r.next.GetMapping(shortCode)
+}
+
+func (r *RegionalShortenerRepo) FindByLongURL(longURL string) (string, error) {
+	return findByLongURL(r.next, longURL)
+}
+
+func (r *RegionalShortenerRepo) UpdateLongURL(shortCode, newLongURL string) error {
+	if err := r.check(shortCode); err != nil {
+		return err
+	}
+	return r.next.UpdateLongURL(shortCode, newLongURL)
+}
+
+func (r *RegionalShortenerRepo) UpdateMapping(mapping shortner.URLMapping) error {
+	if err := r.check(mapping.ShortCode); err != nil {
+		return err
+	}
+	return r.next.UpdateMapping(mapping)
+}
+
+// ConsumeMapping is a write too: a single-use link is opened in its region,
+// so that two regions cannot both open it.
+func (r *RegionalShortenerRepo) ConsumeMapping(shortCode string, now time.Time) error {
+	if err := r.check(shortCode); err != nil {
+		return err
+	}
+	return r.next.ConsumeMapping(shortCode, now)
+}
+
+func (r *RegionalShortenerRepo) DeleteMapping(shortCode string) error {
+	if err := r.check(shortCode); err != nil {
+		return err
+	}
+	return r.next.DeleteMapping(shortCode)
+}
+
+// ApplyBulk refuses the whole batch when one of its links belongs to
+// another region.
+func (r *RegionalShortenerRepo) ApplyBulk(updates []shortner.URLMapping, deletes []string) error {
+	for _, mapping := range updates {
+		if err := r.check(mapping.ShortCode); err != nil {
+			return err
+		}
+	}
+	for _, shortCode := range deletes {
+		if err := r.check(shortCode); err != nil {
+			return err
+		}
+	}
+	return applyBulk(r.next, updates, deletes)
+}
+
+func (r *RegionalShortenerRepo) Search(ctx context.Context, query string, page shortner.SearchPage) ([]shortner.URLMapping, error) {
+	return searchLinks(ctx, r.next, query, page)
+}
+
+func (r *RegionalShortenerRepo) ListSince(afterID int64, limit int) ([]shortner.URLMapping, error) {
+	return listSince(r.next, afterID, limit)
+}
+
+func (r *RegionalShortenerRepo) ListExpired(before time.Time, limit int) ([]shortner.URLMapping, error) {
+	mappings, err := listExpired(r.next, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	own := mappings[:0]
+	for _, mapping := range mappings {
+		if r.check(mapping.ShortCode) == nil {
+			own = append(own, mapping)
+		}
+	}
+	return own, nil
+}
@@ -0,0 +1,173 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// ReplicatedShortenerRepo sends writes to the primary and lookups and
+// listings to a read replica. Replication lags, so a code written less than
+// staleness ago is read from the primary: a link resolves right after it is
+// created or changed. A lookup that fails on the replica, including a miss,
+// is retried on the primary for the same reason.
+type ReplicatedShortenerRepo struct {
+	primary   ShortenerRepository
+	replica   ShortenerRepository
+	staleness time.Duration
+
+	mu        sync.Mutex
+	written   map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewReplicatedShortenerRepo(primary, replica ShortenerRepository, staleness time.Duration) *ReplicatedShortenerRepo {
+	return &ReplicatedShortenerRepo{
+		primary:   primary,
+		replica:   replica,
+		staleness: staleness,
+		written:   make(map[string]time.Time),
+	}
+}
+
+// wrote remembers that shortCode was changed on the primary at now.
+// Entries older than staleness are swept at most once per staleness.
+func (r *ReplicatedShortenerRepo) wrote(shortCode string) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.Sub(r.lastSweep) >= r.staleness {
+		for code, at := range r.written {
+			if now.Sub(at) >= r.staleness {
+				delete(r.written, code)
+			}
+		}
+		r.lastSweep = now
+	}
+	r.written[writtenKey(shortCode)] = now
+}
+
+// fresh reports whether shortCode was changed too recently for the
+// replica to be trusted with it.
+func (r *ReplicatedShortenerRepo) fresh(shortCode string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	at, ok := r.written[writtenKey(shortCode)]
+	return ok && time.Since(at) < r.staleness
+}
+
+// writtenKey ignores case so that a case-insensitive lookup of a fresh code
+// goes to the primary too; a case-sensitive one merely may do so needlessly.
+func writtenKey(shortCode string) string {
+	return strings.ToLower(shortCode)
+}
+
+func (r *ReplicatedShortenerRepo) replicaFailed(method string, err error) {
+	if !errors.Is(err, ErrNotFound) {
+		log.Printf("Replica error in %s, retrying on primary: %v", method, err)
+	}
+}
+
+// InitSchema migrates the primary only; the replica receives the schema
+// through replication.
+func (r *ReplicatedShortenerRepo) InitSchema() error {
+	return r.primary.InitSchema()
+}
+
+func (r *ReplicatedShortenerRepo) SaveMapping(shortCode, longURL string) (int64, error) {
+	r.wrote(shortCode)
+	return r.primary.SaveMapping(shortCode, longURL)
+}
+
+func (r *ReplicatedShortenerRepo) CreateMapping(mapping shortner.URLMapping) (int64, error) {
+	r.wrote(mapping.ShortCode)
+	return r.primary.CreateMapping(mapping)
+}
+
+func (r *ReplicatedShortenerRepo) FindByShortCode(shortCode string) (string, error) {
+	if !r.fresh(shortCode) {
+		longURL, err := r.replica.FindByShortCode(shortCode)
+		if err == nil {
+			return longURL, nil
+		}
+		r.replicaFailed("FindByShortCode", err)
+	}
+	return r.primary.FindByShortCode(shortCode)
+}
+
+func (r *ReplicatedShortenerRepo) GetMapping(shortCode string) (*shortner.URLMapping, error) {
+	if !r.fresh(shortCode) {
+		mapping, err := r.replica.GetMapping(shortCode)
+		if err == nil {
+			return mapping, nil
+		}
+		r.replicaFailed("GetMapping", err)
+	}
+	return r.primary.GetMapping(shortCode)
+}
+
+// FindByLongURL reads the primary: its result decides whether a new link
+// is created, and a stale answer would create a duplicate.
+func (r *ReplicatedShortenerRepo) FindByLongURL(longURL string) (string, error) {
+	return findByLongURL(r.primary, longURL)
+}
+
+func (r *ReplicatedShortenerRepo) UpdateLongURL(shortCode, newLongURL string) error {
+	r.wrote(shortCode)
+	return r.primary.UpdateLongURL(shortCode, newLongURL)
+}
+
+func (r *ReplicatedShortenerRepo) UpdateMapping(mapping shortner.URLMapping) error {
+	r.wrote(mapping.ShortCode)
+	return r.primary.UpdateMapping(mapping)
+}
+
+func (r *ReplicatedShortenerRepo) ConsumeMapping(shortCode string, now time.Time) error {
+	r.wrote(shortCode)
+	return r.primary.ConsumeMapping(shortCode, now)
+}
+
+func (r *ReplicatedShortenerRepo) DeleteMapping(shortCode string) error {
+	r.wrote(shortCode)
+	return r.primary.DeleteMapping(shortCode)
+}
+
+func (r *ReplicatedShortenerRepo) ApplyBulk(updates []shortner.URLMapping, deletes []string) error {
+	for _, mapping := range updates {
+		r.wrote(mapping.ShortCode)
+	}
+	for _, shortCode := range deletes {
+		r.wrote(shortCode)
+	}
+	return applyBulk(r.primary, updates, deletes)
+}
+
+func (r *ReplicatedShortenerRepo) ListSince(afterID int64, limit int) ([]shortner.URLMapping, error) {
+	mappings, err := listSince(r.replica, afterID, limit)
+	if err == nil {
+		return mappings, nil
+	}
+	r.replicaFailed("ListSince", err)
+	return listSince(r.primary, afterID, limit)
+}
+
+// Search is a listing, so it reads the replica like ListSince.
+func (r *ReplicatedShortenerRepo) Search(ctx context.Context, query string, page shortner.SearchPage) ([]shortner.URLMapping, error) {
+	mappings, err := searchLinks(ctx, r.replica, query, page)
+	if err == nil {
+		return mappings, nil
+	}
+	r.replicaFailed("Search", err)
+	return searchLinks(ctx, r.primary, query, page)
+}
+
+// ListExpired reads the primary: the cleanup job deletes what it returns,
+// and a stale answer could include a link whose expiry was just extended.
+func (r *ReplicatedShortenerRepo) ListExpired(before time.Time, limit int) ([]shortner.URLMapping, error) {
+	return listExpired(r.primary, before, limit)
+}
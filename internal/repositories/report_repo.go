@@ -0,0 +1,136 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+type ReportRepository interface {
+	InitSchema() error
+	CreateSubscription(sub shortner.ReportSubscription) (int64, error)
+	ListByEmail(email string) ([]shortner.ReportSubscription, error)
+	ListDue(now time.Time, limit int) ([]shortner.ReportSubscription, error)
+	MarkSent(id int64, sentAt, nextRunAt time.Time) error
+	DeleteSubscription(id int64) error
+	DeleteByToken(token string) error
+}
+
+type SQLiteReportRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteReportRepo(db *sql.DB) *SQLiteReportRepo {
+	return &SQLiteReportRepo{db: db}
+}
+
+func (r *SQLiteReportRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS report_subscriptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		email TEXT NOT NULL,
+		frequency TEXT NOT NULL,
+		short_codes TEXT NOT NULL DEFAULT '',
+		unsubscribe_token TEXT NOT NULL UNIQUE,
+		next_run_at TIMESTAMP NOT NULL,
+		last_sent_at TIMESTAMP NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_report_subscriptions_email ON report_subscriptions(email);
+	CREATE INDEX IF NOT EXISTS idx_report_subscriptions_next_run_at ON report_subscriptions(next_run_at);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing report subscriptions schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLiteReportRepo) CreateSubscription(sub shortner.ReportSubscription) (int64, error) {
+	codes := ""
+	if len(sub.ShortCodes) > 0 {
+		raw, err := json.Marshal(sub.ShortCodes)
+		if err != nil {
+			return 0, err
+		}
+		codes = string(raw)
+	}
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = time.Now()
+	}
+	res, err := r.db.Exec("INSERT INTO report_subscriptions(email, frequency, short_codes, unsubscribe_token, next_run_at, created_at) VALUES(?, ?, ?, ?, ?, ?)",
+		sub.Email, sub.Frequency, codes, sub.UnsubscribeToken, sub.NextRunAt.UTC(), sub.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+const reportColumns = "id, email, frequency, short_codes, unsubscribe_token, next_run_at, last_sent_at, created_at"
+
+func (r *SQLiteReportRepo) ListByEmail(email string) ([]shortner.ReportSubscription, error) {
+	return r.querySubscriptions("SELECT "+reportColumns+" FROM report_subscriptions WHERE email = ? ORDER BY id ASC", email)
+}
+
+func (r *SQLiteReportRepo) ListDue(now time.Time, limit int) ([]shortner.ReportSubscription, error) {
+	return r.querySubscriptions("SELECT "+reportColumns+" FROM report_subscriptions WHERE next_run_at <= ? ORDER BY next_run_at ASC, id ASC LIMIT ?", now.UTC(), limit)
+}
+
+func (r *SQLiteReportRepo) MarkSent(id int64, sentAt, nextRunAt time.Time) error {
+	res, err := r.db.Exec("UPDATE report_subscriptions SET last_sent_at = ?, next_run_at = ? WHERE id = ?", sentAt.UTC(), nextRunAt.UTC(), id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *SQLiteReportRepo) DeleteSubscription(id int64) error {
+	res, err := r.db.Exec("DELETE FROM report_subscriptions WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *SQLiteReportRepo) DeleteByToken(token string) error {
+	res, err := r.db.Exec("DELETE FROM report_subscriptions WHERE unsubscribe_token = ?", token)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *SQLiteReportRepo) querySubscriptions(query string, args ...interface{}) ([]shortner.ReportSubscription, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []shortner.ReportSubscription
+	for rows.Next() {
+		var (
+			s          shortner.ReportSubscription
+			codes      string
+			lastSentAt sql.NullTime
+		)
+		if err := rows.Scan(&s.ID, &s.Email, &s.Frequency, &codes, &s.UnsubscribeToken, &s.NextRunAt, &lastSentAt, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		if codes != "" {
+			if err := json.Unmarshal([]byte(codes), &s.ShortCodes); err != nil {
+				return nil, fmt.Errorf("corrupt short codes for report subscription %d: %w", s.ID, err)
+			}
+		}
+		if lastSentAt.Valid {
+			s.LastSentAt = &lastSentAt.Time
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+type RevisionRepository interface {
+	InitSchema() error
+	AddRevision(rev shortner.LinkRevision) (int64, error)
+	ListRevisions(shortCode string) ([]shortner.LinkRevision, error)
+}
+
+type SQLiteRevisionRepo struct {
+	fieldCipher
+	db *sql.DB
+}
+
+func NewSQLiteRevisionRepo(db *sql.DB) *SQLiteRevisionRepo {
+	return &SQLiteRevisionRepo{db: db}
+}
+
+func (r *SQLiteRevisionRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS link_revisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		short_code TEXT NOT NULL,
+		previous_url TEXT NOT NULL,
+		long_url TEXT NOT NULL,
+		source TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_link_revisions_short_code ON link_revisions(short_code);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing link revisions schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLiteRevisionRepo) AddRevision(rev shortner.LinkRevision) (int64, error) {
+	if rev.CreatedAt.IsZero() {
+		rev.CreatedAt = time.Now()
+	}
+	previousURL, err := r.seal(rev.PreviousURL)
+	if err != nil {
+		return 0, err
+	}
+	longURL, err := r.seal(rev.LongURL)
+	if err != nil {
+		return 0, err
+	}
+	res, err := r.db.Exec("INSERT INTO link_revisions(short_code, previous_url, long_url, source, created_at) VALUES(?, ?, ?, ?, ?)",
+		rev.ShortCode, previousURL, longURL, rev.Source, rev.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ListRevisions returns the link's revisions, newest first.
+func (r *SQLiteRevisionRepo) ListRevisions(shortCode string) ([]shortner.LinkRevision, error) {
+	rows, err := r.db.Query("SELECT id, short_code, previous_url, long_url, source, created_at FROM link_revisions WHERE short_code = ? ORDER BY id DESC", shortCode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []shortner.LinkRevision
+	for rows.Next() {
+		var rev shortner.LinkRevision
+		if err := rows.Scan(&rev.ID, &rev.ShortCode, &rev.PreviousURL, &rev.LongURL, &rev.Source, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		if rev.PreviousURL, err = r.open(rev.PreviousURL); err != nil {
+			return nil, err
+		}
+		if rev.LongURL, err = r.open(rev.LongURL); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// Reencrypt rewrites the URLs of every revision not yet encrypted under the
+// primary key.
+func (r *SQLiteRevisionRepo) Reencrypt(batch int) (int, error) {
+	if r.cipher == nil {
+		return 0, errors.New("encryption is not enabled")
+	}
+	return reencryptColumns(r.db, r.cipher, "link_revisions", "id", []string{"previous_url", "long_url"}, batch, func(key any, _, sealed []string) error {
+		_, err := r.db.Exec("UPDATE link_revisions SET previous_url = ?, long_url = ? WHERE id = ?", sealed[0], sealed[1], key)
+		return err
+	})
+}
@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+type ScheduleRepository interface {
+	InitSchema() error
+	CreateChange(change shortner.ScheduledChange) (int64, error)
+	ListChanges(shortCode string) ([]shortner.ScheduledChange, error)
+	ListDue(now time.Time, limit int) ([]shortner.ScheduledChange, error)
+	// FinishChange moves a pending change to status; it returns ErrNotFound
+	// when the change does not exist or is no longer pending.
+	FinishChange(shortCode string, id int64, status, errMsg string, at time.Time) error
+}
+
+type SQLiteScheduleRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteScheduleRepo(db *sql.DB) *SQLiteScheduleRepo {
+	return &SQLiteScheduleRepo{db: db}
+}
+
+func (r *SQLiteScheduleRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS scheduled_changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		short_code TEXT NOT NULL,
+		new_url TEXT NOT NULL,
+		effective_at TIMESTAMP NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		finished_at TIMESTAMP NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_scheduled_changes_due ON scheduled_changes(status, effective_at);
+	CREATE INDEX IF NOT EXISTS idx_scheduled_changes_short_code ON scheduled_changes(short_code);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing scheduled changes schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLiteScheduleRepo) CreateChange(change shortner.ScheduledChange) (int64, error) {
+	if change.CreatedAt.IsZero() {
+		change.CreatedAt = time.Now()
+	}
+	res, err := r.db.Exec("INSERT INTO scheduled_changes(short_code, new_url, effective_at, status, created_at) VALUES(?, ?, ?, ?, ?)",
+		change.ShortCode, change.NewURL, change.EffectiveAt.UTC(), shortner.ScheduleStatusPending, change.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+const scheduleColumns = "id, short_code, new_url, effective_at, status, error, created_at, finished_at"
+
+func (r *SQLiteScheduleRepo) ListChanges(shortCode string) ([]shortner.ScheduledChange, error) {
+	return r.queryChanges("SELECT "+scheduleColumns+" FROM scheduled_changes WHERE short_code = ? ORDER BY effective_at ASC, id ASC", shortCode)
+}
+
+// ListDue returns pending changes whose effective time has passed, oldest
+// first.
+func (r *SQLiteScheduleRepo) ListDue(now time.Time, limit int) ([]shortner.ScheduledChange, error) {
+	return r.queryChanges("SELECT "+scheduleColumns+" FROM scheduled_changes WHERE status = ? AND effective_at <= ? ORDER BY effective_at ASC, id ASC LIMIT ?",
+		shortner.ScheduleStatusPending, now.UTC(), limit)
+}
+
+func (r *SQLiteScheduleRepo) FinishChange(shortCode string, id int64, status, errMsg string, at time.Time) error {
+	res, err := r.db.Exec("UPDATE scheduled_changes SET status = ?, error = ?, finished_at = ? WHERE id = ? AND short_code = ? AND status = ?",
+		status, errMsg, at, id, shortCode, shortner.ScheduleStatusPending)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *SQLiteScheduleRepo) queryChanges(query string, args ...interface{}) ([]shortner.ScheduledChange, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []shortner.ScheduledChange
+	for rows.Next() {
+		var (
+			c          shortner.ScheduledChange
+			finishedAt sql.NullTime
+		)
+		if err := rows.Scan(&c.ID, &c.ShortCode, &c.NewURL, &c.EffectiveAt, &c.Status, &c.Error, &c.CreatedAt, &finishedAt); err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			c.FinishedAt = &finishedAt.Time
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
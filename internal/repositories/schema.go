@@ -0,0 +1,44 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// ensureColumn adds a column to an existing table when it is missing.
+// CREATE TABLE IF NOT EXISTS does not alter tables created by older versions,
+// so every column added after the initial schema goes through here.
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	log.Printf("Database schema: added column %s.%s", table, column)
+	return nil
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// SettingsRepository stores the settings of the service changed through
+// the admin API, such as the branding of its pages, as JSON documents by
+// name.
+type SettingsRepository interface {
+	InitSchema() error
+	// GetSetting returns the value of the setting and when it was saved.
+	GetSetting(name string) (string, time.Time, error)
+	SaveSetting(name, value string, updatedAt time.Time) error
+	DeleteSetting(name string) error
+}
+
+type SQLiteSettingsRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteSettingsRepo(db *sql.DB) *SQLiteSettingsRepo {
+	return &SQLiteSettingsRepo{db: db}
+}
+
+func (r *SQLiteSettingsRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS settings (
+		name TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing settings schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLiteSettingsRepo) GetSetting(name string) (string, time.Time, error) {
+	var value string
+	var updatedAt time.Time
+	err := r.db.QueryRow("SELECT value, updated_at FROM settings WHERE name = ?", name).Scan(&value, &updatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", time.Time{}, ErrNotFound
+		}
+		return "", time.Time{}, err
+	}
+	return value, updatedAt, nil
+}
+
+func (r *SQLiteSettingsRepo) SaveSetting(name, value string, updatedAt time.Time) error {
+	_, err := r.db.Exec(`INSERT INTO settings(name, value, updated_at) VALUES(?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		name, value, updatedAt.UTC())
+	return err
+}
+
+func (r *SQLiteSettingsRepo) DeleteSetting(name string) error {
+	res, err := r.db.Exec("DELETE FROM settings WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
@@ -0,0 +1,233 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	"template/internal/pkg/fieldcrypt"
+	"template/internal/usecases/shortner"
+)
+
+// ShardedShortenerRepo partitions links across several repositories, each
+// usually its own SQLite file, by a hash of the lower-cased short code, so
+// both spellings of a case-insensitive code land on the same shard. The
+// number and order of shards must not change once links are stored, since
+// that would move codes to shards that do not hold them.
+//
+// Each shard numbers its rows on its own. IDs handed out by this repository
+// interleave them as localID*len(shards) + shard, which keeps them unique
+// and ordered by creation within a shard. Across shards they are only
+// roughly ordered, so a ListSince poller can miss a link created in a shard
+// that lags behind the others.
+type ShardedShortenerRepo struct {
+	shards []ShortenerRepository
+}
+
+func NewShardedShortenerRepo(shards []ShortenerRepository) *ShardedShortenerRepo {
+	return &ShardedShortenerRepo{shards: shards}
+}
+
+// OpenSQLiteShortenerRepo opens the links table kept in paths: a single
+// file, or the shards of a ShardedShortenerRepo in order. Each path is
+// opened with connect, usually ConnectDB. A non-nil cipher enables
+// encryption on each of them. The returned databases must be closed by the
+// caller.
+func OpenSQLiteShortenerRepo(paths []string, connect func(string) (*sql.DB, error), caseInsensitive bool, cipher *fieldcrypt.Cipher) (ShortenerRepository, []*sql.DB, error) {
+	var dbs []*sql.DB
+	shards := make([]ShortenerRepository, len(paths))
+	for i, path := range paths {
+		db, err := connect(path)
+		if err != nil {
+			for _, opened := range dbs {
+				opened.Close()
+			}
+			return nil, nil, fmt.Errorf("failed to open '%s': %w", path, err)
+		}
+		dbs = append(dbs, db)
+		repo := NewSQLiteShortenerRepo(db, caseInsensitive)
+		if cipher != nil {
+			repo.EnableEncryption(cipher)
+		}
+		shards[i] = repo
+	}
+	if len(shards) == 1 {
+		return shards[0], dbs, nil
+	}
+	return NewShardedShortenerRepo(shards), dbs, nil
+}
+
+func (r *ShardedShortenerRepo) shardIndex(shortCode string) int {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(shortCode)))
+	return int(h.Sum32() % uint32(len(r.shards)))
+}
+
+func (r *ShardedShortenerRepo) shard(shortCode string) ShortenerRepository {
+	return r.shards[r.shardIndex(shortCode)]
+}
+
+func (r *ShardedShortenerRepo) globalID(localID int64, shard int) int64 {
+	return localID*int64(len(r.shards)) + int64(shard)
+}
+
+// localCursor returns the largest ID local to shard whose global ID is not
+// after afterID.
+func (r *ShardedShortenerRepo) localCursor(afterID int64, shard int) int64 {
+	n := int64(len(r.shards))
+	diff := afterID - int64(shard)
+	if diff < 0 {
+		return -1
+	}
+	return diff / n
+}
+
+func (r *ShardedShortenerRepo) InitSchema() error {
+	for _, s := range r.shards {
+		if err := s.InitSchema(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ShardedShortenerRepo) SaveMapping(shortCode, longURL string) (int64, error) {
+	i := r.shardIndex(shortCode)
+	id, err := r.shards[i].SaveMapping(shortCode, longURL)
+	if err != nil {
+		return 0, err
+	}
+	return r.globalID(id, i), nil
+}
+
+func (r *ShardedShortenerRepo) CreateMapping(mapping shortner.URLMapping) (int64, error) {
+	i := r.shardIndex(mapping.ShortCode)
+	id, err := r.shards[i].CreateMapping(mapping)
+	if err != nil {
+		return 0, err
+	}
+	return r.globalID(id, i), nil
+}
+
+func (r *ShardedShortenerRepo) FindByShortCode(shortCode string) (string, error) {
+	return r.shard(shortCode).FindByShortCode(shortCode)
+}
+
+func (r *ShardedShortenerRepo) GetMapping(shortCode string) (*shortner.URLMapping, error) {
+	i := r.shardIndex(shortCode)
+	mapping, err := r.shards[i].GetMapping(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	mapping.ID = r.globalID(mapping.ID, i)
+	return mapping, nil
+}
+
+// FindByLongURL asks every shard in turn, since links are not partitioned
+// by destination. Like the shards, it returns an empty code when none has
+// the URL.
+func (r *ShardedShortenerRepo) FindByLongURL(longURL string) (string, error) {
+	for _, s := range r.shards {
+		shortCode, err := findByLongURL(s, longURL)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return "", err
+		}
+		if shortCode != "" {
+			return shortCode, nil
+		}
+	}
+	return "", nil
+}
+
+func (r *ShardedShortenerRepo) UpdateLongURL(shortCode, newLongURL string) error {
+	return r.shard(shortCode).UpdateLongURL(shortCode, newLongURL)
+}
+
+func (r *ShardedShortenerRepo) UpdateMapping(mapping shortner.URLMapping) error {
+	return r.shard(mapping.ShortCode).UpdateMapping(mapping)
+}
+
+func (r *ShardedShortenerRepo) ConsumeMapping(shortCode string, now time.Time) error {
+	return r.shard(shortCode).ConsumeMapping(shortCode, now)
+}
+
+func (r *ShardedShortenerRepo) DeleteMapping(shortCode string) error {
+	return r.shard(shortCode).DeleteMapping(shortCode)
+}
+
+// ApplyBulk is atomic only when every change falls in the same shard.
+func (r *ShardedShortenerRepo) ApplyBulk(updates []shortner.URLMapping, deletes []string) error {
+	var target ShortenerRepository
+	for _, code := range bulkCodes(updates, deletes) {
+		shard := r.shard(code)
+		if target != nil && shard != target {
+			return ErrBulkUnsupported
+		}
+		target = shard
+	}
+	if target == nil {
+		return nil
+	}
+	return applyBulk(target, updates, deletes)
+}
+
+func bulkCodes(updates []shortner.URLMapping, deletes []string) []string {
+	codes := make([]string, 0, len(updates)+len(deletes))
+	for _, mapping := range updates {
+		codes = append(codes, mapping.ShortCode)
+	}
+	return append(codes, deletes...)
+}
+
+// Search is not supported: each shard ranks its matches on its own, so
+// their pages cannot be merged into one ranking.
+func (r *ShardedShortenerRepo) Search(ctx context.Context, query string, page shortner.SearchPage) ([]shortner.URLMapping, error) {
+	return nil, ErrSearchUnsupported
+}
+
+// ListSince merges the first limit mappings of every shard after afterID
+// into one page in global ID order.
+func (r *ShardedShortenerRepo) ListSince(afterID int64, limit int) ([]shortner.URLMapping, error) {
+	var all []shortner.URLMapping
+	for i, s := range r.shards {
+		mappings, err := listSince(s, r.localCursor(afterID, i), limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range mappings {
+			m.ID = r.globalID(m.ID, i)
+			all = append(all, m)
+		}
+	}
+	sort.Slice(all, func(a, b int) bool { return all[a].ID < all[b].ID })
+	if len(all) > limit {
+		all = all[:limit]
+	}
+	return all, nil
+}
+
+// ListExpired merges the expired mappings of every shard, oldest expiry
+// first.
+func (r *ShardedShortenerRepo) ListExpired(before time.Time, limit int) ([]shortner.URLMapping, error) {
+	var all []shortner.URLMapping
+	for i, s := range r.shards {
+		mappings, err := listExpired(s, before, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range mappings {
+			m.ID = r.globalID(m.ID, i)
+			all = append(all, m)
+		}
+	}
+	sort.SliceStable(all, func(a, b int) bool { return all[a].ExpiresAt.Before(*all[b].ExpiresAt) })
+	if len(all) > limit {
+		all = all[:limit]
+	}
+	return all, nil
+}
@@ -2,26 +2,81 @@ package repositories
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"template/internal/usecases/shortner"
 )
 
 var ErrNotFound = errors.New("record not found")
 
+// ShortenerRepository stores links by short code. It is all a key-value
+// store needs to provide; lookups by destination and listings are the
+// optional LongURLIndex and LinkLister, and the wrappers below forward
+// them when the repository they wrap has them.
 type ShortenerRepository interface {
 	InitSchema() error
 	SaveMapping(shortCode, longURL string) (int64, error)
+	CreateMapping(mapping shortner.URLMapping) (int64, error)
 	FindByShortCode(shortCode string) (string, error)
-	FindByLongURL(longURL string) (string, error)
+	GetMapping(shortCode string) (*shortner.URLMapping, error)
 	UpdateLongURL(shortCode, newLongURL string) error
+	UpdateMapping(mapping shortner.URLMapping) error
 	DeleteMapping(shortCode string) error
+	// ConsumeMapping marks an unused single-use mapping as used at now. It
+	// returns ErrNotFound when there is no such mapping, so of concurrent
+	// calls for one link exactly one succeeds.
+	ConsumeMapping(shortCode string, now time.Time) error
 }
 
+// BulkWriter is implemented by link repositories that can store a batch of
+// updated mappings and delete a batch of codes in one transaction: either
+// every change is stored or none is. A mapping or code that does not exist
+// fails the batch with an error wrapping ErrNotFound. Wrappers that cannot
+// keep the batch atomic, such as a sharded repository over several files,
+// return ErrBulkUnsupported and the caller applies the changes one by one.
+type BulkWriter interface {
+	ApplyBulk(updates []shortner.URLMapping, deletes []string) error
+}
+
+// ErrBulkUnsupported is returned by ApplyBulk when the changes cannot be
+// applied atomically.
+var ErrBulkUnsupported = errors.New("bulk changes are not supported by this repository")
+
+// applyBulk calls ApplyBulk on repo, or reports ErrBulkUnsupported when repo
+// is not a BulkWriter; the wrappers forward through it.
+func applyBulk(repo ShortenerRepository, updates []shortner.URLMapping, deletes []string) error {
+	bulk, ok := repo.(BulkWriter)
+	if !ok {
+		return ErrBulkUnsupported
+	}
+	return bulk.ApplyBulk(updates, deletes)
+}
+
+// execer is a *sql.DB or a *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// SQLiteShortenerRepo stores links in the urls table. With case-insensitive
+// codes, lookups ignore the case of the short code and a unique index keeps
+// two codes from differing only in case; the code keeps the case it was
+// created with.
+//
+// With encryption enabled, long_url holds ciphertext and long_url_hash a
+// blind index of the destination, which FindByLongURL searches instead.
 type SQLiteShortenerRepo struct {
-	db *sql.DB
+	fieldCipher
+	db              *sql.DB
+	caseInsensitive bool
+	codeMatch       string
+	// fullText is set by InitSchema when the urls_search index is in use.
+	fullText bool
 }
 
 func ConnectDB(dataSourceName string) (*sql.DB, error) {
@@ -36,8 +91,36 @@ func ConnectDB(dataSourceName string) (*sql.DB, error) {
 	return db, nil
 }
 
-func NewSQLiteShortenerRepo(db *sql.DB) *SQLiteShortenerRepo {
-	return &SQLiteShortenerRepo{db: db}
+// maxConnectBackoff caps the doubling delay between connection attempts.
+const maxConnectBackoff = 8 * time.Second
+
+// ConnectDBWithRetry calls ConnectDB up to attempts times, waiting backoff
+// after the first failure and twice as long after each further one, so a
+// database that is briefly unavailable at startup, such as a volume still
+// being mounted, does not stop the service.
+func ConnectDBWithRetry(dataSourceName string, attempts int, backoff time.Duration) (*sql.DB, error) {
+	var err error
+	for attempt := 1; ; attempt++ {
+		var db *sql.DB
+		if db, err = ConnectDB(dataSourceName); err == nil {
+			return db, nil
+		}
+		if attempt >= attempts {
+			break
+		}
+		log.Printf("Database connection attempt %d/%d failed, retrying in %s: %v", attempt, attempts, backoff, err)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxConnectBackoff)
+	}
+	return nil, fmt.Errorf("after %d attempt(s): %w", attempts, err)
+}
+
+func NewSQLiteShortenerRepo(db *sql.DB, caseInsensitive bool) *SQLiteShortenerRepo {
+	r := &SQLiteShortenerRepo{db: db, caseInsensitive: caseInsensitive, codeMatch: "short_code = ?"}
+	if caseInsensitive {
+		r.codeMatch = "short_code = ? COLLATE NOCASE"
+	}
+	return r
 }
 
 func (r *SQLiteShortenerRepo) InitSchema() error {
@@ -56,18 +139,133 @@ func (r *SQLiteShortenerRepo) InitSchema() error {
 		log.Printf("Error initializing schema: %v", err)
 		return err
 	}
+	columns := []struct{ name, definition string }{
+		{"headers", "TEXT NOT NULL DEFAULT ''"},
+		{"redirect_type", "INTEGER NOT NULL DEFAULT 302"},
+		{"cache_control", "TEXT NOT NULL DEFAULT ''"},
+		{"language", "TEXT NOT NULL DEFAULT ''"},
+		{"kind", "TEXT NOT NULL DEFAULT 'redirect'"},
+		{"title", "TEXT NOT NULL DEFAULT ''"},
+		{"expires_at", "TIMESTAMP NULL"},
+		{"language_targets", "TEXT NOT NULL DEFAULT ''"},
+		{"pixel_ids", "TEXT NOT NULL DEFAULT ''"},
+		{"stats_visibility", "TEXT NOT NULL DEFAULT 'private'"},
+		{"stats_token", "TEXT NOT NULL DEFAULT ''"},
+		{"single_use", "INTEGER NOT NULL DEFAULT 0"},
+		{"consumed_at", "TIMESTAMP NULL"},
+		{"long_url_hash", "TEXT NOT NULL DEFAULT ''"},
+		{"allowed_countries", "TEXT NOT NULL DEFAULT ''"},
+		{"blocked_countries", "TEXT NOT NULL DEFAULT ''"},
+		{"time_rules", "TEXT NOT NULL DEFAULT ''"},
+		{"social_preview", "INTEGER NOT NULL DEFAULT 0"},
+		{"query_passthrough", "TEXT NOT NULL DEFAULT ''"},
+		{"wildcard", "INTEGER NOT NULL DEFAULT 0"},
+		{"spike_factor", "REAL NOT NULL DEFAULT 0"},
+		{"spike_min_clicks", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, c := range columns {
+		if err := ensureColumn(r.db, "urls", c.name, c.definition); err != nil {
+			log.Printf("Error migrating schema: %v", err)
+			return err
+		}
+	}
+	if _, err := r.db.Exec("CREATE INDEX IF NOT EXISTS idx_urls_long_url_hash ON urls(long_url_hash) WHERE long_url_hash != ''"); err != nil {
+		log.Printf("Error migrating schema: %v", err)
+		return err
+	}
+	if _, err := r.db.Exec("CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls(expires_at) WHERE expires_at IS NOT NULL"); err != nil {
+		log.Printf("Error migrating schema: %v", err)
+		return err
+	}
+	if err := r.ensureCodeCaseIndex(); err != nil {
+		log.Printf("Error migrating schema: %v", err)
+		return err
+	}
+	if err := r.ensureSearchIndex(); err != nil {
+		log.Printf("Error creating the link search index: %v", err)
+		return err
+	}
 	log.Println("Database schema initialized successfully.")
 	return nil
 }
 
+// ensureCodeCaseIndex adds the case-insensitive unique index on short_code
+// when codes are case-insensitive and drops it otherwise.
+func (r *SQLiteShortenerRepo) ensureCodeCaseIndex() error {
+	if !r.caseInsensitive {
+		_, err := r.db.Exec("DROP INDEX IF EXISTS idx_urls_short_code_nocase")
+		return err
+	}
+	_, err := r.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_short_code_nocase ON urls(short_code COLLATE NOCASE)")
+	if err != nil {
+		return fmt.Errorf("cannot make short codes case-insensitive, some existing codes differ only in case: %w", err)
+	}
+	return nil
+}
+
 func (r *SQLiteShortenerRepo) SaveMapping(shortCode, longURL string) (int64, error) {
-	stmt, err := r.db.Prepare("INSERT INTO urls(short_code, long_url, created_at) VALUES(?, ?, ?)")
+	storedURL, urlHash, err := r.sealURL(longURL)
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := r.db.Prepare("INSERT INTO urls(short_code, long_url, long_url_hash, created_at) VALUES(?, ?, ?, ?)")
 	if err != nil {
 		return 0, err
 	}
 	defer stmt.Close()
 
-	res, err := stmt.Exec(shortCode, longURL, time.Now())
+	res, err := stmt.Exec(shortCode, storedURL, urlHash, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// CreateMapping inserts a mapping with all of its settings.
+func (r *SQLiteShortenerRepo) CreateMapping(mapping shortner.URLMapping) (int64, error) {
+	headers, err := encodeStringMap(mapping.Headers)
+	if err != nil {
+		return 0, err
+	}
+	languageTargets, err := encodeStringMap(mapping.LanguageTargets)
+	if err != nil {
+		return 0, err
+	}
+	pixelIDs, err := encodePixelIDs(mapping.PixelIDs)
+	if err != nil {
+		return 0, err
+	}
+	allowedCountries, blockedCountries, err := encodeCountries(mapping)
+	if err != nil {
+		return 0, err
+	}
+	timeRules, err := encodeTimeRules(mapping.TimeRules)
+	if err != nil {
+		return 0, err
+	}
+	if mapping.Kind == "" {
+		mapping.Kind = shortner.KindRedirect
+	}
+	if mapping.RedirectType == 0 {
+		mapping.RedirectType = 302
+	}
+	if mapping.CreatedAt.IsZero() {
+		mapping.CreatedAt = time.Now()
+	}
+	if mapping.StatsVisibility == "" {
+		mapping.StatsVisibility = shortner.StatsPrivate
+	}
+
+	storedURL, urlHash, err := r.sealURL(mapping.LongURL)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := r.db.Exec(`INSERT INTO urls(short_code, kind, title, long_url, long_url_hash, created_at, headers, redirect_type, cache_control, language, expires_at, language_targets, pixel_ids, stats_visibility, stats_token, single_use, allowed_countries, blocked_countries, time_rules, social_preview, query_passthrough, wildcard, spike_factor, spike_min_clicks)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		mapping.ShortCode, mapping.Kind, mapping.Title, storedURL, urlHash, mapping.CreatedAt,
+		headers, mapping.RedirectType, mapping.CacheControl, mapping.Language, utcTime(mapping.ExpiresAt), languageTargets, pixelIDs, mapping.StatsVisibility, mapping.StatsToken, mapping.SingleUse,
+		allowedCountries, blockedCountries, timeRules, mapping.SocialPreview, mapping.QueryPassthrough, mapping.Wildcard, mapping.SpikeFactor, mapping.SpikeMinClicks)
 	if err != nil {
 		return 0, err
 	}
@@ -76,19 +274,123 @@ func (r *SQLiteShortenerRepo) SaveMapping(shortCode, longURL string) (int64, err
 
 func (r *SQLiteShortenerRepo) FindByShortCode(shortCode string) (string, error) {
 	var longURL string
-	err := r.db.QueryRow("SELECT long_url FROM urls WHERE short_code = ?", shortCode).Scan(&longURL)
+	err := r.db.QueryRow("SELECT long_url FROM urls WHERE "+r.codeMatch, shortCode).Scan(&longURL)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return "", ErrNotFound
 		}
 		return "", err
 	}
-	return longURL, nil
+	return r.open(longURL)
+}
+
+const mappingColumns = "id, short_code, kind, title, long_url, created_at, headers, redirect_type, cache_control, language, expires_at, language_targets, pixel_ids, stats_visibility, stats_token, single_use, consumed_at, allowed_countries, blocked_countries, time_rules, social_preview, query_passthrough, wildcard, spike_factor, spike_min_clicks"
+
+func (r *SQLiteShortenerRepo) GetMapping(shortCode string) (*shortner.URLMapping, error) {
+	m, err := r.scanMapping(r.db.QueryRow("SELECT "+mappingColumns+" FROM urls WHERE "+r.codeMatch, shortCode))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return m, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMapping(row rowScanner) (*shortner.URLMapping, error) {
+	var (
+		m               shortner.URLMapping
+		headers         string
+		expiresAt       sql.NullTime
+		languageTargets string
+		pixelIDs        string
+		consumedAt      sql.NullTime
+		allowed         string
+		blocked         string
+		timeRules       string
+	)
+	if err := row.Scan(&m.ID, &m.ShortCode, &m.Kind, &m.Title, &m.LongURL, &m.CreatedAt, &headers, &m.RedirectType, &m.CacheControl, &m.Language, &expiresAt, &languageTargets, &pixelIDs, &m.StatsVisibility, &m.StatsToken, &m.SingleUse, &consumedAt, &allowed, &blocked, &timeRules, &m.SocialPreview, &m.QueryPassthrough, &m.Wildcard, &m.SpikeFactor, &m.SpikeMinClicks); err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		m.ExpiresAt = &expiresAt.Time
+	}
+	if consumedAt.Valid {
+		m.ConsumedAt = &consumedAt.Time
+	}
+	if headers != "" {
+		if err := json.Unmarshal([]byte(headers), &m.Headers); err != nil {
+			return nil, fmt.Errorf("corrupt headers for code '%s': %w", m.ShortCode, err)
+		}
+	}
+	if languageTargets != "" {
+		if err := json.Unmarshal([]byte(languageTargets), &m.LanguageTargets); err != nil {
+			return nil, fmt.Errorf("corrupt language targets for code '%s': %w", m.ShortCode, err)
+		}
+	}
+	if pixelIDs != "" {
+		if err := json.Unmarshal([]byte(pixelIDs), &m.PixelIDs); err != nil {
+			return nil, fmt.Errorf("corrupt pixel ids for code '%s': %w", m.ShortCode, err)
+		}
+	}
+	if allowed != "" {
+		if err := json.Unmarshal([]byte(allowed), &m.AllowedCountries); err != nil {
+			return nil, fmt.Errorf("corrupt allowed countries for code '%s': %w", m.ShortCode, err)
+		}
+	}
+	if blocked != "" {
+		if err := json.Unmarshal([]byte(blocked), &m.BlockedCountries); err != nil {
+			return nil, fmt.Errorf("corrupt blocked countries for code '%s': %w", m.ShortCode, err)
+		}
+	}
+	if timeRules != "" {
+		if err := json.Unmarshal([]byte(timeRules), &m.TimeRules); err != nil {
+			return nil, fmt.Errorf("corrupt time rules for code '%s': %w", m.ShortCode, err)
+		}
+	}
+	return &m, nil
+}
+
+// scanMapping scans a mapping and decrypts its destination.
+func (r *SQLiteShortenerRepo) scanMapping(row rowScanner) (*shortner.URLMapping, error) {
+	m, err := scanMapping(row)
+	if err != nil {
+		return nil, err
+	}
+	if m.LongURL, err = r.open(m.LongURL); err != nil {
+		return nil, fmt.Errorf("cannot decrypt destination of code '%s': %w", m.ShortCode, err)
+	}
+	return m, nil
+}
+
+// sealURL returns the stored form of longURL and its blind index, which is
+// empty while encryption is off.
+func (r *SQLiteShortenerRepo) sealURL(longURL string) (stored, hash string, err error) {
+	if r.cipher == nil {
+		return longURL, "", nil
+	}
+	stored, err = r.cipher.Encrypt(longURL)
+	return stored, r.cipher.BlindIndex(longURL), err
 }
 
 func (r *SQLiteShortenerRepo) FindByLongURL(longURL string) (string, error) {
+	query, args := "SELECT short_code FROM urls WHERE long_url = ? AND single_use = 0 AND wildcard = 0 LIMIT 1", []any{longURL}
+	if r.cipher != nil {
+		// Rows written under a key that has since been rotated out keep
+		// their old blind index until they are re-encrypted.
+		indexes := r.cipher.BlindIndexes(longURL)
+		args = make([]any, len(indexes))
+		for i, index := range indexes {
+			args[i] = index
+		}
+		query = "SELECT short_code FROM urls WHERE long_url_hash IN (?" + strings.Repeat(", ?", len(indexes)-1) + ") AND single_use = 0 AND wildcard = 0 LIMIT 1"
+	}
 	var shortCode string
-	err := r.db.QueryRow("SELECT short_code FROM urls WHERE long_url = ? LIMIT 1", longURL).Scan(&shortCode)
+	err := r.db.QueryRow(query, args...).Scan(&shortCode)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return "", nil
@@ -99,13 +401,17 @@ func (r *SQLiteShortenerRepo) FindByLongURL(longURL string) (string, error) {
 }
 
 func (r *SQLiteShortenerRepo) UpdateLongURL(shortCode, newLongURL string) error {
-	stmt, err := r.db.Prepare("UPDATE urls SET long_url = ? WHERE short_code = ?")
+	storedURL, urlHash, err := r.sealURL(newLongURL)
+	if err != nil {
+		return err
+	}
+	stmt, err := r.db.Prepare("UPDATE urls SET long_url = ?, long_url_hash = ? WHERE " + r.codeMatch)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	res, err := stmt.Exec(newLongURL, shortCode)
+	res, err := stmt.Exec(storedURL, urlHash, shortCode)
 	if err != nil {
 		return err
 	}
@@ -121,14 +427,136 @@ func (r *SQLiteShortenerRepo) UpdateLongURL(shortCode, newLongURL string) error
 	return nil
 }
 
-func (r *SQLiteShortenerRepo) DeleteMapping(shortCode string) error {
-	stmt, err := r.db.Prepare("DELETE FROM urls WHERE short_code = ?")
+// UpdateMapping overwrites the mutable fields of an existing mapping.
+func (r *SQLiteShortenerRepo) UpdateMapping(mapping shortner.URLMapping) error {
+	return r.updateMapping(r.db, mapping)
+}
+
+func (r *SQLiteShortenerRepo) updateMapping(db execer, mapping shortner.URLMapping) error {
+	headers, err := encodeStringMap(mapping.Headers)
+	if err != nil {
+		return err
+	}
+	languageTargets, err := encodeStringMap(mapping.LanguageTargets)
+	if err != nil {
+		return err
+	}
+	pixelIDs, err := encodePixelIDs(mapping.PixelIDs)
+	if err != nil {
+		return err
+	}
+	allowedCountries, blockedCountries, err := encodeCountries(mapping)
+	if err != nil {
+		return err
+	}
+	timeRules, err := encodeTimeRules(mapping.TimeRules)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
 
-	res, err := stmt.Exec(shortCode)
+	storedURL, urlHash, err := r.sealURL(mapping.LongURL)
+	if err != nil {
+		return err
+	}
+
+	res, err := db.Exec(`UPDATE urls SET title = ?, long_url = ?, long_url_hash = ?, headers = ?, redirect_type = ?, cache_control = ?, language = ?, expires_at = ?, language_targets = ?, pixel_ids = ?, stats_visibility = ?, stats_token = ?, single_use = ?, consumed_at = ?, allowed_countries = ?, blocked_countries = ?, time_rules = ?, social_preview = ?, query_passthrough = ?, spike_factor = ?, spike_min_clicks = ?
+		WHERE short_code = ?`,
+		mapping.Title, storedURL, urlHash, headers, mapping.RedirectType, mapping.CacheControl, mapping.Language, utcTime(mapping.ExpiresAt), languageTargets, pixelIDs, mapping.StatsVisibility, mapping.StatsToken, mapping.SingleUse, utcTime(mapping.ConsumedAt),
+		allowedCountries, blockedCountries, timeRules, mapping.SocialPreview, mapping.QueryPassthrough, mapping.SpikeFactor, mapping.SpikeMinClicks, mapping.ShortCode)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// utcTime converts an expiry to UTC before it is stored: SQLite compares the
+// timestamps as text, so ListExpired needs every row in the same offset.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+func encodeStringMap(headers map[string]string) (string, error) {
+	if len(headers) == 0 {
+		return "", nil
+	}
+	raw, err := json.Marshal(headers)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+func encodePixelIDs(ids []int64) (string, error) {
+	if len(ids) == 0 {
+		return "", nil
+	}
+	raw, err := json.Marshal(ids)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+func encodeCountries(mapping shortner.URLMapping) (allowed, blocked string, err error) {
+	if allowed, err = encodeStrings(mapping.AllowedCountries); err != nil {
+		return "", "", err
+	}
+	if blocked, err = encodeStrings(mapping.BlockedCountries); err != nil {
+		return "", "", err
+	}
+	return allowed, blocked, nil
+}
+
+func encodeStrings(values []string) (string, error) {
+	if len(values) == 0 {
+		return "", nil
+	}
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+func encodeTimeRules(rules []shortner.TimeRule) (string, error) {
+	if len(rules) == 0 {
+		return "", nil
+	}
+	raw, err := json.Marshal(rules)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// ConsumeMapping relies on the conditional UPDATE being atomic: only the
+// first of several concurrent redirects finds consumed_at still NULL.
+func (r *SQLiteShortenerRepo) ConsumeMapping(shortCode string, now time.Time) error {
+	res, err := r.db.Exec("UPDATE urls SET consumed_at = ? WHERE "+r.codeMatch+" AND single_use = 1 AND consumed_at IS NULL", now.UTC(), shortCode)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *SQLiteShortenerRepo) DeleteMapping(shortCode string) error {
+	return r.deleteMapping(r.db, shortCode)
+}
+
+func (r *SQLiteShortenerRepo) deleteMapping(db execer, shortCode string) error {
+	res, err := db.Exec("DELETE FROM urls WHERE "+r.codeMatch, shortCode)
 	if err != nil {
 		return err
 	}
@@ -144,6 +572,77 @@ func (r *SQLiteShortenerRepo) DeleteMapping(shortCode string) error {
 	return nil
 }
 
+// ApplyBulk stores updates and deletes in one transaction.
+func (r *SQLiteShortenerRepo) ApplyBulk(updates []shortner.URLMapping, deletes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, mapping := range updates {
+		if err := r.updateMapping(tx, mapping); err != nil {
+			return fmt.Errorf("updating %s: %w", mapping.ShortCode, err)
+		}
+	}
+	for _, shortCode := range deletes {
+		if err := r.deleteMapping(tx, shortCode); err != nil {
+			return fmt.Errorf("deleting %s: %w", shortCode, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ListSince returns mappings with an ID greater than afterID in ascending ID
+// order, which gives pollers a stable cursor.
+func (r *SQLiteShortenerRepo) ListSince(afterID int64, limit int) ([]shortner.URLMapping, error) {
+	rows, err := r.db.Query("SELECT "+mappingColumns+" FROM urls WHERE id > ? ORDER BY id ASC LIMIT ?", afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mappings []shortner.URLMapping
+	for rows.Next() {
+		m, err := r.scanMapping(rows)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, *m)
+	}
+	return mappings, rows.Err()
+}
+
+func (r *SQLiteShortenerRepo) ListExpired(before time.Time, limit int) ([]shortner.URLMapping, error) {
+	rows, err := r.db.Query("SELECT "+mappingColumns+" FROM urls WHERE expires_at IS NOT NULL AND expires_at < ? ORDER BY expires_at ASC LIMIT ?", before.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mappings []shortner.URLMapping
+	for rows.Next() {
+		m, err := r.scanMapping(rows)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, *m)
+	}
+	return mappings, rows.Err()
+}
+
+// Reencrypt rewrites every destination that is not yet encrypted under the
+// primary key, together with its blind index.
+func (r *SQLiteShortenerRepo) Reencrypt(batch int) (int, error) {
+	if r.cipher == nil {
+		return 0, errors.New("encryption is not enabled")
+	}
+	return reencryptColumns(r.db, r.cipher, "urls", "id", []string{"long_url"}, batch, func(key any, plaintexts, sealed []string) error {
+		_, err := r.db.Exec("UPDATE urls SET long_url = ?, long_url_hash = ? WHERE id = ?", sealed[0], r.cipher.BlindIndex(plaintexts[0]), key)
+		return err
+	})
+}
+
 func (r *SQLiteShortenerRepo) Close() error {
 	if r.db != nil {
 		return r.db.Close()
@@ -0,0 +1,167 @@
+package repositories_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"template/internal/pkg/latency"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+// benchLinks is the number of links stored before the lookup benchmarks.
+const benchLinks = 1000
+
+// benchRepo is one configuration of the SQLite link repository.
+type benchRepo struct {
+	name  string
+	build func(b *testing.B) *repositories.SQLiteShortenerRepo
+}
+
+func benchRepos() []benchRepo {
+	return []benchRepo{
+		{"plain", func(b *testing.B) *repositories.SQLiteShortenerRepo {
+			return repositories.NewSQLiteShortenerRepo(openDB(b, "bench.db"), false)
+		}},
+		{"encrypted", func(b *testing.B) *repositories.SQLiteShortenerRepo {
+			repo := repositories.NewSQLiteShortenerRepo(openDB(b, "bench.db"), false)
+			repo.EnableEncryption(testCipher(b, 1))
+			return repo
+		}},
+	}
+}
+
+// seededRepo builds repo with its schema and benchLinks links, whose codes
+// and destinations are returned.
+func seededRepo(b *testing.B, build func(*testing.B) *repositories.SQLiteShortenerRepo) (*repositories.SQLiteShortenerRepo, []string, []string) {
+	b.Helper()
+	repo := build(b)
+	if err := repo.InitSchema(); err != nil {
+		b.Fatal(err)
+	}
+	codes := make([]string, benchLinks)
+	urls := make([]string, benchLinks)
+	for i := range codes {
+		codes[i] = fmt.Sprintf("seed%04d", i)
+		urls[i] = fmt.Sprintf("https://example.com/seed/%d", i)
+		if _, err := repo.CreateMapping(shortner.URLMapping{ShortCode: codes[i], LongURL: urls[i], CreatedAt: time.Now()}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return repo, codes, urls
+}
+
+// reportLatency adds the percentiles of rec to the benchmark's output.
+func reportLatency(b *testing.B, rec *latency.Recorder) {
+	for unit, value := range rec.Summary().Metrics() {
+		b.ReportMetric(value, unit)
+	}
+}
+
+func BenchmarkCreateMapping(b *testing.B) {
+	for _, br := range benchRepos() {
+		b.Run(br.name, func(b *testing.B) {
+			repo := br.build(b)
+			if err := repo.InitSchema(); err != nil {
+				b.Fatal(err)
+			}
+			var rec latency.Recorder
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				mapping := shortner.URLMapping{
+					ShortCode: fmt.Sprintf("b%07d", i),
+					LongURL:   fmt.Sprintf("https://example.com/bench/%d", i),
+					CreatedAt: start,
+				}
+				if _, err := repo.CreateMapping(mapping); err != nil {
+					b.Fatal(err)
+				}
+				rec.Since(start)
+			}
+			reportLatency(b, &rec)
+		})
+	}
+}
+
+func BenchmarkFindByShortCode(b *testing.B) {
+	for _, br := range benchRepos() {
+		b.Run(br.name, func(b *testing.B) {
+			repo, codes, _ := seededRepo(b, br.build)
+			var rec latency.Recorder
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				if _, err := repo.FindByShortCode(codes[rand.IntN(len(codes))]); err != nil {
+					b.Fatal(err)
+				}
+				rec.Since(start)
+			}
+			reportLatency(b, &rec)
+		})
+	}
+}
+
+// BenchmarkFindByShortCodeParallel is the redirect path under concurrent
+// load; run it with -cpu to vary the number of readers.
+func BenchmarkFindByShortCodeParallel(b *testing.B) {
+	for _, br := range benchRepos() {
+		b.Run(br.name, func(b *testing.B) {
+			repo, codes, _ := seededRepo(b, br.build)
+			var rec latency.Recorder
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					start := time.Now()
+					if _, err := repo.FindByShortCode(codes[rand.IntN(len(codes))]); err != nil {
+						b.Error(err)
+						return
+					}
+					rec.Since(start)
+				}
+			})
+			reportLatency(b, &rec)
+		})
+	}
+}
+
+func BenchmarkGetMapping(b *testing.B) {
+	for _, br := range benchRepos() {
+		b.Run(br.name, func(b *testing.B) {
+			repo, codes, _ := seededRepo(b, br.build)
+			var rec latency.Recorder
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				if _, err := repo.GetMapping(codes[rand.IntN(len(codes))]); err != nil {
+					b.Fatal(err)
+				}
+				rec.Since(start)
+			}
+			reportLatency(b, &rec)
+		})
+	}
+}
+
+// BenchmarkFindByLongURL is the duplicate check done before every new link;
+// with encryption it goes through the blind index.
+func BenchmarkFindByLongURL(b *testing.B) {
+	for _, br := range benchRepos() {
+		b.Run(br.name, func(b *testing.B) {
+			repo, _, urls := seededRepo(b, br.build)
+			var rec latency.Recorder
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				code, err := repo.FindByLongURL(urls[rand.IntN(len(urls))])
+				if err != nil || code == "" {
+					b.Fatalf("FindByLongURL = %q, %v", code, err)
+				}
+				rec.Since(start)
+			}
+			reportLatency(b, &rec)
+		})
+	}
+}
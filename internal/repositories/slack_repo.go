@@ -0,0 +1,134 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// SlackWorkspaceRepository stores per-workspace configuration for the Slack
+// slash-command integration, keyed by the Slack team ID.
+type SlackWorkspaceRepository interface {
+	InitSchema() error
+	FindSigningSecret(teamID string) (string, error)
+	// ListWorkspaces lists the workspaces in team ID order, without their
+	// secrets.
+	ListWorkspaces() ([]shortner.SlackWorkspace, error)
+	GetWorkspace(teamID string) (*shortner.SlackWorkspace, error)
+	// SaveWorkspace stores the workspace, or replaces the name and secret
+	// of the workspace with the same team ID.
+	SaveWorkspace(teamID, teamName, signingSecret string) error
+	DeleteWorkspace(teamID string) error
+}
+
+// SQLiteSlackWorkspaceRepo encrypts the signing secrets once encryption is
+// enabled.
+type SQLiteSlackWorkspaceRepo struct {
+	fieldCipher
+	db *sql.DB
+}
+
+func NewSQLiteSlackWorkspaceRepo(db *sql.DB) *SQLiteSlackWorkspaceRepo {
+	return &SQLiteSlackWorkspaceRepo{db: db}
+}
+
+func (r *SQLiteSlackWorkspaceRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS slack_workspaces (
+		team_id TEXT PRIMARY KEY,
+		team_name TEXT NOT NULL DEFAULT '',
+		signing_secret TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing slack_workspaces schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLiteSlackWorkspaceRepo) FindSigningSecret(teamID string) (string, error) {
+	var secret string
+	err := r.db.QueryRow("SELECT signing_secret FROM slack_workspaces WHERE team_id = ?", teamID).Scan(&secret)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return r.open(secret)
+}
+
+func (r *SQLiteSlackWorkspaceRepo) ListWorkspaces() ([]shortner.SlackWorkspace, error) {
+	rows, err := r.db.Query("SELECT team_id, team_name, created_at FROM slack_workspaces ORDER BY team_id ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workspaces []shortner.SlackWorkspace
+	for rows.Next() {
+		var w shortner.SlackWorkspace
+		if err := rows.Scan(&w.TeamID, &w.TeamName, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, w)
+	}
+	return workspaces, rows.Err()
+}
+
+func (r *SQLiteSlackWorkspaceRepo) GetWorkspace(teamID string) (*shortner.SlackWorkspace, error) {
+	w := shortner.SlackWorkspace{TeamID: teamID}
+	err := r.db.QueryRow("SELECT team_name, created_at FROM slack_workspaces WHERE team_id = ?", teamID).Scan(&w.TeamName, &w.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (r *SQLiteSlackWorkspaceRepo) SaveWorkspace(teamID, teamName, signingSecret string) error {
+	signingSecret, err := r.seal(signingSecret)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`
+		INSERT INTO slack_workspaces(team_id, team_name, signing_secret, created_at) VALUES(?, ?, ?, ?)
+		ON CONFLICT(team_id) DO UPDATE SET team_name = excluded.team_name, signing_secret = excluded.signing_secret`,
+		teamID, teamName, signingSecret, time.Now())
+	return err
+}
+
+func (r *SQLiteSlackWorkspaceRepo) DeleteWorkspace(teamID string) error {
+	res, err := r.db.Exec("DELETE FROM slack_workspaces WHERE team_id = ?", teamID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Reencrypt rewrites every signing secret not yet encrypted under the
+// primary key.
+func (r *SQLiteSlackWorkspaceRepo) Reencrypt(batch int) (int, error) {
+	if r.cipher == nil {
+		return 0, errors.New("encryption is not enabled")
+	}
+	return reencryptColumns(r.db, r.cipher, "slack_workspaces", "team_id", []string{"signing_secret"}, batch, func(key any, _, sealed []string) error {
+		_, err := r.db.Exec("UPDATE slack_workspaces SET signing_secret = ? WHERE team_id = ?", sealed[0], key)
+		return err
+	})
+}
@@ -0,0 +1,372 @@
+package repositories
+
+import (
+	"database/sql"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// StatsRepository keeps the rollup tables behind the admin overview.
+// Rollup folds links and clicks created since the last run into per-day,
+// per-link and per-domain counters, so the overview never scans the clicks
+// table.
+type StatsRepository interface {
+	InitSchema() error
+	Rollup(batch int) (int, error)
+	// ResetRollups empties the rollup tables, so that the following Rollup
+	// runs count every link and click again from the start.
+	ResetRollups() error
+	Totals() (links, redirects int64, err error)
+	LinksPerDay(from time.Time) ([]shortner.DailyCount, error)
+	TopLinks(limit int) ([]shortner.LinkClicks, error)
+	TopDomains(limit int) ([]shortner.DomainStats, error)
+	StorageUsage() (shortner.StorageUsage, error)
+	// MergeLinks credits the clicks of the from codes to the to code, both
+	// the raw clicks and their rolled-up counts, and returns how many clicks
+	// were moved.
+	MergeLinks(from []string, to string) (int64, error)
+}
+
+type SQLiteStatsRepo struct {
+	fieldCipher
+	db *sql.DB
+}
+
+func NewSQLiteStatsRepo(db *sql.DB) *SQLiteStatsRepo {
+	return &SQLiteStatsRepo{db: db}
+}
+
+func (r *SQLiteStatsRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS rollup_state (
+		source TEXT PRIMARY KEY,
+		last_id INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS daily_stats (
+		day TEXT PRIMARY KEY,
+		links_created INTEGER NOT NULL DEFAULT 0,
+		redirects INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS link_stats (
+		short_code TEXT PRIMARY KEY,
+		clicks INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX IF NOT EXISTS idx_link_stats_clicks ON link_stats(clicks);
+	CREATE TABLE IF NOT EXISTS domain_stats (
+		domain TEXT PRIMARY KEY,
+		links INTEGER NOT NULL DEFAULT 0,
+		clicks INTEGER NOT NULL DEFAULT 0
+	);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing stats schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+type dailyDelta struct {
+	links, redirects int64
+}
+
+type domainDelta struct {
+	links, clicks int64
+}
+
+// Rollup processes at most batch new links and batch new clicks and returns
+// how many rows it folded in. Counters and watermarks are updated in one
+// transaction, so an interrupted run is simply repeated. Clicks are credited
+// to the domain their link points to at rollup time.
+func (r *SQLiteStatsRepo) Rollup(batch int) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	lastLink, err := rollupWatermark(tx, "urls")
+	if err != nil {
+		return 0, err
+	}
+	lastClick, err := rollupWatermark(tx, "clicks")
+	if err != nil {
+		return 0, err
+	}
+
+	days := map[string]*dailyDelta{}
+	day := func(t time.Time) *dailyDelta {
+		key := t.UTC().Format("2006-01-02")
+		if days[key] == nil {
+			days[key] = &dailyDelta{}
+		}
+		return days[key]
+	}
+	domains := map[string]*domainDelta{}
+	domain := func(storedURL string) *domainDelta {
+		longURL, err := r.open(storedURL)
+		if err != nil {
+			// A destination under an unknown key is not credited to
+			// any domain rather than stopping the rollup.
+			return nil
+		}
+		host := destinationHost(longURL)
+		if host == "" {
+			return nil
+		}
+		if domains[host] == nil {
+			domains[host] = &domainDelta{}
+		}
+		return domains[host]
+	}
+	links := map[string]int64{}
+	processed := 0
+
+	rows, err := tx.Query("SELECT id, kind, long_url, created_at FROM urls WHERE id > ? ORDER BY id ASC LIMIT ?", lastLink, batch)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var kind, longURL string
+		var createdAt time.Time
+		if err := rows.Scan(&lastLink, &kind, &longURL, &createdAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		day(createdAt).links++
+		if d := domain(longURL); d != nil && kind == shortner.KindRedirect {
+			d.links++
+		}
+		processed++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	rows, err = tx.Query(`SELECT c.id, c.short_code, c.clicked_at, COALESCE(u.kind, ''), COALESCE(u.long_url, '')
+		FROM clicks c LEFT JOIN urls u ON u.short_code = c.short_code
+		WHERE c.id > ? ORDER BY c.id ASC LIMIT ?`, lastClick, batch)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var code, kind, longURL string
+		var clickedAt time.Time
+		if err := rows.Scan(&lastClick, &code, &clickedAt, &kind, &longURL); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		day(clickedAt).redirects++
+		links[code]++
+		if d := domain(longURL); d != nil && kind == shortner.KindRedirect {
+			d.clicks++
+		}
+		processed++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if processed == 0 {
+		return 0, nil
+	}
+
+	for key, d := range days {
+		if _, err := tx.Exec(`INSERT INTO daily_stats(day, links_created, redirects) VALUES(?, ?, ?)
+			ON CONFLICT(day) DO UPDATE SET links_created = links_created + excluded.links_created, redirects = redirects + excluded.redirects`,
+			key, d.links, d.redirects); err != nil {
+			return 0, err
+		}
+	}
+	for code, clicks := range links {
+		if _, err := tx.Exec(`INSERT INTO link_stats(short_code, clicks) VALUES(?, ?)
+			ON CONFLICT(short_code) DO UPDATE SET clicks = clicks + excluded.clicks`, code, clicks); err != nil {
+			return 0, err
+		}
+	}
+	for host, d := range domains {
+		if _, err := tx.Exec(`INSERT INTO domain_stats(domain, links, clicks) VALUES(?, ?, ?)
+			ON CONFLICT(domain) DO UPDATE SET links = links + excluded.links, clicks = clicks + excluded.clicks`,
+			host, d.links, d.clicks); err != nil {
+			return 0, err
+		}
+	}
+	for source, id := range map[string]int64{"urls": lastLink, "clicks": lastClick} {
+		if _, err := tx.Exec(`INSERT INTO rollup_state(source, last_id) VALUES(?, ?)
+			ON CONFLICT(source) DO UPDATE SET last_id = excluded.last_id`, source, id); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return processed, nil
+}
+
+func (r *SQLiteStatsRepo) ResetRollups() error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"rollup_state", "daily_stats", "link_stats", "domain_stats"} {
+		if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func rollupWatermark(tx *sql.Tx, source string) (int64, error) {
+	var id int64
+	err := tx.QueryRow("SELECT last_id FROM rollup_state WHERE source = ?", source).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// destinationHost returns the lower-cased host of a destination URL, or ""
+// when it has none.
+func destinationHost(longURL string) string {
+	u, err := url.Parse(longURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// Totals counts live links directly (deleted links drop out) and sums the
+// rolled up redirects.
+func (r *SQLiteStatsRepo) Totals() (int64, int64, error) {
+	var links, redirects int64
+	err := r.db.QueryRow("SELECT (SELECT COUNT(*) FROM urls), (SELECT COALESCE(SUM(redirects), 0) FROM daily_stats)").Scan(&links, &redirects)
+	return links, redirects, err
+}
+
+// LinksPerDay returns the days since from on which links were created, oldest
+// first. Days without links are omitted.
+func (r *SQLiteStatsRepo) LinksPerDay(from time.Time) ([]shortner.DailyCount, error) {
+	rows, err := r.db.Query("SELECT day, links_created FROM daily_stats WHERE day >= ? AND links_created > 0 ORDER BY day ASC",
+		from.UTC().Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []shortner.DailyCount
+	for rows.Next() {
+		var c shortner.DailyCount
+		if err := rows.Scan(&c.Day, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// TopLinks returns the most clicked links that still exist.
+func (r *SQLiteStatsRepo) TopLinks(limit int) ([]shortner.LinkClicks, error) {
+	rows, err := r.db.Query(`SELECT s.short_code, s.clicks FROM link_stats s
+		JOIN urls u ON u.short_code = s.short_code
+		ORDER BY s.clicks DESC, s.short_code ASC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var top []shortner.LinkClicks
+	for rows.Next() {
+		var lc shortner.LinkClicks
+		if err := rows.Scan(&lc.ShortCode, &lc.Clicks); err != nil {
+			return nil, err
+		}
+		top = append(top, lc)
+	}
+	return top, rows.Err()
+}
+
+// TopDomains returns the destination hosts with the most links.
+func (r *SQLiteStatsRepo) TopDomains(limit int) ([]shortner.DomainStats, error) {
+	rows, err := r.db.Query("SELECT domain, links, clicks FROM domain_stats ORDER BY links DESC, clicks DESC, domain ASC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var top []shortner.DomainStats
+	for rows.Next() {
+		var d shortner.DomainStats
+		if err := rows.Scan(&d.Domain, &d.Links, &d.Clicks); err != nil {
+			return nil, err
+		}
+		top = append(top, d)
+	}
+	return top, rows.Err()
+}
+
+// StorageUsage reports the database file size from its page count and the
+// bytes held by uploaded files and pastes.
+func (r *SQLiteStatsRepo) StorageUsage() (shortner.StorageUsage, error) {
+	var usage shortner.StorageUsage
+	var pageCount, pageSize int64
+	if err := r.db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return usage, err
+	}
+	if err := r.db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return usage, err
+	}
+	usage.DatabaseBytes = pageCount * pageSize
+
+	err := r.db.QueryRow(`SELECT
+		(SELECT COALESCE(SUM(size), 0) FROM files WHERE status = ?),
+		(SELECT COALESCE(SUM(LENGTH(CAST(content AS BLOB))), 0) FROM pastes)`, shortner.FileStatusReady).Scan(&usage.FileBytes, &usage.PasteBytes)
+	return usage, err
+}
+
+func (r *SQLiteStatsRepo) MergeLinks(from []string, to string) (int64, error) {
+	if len(from) == 0 {
+		return 0, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(from)), ", ")
+	args := make([]any, 0, len(from)+1)
+	args = append(args, to)
+	for _, code := range from {
+		args = append(args, code)
+	}
+
+	// One transaction keeps a concurrent rollup from seeing the clicks
+	// moved but their counts not.
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE clicks SET short_code = ? WHERE short_code IN ("+placeholders+")", args...)
+	if err != nil {
+		return 0, err
+	}
+	moved, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	var rolledUp int64
+	if err := tx.QueryRow("SELECT COALESCE(SUM(clicks), 0) FROM link_stats WHERE short_code IN ("+placeholders+")", args[1:]...).Scan(&rolledUp); err != nil {
+		return 0, err
+	}
+	if rolledUp > 0 {
+		if _, err := tx.Exec("INSERT INTO link_stats(short_code, clicks) VALUES(?, ?) ON CONFLICT(short_code) DO UPDATE SET clicks = clicks + excluded.clicks", to, rolledUp); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM link_stats WHERE short_code IN ("+placeholders+")", args[1:]...); err != nil {
+		return 0, err
+	}
+	return moved, tx.Commit()
+}
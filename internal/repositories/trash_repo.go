@@ -0,0 +1,159 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// TrashRepository keeps deleted links until they are restored or purged.
+// A link is stored whole, so a restore brings back every setting.
+type TrashRepository interface {
+	InitSchema() error
+	// AddTrash stores a deleted link, replacing an earlier entry for the
+	// same code.
+	AddTrash(mapping shortner.URLMapping, deletedAt time.Time) error
+	GetTrash(shortCode string) (*shortner.TrashedLink, error)
+	// ListTrash returns entries with an ID below beforeID, newest first;
+	// beforeID 0 starts at the newest.
+	ListTrash(beforeID int64, limit int) ([]shortner.TrashedLink, error)
+	// ListTrashedBefore returns entries deleted before cutoff, oldest first.
+	ListTrashedBefore(cutoff time.Time, limit int) ([]shortner.TrashedLink, error)
+	RemoveTrash(shortCode string) error
+}
+
+type SQLiteTrashRepo struct {
+	fieldCipher
+	db *sql.DB
+}
+
+func NewSQLiteTrashRepo(db *sql.DB) *SQLiteTrashRepo {
+	return &SQLiteTrashRepo{db: db}
+}
+
+func (r *SQLiteTrashRepo) InitSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS link_trash (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		short_code TEXT NOT NULL UNIQUE,
+		link TEXT NOT NULL,
+		deleted_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_link_trash_deleted_at ON link_trash(deleted_at);
+	`
+	_, err := r.db.Exec(schema)
+	if err != nil {
+		log.Printf("Error initializing link trash schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+// trashedMapping is the stored form of a link. URLMapping leaves the stats
+// token out of its JSON, so it is added here.
+type trashedMapping struct {
+	shortner.URLMapping
+	StatsToken string `json:"stats_token,omitempty"`
+}
+
+func (r *SQLiteTrashRepo) AddTrash(mapping shortner.URLMapping, deletedAt time.Time) error {
+	data, err := json.Marshal(trashedMapping{URLMapping: mapping, StatsToken: mapping.StatsToken})
+	if err != nil {
+		return err
+	}
+	link, err := r.seal(string(data))
+	if err != nil {
+		return err
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM link_trash WHERE short_code = ?", mapping.ShortCode); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO link_trash(short_code, link, deleted_at) VALUES(?, ?, ?)", mapping.ShortCode, link, deletedAt.UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const trashColumns = "id, link, deleted_at"
+
+func (r *SQLiteTrashRepo) GetTrash(shortCode string) (*shortner.TrashedLink, error) {
+	entries, err := r.queryTrash("SELECT "+trashColumns+" FROM link_trash WHERE short_code = ?", shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrNotFound
+	}
+	return &entries[0], nil
+}
+
+func (r *SQLiteTrashRepo) ListTrash(beforeID int64, limit int) ([]shortner.TrashedLink, error) {
+	if beforeID <= 0 {
+		return r.queryTrash("SELECT "+trashColumns+" FROM link_trash ORDER BY id DESC LIMIT ?", limit)
+	}
+	return r.queryTrash("SELECT "+trashColumns+" FROM link_trash WHERE id < ? ORDER BY id DESC LIMIT ?", beforeID, limit)
+}
+
+func (r *SQLiteTrashRepo) ListTrashedBefore(cutoff time.Time, limit int) ([]shortner.TrashedLink, error) {
+	return r.queryTrash("SELECT "+trashColumns+" FROM link_trash WHERE deleted_at < ? ORDER BY deleted_at ASC, id ASC LIMIT ?", cutoff.UTC(), limit)
+}
+
+func (r *SQLiteTrashRepo) RemoveTrash(shortCode string) error {
+	res, err := r.db.Exec("DELETE FROM link_trash WHERE short_code = ?", shortCode)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteTrashRepo) queryTrash(query string, args ...any) ([]shortner.TrashedLink, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []shortner.TrashedLink
+	for rows.Next() {
+		var entry shortner.TrashedLink
+		var link string
+		if err := rows.Scan(&entry.ID, &link, &entry.DeletedAt); err != nil {
+			return nil, err
+		}
+		if link, err = r.open(link); err != nil {
+			return nil, err
+		}
+		var stored trashedMapping
+		if err := json.Unmarshal([]byte(link), &stored); err != nil {
+			return nil, err
+		}
+		entry.Link = stored.URLMapping
+		entry.Link.StatsToken = stored.StatsToken
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Reencrypt rewrites every trashed link not yet encrypted under the primary
+// key.
+func (r *SQLiteTrashRepo) Reencrypt(batch int) (int, error) {
+	if r.cipher == nil {
+		return 0, errors.New("encryption is not enabled")
+	}
+	return reencryptColumns(r.db, r.cipher, "link_trash", "id", []string{"link"}, batch, func(key any, _, sealed []string) error {
+		_, err := r.db.Exec("UPDATE link_trash SET link = ? WHERE id = ?", sealed[0], key)
+		return err
+	})
+}
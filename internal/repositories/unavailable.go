@@ -0,0 +1,22 @@
+package repositories
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+)
+
+// Unavailable reports whether err means the database could not be reached
+// or written at all, rather than that the query was wrong: the file cannot
+// be opened or read, it is full or read-only, it stays locked, or the
+// connection is gone. Callers degrade on such errors instead of failing,
+// since retrying later helps.
+func Unavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, sql.ErrConnDone) || errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	return sqliteUnavailable(err)
+}
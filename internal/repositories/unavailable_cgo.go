@@ -0,0 +1,22 @@
+//go:build cgo
+
+package repositories
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteUnavailable reports whether err is a SQLite error Unavailable
+// counts.
+func sqliteUnavailable(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code {
+		case sqlite3.ErrBusy, sqlite3.ErrLocked, sqlite3.ErrCantOpen, sqlite3.ErrIoErr, sqlite3.ErrFull, sqlite3.ErrReadonly:
+			return true
+		}
+	}
+	return false
+}
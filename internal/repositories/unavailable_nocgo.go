@@ -0,0 +1,9 @@
+//go:build !cgo
+
+package repositories
+
+// sqliteUnavailable is always false without cgo: the SQLite driver is then
+// a stub that cannot open a database, so there are no SQLite errors.
+func sqliteUnavailable(err error) bool {
+	return false
+}
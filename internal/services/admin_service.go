@@ -0,0 +1,122 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	rollupBatchSize     = 5000
+	defaultOverviewDays = 30
+	maxOverviewDays     = 365
+	defaultOverviewTop  = 10
+	maxOverviewTop      = 100
+)
+
+// AdminService builds the system-wide overview for the ops dashboard from
+// the rollup tables. The stats_rollups job keeps the rollups current and
+// Overview catches up on anything newer before reading them.
+type AdminService interface {
+	Overview(days, top int) (*shortner.Overview, error)
+	RefreshRollups() error
+}
+
+type adminSvc struct {
+	determinism
+	stats repositories.StatsRepository
+	// mu serializes rollup runs so two of them never fold in the same rows.
+	mu sync.Mutex
+}
+
+func NewAdminService(stats repositories.StatsRepository) AdminService {
+	return &adminSvc{stats: stats}
+}
+
+func (s *adminSvc) Overview(days, top int) (*shortner.Overview, error) {
+	if days == 0 {
+		days = defaultOverviewDays
+	}
+	if days < 1 || days > maxOverviewDays {
+		return nil, validationError("days", fmt.Sprintf("days must be between 1 and %d", maxOverviewDays))
+	}
+	if top == 0 {
+		top = defaultOverviewTop
+	}
+	if top < 1 || top > maxOverviewTop {
+		return nil, validationError("top", fmt.Sprintf("top must be between 1 and %d", maxOverviewTop))
+	}
+
+	if err := s.RefreshRollups(); err != nil {
+		return nil, err
+	}
+
+	now := s.now().UTC()
+	overview := &shortner.Overview{GeneratedAt: now}
+	var err error
+	if overview.TotalLinks, overview.TotalRedirects, err = s.stats.Totals(); err != nil {
+		return nil, fmt.Errorf("service failed to count links: %w", err)
+	}
+
+	from := now.AddDate(0, 0, 1-days)
+	perDay, err := s.stats.LinksPerDay(from)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to load daily link counts: %w", err)
+	}
+	overview.LinksPerDay = fillDays(perDay, from, days)
+
+	if overview.TopLinks, err = s.stats.TopLinks(top); err != nil {
+		return nil, fmt.Errorf("service failed to load top links: %w", err)
+	}
+	if overview.TopDomains, err = s.stats.TopDomains(top); err != nil {
+		return nil, fmt.Errorf("service failed to load top domains: %w", err)
+	}
+	if overview.TopLinks == nil {
+		overview.TopLinks = []shortner.LinkClicks{}
+	}
+	if overview.TopDomains == nil {
+		overview.TopDomains = []shortner.DomainStats{}
+	}
+
+	if overview.Storage, err = s.stats.StorageUsage(); err != nil {
+		return nil, fmt.Errorf("service failed to measure storage: %w", err)
+	}
+	return overview, nil
+}
+
+// fillDays returns one entry per day starting at from, with zero for the
+// days missing from counts.
+func fillDays(counts []shortner.DailyCount, from time.Time, days int) []shortner.DailyCount {
+	byDay := make(map[string]int64, len(counts))
+	for _, c := range counts {
+		byDay[c.Day] = c.Count
+	}
+	filled := make([]shortner.DailyCount, days)
+	for i := range filled {
+		day := from.AddDate(0, 0, i).Format("2006-01-02")
+		filled[i] = shortner.DailyCount{Day: day, Count: byDay[day]}
+	}
+	return filled
+}
+
+// RefreshRollups folds every link and click created since the last run into
+// the rollup tables, one batch at a time.
+func (s *adminSvc) RefreshRollups() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		n, err := s.stats.Rollup(rollupBatchSize)
+		if err != nil {
+			log.Printf("Service error updating stats rollups: %v", err)
+			return fmt.Errorf("service failed to update stats rollups: %w", err)
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
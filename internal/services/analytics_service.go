@@ -0,0 +1,344 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"template/internal/pkg/batch"
+	"template/internal/pkg/featureflags"
+	"template/internal/pkg/tasks"
+	"template/internal/pkg/wal"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+type AnalyticsService interface {
+	RecordClick(click shortner.Click) error
+	// EnqueueClick records the click in the background so that analytics
+	// never delay a redirect.
+	EnqueueClick(click shortner.Click)
+	// Stop writes the clicks still waiting for their batch. Clicks enqueued
+	// afterwards are written one by one.
+	Stop()
+	ListClicksSince(afterID int64, limit int) ([]shortner.Click, error)
+	ListLinkClicks(shortCode string, afterID int64, limit int) ([]shortner.Click, error)
+	ListClicksBetween(codes []string, from, to time.Time, afterID int64, limit int) ([]shortner.Click, error)
+	TopLinks(codes []string, from, to time.Time, limit int) ([]shortner.LinkClicks, int64, error)
+	CountPerPeriod(codes []string, from, to time.Time, interval string) ([]shortner.PeriodClicks, error)
+}
+
+type analyticsSvc struct {
+	determinism
+	repo   repositories.ClickRepository
+	events EventPublisher
+	flags  *featureflags.Set
+	pool   *tasks.Pool
+	dedup  *clickDeduper
+	batch  *batch.Batcher[shortner.Click]
+	buffer *clickBuffer
+	log    *clickLog
+
+	countPrefetches bool
+}
+
+// AnalyticsOptions decide which clicks are counted. With a positive
+// DedupWindow, a click from the same IP and user agent on the same link
+// within DedupWindow of a counted one is not recorded, so reloads do not
+// inflate counts. Prefetches and link preview fetches are only recorded
+// with CountPrefetches.
+//
+// With a positive FlushInterval, enqueued clicks are written in batches of
+// up to BatchSize, one transaction each, at least every FlushInterval;
+// otherwise every click is written on its own.
+//
+// With a positive BufferSize, clicks that cannot be written because the
+// database is unavailable are kept in memory, up to BufferSize, and written
+// again every BufferRetry (5s when zero) until it answers.
+//
+// With a Log, enqueued clicks are written to it before they are stored,
+// and clicks lost to a crash or an outage are replayed from it at start
+// and every BufferRetry; the log then takes the place of the buffer for
+// them.
+type AnalyticsOptions struct {
+	DedupWindow     time.Duration
+	CountPrefetches bool
+	BatchSize       int
+	FlushInterval   time.Duration
+	BufferSize      int
+	BufferRetry     time.Duration
+	Log             *wal.Log
+}
+
+const (
+	defaultClickBatchSize   = 100
+	defaultClickBufferRetry = 5 * time.Second
+	clickEventIDLength      = 24
+)
+
+func NewAnalyticsService(repo repositories.ClickRepository, events EventPublisher, flags *featureflags.Set, pool *tasks.Pool, opts AnalyticsOptions) AnalyticsService {
+	if events == nil {
+		events = noopPublisher{}
+	}
+	s := &analyticsSvc{repo: repo, events: events, flags: flags, pool: pool, countPrefetches: opts.CountPrefetches}
+	if opts.DedupWindow > 0 {
+		s.dedup = newClickDeduper(opts.DedupWindow)
+	}
+	if opts.FlushInterval > 0 {
+		if opts.BatchSize <= 0 {
+			opts.BatchSize = defaultClickBatchSize
+		}
+		s.batch = batch.New(opts.BatchSize, opts.FlushInterval, s.submitBatch)
+	}
+	if opts.BufferRetry <= 0 {
+		opts.BufferRetry = defaultClickBufferRetry
+	}
+	if opts.BufferSize > 0 {
+		s.buffer = newClickBuffer(opts.BufferSize, opts.BufferRetry, s.writeBuffered)
+	}
+	if opts.Log != nil {
+		s.log = newClickLog(opts.Log, opts.BufferRetry, s.writeBuffered)
+	}
+	return s
+}
+
+// admit decides whether click is counted and prepares it for storage.
+func (s *analyticsSvc) admit(click shortner.Click) (shortner.Click, bool) {
+	if click.ClickedAt.IsZero() {
+		click.ClickedAt = s.now()
+	}
+	if click.Prefetch && !s.countPrefetches {
+		return click, false
+	}
+	if s.dedup != nil && s.dedup.duplicate(click) {
+		return click, false
+	}
+	if s.flags.Enabled(featureflags.AnalyticsV2, click.ShortCode) {
+		click.Referer = refererOrigin(click.Referer)
+	}
+	return click, true
+}
+
+func (s *analyticsSvc) RecordClick(click shortner.Click) error {
+	click, ok := s.admit(click)
+	if !ok {
+		return nil
+	}
+	return s.store(click)
+}
+
+func (s *analyticsSvc) store(click shortner.Click) error {
+	id, err := s.repo.RecordClick(click)
+	if err != nil {
+		if s.hold(err, click) {
+			return nil
+		}
+		if s.dedup != nil {
+			s.dedup.forget(click)
+		}
+		log.Printf("Service error recording click for code '%s': %v", click.ShortCode, err)
+		return fmt.Errorf("service failed to record click: %w", err)
+	}
+	s.stored(click)
+	s.created(click, id)
+	return nil
+}
+
+// created publishes click as stored under id, unless it was logged and
+// had been stored before.
+func (s *analyticsSvc) created(click shortner.Click, id int64) {
+	if id == 0 && click.EventID != "" {
+		return
+	}
+	click.ID = id
+	s.events.Publish(EventClickCreated, click)
+}
+
+func (s *analyticsSvc) EnqueueClick(click shortner.Click) {
+	if click.ClickedAt.IsZero() {
+		click.ClickedAt = s.now()
+	}
+	click, ok := s.admit(click)
+	if !ok {
+		return
+	}
+	click = s.logAhead(click)
+	if s.batch == nil {
+		s.pool.Submit("click on "+click.ShortCode, func() error { return s.store(click) })
+		return
+	}
+	s.batch.Add(click)
+}
+
+// logAhead gives click an EventID and writes it to the click log, when
+// there is one.
+func (s *analyticsSvc) logAhead(click shortner.Click) shortner.Click {
+	if s.log == nil {
+		return click
+	}
+	id, err := s.random().RandomString(clickEventIDLength)
+	if err != nil {
+		log.Printf("Service error generating a click event ID: %v", err)
+		return click
+	}
+	click.EventID = id
+	s.log.append(click)
+	return click
+}
+
+// stored acknowledges logged clicks once they are stored.
+func (s *analyticsSvc) stored(clicks ...shortner.Click) {
+	if s.log != nil {
+		s.log.settle(clicks, true)
+	}
+}
+
+func (s *analyticsSvc) Stop() {
+	if s.batch != nil {
+		s.batch.Stop()
+	}
+	if s.buffer != nil {
+		s.buffer.stop()
+	}
+	if s.log != nil {
+		s.log.stop()
+	}
+}
+
+// hold keeps clicks that could not be written because of err, when err
+// means the database is unavailable: logged clicks are left to replay from
+// the click log, the others are buffered when buffering is on.
+func (s *analyticsSvc) hold(err error, clicks ...shortner.Click) bool {
+	if !repositories.Unavailable(err) {
+		return false
+	}
+	if s.log != nil {
+		if clicks = s.log.settle(clicks, false); len(clicks) == 0 {
+			return true
+		}
+	}
+	if s.buffer == nil {
+		return false
+	}
+	s.buffer.add(clicks...)
+	return true
+}
+
+// writeBuffered writes clicks taken from the buffer, in one transaction
+// when the repository allows it, and returns how many were written.
+func (s *analyticsSvc) writeBuffered(clicks []shortner.Click) (int, error) {
+	if writer, ok := s.repo.(repositories.ClickBatchWriter); ok {
+		ids, err := writer.RecordClicks(clicks)
+		if err != nil {
+			return 0, err
+		}
+		for i, click := range clicks {
+			s.created(click, ids[i])
+		}
+		return len(clicks), nil
+	}
+	for i, click := range clicks {
+		id, err := s.repo.RecordClick(click)
+		if err != nil {
+			return i, err
+		}
+		s.created(click, id)
+	}
+	return len(clicks), nil
+}
+
+// submitBatch writes a full or timed-out batch on the click pool, which
+// retries it as a whole if the transaction fails.
+func (s *analyticsSvc) submitBatch(clicks []shortner.Click) {
+	if len(clicks) == 1 {
+		click := clicks[0]
+		s.pool.Submit("click on "+click.ShortCode, func() error { return s.store(click) })
+		return
+	}
+	s.pool.Submit(fmt.Sprintf("batch of %d clicks", len(clicks)), func() error { return s.storeBatch(clicks) })
+}
+
+// storeBatch writes clicks in one transaction when the repository allows
+// it and one by one otherwise. Clicks written one by one are not retried,
+// since retrying the batch would count the stored ones twice.
+func (s *analyticsSvc) storeBatch(clicks []shortner.Click) error {
+	writer, ok := s.repo.(repositories.ClickBatchWriter)
+	if !ok {
+		failed := 0
+		for _, click := range clicks {
+			if err := s.store(click); err != nil {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return tasks.Permanent(fmt.Errorf("%d of %d clicks could not be recorded", failed, len(clicks)))
+		}
+		return nil
+	}
+	ids, err := writer.RecordClicks(clicks)
+	if err != nil {
+		if s.hold(err, clicks...) {
+			return nil
+		}
+		log.Printf("Service error recording a batch of %d clicks: %v", len(clicks), err)
+		return fmt.Errorf("service failed to record clicks: %w", err)
+	}
+	s.stored(clicks...)
+	for i, click := range clicks {
+		s.created(click, ids[i])
+	}
+	return nil
+}
+
+// refererOrigin reduces a referrer to scheme://host, dropping the path and
+// query string; anything that is not an absolute URL is dropped entirely.
+func refererOrigin(referer string) string {
+	u, err := url.Parse(referer)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func (s *analyticsSvc) ListClicksSince(afterID int64, limit int) ([]shortner.Click, error) {
+	clicks, err := s.repo.ListSince(afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list clicks: %w", err)
+	}
+	return clicks, nil
+}
+
+func (s *analyticsSvc) ListLinkClicks(shortCode string, afterID int64, limit int) ([]shortner.Click, error) {
+	clicks, err := s.repo.ListForLink(shortCode, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list clicks: %w", err)
+	}
+	return clicks, nil
+}
+
+func (s *analyticsSvc) ListClicksBetween(codes []string, from, to time.Time, afterID int64, limit int) ([]shortner.Click, error) {
+	clicks, err := s.repo.ListBetween(codes, from, to, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list clicks: %w", err)
+	}
+	return clicks, nil
+}
+
+// TopLinks returns the most clicked links in [from, to) and the total number
+// of clicks, restricted to codes unless it is empty.
+func (s *analyticsSvc) TopLinks(codes []string, from, to time.Time, limit int) ([]shortner.LinkClicks, int64, error) {
+	top, total, err := s.repo.TopLinks(codes, from, to, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("service failed to count clicks: %w", err)
+	}
+	return top, total, nil
+}
+
+func (s *analyticsSvc) CountPerPeriod(codes []string, from, to time.Time, interval string) ([]shortner.PeriodClicks, error) {
+	counts, err := s.repo.CountPerPeriod(codes, from, to, interval)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to count clicks: %w", err)
+	}
+	return counts, nil
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"template/internal/pkg/tasks"
+	"template/internal/pkg/wal"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+// recordingPublisher remembers the events it was asked to publish.
+type recordingPublisher struct{ payloads []any }
+
+func (p *recordingPublisher) Publish(event string, payload any) {
+	p.payloads = append(p.payloads, payload)
+}
+
+func TestEnqueuedClicksAreBatched(t *testing.T) {
+	clicks := repositories.NewSQLiteClickRepo(openTestDB(t))
+	if err := clicks.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	pool := tasks.New("clicks", tasks.Options{Workers: 1})
+	events := &recordingPublisher{}
+	// The interval is long enough that only a full batch or Stop flushes.
+	s := NewAnalyticsService(clicks, events, nil, pool, AnalyticsOptions{BatchSize: 3, FlushInterval: time.Hour})
+
+	stored := func() int {
+		t.Helper()
+		list, err := clicks.ListSince(0, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(list)
+	}
+	for i := 0; i < 4; i++ {
+		s.EnqueueClick(shortner.Click{ShortCode: "abc", ClickedAt: testNow})
+	}
+	// Let the worker write the full batch; the fourth click keeps waiting.
+	for deadline := time.Now().Add(5 * time.Second); stored() < 3 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := stored(); n != 3 {
+		t.Fatalf("%d clicks stored before the flush, want the full batch of 3", n)
+	}
+
+	s.Stop()
+	pool.Stop()
+	if n := stored(); n != 4 {
+		t.Errorf("%d clicks stored after Stop, want all 4", n)
+	}
+	if len(events.payloads) != 4 {
+		t.Fatalf("published %d click events, want 4", len(events.payloads))
+	}
+	if last := events.payloads[3].(shortner.Click); last.ID != 4 {
+		t.Errorf("last event carries click id %d, want 4", last.ID)
+	}
+}
+
+// flakyClickRepo fails every write as an unavailable database while down,
+// with a lost connection, which repositories.Unavailable counts with or
+// without the cgo SQLite driver.
+type flakyClickRepo struct {
+	repositories.ClickRepository
+	down atomic.Bool
+}
+
+func (r *flakyClickRepo) RecordClick(click shortner.Click) (int64, error) {
+	if r.down.Load() {
+		return 0, fmt.Errorf("recording click: %w", driver.ErrBadConn)
+	}
+	return r.ClickRepository.RecordClick(click)
+}
+
+func TestClicksAreBufferedWhileTheDatabaseIsDown(t *testing.T) {
+	sqlite := repositories.NewSQLiteClickRepo(openTestDB(t))
+	if err := sqlite.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	clicks := &flakyClickRepo{ClickRepository: sqlite}
+	clicks.down.Store(true)
+	pool := tasks.New("clicks", tasks.Options{Workers: 1})
+	defer pool.Stop()
+	events := &recordingPublisher{}
+	// Only Stop retries: the interval is too long to come up in the test.
+	s := NewAnalyticsService(clicks, events, nil, pool, AnalyticsOptions{BufferSize: 2, BufferRetry: time.Hour})
+
+	for _, code := range []string{"a", "b", "c"} {
+		if err := s.RecordClick(shortner.Click{ShortCode: code, ClickedAt: testNow}); err != nil {
+			t.Fatalf("click on %s: %v", code, err)
+		}
+	}
+	if len(events.payloads) != 0 {
+		t.Fatalf("published %d events while the database was down", len(events.payloads))
+	}
+
+	clicks.down.Store(false)
+	s.Stop()
+	list, err := sqlite.ListSince(0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The buffer holds two clicks, so the oldest one was dropped.
+	if len(list) != 2 || list[0].ShortCode != "b" || list[1].ShortCode != "c" {
+		t.Fatalf("stored %+v, want the clicks on b and c", list)
+	}
+	if len(events.payloads) != 2 {
+		t.Errorf("published %d click events, want 2", len(events.payloads))
+	}
+}
+
+func TestLoggedClicksAreReplayedOnce(t *testing.T) {
+	sqlite := repositories.NewSQLiteClickRepo(openTestDB(t))
+	if err := sqlite.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	clicks := &flakyClickRepo{ClickRepository: sqlite}
+	stored := func() []shortner.Click {
+		t.Helper()
+		list, err := sqlite.ListSince(0, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+	waitStored := func(n int) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); len(stored()) < n && time.Now().Before(deadline); {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	dir := t.TempDir()
+
+	// The first run stores the click on a, then the database goes down.
+	clickLog, err := wal.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := tasks.New("clicks", tasks.Options{Workers: 1})
+	s := NewAnalyticsService(clicks, nil, nil, pool, AnalyticsOptions{Log: clickLog, BufferRetry: time.Hour})
+	s.EnqueueClick(shortner.Click{ShortCode: "a", ClickedAt: testNow})
+	waitStored(1)
+	clicks.down.Store(true)
+	s.EnqueueClick(shortner.Click{ShortCode: "b", ClickedAt: testNow})
+	s.EnqueueClick(shortner.Click{ShortCode: "c", ClickedAt: testNow})
+	pool.Stop()
+	s.Stop()
+	if err := clickLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next run finds the database back and replays the whole log.
+	clicks.down.Store(false)
+	if clickLog, err = wal.Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer clickLog.Close()
+	events := &recordingPublisher{}
+	s = NewAnalyticsService(clicks, events, nil, nil, AnalyticsOptions{Log: clickLog, BufferRetry: time.Hour})
+	waitStored(3)
+	s.Stop()
+
+	list := stored()
+	if len(list) != 3 || list[0].ShortCode != "a" || list[1].ShortCode != "b" || list[2].ShortCode != "c" {
+		t.Fatalf("stored %+v, want the clicks on a, b and c once each", list)
+	}
+	if len(events.payloads) != 2 {
+		t.Errorf("published %d click events on replay, want 2 for the clicks not stored before", len(events.payloads))
+	}
+}
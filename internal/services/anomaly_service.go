@@ -0,0 +1,170 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"template/internal/pkg/mailer"
+	"template/internal/pkg/tasks"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+// anomalyMaxLinks is how many of the busiest links of a window are checked
+// for spikes; a spike that does not make the top is not worth an alert.
+const anomalyMaxLinks = 500
+
+// AnomalyService flags links whose clicks spike far above their usual rate,
+// which may be a link going viral or a bot hammering it, and alerts about
+// them through the link.anomaly webhook event and by email.
+type AnomalyService interface {
+	// Detect checks the clicks of the window ending at now and returns the
+	// spikes it flagged. A link is flagged at most once per cooldown.
+	Detect(now time.Time) ([]shortner.ClickAnomaly, error)
+	ListAnomalies(beforeID int64, limit int) ([]shortner.ClickAnomaly, error)
+}
+
+// AnomalyOptions are the operator's spike thresholds. The clicks on a link
+// in the last Window are compared with its rate over the Baseline before
+// that window: a link with at least MinClicks clicks in the window, Factor
+// times or more what the rate predicts, is flagged, then left alone for
+// Cooldown. Links may override Factor and MinClicks; a Factor of 0 turns
+// detection off for links that do not. Alerts are emailed to AlertEmails.
+type AnomalyOptions struct {
+	Window      time.Duration
+	Baseline    time.Duration
+	Cooldown    time.Duration
+	Factor      float64
+	MinClicks   int64
+	AlertEmails []string
+}
+
+type anomalySvc struct {
+	determinism
+	repo      repositories.AnomalyRepository
+	links     ShortenerService
+	analytics AnalyticsService
+	events    EventPublisher
+	mailer    mailer.Mailer
+	pool      *tasks.Pool
+	baseURL   string
+	opts      AnomalyOptions
+}
+
+// NewAnomalyService sends alert emails with m on pool, which retries
+// failed deliveries.
+func NewAnomalyService(repo repositories.AnomalyRepository, links ShortenerService, analytics AnalyticsService, events EventPublisher, m mailer.Mailer, pool *tasks.Pool, baseURL string, opts AnomalyOptions) AnomalyService {
+	if events == nil {
+		events = noopPublisher{}
+	}
+	return &anomalySvc{
+		repo:      repo,
+		links:     links,
+		analytics: analytics,
+		events:    events,
+		mailer:    m,
+		pool:      pool,
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		opts:      opts,
+	}
+}
+
+func (s *anomalySvc) Detect(now time.Time) ([]shortner.ClickAnomaly, error) {
+	windowStart := now.Add(-s.opts.Window)
+	recent, _, err := s.analytics.TopLinks(nil, windowStart, now, anomalyMaxLinks)
+	if err != nil || len(recent) == 0 {
+		return nil, err
+	}
+	codes := make([]string, len(recent))
+	for i, link := range recent {
+		codes[i] = link.ShortCode
+	}
+	past, _, err := s.analytics.TopLinks(codes, windowStart.Add(-s.opts.Baseline), windowStart, len(codes))
+	if err != nil {
+		return nil, err
+	}
+	baseline := make(map[string]int64, len(past))
+	for _, link := range past {
+		baseline[link.ShortCode] = link.Clicks
+	}
+	lastDetected, err := s.repo.LastDetected(codes)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to load past anomalies: %w", err)
+	}
+
+	var anomalies []shortner.ClickAnomaly
+	for _, link := range recent {
+		if last, ok := lastDetected[link.ShortCode]; ok && now.Sub(last) < s.opts.Cooldown {
+			continue
+		}
+		mapping, err := s.links.GetLink(link.ShortCode)
+		if errors.Is(err, repositories.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return anomalies, err
+		}
+		factor, minClicks := s.thresholds(mapping)
+		expected := float64(baseline[link.ShortCode]) * float64(s.opts.Window) / float64(s.opts.Baseline)
+		if factor <= 0 || link.Clicks < minClicks || float64(link.Clicks) < factor*expected {
+			continue
+		}
+
+		anomaly := shortner.ClickAnomaly{
+			ShortCode:   mapping.ShortCode,
+			Clicks:      link.Clicks,
+			Expected:    expected,
+			Factor:      factor,
+			WindowStart: windowStart,
+			DetectedAt:  now,
+		}
+		if anomaly.ID, err = s.repo.RecordAnomaly(anomaly); err != nil {
+			return anomalies, fmt.Errorf("service failed to save anomaly: %w", err)
+		}
+		log.Printf("Service flagged a click spike on %s: %d clicks in %s, %.1f expected", anomaly.ShortCode, anomaly.Clicks, s.opts.Window, anomaly.Expected)
+		s.alert(anomaly)
+		anomalies = append(anomalies, anomaly)
+	}
+	return anomalies, nil
+}
+
+// thresholds returns the spike factor and minimum clicks that apply to
+// mapping.
+func (s *anomalySvc) thresholds(mapping *shortner.URLMapping) (float64, int64) {
+	factor, minClicks := s.opts.Factor, s.opts.MinClicks
+	if mapping.SpikeFactor != 0 {
+		factor = mapping.SpikeFactor
+	}
+	if mapping.SpikeMinClicks != 0 {
+		minClicks = mapping.SpikeMinClicks
+	}
+	return factor, minClicks
+}
+
+func (s *anomalySvc) alert(anomaly shortner.ClickAnomaly) {
+	s.events.Publish(EventLinkAnomaly, anomaly)
+	if len(s.opts.AlertEmails) == 0 {
+		return
+	}
+	subject := fmt.Sprintf("Click spike on %s/%s", s.baseURL, anomaly.ShortCode)
+	body := fmt.Sprintf("%s/%s got %d clicks between %s and %s, where its usual rate predicts %.1f.\n\n"+
+		"This may be the link spreading quickly, or a bot. The clicks are listed at %s/api/v1/links/%s/clicks.\n",
+		s.baseURL, anomaly.ShortCode, anomaly.Clicks, anomaly.WindowStart.UTC().Format(time.RFC3339), anomaly.DetectedAt.UTC().Format(time.RFC3339),
+		anomaly.Expected, s.baseURL, anomaly.ShortCode)
+	for _, to := range s.opts.AlertEmails {
+		s.pool.Submit(fmt.Sprintf("anomaly %d alert to %s", anomaly.ID, to), func() error {
+			return s.mailer.Send(to, subject, body)
+		})
+	}
+}
+
+func (s *anomalySvc) ListAnomalies(beforeID int64, limit int) ([]shortner.ClickAnomaly, error) {
+	anomalies, err := s.repo.ListAnomalies(beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list anomalies: %w", err)
+	}
+	return anomalies, nil
+}
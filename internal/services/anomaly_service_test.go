@@ -0,0 +1,148 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"template/internal/pkg/tasks"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+// recordingMailer remembers the messages it was asked to send.
+type recordingMailer struct {
+	mu     sync.Mutex
+	to     []string
+	bodies []string
+}
+
+func (m *recordingMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.to = append(m.to, to)
+	m.bodies = append(m.bodies, subject+"\n"+body)
+	return nil
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	db := openTestDB(t)
+	links := sqliteShortener(t, db)
+	clicks := repositories.NewSQLiteClickRepo(db)
+	anomalies := repositories.NewSQLiteAnomalyRepo(db)
+	for _, repo := range []interface{ InitSchema() error }{clicks, anomalies} {
+		if err := repo.InitSchema(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, link := range []shortner.URLMapping{
+		{ShortCode: "viral", LongURL: "https://example.com/v"},
+		{ShortCode: "steady", LongURL: "https://example.com/s"},
+		{ShortCode: "quiet", LongURL: "https://example.com/q"},
+		{ShortCode: "custom", LongURL: "https://example.com/c", SpikeMinClicks: 3},
+		{ShortCode: "muted", LongURL: "https://example.com/m", SpikeFactor: -1},
+	} {
+		if _, err := links.repo.CreateMapping(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := testNow
+	record := func(code string, n int, start time.Time, span time.Duration) {
+		t.Helper()
+		batch := make([]shortner.Click, n)
+		for i := range batch {
+			batch[i] = shortner.Click{ShortCode: code, ClickedAt: start.Add(span * time.Duration(i) / time.Duration(n))}
+		}
+		if _, err := clicks.RecordClicks(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The window is the last hour, the baseline the ten hours before it.
+	window, baseline := now.Add(-time.Hour), now.Add(-11*time.Hour)
+	record("viral", 5, baseline, 10*time.Hour)
+	record("viral", 60, window, time.Hour)
+	record("steady", 200, baseline, 10*time.Hour)
+	record("steady", 60, window, time.Hour)
+	record("quiet", 5, window, time.Hour)
+	record("custom", 5, window, time.Hour)
+	record("muted", 60, window, time.Hour)
+
+	events := &recordingPublisher{}
+	mail := &recordingMailer{}
+	pool := tasks.New("mail", tasks.Options{Workers: 1})
+	s := NewAnomalyService(anomalies, links, NewAnalyticsService(clicks, nil, nil, nil, AnalyticsOptions{}), events, mail, pool, "https://sho.rt", AnomalyOptions{
+		Window:      time.Hour,
+		Baseline:    10 * time.Hour,
+		Cooldown:    24 * time.Hour,
+		Factor:      5,
+		MinClicks:   50,
+		AlertEmails: []string{"ops@example.com"},
+	})
+
+	found, err := s.Detect(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flagged []string
+	for _, anomaly := range found {
+		flagged = append(flagged, anomaly.ShortCode)
+	}
+	slices.Sort(flagged)
+	if got := fmt.Sprint(flagged); got != "[custom viral]" {
+		t.Errorf("flagged %s, want [custom viral]", got)
+	}
+	for _, anomaly := range found {
+		if anomaly.ShortCode == "viral" && (anomaly.Clicks != 60 || anomaly.Expected != 0.5 || anomaly.Factor != 5 || !anomaly.WindowStart.Equal(window)) {
+			t.Errorf("viral anomaly = %+v, want 60 clicks against 0.5 expected", anomaly)
+		}
+	}
+	if len(events.payloads) != 2 {
+		t.Errorf("published %d events, want 2", len(events.payloads))
+	}
+	pool.Stop()
+	if got := fmt.Sprint(mail.to); got != "[ops@example.com ops@example.com]" {
+		t.Errorf("alerts emailed to %s, want two to ops@example.com", got)
+	}
+
+	again, err := s.Detect(now.Add(30 * time.Minute))
+	if err != nil || len(again) != 0 {
+		t.Errorf("Detect within the cooldown = %+v, %v, want nothing", again, err)
+	}
+	listed, err := s.ListAnomalies(0, 10)
+	if err != nil || len(listed) != 2 || listed[0].ID < listed[1].ID {
+		t.Errorf("ListAnomalies = %+v, %v, want both, newest first", listed, err)
+	}
+	if older, _ := s.ListAnomalies(listed[0].ID, 10); len(older) != 1 || older[0].ID != listed[1].ID {
+		t.Errorf("ListAnomalies before the newest = %+v, want the older one", older)
+	}
+}
+
+func TestUpdateSpikeThresholds(t *testing.T) {
+	s := sqliteShortener(t, openTestDB(t))
+	code, err := s.CreateShortURL("https://example.com/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	factor, minClicks := 10.0, int64(500)
+	if err := s.UpdateLink(code, shortner.LinkUpdate{SpikeFactor: &factor, SpikeMinClicks: &minClicks}); err != nil {
+		t.Fatal(err)
+	}
+	link, err := s.GetLink(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.SpikeFactor != 10 || link.SpikeMinClicks != 500 {
+		t.Errorf("thresholds = %v, %d, want 10, 500", link.SpikeFactor, link.SpikeMinClicks)
+	}
+
+	low, negative := 0.5, int64(-1)
+	if err := s.UpdateLink(code, shortner.LinkUpdate{SpikeFactor: &low}); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("spike_factor 0.5: error = %v, want a validation error", err)
+	}
+	if err := s.UpdateLink(code, shortner.LinkUpdate{SpikeMinClicks: &negative}); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("spike_min_clicks -1: error = %v, want a validation error", err)
+	}
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	apiKeyPrefix       = "sk_"
+	apiKeySecretLength = 40
+	maxAPIKeyNameBytes = 200
+	// apiKeyUsageInterval is how stale the recorded last use of a key may
+	// get, so that a busy key is not written on every request.
+	apiKeyUsageInterval = time.Minute
+	// DefaultAPIKeyGracePeriod is how long the secret a rotation replaces
+	// keeps working unless the rotation says otherwise.
+	DefaultAPIKeyGracePeriod = 24 * time.Hour
+	maxAPIKeyGracePeriod     = 30 * 24 * time.Hour
+)
+
+// APIKeyService manages the API keys operators provision under IDs of their
+// choice. A key is accepted on the routes its scopes cover, and never by
+// the provisioning API itself.
+type APIKeyService interface {
+	// ListAPIKeys returns the keys by ID, without their secrets.
+	ListAPIKeys() ([]shortner.APIKey, error)
+	GetAPIKey(id string) (*shortner.APIKey, error)
+	// PutAPIKey creates the key id, or changes its name, scopes and expiry
+	// to those of spec; created reports which. Nil scopes keep those of an
+	// existing key and give a new one the admin scope. The creator of spec
+	// is only recorded for a new key. Only a created key carries its
+	// secret.
+	PutAPIKey(id string, spec shortner.APIKey) (key *shortner.APIKey, created bool, err error)
+	// RotateAPIKey gives the key id a new secret, which it carries, and
+	// keeps the secret it replaces working for gracePeriod. expiresAt,
+	// when set, replaces the expiry of the key.
+	RotateAPIKey(id string, gracePeriod time.Duration, expiresAt *time.Time) (*shortner.APIKey, error)
+	DeleteAPIKey(id string) error
+	// Authenticate returns the key whose secret, or previous secret during
+	// its grace period, is secret, or ErrAPIKeyInvalid, also once the key
+	// expired. It records that the key was used.
+	Authenticate(secret string) (*shortner.APIKey, error)
+}
+
+var ErrAPIKeyInvalid = errors.New("invalid API key")
+
+type apiKeySvc struct {
+	determinism
+	repo repositories.APIKeyRepository
+}
+
+func NewAPIKeyService(repo repositories.APIKeyRepository) APIKeyService {
+	return &apiKeySvc{repo: repo}
+}
+
+func (s *apiKeySvc) ListAPIKeys() ([]shortner.APIKey, error) {
+	keys, err := s.repo.ListAPIKeys()
+	if err != nil {
+		log.Printf("Service error listing API keys: %v", err)
+		return nil, fmt.Errorf("service failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (s *apiKeySvc) GetAPIKey(id string) (*shortner.APIKey, error) {
+	key, err := s.repo.GetAPIKey(id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, notFoundError(CodeAPIKeyNotFound, "API key not found")
+		}
+		log.Printf("Service error getting API key '%s': %v", id, err)
+		return nil, fmt.Errorf("service failed to get API key: %w", err)
+	}
+	return key, nil
+}
+
+// PutAPIKey is idempotent: putting the same spec again changes nothing and
+// never shows or replaces the secret, which RotateAPIKey does.
+func (s *apiKeySvc) PutAPIKey(id string, spec shortner.APIKey) (*shortner.APIKey, bool, error) {
+	if err := checkProvisionID("id", id); err != nil {
+		return nil, false, err
+	}
+	name, scopes, createdBy := spec.Name, spec.Scopes, spec.CreatedBy
+	name = strings.TrimSpace(name)
+	if len(name) > maxAPIKeyNameBytes {
+		return nil, false, validationError("name", fmt.Sprintf("name must be at most %d bytes", maxAPIKeyNameBytes))
+	}
+	createdBy = strings.TrimSpace(createdBy)
+	if len(createdBy) > maxAPIKeyNameBytes {
+		return nil, false, validationError("created_by", fmt.Sprintf("created_by must be at most %d bytes", maxAPIKeyNameBytes))
+	}
+	if scopes == nil {
+		existing, err := s.repo.GetAPIKey(id)
+		switch {
+		case err == nil:
+			scopes = existing.Scopes
+		case errors.Is(err, repositories.ErrNotFound):
+			scopes = []string{shortner.ScopeAdmin}
+		default:
+			log.Printf("Service error getting API key '%s': %v", id, err)
+			return nil, false, fmt.Errorf("service failed to put API key: %w", err)
+		}
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, false, err
+	}
+	random, err := s.random().RandomString(apiKeySecretLength)
+	if err != nil {
+		return nil, false, fmt.Errorf("service failed to generate API key: %w", err)
+	}
+	secret := apiKeyPrefix + random
+	now := s.now()
+	var expiresAt *time.Time
+	if spec.ExpiresAt != nil {
+		t := spec.ExpiresAt.UTC().Truncate(time.Second)
+		expiresAt = &t
+	}
+	key, created, err := s.repo.PutAPIKey(shortner.APIKey{ID: id, Name: name, Scopes: scopes, CreatedBy: createdBy, KeyHash: hashAPIKey(secret), ExpiresAt: expiresAt, CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		log.Printf("Service error putting API key '%s': %v", id, err)
+		return nil, false, fmt.Errorf("service failed to put API key: %w", err)
+	}
+	if created {
+		key.Key = secret
+	}
+	log.Printf("Service put API key '%s' (created: %t)", id, created)
+	return key, created, nil
+}
+
+func (s *apiKeySvc) RotateAPIKey(id string, gracePeriod time.Duration, expiresAt *time.Time) (*shortner.APIKey, error) {
+	if gracePeriod < 0 || gracePeriod > maxAPIKeyGracePeriod {
+		return nil, validationError("grace_seconds", fmt.Sprintf("grace_seconds must be between 0 and %d", int(maxAPIKeyGracePeriod.Seconds())))
+	}
+	random, err := s.random().RandomString(apiKeySecretLength)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to generate API key: %w", err)
+	}
+	secret := apiKeyPrefix + random
+	now := s.now()
+	if expiresAt != nil {
+		existing, err := s.GetAPIKey(id)
+		if err != nil {
+			return nil, err
+		}
+		existing.ExpiresAt = expiresAt
+		if _, _, err := s.PutAPIKey(id, *existing); err != nil {
+			return nil, err
+		}
+	}
+	key, err := s.repo.RotateAPIKey(id, hashAPIKey(secret), now.Add(gracePeriod), now)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, notFoundError(CodeAPIKeyNotFound, "API key not found")
+		}
+		log.Printf("Service error rotating API key '%s': %v", id, err)
+		return nil, fmt.Errorf("service failed to rotate API key: %w", err)
+	}
+	key.Key = secret
+	log.Printf("Service rotated API key '%s', the previous secret works until %s", id, key.PreviousKeyExpiresAt.Format(time.RFC3339))
+	return key, nil
+}
+
+func (s *apiKeySvc) DeleteAPIKey(id string) error {
+	if err := s.repo.DeleteAPIKey(id); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeAPIKeyNotFound, "API key not found")
+		}
+		log.Printf("Service error deleting API key '%s': %v", id, err)
+		return fmt.Errorf("service failed to delete API key: %w", err)
+	}
+	log.Printf("Service deleted API key '%s'", id)
+	return nil
+}
+
+func (s *apiKeySvc) Authenticate(secret string) (*shortner.APIKey, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return nil, ErrAPIKeyInvalid
+	}
+	key, err := s.repo.GetAPIKeyByHash(hashAPIKey(secret))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrAPIKeyInvalid
+		}
+		log.Printf("Service error looking up API key: %v", err)
+		return nil, fmt.Errorf("service failed to look up API key: %w", err)
+	}
+	now := s.now()
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return nil, ErrAPIKeyInvalid
+	}
+	if key.KeyHash != hashAPIKey(secret) && (key.PreviousKeyExpiresAt == nil || !now.Before(*key.PreviousKeyExpiresAt)) {
+		return nil, ErrAPIKeyInvalid
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyUsageInterval {
+		// The request goes on when the use cannot be recorded.
+		if err := s.repo.TouchAPIKey(key.ID, now); err != nil {
+			log.Printf("Service error recording use of API key '%s': %v", key.ID, err)
+		} else {
+			key.LastUsedAt = &now
+		}
+	}
+	return key, nil
+}
+
+// normalizeScopes checks scopes and orders them as APIKeyScopes, without
+// repeats.
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, validationError("scopes", "at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(shortner.APIKeyScopes, scope) {
+			return nil, validationError("scopes", fmt.Sprintf("unknown scope %q, must be one of %s", scope, strings.Join(shortner.APIKeyScopes, ", ")))
+		}
+	}
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range shortner.APIKeyScopes {
+		if slices.Contains(scopes, scope) {
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
+
+// hashAPIKey is how keys are stored: the secrets are random, so a plain
+// SHA-256 is enough to make a leaked table useless.
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	brandingSetting = "branding"
+
+	maxBrandingFooterRunes = 500
+	maxBrandingCSSBytes    = 10000
+)
+
+var brandingColorRe = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// BrandingService manages the branding of the public pages, stored with the
+// settings of the service and changed through the admin API.
+type BrandingService interface {
+	// Branding returns the branding for rendering a page, cached; it is
+	// zero when none is set or it cannot be loaded.
+	Branding() shortner.Branding
+	GetBranding() (*shortner.Branding, error)
+	SaveBranding(branding shortner.Branding) (*shortner.Branding, error)
+	// ResetBranding brings back the built-in look.
+	ResetBranding() error
+}
+
+type brandingSvc struct {
+	determinism
+	repo repositories.SettingsRepository
+	ttl  time.Duration
+
+	mu       sync.Mutex
+	cached   *shortner.Branding
+	loadedAt time.Time
+}
+
+// NewBrandingService creates the service. The branding is cached for ttl
+// (30s when zero), like the redirect blocks.
+func NewBrandingService(repo repositories.SettingsRepository, ttl time.Duration) BrandingService {
+	if ttl <= 0 {
+		ttl = defaultPolicyCacheTTL
+	}
+	return &brandingSvc{repo: repo, ttl: ttl}
+}
+
+func (s *brandingSvc) Branding() shortner.Branding {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cached == nil || now.Sub(s.loadedAt) >= s.ttl {
+		s.loadedAt = now
+		branding, err := s.GetBranding()
+		switch {
+		case err == nil:
+			s.cached = branding
+		case s.cached == nil:
+			// As for redirect blocks, a failed load keeps the old
+			// branding; without one pages keep the built-in look.
+			s.cached = &shortner.Branding{}
+		}
+	}
+	return *s.cached
+}
+
+func (s *brandingSvc) GetBranding() (*shortner.Branding, error) {
+	value, updatedAt, err := s.repo.GetSetting(brandingSetting)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return &shortner.Branding{}, nil
+	}
+	if err != nil {
+		log.Printf("Service error loading branding: %v", err)
+		return nil, fmt.Errorf("service failed to load branding: %w", err)
+	}
+	var branding shortner.Branding
+	if err := json.Unmarshal([]byte(value), &branding); err != nil {
+		return nil, fmt.Errorf("service failed to decode branding: %w", err)
+	}
+	branding.UpdatedAt = updatedAt
+	return &branding, nil
+}
+
+func (s *brandingSvc) SaveBranding(branding shortner.Branding) (*shortner.Branding, error) {
+	if err := validateBranding(&branding); err != nil {
+		return nil, err
+	}
+	branding.UpdatedAt = s.now()
+	value, err := json.Marshal(branding)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to encode branding: %w", err)
+	}
+	if err := s.repo.SaveSetting(brandingSetting, string(value), branding.UpdatedAt); err != nil {
+		log.Printf("Service error saving branding: %v", err)
+		return nil, fmt.Errorf("service failed to save branding: %w", err)
+	}
+	s.invalidate()
+	log.Println("Service saved branding")
+	return &branding, nil
+}
+
+func (s *brandingSvc) ResetBranding() error {
+	if err := s.repo.DeleteSetting(brandingSetting); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		log.Printf("Service error resetting branding: %v", err)
+		return fmt.Errorf("service failed to reset branding: %w", err)
+	}
+	s.invalidate()
+	log.Println("Service reset branding")
+	return nil
+}
+
+// invalidate drops the cached branding so a change made through this
+// instance applies to the next page.
+func (s *brandingSvc) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cached = nil
+}
+
+// validateBranding trims the fields and checks them. The CSS goes into the
+// pages as is, so it may not contain "<", which could close its style
+// element.
+func validateBranding(b *shortner.Branding) error {
+	b.LogoURL = strings.TrimSpace(b.LogoURL)
+	if b.LogoURL != "" {
+		u, err := url.Parse(b.LogoURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return validationError("logo_url", "logo_url must be an absolute https URL")
+		}
+	}
+	for _, color := range []struct {
+		field string
+		value *string
+	}{
+		{"primary_color", &b.PrimaryColor},
+		{"background_color", &b.BackgroundColor},
+		{"text_color", &b.TextColor},
+	} {
+		*color.value = strings.TrimSpace(*color.value)
+		if *color.value != "" && !brandingColorRe.MatchString(*color.value) {
+			return validationError(color.field, color.field+" must be a hex color such as #1a73e8")
+		}
+	}
+	b.Footer = strings.TrimSpace(b.Footer)
+	if len([]rune(b.Footer)) > maxBrandingFooterRunes {
+		return validationError("footer", fmt.Sprintf("footer must be at most %d characters", maxBrandingFooterRunes))
+	}
+	b.CSS = strings.TrimSpace(b.CSS)
+	if len(b.CSS) > maxBrandingCSSBytes {
+		return validationError("css", fmt.Sprintf("css must be at most %d bytes", maxBrandingCSSBytes))
+	}
+	if strings.Contains(b.CSS, "<") {
+		return validationError("css", "css must not contain '<'")
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+func TestBranding(t *testing.T) {
+	repo := repositories.NewSQLiteSettingsRepo(openTestDB(t))
+	if err := repo.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	s := NewBrandingService(repo, time.Hour)
+	clock := &fixedClock{now: testNow}
+	s.(Deterministic).SetClock(clock)
+
+	if got := s.Branding(); got != (shortner.Branding{}) {
+		t.Fatalf("Branding before saving = %+v, want zero", got)
+	}
+
+	saved, err := s.SaveBranding(shortner.Branding{LogoURL: " https://cdn.example.com/logo.png ", PrimaryColor: "#1A73E8", Footer: "Example Inc."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.LogoURL != "https://cdn.example.com/logo.png" || !saved.UpdatedAt.Equal(testNow) {
+		t.Errorf("SaveBranding = %+v", saved)
+	}
+	// Saving clears the cache, so pages use the branding at once.
+	if got := s.Branding(); got.PrimaryColor != "#1A73E8" || got.Footer != "Example Inc." || !got.UpdatedAt.Equal(testNow) {
+		t.Errorf("Branding after saving = %+v", got)
+	}
+
+	for _, b := range []shortner.Branding{
+		{LogoURL: "http://cdn.example.com/logo.png"},
+		{LogoURL: "/logo.png"},
+		{PrimaryColor: "blue"},
+		{TextColor: "#12345"},
+		{BackgroundColor: "#fff;background:url(x)"},
+		{Footer: strings.Repeat("x", maxBrandingFooterRunes+1)},
+		{CSS: "</style><script>alert(1)</script>"},
+		{CSS: strings.Repeat("a", maxBrandingCSSBytes+1)},
+	} {
+		if _, err := s.SaveBranding(b); !errors.Is(err, ErrValidationFailed) {
+			t.Errorf("SaveBranding(%+v) error = %v, want a validation error", b, err)
+		}
+	}
+
+	if err := s.ResetBranding(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Branding(); got != (shortner.Branding{}) {
+		t.Errorf("Branding after a reset = %+v, want zero", got)
+	}
+	if err := s.ResetBranding(); err != nil {
+		t.Errorf("resetting twice: %v", err)
+	}
+}
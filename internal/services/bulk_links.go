@@ -0,0 +1,252 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"template/internal/pkg/idn"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	// maxBulkLinks bounds the links one bulk operation may change, so a
+	// filter matching half the database is refused rather than run.
+	maxBulkLinks = 1000
+	// bulkScanPage is the page size used to find the links matching a
+	// destination prefix.
+	bulkScanPage = 500
+)
+
+// BulkDelete deletes the selected links, moving them to the trash when
+// there is one. Unless selection.SkipMissing is
+// set, a listed code that does not exist leaves every link in place; the
+// result says which one.
+func (s *shortenerSvc) BulkDelete(selection shortner.BulkSelection) (*shortner.BulkResult, error) {
+	mappings, result, err := s.selectLinks(selection)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Applied {
+		return result, nil
+	}
+	deletes := make([]string, len(mappings))
+	for i, mapping := range mappings {
+		if err := s.moveToTrash(mapping); err != nil {
+			for _, code := range deletes[:i] {
+				s.keepOutOfTrash(code)
+			}
+			return nil, err
+		}
+		deletes[i] = mapping.ShortCode
+	}
+	if err := s.applyBulk(result, nil, deletes); err != nil {
+		for _, code := range deletes {
+			s.keepOutOfTrash(code)
+		}
+		return nil, err
+	}
+	for _, item := range result.Results {
+		if item.Status != shortner.BulkItemDeleted {
+			s.keepOutOfTrash(item.ShortCode)
+		}
+	}
+	log.Printf("Service bulk-deleted %d of %d links", result.Changed, result.Matched)
+	return result, nil
+}
+
+// BulkUpdate applies update to the selected links. The update is checked
+// once, then against every link (a single-use flag only fits some kinds);
+// if any link refuses it, none is changed. Stats tokens are not issued in
+// bulk, since the response could not show a token per link.
+func (s *shortenerSvc) BulkUpdate(selection shortner.BulkSelection, update shortner.LinkUpdate) (*shortner.BulkResult, error) {
+	if update.StatsVisibility != nil && *update.StatsVisibility == shortner.StatsToken {
+		return nil, validationError("stats_visibility", "stats tokens are issued one link at a time")
+	}
+	if update.Source == "" {
+		update.Source = shortner.RevisionSourceBulk
+	}
+	update, err := s.prepareUpdate(update)
+	if err != nil {
+		return nil, err
+	}
+	mappings, result, err := s.selectLinks(selection)
+	if err != nil {
+		return nil, err
+	}
+
+	previousURLs := make(map[string]string, len(mappings))
+	updates := make([]shortner.URLMapping, 0, len(mappings))
+	for _, mapping := range mappings {
+		previousURLs[mapping.ShortCode] = mapping.LongURL
+		if err := s.mergeUpdate(&mapping, update); err != nil {
+			result.Applied = false
+			result.Results = append(result.Results, shortner.BulkItemResult{ShortCode: mapping.ShortCode, Status: shortner.BulkItemInvalid, Error: err.Error()})
+			continue
+		}
+		updates = append(updates, mapping)
+	}
+	if !result.Applied {
+		skipAll(result, updates)
+		return result, nil
+	}
+
+	if err := s.applyBulk(result, updates, nil); err != nil {
+		return nil, err
+	}
+	for _, item := range result.Results {
+		if item.Status != shortner.BulkItemUpdated {
+			continue
+		}
+		for _, mapping := range updates {
+			if mapping.ShortCode == item.ShortCode && mapping.LongURL != previousURLs[mapping.ShortCode] {
+				s.recordRevision(mapping.ShortCode, previousURLs[mapping.ShortCode], mapping.LongURL, update.Source)
+			}
+		}
+	}
+	log.Printf("Service bulk-updated %d of %d links", result.Changed, result.Matched)
+	return result, nil
+}
+
+// selectLinks loads the links of selection. The result lists the codes that
+// do not exist; Applied starts out true and is false when one of them
+// stops the operation, in which case the found links are marked skipped.
+func (s *shortenerSvc) selectLinks(selection shortner.BulkSelection) ([]shortner.URLMapping, *shortner.BulkResult, error) {
+	hasCodes, hasPrefix := len(selection.Codes) > 0, selection.DestinationPrefix != ""
+	if hasCodes == hasPrefix {
+		return nil, nil, validationError("codes", "give either codes or destination_prefix")
+	}
+
+	result := &shortner.BulkResult{Applied: true, Results: []shortner.BulkItemResult{}}
+	var mappings []shortner.URLMapping
+	if hasPrefix {
+		var err error
+		if mappings, err = s.linksWithPrefix(selection.DestinationPrefix); err != nil {
+			return nil, nil, err
+		}
+		result.Matched = len(mappings)
+		return mappings, result, nil
+	}
+
+	if len(selection.Codes) > maxBulkLinks {
+		return nil, nil, validationError("codes", fmt.Sprintf("at most %d codes can be changed at once", maxBulkLinks))
+	}
+	seen := make(map[string]bool, len(selection.Codes))
+	for _, code := range selection.Codes {
+		if code == "" || seen[code] {
+			continue
+		}
+		seen[code] = true
+		mapping, err := s.repo.GetMapping(code)
+		if errors.Is(err, repositories.ErrNotFound) {
+			result.Results = append(result.Results, shortner.BulkItemResult{ShortCode: code, Status: shortner.BulkItemNotFound, Error: "short code not found"})
+			if !selection.SkipMissing {
+				result.Applied = false
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("Service error loading mapping for code '%s': %v", code, err)
+			return nil, nil, fmt.Errorf("service failed to load mapping: %w", err)
+		}
+		// With case-insensitive codes the stored code may differ in case
+		// from the listed one; changes and results use the stored one.
+		if !seen[mapping.ShortCode] || mapping.ShortCode == code {
+			seen[mapping.ShortCode] = true
+			mappings = append(mappings, *mapping)
+		}
+	}
+	result.Matched = len(mappings)
+	if !result.Applied {
+		skipAll(result, mappings)
+	}
+	return mappings, result, nil
+}
+
+// linksWithPrefix pages through every link for the destinations starting
+// with prefix, which is compared in the normalized form destinations are
+// stored in.
+func (s *shortenerSvc) linksWithPrefix(prefix string) ([]shortner.URLMapping, error) {
+	if normalized, err := idn.NormalizeURL(prefix); err == nil {
+		prefix = normalized
+	}
+	var matched []shortner.URLMapping
+	var afterID int64
+	for {
+		page, err := s.listSince(afterID, bulkScanPage)
+		if err != nil {
+			return nil, err
+		}
+		for _, mapping := range page {
+			if mapping.LongURL != "" && strings.HasPrefix(mapping.LongURL, prefix) {
+				matched = append(matched, mapping)
+			}
+		}
+		if len(matched) > maxBulkLinks {
+			return nil, validationError("destination_prefix", fmt.Sprintf("more than %d links match, use a longer prefix", maxBulkLinks))
+		}
+		if len(page) < bulkScanPage {
+			return matched, nil
+		}
+		afterID = page[len(page)-1].ID
+	}
+}
+
+// skipAll reports mappings as left unchanged.
+func skipAll(result *shortner.BulkResult, mappings []shortner.URLMapping) {
+	for _, mapping := range mappings {
+		result.Results = append(result.Results, shortner.BulkItemResult{ShortCode: mapping.ShortCode, Status: shortner.BulkItemSkipped})
+	}
+}
+
+// applyBulk stores the changes in one transaction when the repository can,
+// and otherwise one by one, recording the outcome of each in result.
+func (s *shortenerSvc) applyBulk(result *shortner.BulkResult, updates []shortner.URLMapping, deletes []string) error {
+	err := repositories.ErrBulkUnsupported
+	if bulk, ok := s.repo.(repositories.BulkWriter); ok {
+		err = bulk.ApplyBulk(updates, deletes)
+	}
+	switch {
+	case err == nil:
+		result.Transactional = true
+		for _, mapping := range updates {
+			result.Results = append(result.Results, shortner.BulkItemResult{ShortCode: mapping.ShortCode, Status: shortner.BulkItemUpdated})
+		}
+		for _, code := range deletes {
+			result.Results = append(result.Results, shortner.BulkItemResult{ShortCode: code, Status: shortner.BulkItemDeleted})
+		}
+		result.Changed = len(updates) + len(deletes)
+		return nil
+	case !errors.Is(err, repositories.ErrBulkUnsupported):
+		log.Printf("Service error applying bulk changes: %v", err)
+		return fmt.Errorf("service failed to apply bulk changes: %w", err)
+	}
+
+	for _, mapping := range updates {
+		result.Results = append(result.Results, s.applyOne(shortner.BulkItemUpdated, mapping.ShortCode, s.repo.UpdateMapping(mapping)))
+	}
+	for _, code := range deletes {
+		result.Results = append(result.Results, s.applyOne(shortner.BulkItemDeleted, code, s.repo.DeleteMapping(code)))
+	}
+	for _, item := range result.Results {
+		if item.Status == shortner.BulkItemUpdated || item.Status == shortner.BulkItemDeleted {
+			result.Changed++
+		}
+	}
+	return nil
+}
+
+// applyOne is the result of one change stored outside a transaction.
+func (s *shortenerSvc) applyOne(status, code string, err error) shortner.BulkItemResult {
+	switch {
+	case err == nil:
+		return shortner.BulkItemResult{ShortCode: code, Status: status}
+	case errors.Is(err, repositories.ErrNotFound):
+		return shortner.BulkItemResult{ShortCode: code, Status: shortner.BulkItemNotFound, Error: "short code not found"}
+	default:
+		log.Printf("Service error applying bulk change to code '%s': %v", code, err)
+		return shortner.BulkItemResult{ShortCode: code, Status: shortner.BulkItemFailed, Error: "failed to store the change"}
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"template/internal/usecases/shortner"
+)
+
+// bulkShortener returns a service with links to
+// https://example.com/{a,b,c} and https://other.example/d, and their codes.
+func bulkShortener(t *testing.T) (*shortenerSvc, []string) {
+	t.Helper()
+	s := sqliteShortener(t, openTestDB(t))
+	var codes []string
+	for _, url := range []string{"https://example.com/a", "https://example.com/b", "https://example.com/c", "https://other.example/d"} {
+		code, err := s.CreateShortURL(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		codes = append(codes, code)
+	}
+	return s, codes
+}
+
+func statuses(result *shortner.BulkResult) map[string]string {
+	out := make(map[string]string, len(result.Results))
+	for _, item := range result.Results {
+		out[item.ShortCode] = item.Status
+	}
+	return out
+}
+
+func TestBulkDeleteRefusesMissingCodes(t *testing.T) {
+	s, codes := bulkShortener(t)
+
+	result, err := s.BulkDelete(shortner.BulkSelection{Codes: []string{codes[0], "missing", codes[1]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Applied || result.Changed != 0 {
+		t.Fatalf("result = %+v, want nothing applied", result)
+	}
+	got := statuses(result)
+	if got["missing"] != shortner.BulkItemNotFound || got[codes[0]] != shortner.BulkItemSkipped || got[codes[1]] != shortner.BulkItemSkipped {
+		t.Errorf("statuses = %v", got)
+	}
+	if _, err := s.GetLink(codes[0]); err != nil {
+		t.Errorf("a refused bulk delete removed %s: %v", codes[0], err)
+	}
+
+	result, err = s.BulkDelete(shortner.BulkSelection{Codes: []string{codes[0], "missing", codes[1], codes[1]}, SkipMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Applied || !result.Transactional || result.Matched != 2 || result.Changed != 2 {
+		t.Fatalf("result = %+v, want both links deleted in one transaction", result)
+	}
+	for _, code := range codes[:2] {
+		if _, err := s.GetLink(code); !errors.Is(err, ErrLinkNotFound) {
+			t.Errorf("GetLink(%s) after bulk delete = %v, want not found", code, err)
+		}
+	}
+}
+
+func TestBulkUpdateByDestinationPrefix(t *testing.T) {
+	s, codes := bulkShortener(t)
+	redirectType := 301
+
+	result, err := s.BulkUpdate(shortner.BulkSelection{DestinationPrefix: "https://EXAMPLE.com/"}, shortner.LinkUpdate{RedirectType: &redirectType})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Applied || result.Matched != 3 || result.Changed != 3 {
+		t.Fatalf("result = %+v, want the three example.com links updated", result)
+	}
+	for i, code := range codes {
+		link, err := s.GetLink(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := i < 3; (link.RedirectType == 301) != want {
+			t.Errorf("%s redirect type = %d, updated = %v", link.LongURL, link.RedirectType, want)
+		}
+	}
+}
+
+func TestBulkUpdateIsAllOrNothing(t *testing.T) {
+	s, codes := bulkShortener(t)
+	paste, err := s.CreateLink(shortner.URLMapping{Kind: shortner.KindPaste})
+	if err != nil {
+		t.Fatal(err)
+	}
+	singleUse := true
+
+	result, err := s.BulkUpdate(shortner.BulkSelection{Codes: []string{codes[0], paste}}, shortner.LinkUpdate{SingleUse: &singleUse})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := statuses(result)
+	if result.Applied || got[paste] != shortner.BulkItemInvalid || got[codes[0]] != shortner.BulkItemSkipped {
+		t.Fatalf("result = %+v, want the paste refused and nothing applied", result)
+	}
+	if link, err := s.GetLink(codes[0]); err != nil || link.SingleUse {
+		t.Errorf("link %s = %+v, %v, want it unchanged", codes[0], link, err)
+	}
+
+	token := shortner.StatsToken
+	if _, err := s.BulkUpdate(shortner.BulkSelection{Codes: codes}, shortner.LinkUpdate{StatsVisibility: &token}); err == nil {
+		t.Error("BulkUpdate issued stats tokens in bulk")
+	}
+	if _, err := s.BulkUpdate(shortner.BulkSelection{Codes: codes, DestinationPrefix: "https://"}, shortner.LinkUpdate{SingleUse: &singleUse}); err == nil {
+		t.Error("BulkUpdate accepted both codes and a destination prefix")
+	}
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"template/internal/pkg/idn"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	maxBundleItems      = 50
+	maxBundleTitleRunes = 200
+)
+
+type BundleService interface {
+	CreateBundle(title string, items []shortner.BundleItem) (string, error)
+	ListItems(shortCode string) ([]shortner.BundleItem, error)
+	GetItem(shortCode string, itemID int64) (*shortner.BundleItem, error)
+	AddItem(shortCode string, item shortner.BundleItem) (*shortner.BundleItem, error)
+	UpdateItem(shortCode string, item shortner.BundleItem) error
+	DeleteItem(shortCode string, itemID int64) error
+	LinkCleaner
+}
+
+type bundleSvc struct {
+	determinism
+	links ShortenerService
+	repo  repositories.BundleRepository
+}
+
+func NewBundleService(links ShortenerService, repo repositories.BundleRepository) BundleService {
+	return &bundleSvc{links: links, repo: repo}
+}
+
+func (s *bundleSvc) CreateBundle(title string, items []shortner.BundleItem) (string, error) {
+	title = strings.TrimSpace(title)
+	if len([]rune(title)) > maxBundleTitleRunes {
+		return "", validationError("title", fmt.Sprintf("title must be at most %d characters", maxBundleTitleRunes))
+	}
+	if len(items) > maxBundleItems {
+		return "", validationError("items", fmt.Sprintf("a bundle can hold at most %d items", maxBundleItems))
+	}
+	for i := range items {
+		if err := s.validateItem(&items[i]); err != nil {
+			return "", err
+		}
+	}
+
+	code, err := s.links.CreateLink(shortner.URLMapping{Kind: shortner.KindBundle, Title: title})
+	if err != nil {
+		return "", err
+	}
+
+	for i, item := range items {
+		item.ShortCode = code
+		item.Position = i
+		if _, err := s.repo.AddItem(item); err != nil {
+			log.Printf("Service error adding item to bundle '%s': %v", code, err)
+			return "", fmt.Errorf("service failed to add bundle item: %w", err)
+		}
+	}
+
+	log.Printf("Service created bundle '%s' with %d item(s)", code, len(items))
+	return code, nil
+}
+
+func (s *bundleSvc) ListItems(shortCode string) ([]shortner.BundleItem, error) {
+	shortCode, err := s.requireBundle(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.repo.ListItems(shortCode)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list bundle items: %w", err)
+	}
+	return items, nil
+}
+
+func (s *bundleSvc) GetItem(shortCode string, itemID int64) (*shortner.BundleItem, error) {
+	item, err := s.repo.GetItem(shortCode, itemID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, notFoundError(CodeBundleItemNotFound, "bundle item not found")
+		}
+		return nil, fmt.Errorf("service failed to load bundle item: %w", err)
+	}
+	return item, nil
+}
+
+func (s *bundleSvc) AddItem(shortCode string, item shortner.BundleItem) (*shortner.BundleItem, error) {
+	shortCode, err := s.requireBundle(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateItem(&item); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.ListItems(shortCode)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list bundle items: %w", err)
+	}
+	if len(existing) >= maxBundleItems {
+		return nil, validationError("items", fmt.Sprintf("a bundle can hold at most %d items", maxBundleItems))
+	}
+
+	item.ShortCode = shortCode
+	item.CreatedAt = s.now()
+	if item.Position == 0 && len(existing) > 0 {
+		item.Position = existing[len(existing)-1].Position + 1
+	}
+	id, err := s.repo.AddItem(item)
+	if err != nil {
+		log.Printf("Service error adding item to bundle '%s': %v", shortCode, err)
+		return nil, fmt.Errorf("service failed to add bundle item: %w", err)
+	}
+	item.ID = id
+	return &item, nil
+}
+
+func (s *bundleSvc) UpdateItem(shortCode string, item shortner.BundleItem) error {
+	if err := s.validateItem(&item); err != nil {
+		return err
+	}
+	item.ShortCode = shortCode
+	if err := s.repo.UpdateItem(item); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeBundleItemNotFound, "bundle item not found")
+		}
+		return fmt.Errorf("service failed to update bundle item: %w", err)
+	}
+	return nil
+}
+
+func (s *bundleSvc) DeleteItem(shortCode string, itemID int64) error {
+	if err := s.repo.DeleteItem(shortCode, itemID); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeBundleItemNotFound, "bundle item not found")
+		}
+		return fmt.Errorf("service failed to delete bundle item: %w", err)
+	}
+	return nil
+}
+
+// requireBundle returns the stored code of the bundle link shortCode, which
+// differs from shortCode in case when codes are case-insensitive.
+func (s *bundleSvc) requireBundle(shortCode string) (string, error) {
+	link, err := s.links.GetLink(shortCode)
+	if err != nil {
+		return "", err
+	}
+	if link.Kind != shortner.KindBundle {
+		return "", validationError("short_code", fmt.Sprintf("link '%s' is not a bundle", shortCode))
+	}
+	return link.ShortCode, nil
+}
+
+func (s *bundleSvc) validateItem(item *shortner.BundleItem) error {
+	item.Title = strings.TrimSpace(item.Title)
+	if !isHTTPURL(item.URL) {
+		return invalidURLError("url", "invalid item URL format provided")
+	}
+	normalized, err := s.links.NormalizeDestination("url", item.URL)
+	if err != nil {
+		return err
+	}
+	item.URL = normalized
+	if len([]rune(item.Title)) > maxBundleTitleRunes {
+		return validationError("title", fmt.Sprintf("title must be at most %d characters", maxBundleTitleRunes))
+	}
+	if item.Title == "" {
+		item.Title = idn.DisplayURL(item.URL)
+	}
+	return nil
+}
+
+// CleanupLink deletes the items of an expired bundle link.
+func (s *bundleSvc) CleanupLink(mapping shortner.URLMapping) error {
+	if err := s.repo.DeleteItems(mapping.ShortCode); err != nil {
+		return fmt.Errorf("service failed to delete bundle items: %w", err)
+	}
+	return nil
+}
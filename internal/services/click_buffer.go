@@ -0,0 +1,119 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// clickBuffer keeps in memory the clicks that could not be written because
+// the database was unavailable, at most size of them, and tries to write
+// them again every interval until it answers. Clicks past size are
+// dropped, oldest first, so an outage costs memory only up to a bound.
+type clickBuffer struct {
+	size int
+	// write stores clicks in order and returns how many of them it
+	// stored before failing.
+	write func(clicks []shortner.Click) (int, error)
+
+	mu      sync.Mutex
+	clicks  []shortner.Click
+	dropped int
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newClickBuffer(size int, interval time.Duration, write func([]shortner.Click) (int, error)) *clickBuffer {
+	b := &clickBuffer{size: size, write: write, done: make(chan struct{})}
+	b.wg.Add(1)
+	go b.tick(interval)
+	return b
+}
+
+func (b *clickBuffer) tick(interval time.Duration) {
+	defer b.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.drain()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *clickBuffer) add(clicks ...shortner.Click) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.clicks) == 0 {
+		log.Printf("Database unavailable, buffering clicks in memory (up to %d)", b.size)
+	}
+	b.clicks = append(b.clicks, clicks...)
+	b.trim()
+}
+
+// drain writes the buffered clicks a batch at a time, and stops at the
+// first failure, putting back the clicks not written.
+func (b *clickBuffer) drain() {
+	written := 0
+	for {
+		b.mu.Lock()
+		n := min(len(b.clicks), defaultClickBatchSize)
+		batch := b.clicks[:n:n]
+		b.clicks = b.clicks[n:]
+		b.mu.Unlock()
+		if n == 0 {
+			break
+		}
+
+		stored, err := b.write(batch)
+		written += stored
+		if err != nil {
+			b.mu.Lock()
+			b.clicks = append(batch[stored:], b.clicks...)
+			b.trim()
+			b.mu.Unlock()
+			if written > 0 {
+				log.Printf("Wrote %d buffered click(s) before the database failed again: %v", written, err)
+			}
+			return
+		}
+	}
+	if written == 0 {
+		return
+	}
+	b.mu.Lock()
+	dropped := b.dropped
+	b.dropped = 0
+	b.mu.Unlock()
+	log.Printf("Database available again, wrote %d buffered click(s); %d dropped while the buffer was full", written, dropped)
+}
+
+// trim drops the oldest clicks past size; b.mu must be held.
+func (b *clickBuffer) trim() {
+	if over := len(b.clicks) - b.size; over > 0 {
+		b.clicks = append([]shortner.Click(nil), b.clicks[over:]...)
+		b.dropped += over
+	}
+}
+
+func (b *clickBuffer) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.clicks)
+}
+
+// stop ends the retries after a last attempt; clicks still buffered then
+// are lost.
+func (b *clickBuffer) stop() {
+	close(b.done)
+	b.wg.Wait()
+	b.drain()
+	if n := b.len(); n > 0 {
+		log.Printf("Database still unavailable at shutdown, %d buffered click(s) lost", n)
+	}
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"template/internal/usecases/shortner"
+)
+
+// clickDeduper remembers when each visitor (IP and user agent) last had a
+// click on a link counted, so that repeats within window are dropped.
+// Entries older than window are swept at most once per window.
+type clickDeduper struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	counted   map[clickKey]time.Time
+	lastSweep time.Time
+}
+
+type clickKey struct {
+	shortCode string
+	itemID    int64
+	ip        string
+	userAgent string
+}
+
+func newClickDeduper(window time.Duration) *clickDeduper {
+	return &clickDeduper{window: window, counted: make(map[clickKey]time.Time)}
+}
+
+// duplicate reports whether click repeats one counted less than window
+// before it; otherwise it remembers click as counted.
+func (d *clickDeduper) duplicate(click shortner.Click) bool {
+	key, at := dedupKey(click), click.ClickedAt
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if at.Sub(d.lastSweep) >= d.window {
+		for k, t := range d.counted {
+			if at.Sub(t) >= d.window {
+				delete(d.counted, k)
+			}
+		}
+		d.lastSweep = at
+	}
+	if last, ok := d.counted[key]; ok && at.Sub(last) < d.window && !at.Before(last) {
+		return true
+	}
+	d.counted[key] = at
+	return false
+}
+
+// forget undoes duplicate for a click that could not be recorded, so that
+// its retry is not dropped as a repeat of itself.
+func (d *clickDeduper) forget(click shortner.Click) {
+	key := dedupKey(click)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.counted[key].Equal(click.ClickedAt) {
+		delete(d.counted, key)
+	}
+}
+
+func dedupKey(click shortner.Click) clickKey {
+	return clickKey{shortCode: click.ShortCode, itemID: click.ItemID, ip: click.IP, userAgent: click.UserAgent}
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"template/internal/pkg/wal"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+// clickLog writes enqueued clicks to a write-ahead log before they are
+// stored, each under its EventID, so that clicks lost to a crash or to a
+// database outage are stored when the log is replayed. The replay runs at
+// start and every interval while the log has failed clicks; clicks already
+// stored are skipped by their EventID.
+type clickLog struct {
+	wal *wal.Log
+	// write stores clicks in order and returns how many of them it
+	// stored before failing.
+	write func(clicks []shortner.Click) (int, error)
+
+	mu sync.Mutex
+	// segments maps the EventID of the clicks not stored yet to their
+	// segment of the log.
+	segments map[string]uint64
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newClickLog(l *wal.Log, interval time.Duration, write func([]shortner.Click) (int, error)) *clickLog {
+	c := &clickLog{wal: l, write: write, segments: map[string]uint64{}, done: make(chan struct{})}
+	c.wg.Add(1)
+	go c.tick(interval)
+	return c
+}
+
+func (c *clickLog) tick(interval time.Duration) {
+	defer c.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.replay()
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// append logs click, which has an EventID. When the log cannot be
+// written, click is stored without it.
+func (c *clickLog) append(click shortner.Click) {
+	record, err := json.Marshal(click)
+	if err != nil {
+		log.Printf("Failed to encode click for the click log: %v", err)
+		return
+	}
+	segment, err := c.wal.Append(record)
+	if err != nil {
+		log.Printf("Failed to write click to the click log, storing it without: %v", err)
+		return
+	}
+	c.mu.Lock()
+	c.segments[click.EventID] = segment
+	c.mu.Unlock()
+}
+
+// settle acknowledges the logged clicks among clicks, as stored or as to
+// replay, and returns the others.
+func (c *clickLog) settle(clicks []shortner.Click, stored bool) []shortner.Click {
+	var unlogged []shortner.Click
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, click := range clicks {
+		segment, ok := c.segments[click.EventID]
+		if !ok {
+			unlogged = append(unlogged, click)
+			continue
+		}
+		delete(c.segments, click.EventID)
+		if stored {
+			c.wal.Ack(segment)
+		} else {
+			c.wal.Nack(segment)
+		}
+	}
+	return unlogged
+}
+
+// replay stores the clicks of the segments left by an earlier run or with
+// failed clicks, oldest first, and stops at the first segment that cannot
+// be stored while the database is unavailable.
+func (c *clickLog) replay() {
+	segments, err := c.wal.Backlog()
+	if err != nil {
+		log.Printf("Failed to read the click log backlog: %v", err)
+		return
+	}
+	for _, segment := range segments {
+		replayed := 0
+		err := c.wal.Replay(segment, func(records [][]byte) error {
+			clicks := make([]shortner.Click, 0, len(records))
+			for _, record := range records {
+				var click shortner.Click
+				if err := json.Unmarshal(record, &click); err != nil {
+					log.Printf("Skipping unreadable click log record: %v", err)
+					continue
+				}
+				clicks = append(clicks, click)
+			}
+			for len(clicks) > 0 {
+				n := min(len(clicks), defaultClickBatchSize)
+				stored, err := c.write(clicks[:n])
+				replayed += stored
+				if repositories.Unavailable(err) {
+					return err
+				}
+				if err != nil {
+					log.Printf("Dropping %d logged click(s) that could not be stored: %v", n-stored, err)
+				}
+				clicks = clicks[n:]
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Replaying the click log stopped, retrying later: %v", err)
+			return
+		}
+		log.Printf("Replayed %d logged click(s) from segment %d", replayed, segment)
+	}
+}
+
+// stop ends the replays. Clicks still to replay are kept in the log for
+// the next start.
+func (c *clickLog) stop() {
+	close(c.done)
+	c.wg.Wait()
+}
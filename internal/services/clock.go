@@ -0,0 +1,83 @@
+package services
+
+import (
+	"time"
+
+	"template/internal/pkg/utils"
+)
+
+// Clock tells the services the time: creation dates, expiry checks and
+// the deadlines of scheduled changes and signed links all come from it.
+type Clock interface {
+	Now() time.Time
+}
+
+// Generator produces the random strings the services hand out: short codes
+// and the tokens of files, reports and stats pages.
+type Generator interface {
+	// RandomString returns length characters of the URL-safe base64
+	// alphabet.
+	RandomString(length int) (string, error)
+	// ReadableString returns length characters of the alphabet without
+	// look-alike characters (see utils.GenerateReadableString).
+	ReadableString(length int) (string, error)
+}
+
+// Deterministic is implemented by every service that reads the time or
+// generates random strings. The defaults are the system clock and
+// crypto/rand; tests replace them to make expiry, created_at and generated
+// codes repeatable. They must be set before the service is used.
+type Deterministic interface {
+	SetClock(clock Clock)
+	SetGenerator(generator Generator)
+}
+
+// SystemClock is the Clock of the services unless SetClock replaces it.
+var SystemClock Clock = systemClock{}
+
+// CryptoGenerator is the Generator of the services unless SetGenerator
+// replaces it.
+var CryptoGenerator Generator = cryptoGenerator{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+type cryptoGenerator struct{}
+
+func (cryptoGenerator) RandomString(length int) (string, error) {
+	return utils.GenerateRandomString(length)
+}
+
+func (cryptoGenerator) ReadableString(length int) (string, error) {
+	return utils.GenerateReadableString(length)
+}
+
+// determinism is embedded by the services to implement Deterministic. Its
+// zero value uses SystemClock and CryptoGenerator.
+type determinism struct {
+	clock     Clock
+	generator Generator
+}
+
+func (d *determinism) SetClock(clock Clock) {
+	d.clock = clock
+}
+
+func (d *determinism) SetGenerator(generator Generator) {
+	d.generator = generator
+}
+
+func (d *determinism) now() time.Time {
+	if d.clock == nil {
+		return SystemClock.Now()
+	}
+	return d.clock.Now()
+}
+
+func (d *determinism) random() Generator {
+	if d.generator == nil {
+		return CryptoGenerator
+	}
+	return d.generator
+}
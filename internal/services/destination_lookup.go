@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"template/internal/pkg/idn"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+// Destination match modes of FindLinksByDestination.
+const (
+	MatchExact  = "exact"
+	MatchPrefix = "prefix"
+	MatchDomain = "domain"
+)
+
+// FindLinksByDestination normalizes destination the way stored
+// destinations are, so a URL typed with an upper-case or Unicode host finds
+// the links made from it.
+func (s *shortenerSvc) FindLinksByDestination(ctx context.Context, destination, match string, afterID int64, limit int) ([]shortner.URLMapping, error) {
+	var query shortner.DestinationQuery
+	switch match {
+	case "", MatchExact, MatchPrefix:
+		if !s.ValidateURL(destination) {
+			return nil, invalidURLError("long_url", "invalid URL format provided")
+		}
+		normalized, err := idn.NormalizeURL(destination)
+		if err != nil {
+			return nil, invalidURLError("long_url", "invalid internationalized domain name")
+		}
+		if match == MatchPrefix {
+			query.Prefixes = []string{normalized}
+		} else {
+			query.URLs = []string{normalized}
+		}
+	case MatchDomain:
+		host, err := destinationHost(destination)
+		if err != nil {
+			return nil, invalidURLError("long_url", "invalid domain")
+		}
+		for _, scheme := range []string{"http://", "https://"} {
+			query.URLs = append(query.URLs, scheme+host)
+			for _, next := range []string{"/", ":", "?", "#"} {
+				query.Prefixes = append(query.Prefixes, scheme+host+next)
+			}
+		}
+	default:
+		return nil, validationError("match", fmt.Sprintf("invalid match '%s' (expected %s, %s or %s)", match, MatchExact, MatchPrefix, MatchDomain))
+	}
+	if limit <= 0 || limit > maxSearchPageSize {
+		limit = maxSearchPageSize
+	}
+
+	err := repositories.ErrSearchUnsupported
+	var mappings []shortner.URLMapping
+	if finder, ok := s.repo.(repositories.DestinationFinder); ok {
+		mappings, err = finder.FindByDestination(ctx, query, afterID, limit)
+	}
+	if err != nil {
+		if errors.Is(err, repositories.ErrSearchUnsupported) {
+			return nil, ErrSearchUnavailable
+		}
+		log.Printf("Service error finding links to '%s': %v", destination, err)
+		return nil, fmt.Errorf("service failed to find links by destination: %w", err)
+	}
+	return mappings, nil
+}
+
+// destinationHost returns the normalized host of a domain, or of the host
+// of a URL, without its port.
+func destinationHost(domain string) (string, error) {
+	if !strings.Contains(domain, "://") {
+		domain = "http://" + domain
+	}
+	normalized, err := idn.NormalizeURL(domain)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(normalized)
+	if err != nil || u.Hostname() == "" {
+		return "", errors.New("no host")
+	}
+	host := strings.TrimSuffix(u.Hostname(), ".")
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return host, nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"template/internal/repositories"
+)
+
+func TestFindLinksByDestination(t *testing.T) {
+	s := sqliteShortener(t, openTestDB(t))
+	codes := map[string]string{}
+	for _, url := range []string{
+		"https://example.com/docs/start",
+		"https://example.com/docs/api",
+		"http://example.com:8080/",
+		"https://example.com",
+		"https://example.com.evil.org/docs",
+		"https://www.example.com/docs",
+		"https://bücher.example/",
+	} {
+		code, err := s.CreateShortURL(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		codes[code] = url
+	}
+
+	find := func(destination, match string) []string {
+		t.Helper()
+		links, err := s.FindLinksByDestination(context.Background(), destination, match, 0, 0)
+		if err != nil {
+			t.Fatalf("FindLinksByDestination(%s, %s): %v", destination, match, err)
+		}
+		var urls []string
+		for _, link := range links {
+			urls = append(urls, codes[link.ShortCode])
+		}
+		return urls
+	}
+	tests := []struct {
+		destination string
+		match       string
+		want        string
+	}{
+		{"https://EXAMPLE.com/docs/api", "", "[https://example.com/docs/api]"},
+		{"https://example.com/docs", MatchExact, "[]"},
+		{"https://Example.com/docs/", MatchPrefix, "[https://example.com/docs/start https://example.com/docs/api]"},
+		{"example.com", MatchDomain, "[https://example.com/docs/start https://example.com/docs/api http://example.com:8080/ https://example.com]"},
+		{"https://www.example.com/anything", MatchDomain, "[https://www.example.com/docs]"},
+		{"https://bücher.example/", "", "[https://bücher.example/]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(find(tt.destination, tt.match)); got != tt.want {
+			t.Errorf("FindLinksByDestination(%s, %s) = %s, want %s", tt.destination, tt.match, got, tt.want)
+		}
+	}
+
+	if _, err := s.FindLinksByDestination(context.Background(), "https://example.com", "suffix", 0, 0); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("unknown match: error = %v, want a validation error", err)
+	}
+	if _, err := s.FindLinksByDestination(context.Background(), "example.com", MatchExact, 0, 0); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("exact match of a bare domain: error = %v, want INVALID_URL", err)
+	}
+}
+
+func TestFindLinksByDestinationSharded(t *testing.T) {
+	shards := make([]repositories.ShortenerRepository, 2)
+	for i := range shards {
+		repo := repositories.NewSQLiteShortenerRepo(openTestDB(t), false)
+		if err := repo.InitSchema(); err != nil {
+			t.Fatal(err)
+		}
+		shards[i] = repo
+	}
+	s := NewShortenerService(repositories.NewShardedShortenerRepo(shards), nil, nil, nil, nil).(*shortenerSvc)
+	s.SetPolicy(LinkPolicy{PrivateDestinations: privateDestinationsAllow})
+	for i := 0; i < 6; i++ {
+		if _, err := s.CreateShortURL(fmt.Sprintf("https://example.com/%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var found int
+	for afterID := int64(0); ; {
+		links, err := s.FindLinksByDestination(context.Background(), "https://example.com/", MatchPrefix, afterID, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(links) == 0 {
+			break
+		}
+		found += len(links)
+		afterID = links[len(links)-1].ID
+	}
+	if found != 6 {
+		t.Errorf("found %d links across shards, want 6", found)
+	}
+}
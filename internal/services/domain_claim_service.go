@@ -0,0 +1,380 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"template/internal/pkg/outbound"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	// VerificationMetaName is the name of the meta tag on the domain's home
+	// page that carries the verification token.
+	VerificationMetaName = "shortener-verification"
+	// VerificationPath is the file on the domain that may carry the token
+	// instead.
+	VerificationPath = "/.well-known/shortener-verification.txt"
+
+	claimTokenLength       = 32
+	verificationTimeout    = 10 * time.Second
+	maxVerificationBody    = 512 << 10
+	defaultClaimedLinks    = 50
+	maxClaimedLinks        = 100
+	maxClaimScanPages      = 20
+	maxTakedownReasonBytes = 200
+)
+
+// DomainClaimService lets the owner of a destination domain prove control
+// of it and then see and take down the links pointing at it. A claim is
+// verified once its token is published on the domain, either as
+// <meta name="shortener-verification" content="TOKEN"> on the home page or
+// as the content of /.well-known/shortener-verification.txt. Everything
+// after creating a claim is authenticated with the claim's key.
+type DomainClaimService interface {
+	CreateClaim(domain string) (*shortner.DomainClaim, error)
+	Verify(ctx context.Context, key string) (*shortner.DomainClaim, error)
+	// ListLinks returns up to limit redirect links to the claimed domain
+	// or its subdomains created after afterID, and the afterID of the
+	// next page, 0 on the last page.
+	ListLinks(key string, afterID int64, limit int) ([]shortner.ClaimedLink, int64, error)
+	// Takedown blocks a link to the claimed domain at redirect time.
+	Takedown(key, code, reason string) (*shortner.RedirectBlock, error)
+
+	// ListProvisionedClaims returns the claims operators provisioned, by
+	// name.
+	ListProvisionedClaims() ([]shortner.DomainClaim, error)
+	GetProvisionedClaim(name string) (*shortner.DomainClaim, error)
+	// PutProvisionedClaim makes the claim named name a verified claim on
+	// domain, creating it when there is none; created reports which. The
+	// key of a created claim is returned once, like CreateClaim's.
+	PutProvisionedClaim(name, domain string) (claim *shortner.DomainClaim, created bool, err error)
+	RemoveProvisionedClaim(name string) error
+}
+
+type domainClaimSvc struct {
+	determinism
+	repo   repositories.DomainClaimRepository
+	links  ShortenerService
+	policy RedirectPolicyService
+	client *outbound.Client
+	// scheme is how the domain is fetched for verification; tests use
+	// plain http.
+	scheme string
+}
+
+func NewDomainClaimService(repo repositories.DomainClaimRepository, links ShortenerService, policy RedirectPolicyService, client *outbound.Client) DomainClaimService {
+	return &domainClaimSvc{repo: repo, links: links, policy: policy, client: client, scheme: "https"}
+}
+
+// CreateClaim starts a claim on domain, which is read like BLOCKED_DOMAINS.
+// Anyone may claim any domain: nothing is granted before verification.
+func (s *domainClaimSvc) CreateClaim(domain string) (*shortner.DomainClaim, error) {
+	claim, err := s.newClaim(domain)
+	if err != nil {
+		return nil, err
+	}
+	claim.ID, err = s.repo.CreateClaim(*claim)
+	if err != nil {
+		log.Printf("Service error creating claim on %s: %v", domain, err)
+		return nil, fmt.Errorf("service failed to create domain claim: %w", err)
+	}
+	log.Printf("Service created claim %d on %s", claim.ID, claim.Domain)
+	return claim, nil
+}
+
+// newClaim checks domain and generates the token and key of a claim on it.
+func (s *domainClaimSvc) newClaim(domain string) (*shortner.DomainClaim, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" {
+		return nil, validationError("domain", "domain is required")
+	}
+	if strings.ContainsAny(domain, "/:@ *") || !strings.Contains(domain, ".") {
+		return nil, validationError("domain", "must be a domain name such as example.com")
+	}
+	token, err := s.random().RandomString(claimTokenLength)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to generate verification token: %w", err)
+	}
+	key, err := s.random().RandomString(claimTokenLength)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to generate claim key: %w", err)
+	}
+	return &shortner.DomainClaim{Domain: domain, VerificationToken: token, Key: key, CreatedAt: s.now()}, nil
+}
+
+// claim looks up the claim authenticated by key.
+func (s *domainClaimSvc) claim(key string) (*shortner.DomainClaim, error) {
+	if key == "" {
+		return nil, ErrClaimKeyInvalid
+	}
+	claim, err := s.repo.GetClaimByKey(key)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrClaimKeyInvalid
+		}
+		log.Printf("Service error looking up domain claim: %v", err)
+		return nil, fmt.Errorf("service failed to look up domain claim: %w", err)
+	}
+	claim.Key = ""
+	return claim, nil
+}
+
+// verifiedClaim is claim for the calls that need a verified claim.
+func (s *domainClaimSvc) verifiedClaim(key string) (*shortner.DomainClaim, error) {
+	claim, err := s.claim(key)
+	if err != nil {
+		return nil, err
+	}
+	if claim.VerifiedAt == nil {
+		return nil, &Error{Code: CodeDomainNotVerified, Message: fmt.Sprintf("control of %s has not been verified yet", claim.Domain)}
+	}
+	return claim, nil
+}
+
+// Verify looks for the token on the domain, first in the well-known file
+// and then on the home page. Verifying a verified claim checks again.
+func (s *domainClaimSvc) Verify(ctx context.Context, key string) (*shortner.DomainClaim, error) {
+	claim, err := s.claim(key)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, verificationTimeout)
+	defer cancel()
+
+	base := s.scheme + "://" + claim.Domain
+	body, fileErr := s.fetch(ctx, base+VerificationPath)
+	found := fileErr == nil && strings.TrimSpace(string(body)) == claim.VerificationToken
+	var pageErr error
+	if !found {
+		body, pageErr = s.fetch(ctx, base+"/")
+		found = pageErr == nil && metaContent(body, VerificationMetaName) == claim.VerificationToken
+	}
+	if !found {
+		log.Printf("Service could not verify claim %d on %s: file: %v, page: %v", claim.ID, claim.Domain, fileErr, pageErr)
+		return nil, &Error{
+			Code:    CodeDomainNotVerified,
+			Message: fmt.Sprintf("verification token not found at %s%s or in a %s meta tag on %s/", base, VerificationPath, VerificationMetaName, base),
+		}
+	}
+
+	now := s.now()
+	if err := s.repo.MarkVerified(claim.ID, now); err != nil {
+		log.Printf("Service error marking claim %d verified: %v", claim.ID, err)
+		return nil, fmt.Errorf("service failed to verify domain claim: %w", err)
+	}
+	claim.VerifiedAt = &now
+	log.Printf("Service verified claim %d on %s", claim.ID, claim.Domain)
+	return claim, nil
+}
+
+// fetch returns the body of a 200 response from target.
+func (s *domainClaimSvc) fetch(ctx context.Context, target string) ([]byte, error) {
+	resp, err := s.client.Get(ctx, "domain_verification", target)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %d", target, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxVerificationBody))
+}
+
+// metaContent returns the content of the first <meta name=name> in page.
+func metaContent(page []byte, name string) string {
+	tokens := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		switch tokens.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokens.Token()
+			if token.Data != "meta" {
+				continue
+			}
+			var metaName, content string
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "name":
+					metaName = attr.Val
+				case "content":
+					content = attr.Val
+				}
+			}
+			if strings.EqualFold(metaName, name) {
+				return strings.TrimSpace(content)
+			}
+		}
+	}
+}
+
+// ListLinks reads the links in order, like FindDuplicates, but stops after
+// a bounded number of pages so one request stays cheap; a page may then
+// hold fewer than limit links and still have a next page.
+func (s *domainClaimSvc) ListLinks(key string, afterID int64, limit int) ([]shortner.ClaimedLink, int64, error) {
+	claim, err := s.verifiedClaim(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if limit <= 0 {
+		limit = defaultClaimedLinks
+	}
+	limit = min(limit, maxClaimedLinks)
+
+	var links []shortner.ClaimedLink
+	for range maxClaimScanPages {
+		page, err := s.links.ListLinksSince(afterID, duplicateScanPage)
+		if err != nil {
+			return nil, 0, err
+		}
+		for i, mapping := range page {
+			if !pointsAt(&mapping, claim.Domain) {
+				continue
+			}
+			links = append(links, shortner.ClaimedLink{ShortCode: mapping.ShortCode, LongURL: mapping.LongURL, CreatedAt: mapping.CreatedAt})
+			if len(links) == limit {
+				if i == len(page)-1 && len(page) < duplicateScanPage {
+					return links, 0, nil
+				}
+				return links, mapping.ID, nil
+			}
+		}
+		if len(page) < duplicateScanPage {
+			return links, 0, nil
+		}
+		afterID = page[len(page)-1].ID
+	}
+	return links, afterID, nil
+}
+
+// pointsAt reports whether mapping redirects to domain or a subdomain, by
+// any of its destinations.
+func pointsAt(mapping *shortner.URLMapping, domain string) bool {
+	if mapping.Kind != shortner.KindRedirect {
+		return false
+	}
+	for _, destination := range mapping.Destinations() {
+		u, err := url.Parse(destination)
+		if err == nil && onDomain(strings.TrimSuffix(strings.ToLower(u.Hostname()), "."), []string{domain}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Takedown records who asked in the block's reason, so operators can tell
+// owner takedowns from their own blocks and lift them if needed.
+func (s *domainClaimSvc) Takedown(key, code, reason string) (*shortner.RedirectBlock, error) {
+	claim, err := s.verifiedClaim(key)
+	if err != nil {
+		return nil, err
+	}
+	if code == "" {
+		return nil, validationError("code", "code is required")
+	}
+	if len(reason) > maxTakedownReasonBytes {
+		return nil, validationError("reason", fmt.Sprintf("reason must be at most %d bytes", maxTakedownReasonBytes))
+	}
+	mapping, err := s.links.GetLink(code)
+	if err != nil {
+		return nil, err
+	}
+	if !pointsAt(mapping, claim.Domain) {
+		return nil, validationError("code", fmt.Sprintf("link does not point at %s", claim.Domain))
+	}
+	block, err := s.policy.AddBlock(shortner.RedirectBlock{
+		Kind:   shortner.BlockCode,
+		Value:  mapping.ShortCode,
+		Reason: strings.TrimSpace(fmt.Sprintf("takedown by owner of %s (claim %d): %s", claim.Domain, claim.ID, reason)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Service took down code %s for owner of %s", mapping.ShortCode, claim.Domain)
+	return block, nil
+}
+
+func (s *domainClaimSvc) ListProvisionedClaims() ([]shortner.DomainClaim, error) {
+	claims, err := s.repo.ListNamedClaims()
+	if err != nil {
+		log.Printf("Service error listing provisioned domain claims: %v", err)
+		return nil, fmt.Errorf("service failed to list domain claims: %w", err)
+	}
+	for i := range claims {
+		claims[i].Key = ""
+	}
+	return claims, nil
+}
+
+func (s *domainClaimSvc) GetProvisionedClaim(name string) (*shortner.DomainClaim, error) {
+	claim, err := s.repo.GetClaimByName(name)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, notFoundError(CodeDomainNotFound, "domain not found")
+		}
+		log.Printf("Service error getting domain claim '%s': %v", name, err)
+		return nil, fmt.Errorf("service failed to get domain claim: %w", err)
+	}
+	claim.Key = ""
+	return claim, nil
+}
+
+// PutProvisionedClaim is idempotent: putting the same domain again changes
+// nothing. An operator vouches for the domain, so the claim needs no
+// verification; its owner uses the key like that of a verified claim.
+func (s *domainClaimSvc) PutProvisionedClaim(name, domain string) (*shortner.DomainClaim, bool, error) {
+	if err := checkProvisionID("name", name); err != nil {
+		return nil, false, err
+	}
+	claim, err := s.newClaim(domain)
+	if err != nil {
+		return nil, false, err
+	}
+	existing, err := s.repo.GetClaimByName(name)
+	switch {
+	case err == nil && existing.Domain == claim.Domain:
+		existing.Key = ""
+		return existing, false, nil
+	case err != nil && !errors.Is(err, repositories.ErrNotFound):
+		log.Printf("Service error getting domain claim '%s': %v", name, err)
+		return nil, false, fmt.Errorf("service failed to put domain claim: %w", err)
+	}
+
+	now := s.now()
+	claim.Name = name
+	claim.VerifiedAt = &now
+	stored, created, err := s.repo.PutNamedClaim(*claim)
+	if err != nil {
+		log.Printf("Service error putting domain claim '%s' on %s: %v", name, claim.Domain, err)
+		return nil, false, fmt.Errorf("service failed to put domain claim: %w", err)
+	}
+	if !created {
+		stored.Key = ""
+	}
+	log.Printf("Service put claim '%s' on %s (created: %t)", name, stored.Domain, created)
+	return stored, created, nil
+}
+
+func (s *domainClaimSvc) RemoveProvisionedClaim(name string) error {
+	if err := s.repo.DeleteClaimByName(name); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeDomainNotFound, "domain not found")
+		}
+		log.Printf("Service error removing domain claim '%s': %v", name, err)
+		return fmt.Errorf("service failed to remove domain claim: %w", err)
+	}
+	log.Printf("Service removed claim '%s'", name)
+	return nil
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"template/internal/pkg/metrics"
+	"template/internal/pkg/outbound"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+// claimFixture stores links to example.com, a subdomain, a language target
+// on it and elsewhere, and a claim on example.com with key "key".
+func claimFixture(t *testing.T, verified bool) (*shortenerSvc, *domainClaimSvc, *repositories.SQLiteDomainClaimRepo) {
+	t.Helper()
+	db := openTestDB(t)
+	s := sqliteShortener(t, db)
+	blocks := repositories.NewSQLiteRedirectBlockRepo(db)
+	claims := repositories.NewSQLiteDomainClaimRepo(db)
+	for _, repo := range []interface{ InitSchema() error }{blocks, claims} {
+		if err := repo.InitSchema(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := []shortner.URLMapping{
+		{ShortCode: "own", LongURL: "https://example.com/a", Kind: shortner.KindRedirect},
+		{ShortCode: "other", LongURL: "https://example.org/", Kind: shortner.KindRedirect},
+		{ShortCode: "sub", LongURL: "https://www.example.com/b", Kind: shortner.KindRedirect},
+		{ShortCode: "lang", LongURL: "https://example.org/", Kind: shortner.KindRedirect, LanguageTargets: map[string]string{"de": "https://example.com/de"}},
+		{ShortCode: "fake", LongURL: "https://notexample.com/", Kind: shortner.KindRedirect},
+	}
+	for _, link := range links {
+		if _, err := s.repo.CreateMapping(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id, err := claims.CreateClaim(shortner.DomainClaim{Domain: "example.com", VerificationToken: "token", Key: "key", CreatedAt: testNow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified {
+		if err := claims.MarkVerified(id, testNow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client := outbound.New(outbound.Options{Timeout: time.Second, MaxBodyBytes: 1 << 20, AllowPrivate: true}, metrics.NewRegistry(nil))
+	policy := NewRedirectPolicyService(blocks, s, time.Minute)
+	svc := NewDomainClaimService(claims, s, policy, client).(*domainClaimSvc)
+	svc.scheme = "http"
+	return s, svc, claims
+}
+
+func TestVerifyDomainClaim(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		page  string
+		found bool
+	}{
+		{"well-known file", "token\n", "", true},
+		{"meta tag", "", `<html><head><meta name="Shortener-Verification" content="token"></head></html>`, true},
+		{"wrong token", "other", `<meta name="shortener-verification" content="other">`, false},
+		{"token elsewhere on the page", "", `<p>token</p>`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == VerificationPath && tt.file != "":
+					fmt.Fprint(w, tt.file)
+				case r.URL.Path == "/" && tt.page != "":
+					fmt.Fprint(w, tt.page)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			_, svc, claims := claimFixture(t, false)
+			if _, err := claims.CreateClaim(shortner.DomainClaim{Domain: strings.TrimPrefix(server.URL, "http://"), VerificationToken: "token", Key: "local", CreatedAt: testNow}); err != nil {
+				t.Fatal(err)
+			}
+			claim, err := svc.Verify(context.Background(), "local")
+			if !tt.found {
+				if !errors.Is(err, &Error{Code: CodeDomainNotVerified}) {
+					t.Errorf("Verify error = %v, want DOMAIN_NOT_VERIFIED", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claim.VerifiedAt == nil || claim.Key != "" {
+				t.Errorf("claim = %+v, want verified and without its key", claim)
+			}
+		})
+	}
+}
+
+func TestDomainClaimRequiresVerification(t *testing.T) {
+	_, svc, _ := claimFixture(t, false)
+	if _, _, err := svc.ListLinks("key", 0, 0); !errors.Is(err, &Error{Code: CodeDomainNotVerified}) {
+		t.Errorf("ListLinks error = %v, want DOMAIN_NOT_VERIFIED", err)
+	}
+	if _, _, err := svc.ListLinks("wrong", 0, 0); !errors.Is(err, ErrClaimKeyInvalid) {
+		t.Errorf("ListLinks with a wrong key error = %v, want CLAIM_KEY_INVALID", err)
+	}
+}
+
+func TestListClaimedLinks(t *testing.T) {
+	_, svc, _ := claimFixture(t, true)
+	links, next, err := svc.ListLinks("key", 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 || links[0].ShortCode != "own" || links[1].ShortCode != "sub" || next == 0 {
+		t.Fatalf("first page = %+v, next %d, want own and sub and a next page", links, next)
+	}
+	links, next, err = svc.ListLinks("key", next, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].ShortCode != "lang" || next != 0 {
+		t.Errorf("second page = %+v, next %d, want lang only", links, next)
+	}
+}
+
+func TestTakedown(t *testing.T) {
+	s, svc, _ := claimFixture(t, true)
+	block, err := svc.Takedown("key", "own", "phishing copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Kind != shortner.BlockCode || block.Value != "own" || !strings.Contains(block.Reason, "example.com") {
+		t.Errorf("block = %+v", block)
+	}
+	mapping, _ := s.repo.GetMapping("own")
+	if err := svc.policy.Check(mapping); !errors.Is(err, ErrLinkBlocked) {
+		t.Errorf("Check after takedown = %v, want ErrLinkBlocked", err)
+	}
+	if _, err := svc.Takedown("key", "other", ""); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("Takedown of a link elsewhere error = %v, want a validation error", err)
+	}
+}
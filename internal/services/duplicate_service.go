@@ -0,0 +1,172 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"template/internal/pkg/idn"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	defaultDuplicateGroups = 50
+	maxDuplicateGroups     = 500
+	maxMergeLinks          = 100
+	duplicateScanPage      = 500
+)
+
+// DuplicateService finds links that lead to the same destination and merges
+// them into one canonical link: the others become 301 redirects to the
+// canonical short URL and their clicks are credited to it.
+type DuplicateService interface {
+	FindDuplicates(limit int) ([]shortner.DuplicateGroup, error)
+	Merge(canonical string, codes []string) (*shortner.MergeResult, error)
+}
+
+type duplicateSvc struct {
+	links   ShortenerService
+	stats   repositories.StatsRepository
+	baseURL string
+}
+
+// NewDuplicateService creates the service; merged links redirect to
+// baseURL + "/" + the canonical code.
+func NewDuplicateService(links ShortenerService, stats repositories.StatsRepository, baseURL string) DuplicateService {
+	return &duplicateSvc{links: links, stats: stats, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// FindDuplicates returns up to limit destinations with more than one
+// redirect link, those with the most links first. Destinations are compared
+// normalized, so links created before normalization was added are found
+// too. It reads every link, which is fine for an occasional admin request.
+func (s *duplicateSvc) FindDuplicates(limit int) ([]shortner.DuplicateGroup, error) {
+	if limit == 0 {
+		limit = defaultDuplicateGroups
+	}
+	if limit < 1 || limit > maxDuplicateGroups {
+		return nil, validationError("limit", fmt.Sprintf("limit must be between 1 and %d", maxDuplicateGroups))
+	}
+
+	groups := map[string]*shortner.DuplicateGroup{}
+	var afterID int64
+	for {
+		page, err := s.links.ListLinksSince(afterID, duplicateScanPage)
+		if err != nil {
+			return nil, err
+		}
+		for _, mapping := range page {
+			if mapping.Kind != shortner.KindRedirect || mapping.LongURL == "" {
+				continue
+			}
+			destination := normalizedDestination(mapping.LongURL)
+			group := groups[destination]
+			if group == nil {
+				group = &shortner.DuplicateGroup{Destination: destination}
+				groups[destination] = group
+			}
+			group.Links = append(group.Links, shortner.DuplicateLink{ShortCode: mapping.ShortCode, CreatedAt: mapping.CreatedAt})
+		}
+		if len(page) < duplicateScanPage {
+			break
+		}
+		afterID = page[len(page)-1].ID
+	}
+
+	var duplicates []shortner.DuplicateGroup
+	for _, group := range groups {
+		if len(group.Links) < 2 {
+			continue
+		}
+		sort.SliceStable(group.Links, func(i, j int) bool {
+			return group.Links[i].CreatedAt.Before(group.Links[j].CreatedAt)
+		})
+		duplicates = append(duplicates, *group)
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if len(duplicates[i].Links) != len(duplicates[j].Links) {
+			return len(duplicates[i].Links) > len(duplicates[j].Links)
+		}
+		return duplicates[i].Destination < duplicates[j].Destination
+	})
+	if len(duplicates) > limit {
+		duplicates = duplicates[:limit]
+	}
+	return duplicates, nil
+}
+
+// Merge points codes at the canonical link. Every code must be a redirect
+// to the canonical link's destination; otherwise nothing is changed.
+func (s *duplicateSvc) Merge(canonical string, codes []string) (*shortner.MergeResult, error) {
+	if canonical == "" {
+		return nil, validationError("canonical", "canonical is required")
+	}
+	target, err := s.links.GetLink(canonical)
+	if err != nil {
+		return nil, err
+	}
+	if target.Kind != shortner.KindRedirect {
+		return nil, validationError("canonical", fmt.Sprintf("only redirect links can be merged, %s is a %s", target.ShortCode, target.Kind))
+	}
+	destination := normalizedDestination(target.LongURL)
+
+	var merged []string
+	seen := map[string]bool{target.ShortCode: true}
+	for _, code := range codes {
+		mapping, err := s.links.GetLink(code)
+		if err != nil {
+			return nil, err
+		}
+		if seen[mapping.ShortCode] {
+			continue
+		}
+		seen[mapping.ShortCode] = true
+		if mapping.Kind != shortner.KindRedirect || normalizedDestination(mapping.LongURL) != destination {
+			return nil, validationError("codes", fmt.Sprintf("%s does not redirect to %s", mapping.ShortCode, destination))
+		}
+		merged = append(merged, mapping.ShortCode)
+	}
+	if len(merged) == 0 {
+		return nil, validationError("codes", "give at least one code other than the canonical one")
+	}
+	if len(merged) > maxMergeLinks {
+		return nil, validationError("codes", fmt.Sprintf("at most %d links can be merged at once", maxMergeLinks))
+	}
+
+	canonicalURL := s.baseURL + "/" + target.ShortCode
+	permanent := 301
+	for i, code := range merged {
+		err := s.links.UpdateLink(code, shortner.LinkUpdate{
+			LongURL:         &canonicalURL,
+			RedirectType:    &permanent,
+			LanguageTargets: map[string]string{},
+			TimeRules:       []shortner.TimeRule{},
+			Source:          shortner.RevisionSourceMerge,
+		})
+		if err != nil {
+			log.Printf("Service error merging code '%s' into '%s' after %d of %d links: %v", code, target.ShortCode, i, len(merged), err)
+			return nil, err
+		}
+	}
+
+	moved, err := s.stats.MergeLinks(merged, target.ShortCode)
+	if err != nil {
+		// The redirects are in place; only the click history stays with
+		// the old codes, and merging again moves it.
+		log.Printf("Service error moving the clicks of %v to '%s': %v", merged, target.ShortCode, err)
+		return nil, fmt.Errorf("service failed to move clicks: %w", err)
+	}
+	log.Printf("Service merged %v into '%s', moving %d clicks", merged, target.ShortCode, moved)
+	return &shortner.MergeResult{Canonical: target.ShortCode, Merged: merged, ClicksMoved: moved}, nil
+}
+
+// normalizedDestination is rawURL in the form new destinations are stored
+// in, or rawURL itself when it cannot be normalized.
+func normalizedDestination(rawURL string) string {
+	if normalized, err := idn.NormalizeURL(rawURL); err == nil {
+		return normalized
+	}
+	return rawURL
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+// duplicateFixture stores links a, b and c to one destination, written
+// differently as links made before normalization can be, and d elsewhere.
+func duplicateFixture(t *testing.T) (*shortenerSvc, DuplicateService, *repositories.SQLiteClickRepo, *repositories.SQLiteStatsRepo) {
+	t.Helper()
+	db := openTestDB(t)
+	s := sqliteShortener(t, db)
+	clicks := repositories.NewSQLiteClickRepo(db)
+	stats := repositories.NewSQLiteStatsRepo(db)
+	for _, repo := range []interface{ InitSchema() error }{clicks, stats} {
+		if err := repo.InitSchema(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := []struct{ code, url string }{
+		{"a", "https://example.com/page"},
+		{"b", "https://EXAMPLE.com/page"},
+		{"c", "https://Example.COM/page"},
+		{"d", "https://example.org/"},
+	}
+	for i, link := range links {
+		mapping := shortner.URLMapping{ShortCode: link.code, LongURL: link.url, Kind: shortner.KindRedirect, RedirectType: 302, CreatedAt: testNow.Add(time.Duration(i) * time.Hour)}
+		if _, err := s.repo.CreateMapping(mapping); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s, NewDuplicateService(s, stats, "https://sho.rt/"), clicks, stats
+}
+
+func TestFindDuplicates(t *testing.T) {
+	_, duplicates, _, _ := duplicateFixture(t)
+	groups, err := duplicates.FindDuplicates(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].Destination != "https://example.com/page" || len(groups[0].Links) != 3 {
+		t.Fatalf("groups = %+v, want a, b and c under https://example.com/page", groups)
+	}
+	if groups[0].Links[0].ShortCode != "a" {
+		t.Errorf("first link = %s, want the oldest, a", groups[0].Links[0].ShortCode)
+	}
+	if _, err := duplicates.FindDuplicates(maxDuplicateGroups + 1); err == nil {
+		t.Error("FindDuplicates accepted a limit over the maximum")
+	}
+}
+
+func TestMergeDuplicates(t *testing.T) {
+	s, duplicates, clicks, stats := duplicateFixture(t)
+	for _, code := range []string{"a", "b", "b", "c"} {
+		if _, err := clicks.RecordClick(shortner.Click{ShortCode: code, ClickedAt: testNow}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Roll up the first clicks so both the raw and the counted ones move.
+	if _, err := stats.Rollup(2); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := duplicates.Merge("a", []string{"b", "c", "a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Merged) != 2 || result.ClicksMoved != 3 {
+		t.Errorf("result = %+v, want b and c merged with their 3 clicks", result)
+	}
+	for _, code := range []string{"b", "c"} {
+		link, err := s.GetLink(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link.LongURL != "https://sho.rt/a" || link.RedirectType != 301 {
+			t.Errorf("%s = %s (%d), want a 301 to the canonical short URL", code, link.LongURL, link.RedirectType)
+		}
+	}
+
+	if _, err := stats.Rollup(100); err != nil {
+		t.Fatal(err)
+	}
+	top, err := stats.TopLinks(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 1 || top[0].ShortCode != "a" || top[0].Clicks != 4 {
+		t.Errorf("top links = %+v, want all 4 clicks on a", top)
+	}
+}
+
+func TestMergeRefusesOtherDestinations(t *testing.T) {
+	s, duplicates, _, _ := duplicateFixture(t)
+	tests := []struct {
+		name      string
+		canonical string
+		codes     []string
+	}{
+		{"other destination", "a", []string{"b", "d"}},
+		{"only the canonical", "a", []string{"a"}},
+		{"no canonical", "", []string{"b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := duplicates.Merge(tt.canonical, tt.codes); !errors.Is(err, ErrValidationFailed) {
+				t.Errorf("Merge error = %v, want a validation error", err)
+			}
+		})
+	}
+	if link, err := s.GetLink("b"); err != nil || link.LongURL != "https://EXAMPLE.com/page" {
+		t.Errorf("b after refused merges = %+v, %v, want it unchanged", link, err)
+	}
+}
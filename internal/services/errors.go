@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"template/internal/repositories"
+)
+
+// ErrorCode is a stable, machine-readable identifier for a failure that API
+// clients can branch on. Codes are part of the public API: never rename one.
+type ErrorCode string
+
+const (
+	CodeInvalidURL           ErrorCode = "INVALID_URL"
+	CodeURLTooLong           ErrorCode = "URL_TOO_LONG"
+	CodeValidationFailed     ErrorCode = "VALIDATION_FAILED"
+	CodeLinkNotFound         ErrorCode = "LINK_NOT_FOUND"
+	CodeCodeMistyped         ErrorCode = "CODE_MISTYPED"
+	CodeHookNotFound         ErrorCode = "HOOK_NOT_FOUND"
+	CodeBundleItemNotFound   ErrorCode = "BUNDLE_ITEM_NOT_FOUND"
+	CodeCodeTaken            ErrorCode = "CODE_TAKEN"
+	CodeLinkExpired          ErrorCode = "LINK_EXPIRED"
+	CodeLinkConsumed         ErrorCode = "LINK_CONSUMED"
+	CodePayloadTooLarge      ErrorCode = "PAYLOAD_TOO_LARGE"
+	CodeFileNotUploaded      ErrorCode = "FILE_NOT_UPLOADED"
+	CodeUploadForbidden      ErrorCode = "UPLOAD_FORBIDDEN"
+	CodePixelNotFound        ErrorCode = "PIXEL_NOT_FOUND"
+	CodeScheduleNotFound     ErrorCode = "SCHEDULE_NOT_FOUND"
+	CodeSubscriptionNotFound ErrorCode = "SUBSCRIPTION_NOT_FOUND"
+	CodeDestinationBlocked   ErrorCode = "DESTINATION_BLOCKED"
+	CodeDestinationPrivate   ErrorCode = "DESTINATION_PRIVATE"
+	CodeFlagNotFound         ErrorCode = "FLAG_NOT_FOUND"
+	CodeStatsPrivate         ErrorCode = "STATS_PRIVATE"
+	CodeSignatureInvalid     ErrorCode = "SIGNATURE_INVALID"
+	CodeSignatureExpired     ErrorCode = "SIGNATURE_EXPIRED"
+	CodeTrashItemNotFound    ErrorCode = "TRASH_ITEM_NOT_FOUND"
+	CodeSearchUnavailable    ErrorCode = "SEARCH_UNAVAILABLE"
+	CodeListingUnavailable   ErrorCode = "LISTING_UNAVAILABLE"
+	CodeLinkBlocked          ErrorCode = "LINK_BLOCKED"
+	CodeBlockNotFound        ErrorCode = "BLOCK_NOT_FOUND"
+	CodeHoneypotNotFound     ErrorCode = "HONEYPOT_NOT_FOUND"
+	CodeProfileNotFound      ErrorCode = "PROFILE_NOT_FOUND"
+	CodeProfileItemNotFound  ErrorCode = "PROFILE_ITEM_NOT_FOUND"
+	CodeClaimKeyInvalid      ErrorCode = "CLAIM_KEY_INVALID"
+	CodeDomainNotVerified    ErrorCode = "DOMAIN_NOT_VERIFIED"
+	CodeChainedLink          ErrorCode = "CHAINED_LINK"
+	CodeRedirectLoop         ErrorCode = "REDIRECT_LOOP"
+	CodeAPIKeyNotFound       ErrorCode = "API_KEY_NOT_FOUND"
+	CodeDomainNotFound       ErrorCode = "DOMAIN_NOT_FOUND"
+	CodeBlockTaken           ErrorCode = "BLOCK_TAKEN"
+	CodeWorkspaceNotFound    ErrorCode = "SLACK_WORKSPACE_NOT_FOUND"
+	CodeInternal             ErrorCode = "INTERNAL_ERROR"
+)
+
+// FieldError describes a problem with a single input field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is the typed error returned by services. Handlers translate it into
+// an HTTP response without inspecting error strings.
+type Error struct {
+	Code    ErrorCode
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches errors by code, so errors.Is(err, services.ErrInvalidURL)
+// holds for any INVALID_URL error regardless of its message.
+func (e *Error) Is(target error) bool {
+	var t *Error
+	if errors.As(target, &t) {
+		return t.Code == e.Code
+	}
+	return false
+}
+
+var (
+	ErrInvalidURL         = &Error{Code: CodeInvalidURL, Message: "invalid URL format provided"}
+	ErrURLTooLong         = &Error{Code: CodeURLTooLong, Message: "URL is too long"}
+	ErrValidationFailed   = &Error{Code: CodeValidationFailed, Message: "validation failed"}
+	ErrLinkNotFound       = &Error{Code: CodeLinkNotFound, Message: "short code not found"}
+	ErrHookNotFound       = &Error{Code: CodeHookNotFound, Message: "hook not found"}
+	ErrCodeTaken          = &Error{Code: CodeCodeTaken, Message: "short code is already taken"}
+	ErrLinkExpired        = &Error{Code: CodeLinkExpired, Message: "short link has expired"}
+	ErrLinkConsumed       = &Error{Code: CodeLinkConsumed, Message: "this single-use link has already been used"}
+	ErrFileNotUploaded    = &Error{Code: CodeFileNotUploaded, Message: "file has not been uploaded yet"}
+	ErrUploadForbidden    = &Error{Code: CodeUploadForbidden, Message: "invalid upload token or file already uploaded"}
+	ErrSearchUnavailable  = &Error{Code: CodeSearchUnavailable, Message: "link search is not available with this storage"}
+	ErrListingUnavailable = &Error{Code: CodeListingUnavailable, Message: "listing links is not available with this storage"}
+	ErrLinkBlocked        = &Error{Code: CodeLinkBlocked, Message: "this link has been blocked"}
+	ErrClaimKeyInvalid    = &Error{Code: CodeClaimKeyInvalid, Message: "invalid domain claim key"}
+)
+
+func invalidURLError(field, message string) *Error {
+	return &Error{
+		Code:    CodeInvalidURL,
+		Message: message,
+		Fields:  []FieldError{{Field: field, Message: "must be an absolute http or https URL"}},
+	}
+}
+
+func validationError(field, message string) *Error {
+	return &Error{
+		Code:    CodeValidationFailed,
+		Message: message,
+		Fields:  []FieldError{{Field: field, Message: message}},
+	}
+}
+
+// notFoundError wraps repositories.ErrNotFound so existing errors.Is checks
+// against the repository sentinel keep working.
+func notFoundError(code ErrorCode, message string) *Error {
+	return &Error{Code: code, Message: message, Err: repositories.ErrNotFound}
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+
+	"template/internal/pkg/objectstore"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	fileUploadURLTTL   = time.Hour
+	fileDownloadURLTTL = 5 * time.Minute
+	maxFilenameRunes   = 255
+)
+
+// FileLimits bounds file links. AllowedTypes holds media types such as
+// "application/pdf"; a "type/*" entry allows the whole family.
+type FileLimits struct {
+	MaxBytes     int64
+	AllowedTypes []string
+	DefaultTTL   time.Duration
+	MaxTTL       time.Duration
+}
+
+// FileUpload is what a client declares before uploading a file.
+type FileUpload struct {
+	Filename    string
+	ContentType string
+	Size        int64
+}
+
+// FileDrop is a newly created file link. UploadURL is a presigned URL for
+// the object store; when it is empty, the content must be uploaded through
+// the server with File.UploadToken.
+type FileDrop struct {
+	File      *shortner.File
+	UploadURL string
+	ExpiresAt time.Time
+}
+
+type FileService interface {
+	CreateFile(upload FileUpload, ttl time.Duration) (*FileDrop, error)
+	Upload(shortCode, token string, body io.Reader, size int64, contentType string) error
+	GetFile(shortCode string) (*shortner.File, error)
+	Open(shortCode string) (io.ReadCloser, *shortner.File, error)
+	// DownloadURL returns a short-lived presigned URL for a ready file, or
+	// objectstore.ErrPresignUnsupported when the file must be streamed.
+	DownloadURL(file *shortner.File) (string, error)
+	LinkCleaner
+}
+
+type fileSvc struct {
+	determinism
+	links  ShortenerService
+	repo   repositories.FileRepository
+	store  objectstore.Store
+	limits FileLimits
+}
+
+func NewFileService(links ShortenerService, repo repositories.FileRepository, store objectstore.Store, limits FileLimits) FileService {
+	return &fileSvc{links: links, repo: repo, store: store, limits: limits}
+}
+
+func (s *fileSvc) CreateFile(upload FileUpload, ttl time.Duration) (*FileDrop, error) {
+	filename, err := sanitizeFilename(upload.Filename)
+	if err != nil {
+		return nil, err
+	}
+	contentType, err := s.checkContentType(upload.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Size <= 0 {
+		return nil, validationError("size", "size must be a positive number of bytes")
+	}
+	if upload.Size > s.limits.MaxBytes {
+		return nil, fileTooLargeError(s.limits.MaxBytes)
+	}
+	if ttl < 0 {
+		return nil, validationError("expires_in", "expiry must not be negative")
+	}
+	if ttl == 0 {
+		ttl = s.limits.DefaultTTL
+	}
+	if s.limits.MaxTTL > 0 && ttl > s.limits.MaxTTL {
+		ttl = s.limits.MaxTTL
+	}
+	expiresAt := s.now().Add(ttl)
+
+	token, err := s.random().RandomString(32)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to generate upload token: %w", err)
+	}
+
+	code, err := s.links.CreateLink(shortner.URLMapping{Kind: shortner.KindFile, Title: filename, ExpiresAt: &expiresAt})
+	if err != nil {
+		return nil, err
+	}
+
+	file := &shortner.File{
+		ShortCode:   code,
+		ObjectKey:   "files/" + code,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        upload.Size,
+		Status:      shortner.FileStatusPending,
+		UploadToken: token,
+		CreatedAt:   s.now(),
+	}
+	if err := s.repo.SaveFile(*file); err != nil {
+		log.Printf("Service error saving file '%s': %v", code, err)
+		return nil, fmt.Errorf("service failed to save file: %w", err)
+	}
+
+	drop := &FileDrop{File: file, ExpiresAt: expiresAt}
+	uploadURL, err := s.store.PresignPut(file.ObjectKey, contentType, upload.Size, fileUploadURLTTL)
+	switch {
+	case err == nil:
+		drop.UploadURL = uploadURL
+	case !errors.Is(err, objectstore.ErrPresignUnsupported):
+		log.Printf("Service error presigning upload for file '%s': %v", code, err)
+		return nil, fmt.Errorf("service failed to presign upload: %w", err)
+	}
+
+	log.Printf("Service created file link '%s' for '%s' (%s, %d bytes)", code, filename, contentType, upload.Size)
+	return drop, nil
+}
+
+// Upload stores the content of a pending file sent through the server. The
+// body must match the declared size and content type exactly.
+func (s *fileSvc) Upload(shortCode, token string, body io.Reader, size int64, contentType string) error {
+	file, err := s.loadFile(shortCode)
+	if err != nil {
+		return err
+	}
+	if file.Status != shortner.FileStatusPending || file.UploadToken == "" || token != file.UploadToken {
+		return ErrUploadForbidden
+	}
+	if size != file.Size {
+		return validationError("size", fmt.Sprintf("expected exactly %d bytes", file.Size))
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != file.ContentType {
+		return validationError("content_type", fmt.Sprintf("expected content type '%s'", file.ContentType))
+	}
+
+	if err := s.store.Put(file.ObjectKey, body, size, file.ContentType); err != nil {
+		log.Printf("Service error storing file '%s': %v", shortCode, err)
+		return fmt.Errorf("service failed to store file: %w", err)
+	}
+	if err := s.repo.MarkReady(shortCode, size); err != nil {
+		return fmt.Errorf("service failed to mark file ready: %w", err)
+	}
+
+	log.Printf("Service stored file '%s' (%d bytes)", shortCode, size)
+	return nil
+}
+
+// GetFile returns the file, first checking the object store for pending
+// files whose content may have arrived through a presigned upload.
+func (s *fileSvc) GetFile(shortCode string) (*shortner.File, error) {
+	file, err := s.loadFile(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if file.Status == shortner.FileStatusReady {
+		return file, nil
+	}
+
+	obj, err := s.store.Stat(file.ObjectKey)
+	if err != nil {
+		if errors.Is(err, objectstore.ErrNotFound) {
+			return nil, ErrFileNotUploaded
+		}
+		return nil, fmt.Errorf("service failed to check file upload: %w", err)
+	}
+	if obj.Size > s.limits.MaxBytes {
+		log.Printf("Service: Uploaded object for file '%s' is %d bytes, over the limit; deleting it", shortCode, obj.Size)
+		if err := s.store.Delete(file.ObjectKey); err != nil {
+			log.Printf("Service error deleting oversized object for file '%s': %v", shortCode, err)
+		}
+		return nil, ErrFileNotUploaded
+	}
+	if err := s.repo.MarkReady(shortCode, obj.Size); err != nil {
+		return nil, fmt.Errorf("service failed to mark file ready: %w", err)
+	}
+	file.Status = shortner.FileStatusReady
+	file.Size = obj.Size
+	file.UploadToken = ""
+	return file, nil
+}
+
+func (s *fileSvc) Open(shortCode string) (io.ReadCloser, *shortner.File, error) {
+	file, err := s.GetFile(shortCode)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, _, err := s.store.Open(file.ObjectKey)
+	if err != nil {
+		if errors.Is(err, objectstore.ErrNotFound) {
+			return nil, nil, ErrFileNotUploaded
+		}
+		return nil, nil, fmt.Errorf("service failed to open file: %w", err)
+	}
+	return body, file, nil
+}
+
+func (s *fileSvc) DownloadURL(file *shortner.File) (string, error) {
+	return s.store.PresignGet(file.ObjectKey, file.Filename, fileDownloadURLTTL)
+}
+
+func (s *fileSvc) loadFile(shortCode string) (*shortner.File, error) {
+	file, err := s.repo.GetFile(shortCode)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, notFoundError(CodeLinkNotFound, "short code not found")
+		}
+		return nil, fmt.Errorf("service failed to load file: %w", err)
+	}
+	return file, nil
+}
+
+func (s *fileSvc) checkContentType(raw string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(raw)
+	if err != nil {
+		return "", validationError("content_type", "content_type must be a media type such as application/pdf")
+	}
+	for _, allowed := range s.limits.AllowedTypes {
+		allowed = strings.ToLower(allowed)
+		if allowed == mediaType || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(allowed, "*"))) {
+			return mediaType, nil
+		}
+	}
+	return "", validationError("content_type", fmt.Sprintf("content type '%s' is not allowed (allowed: %s)", mediaType, strings.Join(s.limits.AllowedTypes, ", ")))
+}
+
+// sanitizeFilename keeps only the base name and drops control characters,
+// since the name ends up in Content-Disposition headers.
+func sanitizeFilename(name string) (string, error) {
+	name = path.Base(strings.ReplaceAll(strings.TrimSpace(name), "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		return "", validationError("filename", "filename is required")
+	}
+	if len([]rune(name)) > maxFilenameRunes {
+		return "", validationError("filename", fmt.Sprintf("filename must be at most %d characters", maxFilenameRunes))
+	}
+	return name, nil
+}
+
+func fileTooLargeError(maxBytes int64) *Error {
+	return &Error{
+		Code:    CodePayloadTooLarge,
+		Message: fmt.Sprintf("file exceeds the maximum size of %d bytes", maxBytes),
+		Fields:  []FieldError{{Field: "size", Message: "too large"}},
+	}
+}
+
+// CleanupLink deletes the stored object and the record of an expired file
+// link.
+func (s *fileSvc) CleanupLink(mapping shortner.URLMapping) error {
+	file, err := s.repo.GetFile(mapping.ShortCode)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("service failed to load file: %w", err)
+	}
+	if err := s.store.Delete(file.ObjectKey); err != nil && !errors.Is(err, objectstore.ErrNotFound) {
+		return fmt.Errorf("service failed to delete stored file: %w", err)
+	}
+	if err := s.repo.DeleteFile(mapping.ShortCode); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return fmt.Errorf("service failed to delete file record: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"template/internal/pkg/featureflags"
+	"template/internal/repositories"
+)
+
+// FlagService manages the runtime overrides of feature flags. Changes are
+// saved to the database and applied to the shared featureflags.Set at once;
+// the feature_flags job also calls Refresh periodically so that changes made
+// through another instance are picked up.
+type FlagService interface {
+	ListFlags() []featureflags.Flag
+	SetFlag(flag featureflags.Flag) (*featureflags.Flag, error)
+	ResetFlag(name string) error
+	Refresh() error
+}
+
+type flagSvc struct {
+	determinism
+	repo  repositories.FlagRepository
+	flags *featureflags.Set
+}
+
+func NewFlagService(repo repositories.FlagRepository, flags *featureflags.Set) FlagService {
+	return &flagSvc{repo: repo, flags: flags}
+}
+
+func (s *flagSvc) ListFlags() []featureflags.Flag {
+	return s.flags.List()
+}
+
+func (s *flagSvc) SetFlag(flag featureflags.Flag) (*featureflags.Flag, error) {
+	if !featureflags.Known(flag.Name) {
+		return nil, notFoundError(CodeFlagNotFound, fmt.Sprintf("unknown feature flag '%s'", flag.Name))
+	}
+	for i, env := range flag.Environments {
+		flag.Environments[i] = strings.TrimSpace(env)
+	}
+	if err := featureflags.Validate(flag); err != nil {
+		return nil, validationError("flag", err.Error())
+	}
+
+	now := s.now().UTC().Truncate(time.Second)
+	flag.UpdatedAt = &now
+	if err := s.repo.SaveFlag(flag); err != nil {
+		log.Printf("Service error saving feature flag '%s': %v", flag.Name, err)
+		return nil, fmt.Errorf("service failed to save feature flag: %w", err)
+	}
+	if err := s.Refresh(); err != nil {
+		return nil, err
+	}
+	log.Printf("Service set feature flag '%s': enabled=%t rollout=%d%% environments=%v", flag.Name, flag.Enabled, flag.Rollout, flag.Environments)
+
+	for _, f := range s.flags.List() {
+		if f.Name == flag.Name {
+			return &f, nil
+		}
+	}
+	return &flag, nil
+}
+
+// ResetFlag drops the override so the flag returns to its config or
+// built-in state.
+func (s *flagSvc) ResetFlag(name string) error {
+	if !featureflags.Known(name) {
+		return notFoundError(CodeFlagNotFound, fmt.Sprintf("unknown feature flag '%s'", name))
+	}
+	if err := s.repo.DeleteFlag(name); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		log.Printf("Service error deleting feature flag '%s': %v", name, err)
+		return fmt.Errorf("service failed to delete feature flag: %w", err)
+	}
+	log.Printf("Service reset feature flag '%s'", name)
+	return s.Refresh()
+}
+
+func (s *flagSvc) Refresh() error {
+	overrides, err := s.repo.ListFlags()
+	if err != nil {
+		log.Printf("Service error loading feature flags: %v", err)
+		return fmt.Errorf("service failed to load feature flags: %w", err)
+	}
+	s.flags.Override(overrides)
+	return nil
+}
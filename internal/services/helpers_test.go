@@ -0,0 +1,69 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"template/internal/repositories"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// openTestDB connects to a fresh database file that is removed after the
+// test.
+func openTestDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	db, err := repositories.ConnectDB(filepath.Join(tb.TempDir(), "test.db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+// sqliteShortener returns a service on db with the link table created.
+// Destinations are not resolved, so tests do not depend on DNS.
+func sqliteShortener(tb testing.TB, db *sql.DB) *shortenerSvc {
+	tb.Helper()
+	repo := repositories.NewSQLiteShortenerRepo(db, false)
+	if err := repo.InitSchema(); err != nil {
+		tb.Fatal(err)
+	}
+	s := NewShortenerService(repo, nil, nil, nil, nil).(*shortenerSvc)
+	s.SetPolicy(LinkPolicy{PrivateDestinations: privateDestinationsAllow})
+	return s
+}
+
+// fixedClock is a Clock that only moves when told to.
+type fixedClock struct{ now time.Time }
+
+func (c *fixedClock) Now() time.Time { return c.now }
+
+// sequenceGenerator hands out its strings in order, cut or padded to the
+// requested length, and fails once they run out.
+type sequenceGenerator struct{ values []string }
+
+func (g *sequenceGenerator) RandomString(length int) (string, error) {
+	if len(g.values) == 0 {
+		return "", fmt.Errorf("sequenceGenerator: out of values")
+	}
+	value := g.values[0]
+	g.values = g.values[1:]
+	for len(value) < length {
+		value += "0"
+	}
+	return value[:length], nil
+}
+
+func (g *sequenceGenerator) ReadableString(length int) (string, error) {
+	return g.RandomString(length)
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const maxHoneypotNoteLength = 500
+
+var honeypotCodeRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ClientBlocker refuses a client, by IP, for a while. The probe protection
+// (see ratelimit.ProbeGuard) is one.
+type ClientBlocker interface {
+	Block(key string, now time.Time)
+}
+
+// HoneypotService manages honeypot codes: codes that are never handed out,
+// so any request for one comes from someone guessing or scanning for codes.
+// Such requests are stored for the admin API instead of being counted as
+// clicks, and the client is blocked.
+type HoneypotService interface {
+	// IsHoneypot reports whether code is a honeypot, ignoring case.
+	IsHoneypot(code string) bool
+	// RecordHit stores a request for a honeypot and blocks its IP.
+	RecordHit(hit shortner.HoneypotHit)
+	ListHoneypots() ([]shortner.Honeypot, error)
+	// AddHoneypot stores code as a honeypot, or updates its note. Codes
+	// of existing links cannot be honeypots.
+	AddHoneypot(code, note string) (*shortner.Honeypot, error)
+	RemoveHoneypot(code string) error
+	ListHits(beforeID int64, limit int) ([]shortner.HoneypotHit, error)
+}
+
+type honeypotSvc struct {
+	determinism
+	repo    repositories.HoneypotRepository
+	links   ShortenerService
+	blocker ClientBlocker
+	ttl     time.Duration
+
+	mu       sync.Mutex
+	codes    map[string]bool
+	loadedAt time.Time
+}
+
+// NewHoneypotService creates the service. The honeypot codes are cached for
+// ttl (30s when zero), like the redirect blocks; blocker may be nil, in
+// which case hits are only stored.
+func NewHoneypotService(repo repositories.HoneypotRepository, links ShortenerService, blocker ClientBlocker, ttl time.Duration) HoneypotService {
+	if ttl <= 0 {
+		ttl = defaultPolicyCacheTTL
+	}
+	return &honeypotSvc{repo: repo, links: links, blocker: blocker, ttl: ttl}
+}
+
+func (s *honeypotSvc) IsHoneypot(code string) bool {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.codes == nil || now.Sub(s.loadedAt) >= s.ttl {
+		s.reload(now)
+	}
+	return s.codes[strings.ToLower(code)]
+}
+
+// reload refreshes the cached codes. When loading fails the old codes are
+// kept, as for redirect blocks. s.mu must be held.
+func (s *honeypotSvc) reload(now time.Time) {
+	s.loadedAt = now
+	honeypots, err := s.repo.ListHoneypots()
+	if err != nil {
+		log.Printf("Service error loading honeypots: %v", err)
+		if s.codes == nil {
+			s.codes = map[string]bool{}
+		}
+		return
+	}
+	s.codes = make(map[string]bool, len(honeypots))
+	for _, honeypot := range honeypots {
+		s.codes[strings.ToLower(honeypot.Code)] = true
+	}
+}
+
+func (s *honeypotSvc) RecordHit(hit shortner.HoneypotHit) {
+	hit.HitAt = s.now()
+	log.Printf("Service caught %s requesting honeypot code '%s'", hit.IP, hit.Code)
+	if s.blocker != nil && hit.IP != "" {
+		s.blocker.Block(hit.IP, hit.HitAt)
+	}
+	if _, err := s.repo.RecordHit(hit); err != nil {
+		log.Printf("Service error recording honeypot hit on '%s': %v", hit.Code, err)
+	}
+}
+
+func (s *honeypotSvc) ListHoneypots() ([]shortner.Honeypot, error) {
+	honeypots, err := s.repo.ListHoneypots()
+	if err != nil {
+		log.Printf("Service error listing honeypots: %v", err)
+		return nil, fmt.Errorf("service failed to list honeypots: %w", err)
+	}
+	return honeypots, nil
+}
+
+func (s *honeypotSvc) AddHoneypot(code, note string) (*shortner.Honeypot, error) {
+	code = strings.TrimSpace(code)
+	if !honeypotCodeRe.MatchString(code) {
+		return nil, validationError("code", "code must be 1 to 64 letters, digits, '-' or '_'")
+	}
+	if len(note) > maxHoneypotNoteLength {
+		return nil, validationError("note", fmt.Sprintf("note must be at most %d bytes", maxHoneypotNoteLength))
+	}
+	if _, err := s.links.GetLink(code); err == nil {
+		return nil, ErrCodeTaken
+	} else if !errors.Is(err, repositories.ErrNotFound) {
+		return nil, err
+	}
+
+	if err := s.repo.AddHoneypot(shortner.Honeypot{Code: code, Note: note, CreatedAt: s.now()}); err != nil {
+		log.Printf("Service error adding honeypot '%s': %v", code, err)
+		return nil, fmt.Errorf("service failed to add honeypot: %w", err)
+	}
+	s.invalidate()
+	log.Printf("Service added honeypot '%s'", code)
+
+	honeypots, err := s.ListHoneypots()
+	if err != nil {
+		return nil, err
+	}
+	for i := range honeypots {
+		if honeypots[i].Code == code {
+			return &honeypots[i], nil
+		}
+	}
+	return nil, fmt.Errorf("service lost honeypot '%s' after adding it", code)
+}
+
+func (s *honeypotSvc) RemoveHoneypot(code string) error {
+	if err := s.repo.DeleteHoneypot(code); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeHoneypotNotFound, "honeypot not found")
+		}
+		log.Printf("Service error removing honeypot '%s': %v", code, err)
+		return fmt.Errorf("service failed to remove honeypot: %w", err)
+	}
+	s.invalidate()
+	log.Printf("Service removed honeypot '%s'", code)
+	return nil
+}
+
+func (s *honeypotSvc) ListHits(beforeID int64, limit int) ([]shortner.HoneypotHit, error) {
+	hits, err := s.repo.ListHits(beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list honeypot hits: %w", err)
+	}
+	return hits, nil
+}
+
+// invalidate drops the cached codes so a change made through this instance
+// applies to the next request.
+func (s *honeypotSvc) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes = nil
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+// recordingBlocker remembers the clients it was asked to block.
+type recordingBlocker struct{ keys []string }
+
+func (b *recordingBlocker) Block(key string, now time.Time) { b.keys = append(b.keys, key) }
+
+func TestHoneypots(t *testing.T) {
+	db := openTestDB(t)
+	links := sqliteShortener(t, db)
+	repo := repositories.NewSQLiteHoneypotRepo(db)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := links.repo.CreateMapping(shortner.URLMapping{ShortCode: "real000", LongURL: "https://example.com/a"}); err != nil {
+		t.Fatal(err)
+	}
+	blocker := &recordingBlocker{}
+	s := NewHoneypotService(repo, links, blocker, time.Hour)
+	s.(Deterministic).SetClock(&fixedClock{now: testNow})
+	links.SetHoneypots(s)
+
+	if s.IsHoneypot("trap000") {
+		t.Fatal("trap000 is a honeypot before it was added")
+	}
+	added, err := s.AddHoneypot("trap000", "scanner bait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.Code != "trap000" || added.Note != "scanner bait" || !added.CreatedAt.Equal(testNow) {
+		t.Errorf("AddHoneypot = %+v", added)
+	}
+	// Adding clears the cache, so the honeypot is in force at once.
+	if !s.IsHoneypot("trap000") || !s.IsHoneypot("TRAP000") {
+		t.Error("the new honeypot is not recognized")
+	}
+
+	for _, tt := range []struct {
+		code string
+		want error
+	}{
+		{"real000", ErrCodeTaken},
+		{"", ErrValidationFailed},
+		{"a/b", ErrValidationFailed},
+	} {
+		if _, err := s.AddHoneypot(tt.code, ""); !errors.Is(err, tt.want) {
+			t.Errorf("AddHoneypot(%q) error = %v, want %v", tt.code, err, tt.want)
+		}
+	}
+
+	s.RecordHit(shortner.HoneypotHit{Code: "trap000", IP: "198.51.100.7", UserAgent: "scanner/1.0"})
+	if len(blocker.keys) != 1 || blocker.keys[0] != "198.51.100.7" {
+		t.Errorf("blocked %v, want 198.51.100.7", blocker.keys)
+	}
+	hits, err := s.ListHits(0, 10)
+	if err != nil || len(hits) != 1 || hits[0].IP != "198.51.100.7" || !hits[0].HitAt.Equal(testNow) {
+		t.Errorf("ListHits = %+v, %v, want the hit", hits, err)
+	}
+	honeypots, err := s.ListHoneypots()
+	if err != nil || len(honeypots) != 1 || honeypots[0].Hits != 1 || honeypots[0].LastHitAt == nil {
+		t.Errorf("ListHoneypots = %+v, %v, want trap000 with one hit", honeypots, err)
+	}
+
+	// Generated codes never land on a honeypot.
+	links.SetGenerator(&sequenceGenerator{values: []string{"trap000", "fresh00"}})
+	if code, err := links.CreateShortURL("https://example.com/b"); err != nil || code != "fresh00" {
+		t.Errorf("CreateShortURL = %q, %v, want fresh00", code, err)
+	}
+
+	if err := s.RemoveHoneypot("trap000"); err != nil {
+		t.Fatal(err)
+	}
+	if s.IsHoneypot("trap000") {
+		t.Error("trap000 is still a honeypot after its removal")
+	}
+	if err := s.RemoveHoneypot("trap000"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("removing it again: error = %v, want not found", err)
+	}
+}
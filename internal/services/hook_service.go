@@ -0,0 +1,195 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"template/internal/pkg/outbound"
+	"template/internal/pkg/tasks"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	EventLinkCreated  = "link.created"
+	EventClickCreated = "click.created"
+	EventLinkAnomaly  = "link.anomaly"
+)
+
+var supportedEvents = map[string]bool{
+	EventLinkCreated:  true,
+	EventClickCreated: true,
+	EventLinkAnomaly:  true,
+}
+
+// EventPublisher is notified about domain events so they can be fanned out to
+// external subscribers.
+type EventPublisher interface {
+	Publish(event string, payload interface{})
+}
+
+type HookService interface {
+	EventPublisher
+	Subscribe(event, targetURL string) (*shortner.Hook, error)
+	Unsubscribe(id int64) error
+	ListHooks() ([]shortner.Hook, error)
+	// Replay delivers the event to every subscriber right away, without the
+	// pool or its retries, and returns the first failed delivery. It is how
+	// cmd/backfill sends past events.
+	Replay(event string, payload interface{}) error
+}
+
+type hookSvc struct {
+	determinism
+	repo   repositories.HookRepository
+	links  repositories.ShortenerRepository
+	client *outbound.Client
+	pool   *tasks.Pool
+}
+
+// NewHookService delivers hooks with client on pool, which retries failed
+// deliveries. Clicks are only published for links in links whose stats are
+// public.
+func NewHookService(repo repositories.HookRepository, links repositories.ShortenerRepository, client *outbound.Client, pool *tasks.Pool) HookService {
+	return &hookSvc{repo: repo, links: links, client: client, pool: pool}
+}
+
+func (s *hookSvc) Subscribe(event, targetURL string) (*shortner.Hook, error) {
+	if !supportedEvents[event] {
+		return nil, validationError("event", fmt.Sprintf("unsupported event '%s'", event))
+	}
+	if !isHTTPURL(targetURL) {
+		return nil, invalidURLError("target_url", "invalid target URL format provided")
+	}
+
+	id, err := s.repo.CreateHook(event, targetURL)
+	if err != nil {
+		log.Printf("Service error saving hook for event '%s': %v", event, err)
+		return nil, fmt.Errorf("service failed to save hook: %w", err)
+	}
+	log.Printf("Service subscribed hook %d: %s -> %s", id, event, targetURL)
+	return &shortner.Hook{ID: id, Event: event, TargetURL: targetURL, CreatedAt: s.now()}, nil
+}
+
+func (s *hookSvc) Unsubscribe(id int64) error {
+	if err := s.repo.DeleteHook(id); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeHookNotFound, "hook not found")
+		}
+		return fmt.Errorf("service failed to delete hook: %w", err)
+	}
+	log.Printf("Service unsubscribed hook %d", id)
+	return nil
+}
+
+func (s *hookSvc) ListHooks() ([]shortner.Hook, error) {
+	hooks, err := s.repo.ListHooks()
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list hooks: %w", err)
+	}
+	return hooks, nil
+}
+
+// Publish delivers the event to every subscriber in the background. A
+// subscriber answering 410 Gone is unsubscribed, as the REST hooks
+// convention (used by Zapier) expects; network errors, 429 and 5xx answers
+// are retried.
+func (s *hookSvc) Publish(event string, payload interface{}) {
+	hooks, err := s.repo.ListHooksByEvent(event)
+	if err != nil {
+		log.Printf("Service error loading hooks for event '%s': %v", event, err)
+		return
+	}
+	if len(hooks) == 0 || !s.public(event, payload) {
+		return
+	}
+
+	body, err := eventBody(event, payload)
+	if err != nil {
+		log.Printf("Service error marshalling payload for event '%s': %v", event, err)
+		return
+	}
+
+	for _, hook := range hooks {
+		s.pool.Submit(fmt.Sprintf("hook %d delivery of %s", hook.ID, event), func() error {
+			return s.deliver(hook, body)
+		})
+	}
+}
+
+func (s *hookSvc) Replay(event string, payload interface{}) error {
+	hooks, err := s.repo.ListHooksByEvent(event)
+	if err != nil {
+		return fmt.Errorf("service failed to load hooks for event '%s': %w", event, err)
+	}
+	if len(hooks) == 0 || !s.public(event, payload) {
+		return nil
+	}
+	body, err := eventBody(event, payload)
+	if err != nil {
+		return fmt.Errorf("service failed to marshal payload for event '%s': %w", event, err)
+	}
+	for _, hook := range hooks {
+		if err := s.deliver(hook, body); err != nil {
+			return fmt.Errorf("hook %d: %w", hook.ID, err)
+		}
+	}
+	return nil
+}
+
+// public reports whether payload may be sent to subscribers: a click only
+// when the stats of its link are public, as they would otherwise be behind
+// the link's stats token or credentials.
+func (s *hookSvc) public(event string, payload interface{}) bool {
+	click, ok := payload.(shortner.Click)
+	if event != EventClickCreated || !ok {
+		return true
+	}
+	mapping, err := s.links.GetMapping(click.ShortCode)
+	if err != nil {
+		if !errors.Is(err, repositories.ErrNotFound) {
+			log.Printf("Service error loading link '%s' for event '%s': %v", click.ShortCode, event, err)
+		}
+		return false
+	}
+	return mapping.StatsVisibility == shortner.StatsPublic
+}
+
+// eventBody is the JSON subscribers receive for an event.
+func eventBody(event string, payload interface{}) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"event": event, "data": payload})
+}
+
+func (s *hookSvc) deliver(hook shortner.Hook, body []byte) error {
+	resp, err := s.client.Post(context.Background(), "webhook", hook.TargetURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		if errors.Is(err, outbound.ErrBlockedAddress) {
+			return tasks.Permanent(fmt.Errorf("delivery to %s refused: %w", hook.TargetURL, err))
+		}
+		return fmt.Errorf("delivery to %s failed: %w", hook.TargetURL, err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		log.Printf("Hook %d target answered 410 Gone, unsubscribing", hook.ID)
+		if err := s.repo.DeleteHook(hook.ID); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			log.Printf("Failed to remove gone hook %d: %v", hook.ID, err)
+		}
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("delivery to %s returned status %d", hook.TargetURL, resp.StatusCode)
+	case resp.StatusCode >= 300:
+		return tasks.Permanent(fmt.Errorf("delivery to %s returned status %d", hook.TargetURL, resp.StatusCode))
+	}
+	return nil
+}
+
+type noopPublisher struct{}
+
+func (noopPublisher) Publish(string, interface{}) {}
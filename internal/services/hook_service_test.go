@@ -0,0 +1,64 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"template/internal/pkg/metrics"
+	"template/internal/pkg/outbound"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+func TestHookClicksOnlyForPublicStats(t *testing.T) {
+	db := openTestDB(t)
+	links := repositories.NewSQLiteShortenerRepo(db, false)
+	hooks := repositories.NewSQLiteHookRepo(db)
+	for _, repo := range []interface{ InitSchema() error }{links, hooks} {
+		if err := repo.InitSchema(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for code, visibility := range map[string]string{"pub": shortner.StatsPublic, "priv": shortner.StatsPrivate, "tok": shortner.StatsToken} {
+		mapping := shortner.URLMapping{ShortCode: code, LongURL: "https://example.com", StatsVisibility: visibility}
+		if _, err := links.CreateMapping(mapping); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var delivered atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered.Add(1)
+	}))
+	defer target.Close()
+	client := outbound.New(outbound.Options{Timeout: time.Second, AllowPrivate: true}, metrics.NewRegistry(nil))
+	svc := NewHookService(hooks, links, client, nil)
+	for _, event := range []string{EventClickCreated, EventLinkCreated} {
+		if _, err := svc.Subscribe(event, target.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		event   string
+		payload interface{}
+		want    int32
+	}{
+		{EventClickCreated, shortner.Click{ShortCode: "pub"}, 1},
+		{EventClickCreated, shortner.Click{ShortCode: "priv"}, 0},
+		{EventClickCreated, shortner.Click{ShortCode: "tok"}, 0},
+		{EventClickCreated, shortner.Click{ShortCode: "gone"}, 0},
+		{EventLinkCreated, shortner.URLMapping{ShortCode: "priv"}, 1},
+	} {
+		delivered.Store(0)
+		if err := svc.Replay(tt.event, tt.payload); err != nil {
+			t.Fatal(err)
+		}
+		if got := delivered.Load(); got != tt.want {
+			t.Errorf("%s %+v: %d deliveries, want %d", tt.event, tt.payload, got, tt.want)
+		}
+	}
+}
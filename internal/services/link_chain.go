@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"template/internal/pkg/outbound"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	chainedLinksFlag    = "flag"
+	chainedLinksReject  = "reject"
+	chainedLinksResolve = "resolve"
+
+	defaultMaxChainDepth = 5
+	chainLookupTimeout   = 5 * time.Second
+	// maxLoopLookups bounds the links checkLoop reads for one link.
+	maxLoopLookups = 100
+)
+
+// SetOutboundClient gives the service the client it resolves links on
+// other shorteners with. Without one, such links are kept as they are even
+// when ChainedLinks is "resolve"; links on BaseURL are resolved either way.
+func (s *shortenerSvc) SetOutboundClient(client *outbound.Client) {
+	s.client = client
+}
+
+// followChain applies the chained link policy to a normalized destination.
+func (s *shortenerSvc) followChain(field, destination string) (string, error) {
+	policy := s.policy.Load()
+	ctx, cancel := context.WithTimeout(context.Background(), chainLookupTimeout)
+	defer cancel()
+
+	current := destination
+	for depth := 0; policy.shortLink(current); depth++ {
+		switch policy.chainedLinks {
+		case chainedLinksReject:
+			return "", chainedLinkError(field, fmt.Sprintf("%s is itself a short link; link to its destination instead", current))
+		case chainedLinksResolve:
+		default:
+			log.Printf("Service flagged destination '%s': it is a short link", destination)
+			return destination, nil
+		}
+		if depth == policy.maxChainDepth {
+			return "", chainedLinkError(field, fmt.Sprintf("%s leads through more than %d short links", destination, policy.maxChainDepth))
+		}
+		next, err := s.resolveHop(ctx, policy, current)
+		if err != nil {
+			log.Printf("Service could not resolve short link '%s', keeping it: %v", current, err)
+			return current, nil
+		}
+		if next == "" {
+			return current, nil
+		}
+		if !s.ValidateURL(next) {
+			log.Printf("Service keeping short link '%s': it leads to unsupported '%s'", current, next)
+			return current, nil
+		}
+		if current, err = s.normalizeDestination(field, next); err != nil {
+			return "", err
+		}
+	}
+	if current != destination {
+		log.Printf("Service resolved short link '%s' to '%s'", destination, current)
+	}
+	return current, nil
+}
+
+// shortLink reports whether destination is a link on this service or on one
+// of the known shorteners.
+func (p *compiledPolicy) shortLink(destination string) bool {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if _, ok := p.ownCode(u); ok {
+		return true
+	}
+	return u.Path != "" && u.Path != "/" && onDomain(host, p.shortenerDomains)
+}
+
+// ownCode returns the short code of u when u is a link on BaseURL.
+func (p *compiledPolicy) ownCode(u *url.URL) (string, bool) {
+	if p.ownHost == "" || strings.TrimSuffix(strings.ToLower(u.Hostname()), ".") != p.ownHost {
+		return "", false
+	}
+	code, ok := strings.CutPrefix(u.Path, p.ownPath+"/")
+	if !ok || code == "" || strings.Contains(code, "/") || strings.HasSuffix(code, "+") {
+		return "", false
+	}
+	return code, true
+}
+
+// resolveHop returns where the short link current leads, or "" when it
+// does not simply redirect: links on this service of another kind or whose
+// destination varies (by language, time, country, or expiry) are kept.
+func (s *shortenerSvc) resolveHop(ctx context.Context, policy *compiledPolicy, current string) (string, error) {
+	u, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	if code, ok := policy.ownCode(u); ok {
+		mapping, err := s.repo.GetMapping(code)
+		if errors.Is(err, repositories.ErrNotFound) {
+			return "", fmt.Errorf("no short link %s", code)
+		}
+		if err != nil {
+			return "", err
+		}
+		if !fixedRedirect(mapping) {
+			return "", nil
+		}
+		return mapping.LongURL, nil
+	}
+
+	if s.client == nil {
+		return "", errors.New("no outbound client")
+	}
+	ctx = outbound.NoRedirects(ctx)
+	resp, err := s.client.Head(ctx, "link_chain", current)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = s.client.Get(ctx, "link_chain", current)
+	}
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	location := resp.Header.Get("Location")
+	if resp.StatusCode < 300 || resp.StatusCode > 399 || location == "" {
+		return "", nil
+	}
+	next, err := u.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	return next.String(), nil
+}
+
+// fixedRedirect reports whether mapping always redirects everyone to
+// LongURL, so linking to it directly changes nothing for visitors.
+func fixedRedirect(mapping *shortner.URLMapping) bool {
+	return mapping.Kind == shortner.KindRedirect && mapping.ExpiresAt == nil && !mapping.SingleUse &&
+		len(mapping.LanguageTargets) == 0 && len(mapping.TimeRules) == 0 &&
+		len(mapping.AllowedCountries) == 0 && len(mapping.BlockedCountries) == 0
+}
+
+// checkLoop refuses mapping when a destination leads back to it, or into
+// a loop, through links on BaseURL. A mapping without a code yet can only
+// lead into an existing loop.
+func (s *shortenerSvc) checkLoop(mapping *shortner.URLMapping) error {
+	policy := s.policy.Load()
+	if policy.ownHost == "" || mapping.Kind != shortner.KindRedirect {
+		return nil
+	}
+	path := map[string]bool{}
+	if mapping.ShortCode != "" {
+		path[mapping.ShortCode] = true
+	}
+	w := loopWalk{s: s, policy: policy, path: path, done: map[string]bool{}, budget: maxLoopLookups}
+	for _, destination := range mapping.Destinations() {
+		if err := w.visit(destination); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loopWalk is a depth-first walk through the links on BaseURL; path holds
+// the links on the way to the current one, done the ones without loops.
+type loopWalk struct {
+	s      *shortenerSvc
+	policy *compiledPolicy
+	path   map[string]bool
+	done   map[string]bool
+	budget int
+}
+
+func (w *loopWalk) visit(destination string) error {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil
+	}
+	code, ok := w.policy.ownCode(u)
+	if !ok || w.budget == 0 {
+		return nil
+	}
+	w.budget--
+	mapping, err := w.s.repo.GetMapping(code)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Service error loading '%s' to check for redirect loops: %v", code, err)
+		return fmt.Errorf("service failed to check for redirect loops: %w", err)
+	}
+	if w.path[mapping.ShortCode] {
+		return &Error{
+			Code:    CodeRedirectLoop,
+			Message: fmt.Sprintf("%s redirects in a loop", destination),
+			Fields:  []FieldError{{Field: "url", Message: "destination redirects in a loop"}},
+		}
+	}
+	if w.done[mapping.ShortCode] || mapping.Kind != shortner.KindRedirect {
+		return nil
+	}
+	w.path[mapping.ShortCode] = true
+	for _, next := range mapping.Destinations() {
+		if err := w.visit(next); err != nil {
+			return err
+		}
+	}
+	delete(w.path, mapping.ShortCode)
+	w.done[mapping.ShortCode] = true
+	return nil
+}
+
+func chainedLinkError(field, message string) *Error {
+	return &Error{
+		Code:    CodeChainedLink,
+		Message: message,
+		Fields:  []FieldError{{Field: field, Message: "destination is a short link"}},
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"template/internal/pkg/metrics"
+	"template/internal/pkg/outbound"
+	"template/internal/usecases/shortner"
+)
+
+// chainShortener is sqliteShortener with the chained link policy mode and
+// links "a" to "b" to example.com/end on https://sho.rt.
+func chainShortener(t *testing.T, mode string) *shortenerSvc {
+	t.Helper()
+	s := sqliteShortener(t, openTestDB(t))
+	s.SetPolicy(LinkPolicy{PrivateDestinations: privateDestinationsAllow, ChainedLinks: mode, BaseURL: "https://sho.rt", MaxChainDepth: 3})
+	links := []shortner.URLMapping{
+		{ShortCode: "a", LongURL: "https://sho.rt/b"},
+		{ShortCode: "b", LongURL: "https://example.com/end"},
+		{ShortCode: "loop1", LongURL: "https://sho.rt/loop2"},
+		{ShortCode: "loop2", LongURL: "https://sho.rt/loop1"},
+		{ShortCode: "timed", LongURL: "https://example.com/day", TimeRules: []shortner.TimeRule{{From: "18:00", To: "09:00", URL: "https://example.com/night"}}},
+	}
+	for _, link := range links {
+		if _, err := s.repo.CreateMapping(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestResolveOwnChain(t *testing.T) {
+	s := chainShortener(t, chainedLinksResolve)
+	tests := []struct {
+		destination string
+		want        string
+	}{
+		{"https://sho.rt/a", "https://example.com/end"},
+		{"https://SHO.RT/b", "https://example.com/end"},
+		// Where a link with time rules leads varies, so it is kept.
+		{"https://sho.rt/timed", "https://sho.rt/timed"},
+		{"https://sho.rt/api/v1/links", "https://sho.rt/api/v1/links"},
+	}
+	for _, tt := range tests {
+		got, err := s.NormalizeDestination("url", tt.destination)
+		if err != nil {
+			t.Errorf("%s: %v", tt.destination, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s resolved to %s, want %s", tt.destination, got, tt.want)
+		}
+	}
+	if _, err := s.NormalizeDestination("url", "https://sho.rt/loop1"); !errors.Is(err, &Error{Code: CodeChainedLink}) {
+		t.Errorf("looping chain error = %v, want CHAINED_LINK", err)
+	}
+}
+
+func TestRejectChainedLinks(t *testing.T) {
+	s := chainShortener(t, chainedLinksReject)
+	if _, err := s.CreateShortURL("https://sho.rt/b"); !errors.Is(err, &Error{Code: CodeChainedLink}) {
+		t.Errorf("CreateShortURL error = %v, want CHAINED_LINK", err)
+	}
+	if _, err := s.CreateShortURL("https://bit.ly/x"); err != nil {
+		t.Errorf("a shortener outside ShortenerDomains was refused: %v", err)
+	}
+
+	// Merges point links at their canonical short link on purpose.
+	merged := "https://sho.rt/b"
+	if err := s.UpdateLink("a", shortner.LinkUpdate{LongURL: &merged, Source: shortner.RevisionSourceMerge}); err != nil {
+		t.Errorf("merge update: %v", err)
+	}
+}
+
+func TestResolveShortenerChain(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/abc":
+			http.Redirect(w, r, "/def", http.StatusMovedPermanently)
+		case "/def":
+			http.Redirect(w, r, "https://example.com/landing", http.StatusFound)
+		case "/get-only":
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			http.Redirect(w, r, "https://example.com/got", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+	hostname, _, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	s := sqliteShortener(t, openTestDB(t))
+	s.SetPolicy(LinkPolicy{PrivateDestinations: privateDestinationsAllow, ChainedLinks: chainedLinksResolve, ShortenerDomains: []string{hostname}})
+	s.SetOutboundClient(outbound.New(outbound.Options{Timeout: time.Second, MaxRedirects: 10, AllowPrivate: true}, metrics.NewRegistry(nil)))
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/abc", "https://example.com/landing"},
+		{"/get-only", "https://example.com/got"},
+		{"/page", server.URL + "/page"},
+	}
+	for _, tt := range tests {
+		got, err := s.NormalizeDestination("url", server.URL+tt.path)
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s resolved to %s, want %s", tt.path, got, tt.want)
+		}
+	}
+
+	// A shortener that cannot be reached is kept rather than refused.
+	s.SetOutboundClient(nil)
+	destination := server.URL + "/abc"
+	if got, err := s.NormalizeDestination("url", destination); err != nil || got != destination {
+		t.Errorf("without a client: %s, %v, want %s kept", got, err, destination)
+	}
+}
+
+func TestRefuseRedirectLoops(t *testing.T) {
+	s := chainShortener(t, chainedLinksFlag)
+	if _, err := s.CreateLink(shortner.URLMapping{LongURL: "https://sho.rt/loop1"}); !errors.Is(err, &Error{Code: CodeRedirectLoop}) {
+		t.Errorf("link into a loop: error = %v, want REDIRECT_LOOP", err)
+	}
+	back := "https://sho.rt/a"
+	if err := s.UpdateLink("b", shortner.LinkUpdate{LongURL: &back}); !errors.Is(err, &Error{Code: CodeRedirectLoop}) {
+		t.Errorf("b to a, which leads to b: error = %v, want REDIRECT_LOOP", err)
+	}
+	rules := []shortner.TimeRule{{URL: "https://sho.rt/a"}}
+	if err := s.UpdateLink("b", shortner.LinkUpdate{TimeRules: rules}); !errors.Is(err, &Error{Code: CodeRedirectLoop}) {
+		t.Errorf("time rule back to a: error = %v, want REDIRECT_LOOP", err)
+	}
+
+	// Two ways to the same link are not a loop.
+	code, err := s.CreateLink(shortner.URLMapping{LongURL: "https://sho.rt/a", LanguageTargets: map[string]string{"de": "https://sho.rt/b"}})
+	if err != nil {
+		t.Fatalf("link with two ways to b: %v", err)
+	}
+	if err := s.UpdateLink(code, shortner.LinkUpdate{LongURL: &back}); err != nil {
+		t.Errorf("update without a loop: %v", err)
+	}
+}
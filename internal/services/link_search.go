@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	maxSearchQueryLength = 200
+	maxSearchTerms       = 10
+	maxSearchPageSize    = 100
+	maxSearchOffset      = 1000
+)
+
+// SearchLinks ignores words without a letter or digit, such as a lone
+// "/", since they match nothing the index holds.
+func (s *shortenerSvc) SearchLinks(ctx context.Context, query string, page shortner.SearchPage) ([]shortner.URLMapping, error) {
+	if len(query) > maxSearchQueryLength {
+		return nil, validationError("q", fmt.Sprintf("search query must be at most %d bytes", maxSearchQueryLength))
+	}
+	var terms []string
+	for _, term := range strings.Fields(query) {
+		if strings.IndexFunc(term, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			terms = append(terms, term)
+		}
+	}
+	if len(terms) == 0 {
+		return nil, validationError("q", "search query must contain a letter or digit")
+	}
+	if len(terms) > maxSearchTerms {
+		return nil, validationError("q", fmt.Sprintf("search query must have at most %d words", maxSearchTerms))
+	}
+	if page.Limit <= 0 || page.Limit > maxSearchPageSize {
+		page.Limit = maxSearchPageSize
+	}
+	if page.Offset < 0 || page.Offset > maxSearchOffset {
+		return nil, validationError("cursor", fmt.Sprintf("search results are available up to the first %d", maxSearchOffset))
+	}
+
+	err := repositories.ErrSearchUnsupported
+	var mappings []shortner.URLMapping
+	if searcher, ok := s.repo.(repositories.LinkSearcher); ok {
+		mappings, err = searcher.Search(ctx, strings.Join(terms, " "), page)
+	}
+	if err != nil {
+		if errors.Is(err, repositories.ErrSearchUnsupported) {
+			return nil, ErrSearchUnavailable
+		}
+		log.Printf("Service error searching links: %v", err)
+		return nil, fmt.Errorf("service failed to search links: %w", err)
+	}
+	return mappings, nil
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+func TestSearchLinks(t *testing.T) {
+	s := sqliteShortener(t, openTestDB(t))
+	for _, url := range []string{"https://example.com/pricing", "https://example.org/blog"} {
+		if _, err := s.CreateShortURL(url); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Words without a letter or digit are dropped rather than failing the
+	// search or matching everything.
+	links, err := s.SearchLinks(context.Background(), "pricing /", shortner.SearchPage{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].LongURL != "https://example.com/pricing" {
+		t.Errorf("SearchLinks(pricing /) = %+v, want the pricing link", links)
+	}
+
+	for _, query := range []string{"", " / ", strings.Repeat("a ", maxSearchTerms+1), strings.Repeat("a", maxSearchQueryLength+1)} {
+		if _, err := s.SearchLinks(context.Background(), query, shortner.SearchPage{}); !errors.Is(err, ErrValidationFailed) {
+			t.Errorf("SearchLinks(%q) error = %v, want a validation error", query, err)
+		}
+	}
+	if _, err := s.SearchLinks(context.Background(), "blog", shortner.SearchPage{Offset: maxSearchOffset + 1}); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("SearchLinks past the last page error = %v, want a validation error", err)
+	}
+}
+
+func TestSearchLinksUnsupported(t *testing.T) {
+	repo := repositories.NewSQLiteShortenerRepo(openTestDB(t), false)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	sharded := repositories.NewShardedShortenerRepo([]repositories.ShortenerRepository{repo})
+	s := NewShortenerService(sharded, nil, nil, nil, nil)
+	if _, err := s.SearchLinks(context.Background(), "blog", shortner.SearchPage{}); !errors.Is(err, ErrSearchUnavailable) {
+		t.Errorf("SearchLinks on shards error = %v, want %s", err, CodeSearchUnavailable)
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	maintenanceSetting = "maintenance"
+
+	maxMaintenanceMessageRunes = 500
+	maxMaintenanceRetryAfter   = 24 * 60 * 60
+)
+
+// MaintenanceModeService switches the service into maintenance mode, for
+// migrations and backups: mutations are refused while redirects keep
+// working. The state is stored with the settings, so every instance
+// follows it, and can be held on with MAINTENANCE_MODE.
+type MaintenanceModeService interface {
+	// Maintenance returns the state for answering a request, cached; a
+	// failed load keeps the last known state.
+	Maintenance() shortner.Maintenance
+	GetMaintenance() (*shortner.Maintenance, error)
+	// SetMaintenance saves the state. A zero RetryAfter takes the default.
+	SetMaintenance(m shortner.Maintenance) (*shortner.Maintenance, error)
+}
+
+type maintenanceModeSvc struct {
+	determinism
+	repo       repositories.SettingsRepository
+	forced     bool
+	retryAfter time.Duration
+	ttl        time.Duration
+
+	mu       sync.Mutex
+	cached   *shortner.Maintenance
+	loadedAt time.Time
+}
+
+// NewMaintenanceModeService creates the service. forced holds maintenance
+// mode on; retryAfter is the default Retry-After. The state is cached for
+// ttl (30s when zero), like the branding.
+func NewMaintenanceModeService(repo repositories.SettingsRepository, forced bool, retryAfter, ttl time.Duration) MaintenanceModeService {
+	if ttl <= 0 {
+		ttl = defaultPolicyCacheTTL
+	}
+	return &maintenanceModeSvc{repo: repo, forced: forced, retryAfter: retryAfter, ttl: ttl}
+}
+
+func (s *maintenanceModeSvc) Maintenance() shortner.Maintenance {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cached == nil || now.Sub(s.loadedAt) >= s.ttl {
+		s.loadedAt = now
+		m, err := s.GetMaintenance()
+		switch {
+		case err == nil:
+			s.cached = m
+		case s.cached == nil:
+			s.cached = s.defaults()
+		}
+	}
+	return *s.cached
+}
+
+func (s *maintenanceModeSvc) GetMaintenance() (*shortner.Maintenance, error) {
+	value, updatedAt, err := s.repo.GetSetting(maintenanceSetting)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return s.defaults(), nil
+	}
+	if err != nil {
+		log.Printf("Service error loading maintenance mode: %v", err)
+		return nil, fmt.Errorf("service failed to load maintenance mode: %w", err)
+	}
+	var m shortner.Maintenance
+	if err := json.Unmarshal([]byte(value), &m); err != nil {
+		return nil, fmt.Errorf("service failed to decode maintenance mode: %w", err)
+	}
+	m.UpdatedAt = &updatedAt
+	s.apply(&m)
+	return &m, nil
+}
+
+func (s *maintenanceModeSvc) SetMaintenance(m shortner.Maintenance) (*shortner.Maintenance, error) {
+	m.Message = strings.TrimSpace(m.Message)
+	if len([]rune(m.Message)) > maxMaintenanceMessageRunes {
+		return nil, validationError("message", fmt.Sprintf("message must be at most %d characters", maxMaintenanceMessageRunes))
+	}
+	if m.RetryAfter < 0 || m.RetryAfter > maxMaintenanceRetryAfter {
+		return nil, validationError("retry_after", fmt.Sprintf("retry_after must be between 0 and %d seconds", maxMaintenanceRetryAfter))
+	}
+	m.Forced, m.UpdatedAt = false, nil
+	value, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to encode maintenance mode: %w", err)
+	}
+	now := s.now()
+	if err := s.repo.SaveSetting(maintenanceSetting, string(value), now); err != nil {
+		log.Printf("Service error saving maintenance mode: %v", err)
+		return nil, fmt.Errorf("service failed to save maintenance mode: %w", err)
+	}
+	m.UpdatedAt = &now
+	s.apply(&m)
+
+	s.mu.Lock()
+	s.cached = nil
+	s.mu.Unlock()
+	log.Printf("Service set maintenance mode: enabled %t", m.Enabled)
+	return &m, nil
+}
+
+// defaults is the state when none is saved.
+func (s *maintenanceModeSvc) defaults() *shortner.Maintenance {
+	m := &shortner.Maintenance{}
+	s.apply(m)
+	return m
+}
+
+// apply fills in the default Retry-After and MAINTENANCE_MODE.
+func (s *maintenanceModeSvc) apply(m *shortner.Maintenance) {
+	if m.RetryAfter == 0 {
+		m.RetryAfter = int(s.retryAfter.Seconds())
+	}
+	if s.forced {
+		m.Enabled, m.Forced = true, true
+	}
+}
@@ -0,0 +1,318 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	reapBatchSize      = 100
+	backupFilePrefix   = "backup-"
+	backupFileSuffix   = ".db"
+	backupFileTimeForm = "20060102T150405Z"
+)
+
+// LinkCleaner removes the data a link kind keeps outside the urls table. It
+// is called before an expired link of that kind is deleted, and when a
+// deleted link is purged from the trash.
+type LinkCleaner interface {
+	CleanupLink(mapping shortner.URLMapping) error
+}
+
+// BackupOptions configures Backup. Backups are disabled when Dir is empty;
+// only the newest Keep backup files are retained.
+type BackupOptions struct {
+	Dir  string
+	Keep int
+}
+
+// MaintenanceService holds the housekeeping jobs: deleting links that
+// expired more than the retention period ago, database backups and health
+// checks of the dependencies. It is itself a LinkCleaner that hands each
+// link to the cleaner registered for its kind.
+type MaintenanceService interface {
+	LinkCleaner
+	RegisterCleaner(kind string, cleaner LinkCleaner)
+	ReapExpired(now time.Time) (int, error)
+	Backup(now time.Time) (string, error)
+	AddHealthCheck(name string, critical bool, check func() error)
+	CheckHealth() error
+	Health() HealthReport
+}
+
+// Component health states. A check reports ComponentDisabled by returning
+// ErrComponentDisabled, for integrations that are not configured.
+const (
+	ComponentUp       = "up"
+	ComponentDown     = "down"
+	ComponentDisabled = "disabled"
+)
+
+// Overall health states: down when a critical component is down, degraded
+// when only optional ones are.
+const (
+	HealthUp       = "up"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+// healthCacheTTL is how long Health reuses the results of the last checks,
+// so frequent readiness probes do not hammer the dependencies.
+const healthCacheTTL = 5 * time.Second
+
+var ErrComponentDisabled = errors.New("component is not configured")
+
+// ComponentHealth is the outcome of one component's health check.
+type ComponentHealth struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HealthReport is the health of every component at CheckedAt.
+type HealthReport struct {
+	Status     string            `json:"status"`
+	Components []ComponentHealth `json:"components"`
+	CheckedAt  time.Time         `json:"checked_at"`
+}
+
+type healthCheck struct {
+	name     string
+	critical bool
+	check    func() error
+}
+
+type maintenanceSvc struct {
+	links     repositories.ShortenerRepository
+	db        repositories.MaintenanceRepository
+	retention time.Duration
+	backup    BackupOptions
+
+	mu         sync.Mutex
+	cleaners   map[string]LinkCleaner
+	checks     []healthCheck
+	lastHealth *HealthReport
+}
+
+func NewMaintenanceService(links repositories.ShortenerRepository, db repositories.MaintenanceRepository, retention time.Duration, backup BackupOptions) MaintenanceService {
+	return &maintenanceSvc{
+		links:     links,
+		db:        db,
+		retention: retention,
+		backup:    backup,
+		cleaners:  make(map[string]LinkCleaner),
+	}
+}
+
+func (s *maintenanceSvc) RegisterCleaner(kind string, cleaner LinkCleaner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cleaners[kind] = cleaner
+}
+
+// CleanupLink runs the cleaner registered for the link's kind, if any.
+func (s *maintenanceSvc) CleanupLink(mapping shortner.URLMapping) error {
+	s.mu.Lock()
+	cleaner := s.cleaners[mapping.Kind]
+	s.mu.Unlock()
+	if cleaner == nil {
+		return nil
+	}
+	return cleaner.CleanupLink(mapping)
+}
+
+// ReapExpired deletes the links that expired before now minus the
+// retention period, together with their pastes, files or bundle items, and
+// returns how many were deleted. Until then an expired link keeps answering
+// 410 Gone. A link whose cleanup fails is kept and retried on the next run.
+func (s *maintenanceSvc) ReapExpired(now time.Time) (int, error) {
+	cutoff := now.Add(-s.retention)
+	reaped, failed := 0, 0
+	for {
+		err := repositories.ErrListUnsupported
+		var expired []shortner.URLMapping
+		if lister, ok := s.links.(repositories.LinkLister); ok {
+			expired, err = lister.ListExpired(cutoff, reapBatchSize)
+		}
+		if errors.Is(err, repositories.ErrListUnsupported) {
+			// The links expire all the same; they are only kept.
+			log.Println("Service: the link storage cannot list expired links, skipping the cleanup")
+			return reaped, nil
+		}
+		if err != nil {
+			log.Printf("Service error listing expired links: %v", err)
+			return reaped, fmt.Errorf("service failed to list expired links: %w", err)
+		}
+		// Failed links stay in the table and come back first in the next
+		// batch, so stop once a batch makes no progress.
+		progress := false
+		for _, mapping := range expired {
+			if err := s.reap(mapping); err != nil {
+				log.Printf("Service error reaping expired link '%s': %v", mapping.ShortCode, err)
+				failed++
+				continue
+			}
+			reaped++
+			progress = true
+		}
+		if len(expired) < reapBatchSize || !progress {
+			break
+		}
+	}
+	if reaped > 0 {
+		log.Printf("Service reaped %d expired links", reaped)
+	}
+	if failed > 0 {
+		return reaped, fmt.Errorf("%d expired links could not be reaped", failed)
+	}
+	return reaped, nil
+}
+
+func (s *maintenanceSvc) reap(mapping shortner.URLMapping) error {
+	if err := s.CleanupLink(mapping); err != nil {
+		return err
+	}
+	if err := s.links.DeleteMapping(mapping.ShortCode); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Backup writes a snapshot of the database to the backup directory and
+// removes the oldest backups beyond the configured number. It returns the
+// path of the new backup.
+func (s *maintenanceSvc) Backup(now time.Time) (string, error) {
+	if s.backup.Dir == "" {
+		return "", errors.New("backups are disabled (BACKUP_DIR is not set)")
+	}
+	if err := os.MkdirAll(s.backup.Dir, 0755); err != nil {
+		return "", fmt.Errorf("service failed to create backup directory: %w", err)
+	}
+
+	path := filepath.Join(s.backup.Dir, backupFilePrefix+now.UTC().Format(backupFileTimeForm)+backupFileSuffix)
+	start := time.Now()
+	if err := s.db.Backup(path); err != nil {
+		log.Printf("Service error backing up database to '%s': %v", path, err)
+		return "", fmt.Errorf("service failed to back up database: %w", err)
+	}
+	log.Printf("Service backed up database to '%s' in %s", path, time.Since(start).Round(time.Millisecond))
+
+	if err := s.pruneBackups(); err != nil {
+		log.Printf("Service error pruning old backups: %v", err)
+		return path, fmt.Errorf("service failed to prune old backups: %w", err)
+	}
+	return path, nil
+}
+
+func (s *maintenanceSvc) pruneBackups() error {
+	if s.backup.Keep <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(s.backup.Dir)
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasPrefix(name, backupFilePrefix) && strings.HasSuffix(name, backupFileSuffix) {
+			backups = append(backups, name)
+		}
+	}
+	// The timestamp format sorts chronologically.
+	sort.Strings(backups)
+	for len(backups) > s.backup.Keep {
+		if err := os.Remove(filepath.Join(s.backup.Dir, backups[0])); err != nil {
+			return err
+		}
+		log.Printf("Service removed old backup '%s'", backups[0])
+		backups = backups[1:]
+	}
+	return nil
+}
+
+func (s *maintenanceSvc) AddHealthCheck(name string, critical bool, check func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks = append(s.checks, healthCheck{name: name, critical: critical, check: check})
+}
+
+// CheckHealth runs every health check and reports the failing ones in a
+// single error. The database is always checked.
+func (s *maintenanceSvc) CheckHealth() error {
+	report := s.runChecks()
+	var failures []string
+	for _, c := range report.Components {
+		if c.Status == ComponentDown {
+			log.Printf("Service health check '%s' failed: %s", c.Name, c.Error)
+			failures = append(failures, fmt.Sprintf("%s: %s", c.Name, c.Error))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("unhealthy: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// Health returns the health of every component, checking them again when
+// the last results are older than healthCacheTTL.
+func (s *maintenanceSvc) Health() HealthReport {
+	s.mu.Lock()
+	last := s.lastHealth
+	s.mu.Unlock()
+	if last != nil && time.Since(last.CheckedAt) < healthCacheTTL {
+		return *last
+	}
+	return s.runChecks()
+}
+
+// runChecks runs the checks concurrently and remembers the report.
+func (s *maintenanceSvc) runChecks() HealthReport {
+	s.mu.Lock()
+	checks := append([]healthCheck{{name: "database", critical: true, check: s.db.Ping}}, s.checks...)
+	s.mu.Unlock()
+
+	components := make([]ComponentHealth, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			component := ComponentHealth{Name: c.name, Status: ComponentUp, Critical: c.critical}
+			if err := c.check(); errors.Is(err, ErrComponentDisabled) {
+				component.Status = ComponentDisabled
+			} else if err != nil {
+				component.Status, component.Error = ComponentDown, err.Error()
+			}
+			components[i] = component
+		}()
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: HealthUp, Components: components, CheckedAt: time.Now().UTC()}
+	for _, c := range components {
+		if c.Status != ComponentDown {
+			continue
+		}
+		if c.Critical {
+			report.Status = HealthDown
+		} else if report.Status == HealthUp {
+			report.Status = HealthDegraded
+		}
+	}
+	s.mu.Lock()
+	s.lastHealth = &report
+	s.mu.Unlock()
+	return report
+}
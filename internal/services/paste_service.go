@@ -0,0 +1,101 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+// PasteLimits bounds what a single paste may contain and how long it lives.
+type PasteLimits struct {
+	MaxBytes   int
+	DefaultTTL time.Duration
+	MaxTTL     time.Duration
+}
+
+type PasteService interface {
+	CreatePaste(content, format string, ttl time.Duration) (string, error)
+	GetPaste(shortCode string) (*shortner.Paste, error)
+	LinkCleaner
+}
+
+type pasteSvc struct {
+	determinism
+	links  ShortenerService
+	repo   repositories.PasteRepository
+	limits PasteLimits
+}
+
+func NewPasteService(links ShortenerService, repo repositories.PasteRepository, limits PasteLimits) PasteService {
+	return &pasteSvc{links: links, repo: repo, limits: limits}
+}
+
+// CreatePaste stores content behind a new code. A zero ttl means the
+// configured default; every paste expires, capped at the configured maximum.
+func (s *pasteSvc) CreatePaste(content, format string, ttl time.Duration) (string, error) {
+	if format == "" {
+		format = shortner.PasteFormatText
+	}
+	if format != shortner.PasteFormatText && format != shortner.PasteFormatMarkdown {
+		return "", validationError("format", fmt.Sprintf("unsupported format '%s' (expected text or markdown)", format))
+	}
+	if content == "" {
+		return "", validationError("content", "content must not be empty")
+	}
+	if len(content) > s.limits.MaxBytes {
+		return "", &Error{
+			Code:    CodePayloadTooLarge,
+			Message: fmt.Sprintf("content exceeds the maximum size of %d bytes", s.limits.MaxBytes),
+			Fields:  []FieldError{{Field: "content", Message: "too large"}},
+		}
+	}
+	if !utf8.ValidString(content) {
+		return "", validationError("content", "content must be valid UTF-8 text")
+	}
+	if ttl < 0 {
+		return "", validationError("expires_in", "expiry must not be negative")
+	}
+	if ttl == 0 {
+		ttl = s.limits.DefaultTTL
+	}
+	if s.limits.MaxTTL > 0 && ttl > s.limits.MaxTTL {
+		ttl = s.limits.MaxTTL
+	}
+	expiresAt := s.now().Add(ttl)
+
+	code, err := s.links.CreateLink(shortner.URLMapping{Kind: shortner.KindPaste, ExpiresAt: &expiresAt})
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.SavePaste(shortner.Paste{ShortCode: code, Format: format, Content: content}); err != nil {
+		log.Printf("Service error saving paste '%s': %v", code, err)
+		return "", fmt.Errorf("service failed to save paste: %w", err)
+	}
+
+	log.Printf("Service created %s paste '%s' (%d bytes, expires %s)", format, code, len(content), expiresAt.Format(time.RFC3339))
+	return code, nil
+}
+
+func (s *pasteSvc) GetPaste(shortCode string) (*shortner.Paste, error) {
+	paste, err := s.repo.GetPaste(shortCode)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, notFoundError(CodeLinkNotFound, "short code not found")
+		}
+		return nil, fmt.Errorf("service failed to load paste: %w", err)
+	}
+	return paste, nil
+}
+
+// CleanupLink deletes the content of an expired paste link.
+func (s *pasteSvc) CleanupLink(mapping shortner.URLMapping) error {
+	if err := s.repo.DeletePaste(mapping.ShortCode); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return fmt.Errorf("service failed to delete paste: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const maxPixelNameRunes = 100
+
+// pixelTagFormats is the accepted tag ID format for each provider.
+var pixelTagFormats = map[string]*regexp.Regexp{
+	shortner.PixelProviderFacebook: regexp.MustCompile(`^[0-9]{5,20}$`),
+	shortner.PixelProviderGoogle:   regexp.MustCompile(`^(G|AW|GT|DC)-[A-Z0-9]{4,20}$`),
+}
+
+// PixelService manages retargeting pixels. Pixels are shared by all links of
+// the deployment; links reference them by id.
+type PixelService interface {
+	CreatePixel(provider, tagID, name string) (*shortner.Pixel, error)
+	ListPixels() ([]shortner.Pixel, error)
+	DeletePixel(id int64) error
+	// CheckPixels fails with a validation error when any id is unknown.
+	CheckPixels(ids []int64) error
+	// ResolvePixels returns the pixels that still exist for the given ids.
+	ResolvePixels(ids []int64) ([]shortner.Pixel, error)
+}
+
+type pixelSvc struct {
+	determinism
+	repo repositories.PixelRepository
+}
+
+func NewPixelService(repo repositories.PixelRepository) PixelService {
+	return &pixelSvc{repo: repo}
+}
+
+func (s *pixelSvc) CreatePixel(provider, tagID, name string) (*shortner.Pixel, error) {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	format, ok := pixelTagFormats[provider]
+	if !ok {
+		return nil, validationError("provider", fmt.Sprintf("unsupported provider '%s' (expected facebook or google)", provider))
+	}
+	tagID = strings.TrimSpace(tagID)
+	if provider == shortner.PixelProviderGoogle {
+		tagID = strings.ToUpper(tagID)
+	}
+	if !format.MatchString(tagID) {
+		return nil, validationError("tag_id", fmt.Sprintf("invalid %s tag id '%s'", provider, tagID))
+	}
+	name = strings.TrimSpace(name)
+	if len([]rune(name)) > maxPixelNameRunes {
+		return nil, validationError("name", fmt.Sprintf("name must be at most %d characters", maxPixelNameRunes))
+	}
+
+	pixel := shortner.Pixel{Provider: provider, TagID: tagID, Name: name, CreatedAt: s.now()}
+	id, err := s.repo.CreatePixel(pixel)
+	if err != nil {
+		log.Printf("Service error saving %s pixel: %v", provider, err)
+		return nil, fmt.Errorf("service failed to save pixel: %w", err)
+	}
+	pixel.ID = id
+	log.Printf("Service created %s pixel %d (%s)", provider, id, tagID)
+	return &pixel, nil
+}
+
+func (s *pixelSvc) ListPixels() ([]shortner.Pixel, error) {
+	pixels, err := s.repo.ListPixels()
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list pixels: %w", err)
+	}
+	return pixels, nil
+}
+
+func (s *pixelSvc) DeletePixel(id int64) error {
+	if err := s.repo.DeletePixel(id); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodePixelNotFound, "pixel not found")
+		}
+		return fmt.Errorf("service failed to delete pixel: %w", err)
+	}
+	log.Printf("Service deleted pixel %d", id)
+	return nil
+}
+
+func (s *pixelSvc) CheckPixels(ids []int64) error {
+	pixels, err := s.ResolvePixels(ids)
+	if err != nil {
+		return err
+	}
+	found := make(map[int64]bool, len(pixels))
+	for _, p := range pixels {
+		found[p.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return validationError("pixel_ids", fmt.Sprintf("unknown pixel %d", id))
+		}
+	}
+	return nil
+}
+
+func (s *pixelSvc) ResolvePixels(ids []int64) ([]shortner.Pixel, error) {
+	pixels, err := s.repo.GetPixels(ids)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to load pixels: %w", err)
+	}
+	return pixels, nil
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"template/internal/pkg/idn"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	maxProfileItems       = 50
+	maxProfileNameRunes   = 100
+	maxProfileBioRunes    = 500
+	maxProfileTitleRunes  = 200
+	profileUsernameFormat = "username must be 2 to 30 letters, digits, '.', '-' or '_', starting with a letter or digit"
+)
+
+var profileUsernameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,29}$`)
+
+// ProfileService manages link-in-bio profiles: public pages at /@{username}
+// listing chosen short links. Usernames are case-insensitive and stored in
+// lower case.
+type ProfileService interface {
+	ListProfiles() ([]shortner.Profile, error)
+	GetProfile(username string) (*shortner.Profile, error)
+	// SaveProfile creates the profile or updates its display name and bio.
+	SaveProfile(profile shortner.Profile) (*shortner.Profile, error)
+	DeleteProfile(username string) error
+	ListItems(username string) ([]shortner.ProfileItem, error)
+	// AddItem lists the short link item.ShortCode on the profile. Without a
+	// title the item shows the link's title or destination; without a
+	// position it goes last.
+	AddItem(username string, item shortner.ProfileItem) (*shortner.ProfileItem, error)
+	UpdateItem(username string, item shortner.ProfileItem) error
+	DeleteItem(username string, itemID int64) error
+	// Page returns the profile and the items to show on its page, in
+	// order. Items whose links were deleted or have expired are left out.
+	Page(username string) (*shortner.Profile, []shortner.ProfileItem, error)
+	// FollowItem counts a click on the item and returns its short code.
+	FollowItem(username string, itemID int64) (string, error)
+}
+
+type profileSvc struct {
+	determinism
+	links ShortenerService
+	repo  repositories.ProfileRepository
+}
+
+func NewProfileService(links ShortenerService, repo repositories.ProfileRepository) ProfileService {
+	return &profileSvc{links: links, repo: repo}
+}
+
+func (s *profileSvc) ListProfiles() ([]shortner.Profile, error) {
+	profiles, err := s.repo.ListProfiles()
+	if err != nil {
+		log.Printf("Service error listing profiles: %v", err)
+		return nil, fmt.Errorf("service failed to list profiles: %w", err)
+	}
+	return profiles, nil
+}
+
+func (s *profileSvc) GetProfile(username string) (*shortner.Profile, error) {
+	profile, err := s.repo.GetProfile(strings.ToLower(username))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, notFoundError(CodeProfileNotFound, "profile not found")
+		}
+		return nil, fmt.Errorf("service failed to load profile: %w", err)
+	}
+	return profile, nil
+}
+
+func (s *profileSvc) SaveProfile(profile shortner.Profile) (*shortner.Profile, error) {
+	profile.Username = strings.ToLower(strings.TrimSpace(profile.Username))
+	profile.DisplayName = strings.TrimSpace(profile.DisplayName)
+	profile.Bio = strings.TrimSpace(profile.Bio)
+	if !profileUsernameRe.MatchString(profile.Username) {
+		return nil, validationError("username", profileUsernameFormat)
+	}
+	if len([]rune(profile.DisplayName)) > maxProfileNameRunes {
+		return nil, validationError("display_name", fmt.Sprintf("display_name must be at most %d characters", maxProfileNameRunes))
+	}
+	if len([]rune(profile.Bio)) > maxProfileBioRunes {
+		return nil, validationError("bio", fmt.Sprintf("bio must be at most %d characters", maxProfileBioRunes))
+	}
+
+	now := s.now()
+	profile.CreatedAt, profile.UpdatedAt = now, now
+	if err := s.repo.SaveProfile(profile); err != nil {
+		log.Printf("Service error saving profile '%s': %v", profile.Username, err)
+		return nil, fmt.Errorf("service failed to save profile: %w", err)
+	}
+	log.Printf("Service saved profile '%s'", profile.Username)
+	return s.GetProfile(profile.Username)
+}
+
+func (s *profileSvc) DeleteProfile(username string) error {
+	if err := s.repo.DeleteProfile(strings.ToLower(username)); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeProfileNotFound, "profile not found")
+		}
+		return fmt.Errorf("service failed to delete profile: %w", err)
+	}
+	log.Printf("Service deleted profile '%s'", username)
+	return nil
+}
+
+func (s *profileSvc) ListItems(username string) ([]shortner.ProfileItem, error) {
+	profile, err := s.GetProfile(username)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.repo.ListItems(profile.Username)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list profile items: %w", err)
+	}
+	return items, nil
+}
+
+func (s *profileSvc) AddItem(username string, item shortner.ProfileItem) (*shortner.ProfileItem, error) {
+	existing, err := s.ListItems(username)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxProfileItems {
+		return nil, validationError("items", fmt.Sprintf("a profile can list at most %d links", maxProfileItems))
+	}
+	if err := s.validateItem(&item); err != nil {
+		return nil, err
+	}
+
+	item.Username = strings.ToLower(username)
+	item.CreatedAt = s.now()
+	if item.Position == 0 && len(existing) > 0 {
+		item.Position = existing[len(existing)-1].Position + 1
+	}
+	id, err := s.repo.AddItem(item)
+	if err != nil {
+		log.Printf("Service error adding item to profile '%s': %v", item.Username, err)
+		return nil, fmt.Errorf("service failed to add profile item: %w", err)
+	}
+	item.ID = id
+	return &item, nil
+}
+
+func (s *profileSvc) UpdateItem(username string, item shortner.ProfileItem) error {
+	if err := s.validateItem(&item); err != nil {
+		return err
+	}
+	item.Username = strings.ToLower(username)
+	if err := s.repo.UpdateItem(item); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeProfileItemNotFound, "profile item not found")
+		}
+		return fmt.Errorf("service failed to update profile item: %w", err)
+	}
+	return nil
+}
+
+func (s *profileSvc) DeleteItem(username string, itemID int64) error {
+	if err := s.repo.DeleteItem(strings.ToLower(username), itemID); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeProfileItemNotFound, "profile item not found")
+		}
+		return fmt.Errorf("service failed to delete profile item: %w", err)
+	}
+	return nil
+}
+
+func (s *profileSvc) Page(username string) (*shortner.Profile, []shortner.ProfileItem, error) {
+	profile, err := s.GetProfile(username)
+	if err != nil {
+		return nil, nil, err
+	}
+	items, err := s.repo.ListItems(profile.Username)
+	if err != nil {
+		return nil, nil, fmt.Errorf("service failed to list profile items: %w", err)
+	}
+
+	now := s.now()
+	shown := make([]shortner.ProfileItem, 0, len(items))
+	for _, item := range items {
+		link, err := s.links.GetLink(item.ShortCode)
+		if errors.Is(err, repositories.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if link.Expired(now) {
+			continue
+		}
+		shown = append(shown, item)
+	}
+	return profile, shown, nil
+}
+
+func (s *profileSvc) FollowItem(username string, itemID int64) (string, error) {
+	username = strings.ToLower(username)
+	item, err := s.repo.GetItem(username, itemID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return "", notFoundError(CodeProfileItemNotFound, "profile item not found")
+		}
+		return "", fmt.Errorf("service failed to load profile item: %w", err)
+	}
+	// A lost count must not keep the visitor from the link.
+	if err := s.repo.CountClick(username, itemID); err != nil {
+		log.Printf("Service error counting click on profile item %s/%d: %v", username, itemID, err)
+	}
+	return item.ShortCode, nil
+}
+
+// validateItem checks that the item's link exists, stores its code as the
+// link has it and fills in a missing title.
+func (s *profileSvc) validateItem(item *shortner.ProfileItem) error {
+	item.Title = strings.TrimSpace(item.Title)
+	if len([]rune(item.Title)) > maxProfileTitleRunes {
+		return validationError("title", fmt.Sprintf("title must be at most %d characters", maxProfileTitleRunes))
+	}
+	if strings.TrimSpace(item.ShortCode) == "" {
+		return validationError("short_code", "short_code is required")
+	}
+	link, err := s.links.GetLink(strings.TrimSpace(item.ShortCode))
+	if err != nil {
+		return err
+	}
+	item.ShortCode = link.ShortCode
+	if item.Title == "" {
+		item.Title = link.Title
+	}
+	if item.Title == "" && link.LongURL != "" {
+		item.Title = idn.DisplayURL(link.LongURL)
+	}
+	if item.Title == "" {
+		item.Title = link.ShortCode
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+func TestProfiles(t *testing.T) {
+	db := openTestDB(t)
+	links := sqliteShortener(t, db)
+	repo := repositories.NewSQLiteProfileRepo(db)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	expired := testNow.Add(-time.Hour)
+	for _, link := range []shortner.URLMapping{
+		{ShortCode: "shop", LongURL: "https://example.com/shop", Title: "My shop"},
+		{ShortCode: "blog", LongURL: "https://example.com/blog"},
+		{ShortCode: "old", LongURL: "https://example.com/old", ExpiresAt: &expired},
+	} {
+		if _, err := links.repo.CreateMapping(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewProfileService(links, repo)
+	s.(Deterministic).SetClock(&fixedClock{now: testNow})
+
+	profile, err := s.SaveProfile(shortner.Profile{Username: " Ann.Maker ", DisplayName: "Ann", Bio: "I make things"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Username != "ann.maker" || profile.DisplayName != "Ann" || !profile.CreatedAt.Equal(testNow) {
+		t.Errorf("SaveProfile = %+v", profile)
+	}
+	for _, username := range []string{"a", "-ann", "ann maker", "ann@example"} {
+		if _, err := s.SaveProfile(shortner.Profile{Username: username}); !errors.Is(err, ErrValidationFailed) {
+			t.Errorf("SaveProfile(%q) error = %v, want a validation error", username, err)
+		}
+	}
+
+	var added []*shortner.ProfileItem
+	for _, item := range []shortner.ProfileItem{{ShortCode: "blog"}, {ShortCode: "shop"}, {ShortCode: "old", Title: "Old news"}} {
+		a, err := s.AddItem("ANN.MAKER", item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		added = append(added, a)
+	}
+	if added[0].Title != "https://example.com/blog" || added[1].Title != "My shop" || added[2].Position != 2 {
+		t.Errorf("added items = %+v %+v %+v, want titles from the links and positions in order", *added[0], *added[1], *added[2])
+	}
+	if _, err := s.AddItem("ann.maker", shortner.ProfileItem{ShortCode: "missing"}); !errors.Is(err, ErrLinkNotFound) {
+		t.Errorf("AddItem of an unknown link: error = %v, want LINK_NOT_FOUND", err)
+	}
+	if _, err := s.AddItem("nobody", shortner.ProfileItem{ShortCode: "shop"}); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("AddItem to an unknown profile: error = %v, want not found", err)
+	}
+
+	// Move the shop to the top.
+	if err := s.UpdateItem("ann.maker", shortner.ProfileItem{ID: added[1].ID, ShortCode: "shop", Position: -1}); err != nil {
+		t.Fatal(err)
+	}
+	_, items, err := s.Page("Ann.Maker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].ShortCode != "shop" || items[1].ShortCode != "blog" {
+		t.Errorf("Page items = %+v, want shop and blog without the expired link", items)
+	}
+
+	code, err := s.FollowItem("ann.maker", added[0].ID)
+	if err != nil || code != "blog" {
+		t.Fatalf("FollowItem = %q, %v, want blog", code, err)
+	}
+	if all, _ := s.ListItems("ann.maker"); len(all) != 3 || all[1].ShortCode != "blog" || all[1].Clicks != 1 || all[0].Clicks != 0 {
+		t.Errorf("items after a click = %+v, want one click on blog", all)
+	}
+	if _, err := s.FollowItem("ann.maker", 999); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("FollowItem of an unknown item: error = %v, want not found", err)
+	}
+
+	if err := s.DeleteProfile("ann.maker"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Page("ann.maker"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("Page of a deleted profile: error = %v, want not found", err)
+	}
+}
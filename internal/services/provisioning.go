@@ -0,0 +1,14 @@
+package services
+
+import "regexp"
+
+// provisionIDPattern is what the client-chosen IDs of provisioned API keys,
+// domain claims and blocks look like, e.g. "prod-marketing" or "ci.deploy".
+var provisionIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+func checkProvisionID(field, id string) error {
+	if !provisionIDPattern.MatchString(id) {
+		return validationError(field, "must be 1 to 64 lowercase letters, digits, dots, dashes or underscores, starting with a letter or digit")
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	defaultPolicyCacheTTL = 30 * time.Second
+	maxPolicyDecisions    = 10000
+	maxBlockReasonLength  = 500
+)
+
+// RedirectPolicyService decides at redirect time whether a link may still
+// be followed, so links created before their destination was found to be
+// abusive can be stopped centrally without deleting them. A link is
+// blocked when its code is blocked, or, for redirects, when any of its
+// destinations (see URLMapping.Destinations) is blocked or on a blocked
+// domain. Blocked domains are the stored domain blocks plus BLOCKED_DOMAINS.
+type RedirectPolicyService interface {
+	// Check returns ErrLinkBlocked when mapping must not be followed.
+	Check(mapping *shortner.URLMapping) error
+	ListBlocks() ([]shortner.RedirectBlock, error)
+	AddBlock(block shortner.RedirectBlock) (*shortner.RedirectBlock, error)
+	RemoveBlock(id int64) error
+	// ListNamedBlocks returns the blocks provisioned under a name, by name.
+	ListNamedBlocks() ([]shortner.RedirectBlock, error)
+	GetNamedBlock(name string) (*shortner.RedirectBlock, error)
+	// PutNamedBlock makes the block named block.Name block block.Kind and
+	// block.Value, creating it when there is none; created reports which.
+	PutNamedBlock(block shortner.RedirectBlock) (stored *shortner.RedirectBlock, created bool, err error)
+	RemoveNamedBlock(name string) error
+	// SetBlockedDomains replaces the domains blocked by configuration.
+	SetBlockedDomains(domains []string)
+}
+
+// blockRules is a snapshot of the blocks, indexed for lookups.
+type blockRules struct {
+	codes        map[string]bool
+	destinations map[string]bool
+	domains      []string
+	loadedAt     time.Time
+}
+
+type redirectPolicySvc struct {
+	determinism
+	repo  repositories.RedirectBlockRepository
+	links ShortenerService
+	ttl   time.Duration
+
+	mu            sync.Mutex
+	rules         *blockRules
+	configDomains []string
+	decisions     map[string]policyDecision
+}
+
+type policyDecision struct {
+	blocked bool
+	at      time.Time
+}
+
+// NewRedirectPolicyService creates the service. Blocks and decisions are
+// cached for ttl (30s when zero), so blocks added on another instance take
+// effect within ttl and those added here at once.
+func NewRedirectPolicyService(repo repositories.RedirectBlockRepository, links ShortenerService, ttl time.Duration) RedirectPolicyService {
+	if ttl <= 0 {
+		ttl = defaultPolicyCacheTTL
+	}
+	return &redirectPolicySvc{repo: repo, links: links, ttl: ttl, decisions: map[string]policyDecision{}}
+}
+
+func (s *redirectPolicySvc) Check(mapping *shortner.URLMapping) error {
+	key := mapping.ShortCode + "\x00" + mapping.LongURL
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if decision, ok := s.decisions[key]; ok && now.Sub(decision.at) < s.ttl {
+		return blockedError(decision.blocked)
+	}
+	rules := s.currentRules(now)
+	blocked := rules.blocks(mapping, s.configDomains)
+	if len(s.decisions) >= maxPolicyDecisions {
+		s.decisions = map[string]policyDecision{}
+	}
+	s.decisions[key] = policyDecision{blocked: blocked, at: now}
+	if blocked {
+		log.Printf("Service blocked redirect of code %s to '%s'", mapping.ShortCode, mapping.LongURL)
+	}
+	return blockedError(blocked)
+}
+
+func blockedError(blocked bool) error {
+	if blocked {
+		return ErrLinkBlocked
+	}
+	return nil
+}
+
+// currentRules reloads the blocks when the snapshot is older than the ttl.
+// When reloading fails the old snapshot is kept: a storage hiccup must not
+// stop every redirect. s.mu must be held.
+func (s *redirectPolicySvc) currentRules(now time.Time) *blockRules {
+	if s.rules != nil && now.Sub(s.rules.loadedAt) < s.ttl {
+		return s.rules
+	}
+	blocks, err := s.repo.ListBlocks()
+	if err != nil {
+		log.Printf("Service error loading redirect blocks: %v", err)
+		if s.rules == nil {
+			return &blockRules{}
+		}
+		s.rules.loadedAt = now
+		return s.rules
+	}
+	rules := &blockRules{codes: map[string]bool{}, destinations: map[string]bool{}, loadedAt: now}
+	for _, block := range blocks {
+		switch block.Kind {
+		case shortner.BlockCode:
+			rules.codes[block.Value] = true
+		case shortner.BlockDestination:
+			rules.destinations[block.Value] = true
+		case shortner.BlockDomain:
+			rules.domains = append(rules.domains, block.Value)
+		}
+	}
+	s.rules = rules
+	return rules
+}
+
+func (r *blockRules) blocks(mapping *shortner.URLMapping, configDomains []string) bool {
+	if r.codes[mapping.ShortCode] {
+		return true
+	}
+	if mapping.Kind != shortner.KindRedirect {
+		return false
+	}
+	for _, destination := range mapping.Destinations() {
+		if r.destinations[normalizedDestination(destination)] {
+			return true
+		}
+		u, err := url.Parse(destination)
+		if err != nil {
+			continue
+		}
+		host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+		if onDomain(host, r.domains) || onDomain(host, configDomains) {
+			return true
+		}
+	}
+	return false
+}
+
+// onDomain reports whether host is one of domains or a subdomain of one.
+func onDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *redirectPolicySvc) ListBlocks() ([]shortner.RedirectBlock, error) {
+	blocks, err := s.repo.ListBlocks()
+	if err != nil {
+		log.Printf("Service error listing redirect blocks: %v", err)
+		return nil, fmt.Errorf("service failed to list redirect blocks: %w", err)
+	}
+	return blocks, nil
+}
+
+// AddBlock stores the block in the form Check compares (see normalizeBlock).
+// Adding a block that exists updates its reason.
+func (s *redirectPolicySvc) AddBlock(block shortner.RedirectBlock) (*shortner.RedirectBlock, error) {
+	block, err := s.normalizeBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	block.CreatedAt = s.now()
+
+	stored, err := s.repo.AddBlock(block)
+	if err != nil {
+		log.Printf("Service error adding %s block '%s': %v", block.Kind, block.Value, err)
+		return nil, fmt.Errorf("service failed to add redirect block: %w", err)
+	}
+	s.invalidate()
+	log.Printf("Service added %s block '%s': %s", stored.Kind, stored.Value, stored.Reason)
+	return stored, nil
+}
+
+// normalizeBlock validates block and puts its value in the form Check
+// compares: codes as stored, destinations normalized and domains as
+// BLOCKED_DOMAINS reads them.
+func (s *redirectPolicySvc) normalizeBlock(block shortner.RedirectBlock) (shortner.RedirectBlock, error) {
+	block.Value = strings.TrimSpace(block.Value)
+	if block.Value == "" {
+		return block, validationError("value", "value is required")
+	}
+	if len(block.Reason) > maxBlockReasonLength {
+		return block, validationError("reason", fmt.Sprintf("reason must be at most %d bytes", maxBlockReasonLength))
+	}
+	switch block.Kind {
+	case shortner.BlockCode:
+		mapping, err := s.links.GetLink(block.Value)
+		if err != nil {
+			return block, err
+		}
+		block.Value = mapping.ShortCode
+	case shortner.BlockDestination:
+		u, err := url.Parse(block.Value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return block, invalidURLError("value", "invalid URL format provided")
+		}
+		block.Value = normalizedDestination(block.Value)
+	case shortner.BlockDomain:
+		block.Value = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(block.Value), "*"), "."), ".")
+		if block.Value == "" || strings.ContainsAny(block.Value, "/:@ ") {
+			return block, validationError("value", "must be a domain name such as example.com")
+		}
+	default:
+		return block, validationError("kind", fmt.Sprintf("kind must be %s, %s or %s", shortner.BlockCode, shortner.BlockDestination, shortner.BlockDomain))
+	}
+	return block, nil
+}
+
+func (s *redirectPolicySvc) RemoveBlock(id int64) error {
+	if err := s.repo.DeleteBlock(id); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeBlockNotFound, "redirect block not found")
+		}
+		log.Printf("Service error removing redirect block %d: %v", id, err)
+		return fmt.Errorf("service failed to remove redirect block: %w", err)
+	}
+	s.invalidate()
+	log.Printf("Service removed redirect block %d", id)
+	return nil
+}
+
+func (s *redirectPolicySvc) ListNamedBlocks() ([]shortner.RedirectBlock, error) {
+	blocks, err := s.ListBlocks()
+	if err != nil {
+		return nil, err
+	}
+	named := make([]shortner.RedirectBlock, 0, len(blocks))
+	for _, block := range blocks {
+		if block.Name != "" {
+			named = append(named, block)
+		}
+	}
+	sort.Slice(named, func(i, j int) bool { return named[i].Name < named[j].Name })
+	return named, nil
+}
+
+func (s *redirectPolicySvc) GetNamedBlock(name string) (*shortner.RedirectBlock, error) {
+	block, err := s.repo.GetBlockByName(name)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, notFoundError(CodeBlockNotFound, "redirect block not found")
+		}
+		log.Printf("Service error getting redirect block '%s': %v", name, err)
+		return nil, fmt.Errorf("service failed to get redirect block: %w", err)
+	}
+	return block, nil
+}
+
+// PutNamedBlock is idempotent: putting the same block again changes
+// nothing. A block added without a name for the same kind and value is
+// taken over.
+func (s *redirectPolicySvc) PutNamedBlock(block shortner.RedirectBlock) (*shortner.RedirectBlock, bool, error) {
+	if err := checkProvisionID("name", block.Name); err != nil {
+		return nil, false, err
+	}
+	block, err := s.normalizeBlock(block)
+	if err != nil {
+		return nil, false, err
+	}
+	block.CreatedAt = s.now()
+
+	stored, created, err := s.repo.PutBlock(block)
+	if err != nil {
+		if errors.Is(err, repositories.ErrBlockTaken) {
+			return nil, false, &Error{Code: CodeBlockTaken, Message: fmt.Sprintf("%s '%s' is already blocked under another name", block.Kind, block.Value)}
+		}
+		log.Printf("Service error putting redirect block '%s': %v", block.Name, err)
+		return nil, false, fmt.Errorf("service failed to put redirect block: %w", err)
+	}
+	s.invalidate()
+	log.Printf("Service put %s block '%s' as '%s' (created: %t)", stored.Kind, stored.Value, stored.Name, created)
+	return stored, created, nil
+}
+
+func (s *redirectPolicySvc) RemoveNamedBlock(name string) error {
+	if err := s.repo.DeleteBlockByName(name); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeBlockNotFound, "redirect block not found")
+		}
+		log.Printf("Service error removing redirect block '%s': %v", name, err)
+		return fmt.Errorf("service failed to remove redirect block: %w", err)
+	}
+	s.invalidate()
+	log.Printf("Service removed redirect block '%s'", name)
+	return nil
+}
+
+func (s *redirectPolicySvc) SetBlockedDomains(domains []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configDomains = domains
+	s.decisions = map[string]policyDecision{}
+}
+
+// invalidate drops the cached blocks and decisions so a change made
+// through this instance applies to the next redirect.
+func (s *redirectPolicySvc) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = nil
+	s.decisions = map[string]policyDecision{}
+}
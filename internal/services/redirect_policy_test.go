@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+func policyFixture(t *testing.T) (*shortenerSvc, *repositories.SQLiteRedirectBlockRepo) {
+	t.Helper()
+	db := openTestDB(t)
+	s := sqliteShortener(t, db)
+	blocks := repositories.NewSQLiteRedirectBlockRepo(db)
+	if err := blocks.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	links := []shortner.URLMapping{
+		{ShortCode: "spam", LongURL: "https://spam.example/offer", Kind: shortner.KindRedirect},
+		{ShortCode: "sub", LongURL: "https://cdn.Bad.example/x", Kind: shortner.KindRedirect},
+		{ShortCode: "lang", LongURL: "https://example.org/", Kind: shortner.KindRedirect, LanguageTargets: map[string]string{"de": "https://bad.example/de"}},
+		{ShortCode: "fine", LongURL: "https://example.org/", Kind: shortner.KindRedirect},
+	}
+	for _, link := range links {
+		if _, err := s.repo.CreateMapping(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s, blocks
+}
+
+func checkLink(t *testing.T, s *shortenerSvc, policy RedirectPolicyService, code string) error {
+	t.Helper()
+	mapping, err := s.repo.GetMapping(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy.Check(mapping)
+}
+
+func TestRedirectPolicyBlocks(t *testing.T) {
+	s, blocks := policyFixture(t)
+	policy := NewRedirectPolicyService(blocks, s, time.Minute)
+	for _, block := range []shortner.RedirectBlock{
+		{Kind: shortner.BlockDestination, Value: "https://SPAM.example/offer"},
+		{Kind: shortner.BlockDomain, Value: "bad.example."},
+	} {
+		if _, err := policy.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for code, want := range map[string]bool{"spam": true, "sub": true, "lang": true, "fine": false} {
+		if err := checkLink(t, s, policy, code); errors.Is(err, ErrLinkBlocked) != want {
+			t.Errorf("Check(%s) = %v, want blocked %v", code, err, want)
+		}
+	}
+
+	code, err := policy.AddBlock(shortner.RedirectBlock{Kind: shortner.BlockCode, Value: "fine", Reason: "reported"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkLink(t, s, policy, "fine"); !errors.Is(err, ErrLinkBlocked) {
+		t.Errorf("Check(fine) after blocking its code = %v, want ErrLinkBlocked", err)
+	}
+	if err := policy.RemoveBlock(code.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkLink(t, s, policy, "fine"); err != nil {
+		t.Errorf("Check(fine) after removing the block = %v, want nil", err)
+	}
+	if err := policy.RemoveBlock(code.ID); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("second RemoveBlock error = %v, want not found", err)
+	}
+}
+
+func TestRedirectPolicyConfigDomains(t *testing.T) {
+	s, blocks := policyFixture(t)
+	policy := NewRedirectPolicyService(blocks, s, time.Minute)
+	if err := checkLink(t, s, policy, "fine"); err != nil {
+		t.Fatal(err)
+	}
+	policy.SetBlockedDomains([]string{"example.org"})
+	if err := checkLink(t, s, policy, "fine"); !errors.Is(err, ErrLinkBlocked) {
+		t.Errorf("Check(fine) with example.org blocked = %v, want ErrLinkBlocked", err)
+	}
+}
+
+// TestRedirectPolicyCache checks that a block added on another instance
+// applies once the cached decisions expire.
+func TestRedirectPolicyCache(t *testing.T) {
+	s, blocks := policyFixture(t)
+	clock := &fixedClock{now: testNow}
+	policy := NewRedirectPolicyService(blocks, s, time.Minute)
+	policy.(*redirectPolicySvc).SetClock(clock)
+	other := NewRedirectPolicyService(blocks, s, time.Minute)
+
+	if err := checkLink(t, s, policy, "fine"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.AddBlock(shortner.RedirectBlock{Kind: shortner.BlockCode, Value: "fine"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkLink(t, s, policy, "fine"); err != nil {
+		t.Errorf("Check(fine) within the TTL = %v, want the cached decision", err)
+	}
+	clock.now = clock.now.Add(time.Minute)
+	if err := checkLink(t, s, policy, "fine"); !errors.Is(err, ErrLinkBlocked) {
+		t.Errorf("Check(fine) after the TTL = %v, want ErrLinkBlocked", err)
+	}
+}
+
+func TestAddBlockValidates(t *testing.T) {
+	s, blocks := policyFixture(t)
+	policy := NewRedirectPolicyService(blocks, s, time.Minute)
+	tests := []struct {
+		name  string
+		block shortner.RedirectBlock
+		want  error
+	}{
+		{"unknown kind", shortner.RedirectBlock{Kind: "owner", Value: "x"}, ErrValidationFailed},
+		{"empty value", shortner.RedirectBlock{Kind: shortner.BlockDomain}, ErrValidationFailed},
+		{"domain with path", shortner.RedirectBlock{Kind: shortner.BlockDomain, Value: "bad.example/x"}, ErrValidationFailed},
+		{"relative destination", shortner.RedirectBlock{Kind: shortner.BlockDestination, Value: "/offer"}, ErrInvalidURL},
+		{"missing code", shortner.RedirectBlock{Kind: shortner.BlockCode, Value: "nope"}, ErrLinkNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := policy.AddBlock(tt.block); !errors.Is(err, tt.want) {
+				t.Errorf("AddBlock error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"template/internal/pkg/mailer"
+	"template/internal/pkg/outbound"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	reportTopLinks          = 10
+	reportMaxCheckedLinks   = 20
+	reportBatchSize         = 50
+	maxReportCodes          = 100
+	maxSubscriptionsByEmail = 10
+)
+
+//go:embed templates/report.txt
+var reportTemplateFS embed.FS
+
+var reportTemplate = template.Must(template.ParseFS(reportTemplateFS, "templates/report.txt"))
+
+// ReportService emails periodic link summaries to subscribers: total clicks,
+// the busiest links and destinations that no longer respond.
+type ReportService interface {
+	Subscribe(email, frequency string, shortCodes []string) (*shortner.ReportSubscription, error)
+	ListSubscriptions(email string) ([]shortner.ReportSubscription, error)
+	Unsubscribe(id int64) error
+	UnsubscribeByToken(token string) error
+	RunDue(now time.Time) (int, error)
+}
+
+type reportSvc struct {
+	determinism
+	repo      repositories.ReportRepository
+	links     ShortenerService
+	analytics AnalyticsService
+	mailer    mailer.Mailer
+	baseURL   string
+	client    *outbound.Client
+}
+
+func NewReportService(repo repositories.ReportRepository, links ShortenerService, analytics AnalyticsService, m mailer.Mailer, client *outbound.Client, baseURL string) ReportService {
+	return &reportSvc{
+		repo:      repo,
+		links:     links,
+		analytics: analytics,
+		mailer:    m,
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		client:    client,
+	}
+}
+
+type reportLink struct {
+	ShortURL string
+	LongURL  string
+	Clicks   int64
+	Problem  string
+}
+
+type reportData struct {
+	Email          string
+	Frequency      string
+	From, To       time.Time
+	TotalClicks    int64
+	TopLinks       []reportLink
+	BrokenLinks    []reportLink
+	UnsubscribeURL string
+}
+
+func (s *reportSvc) Subscribe(email, frequency string, shortCodes []string) (*shortner.ReportSubscription, error) {
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return nil, validationError("email", "invalid email address")
+	}
+	email = strings.ToLower(addr.Address)
+	if frequency != shortner.ReportWeekly && frequency != shortner.ReportMonthly {
+		return nil, validationError("frequency", fmt.Sprintf("unsupported frequency '%s' (expected weekly or monthly)", frequency))
+	}
+	if len(shortCodes) > maxReportCodes {
+		return nil, validationError("short_codes", fmt.Sprintf("a report can cover at most %d links", maxReportCodes))
+	}
+	for _, code := range shortCodes {
+		if _, err := s.links.GetLink(code); err != nil {
+			if errors.Is(err, ErrLinkNotFound) {
+				return nil, validationError("short_codes", fmt.Sprintf("unknown short code '%s'", code))
+			}
+			return nil, err
+		}
+	}
+
+	existing, err := s.repo.ListByEmail(email)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list report subscriptions: %w", err)
+	}
+	if len(existing) >= maxSubscriptionsByEmail {
+		return nil, validationError("email", fmt.Sprintf("an address can have at most %d report subscriptions", maxSubscriptionsByEmail))
+	}
+
+	token, err := s.random().RandomString(32)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to generate unsubscribe token: %w", err)
+	}
+	now := s.now()
+	sub := shortner.ReportSubscription{
+		Email:            email,
+		Frequency:        frequency,
+		ShortCodes:       shortCodes,
+		NextRunAt:        nextReportRun(frequency, now),
+		UnsubscribeToken: token,
+		CreatedAt:        now,
+	}
+	id, err := s.repo.CreateSubscription(sub)
+	if err != nil {
+		log.Printf("Service error saving report subscription for '%s': %v", email, err)
+		return nil, fmt.Errorf("service failed to save report subscription: %w", err)
+	}
+	sub.ID = id
+
+	log.Printf("Service subscribed '%s' to %s reports (subscription %d)", email, frequency, id)
+	return &sub, nil
+}
+
+func (s *reportSvc) ListSubscriptions(email string) ([]shortner.ReportSubscription, error) {
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return nil, validationError("email", "invalid email address")
+	}
+	subs, err := s.repo.ListByEmail(strings.ToLower(addr.Address))
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list report subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+func (s *reportSvc) Unsubscribe(id int64) error {
+	if err := s.repo.DeleteSubscription(id); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeSubscriptionNotFound, "report subscription not found")
+		}
+		return fmt.Errorf("service failed to delete report subscription: %w", err)
+	}
+	log.Printf("Service deleted report subscription %d", id)
+	return nil
+}
+
+func (s *reportSvc) UnsubscribeByToken(token string) error {
+	if token == "" {
+		return notFoundError(CodeSubscriptionNotFound, "report subscription not found")
+	}
+	if err := s.repo.DeleteByToken(token); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeSubscriptionNotFound, "report subscription not found")
+		}
+		return fmt.Errorf("service failed to delete report subscription: %w", err)
+	}
+	log.Println("Service deleted a report subscription by unsubscribe token")
+	return nil
+}
+
+// RunDue sends every report whose time has come and returns how many were
+// sent. A report that fails to send is retried on the next run; the error
+// counts the failures.
+func (s *reportSvc) RunDue(now time.Time) (int, error) {
+	due, err := s.repo.ListDue(now, reportBatchSize)
+	if err != nil {
+		log.Printf("Service error listing due report subscriptions: %v", err)
+		return 0, fmt.Errorf("service failed to list due report subscriptions: %w", err)
+	}
+
+	sent, failed := 0, 0
+	for _, sub := range due {
+		to := sub.NextRunAt
+		from := previousReportRun(sub.Frequency, to)
+		if err := s.sendReport(sub, from, to); err != nil {
+			log.Printf("Service error sending report %d to '%s': %v", sub.ID, sub.Email, err)
+			failed++
+			continue
+		}
+		next := nextReportRun(sub.Frequency, to)
+		if !next.After(now) {
+			next = nextReportRun(sub.Frequency, now)
+		}
+		if err := s.repo.MarkSent(sub.ID, now, next); err != nil {
+			log.Printf("Service error recording sent report %d: %v", sub.ID, err)
+			failed++
+			continue
+		}
+		sent++
+	}
+	if failed > 0 {
+		return sent, fmt.Errorf("%d of %d due reports failed", failed, len(due))
+	}
+	return sent, nil
+}
+
+func (s *reportSvc) sendReport(sub shortner.ReportSubscription, from, to time.Time) error {
+	top, total, err := s.analytics.TopLinks(sub.ShortCodes, from, to, reportTopLinks)
+	if err != nil {
+		return err
+	}
+
+	data := reportData{
+		Email:          sub.Email,
+		Frequency:      sub.Frequency,
+		From:           from,
+		To:             to,
+		TotalClicks:    total,
+		UnsubscribeURL: s.baseURL + "/api/v1/reports/unsubscribe?token=" + url.QueryEscape(sub.UnsubscribeToken),
+	}
+
+	// Broken links are looked for among the busiest links first, then the
+	// subscribed ones, checking at most reportMaxCheckedLinks destinations.
+	checked := make(map[string]bool)
+	candidates := make([]string, 0, len(top)+len(sub.ShortCodes))
+	for _, lc := range top {
+		candidates = append(candidates, lc.ShortCode)
+	}
+	candidates = append(candidates, sub.ShortCodes...)
+
+	clicks := make(map[string]int64, len(top))
+	for _, lc := range top {
+		clicks[lc.ShortCode] = lc.Clicks
+	}
+	for _, code := range candidates {
+		if checked[code] || len(checked) >= reportMaxCheckedLinks {
+			continue
+		}
+		checked[code] = true
+		mapping, err := s.links.GetLink(code)
+		if err != nil {
+			continue
+		}
+		link := reportLink{ShortURL: s.baseURL + "/" + code, LongURL: mapping.LongURL, Clicks: clicks[code]}
+		if _, ok := clicks[code]; ok {
+			data.TopLinks = append(data.TopLinks, link)
+		}
+		if mapping.Kind == shortner.KindRedirect {
+			if problem := s.checkDestination(mapping.LongURL); problem != "" {
+				link.Problem = problem
+				data.BrokenLinks = append(data.BrokenLinks, link)
+			}
+		}
+	}
+
+	var subject, body bytes.Buffer
+	if err := reportTemplate.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return fmt.Errorf("failed to render report subject: %w", err)
+	}
+	if err := reportTemplate.ExecuteTemplate(&body, "body", data); err != nil {
+		return fmt.Errorf("failed to render report body: %w", err)
+	}
+	return s.mailer.Send(sub.Email, strings.TrimSpace(subject.String()), body.String())
+}
+
+// checkDestination returns a short description of why url looks broken, or
+// an empty string when it responds successfully.
+func (s *reportSvc) checkDestination(target string) string {
+	resp, err := s.client.Head(context.Background(), "link_check", target)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodGet, target, nil)
+		if err == nil {
+			req.Header.Set("Range", "bytes=0-0")
+			resp, err = s.client.Do("link_check", req)
+		}
+	}
+	if errors.Is(err, outbound.ErrBlockedAddress) {
+		return "points to a private address"
+	}
+	if err != nil {
+		return "unreachable"
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return resp.Status
+	}
+	return ""
+}
+
+func nextReportRun(frequency string, from time.Time) time.Time {
+	if frequency == shortner.ReportMonthly {
+		return from.AddDate(0, 1, 0)
+	}
+	return from.AddDate(0, 0, 7)
+}
+
+func previousReportRun(frequency string, to time.Time) time.Time {
+	if frequency == shortner.ReportMonthly {
+		return to.AddDate(0, -1, 0)
+	}
+	return to.AddDate(0, 0, -7)
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	scheduleBatchSize   = 100
+	maxPendingSchedules = 20
+)
+
+// ScheduleService manages future destination changes. RunDue applies the
+// changes whose time has come; the scheduled_changes job calls it.
+type ScheduleService interface {
+	ScheduleChange(shortCode, newURL string, effectiveAt time.Time) (*shortner.ScheduledChange, error)
+	ListChanges(shortCode string) ([]shortner.ScheduledChange, error)
+	CancelChange(shortCode string, id int64) error
+	RunDue(now time.Time) (int, error)
+}
+
+type scheduleSvc struct {
+	determinism
+	links ShortenerService
+	repo  repositories.ScheduleRepository
+}
+
+func NewScheduleService(links ShortenerService, repo repositories.ScheduleRepository) ScheduleService {
+	return &scheduleSvc{links: links, repo: repo}
+}
+
+func (s *scheduleSvc) ScheduleChange(shortCode, newURL string, effectiveAt time.Time) (*shortner.ScheduledChange, error) {
+	if !s.links.ValidateURL(newURL) {
+		return nil, invalidURLError("new_url", "invalid new URL format provided")
+	}
+	newURL, err := s.links.NormalizeDestination("new_url", newURL)
+	if err != nil {
+		return nil, err
+	}
+	if effectiveAt.IsZero() {
+		return nil, validationError("effective_at", "effective_at is required")
+	}
+	if !effectiveAt.After(s.now()) {
+		return nil, validationError("effective_at", "effective_at must be in the future")
+	}
+
+	mapping, err := s.links.GetLink(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Kind != shortner.KindRedirect {
+		return nil, validationError("short_code", fmt.Sprintf("only redirect links can be scheduled, this link is a %s", mapping.Kind))
+	}
+	shortCode = mapping.ShortCode
+
+	existing, err := s.repo.ListChanges(shortCode)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list scheduled changes: %w", err)
+	}
+	pending := 0
+	for _, c := range existing {
+		if c.Status == shortner.ScheduleStatusPending {
+			pending++
+		}
+	}
+	if pending >= maxPendingSchedules {
+		return nil, validationError("effective_at", fmt.Sprintf("a link can have at most %d pending changes", maxPendingSchedules))
+	}
+
+	change := shortner.ScheduledChange{
+		ShortCode:   shortCode,
+		NewURL:      newURL,
+		EffectiveAt: effectiveAt.UTC().Truncate(time.Second),
+		Status:      shortner.ScheduleStatusPending,
+		CreatedAt:   s.now(),
+	}
+	id, err := s.repo.CreateChange(change)
+	if err != nil {
+		log.Printf("Service error saving scheduled change for '%s': %v", shortCode, err)
+		return nil, fmt.Errorf("service failed to save scheduled change: %w", err)
+	}
+	change.ID = id
+
+	log.Printf("Service scheduled change %d for '%s' -> '%s' at %s", id, shortCode, newURL, change.EffectiveAt.Format(time.RFC3339))
+	return &change, nil
+}
+
+func (s *scheduleSvc) ListChanges(shortCode string) ([]shortner.ScheduledChange, error) {
+	mapping, err := s.links.GetLink(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := s.repo.ListChanges(mapping.ShortCode)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list scheduled changes: %w", err)
+	}
+	return changes, nil
+}
+
+func (s *scheduleSvc) CancelChange(shortCode string, id int64) error {
+	err := s.repo.FinishChange(shortCode, id, shortner.ScheduleStatusCanceled, "", s.now())
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeScheduleNotFound, "no pending scheduled change with this id")
+		}
+		return fmt.Errorf("service failed to cancel scheduled change: %w", err)
+	}
+	log.Printf("Service canceled scheduled change %d for '%s'", id, shortCode)
+	return nil
+}
+
+// RunDue applies every pending change whose effective time is not after
+// now and returns how many were applied. A change that cannot be applied,
+// for example because its link was deleted, is marked failed.
+func (s *scheduleSvc) RunDue(now time.Time) (int, error) {
+	applied := 0
+	for {
+		due, err := s.repo.ListDue(now, scheduleBatchSize)
+		if err != nil {
+			log.Printf("Service error listing due scheduled changes: %v", err)
+			return applied, fmt.Errorf("service failed to list due scheduled changes: %w", err)
+		}
+		for _, change := range due {
+			status, errMsg := shortner.ScheduleStatusApplied, ""
+			err := s.links.UpdateLink(change.ShortCode, shortner.LinkUpdate{LongURL: &change.NewURL, Source: shortner.RevisionSourceSchedule})
+			if err != nil {
+				log.Printf("Service error applying scheduled change %d for '%s': %v", change.ID, change.ShortCode, err)
+				status, errMsg = shortner.ScheduleStatusFailed, err.Error()
+			}
+			if err := s.repo.FinishChange(change.ShortCode, change.ID, status, errMsg, s.now()); err != nil {
+				log.Printf("Service error finishing scheduled change %d: %v", change.ID, err)
+				return applied, fmt.Errorf("service failed to finish scheduled change %d: %w", change.ID, err)
+			}
+			if status == shortner.ScheduleStatusApplied {
+				applied++
+				log.Printf("Service applied scheduled change %d: '%s' -> '%s'", change.ID, change.ShortCode, change.NewURL)
+			}
+		}
+		if len(due) < scheduleBatchSize {
+			return applied, nil
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"log"
+	"net/mail"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"template/internal/pkg/mailer"
+	"template/internal/pkg/sms"
+	"template/internal/pkg/tasks"
+)
+
+// Share channels.
+const (
+	ShareEmail = "email"
+	ShareSMS   = "sms"
+)
+
+const (
+	maxShareMessageLength = 500
+	maxShareSenderLength  = 100
+)
+
+//go:embed templates/share.txt
+var shareTemplateFS embed.FS
+
+var shareTemplate = template.Must(template.ParseFS(shareTemplateFS, "templates/share.txt"))
+
+var phoneNumberRe = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// Share is a request to send a short link to someone: by email to an
+// address, or by SMS to a phone number in E.164 form. SenderName and
+// Message are optional and appear in the message.
+type Share struct {
+	Channel    string
+	To         string
+	SenderName string
+	Message    string
+}
+
+// ShareService sends short links by email or SMS on behalf of a visitor,
+// with a fixed message around what they typed.
+type ShareService interface {
+	// Share queues the message with the short link of code; it is sent in
+	// the background, with retries.
+	Share(code string, share Share) error
+}
+
+type shareSvc struct {
+	determinism
+	links   ShortenerService
+	mailer  mailer.Mailer
+	sms     sms.Sender
+	pool    *tasks.Pool
+	baseURL string
+}
+
+type shareData struct {
+	ShortURL   string
+	Title      string
+	SenderName string
+	Message    string
+	BaseURL    string
+}
+
+// NewShareService sends email with m and SMS with sender, on pool. sender
+// may be nil, in which case the sms channel is refused.
+func NewShareService(links ShortenerService, m mailer.Mailer, sender sms.Sender, pool *tasks.Pool, baseURL string) ShareService {
+	return &shareSvc{links: links, mailer: m, sms: sender, pool: pool, baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+func (s *shareSvc) Share(code string, share Share) error {
+	to, err := s.recipient(share)
+	if err != nil {
+		return err
+	}
+	share.SenderName = strings.TrimSpace(share.SenderName)
+	share.Message = strings.TrimSpace(share.Message)
+	if len(share.SenderName) > maxShareSenderLength || strings.ContainsFunc(share.SenderName, unicode.IsControl) {
+		return validationError("sender_name", fmt.Sprintf("sender_name must be at most %d bytes on one line", maxShareSenderLength))
+	}
+	if len(share.Message) > maxShareMessageLength {
+		return validationError("message", fmt.Sprintf("message must be at most %d bytes", maxShareMessageLength))
+	}
+
+	mapping, err := s.links.GetLink(code)
+	if err != nil {
+		return err
+	}
+	if mapping.Expired(s.now()) {
+		return ErrLinkExpired
+	}
+	data := shareData{
+		ShortURL:   s.baseURL + "/" + mapping.ShortCode,
+		Title:      mapping.Title,
+		SenderName: share.SenderName,
+		Message:    share.Message,
+		BaseURL:    s.baseURL,
+	}
+
+	var send func() error
+	switch share.Channel {
+	case ShareEmail:
+		var subject, body bytes.Buffer
+		if err := shareTemplate.ExecuteTemplate(&subject, "subject", data); err != nil {
+			return fmt.Errorf("failed to render share subject: %w", err)
+		}
+		if err := shareTemplate.ExecuteTemplate(&body, "body", data); err != nil {
+			return fmt.Errorf("failed to render share body: %w", err)
+		}
+		send = func() error { return s.mailer.Send(to, subject.String(), body.String()) }
+	case ShareSMS:
+		var body bytes.Buffer
+		if err := shareTemplate.ExecuteTemplate(&body, "sms", data); err != nil {
+			return fmt.Errorf("failed to render share SMS: %w", err)
+		}
+		send = func() error { return s.sms.Send(to, body.String()) }
+	}
+	s.pool.Submit(fmt.Sprintf("share %s by %s", mapping.ShortCode, share.Channel), send)
+	log.Printf("Service queued %s share of '%s'", share.Channel, mapping.ShortCode)
+	return nil
+}
+
+// recipient validates the channel and returns the address or number to
+// send to, normalized.
+func (s *shareSvc) recipient(share Share) (string, error) {
+	to := strings.TrimSpace(share.To)
+	switch share.Channel {
+	case ShareEmail:
+		addr, err := mail.ParseAddress(to)
+		if err != nil {
+			return "", validationError("to", "invalid email address")
+		}
+		return addr.Address, nil
+	case ShareSMS:
+		if s.sms == nil {
+			return "", validationError("channel", "sharing by SMS is not available")
+		}
+		to = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(to)
+		if !phoneNumberRe.MatchString(to) {
+			return "", validationError("to", "phone number must be in international form, such as +15551234567")
+		}
+		return to, nil
+	default:
+		return "", validationError("channel", fmt.Sprintf("channel must be %s or %s", ShareEmail, ShareSMS))
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"template/internal/pkg/tasks"
+	"template/internal/usecases/shortner"
+)
+
+// recordingSMS remembers the text messages it was asked to send.
+type recordingSMS struct {
+	to, bodies []string
+}
+
+func (s *recordingSMS) Send(to, body string) error {
+	s.to = append(s.to, to)
+	s.bodies = append(s.bodies, body)
+	return nil
+}
+
+func TestShareLink(t *testing.T) {
+	links := sqliteShortener(t, openTestDB(t))
+	expired := testNow.Add(-time.Hour)
+	for _, link := range []shortner.URLMapping{
+		{ShortCode: "promo", LongURL: "https://example.com/sale", Title: "Spring sale"},
+		{ShortCode: "gone", LongURL: "https://example.com/old", ExpiresAt: &expired},
+	} {
+		if _, err := links.repo.CreateMapping(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mail, text := &recordingMailer{}, &recordingSMS{}
+	pool := tasks.New("share", tasks.Options{Workers: 1})
+	s := NewShareService(links, mail, text, pool, "https://sho.rt/")
+	s.(Deterministic).SetClock(&fixedClock{now: testNow})
+
+	if err := s.Share("promo", Share{Channel: ShareEmail, To: "Ann <ann@example.com>", SenderName: "Bob", Message: "Look at this"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Share("promo", Share{Channel: ShareSMS, To: "+1 (555) 123-4567", Message: "Sale!"}); err != nil {
+		t.Fatal(err)
+	}
+	pool.Stop()
+	if len(mail.to) != 1 || mail.to[0] != "ann@example.com" {
+		t.Fatalf("emailed %v, want ann@example.com", mail.to)
+	}
+	for _, want := range []string{"Bob shared a link with you\n", "Bob shared a link with you: Spring sale", "https://sho.rt/promo", "Look at this"} {
+		if !strings.Contains(mail.bodies[0], want) {
+			t.Errorf("email lacks %q:\n%s", want, mail.bodies[0])
+		}
+	}
+	if len(text.to) != 1 || text.to[0] != "+15551234567" || text.bodies[0] != "Sale! https://sho.rt/promo" {
+		t.Errorf("SMS = %v %q, want \"Sale! https://sho.rt/promo\" to +15551234567", text.to, text.bodies)
+	}
+
+	for _, tt := range []struct {
+		code  string
+		share Share
+		want  error
+	}{
+		{"promo", Share{Channel: "fax", To: "ann@example.com"}, ErrValidationFailed},
+		{"promo", Share{Channel: ShareEmail, To: "not an address"}, ErrValidationFailed},
+		{"promo", Share{Channel: ShareSMS, To: "5551234567"}, ErrValidationFailed},
+		{"promo", Share{Channel: ShareEmail, To: "ann@example.com", SenderName: "Bob\r\nBcc: all@example.com"}, ErrValidationFailed},
+		{"promo", Share{Channel: ShareEmail, To: "ann@example.com", Message: strings.Repeat("x", maxShareMessageLength+1)}, ErrValidationFailed},
+		{"missing", Share{Channel: ShareEmail, To: "ann@example.com"}, ErrLinkNotFound},
+		{"gone", Share{Channel: ShareEmail, To: "ann@example.com"}, ErrLinkExpired},
+	} {
+		if err := s.Share(tt.code, tt.share); !errors.Is(err, tt.want) {
+			t.Errorf("Share(%s, %+v) error = %v, want %v", tt.code, tt.share, err, tt.want)
+		}
+	}
+
+	noSMS := NewShareService(links, mail, nil, pool, "https://sho.rt")
+	if err := noSMS.Share("promo", Share{Channel: ShareSMS, To: "+15551234567"}); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("SMS without a provider: error = %v, want a validation error", err)
+	}
+}
@@ -1,42 +1,341 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/netip"
 	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"template/internal/pkg/featureflags"
+	"template/internal/pkg/geo"
+	"template/internal/pkg/i18n"
+	"template/internal/pkg/idn"
+	"template/internal/pkg/outbound"
 	"template/internal/pkg/utils"
 	"template/internal/repositories"
+	"template/internal/usecases/shortner"
 )
 
 const (
-	shortCodeLength      = 7
+	defaultCodeLength    = 7
 	maxGenerationRetries = 5
+	maxCodeCorrections   = 3
 )
 
+var validRedirectTypes = map[int]bool{301: true, 302: true, 307: true, 308: true}
+
+const (
+	maxLanguageTargets = 50
+	maxLinkPixels      = 5
+	maxLinkCountries   = 250
+	maxTimeRules       = 20
+)
+
+var languageTagRe = regexp.MustCompile(`^[a-z]{2,8}(-[a-z0-9]{1,8})*$`)
+
 type ShortenerService interface {
 	CreateShortURL(longURL string) (string, error)
+	CreateSingleUseURL(longURL string) (string, error)
+	// CreateWildcardURL creates a link that also redirects
+	// /{code}/{path...} to longURL with the path appended.
+	CreateWildcardURL(longURL string) (string, error)
+	CreateLink(mapping shortner.URLMapping) (string, error)
+	GetLink(shortCode string) (*shortner.URLMapping, error)
+	ConsumeLink(shortCode string) error
 	ValidateURL(inputURL string) bool
+	CheckCode(shortCode string) error
+	NormalizeDestination(field, rawURL string) (string, error)
+	SetPolicy(policy LinkPolicy)
+	SetOutboundClient(client *outbound.Client)
+	// SetHoneypots makes the service skip honeypot codes when generating
+	// codes.
+	SetHoneypots(honeypots HoneypotService)
 	UpdateLongURL(shortCode, newLongURL string) error
+	UpdateLink(shortCode string, update shortner.LinkUpdate) error
 	DeleteMapping(shortCode string) error
+	// BulkDelete and BulkUpdate change every selected link in one
+	// transaction where the repository allows it, reporting each link.
+	BulkDelete(selection shortner.BulkSelection) (*shortner.BulkResult, error)
+	BulkUpdate(selection shortner.BulkSelection, update shortner.LinkUpdate) (*shortner.BulkResult, error)
+	ListLinksSince(afterID int64, limit int) ([]shortner.URLMapping, error)
+	// SearchLinks finds links whose destination or title contains every
+	// word of query, best match first.
+	SearchLinks(ctx context.Context, query string, page shortner.SearchPage) ([]shortner.URLMapping, error)
+	// FindLinksByDestination lists the links after afterID, oldest first,
+	// whose destination is destination (MatchExact), starts with it
+	// (MatchPrefix), or is on the domain it names (MatchDomain).
+	FindLinksByDestination(ctx context.Context, destination, match string, afterID int64, limit int) ([]shortner.URLMapping, error)
+	ListRevisions(shortCode string) ([]shortner.LinkRevision, error)
+}
+
+// LinkPolicy holds the operator rules applied to links: destinations on
+// BlockedDomains (or their subdomains) are refused and ReservedCodes are never
+// handed out. PrivateDestinations is "reject", "flag" or "allow" and decides
+// what happens to destinations that resolve to internal addresses; it
+// defaults to reject. Destinations longer than MaxURLLength bytes once
+// normalized are refused (0 means no limit). With CodeChecksum, generated
+// codes end in a check character (see CheckCode). ChainedLinks is "flag",
+// "reject" or "resolve" and decides what happens to destinations that are
+// themselves short links, on BaseURL or ShortenerDomains: they are logged
+// (the default), refused, or replaced by the end of the chain, following
+// at most MaxChainDepth links (0 means 5). It can be replaced at runtime
+// with SetPolicy.
+//
+// The remaining fields are defaults for new links: CodeLength is the length
+// of generated codes, before the check character (0 means 7); CodePrefix,
+// the prefix of the instance's region in a multi-region deployment, starts
+// every generated code, which it makes longer;
+// DefaultRedirectType is stored on links created without a redirect type
+// (0 leaves it to the redirect handler, which answers 302); and links
+// created without an expiry expire DefaultTTL after creation (0 means
+// never).
+type LinkPolicy struct {
+	BlockedDomains      []string
+	ReservedCodes       []string
+	PrivateDestinations string
+	MaxURLLength        int
+	CodeChecksum        bool
+	ChainedLinks        string
+	BaseURL             string
+	ShortenerDomains    []string
+	MaxChainDepth       int
+
+	CodeLength          int
+	CodePrefix          string
+	DefaultRedirectType int
+	DefaultTTL          time.Duration
+}
+
+const (
+	privateDestinationsReject = "reject"
+	privateDestinationsFlag   = "flag"
+	privateDestinationsAllow  = "allow"
+
+	destinationLookupTimeout = 2 * time.Second
+)
+
+type compiledPolicy struct {
+	blockedDomains      []string
+	reservedCodes       map[string]bool
+	privateDestinations string
+	maxURLLength        int
+	codeChecksum        bool
+	chainedLinks        string
+	ownHost             string
+	ownPath             string
+	shortenerDomains    []string
+	maxChainDepth       int
+	codeLength          int
+	codePrefix          string
+	defaultRedirectType int
+	defaultTTL          time.Duration
 }
 
 type shortenerSvc struct {
-	repo repositories.ShortenerRepository
+	determinism
+	repo      repositories.ShortenerRepository
+	revisions repositories.RevisionRepository
+	trash     repositories.TrashRepository
+	events    EventPublisher
+	flags     *featureflags.Set
+	policy    atomic.Pointer[compiledPolicy]
+	client    *outbound.Client
+	honeypots HoneypotService
 }
 
-func NewShortenerService(repo repositories.ShortenerRepository) ShortenerService {
-	return &shortenerSvc{repo: repo}
+// NewShortenerService creates the link service. revisions may be nil, in
+// which case destination changes are not recorded; trash may be nil, in
+// which case deleted links are gone at once; and flags may be nil to use
+// the built-in feature flag defaults.
+func NewShortenerService(repo repositories.ShortenerRepository, revisions repositories.RevisionRepository, trash repositories.TrashRepository, events EventPublisher, flags *featureflags.Set) ShortenerService {
+	if events == nil {
+		events = noopPublisher{}
+	}
+	s := &shortenerSvc{repo: repo, revisions: revisions, trash: trash, events: events, flags: flags}
+	s.policy.Store(&compiledPolicy{privateDestinations: privateDestinationsReject, chainedLinks: chainedLinksFlag, maxChainDepth: defaultMaxChainDepth, codeLength: defaultCodeLength})
+	return s
+}
+
+// SetPolicy swaps in a new LinkPolicy. Existing links are not re-checked.
+func (s *shortenerSvc) SetPolicy(policy LinkPolicy) {
+	compiled := &compiledPolicy{
+		blockedDomains:      policy.BlockedDomains,
+		reservedCodes:       make(map[string]bool, len(policy.ReservedCodes)),
+		privateDestinations: policy.PrivateDestinations,
+		maxURLLength:        policy.MaxURLLength,
+		codeChecksum:        policy.CodeChecksum,
+		chainedLinks:        policy.ChainedLinks,
+		shortenerDomains:    policy.ShortenerDomains,
+		maxChainDepth:       policy.MaxChainDepth,
+		codeLength:          policy.CodeLength,
+		codePrefix:          policy.CodePrefix,
+		defaultRedirectType: policy.DefaultRedirectType,
+		defaultTTL:          policy.DefaultTTL,
+	}
+	if compiled.privateDestinations == "" {
+		compiled.privateDestinations = privateDestinationsReject
+	}
+	if compiled.chainedLinks == "" {
+		compiled.chainedLinks = chainedLinksFlag
+	}
+	if compiled.maxChainDepth <= 0 {
+		compiled.maxChainDepth = defaultMaxChainDepth
+	}
+	if base, err := url.Parse(policy.BaseURL); err == nil && policy.BaseURL != "" {
+		compiled.ownHost = strings.TrimSuffix(strings.ToLower(base.Hostname()), ".")
+		compiled.ownPath = strings.TrimSuffix(base.Path, "/")
+	}
+	if compiled.codeLength <= 0 {
+		compiled.codeLength = defaultCodeLength
+	}
+	if compiled.defaultRedirectType != 0 && !validRedirectTypes[compiled.defaultRedirectType] {
+		log.Printf("Service ignoring invalid default redirect type %d", compiled.defaultRedirectType)
+		compiled.defaultRedirectType = 0
+	}
+	for _, code := range policy.ReservedCodes {
+		compiled.reservedCodes[strings.ToLower(code)] = true
+	}
+	s.policy.Store(compiled)
+	log.Printf("Service link policy updated: %d blocked domains, %d reserved codes, private destinations: %s, chained links: %s, code length: %d", len(policy.BlockedDomains), len(policy.ReservedCodes), compiled.privateDestinations, compiled.chainedLinks, compiled.codeLength)
+}
+
+func (s *shortenerSvc) SetHoneypots(honeypots HoneypotService) {
+	s.honeypots = honeypots
+}
+
+// NormalizeDestination converts a destination that passed ValidateURL to the
+// form links are stored and compared in, with a punycode host and
+// percent-encoded path (see package idn), enforces the maximum URL length
+// and applies checkDestination and the chained link policy to it. Hosts that
+// mix scripts like look-alike domains are logged.
+func (s *shortenerSvc) NormalizeDestination(field, rawURL string) (string, error) {
+	normalized, err := s.normalizeDestination(field, rawURL)
+	if err != nil {
+		return "", err
+	}
+	return s.followChain(field, normalized)
+}
+
+// normalizeDestination is NormalizeDestination without the chained link
+// policy.
+func (s *shortenerSvc) normalizeDestination(field, rawURL string) (string, error) {
+	normalized, err := idn.NormalizeURL(rawURL)
+	if err != nil {
+		return "", invalidURLError(field, "invalid internationalized domain name")
+	}
+	if limit := s.policy.Load().maxURLLength; limit > 0 && len(normalized) > limit {
+		return "", &Error{
+			Code:    CodeURLTooLong,
+			Message: fmt.Sprintf("URL is %d characters long, the maximum is %d", len(normalized), limit),
+			Fields:  []FieldError{{Field: field, Message: fmt.Sprintf("must be at most %d characters", limit)}},
+		}
+	}
+	for _, warning := range idn.MixedScripts(normalized) {
+		log.Printf("Service warning for destination '%s': %s", rawURL, warning)
+	}
+	if err := s.checkDestination(field, normalized); err != nil {
+		return "", err
+	}
+	return normalized, nil
+}
+
+// checkDestination refuses URLs whose host is a blocked domain or one of its
+// subdomains, and, unless the policy allows them, URLs whose host is or
+// resolves to a private, loopback or link-local address.
+func (s *shortenerSvc) checkDestination(field, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return invalidURLError(field, "invalid URL format provided")
+	}
+	policy := s.policy.Load()
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for _, domain := range policy.blockedDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return &Error{
+				Code:    CodeDestinationBlocked,
+				Message: fmt.Sprintf("links to %s are not allowed", domain),
+				Fields:  []FieldError{{Field: field, Message: "destination domain is blocked"}},
+			}
+		}
+	}
+
+	if policy.privateDestinations == privateDestinationsAllow {
+		return nil
+	}
+	addr, internal := s.internalAddress(host)
+	if !internal {
+		return nil
+	}
+	if policy.privateDestinations == privateDestinationsFlag {
+		log.Printf("Service flagged destination '%s': %s resolves to internal address %s", rawURL, host, addr)
+		return nil
+	}
+	message := fmt.Sprintf("links to internal addresses are not allowed (%s resolves to %s)", host, addr)
+	if strings.Trim(host, "[]") == addr.String() {
+		message = fmt.Sprintf("links to internal addresses are not allowed (%s)", addr)
+	}
+	return &Error{
+		Code:    CodeDestinationPrivate,
+		Message: message,
+		Fields:  []FieldError{{Field: field, Message: "destination resolves to a private address"}},
+	}
+}
+
+// internalAddress reports the first internal address host is or resolves
+// to. A host that does not resolve is not treated as internal: it cannot be
+// fetched either way, and the outbound client checks again at connect time.
+func (s *shortenerSvc) internalAddress(host string) (netip.Addr, bool) {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return netip.IPv6Loopback(), true
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return addr, outbound.IsInternal(addr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), destinationLookupTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		log.Printf("Service could not resolve destination host '%s': %v", host, err)
+		return netip.Addr{}, false
+	}
+	for _, addr := range addrs {
+		if outbound.IsInternal(addr) {
+			return addr, true
+		}
+	}
+	return netip.Addr{}, false
 }
 
 func (s *shortenerSvc) CreateShortURL(longURL string) (string, error) {
 	if !s.ValidateURL(longURL) {
-		return "", errors.New("invalid URL format provided")
+		return "", invalidURLError("url", "invalid URL format provided")
+	}
+	longURL, err := s.NormalizeDestination("url", longURL)
+	if err != nil {
+		return "", err
+	}
+
+	if s.policy.Load().defaultTTL > 0 {
+		// An existing link to the same destination may have expired, so
+		// with a default TTL every request gets a fresh link.
+		return s.insertLink(shortner.URLMapping{Kind: shortner.KindRedirect, LongURL: longURL})
 	}
 
-	existingCode, err := s.repo.FindByLongURL(longURL)
-	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+	// Without an index of destinations, every request gets a new link.
+	err = repositories.ErrIndexUnsupported
+	var existingCode string
+	if index, ok := s.repo.(repositories.LongURLIndex); ok {
+		existingCode, err = index.FindByLongURL(longURL)
+	}
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) && !errors.Is(err, repositories.ErrIndexUnsupported) {
 		log.Printf("Service error checking for existing long URL '%s': %v", longURL, err)
 		return "", fmt.Errorf("failed to check for existing URL: %w", err)
 	}
@@ -45,21 +344,101 @@ func (s *shortenerSvc) CreateShortURL(longURL string) (string, error) {
 		return existingCode, nil
 	}
 
+	return s.insertLink(shortner.URLMapping{Kind: shortner.KindRedirect, LongURL: longURL})
+}
+
+// CreateSingleUseURL is CreateShortURL for a link that opens only once. It
+// always creates a new link, since an existing one may already be used up.
+func (s *shortenerSvc) CreateSingleUseURL(longURL string) (string, error) {
+	return s.createFresh(shortner.URLMapping{Kind: shortner.KindRedirect, LongURL: longURL, SingleUse: true})
+}
+
+// CreateWildcardURL always creates a new link too: links to the same
+// destination without the flag must not start answering subpaths.
+func (s *shortenerSvc) CreateWildcardURL(longURL string) (string, error) {
+	return s.createFresh(shortner.URLMapping{Kind: shortner.KindRedirect, LongURL: longURL, Wildcard: true})
+}
+
+// createFresh is CreateShortURL without reusing an existing link.
+func (s *shortenerSvc) createFresh(mapping shortner.URLMapping) (string, error) {
+	if !s.ValidateURL(mapping.LongURL) {
+		return "", invalidURLError("url", "invalid URL format provided")
+	}
+	longURL, err := s.NormalizeDestination("url", mapping.LongURL)
+	if err != nil {
+		return "", err
+	}
+	mapping.LongURL = longURL
+	return s.insertLink(mapping)
+}
+
+// CreateLink stores a new link of any kind under a freshly generated code,
+// retrying on collisions. Callers validate kind-specific fields.
+func (s *shortenerSvc) CreateLink(mapping shortner.URLMapping) (string, error) {
+	if mapping.Kind == "" {
+		mapping.Kind = shortner.KindRedirect
+	}
+	if mapping.LongURL != "" {
+		longURL, err := s.NormalizeDestination("url", mapping.LongURL)
+		if err != nil {
+			return "", err
+		}
+		mapping.LongURL = longURL
+	}
+	return s.insertLink(mapping)
+}
+
+// insertLink is CreateLink for a mapping whose destination has been checked.
+// Redirects get the policy's default redirect type and expiry unless they
+// set their own.
+func (s *shortenerSvc) insertLink(mapping shortner.URLMapping) (string, error) {
+	if err := s.checkLoop(&mapping); err != nil {
+		return "", err
+	}
+	policy := s.policy.Load()
+	if mapping.Kind == shortner.KindRedirect {
+		if mapping.RedirectType == 0 {
+			mapping.RedirectType = policy.defaultRedirectType
+		}
+		if mapping.ExpiresAt == nil && policy.defaultTTL > 0 {
+			expiresAt := s.now().Add(policy.defaultTTL).UTC()
+			mapping.ExpiresAt = &expiresAt
+		}
+	}
+
+	generate := s.random().RandomString
+	readable := s.flags.Enabled(featureflags.ReadableCodes, "")
+	if readable {
+		generate = s.random().ReadableString
+	}
+
 	for i := 0; i < maxGenerationRetries; i++ {
-		code, err := utils.GenerateRandomString(shortCodeLength)
+		code, err := generate(policy.codeLength)
 		if err != nil {
 			return "", fmt.Errorf("service failed to generate random string: %w", err)
 		}
+		code = policy.codePrefix + code
+		if policy.codeChecksum {
+			code = utils.AddChecksum(code, readable)
+		}
+		if policy.reservedCodes[strings.ToLower(code)] || (s.honeypots != nil && s.honeypots.IsHoneypot(code)) {
+			log.Printf("Service generated reserved code (%s), retrying (%d/%d)...", code, i+1, maxGenerationRetries)
+			continue
+		}
 
 		_, repoErr := s.repo.FindByShortCode(code)
 		if repoErr != nil {
 			if errors.Is(repoErr, repositories.ErrNotFound) {
-				_, saveErr := s.repo.SaveMapping(code, longURL)
+				mapping.ShortCode = code
+				mapping.CreatedAt = s.now()
+				id, saveErr := s.repo.CreateMapping(mapping)
 				if saveErr != nil {
 					log.Printf("Service error saving new mapping (Code: %s): %v", code, saveErr)
 					return "", fmt.Errorf("service failed to save mapping: %w", saveErr)
 				}
-				log.Printf("Service successfully created mapping: %s -> %s", code, longURL)
+				mapping.ID = id
+				log.Printf("Service successfully created %s mapping: %s -> %s", mapping.Kind, code, mapping.LongURL)
+				s.events.Publish(EventLinkCreated, mapping)
 				return code, nil
 			}
 			log.Printf("Service database error checking code uniqueness (%s): %v", code, repoErr)
@@ -72,39 +451,463 @@ func (s *shortenerSvc) CreateShortURL(longURL string) (string, error) {
 	return "", fmt.Errorf("service could not generate unique short code after %d retries", maxGenerationRetries)
 }
 
+func (s *shortenerSvc) GetLink(shortCode string) (*shortner.URLMapping, error) {
+	mapping, err := s.repo.GetMapping(shortCode)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, notFoundError(CodeLinkNotFound, "short code not found")
+		}
+		return nil, fmt.Errorf("service failed to load mapping: %w", err)
+	}
+	return mapping, nil
+}
+
+// ConsumeLink uses up a single-use link; it fails with LINK_CONSUMED for
+// every caller but the first.
+func (s *shortenerSvc) ConsumeLink(shortCode string) error {
+	if err := s.repo.ConsumeMapping(shortCode, s.now()); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrLinkConsumed
+		}
+		log.Printf("Service error consuming single-use link '%s': %v", shortCode, err)
+		return fmt.Errorf("service failed to consume link: %w", err)
+	}
+	log.Printf("Service consumed single-use link '%s'", shortCode)
+	return nil
+}
+
+// CheckCode catches mistyped codes before they are looked up. Codes
+// generated with the checksum option are one character longer than the
+// others, so only codes of that length are checked; a bad check character
+// gives a CODE_MISTYPED error suggesting likely corrections. Codes created
+// before the option was turned on are unaffected.
+func (s *shortenerSvc) CheckCode(shortCode string) error {
+	policy := s.policy.Load()
+	if !policy.codeChecksum || len(shortCode) != policy.codeLength+1 || utils.ValidChecksum(shortCode) {
+		return nil
+	}
+	err := &Error{
+		Code:    CodeCodeMistyped,
+		Message: fmt.Sprintf("short code '%s' looks mistyped", shortCode),
+	}
+	for _, correction := range utils.ChecksumCorrections(shortCode, maxCodeCorrections) {
+		err.Fields = append(err.Fields, FieldError{Field: "short_code", Message: fmt.Sprintf("did you mean %s?", correction)})
+	}
+	return err
+}
+
 func (s *shortenerSvc) ValidateURL(inputURL string) bool {
+	return isHTTPURL(inputURL)
+}
+
+// normalizeLanguageTargets lower-cases the language tags and checks every
+// destination, returning a new map.
+func (s *shortenerSvc) normalizeLanguageTargets(targets map[string]string) (map[string]string, error) {
+	if len(targets) > maxLanguageTargets {
+		return nil, validationError("language_targets", fmt.Sprintf("at most %d language targets are allowed", maxLanguageTargets))
+	}
+	normalized := make(map[string]string, len(targets))
+	for tag, target := range targets {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !languageTagRe.MatchString(tag) {
+			return nil, validationError("language_targets", fmt.Sprintf("invalid language tag '%s'", tag))
+		}
+		if !s.ValidateURL(target) {
+			return nil, invalidURLError("language_targets", fmt.Sprintf("invalid URL for language '%s'", tag))
+		}
+		target, err := s.NormalizeDestination("language_targets", target)
+		if err != nil {
+			return nil, err
+		}
+		normalized[tag] = target
+	}
+	return normalized, nil
+}
+
+// normalizeTimeRules lower-cases the day names and checks the times, the
+// time zone and the destination of every rule, returning a new slice.
+func (s *shortenerSvc) normalizeTimeRules(rules []shortner.TimeRule) ([]shortner.TimeRule, error) {
+	if len(rules) > maxTimeRules {
+		return nil, validationError("time_rules", fmt.Sprintf("at most %d time rules are allowed", maxTimeRules))
+	}
+	normalized := make([]shortner.TimeRule, 0, len(rules))
+	for i, rule := range rules {
+		days := make([]string, 0, len(rule.Days))
+		for _, day := range rule.Days {
+			day = strings.ToLower(strings.TrimSpace(day))
+			if _, ok := shortner.Weekdays[day]; !ok {
+				return nil, validationError("time_rules", fmt.Sprintf("rule %d: invalid day '%s' (expected mon, tue, wed, thu, fri, sat or sun)", i+1, day))
+			}
+			days = append(days, day)
+		}
+		rule.Days = days
+		if (rule.From == "") != (rule.To == "") {
+			return nil, validationError("time_rules", fmt.Sprintf("rule %d: give both from and to, or neither", i+1))
+		}
+		for _, clock := range []string{rule.From, rule.To} {
+			if _, err := time.Parse("15:04", clock); clock != "" && err != nil {
+				return nil, validationError("time_rules", fmt.Sprintf("rule %d: invalid time '%s' (expected HH:MM)", i+1, clock))
+			}
+		}
+		if _, err := time.LoadLocation(rule.TimeZone); err != nil {
+			return nil, validationError("time_rules", fmt.Sprintf("rule %d: unknown time zone '%s'", i+1, rule.TimeZone))
+		}
+		if !s.ValidateURL(rule.URL) {
+			return nil, invalidURLError("time_rules", fmt.Sprintf("rule %d: invalid URL", i+1))
+		}
+		target, err := s.NormalizeDestination("time_rules", rule.URL)
+		if err != nil {
+			return nil, err
+		}
+		rule.URL = target
+		normalized = append(normalized, rule)
+	}
+	return normalized, nil
+}
+
+// normalizeCountries upper-cases the country codes and drops duplicates,
+// keeping the first occurrence; an empty, non-nil list stays non-nil.
+func normalizeCountries(field string, countries []string) ([]string, error) {
+	normalized := make([]string, 0, len(countries))
+	seen := make(map[string]bool, len(countries))
+	for _, country := range countries {
+		code := geo.Normalize(country)
+		if code == "" {
+			return nil, validationError(field, fmt.Sprintf("invalid country code '%s' (expected ISO 3166-1 alpha-2, such as DE)", country))
+		}
+		if !seen[code] {
+			seen[code] = true
+			normalized = append(normalized, code)
+		}
+	}
+	if len(normalized) > maxLinkCountries {
+		return nil, validationError(field, fmt.Sprintf("a link can list at most %d countries", maxLinkCountries))
+	}
+	return normalized, nil
+}
+
+// normalizePixelIDs drops duplicates, keeping the first occurrence.
+func normalizePixelIDs(ids []int64) ([]int64, error) {
+	seen := make(map[int64]bool, len(ids))
+	normalized := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id <= 0 {
+			return nil, validationError("pixel_ids", fmt.Sprintf("invalid pixel id %d", id))
+		}
+		if !seen[id] {
+			seen[id] = true
+			normalized = append(normalized, id)
+		}
+	}
+	if len(normalized) > maxLinkPixels {
+		return nil, validationError("pixel_ids", fmt.Sprintf("a link can fire at most %d pixels", maxLinkPixels))
+	}
+	return normalized, nil
+}
+
+// blockedSchemes run script in the visitor's browser or read their files.
+// isHTTPURL only accepts http and https anyway; these are refused by name
+// first so that widening the accepted schemes can never let them through.
+var blockedSchemes = []string{"javascript", "vbscript", "data", "file", "blob"}
+
+// hasBlockedScheme reports whether inputURL starts with one of
+// blockedSchemes the way a browser would read it: ignoring case, leading
+// spaces and control characters, and tabs and newlines anywhere.
+func hasBlockedScheme(inputURL string) bool {
+	cleaned := strings.TrimLeftFunc(inputURL, func(r rune) bool { return r <= ' ' })
+	cleaned = strings.NewReplacer("\t", "", "\n", "", "\r", "").Replace(cleaned)
+	for _, scheme := range blockedSchemes {
+		if len(cleaned) > len(scheme) && cleaned[len(scheme)] == ':' && strings.EqualFold(cleaned[:len(scheme)], scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+func isHTTPURL(inputURL string) bool {
+	if hasBlockedScheme(inputURL) {
+		return false
+	}
 	u, err := url.ParseRequestURI(inputURL)
 	if err != nil {
 		return false
 	}
-	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Hostname() != ""
 }
 
 func (s *shortenerSvc) UpdateLongURL(shortCode, newLongURL string) error {
-	if !s.ValidateURL(newLongURL) {
-		return errors.New("invalid new URL format provided")
+	return s.UpdateLink(shortCode, shortner.LinkUpdate{LongURL: &newLongURL})
+}
+
+func (s *shortenerSvc) UpdateLink(shortCode string, update shortner.LinkUpdate) error {
+	update, err := s.prepareUpdate(update)
+	if err != nil {
+		return err
 	}
 
-	err := s.repo.UpdateLongURL(shortCode, newLongURL)
+	mapping, err := s.repo.GetMapping(shortCode)
 	if err != nil {
 		if errors.Is(err, repositories.ErrNotFound) {
 			log.Printf("Service: Attempted to update non-existent short code '%s'", shortCode)
-			return err
+			return notFoundError(CodeLinkNotFound, "short code not found")
+		}
+		log.Printf("Service error loading mapping for code '%s': %v", shortCode, err)
+		return fmt.Errorf("service failed to load mapping: %w", err)
+	}
+
+	previousURL := mapping.LongURL
+	if err := s.mergeUpdate(mapping, update); err != nil {
+		return err
+	}
+
+	if err := s.repo.UpdateMapping(*mapping); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeLinkNotFound, "short code not found")
 		}
 		log.Printf("Service error updating mapping for code '%s': %v", shortCode, err)
 		return fmt.Errorf("service failed to update mapping: %w", err)
 	}
+	if mapping.LongURL != previousURL {
+		s.recordRevision(mapping.ShortCode, previousURL, mapping.LongURL, update.Source)
+	}
 
-	log.Printf("Service successfully updated mapping for code '%s' to '%s'", shortCode, newLongURL)
+	log.Printf("Service successfully updated link '%s'", shortCode)
 	return nil
 }
 
+// prepareUpdate validates the fields of update that do not depend on the
+// link and returns it with the destinations normalized.
+func (s *shortenerSvc) prepareUpdate(update shortner.LinkUpdate) (shortner.LinkUpdate, error) {
+	if update.LongURL != nil {
+		if !s.ValidateURL(*update.LongURL) {
+			return update, invalidURLError("new_url", "invalid new URL format provided")
+		}
+		normalize := s.NormalizeDestination
+		if update.Source == shortner.RevisionSourceMerge {
+			// Merged links point at their canonical short link on
+			// purpose.
+			normalize = s.normalizeDestination
+		}
+		longURL, err := normalize("new_url", *update.LongURL)
+		if err != nil {
+			return update, err
+		}
+		update.LongURL = &longURL
+	}
+	if update.Headers != nil {
+		if err := utils.ValidateResponseHeaders(update.Headers); err != nil {
+			return update, validationError("headers", "invalid headers: "+err.Error())
+		}
+	}
+	if update.RedirectType != nil && !validRedirectTypes[*update.RedirectType] {
+		return update, validationError("redirect_type", fmt.Sprintf("invalid redirect type %d (expected 301, 302, 307 or 308)", *update.RedirectType))
+	}
+	if update.CacheControl != nil && strings.ContainsAny(*update.CacheControl, "\r\n\x00") {
+		return update, validationError("cache_control", "invalid cache control value")
+	}
+	if update.LanguageTargets != nil {
+		targets, err := s.normalizeLanguageTargets(update.LanguageTargets)
+		if err != nil {
+			return update, err
+		}
+		update.LanguageTargets = targets
+	}
+	if update.TimeRules != nil {
+		rules, err := s.normalizeTimeRules(update.TimeRules)
+		if err != nil {
+			return update, err
+		}
+		update.TimeRules = rules
+	}
+	if update.PixelIDs != nil {
+		ids, err := normalizePixelIDs(update.PixelIDs)
+		if err != nil {
+			return update, err
+		}
+		update.PixelIDs = ids
+	}
+	if update.AllowedCountries != nil {
+		countries, err := normalizeCountries("allowed_countries", update.AllowedCountries)
+		if err != nil {
+			return update, err
+		}
+		update.AllowedCountries = countries
+	}
+	if update.BlockedCountries != nil {
+		countries, err := normalizeCountries("blocked_countries", update.BlockedCountries)
+		if err != nil {
+			return update, err
+		}
+		update.BlockedCountries = countries
+	}
+	if update.QueryPassthrough != nil {
+		switch *update.QueryPassthrough {
+		case "", shortner.QueryOff, shortner.QueryMerge, shortner.QueryOverride:
+		default:
+			return update, validationError("query_passthrough", fmt.Sprintf("invalid query passthrough '%s' (expected %s, %s, %s or empty for the default)", *update.QueryPassthrough, shortner.QueryOff, shortner.QueryMerge, shortner.QueryOverride))
+		}
+	}
+	if update.SpikeFactor != nil && *update.SpikeFactor > 0 && *update.SpikeFactor <= 1 {
+		return update, validationError("spike_factor", "spike_factor must be greater than 1, 0 for the default or negative to turn spike alerts off")
+	}
+	if update.SpikeMinClicks != nil && *update.SpikeMinClicks < 0 {
+		return update, validationError("spike_min_clicks", "spike_min_clicks cannot be negative")
+	}
+	if update.StatsVisibility != nil && !validStatsVisibility(*update.StatsVisibility) {
+		return update, validationError("stats_visibility", fmt.Sprintf("invalid stats visibility '%s' (expected %s, %s or %s)", *update.StatsVisibility, shortner.StatsPrivate, shortner.StatsPublic, shortner.StatsToken))
+	}
+	if update.Language != nil && *update.Language != "" && !i18n.Default().Supports(*update.Language) {
+		return update, validationError("language", fmt.Sprintf("unsupported language '%s' (available: %s)", *update.Language, strings.Join(i18n.Default().Languages(), ", ")))
+	}
+
+	return update, nil
+}
+
+// mergeUpdate applies a prepared update to mapping, refusing it when the
+// link would then redirect in a loop.
+func (s *shortenerSvc) mergeUpdate(mapping *shortner.URLMapping, update shortner.LinkUpdate) error {
+	if update.LongURL != nil {
+		mapping.LongURL = *update.LongURL
+	}
+	if update.Headers != nil {
+		mapping.Headers = update.Headers
+	}
+	if update.RedirectType != nil {
+		mapping.RedirectType = *update.RedirectType
+	}
+	if update.CacheControl != nil {
+		mapping.CacheControl = *update.CacheControl
+	}
+	if update.Language != nil {
+		mapping.Language = *update.Language
+	}
+	if update.LanguageTargets != nil {
+		mapping.LanguageTargets = update.LanguageTargets
+	}
+	if update.TimeRules != nil {
+		mapping.TimeRules = update.TimeRules
+	}
+	if update.PixelIDs != nil {
+		mapping.PixelIDs = update.PixelIDs
+	}
+	if update.AllowedCountries != nil {
+		mapping.AllowedCountries = update.AllowedCountries
+	}
+	if update.BlockedCountries != nil {
+		mapping.BlockedCountries = update.BlockedCountries
+	}
+	if len(mapping.AllowedCountries) > 0 && len(mapping.BlockedCountries) > 0 {
+		return validationError("allowed_countries", "a link can have allowed_countries or blocked_countries, not both")
+	}
+	if update.SocialPreview != nil {
+		if *update.SocialPreview && mapping.Kind != shortner.KindRedirect {
+			return validationError("social_preview", fmt.Sprintf("only redirect links can have a social preview, this link is a %s", mapping.Kind))
+		}
+		mapping.SocialPreview = *update.SocialPreview
+	}
+	if update.QueryPassthrough != nil {
+		if *update.QueryPassthrough != "" && mapping.Kind != shortner.KindRedirect {
+			return validationError("query_passthrough", fmt.Sprintf("only redirect links pass their query on, this link is a %s", mapping.Kind))
+		}
+		mapping.QueryPassthrough = *update.QueryPassthrough
+	}
+	if update.SpikeFactor != nil {
+		mapping.SpikeFactor = *update.SpikeFactor
+	}
+	if update.SpikeMinClicks != nil {
+		mapping.SpikeMinClicks = *update.SpikeMinClicks
+	}
+	if update.SingleUse != nil {
+		if *update.SingleUse && mapping.Kind != shortner.KindRedirect && mapping.Kind != shortner.KindFile {
+			return validationError("single_use", fmt.Sprintf("only redirect and file links can be single-use, this link is a %s", mapping.Kind))
+		}
+		mapping.SingleUse = *update.SingleUse
+		mapping.ConsumedAt = nil
+	}
+	if update.StatsVisibility != nil {
+		mapping.StatsVisibility = *update.StatsVisibility
+		mapping.StatsToken = ""
+		if mapping.StatsVisibility == shortner.StatsToken {
+			token, err := s.random().RandomString(statsTokenLength)
+			if err != nil {
+				return fmt.Errorf("service failed to generate stats token: %w", err)
+			}
+			mapping.StatsToken = token
+		}
+	}
+	if update.ExpiresAt != nil {
+		if update.ExpiresAt.IsZero() {
+			mapping.ExpiresAt = nil
+		} else {
+			expiresAt := *update.ExpiresAt
+			mapping.ExpiresAt = &expiresAt
+		}
+	}
+
+	return s.checkLoop(mapping)
+}
+
+// recordRevision adds a destination change to the revision history. The
+// change itself has already been saved, so a failure is only logged.
+func (s *shortenerSvc) recordRevision(shortCode, previousURL, longURL, source string) {
+	if s.revisions == nil {
+		return
+	}
+	if source == "" {
+		source = shortner.RevisionSourceAPI
+	}
+	_, err := s.revisions.AddRevision(shortner.LinkRevision{
+		ShortCode:   shortCode,
+		PreviousURL: previousURL,
+		LongURL:     longURL,
+		Source:      source,
+		CreatedAt:   s.now(),
+	})
+	if err != nil {
+		log.Printf("Service error recording revision for code '%s': %v", shortCode, err)
+	}
+}
+
+func (s *shortenerSvc) ListRevisions(shortCode string) ([]shortner.LinkRevision, error) {
+	mapping, err := s.GetLink(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if s.revisions == nil {
+		return nil, nil
+	}
+	revisions, err := s.revisions.ListRevisions(mapping.ShortCode)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+// DeleteMapping deletes a link. With a trash, the link is moved there
+// first and can be restored until it is purged.
 func (s *shortenerSvc) DeleteMapping(shortCode string) error {
+	if s.trash != nil {
+		mapping, err := s.repo.GetMapping(shortCode)
+		if err != nil {
+			if errors.Is(err, repositories.ErrNotFound) {
+				log.Printf("Service: Attempted to delete non-existent short code '%s'", shortCode)
+				return notFoundError(CodeLinkNotFound, "short code not found")
+			}
+			log.Printf("Service error loading mapping for code '%s': %v", shortCode, err)
+			return fmt.Errorf("service failed to load mapping: %w", err)
+		}
+		if err := s.moveToTrash(*mapping); err != nil {
+			return err
+		}
+		shortCode = mapping.ShortCode
+	}
+
 	err := s.repo.DeleteMapping(shortCode)
 	if err != nil {
+		s.keepOutOfTrash(shortCode)
 		if errors.Is(err, repositories.ErrNotFound) {
 			log.Printf("Service: Attempted to delete non-existent short code '%s'", shortCode)
-			return err
+			return notFoundError(CodeLinkNotFound, "short code not found")
 		}
 		log.Printf("Service error deleting mapping for code '%s': %v", shortCode, err)
 		return fmt.Errorf("service failed to delete mapping: %w", err)
@@ -113,3 +916,50 @@ func (s *shortenerSvc) DeleteMapping(shortCode string) error {
 	log.Printf("Service successfully deleted mapping for code '%s'", shortCode)
 	return nil
 }
+
+// moveToTrash stores a link that is about to be deleted. Without a trash
+// it does nothing.
+func (s *shortenerSvc) moveToTrash(mapping shortner.URLMapping) error {
+	if s.trash == nil {
+		return nil
+	}
+	if err := s.trash.AddTrash(mapping, s.now()); err != nil {
+		log.Printf("Service error moving code '%s' to the trash: %v", mapping.ShortCode, err)
+		return fmt.Errorf("service failed to move link to the trash: %w", err)
+	}
+	return nil
+}
+
+// keepOutOfTrash takes back the trash entry of a link whose deletion
+// failed, so the trash only lists links that are gone. A failure is only
+// logged: restoring the entry would then fail with CODE_TAKEN.
+func (s *shortenerSvc) keepOutOfTrash(shortCode string) {
+	if s.trash == nil {
+		return
+	}
+	if err := s.trash.RemoveTrash(shortCode); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		log.Printf("Service error taking code '%s' back out of the trash: %v", shortCode, err)
+	}
+}
+
+func (s *shortenerSvc) ListLinksSince(afterID int64, limit int) ([]shortner.URLMapping, error) {
+	return s.listSince(afterID, limit)
+}
+
+// listSince lists links when the repository is a LinkLister, and otherwise
+// fails with ErrListingUnavailable.
+func (s *shortenerSvc) listSince(afterID int64, limit int) ([]shortner.URLMapping, error) {
+	err := repositories.ErrListUnsupported
+	var mappings []shortner.URLMapping
+	if lister, ok := s.repo.(repositories.LinkLister); ok {
+		mappings, err = lister.ListSince(afterID, limit)
+	}
+	if err != nil {
+		if errors.Is(err, repositories.ErrListUnsupported) {
+			return nil, ErrListingUnavailable
+		}
+		log.Printf("Service error listing mappings after id %d: %v", afterID, err)
+		return nil, fmt.Errorf("service failed to list mappings: %w", err)
+	}
+	return mappings, nil
+}
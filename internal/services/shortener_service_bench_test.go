@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"template/internal/pkg/latency"
+)
+
+// benchLinks is the number of links created before the lookup benchmarks.
+const benchLinks = 1000
+
+// seededShortener is a service with benchLinks links, whose codes and
+// destinations are returned.
+func seededShortener(b *testing.B) (*shortenerSvc, []string, []string) {
+	b.Helper()
+	s := sqliteShortener(b, openTestDB(b))
+	codes := make([]string, benchLinks)
+	urls := make([]string, benchLinks)
+	for i := range codes {
+		urls[i] = fmt.Sprintf("https://example.com/seed/%d", i)
+		code, err := s.CreateShortURL(urls[i])
+		if err != nil {
+			b.Fatal(err)
+		}
+		codes[i] = code
+	}
+	return s, codes, urls
+}
+
+// reportLatency adds the percentiles of rec to the benchmark's output.
+func reportLatency(b *testing.B, rec *latency.Recorder) {
+	for unit, value := range rec.Summary().Metrics() {
+		b.ReportMetric(value, unit)
+	}
+}
+
+// BenchmarkCreateShortURL creates a link to a new destination each time:
+// validation, normalization, the duplicate check, code generation with its
+// uniqueness check and the insert.
+func BenchmarkCreateShortURL(b *testing.B) {
+	s := sqliteShortener(b, openTestDB(b))
+	var rec latency.Recorder
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		if _, err := s.CreateShortURL(fmt.Sprintf("https://example.com/bench/%d", i)); err != nil {
+			b.Fatal(err)
+		}
+		rec.Since(start)
+	}
+	reportLatency(b, &rec)
+}
+
+// BenchmarkCreateShortURLExisting shortens destinations that already have a
+// link, which ends at the duplicate check.
+func BenchmarkCreateShortURLExisting(b *testing.B) {
+	s, _, urls := seededShortener(b)
+	var rec latency.Recorder
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		if _, err := s.CreateShortURL(urls[rand.IntN(len(urls))]); err != nil {
+			b.Fatal(err)
+		}
+		rec.Since(start)
+	}
+	reportLatency(b, &rec)
+}
+
+// BenchmarkGetLink is the lookup behind every redirect.
+func BenchmarkGetLink(b *testing.B) {
+	s, codes, _ := seededShortener(b)
+	var rec latency.Recorder
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			start := time.Now()
+			if _, err := s.GetLink(codes[rand.IntN(len(codes))]); err != nil {
+				b.Error(err)
+				return
+			}
+			rec.Since(start)
+		}
+	})
+	reportLatency(b, &rec)
+}
+
+// BenchmarkNormalizeDestination covers the checks every destination goes
+// through before it reaches the repository.
+func BenchmarkNormalizeDestination(b *testing.B) {
+	s := sqliteShortener(b, openTestDB(b))
+	urls := []string{
+		"https://example.com/a/b?c=d",
+		"https://пример.рф/путь?q=значение",
+		"http://[2001:db8::1]:8080/",
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		raw := urls[i%len(urls)]
+		if !s.ValidateURL(raw) {
+			b.Fatalf("ValidateURL(%q) = false", raw)
+		}
+		if _, err := s.NormalizeDestination("url", raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
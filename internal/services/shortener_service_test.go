@@ -0,0 +1,375 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"template/internal/pkg/utils"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+var testNow = time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func TestCreateShortURLUsesClockAndGenerator(t *testing.T) {
+	s := sqliteShortener(t, openTestDB(t))
+	s.SetClock(&fixedClock{now: testNow})
+	s.SetGenerator(&sequenceGenerator{values: []string{"first00", "second0"}})
+
+	code, err := s.CreateShortURL("https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "first00" {
+		t.Errorf("code = %q, want the first generated string", code)
+	}
+	link, err := s.GetLink(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !link.CreatedAt.Equal(testNow) {
+		t.Errorf("CreatedAt = %v, want %v", link.CreatedAt, testNow)
+	}
+
+	if code, err := s.CreateShortURL("https://example.com/b"); err != nil || code != "second0" {
+		t.Errorf("second link = %q, %v, want second0", code, err)
+	}
+}
+
+func TestCreateShortURLSkipsReservedAndTakenCodes(t *testing.T) {
+	s := sqliteShortener(t, openTestDB(t))
+	s.SetPolicy(LinkPolicy{PrivateDestinations: privateDestinationsAllow, ReservedCodes: []string{"ADMIN00"}})
+	s.SetGenerator(&sequenceGenerator{values: []string{"taken00"}})
+	if _, err := s.CreateShortURL("https://example.com/taken"); err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetGenerator(&sequenceGenerator{values: []string{"admin00", "taken00", "fresh00"}})
+	code, err := s.CreateShortURL("https://example.com/new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "fresh00" {
+		t.Errorf("code = %q, want fresh00 after skipping a reserved and a taken code", code)
+	}
+}
+
+func TestCreateShortURLGivesUpAfterRetries(t *testing.T) {
+	s := sqliteShortener(t, openTestDB(t))
+	s.SetGenerator(&sequenceGenerator{values: []string{"taken00"}})
+	if _, err := s.CreateShortURL("https://example.com/taken"); err != nil {
+		t.Fatal(err)
+	}
+
+	values := make([]string, maxGenerationRetries)
+	for i := range values {
+		values[i] = "taken00"
+	}
+	s.SetGenerator(&sequenceGenerator{values: values})
+	if _, err := s.CreateShortURL("https://example.com/new"); err == nil {
+		t.Fatal("CreateShortURL succeeded although every generated code was taken")
+	}
+}
+
+func TestChecksumCodesAreChecked(t *testing.T) {
+	s := sqliteShortener(t, openTestDB(t))
+	s.SetPolicy(LinkPolicy{PrivateDestinations: privateDestinationsAllow, CodeChecksum: true})
+	s.SetGenerator(&sequenceGenerator{values: []string{"abcdefg"}})
+
+	code, err := s.CreateShortURL("https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := utils.AddChecksum("abcdefg", false); code != want {
+		t.Fatalf("code = %q, want %q", code, want)
+	}
+	if err := s.CheckCode(code); err != nil {
+		t.Errorf("CheckCode(%q) = %v, want nil", code, err)
+	}
+	mistyped := code[:len(code)-1] + string(code[len(code)-1]^1)
+	var serviceErr *Error
+	if err := s.CheckCode(mistyped); !errors.As(err, &serviceErr) || serviceErr.Code != CodeCodeMistyped {
+		t.Errorf("CheckCode(%q) = %v, want %s", mistyped, err, CodeCodeMistyped)
+	}
+}
+
+func TestRegionsOnlyChangeTheirOwnLinks(t *testing.T) {
+	db := openTestDB(t)
+	repo := repositories.NewSQLiteShortenerRepo(db, false)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	regions := []repositories.Region{
+		{Name: "eu", Prefix: "e", BaseURL: "https://eu.example.com"},
+		{Name: "us", Prefix: "u", BaseURL: "https://us.example.com"},
+	}
+	instance := func(home int) *shortenerSvc {
+		s := NewShortenerService(repositories.NewRegionalShortenerRepo(repo, regions[home], regions, false), nil, nil, nil, nil).(*shortenerSvc)
+		s.SetPolicy(LinkPolicy{PrivateDestinations: privateDestinationsAllow, CodePrefix: regions[home].Prefix})
+		s.SetGenerator(&sequenceGenerator{values: []string{"abcdefg"}})
+		return s
+	}
+	eu, us := instance(0), instance(1)
+
+	euCode, err := eu.CreateShortURL("https://example.com/eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usCode, err := us.CreateShortURL("https://example.com/us")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if euCode != "eabcdefg" || usCode != "uabcdefg" {
+		t.Fatalf("codes = %q, %q, want the same random part behind each region's prefix", euCode, usCode)
+	}
+
+	if _, err := us.GetLink(euCode); err != nil {
+		t.Errorf("reading the eu link in us: %v", err)
+	}
+	var wrongRegion *repositories.WrongRegionError
+	if err := us.DeleteMapping(euCode); !errors.As(err, &wrongRegion) || wrongRegion.Region.Name != "eu" {
+		t.Errorf("deleting the eu link in us = %v, want WrongRegionError for eu", err)
+	}
+	if err := eu.DeleteMapping(euCode); err != nil {
+		t.Errorf("deleting the eu link in eu: %v", err)
+	}
+}
+
+func TestKeyValueStorageWithoutIndexes(t *testing.T) {
+	repo := repositories.NewKeyValueShortenerRepo(repositories.NewMemoryKeyValueStore(), false)
+	s := NewShortenerService(repo, nil, nil, nil, nil).(*shortenerSvc)
+	s.SetPolicy(LinkPolicy{PrivateDestinations: privateDestinationsAllow})
+	s.SetGenerator(&sequenceGenerator{values: []string{"first00", "second0"}})
+
+	first, err := s.CreateShortURL("https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.CreateShortURL("https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Errorf("both requests got %q; without an index of destinations each gets a link", first)
+	}
+	if link, err := s.GetLink(second); err != nil || link.LongURL != "https://example.com/a" {
+		t.Errorf("GetLink(%q) = %+v, %v", second, link, err)
+	}
+	if _, err := s.ListLinksSince(0, 10); !errors.Is(err, ErrListingUnavailable) {
+		t.Errorf("ListLinksSince error = %v, want %s", err, CodeListingUnavailable)
+	}
+}
+
+func TestConsumeLinkUsesClock(t *testing.T) {
+	s := sqliteShortener(t, openTestDB(t))
+	s.SetClock(&fixedClock{now: testNow})
+	code, err := s.CreateSingleUseURL("https://example.com/once")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ConsumeLink(code); err != nil {
+		t.Fatal(err)
+	}
+	link, err := s.GetLink(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.ConsumedAt == nil || !link.ConsumedAt.Equal(testNow) {
+		t.Errorf("ConsumedAt = %v, want %v", link.ConsumedAt, testNow)
+	}
+}
+
+func TestScheduleChangeUsesClock(t *testing.T) {
+	db := openTestDB(t)
+	links := sqliteShortener(t, db)
+	code, err := links.CreateShortURL("https://example.com/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := repositories.NewSQLiteScheduleRepo(db)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	schedule := NewScheduleService(links, repo)
+	schedule.(Deterministic).SetClock(&fixedClock{now: testNow})
+
+	if _, err := schedule.ScheduleChange(code, "https://example.com/new", testNow.Add(-time.Minute)); err == nil {
+		t.Error("a change effective before the clock's time was accepted")
+	}
+	change, err := schedule.ScheduleChange(code, "https://example.com/new", testNow.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !change.CreatedAt.Equal(testNow) {
+		t.Errorf("CreatedAt = %v, want %v", change.CreatedAt, testNow)
+	}
+}
+
+func TestPolicyDefaultsForNewLinks(t *testing.T) {
+	s := sqliteShortener(t, openTestDB(t))
+	s.SetClock(&fixedClock{now: testNow})
+	s.SetPolicy(LinkPolicy{
+		PrivateDestinations: privateDestinationsAllow,
+		CodeLength:          10,
+		DefaultRedirectType: 301,
+		DefaultTTL:          time.Hour,
+	})
+
+	first, err := s.CreateShortURL("https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 10 {
+		t.Errorf("code %q has %d characters, want 10", first, len(first))
+	}
+	link, err := s.GetLink(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.RedirectType != 301 {
+		t.Errorf("RedirectType = %d, want the default 301", link.RedirectType)
+	}
+	if want := testNow.Add(time.Hour); link.ExpiresAt == nil || !link.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt = %v, want %v", link.ExpiresAt, want)
+	}
+
+	// The first link may expire before a second one to the same
+	// destination would, so it is not reused.
+	second, err := s.CreateShortURL("https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Error("CreateShortURL reused a link that expires by default")
+	}
+
+	expiresAt := testNow.Add(24 * time.Hour)
+	own, err := s.CreateLink(shortner.URLMapping{LongURL: "https://example.com/b", RedirectType: 307, ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link, err = s.GetLink(own); err != nil {
+		t.Fatal(err)
+	}
+	if link.RedirectType != 307 || link.ExpiresAt == nil || !link.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("link settings = %d, %v, want its own 307 and %v", link.RedirectType, link.ExpiresAt, expiresAt)
+	}
+}
+
+func TestUpdateCountries(t *testing.T) {
+	s := sqliteShortener(t, openTestDB(t))
+	code, err := s.CreateShortURL("https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateLink(code, shortner.LinkUpdate{AllowedCountries: []string{"de", " AT", "DE"}}); err != nil {
+		t.Fatal(err)
+	}
+	link, err := s.GetLink(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(link.AllowedCountries) != 2 || link.AllowedCountries[0] != "DE" || link.AllowedCountries[1] != "AT" {
+		t.Errorf("AllowedCountries = %v, want [DE AT]", link.AllowedCountries)
+	}
+	if !link.CountryAllowed("AT") || link.CountryAllowed("FR") || link.CountryAllowed("") {
+		t.Error("an allow-list of DE and AT let in the wrong countries")
+	}
+
+	if err := s.UpdateLink(code, shortner.LinkUpdate{BlockedCountries: []string{"FR"}}); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("setting both lists error = %v, want a validation error", err)
+	}
+	if err := s.UpdateLink(code, shortner.LinkUpdate{AllowedCountries: []string{"germany"}}); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("invalid country error = %v, want a validation error", err)
+	}
+	if err := s.UpdateLink(code, shortner.LinkUpdate{AllowedCountries: []string{}, BlockedCountries: []string{"FR"}}); err != nil {
+		t.Fatal(err)
+	}
+	if link, err = s.GetLink(code); err != nil {
+		t.Fatal(err)
+	}
+	if len(link.AllowedCountries) != 0 || !link.CountryAllowed("") || link.CountryAllowed("FR") {
+		t.Errorf("after switching to a block-list: %+v", link)
+	}
+}
+
+func TestCreateWildcardURL(t *testing.T) {
+	s := sqliteShortener(t, openTestDB(t))
+	plain, err := s.CreateShortURL("https://example.com/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wildcard, err := s.CreateWildcardURL("https://example.com/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wildcard == plain {
+		t.Fatalf("CreateWildcardURL reused plain link %s", plain)
+	}
+	if link, err := s.GetLink(wildcard); err != nil || !link.Wildcard {
+		t.Errorf("GetLink = %+v, %v, want a wildcard link", link, err)
+	}
+	if again, err := s.CreateShortURL("https://example.com/docs"); err != nil || again != plain {
+		t.Errorf("CreateShortURL = %s, %v, want plain link %s", again, err, plain)
+	}
+}
+
+func TestUpdateQueryPassthrough(t *testing.T) {
+	s := sqliteShortener(t, openTestDB(t))
+	code, err := s.CreateShortURL("https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []string{shortner.QueryOverride, ""} {
+		if err := s.UpdateLink(code, shortner.LinkUpdate{QueryPassthrough: &mode}); err != nil {
+			t.Fatalf("%q: %v", mode, err)
+		}
+		link, err := s.GetLink(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link.QueryPassthrough != mode {
+			t.Errorf("QueryPassthrough = %q, want %q", link.QueryPassthrough, mode)
+		}
+	}
+	bogus := "append"
+	if err := s.UpdateLink(code, shortner.LinkUpdate{QueryPassthrough: &bogus}); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("error = %v, want a validation error", err)
+	}
+}
+
+func TestUpdateTimeRules(t *testing.T) {
+	s := sqliteShortener(t, openTestDB(t))
+	code, err := s.CreateShortURL("https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := []shortner.TimeRule{{Days: []string{" Sat", "SUN"}, From: "18:00", To: "09:00", TimeZone: "Europe/Berlin", URL: "https://example.com/closed"}}
+	if err := s.UpdateLink(code, shortner.LinkUpdate{TimeRules: rules}); err != nil {
+		t.Fatal(err)
+	}
+	link, err := s.GetLink(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(link.TimeRules) != 1 || strings.Join(link.TimeRules[0].Days, ",") != "sat,sun" || link.TimeRules[0].URL != "https://example.com/closed" {
+		t.Errorf("TimeRules = %+v", link.TimeRules)
+	}
+
+	invalid := []shortner.TimeRule{
+		{Days: []string{"monday"}, URL: "https://example.com/"},
+		{From: "18:00", URL: "https://example.com/"},
+		{From: "25:00", To: "09:00", URL: "https://example.com/"},
+		{TimeZone: "Mars/Olympus", URL: "https://example.com/"},
+	}
+	for _, rule := range invalid {
+		if err := s.UpdateLink(code, shortner.LinkUpdate{TimeRules: []shortner.TimeRule{rule}}); !errors.Is(err, ErrValidationFailed) {
+			t.Errorf("rule %+v: error = %v, want a validation error", rule, err)
+		}
+	}
+	if err := s.UpdateLink(code, shortner.LinkUpdate{TimeRules: []shortner.TimeRule{{URL: "not a url"}}}); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("rule without a valid URL: error = %v, want INVALID_URL", err)
+	}
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"template/internal/pkg/linksign"
+	"template/internal/usecases/shortner"
+)
+
+// SigningService issues and checks signed links. While it is enabled every
+// redirect must carry a valid, unexpired signature, which is checked before
+// the link is looked up.
+type SigningService interface {
+	Sign(shortCode string, expiresAt time.Time) (*shortner.SignedLink, error)
+	// Verify checks the signature sig of shortCode until exp made with
+	// the key kid, empty for the key without an ID.
+	Verify(shortCode, kid, exp, sig string, now time.Time) error
+}
+
+type signingSvc struct {
+	determinism
+	links  ShortenerService
+	signer *linksign.Signer
+}
+
+func NewSigningService(links ShortenerService, signer *linksign.Signer) SigningService {
+	return &signingSvc{links: links, signer: signer}
+}
+
+func (s *signingSvc) Sign(shortCode string, expiresAt time.Time) (*shortner.SignedLink, error) {
+	if expiresAt.IsZero() {
+		return nil, validationError("expires_at", "expires_at is required")
+	}
+	if !expiresAt.After(s.now()) {
+		return nil, validationError("expires_at", "expires_at must be in the future")
+	}
+	mapping, err := s.links.GetLink(shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt = expiresAt.UTC().Truncate(time.Second)
+	kid, exp, sig := s.signer.Sign(mapping.ShortCode, expiresAt, s.now())
+	log.Printf("Service signed link '%s' until %s with key '%s'", mapping.ShortCode, expiresAt.Format(time.RFC3339), kid)
+	return &shortner.SignedLink{ShortCode: mapping.ShortCode, ExpiresAt: expiresAt, KeyID: kid, Expires: exp, Signature: sig}, nil
+}
+
+func (s *signingSvc) Verify(shortCode, kid, exp, sig string, now time.Time) error {
+	err := s.signer.Verify(shortCode, kid, exp, sig, now)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, linksign.ErrExpired):
+		return &Error{Code: CodeSignatureExpired, Message: "the signature of this link has expired"}
+	case errors.Is(err, linksign.ErrMissing):
+		return &Error{Code: CodeSignatureInvalid, Message: "this link can only be opened with a signature"}
+	}
+	return &Error{Code: CodeSignatureInvalid, Message: "the signature of this link is invalid"}
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"template/internal/pkg/linksign"
+)
+
+func TestSigningKeyRotation(t *testing.T) {
+	s := sqliteShortener(t, openTestDB(t))
+	code, err := s.CreateShortURL("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotation := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	signer, err := linksign.NewKeyring([]linksign.Key{
+		{Secret: "the key links were signed with before key IDs....."},
+		{ID: "2030", Secret: "the key that takes over on new year's day 2030.....", NotBefore: rotation},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signing := NewSigningService(s, signer).(*signingSvc)
+	clock := &fixedClock{now: rotation.Add(-time.Hour)}
+	signing.SetClock(clock)
+	expiresAt := rotation.Add(30 * 24 * time.Hour)
+
+	before, err := signing.Sign(code, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.KeyID != "" {
+		t.Errorf("signed before the rotation with key %q, want the key without an ID", before.KeyID)
+	}
+	clock.now = rotation
+	after, err := signing.Sign(code, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.KeyID != "2030" {
+		t.Errorf("signed after the rotation with key %q, want 2030", after.KeyID)
+	}
+
+	// Signatures made before the rotation keep working.
+	for _, link := range []struct{ kid, exp, sig string }{
+		{before.KeyID, before.Expires, before.Signature},
+		{after.KeyID, after.Expires, after.Signature},
+	} {
+		if err := signing.Verify(code, link.kid, link.exp, link.sig, clock.now); err != nil {
+			t.Errorf("Verify with key %q: %v", link.kid, err)
+		}
+	}
+	var serviceErr *Error
+	if err := signing.Verify(code, "2030", before.Expires, before.Signature, clock.now); !errors.As(err, &serviceErr) || serviceErr.Code != CodeSignatureInvalid {
+		t.Errorf("Verify with the wrong key ID: error = %v, want %s", err, CodeSignatureInvalid)
+	}
+	if err := signing.Verify(code, "retired", after.Expires, after.Signature, clock.now); !errors.As(err, &serviceErr) || serviceErr.Code != CodeSignatureInvalid {
+		t.Errorf("Verify with an unknown key ID: error = %v, want %s", err, CodeSignatureInvalid)
+	}
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const maxSlackTeamNameLength = 100
+
+// slackTeamIDRe matches Slack team and enterprise IDs, such as T0123ABCD.
+var slackTeamIDRe = regexp.MustCompile(`^[A-Z0-9]{1,32}$`)
+
+// SlackWorkspaceService manages the Slack workspaces that sign slash
+// commands with their own secret instead of SLACK_SIGNING_SECRET.
+type SlackWorkspaceService interface {
+	ListWorkspaces() ([]shortner.SlackWorkspace, error)
+	// SaveWorkspace stores the workspace or replaces its name and secret,
+	// and reports whether it was created.
+	SaveWorkspace(teamID, teamName, signingSecret string) (*shortner.SlackWorkspace, bool, error)
+	DeleteWorkspace(teamID string) error
+}
+
+type slackWorkspaceSvc struct {
+	repo repositories.SlackWorkspaceRepository
+}
+
+func NewSlackWorkspaceService(repo repositories.SlackWorkspaceRepository) SlackWorkspaceService {
+	return &slackWorkspaceSvc{repo: repo}
+}
+
+func (s *slackWorkspaceSvc) ListWorkspaces() ([]shortner.SlackWorkspace, error) {
+	workspaces, err := s.repo.ListWorkspaces()
+	if err != nil {
+		log.Printf("Service error listing Slack workspaces: %v", err)
+		return nil, fmt.Errorf("service failed to list Slack workspaces: %w", err)
+	}
+	return workspaces, nil
+}
+
+func (s *slackWorkspaceSvc) SaveWorkspace(teamID, teamName, signingSecret string) (*shortner.SlackWorkspace, bool, error) {
+	if !slackTeamIDRe.MatchString(teamID) {
+		return nil, false, validationError("team_id", "team_id must be a Slack team ID of up to 32 capital letters and digits")
+	}
+	if len(teamName) > maxSlackTeamNameLength {
+		return nil, false, validationError("team_name", fmt.Sprintf("team_name must be at most %d bytes", maxSlackTeamNameLength))
+	}
+	if signingSecret == "" {
+		return nil, false, validationError("signing_secret", "signing_secret is required")
+	}
+	_, err := s.repo.GetWorkspace(teamID)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		log.Printf("Service error looking up Slack workspace '%s': %v", teamID, err)
+		return nil, false, fmt.Errorf("service failed to save Slack workspace: %w", err)
+	}
+	created := err != nil
+	if err := s.repo.SaveWorkspace(teamID, teamName, signingSecret); err != nil {
+		log.Printf("Service error saving Slack workspace '%s': %v", teamID, err)
+		return nil, false, fmt.Errorf("service failed to save Slack workspace: %w", err)
+	}
+	workspace, err := s.repo.GetWorkspace(teamID)
+	if err != nil {
+		return nil, false, fmt.Errorf("service failed to read saved Slack workspace: %w", err)
+	}
+	log.Printf("Service saved Slack workspace '%s'", teamID)
+	return workspace, created, nil
+}
+
+func (s *slackWorkspaceSvc) DeleteWorkspace(teamID string) error {
+	if err := s.repo.DeleteWorkspace(teamID); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return notFoundError(CodeWorkspaceNotFound, "Slack workspace not found")
+		}
+		log.Printf("Service error deleting Slack workspace '%s': %v", teamID, err)
+		return fmt.Errorf("service failed to delete Slack workspace: %w", err)
+	}
+	log.Printf("Service deleted Slack workspace '%s'", teamID)
+	return nil
+}
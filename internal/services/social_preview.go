@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"template/internal/pkg/outbound"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	defaultSocialPreviewTTL = time.Hour
+	// socialPreviewRetry is how long a failed fetch is remembered, so a
+	// broken destination is not fetched on every visit.
+	socialPreviewRetry   = 5 * time.Minute
+	socialPreviewTimeout = 3 * time.Second
+	maxSocialPreviewBody = 512 << 10
+	maxSocialPreviews    = 1000
+	maxSocialPreviewTags = 30
+	maxSocialTagLength   = 1000
+)
+
+// SocialPreviewService fetches what destinations say about themselves for
+// link previews, for links with SocialPreview set.
+type SocialPreviewService interface {
+	// PageMeta returns the Open Graph and Twitter card tags of destination.
+	// It never fails: a destination that cannot be fetched has no tags.
+	PageMeta(ctx context.Context, destination string) shortner.PageMeta
+}
+
+type socialPreviewSvc struct {
+	determinism
+	client *outbound.Client
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	pages map[string]cachedPageMeta
+}
+
+type cachedPageMeta struct {
+	meta    shortner.PageMeta
+	expires time.Time
+}
+
+// NewSocialPreviewService creates the service. Fetched tags are cached for
+// ttl (an hour when zero).
+func NewSocialPreviewService(client *outbound.Client, ttl time.Duration) SocialPreviewService {
+	if ttl <= 0 {
+		ttl = defaultSocialPreviewTTL
+	}
+	return &socialPreviewSvc{client: client, ttl: ttl, pages: map[string]cachedPageMeta{}}
+}
+
+func (s *socialPreviewSvc) PageMeta(ctx context.Context, destination string) shortner.PageMeta {
+	now := s.now()
+	s.mu.Lock()
+	cached, ok := s.pages[destination]
+	s.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.meta
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, socialPreviewTimeout)
+	defer cancel()
+	meta, err := s.fetch(ctx, destination)
+	expires := now.Add(s.ttl)
+	if err != nil {
+		log.Printf("Service could not fetch preview tags of '%s': %v", destination, err)
+		expires = now.Add(min(socialPreviewRetry, s.ttl))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pages) >= maxSocialPreviews {
+		s.pages = map[string]cachedPageMeta{}
+	}
+	s.pages[destination] = cachedPageMeta{meta: meta, expires: expires}
+	return meta
+}
+
+func (s *socialPreviewSvc) fetch(ctx context.Context, destination string) (shortner.PageMeta, error) {
+	resp, err := s.client.Get(ctx, "social_preview", destination)
+	if err != nil {
+		return shortner.PageMeta{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return shortner.PageMeta{}, fmt.Errorf("answered %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.Contains(contentType, "html") {
+		return shortner.PageMeta{}, fmt.Errorf("not an HTML page (%s)", contentType)
+	}
+	return pageMeta(io.LimitReader(resp.Body, maxSocialPreviewBody)), nil
+}
+
+// pageMeta reads the title and the og: and twitter: meta tags of the head
+// of a page.
+func pageMeta(page io.Reader) shortner.PageMeta {
+	var meta shortner.PageMeta
+	tokens := html.NewTokenizer(page)
+	for {
+		switch tokens.Next() {
+		case html.ErrorToken:
+			return meta
+		case html.EndTagToken:
+			if name, _ := tokens.TagName(); atom.Lookup(name) == atom.Head {
+				return meta
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokens.Token()
+			switch token.DataAtom {
+			case atom.Body:
+				return meta
+			case atom.Title:
+				if meta.Title == "" && tokens.Next() == html.TextToken {
+					meta.Title = clip(strings.TrimSpace(string(tokens.Text())))
+				}
+			case atom.Meta:
+				var property, content string
+				for _, attr := range token.Attr {
+					switch attr.Key {
+					case "property", "name":
+						property = strings.ToLower(attr.Val)
+					case "content":
+						content = attr.Val
+					}
+				}
+				if (strings.HasPrefix(property, "og:") || strings.HasPrefix(property, "twitter:")) && len(meta.Tags) < maxSocialPreviewTags {
+					meta.Tags = append(meta.Tags, shortner.MetaTag{Property: property, Content: clip(content)})
+				}
+			}
+		}
+	}
+}
+
+// clip cuts s to maxSocialTagLength bytes.
+func clip(s string) string {
+	if len(s) > maxSocialTagLength {
+		return strings.ToValidUTF8(s[:maxSocialTagLength], "")
+	}
+	return s
+}
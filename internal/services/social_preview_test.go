@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"template/internal/pkg/metrics"
+	"template/internal/pkg/outbound"
+	"template/internal/usecases/shortner"
+)
+
+func TestPageMeta(t *testing.T) {
+	page := `<!DOCTYPE html><html><head>
+<title> Launch day </title>
+<meta charset="utf-8">
+<meta property="og:title" content="We launched">
+<meta property="OG:Image" content="https://example.com/cover.png">
+<meta name="twitter:card" content="summary_large_image">
+<meta name="description" content="not a card tag">
+</head><body><meta property="og:description" content="in the body"></body></html>`
+
+	got := pageMeta(strings.NewReader(page))
+	want := shortner.PageMeta{
+		Title: "Launch day",
+		Tags: []shortner.MetaTag{
+			{Property: "og:title", Content: "We launched"},
+			{Property: "og:image", Content: "https://example.com/cover.png"},
+			{Property: "twitter:card", Content: "summary_large_image"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pageMeta = %+v, want %+v", got, want)
+	}
+}
+
+func TestSocialPreviewCache(t *testing.T) {
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<head><meta property="og:title" content="Post"></head>`))
+	}))
+	defer server.Close()
+
+	client := outbound.New(outbound.Options{Timeout: time.Second, AllowPrivate: true}, metrics.NewRegistry(nil))
+	social := NewSocialPreviewService(client, time.Hour).(*socialPreviewSvc)
+	clock := &fixedClock{now: testNow}
+	social.SetClock(clock)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if meta := social.PageMeta(ctx, server.URL+"/post"); len(meta.Tags) != 1 || meta.Tags[0].Content != "Post" {
+			t.Fatalf("PageMeta = %+v, want og:title Post", meta)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("fetches = %d, want the second call served from the cache", fetches)
+	}
+	clock.now = clock.now.Add(time.Hour)
+	social.PageMeta(ctx, server.URL+"/post")
+	if fetches != 2 {
+		t.Errorf("fetches = %d, want a fetch once the tags expired", fetches)
+	}
+
+	if meta := social.PageMeta(ctx, server.URL+"/broken"); len(meta.Tags) != 0 || meta.Title != "" {
+		t.Errorf("broken destination: PageMeta = %+v, want nothing", meta)
+	}
+	social.PageMeta(ctx, server.URL+"/broken")
+	clock.now = clock.now.Add(socialPreviewRetry)
+	social.PageMeta(ctx, server.URL+"/broken")
+	if fetches != 4 {
+		t.Errorf("fetches = %d, want a failure retried only after %s", fetches, socialPreviewRetry)
+	}
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"template/internal/pkg/idn"
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+// statsTokenLength is the length of the tokens that unlock the stats of
+// token-protected links.
+const statsTokenLength = 32
+
+const (
+	maxCompareLinks   = 10
+	maxComparePeriods = 1000
+	maxExportLinks    = 100
+	exportPageSize    = 1000
+)
+
+// StatsAccess carries the credentials a request presents for a link's stats:
+// the bearer token of its Authorization header and the stats token it
+// passed. AllLinks is set for requests authenticated with an API key with
+// the stats:read scope, which sees the stats of every link as the owner
+// does.
+type StatsAccess struct {
+	BearerToken string
+	StatsToken  string
+	AllLinks    bool
+}
+
+// StatsService serves the stats of a link to the preview page (/{code}+),
+// the stats endpoint and the click export, enforcing the link's stats
+// visibility. The owner, identified by ownerToken, may see the stats of
+// every link.
+type StatsService interface {
+	Preview(shortCode string, access StatsAccess, now time.Time) (*shortner.LinkPreview, error)
+	ListClicks(shortCode string, access StatsAccess, afterID int64, limit int) ([]shortner.Click, error)
+	// VisibleClicks drops the clicks on links whose stats access may not
+	// see.
+	VisibleClicks(clicks []shortner.Click, access StatsAccess) ([]shortner.Click, error)
+	// Compare counts the clicks on each of codes in [from, to) per hour or
+	// day, over the same periods for every link. access must be allowed to
+	// see the stats of all of them.
+	Compare(codes []string, access StatsAccess, from, to time.Time, interval string) (*shortner.StatsComparison, error)
+	// ExportClicks calls each with the clicks on codes made in [from, to)
+	// in the order they were recorded, and stops at the first error each
+	// returns. It checks that access may see the stats of all the links
+	// before the first call.
+	ExportClicks(codes []string, access StatsAccess, from, to time.Time, each func(shortner.Click) error) error
+	// DailyClicks counts the clicks on codes made in [from, to) per UTC
+	// day, ordered by day and code. Days without clicks are left out.
+	DailyClicks(codes []string, access StatsAccess, from, to time.Time) ([]shortner.PeriodClicks, error)
+}
+
+type statsSvc struct {
+	links      ShortenerService
+	analytics  AnalyticsService
+	ownerToken string
+}
+
+func NewStatsService(links ShortenerService, analytics AnalyticsService, ownerToken string) StatsService {
+	return &statsSvc{links: links, analytics: analytics, ownerToken: ownerToken}
+}
+
+func validStatsVisibility(visibility string) bool {
+	switch visibility {
+	case shortner.StatsPrivate, shortner.StatsPublic, shortner.StatsToken:
+		return true
+	}
+	return false
+}
+
+// Preview describes the link with its click counts. Expired links give
+// LINK_EXPIRED.
+func (s *statsSvc) Preview(shortCode string, access StatsAccess, now time.Time) (*shortner.LinkPreview, error) {
+	mapping, err := s.authorize(shortCode, access)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Expired(now) {
+		return nil, ErrLinkExpired
+	}
+
+	preview := &shortner.LinkPreview{
+		ShortCode: mapping.ShortCode,
+		Kind:      mapping.Kind,
+		Title:     mapping.Title,
+		CreatedAt: mapping.CreatedAt,
+		ExpiresAt: mapping.ExpiresAt,
+	}
+	if mapping.Kind == shortner.KindRedirect {
+		preview.Destination = idn.DisplayURL(mapping.LongURL)
+	}
+
+	codes := []string{mapping.ShortCode}
+	if _, preview.Clicks, err = s.analytics.TopLinks(codes, time.Time{}, now, 1); err != nil {
+		return nil, fmt.Errorf("service failed to count clicks: %w", err)
+	}
+	if _, preview.ClicksWeek, err = s.analytics.TopLinks(codes, now.AddDate(0, 0, -7), now, 1); err != nil {
+		return nil, fmt.Errorf("service failed to count clicks: %w", err)
+	}
+	return preview, nil
+}
+
+func (s *statsSvc) ListClicks(shortCode string, access StatsAccess, afterID int64, limit int) ([]shortner.Click, error) {
+	mapping, err := s.authorize(shortCode, access)
+	if err != nil {
+		return nil, err
+	}
+	clicks, err := s.analytics.ListLinkClicks(mapping.ShortCode, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("service failed to list clicks: %w", err)
+	}
+	return clicks, nil
+}
+
+func (s *statsSvc) VisibleClicks(clicks []shortner.Click, access StatsAccess) ([]shortner.Click, error) {
+	if s.isOwner(access) {
+		return clicks, nil
+	}
+	visible := make(map[string]bool)
+	filtered := clicks[:0:0]
+	for _, click := range clicks {
+		allowed, seen := visible[click.ShortCode]
+		if !seen {
+			mapping, err := s.links.GetLink(click.ShortCode)
+			if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+				return nil, err
+			}
+			// Clicks on deleted links are only shown to the owner.
+			allowed = err == nil && mapping.StatsVisibility == shortner.StatsPublic
+			visible[click.ShortCode] = allowed
+		}
+		if allowed {
+			filtered = append(filtered, click)
+		}
+	}
+	return filtered, nil
+}
+
+// Compare answers for the links in the order given, each once.
+func (s *statsSvc) Compare(codes []string, access StatsAccess, from, to time.Time, interval string) (*shortner.StatsComparison, error) {
+	var period time.Duration
+	switch interval {
+	case shortner.IntervalDay, "":
+		interval, period = shortner.IntervalDay, 24*time.Hour
+	case shortner.IntervalHour:
+		period = time.Hour
+	default:
+		return nil, validationError("interval", fmt.Sprintf("invalid interval '%s' (expected %s or %s)", interval, shortner.IntervalHour, shortner.IntervalDay))
+	}
+	if len(codes) == 0 {
+		return nil, validationError("codes", "at least one code is required")
+	}
+	if len(codes) > maxCompareLinks {
+		return nil, validationError("codes", fmt.Sprintf("at most %d links can be compared", maxCompareLinks))
+	}
+	from, to = from.UTC().Truncate(period), to.UTC()
+	if !to.After(from) {
+		return nil, validationError("to", "to must be after from")
+	}
+	periods := int((to.Sub(from) + period - 1) / period)
+	if periods > maxComparePeriods {
+		return nil, validationError("from", fmt.Sprintf("at most %d periods can be compared; use a shorter range or a longer interval", maxComparePeriods))
+	}
+
+	comparison := &shortner.StatsComparison{From: from, To: to, Interval: interval, Periods: make([]time.Time, periods)}
+	for i := range comparison.Periods {
+		comparison.Periods[i] = from.Add(time.Duration(i) * period)
+	}
+	var stored []string
+	for _, code := range codes {
+		mapping, err := s.authorize(code, access)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(stored, mapping.ShortCode) {
+			stored = append(stored, mapping.ShortCode)
+			comparison.Series = append(comparison.Series, shortner.ClickSeries{ShortCode: mapping.ShortCode, Clicks: make([]int64, periods)})
+		}
+	}
+	series := make(map[string]*shortner.ClickSeries, len(stored))
+	for i := range comparison.Series {
+		series[comparison.Series[i].ShortCode] = &comparison.Series[i]
+	}
+
+	counts, err := s.analytics.CountPerPeriod(stored, from, to, interval)
+	if err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		line, i := series[count.ShortCode], int(count.Start.Sub(from)/period)
+		if line == nil || i < 0 || i >= periods {
+			continue
+		}
+		line.Clicks[i] += count.Clicks
+		line.Total += count.Clicks
+	}
+	return comparison, nil
+}
+
+func (s *statsSvc) ExportClicks(codes []string, access StatsAccess, from, to time.Time, each func(shortner.Click) error) error {
+	stored, err := s.exportLinks(codes, access, from, to)
+	if err != nil {
+		return err
+	}
+	var afterID int64
+	for {
+		clicks, err := s.analytics.ListClicksBetween(stored, from, to, afterID, exportPageSize)
+		if err != nil {
+			return err
+		}
+		for _, click := range clicks {
+			if err := each(click); err != nil {
+				return err
+			}
+		}
+		if len(clicks) < exportPageSize {
+			return nil
+		}
+		afterID = clicks[len(clicks)-1].ID
+	}
+}
+
+func (s *statsSvc) DailyClicks(codes []string, access StatsAccess, from, to time.Time) ([]shortner.PeriodClicks, error) {
+	stored, err := s.exportLinks(codes, access, from, to)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := s.analytics.CountPerPeriod(stored, from, to, shortner.IntervalDay)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(counts, func(a, b shortner.PeriodClicks) int {
+		if c := a.Start.Compare(b.Start); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ShortCode, b.ShortCode)
+	})
+	return counts, nil
+}
+
+// exportLinks checks an export of codes over [from, to) and returns the
+// stored codes of the links, each once.
+func (s *statsSvc) exportLinks(codes []string, access StatsAccess, from, to time.Time) ([]string, error) {
+	if len(codes) == 0 {
+		return nil, validationError("codes", "at least one code is required")
+	}
+	if len(codes) > maxExportLinks {
+		return nil, validationError("codes", fmt.Sprintf("at most %d links can be exported at once", maxExportLinks))
+	}
+	if !to.After(from) {
+		return nil, validationError("to", "to must be after from")
+	}
+	var stored []string
+	for _, code := range codes {
+		mapping, err := s.authorize(code, access)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(stored, mapping.ShortCode) {
+			stored = append(stored, mapping.ShortCode)
+		}
+	}
+	return stored, nil
+}
+
+// authorize loads the link and checks that access may see its stats.
+func (s *statsSvc) authorize(shortCode string, access StatsAccess) (*shortner.URLMapping, error) {
+	mapping, err := s.links.GetLink(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if s.isOwner(access) {
+		return mapping, nil
+	}
+	switch mapping.StatsVisibility {
+	case shortner.StatsPublic:
+		return mapping, nil
+	case shortner.StatsToken:
+		if access.StatsToken != "" && mapping.StatsToken != "" && subtle.ConstantTimeCompare([]byte(access.StatsToken), []byte(mapping.StatsToken)) == 1 {
+			return mapping, nil
+		}
+		return nil, &Error{Code: CodeStatsPrivate, Message: "a valid stats token is required to see the stats of this link"}
+	}
+	return nil, &Error{Code: CodeStatsPrivate, Message: "stats for this link are private"}
+}
+
+func (s *statsSvc) isOwner(access StatsAccess) bool {
+	if access.AllLinks {
+		return true
+	}
+	return s.ownerToken != "" && access.BearerToken != "" && subtle.ConstantTimeCompare([]byte(access.BearerToken), []byte(s.ownerToken)) == 1
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+func TestCompareStats(t *testing.T) {
+	db := openTestDB(t)
+	links := sqliteShortener(t, db)
+	clicks := repositories.NewSQLiteClickRepo(db)
+	if err := clicks.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []shortner.URLMapping{
+		{ShortCode: "a", LongURL: "https://example.com/a", StatsVisibility: shortner.StatsPublic},
+		{ShortCode: "b", LongURL: "https://example.com/b", StatsVisibility: shortner.StatsPublic},
+		{ShortCode: "secret", LongURL: "https://example.com/s", StatsVisibility: shortner.StatsPrivate},
+	} {
+		if _, err := links.repo.CreateMapping(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	day := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, click := range []shortner.Click{
+		{ShortCode: "a", ClickedAt: day.Add(time.Hour)},
+		{ShortCode: "a", ClickedAt: day.Add(23 * time.Hour)},
+		{ShortCode: "a", ClickedAt: day.Add(49 * time.Hour)},
+		{ShortCode: "b", ClickedAt: day.Add(25 * time.Hour)},
+		// Outside the range.
+		{ShortCode: "b", ClickedAt: day.Add(-time.Hour)},
+	} {
+		if _, err := clicks.RecordClick(click); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewStatsService(links, NewAnalyticsService(clicks, nil, nil, nil, AnalyticsOptions{}), "owner")
+	public := StatsAccess{}
+
+	comparison, err := s.Compare([]string{"b", "a", "b"}, public, day.Add(5*time.Hour), day.AddDate(0, 0, 3), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !comparison.From.Equal(day) || len(comparison.Periods) != 3 || !comparison.Periods[2].Equal(day.AddDate(0, 0, 2)) {
+		t.Errorf("from %s, periods %v, want three days from %s", comparison.From, comparison.Periods, day)
+	}
+	if got := fmt.Sprint(comparison.Series); got != "[{b [0 1 0] 1} {a [2 0 1] 3}]" {
+		t.Errorf("series = %s", got)
+	}
+
+	hourly, err := s.Compare([]string{"a"}, public, day, day.Add(2*time.Hour), shortner.IntervalHour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(hourly.Series[0].Clicks); got != "[0 1]" {
+		t.Errorf("hourly clicks = %s, want [0 1]", got)
+	}
+
+	if _, err := s.Compare([]string{"a", "secret"}, public, day, day.Add(time.Hour), ""); !errors.Is(err, &Error{Code: CodeStatsPrivate}) {
+		t.Errorf("with a private link: error = %v, want STATS_PRIVATE", err)
+	}
+	if _, err := s.Compare([]string{"a", "secret"}, StatsAccess{BearerToken: "owner"}, day, day.Add(time.Hour), ""); err != nil {
+		t.Errorf("the owner was refused: %v", err)
+	}
+	invalid := []struct {
+		codes    []string
+		from, to time.Time
+		interval string
+	}{
+		{nil, day, day.Add(time.Hour), ""},
+		{[]string{"a"}, day, day.Add(time.Hour), "week"},
+		{[]string{"a"}, day, day, ""},
+		{[]string{"a"}, day.AddDate(-1, 0, 0), day, shortner.IntervalHour},
+	}
+	for _, tt := range invalid {
+		if _, err := s.Compare(tt.codes, public, tt.from, tt.to, tt.interval); !errors.Is(err, ErrValidationFailed) {
+			t.Errorf("Compare(%v, %s, %s, %q) error = %v, want a validation error", tt.codes, tt.from, tt.to, tt.interval, err)
+		}
+	}
+}
+
+func TestExportStats(t *testing.T) {
+	db := openTestDB(t)
+	links := sqliteShortener(t, db)
+	clicks := repositories.NewSQLiteClickRepo(db)
+	if err := clicks.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []shortner.URLMapping{
+		{ShortCode: "a", LongURL: "https://example.com/a", StatsVisibility: shortner.StatsPublic},
+		{ShortCode: "b", LongURL: "https://example.com/b", StatsVisibility: shortner.StatsPublic},
+		{ShortCode: "secret", LongURL: "https://example.com/s", StatsVisibility: shortner.StatsPrivate},
+	} {
+		if _, err := links.repo.CreateMapping(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	day := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, click := range []shortner.Click{
+		{ShortCode: "b", ClickedAt: day.Add(time.Hour)},
+		{ShortCode: "a", ClickedAt: day.Add(2 * time.Hour)},
+		{ShortCode: "a", ClickedAt: day.Add(26 * time.Hour)},
+		{ShortCode: "secret", ClickedAt: day.Add(3 * time.Hour)},
+		// Outside the range.
+		{ShortCode: "a", ClickedAt: day.AddDate(0, 0, 2)},
+	} {
+		if _, err := clicks.RecordClick(click); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewStatsService(links, NewAnalyticsService(clicks, nil, nil, nil, AnalyticsOptions{}), "owner")
+	public := StatsAccess{}
+	from, to := day, day.AddDate(0, 0, 2)
+
+	var exported []string
+	err := s.ExportClicks([]string{"a", "b", "a"}, public, from, to, func(click shortner.Click) error {
+		exported = append(exported, click.ShortCode)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(exported); got != "[b a a]" {
+		t.Errorf("exported clicks on %s, want [b a a]", got)
+	}
+	stop := errors.New("stop")
+	calls := 0
+	if err := s.ExportClicks([]string{"a"}, public, from, to, func(shortner.Click) error { calls++; return stop }); err != stop || calls != 1 {
+		t.Errorf("ExportClicks = %v after %d calls, want the callback's error after one", err, calls)
+	}
+
+	daily, err := s.DailyClicks([]string{"b", "a"}, public, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []string
+	for _, count := range daily {
+		rows = append(rows, fmt.Sprintf("%s %s %d", count.Start.Format(time.DateOnly), count.ShortCode, count.Clicks))
+	}
+	if got := fmt.Sprint(rows); got != "[2030-01-01 a 1 2030-01-01 b 1 2030-01-02 a 1]" {
+		t.Errorf("daily clicks = %s", got)
+	}
+
+	called := false
+	if err := s.ExportClicks([]string{"a", "secret"}, public, from, to, func(shortner.Click) error { called = true; return nil }); !errors.Is(err, &Error{Code: CodeStatsPrivate}) || called {
+		t.Errorf("with a private link: error = %v, called = %t, want STATS_PRIVATE before any click", err, called)
+	}
+	if _, err := s.DailyClicks([]string{"secret"}, StatsAccess{BearerToken: "owner"}, from, to); err != nil {
+		t.Errorf("the owner was refused: %v", err)
+	}
+	if _, err := s.DailyClicks(nil, public, from, to); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("without codes: error = %v, want a validation error", err)
+	}
+	if _, err := s.DailyClicks([]string{"a"}, public, to, from); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("with to before from: error = %v, want a validation error", err)
+	}
+}
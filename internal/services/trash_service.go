@@ -0,0 +1,171 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+const (
+	trashBatchSize   = 100
+	maxTrashPageSize = 100
+)
+
+// TrashService manages the links DeleteMapping moved to the trash: listing,
+// restoring and purging them. PurgeExpired deletes for good the links
+// deleted longer than the retention period ago; the trash_purge job calls
+// it.
+type TrashService interface {
+	ListTrash(beforeID int64, limit int) ([]shortner.TrashedLink, error)
+	Restore(shortCode string) (*shortner.URLMapping, error)
+	Purge(shortCode string) error
+	PurgeExpired(now time.Time) (int, error)
+}
+
+type trashSvc struct {
+	links     repositories.ShortenerRepository
+	trash     repositories.TrashRepository
+	cleaner   LinkCleaner
+	retention time.Duration
+}
+
+// NewTrashService creates the trash service. cleaner removes the pastes,
+// files and bundle items of purged links.
+func NewTrashService(links repositories.ShortenerRepository, trash repositories.TrashRepository, cleaner LinkCleaner, retention time.Duration) TrashService {
+	return &trashSvc{links: links, trash: trash, cleaner: cleaner, retention: retention}
+}
+
+// ListTrash returns up to limit trashed links deleted before the entry
+// beforeID, newest first.
+func (s *trashSvc) ListTrash(beforeID int64, limit int) ([]shortner.TrashedLink, error) {
+	if limit <= 0 || limit > maxTrashPageSize {
+		limit = maxTrashPageSize
+	}
+	entries, err := s.trash.ListTrash(beforeID, limit)
+	if err != nil {
+		log.Printf("Service error listing the trash before id %d: %v", beforeID, err)
+		return nil, fmt.Errorf("service failed to list the trash: %w", err)
+	}
+	for i := range entries {
+		entries[i].PurgeAt = entries[i].DeletedAt.Add(s.retention)
+	}
+	return entries, nil
+}
+
+// Restore puts a trashed link back under its code. It fails with
+// CODE_TAKEN when a newer link has taken the code in the meantime.
+func (s *trashSvc) Restore(shortCode string) (*shortner.URLMapping, error) {
+	entry, err := s.get(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	mapping := entry.Link
+	if _, err := s.links.GetMapping(mapping.ShortCode); err == nil {
+		return nil, ErrCodeTaken
+	} else if !errors.Is(err, repositories.ErrNotFound) {
+		log.Printf("Service error checking code '%s' before a restore: %v", mapping.ShortCode, err)
+		return nil, fmt.Errorf("service failed to check short code: %w", err)
+	}
+
+	mapping.ID = 0
+	id, err := s.links.CreateMapping(mapping)
+	if err != nil {
+		log.Printf("Service error restoring code '%s': %v", mapping.ShortCode, err)
+		return nil, fmt.Errorf("service failed to restore link: %w", err)
+	}
+	mapping.ID = id
+	if err := s.trash.RemoveTrash(mapping.ShortCode); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		// The link is back; a stale trash entry can only be purged, which
+		// would not touch the restored link's row.
+		log.Printf("Service error removing restored code '%s' from the trash: %v", mapping.ShortCode, err)
+	}
+	log.Printf("Service restored code '%s' from the trash", mapping.ShortCode)
+	return &mapping, nil
+}
+
+// Purge deletes a trashed link for good, with its paste, file or bundle
+// items.
+func (s *trashSvc) Purge(shortCode string) error {
+	entry, err := s.get(shortCode)
+	if err != nil {
+		return err
+	}
+	if err := s.purge(*entry); err != nil {
+		log.Printf("Service error purging code '%s': %v", shortCode, err)
+		return fmt.Errorf("service failed to purge link: %w", err)
+	}
+	log.Printf("Service purged code '%s' from the trash", shortCode)
+	return nil
+}
+
+// PurgeExpired purges the links deleted before now minus the retention
+// period and returns how many were purged. A link whose cleanup fails stays
+// in the trash and is retried on the next run.
+func (s *trashSvc) PurgeExpired(now time.Time) (int, error) {
+	cutoff := now.Add(-s.retention)
+	purged, failed := 0, 0
+	for {
+		entries, err := s.trash.ListTrashedBefore(cutoff, trashBatchSize)
+		if err != nil {
+			log.Printf("Service error listing the trash: %v", err)
+			return purged, fmt.Errorf("service failed to list the trash: %w", err)
+		}
+		progress := false
+		for _, entry := range entries {
+			if err := s.purge(entry); err != nil {
+				log.Printf("Service error purging code '%s': %v", entry.Link.ShortCode, err)
+				failed++
+				continue
+			}
+			purged++
+			progress = true
+		}
+		if len(entries) < trashBatchSize || !progress {
+			break
+		}
+	}
+	if purged > 0 {
+		log.Printf("Service purged %d links from the trash", purged)
+	}
+	if failed > 0 {
+		return purged, fmt.Errorf("%d trashed links could not be purged", failed)
+	}
+	return purged, nil
+}
+
+func (s *trashSvc) get(shortCode string) (*shortner.TrashedLink, error) {
+	entry, err := s.trash.GetTrash(shortCode)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, notFoundError(CodeTrashItemNotFound, "short code is not in the trash")
+		}
+		log.Printf("Service error loading trashed code '%s': %v", shortCode, err)
+		return nil, fmt.Errorf("service failed to load trashed link: %w", err)
+	}
+	entry.PurgeAt = entry.DeletedAt.Add(s.retention)
+	return entry, nil
+}
+
+// purge cleans up the link's data unless a restored or newer link now uses
+// the code, since pastes, files and bundle items are keyed by code.
+func (s *trashSvc) purge(entry shortner.TrashedLink) error {
+	_, err := s.links.GetMapping(entry.Link.ShortCode)
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		if s.cleaner != nil {
+			if err := s.cleaner.CleanupLink(entry.Link); err != nil {
+				return err
+			}
+		}
+	case err != nil:
+		return err
+	}
+	if err := s.trash.RemoveTrash(entry.Link.ShortCode); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+	return nil
+}
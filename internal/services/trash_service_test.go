@@ -0,0 +1,141 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"template/internal/repositories"
+	"template/internal/usecases/shortner"
+)
+
+// recordingCleaner remembers the links it was asked to clean up.
+type recordingCleaner struct{ cleaned []string }
+
+func (c *recordingCleaner) CleanupLink(mapping shortner.URLMapping) error {
+	c.cleaned = append(c.cleaned, mapping.ShortCode)
+	return nil
+}
+
+// trashFixture is a link service whose deletions go to a trash kept for a
+// day, and the trash service over it.
+func trashFixture(t *testing.T) (*shortenerSvc, TrashService, *recordingCleaner) {
+	t.Helper()
+	db := openTestDB(t)
+	links := repositories.NewSQLiteShortenerRepo(db, false)
+	trash := repositories.NewSQLiteTrashRepo(db)
+	for _, repo := range []interface{ InitSchema() error }{links, trash} {
+		if err := repo.InitSchema(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewShortenerService(links, nil, trash, nil, nil).(*shortenerSvc)
+	s.SetPolicy(LinkPolicy{PrivateDestinations: privateDestinationsAllow})
+	s.SetClock(&fixedClock{now: testNow})
+	cleaner := &recordingCleaner{}
+	return s, NewTrashService(links, trash, cleaner, 24*time.Hour), cleaner
+}
+
+func TestDeletedLinkCanBeRestored(t *testing.T) {
+	s, trash, cleaner := trashFixture(t)
+	code, err := s.CreateShortURL("https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirectType := 301
+	if err := s.UpdateLink(code, shortner.LinkUpdate{RedirectType: &redirectType}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteMapping(code); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetLink(code); !errors.Is(err, ErrLinkNotFound) {
+		t.Fatalf("GetLink after delete error = %v, want not found", err)
+	}
+
+	items, err := trash.ListTrash(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Link.ShortCode != code || !items[0].PurgeAt.Equal(testNow.Add(24*time.Hour)) {
+		t.Fatalf("trash = %+v, want %s purged a day after deletion", items, code)
+	}
+
+	if _, err := trash.Restore(code); err != nil {
+		t.Fatal(err)
+	}
+	link, err := s.GetLink(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.LongURL != "https://example.com/a" || link.RedirectType != 301 {
+		t.Errorf("restored link = %+v, want its destination and redirect type back", link)
+	}
+	if _, err := trash.Restore(code); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("second Restore error = %v, want not in the trash", err)
+	}
+	if len(cleaner.cleaned) != 0 {
+		t.Errorf("restoring cleaned up %v", cleaner.cleaned)
+	}
+}
+
+func TestRestoreRefusesTakenCode(t *testing.T) {
+	s, trash, _ := trashFixture(t)
+	s.SetGenerator(&sequenceGenerator{values: []string{"reused0", "reused0"}})
+	code, err := s.CreateShortURL("https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteMapping(code); err != nil {
+		t.Fatal(err)
+	}
+	// The code of a trashed link is free again for new links.
+	if newer, err := s.CreateShortURL("https://example.com/new"); err != nil || newer != code {
+		t.Fatalf("new link = %q, %v, want the generator's %s", newer, err, code)
+	}
+	if _, err := trash.Restore(code); !errors.Is(err, ErrCodeTaken) {
+		t.Errorf("Restore over a newer link error = %v, want %s", err, CodeCodeTaken)
+	}
+
+	// Purging the old link must leave the newer one's data alone.
+	if err := trash.Purge(code); err != nil {
+		t.Fatal(err)
+	}
+	if link, err := s.GetLink(code); err != nil || link.LongURL != "https://example.com/new" {
+		t.Errorf("newer link after purge = %+v, %v", link, err)
+	}
+}
+
+func TestPurgeExpiredTrash(t *testing.T) {
+	s, trash, cleaner := trashFixture(t)
+	var codes []string
+	for _, url := range []string{"https://example.com/old", "https://example.com/new"} {
+		code, err := s.CreateShortURL(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		codes = append(codes, code)
+	}
+	if err := s.DeleteMapping(codes[0]); err != nil {
+		t.Fatal(err)
+	}
+	s.SetClock(&fixedClock{now: testNow.Add(12 * time.Hour)})
+	if _, err := s.BulkDelete(shortner.BulkSelection{Codes: codes[1:]}); err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := trash.PurgeExpired(testNow.Add(30 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 || len(cleaner.cleaned) != 1 || cleaner.cleaned[0] != codes[0] {
+		t.Fatalf("purged %d, cleaned %v, want only %s", purged, cleaner.cleaned, codes[0])
+	}
+	items, err := trash.ListTrash(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Link.ShortCode != codes[1] {
+		t.Errorf("trash after purge = %+v, want only the bulk-deleted %s", items, codes[1])
+	}
+}
@@ -0,0 +1,751 @@
+package shortner
+
+import "time"
+
+// Link kinds. A redirect link sends the visitor to LongURL; other kinds are
+// served by a dedicated renderer.
+const (
+	KindRedirect = "redirect"
+	KindBundle   = "bundle"
+	KindPaste    = "paste"
+	KindFile     = "file"
+)
+
+type URLMapping struct {
+	ID        int64             `json:"id"`
+	ShortCode string            `json:"short_code"`
+	Kind      string            `json:"kind"`
+	Title     string            `json:"title,omitempty"`
+	LongURL   string            `json:"long_url"`
+	CreatedAt time.Time         `json:"created_at"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	// RedirectType is the HTTP status used for the redirect (301, 302, 307
+	// or 308).
+	RedirectType int `json:"redirect_type"`
+	// CacheControl overrides the Cache-Control policy for this link's
+	// redirect; empty means the operator default for RedirectType.
+	CacheControl string `json:"cache_control,omitempty"`
+	// Language forces the language of pages served for this link instead of
+	// negotiating it from Accept-Language.
+	Language string `json:"language,omitempty"`
+	// ExpiresAt is when the link stops resolving; nil means never.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// LanguageTargets overrides LongURL for visitors whose Accept-Language
+	// matches a key, e.g. {"fr": "https://docs.example.com/fr"}. Keys are
+	// lower-case language tags; a primary tag such as "fr" also matches
+	// "fr-CA".
+	LanguageTargets map[string]string `json:"language_targets,omitempty"`
+	// PixelIDs are the retargeting pixels fired on an interstitial page
+	// before the redirect; empty means a plain redirect.
+	PixelIDs []int64 `json:"pixel_ids,omitempty"`
+	// StatsVisibility decides who may see the link's preview page
+	// (/{code}+), stats and clicks: StatsPrivate, StatsPublic or StatsToken.
+	StatsVisibility string `json:"stats_visibility"`
+	// StatsToken unlocks the stats of a StatsToken link.
+	StatsToken string `json:"-"`
+	// SingleUse links can be opened once; ConsumedAt is when that
+	// happened, nil while the link is still unused.
+	SingleUse  bool       `json:"single_use,omitempty"`
+	ConsumedAt *time.Time `json:"consumed_at,omitempty"`
+	// AllowedCountries limits the link to visitors from these countries,
+	// BlockedCountries keeps out visitors from these; at most one of them
+	// is set. Both hold upper-case ISO 3166-1 alpha-2 codes.
+	AllowedCountries []string `json:"allowed_countries,omitempty"`
+	BlockedCountries []string `json:"blocked_countries,omitempty"`
+	// TimeRules override LongURL and LanguageTargets while they are
+	// active; the first active rule wins.
+	TimeRules []TimeRule `json:"time_rules,omitempty"`
+	// SocialPreview serves a page with the destination's Open Graph tags
+	// that then redirects, instead of a plain redirect, so that social
+	// platforms show a rich preview of the short link.
+	SocialPreview bool `json:"social_preview,omitempty"`
+	// QueryPassthrough decides what happens to the query parameters of
+	// the short URL at redirect time: QueryOff, QueryMerge or
+	// QueryOverride. Empty uses the operator default.
+	QueryPassthrough string `json:"query_passthrough,omitempty"`
+	// Wildcard links also answer /{code}/{path...}, redirecting to their
+	// destination with the path appended.
+	Wildcard bool `json:"wildcard,omitempty"`
+	// SpikeFactor and SpikeMinClicks override the operator's click spike
+	// thresholds for this link: an alert is raised when at least
+	// SpikeMinClicks clicks arrive within the detection window and they are
+	// SpikeFactor times what the link's baseline rate predicts. Zero keeps
+	// the default; a negative SpikeFactor turns spike alerts off.
+	SpikeFactor    float64 `json:"spike_factor,omitempty"`
+	SpikeMinClicks int64   `json:"spike_min_clicks,omitempty"`
+	// Stale marks a link served from the cache past its TTL because the
+	// database could not be reached; it may have changed since.
+	Stale bool `json:"-"`
+}
+
+// PageMeta is what a page says about itself for link previews: its title
+// and its Open Graph and Twitter card meta tags.
+type PageMeta struct {
+	Title string
+	Tags  []MetaTag
+}
+
+// MetaTag is a <meta property="..." content="..."> tag.
+type MetaTag struct {
+	Property string
+	Content  string
+}
+
+// TimeRule sends visitors to URL on the given days between From and To,
+// e.g. to a "we're closed" page outside business hours.
+type TimeRule struct {
+	// Days are "mon" to "sun"; empty means every day.
+	Days []string `json:"days,omitempty"`
+	// From and To are "15:04" times, From included and To not. A To
+	// before From spans midnight, into the day after each listed day;
+	// both empty means the whole day.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// TimeZone is the IANA zone the days and times are in, such as
+	// "Europe/Berlin"; empty means the server's.
+	TimeZone string `json:"time_zone,omitempty"`
+	URL      string `json:"url"`
+}
+
+// Weekdays maps the TimeRule day names to time.Weekday.
+var Weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Active reports whether the rule applies at local, a time already in the
+// rule's zone. Rules with unparsable times never apply.
+func (r *TimeRule) Active(local time.Time) bool {
+	if r.From == "" && r.To == "" {
+		return r.on(local.Weekday())
+	}
+	from, err1 := time.Parse("15:04", r.From)
+	to, err2 := time.Parse("15:04", r.To)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	now := local.Hour()*60 + local.Minute()
+	start, end := from.Hour()*60+from.Minute(), to.Hour()*60+to.Minute()
+	switch {
+	case start < end:
+		return r.on(local.Weekday()) && now >= start && now < end
+	case start > end:
+		return (r.on(local.Weekday()) && now >= start) || (r.on((local.Weekday()+6)%7) && now < end)
+	default:
+		return r.on(local.Weekday())
+	}
+}
+
+func (r *TimeRule) on(day time.Weekday) bool {
+	if len(r.Days) == 0 {
+		return true
+	}
+	for _, name := range r.Days {
+		if d, ok := Weekdays[name]; ok && d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// Link stats visibilities. Private stats are shown only to the owner, public
+// ones to everyone and token-protected ones to whoever has the link's stats
+// token.
+const (
+	StatsPrivate = "private"
+	StatsPublic  = "public"
+	StatsToken   = "token"
+)
+
+// Query passthrough modes. With QueryOff the query of the short URL is
+// dropped; QueryMerge appends its parameters to the destination, keeping
+// the destination's value of a parameter both have; QueryOverride appends
+// them too, but replaces the destination's values.
+const (
+	QueryOff      = "off"
+	QueryMerge    = "merge"
+	QueryOverride = "override"
+)
+
+// CountryAllowed reports whether a visitor from country may open the link.
+// An unknown country, "", is kept out of links limited to some countries.
+func (m *URLMapping) CountryAllowed(country string) bool {
+	if len(m.AllowedCountries) > 0 {
+		for _, c := range m.AllowedCountries {
+			if c == country {
+				return true
+			}
+		}
+		return false
+	}
+	for _, c := range m.BlockedCountries {
+		if c == country {
+			return false
+		}
+	}
+	return true
+}
+
+// Destinations lists every address the link may redirect to: LongURL,
+// the language targets and the time rule URLs.
+func (m *URLMapping) Destinations() []string {
+	destinations := []string{m.LongURL}
+	for _, target := range m.LanguageTargets {
+		destinations = append(destinations, target)
+	}
+	for _, rule := range m.TimeRules {
+		destinations = append(destinations, rule.URL)
+	}
+	return destinations
+}
+
+// Expired reports whether the link has passed its expiry time.
+func (m *URLMapping) Expired(now time.Time) bool {
+	return m.ExpiresAt != nil && !now.Before(*m.ExpiresAt)
+}
+
+// LinkUpdate is a partial update of a mapping: nil fields are left as they
+// are. An empty, non-nil Headers map clears the per-link headers.
+type LinkUpdate struct {
+	LongURL      *string
+	Title        *string
+	Headers      map[string]string
+	RedirectType *int
+	CacheControl *string
+	Language     *string
+	// ExpiresAt sets the expiry; a zero time clears it.
+	ExpiresAt *time.Time
+	// LanguageTargets replaces the per-language destinations; an empty,
+	// non-nil map clears them.
+	LanguageTargets map[string]string
+	// PixelIDs replaces the retargeting pixels; an empty, non-nil slice
+	// clears them.
+	PixelIDs []int64
+	// StatsVisibility changes who may see the link's stats. Setting
+	// StatsToken issues a new stats token, even if the link already had one.
+	StatsVisibility *string
+	// SingleUse turns the single-use flag on or off; either way the link
+	// becomes unused again.
+	SingleUse *bool
+	// AllowedCountries and BlockedCountries replace the country rules; an
+	// empty, non-nil slice clears them.
+	AllowedCountries []string
+	BlockedCountries []string
+	// TimeRules replaces the time rules; an empty, non-nil slice clears
+	// them.
+	TimeRules []TimeRule
+	// SocialPreview turns the preview page on or off; only redirects can
+	// have one.
+	SocialPreview *bool
+	// QueryPassthrough changes the query passthrough mode; "" restores
+	// the operator default.
+	QueryPassthrough *string
+	// SpikeFactor and SpikeMinClicks change the link's click spike
+	// thresholds; 0 restores the operator default.
+	SpikeFactor    *float64
+	SpikeMinClicks *int64
+	// Source is recorded in the revision history when LongURL changes;
+	// empty means RevisionSourceAPI.
+	Source string
+}
+
+const (
+	RevisionSourceAPI      = "api"
+	RevisionSourceSchedule = "schedule"
+	RevisionSourceBulk     = "bulk"
+	RevisionSourceMerge    = "merge"
+)
+
+// BulkSelection picks the links of a bulk update or delete: the listed
+// codes, or every link whose destination starts with DestinationPrefix.
+type BulkSelection struct {
+	Codes             []string `json:"codes"`
+	DestinationPrefix string   `json:"destination_prefix"`
+	// SkipMissing reports listed codes that do not exist instead of
+	// refusing the whole operation.
+	SkipMissing bool `json:"skip_missing"`
+}
+
+// Statuses of a link in a BulkResult.
+const (
+	BulkItemUpdated  = "updated"
+	BulkItemDeleted  = "deleted"
+	BulkItemNotFound = "not_found"
+	BulkItemInvalid  = "invalid"
+	// BulkItemSkipped marks links left unchanged because another link
+	// of the operation failed.
+	BulkItemSkipped = "skipped"
+	// BulkItemFailed marks a link whose change could not be stored when
+	// the changes were applied one by one.
+	BulkItemFailed = "failed"
+)
+
+// BulkItemResult is the outcome of a bulk operation for one link.
+type BulkItemResult struct {
+	ShortCode string `json:"short_code"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BulkResult reports a bulk operation link by link. Applied is false when
+// nothing was changed because some link could not be. Transactional tells
+// whether the changes were stored in one transaction; when the storage
+// cannot do that (links sharded over several files), they are stored one
+// by one and a failure leaves the others applied.
+type BulkResult struct {
+	Applied       bool             `json:"applied"`
+	Transactional bool             `json:"transactional"`
+	Matched       int              `json:"matched"`
+	Changed       int              `json:"changed"`
+	Results       []BulkItemResult `json:"results"`
+}
+
+// LinkRevision records one change of a link's destination.
+type LinkRevision struct {
+	ID          int64     `json:"id"`
+	ShortCode   string    `json:"short_code"`
+	PreviousURL string    `json:"previous_url"`
+	LongURL     string    `json:"long_url"`
+	Source      string    `json:"source"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TrashedLink is a deleted link kept in the trash, from which it can be
+// restored until PurgeAt.
+type TrashedLink struct {
+	ID        int64      `json:"id"`
+	Link      URLMapping `json:"link"`
+	DeletedAt time.Time  `json:"deleted_at"`
+	PurgeAt   time.Time  `json:"purge_at"`
+}
+
+const (
+	ScheduleStatusPending  = "pending"
+	ScheduleStatusApplied  = "applied"
+	ScheduleStatusFailed   = "failed"
+	ScheduleStatusCanceled = "canceled"
+)
+
+// ScheduledChange switches a link to NewURL once EffectiveAt has passed.
+// FinishedAt is set when it is applied, fails or is canceled.
+type ScheduledChange struct {
+	ID          int64      `json:"id"`
+	ShortCode   string     `json:"short_code"`
+	NewURL      string     `json:"new_url"`
+	EffectiveAt time.Time  `json:"effective_at"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+type Click struct {
+	ID        int64     `json:"id"`
+	ShortCode string    `json:"short_code"`
+	ClickedAt time.Time `json:"clicked_at"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Referer   string    `json:"referer"`
+	// ItemID is the bundle item that was followed, or 0 for the link itself.
+	ItemID int64 `json:"item_id,omitempty"`
+	// EventID identifies a click logged ahead of being stored, so that
+	// storing it again after a crash or an outage is a no-op.
+	EventID string `json:"event_id,omitempty"`
+	// Prefetch marks a fetch by a prefetching browser or a link preview
+	// bot rather than a person; it is not stored.
+	Prefetch bool `json:"-"`
+}
+
+// LinkClicks is the number of clicks on one link over some period.
+type LinkClicks struct {
+	ShortCode string `json:"short_code"`
+	Clicks    int64  `json:"clicks"`
+}
+
+// Stats comparison intervals: the length of the periods clicks are counted
+// in, starting at midnight UTC or on the hour.
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+)
+
+// PeriodClicks is the number of clicks on one link in the period starting
+// at Start.
+type PeriodClicks struct {
+	ShortCode string
+	Start     time.Time
+	Clicks    int64
+}
+
+// StatsComparison holds the clicks of several links over the same periods:
+// Clicks[i] of every series counts the period starting at Periods[i].
+type StatsComparison struct {
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Interval string        `json:"interval"`
+	Periods  []time.Time   `json:"periods"`
+	Series   []ClickSeries `json:"series"`
+}
+
+// ClickSeries is one link of a StatsComparison.
+type ClickSeries struct {
+	ShortCode string  `json:"short_code"`
+	Clicks    []int64 `json:"clicks"`
+	Total     int64   `json:"total"`
+}
+
+// Redirect block kinds: a code block stops one link, a destination block
+// every link to that exact URL and a domain block every link to the domain
+// or its subdomains.
+const (
+	BlockCode        = "code"
+	BlockDestination = "destination"
+	BlockDomain      = "domain"
+)
+
+// RedirectBlock is a rule checked on every redirect, so links created
+// before a destination turned out to be abusive can be stopped without
+// deleting them. Reason is for operators and is never shown to visitors.
+// Name is the ID chosen by the client for blocks provisioned with PUT.
+type RedirectBlock struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Kind      string    `json:"kind"`
+	Value     string    `json:"value"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DomainClaim is a request by the owner of Domain to manage the links that
+// point at it. The owner proves control by publishing VerificationToken on
+// the domain; Key is the secret that authenticates the owner afterwards
+// and is only shown when the claim is created. Claims provisioned by an
+// operator with PUT carry the Name they were provisioned under and are
+// verified from the start.
+type DomainClaim struct {
+	ID                int64      `json:"id"`
+	Name              string     `json:"name,omitempty"`
+	Domain            string     `json:"domain"`
+	VerificationToken string     `json:"verification_token"`
+	Key               string     `json:"key,omitempty"`
+	VerifiedAt        *time.Time `json:"verified_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// APIKey is a credential provisioned by an operator under the ID of their
+// choice. Key is the secret, only shown when the key is created; the
+// repository stores its hash. Scopes are the API key scopes it is granted,
+// in the order of APIKeyScopes. CreatedBy is who the operator said created
+// it, and LastUsedAt when it last authenticated a request, to the minute.
+// The key stops authenticating at ExpiresAt. After a rotation the secret it
+// replaced, whose hash is PreviousKeyHash, keeps authenticating until
+// PreviousKeyExpiresAt, so that clients can move to the new one.
+type APIKey struct {
+	ID                   string     `json:"id"`
+	Name                 string     `json:"name"`
+	Scopes               []string   `json:"scopes"`
+	CreatedBy            string     `json:"created_by,omitempty"`
+	Key                  string     `json:"key,omitempty"`
+	KeyHash              string     `json:"-"`
+	ExpiresAt            *time.Time `json:"expires_at,omitempty"`
+	PreviousKeyHash      string     `json:"-"`
+	PreviousKeyExpiresAt *time.Time `json:"previous_key_expires_at,omitempty"`
+	LastUsedAt           *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+// API key scopes. ScopeAdmin grants the others too.
+const (
+	// ScopeLinksRead lists and searches links, trash and profiles.
+	ScopeLinksRead = "links:read"
+	// ScopeLinksWrite changes them in bulk, restores and purges trash and
+	// edits profiles.
+	ScopeLinksWrite = "links:write"
+	// ScopeStatsRead sees the stats of every link, whatever its stats
+	// visibility.
+	ScopeStatsRead = "stats:read"
+	// ScopeAdmin uses the admin API, /api/v1/admin/*.
+	ScopeAdmin = "admin"
+)
+
+// APIKeyScopes lists the API key scopes.
+var APIKeyScopes = []string{ScopeLinksRead, ScopeLinksWrite, ScopeStatsRead, ScopeAdmin}
+
+// HasScope reports whether the key is granted scope.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimedLink is what a domain owner sees of a link to their domain.
+type ClaimedLink struct {
+	ShortCode string    `json:"short_code"`
+	LongURL   string    `json:"long_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SearchPage selects a page of link search results: Limit results after
+// skipping the first Offset.
+type SearchPage struct {
+	Offset int
+	Limit  int
+}
+
+// DestinationQuery selects links by destination: a link matches when its
+// destination equals one of URLs or starts with one of Prefixes. Both hold
+// normalized destinations.
+type DestinationQuery struct {
+	URLs     []string
+	Prefixes []string
+}
+
+// DuplicateGroup is a destination that several links point at. Links are
+// oldest first; the oldest is the suggested canonical code.
+type DuplicateGroup struct {
+	Destination string          `json:"destination"`
+	Links       []DuplicateLink `json:"links"`
+}
+
+type DuplicateLink struct {
+	ShortCode string    `json:"short_code"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MergeResult reports a merge of duplicate links into Canonical: Merged
+// now redirect to it, and their ClicksMoved clicks are counted for it.
+type MergeResult struct {
+	Canonical   string   `json:"canonical"`
+	Merged      []string `json:"merged"`
+	ClicksMoved int64    `json:"clicks_moved"`
+}
+
+// LinkPreview is what the /{code}+ page shows about a link: where it leads
+// and how often it was clicked.
+type LinkPreview struct {
+	ShortCode   string     `json:"short_code"`
+	Kind        string     `json:"kind"`
+	Title       string     `json:"title,omitempty"`
+	Destination string     `json:"destination,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Clicks      int64      `json:"clicks"`
+	ClicksWeek  int64      `json:"clicks_last_7_days"`
+}
+
+// SignedLink is a signature that lets the link be opened until ExpiresAt.
+// Expires and Signature are the exp and sig query parameters.
+type SignedLink struct {
+	ShortCode string    `json:"short_code"`
+	ExpiresAt time.Time `json:"expires_at"`
+	KeyID     string    `json:"kid,omitempty"`
+	Expires   string    `json:"exp"`
+	Signature string    `json:"sig"`
+}
+
+// Hook is a REST hook subscription: TargetURL receives a POST for every
+// occurrence of Event.
+type Hook struct {
+	ID        int64     `json:"id"`
+	Event     string    `json:"event"`
+	TargetURL string    `json:"target_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ClickAnomaly is a click spike detected on a link: Clicks in the window
+// from WindowStart to DetectedAt, Factor times or more the Expected clicks
+// of the link's baseline rate. It may be a link going viral or a bot.
+type ClickAnomaly struct {
+	ID          int64     `json:"id"`
+	ShortCode   string    `json:"short_code"`
+	Clicks      int64     `json:"clicks"`
+	Expected    float64   `json:"expected"`
+	Factor      float64   `json:"factor"`
+	WindowStart time.Time `json:"window_start"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
+
+// Honeypot is a code that is never handed out, so only clients guessing
+// or scanning for codes ever request it. Hits counts those requests and
+// LastHitAt is the latest; Note is for operators.
+type Honeypot struct {
+	Code      string     `json:"code"`
+	Note      string     `json:"note,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	Hits      int64      `json:"hits"`
+	LastHitAt *time.Time `json:"last_hit_at,omitempty"`
+}
+
+// SlackWorkspace is a Slack workspace with its own signing secret for the
+// slash-command integration. The secret is never returned.
+type SlackWorkspace struct {
+	TeamID    string    `json:"team_id"`
+	TeamName  string    `json:"team_name,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HoneypotHit is one request for a honeypot code.
+type HoneypotHit struct {
+	ID        int64     `json:"id"`
+	Code      string    `json:"code"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Referer   string    `json:"referer,omitempty"`
+	HitAt     time.Time `json:"hit_at"`
+}
+
+// BundleItem is one destination listed on a bundle link's landing page.
+type BundleItem struct {
+	ID        int64     `json:"id"`
+	ShortCode string    `json:"short_code"`
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Branding is the look of the public pages (landing, preview, profile and
+// interstitial pages): a logo shown at the top, colors, a footer line and
+// extra CSS. Empty fields keep the built-in look.
+type Branding struct {
+	LogoURL         string    `json:"logo_url"`
+	PrimaryColor    string    `json:"primary_color"`
+	BackgroundColor string    `json:"background_color"`
+	TextColor       string    `json:"text_color"`
+	Footer          string    `json:"footer"`
+	CSS             string    `json:"css"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Maintenance is the maintenance mode of the service. While Enabled,
+// requests that change state are refused with 503 and RetryAfter (seconds)
+// and Message, and redirects and other reads keep working. Forced reports
+// that MAINTENANCE_MODE holds it on, whatever is saved.
+type Maintenance struct {
+	Enabled    bool       `json:"enabled"`
+	Message    string     `json:"message,omitempty"`
+	RetryAfter int        `json:"retry_after"`
+	Forced     bool       `json:"forced,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+// Profile is a link-in-bio page served at /@{username}: a display name, a
+// short bio and the short links of its items.
+type Profile struct {
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ProfileItem is a short link listed on a profile page, in Position order.
+// Clicks counts the visitors who followed it from the page.
+type ProfileItem struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	ShortCode string    `json:"short_code"`
+	Title     string    `json:"title"`
+	Position  int       `json:"position"`
+	Clicks    int64     `json:"clicks"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	PasteFormatText     = "text"
+	PasteFormatMarkdown = "markdown"
+)
+
+// Paste is the stored content of a paste link.
+type Paste struct {
+	ShortCode string `json:"short_code"`
+	Format    string `json:"format"`
+	Content   string `json:"content"`
+}
+
+const (
+	FileStatusPending = "pending"
+	FileStatusReady   = "ready"
+)
+
+// File is the upload behind a file link. It stays pending until its content
+// has reached the object store.
+type File struct {
+	ShortCode   string    `json:"short_code"`
+	ObjectKey   string    `json:"-"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Status      string    `json:"status"`
+	UploadToken string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const (
+	PixelProviderFacebook = "facebook"
+	PixelProviderGoogle   = "google"
+)
+
+// Pixel is a retargeting or conversion tag (a Facebook pixel ID or a Google
+// tag ID such as G-XXXX or AW-123) that links can fire before redirecting.
+type Pixel struct {
+	ID        int64     `json:"id"`
+	Provider  string    `json:"provider"`
+	TagID     string    `json:"tag_id"`
+	Name      string    `json:"name,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	ReportWeekly  = "weekly"
+	ReportMonthly = "monthly"
+)
+
+// ReportSubscription sends Email a periodic summary of the links in
+// ShortCodes, or of all links when it is empty.
+type ReportSubscription struct {
+	ID               int64      `json:"id"`
+	Email            string     `json:"email"`
+	Frequency        string     `json:"frequency"`
+	ShortCodes       []string   `json:"short_codes,omitempty"`
+	NextRunAt        time.Time  `json:"next_run_at"`
+	LastSentAt       *time.Time `json:"last_sent_at,omitempty"`
+	UnsubscribeToken string     `json:"-"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// DailyCount is a per-day total; Day is a UTC date in YYYY-MM-DD form.
+type DailyCount struct {
+	Day   string `json:"day"`
+	Count int64  `json:"count"`
+}
+
+// DomainStats counts the links created for a destination host and the
+// clicks they received.
+type DomainStats struct {
+	Domain string `json:"domain"`
+	Links  int64  `json:"links"`
+	Clicks int64  `json:"clicks"`
+}
+
+// StorageUsage is the space taken by the database and the content it points to.
+type StorageUsage struct {
+	DatabaseBytes int64 `json:"database_bytes"`
+	FileBytes     int64 `json:"file_bytes"`
+	PasteBytes    int64 `json:"paste_bytes"`
+}
+
+// Overview is the system-wide summary shown on the ops dashboard.
+type Overview struct {
+	TotalLinks     int64         `json:"total_links"`
+	TotalRedirects int64         `json:"total_redirects"`
+	LinksPerDay    []DailyCount  `json:"links_per_day"`
+	TopLinks       []LinkClicks  `json:"top_links"`
+	TopDomains     []DomainStats `json:"top_domains"`
+	Storage        StorageUsage  `json:"storage"`
+	GeneratedAt    time.Time     `json:"generated_at"`
+}
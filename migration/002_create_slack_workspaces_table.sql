@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS slack_workspaces (
+                                    team_id TEXT PRIMARY KEY,
+                                    team_name TEXT NOT NULL DEFAULT '',
+                                    signing_secret TEXT NOT NULL,
+                                    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS clicks (
+                                    id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                    short_code TEXT NOT NULL,
+                                    clicked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                    ip TEXT NOT NULL DEFAULT '',
+                                    user_agent TEXT NOT NULL DEFAULT '',
+                                    referer TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_clicks_short_code ON clicks(short_code);
+
+CREATE TABLE IF NOT EXISTS hooks (
+                                    id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                    event TEXT NOT NULL,
+                                    target_url TEXT NOT NULL,
+                                    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_hooks_event ON hooks(event);
@@ -0,0 +1 @@
+ALTER TABLE urls ADD COLUMN headers TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN redirect_type INTEGER NOT NULL DEFAULT 302;
+ALTER TABLE urls ADD COLUMN cache_control TEXT NOT NULL DEFAULT '';
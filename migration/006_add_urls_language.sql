@@ -0,0 +1 @@
+ALTER TABLE urls ADD COLUMN language TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+ALTER TABLE urls ADD COLUMN kind TEXT NOT NULL DEFAULT 'redirect';
+ALTER TABLE urls ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN item_id INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS bundle_items (
+                                    id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                    short_code TEXT NOT NULL,
+                                    title TEXT NOT NULL DEFAULT '',
+                                    url TEXT NOT NULL,
+                                    position INTEGER NOT NULL DEFAULT 0,
+                                    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_bundle_items_short_code ON bundle_items(short_code);
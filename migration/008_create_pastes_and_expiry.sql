@@ -0,0 +1,7 @@
+ALTER TABLE urls ADD COLUMN expires_at TIMESTAMP NULL;
+
+CREATE TABLE IF NOT EXISTS pastes (
+                                    short_code TEXT PRIMARY KEY,
+                                    format TEXT NOT NULL DEFAULT 'text',
+                                    content TEXT NOT NULL
+);
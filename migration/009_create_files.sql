@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS files (
+                                   short_code TEXT PRIMARY KEY,
+                                   object_key TEXT NOT NULL,
+                                   filename TEXT NOT NULL,
+                                   content_type TEXT NOT NULL,
+                                   size INTEGER NOT NULL,
+                                   status TEXT NOT NULL DEFAULT 'pending',
+                                   upload_token TEXT NOT NULL DEFAULT '',
+                                   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
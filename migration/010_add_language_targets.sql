@@ -0,0 +1 @@
+ALTER TABLE urls ADD COLUMN language_targets TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+ALTER TABLE urls ADD COLUMN pixel_ids TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS pixels (
+                                    id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                    provider TEXT NOT NULL,
+                                    tag_id TEXT NOT NULL,
+                                    name TEXT NOT NULL DEFAULT '',
+                                    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
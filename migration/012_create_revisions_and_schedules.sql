@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS link_revisions (
+                                            id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                            short_code TEXT NOT NULL,
+                                            previous_url TEXT NOT NULL,
+                                            long_url TEXT NOT NULL,
+                                            source TEXT NOT NULL,
+                                            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_revisions_short_code ON link_revisions(short_code);
+
+CREATE TABLE IF NOT EXISTS scheduled_changes (
+                                               id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                               short_code TEXT NOT NULL,
+                                               new_url TEXT NOT NULL,
+                                               effective_at TIMESTAMP NOT NULL,
+                                               status TEXT NOT NULL DEFAULT 'pending',
+                                               error TEXT NOT NULL DEFAULT '',
+                                               created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                               finished_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_changes_due ON scheduled_changes(status, effective_at);
+CREATE INDEX IF NOT EXISTS idx_scheduled_changes_short_code ON scheduled_changes(short_code);
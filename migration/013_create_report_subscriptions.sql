@@ -0,0 +1,15 @@
+CREATE INDEX IF NOT EXISTS idx_clicks_clicked_at ON clicks(clicked_at);
+
+CREATE TABLE IF NOT EXISTS report_subscriptions (
+                                                  id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                                  email TEXT NOT NULL,
+                                                  frequency TEXT NOT NULL,
+                                                  short_codes TEXT NOT NULL DEFAULT '',
+                                                  unsubscribe_token TEXT NOT NULL UNIQUE,
+                                                  next_run_at TIMESTAMP NOT NULL,
+                                                  last_sent_at TIMESTAMP NULL,
+                                                  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_report_subscriptions_email ON report_subscriptions(email);
+CREATE INDEX IF NOT EXISTS idx_report_subscriptions_next_run_at ON report_subscriptions(next_run_at);
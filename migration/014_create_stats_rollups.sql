@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS rollup_state (
+                                            source TEXT PRIMARY KEY,
+                                            last_id INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS daily_stats (
+                                           day TEXT PRIMARY KEY,
+                                           links_created INTEGER NOT NULL DEFAULT 0,
+                                           redirects INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS link_stats (
+                                          short_code TEXT PRIMARY KEY,
+                                          clicks INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_stats_clicks ON link_stats(clicks);
+
+CREATE TABLE IF NOT EXISTS domain_stats (
+                                            domain TEXT PRIMARY KEY,
+                                            links INTEGER NOT NULL DEFAULT 0,
+                                            clicks INTEGER NOT NULL DEFAULT 0
+);
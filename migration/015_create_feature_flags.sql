@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS feature_flags (
+                                             name TEXT PRIMARY KEY,
+                                             enabled INTEGER NOT NULL DEFAULT 0,
+                                             rollout INTEGER NOT NULL DEFAULT 100,
+                                             environments TEXT NOT NULL DEFAULT '',
+                                             updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1 @@
+ALTER TABLE urls ADD COLUMN stats_visibility TEXT NOT NULL DEFAULT 'private';
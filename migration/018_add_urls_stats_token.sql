@@ -0,0 +1 @@
+ALTER TABLE urls ADD COLUMN stats_token TEXT NOT NULL DEFAULT '';
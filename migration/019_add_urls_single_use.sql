@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN single_use INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN consumed_at TIMESTAMP NULL;
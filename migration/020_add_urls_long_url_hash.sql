@@ -0,0 +1,3 @@
+ALTER TABLE urls ADD COLUMN long_url_hash TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_urls_long_url_hash ON urls(long_url_hash) WHERE long_url_hash != '';
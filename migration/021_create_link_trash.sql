@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS link_trash (
+                                          id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                          short_code TEXT NOT NULL UNIQUE,
+                                          link TEXT NOT NULL,
+                                          deleted_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_trash_deleted_at ON link_trash(deleted_at);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS redirect_blocks (
+                                               id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                               kind TEXT NOT NULL,
+                                               value TEXT NOT NULL,
+                                               reason TEXT NOT NULL DEFAULT '',
+                                               created_at TIMESTAMP NOT NULL,
+                                               UNIQUE(kind, value)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS domain_claims (
+                                             id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                             domain TEXT NOT NULL,
+                                             verification_token TEXT NOT NULL,
+                                             claim_key TEXT NOT NULL UNIQUE,
+                                             verified_at TIMESTAMP NULL,
+                                             created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN allowed_countries TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN blocked_countries TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE urls ADD COLUMN time_rules TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE urls ADD COLUMN social_preview INTEGER NOT NULL DEFAULT 0;
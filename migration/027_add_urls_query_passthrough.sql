@@ -0,0 +1 @@
+ALTER TABLE urls ADD COLUMN query_passthrough TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE urls ADD COLUMN wildcard INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,13 @@
+ALTER TABLE urls ADD COLUMN spike_factor REAL NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN spike_min_clicks INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS click_anomalies (
+                                               id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                               short_code TEXT NOT NULL,
+                                               clicks INTEGER NOT NULL,
+                                               expected REAL NOT NULL,
+                                               factor REAL NOT NULL,
+                                               window_start TIMESTAMP NOT NULL,
+                                               detected_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_click_anomalies_short_code ON click_anomalies(short_code, detected_at);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS honeypots (
+                                         code TEXT PRIMARY KEY,
+                                         note TEXT NOT NULL DEFAULT '',
+                                         created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS honeypot_hits (
+                                             id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                             code TEXT NOT NULL,
+                                             ip TEXT NOT NULL,
+                                             user_agent TEXT NOT NULL DEFAULT '',
+                                             referer TEXT NOT NULL DEFAULT '',
+                                             hit_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_honeypot_hits_code ON honeypot_hits(code);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS profiles (
+                                        username TEXT PRIMARY KEY,
+                                        display_name TEXT NOT NULL DEFAULT '',
+                                        bio TEXT NOT NULL DEFAULT '',
+                                        created_at TIMESTAMP NOT NULL,
+                                        updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS profile_items (
+                                             id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                             username TEXT NOT NULL,
+                                             short_code TEXT NOT NULL,
+                                             title TEXT NOT NULL DEFAULT '',
+                                             position INTEGER NOT NULL DEFAULT 0,
+                                             clicks INTEGER NOT NULL DEFAULT 0,
+                                             created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_profile_items_username ON profile_items(username);
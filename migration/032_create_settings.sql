@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS settings (
+                                        name TEXT PRIMARY KEY,
+                                        value TEXT NOT NULL,
+                                        updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,4 @@
+ALTER TABLE redirect_blocks ADD COLUMN name TEXT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_redirect_blocks_name ON redirect_blocks(name) WHERE name IS NOT NULL;
+ALTER TABLE domain_claims ADD COLUMN name TEXT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_domain_claims_name ON domain_claims(name) WHERE name IS NOT NULL;
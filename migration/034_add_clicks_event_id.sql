@@ -0,0 +1,2 @@
+ALTER TABLE clicks ADD COLUMN event_id TEXT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_clicks_event_id ON clicks(event_id) WHERE event_id IS NOT NULL;
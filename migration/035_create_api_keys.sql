@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+                                        id TEXT PRIMARY KEY,
+                                        name TEXT NOT NULL DEFAULT '',
+                                        key_hash TEXT NOT NULL UNIQUE,
+                                        created_at TIMESTAMP NOT NULL,
+                                        updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,4 @@
+ALTER TABLE api_keys ADD COLUMN expires_at TIMESTAMP NULL;
+ALTER TABLE api_keys ADD COLUMN previous_key_hash TEXT NULL;
+ALTER TABLE api_keys ADD COLUMN previous_key_expires_at TIMESTAMP NULL;
+CREATE INDEX IF NOT EXISTS idx_api_keys_previous_key_hash ON api_keys(previous_key_hash) WHERE previous_key_hash IS NOT NULL;
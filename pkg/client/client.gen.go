@@ -0,0 +1,203 @@
+// Code generated by apigen from openapi.json. DO NOT EDIT.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrorResponse is the ErrorResponse schema.
+type ErrorResponse struct {
+	// The human-readable message.
+	Error string `json:"error"`
+	// A stable identifier, e.g. LINK_NOT_FOUND.
+	Code   string       `json:"code"`
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError is the FieldError schema.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ShortenRequest is the ShortenRequest schema.
+type ShortenRequest struct {
+	// The absolute http or https destination.
+	URL string `json:"url"`
+	// Creates a link that opens only once.
+	SingleUse bool `json:"single_use,omitempty"`
+	// Also redirects /{code}/{path...} to the destination with the path appended.
+	Wildcard bool `json:"wildcard,omitempty"`
+	// The response of the CAPTCHA widget, required from anonymous clients when
+	// the server has CAPTCHA enabled.
+	CaptchaToken string `json:"captcha_token,omitempty"`
+}
+
+// ShortenResponse is the ShortenResponse schema.
+type ShortenResponse struct {
+	ShortCode string `json:"short_code"`
+	ShortURL  string `json:"short_url"`
+	// The destination as stored.
+	LongURL string `json:"long_url"`
+	// The destination in its human-readable form, with an internationalized
+	// domain decoded from punycode.
+	OriginalURL string `json:"original_url"`
+	// Flags destinations that look like homograph (look-alike) domains.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// TimeRule is the TimeRule schema.
+type TimeRule struct {
+	Days     []string `json:"days,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       string   `json:"to,omitempty"`
+	TimeZone string   `json:"time_zone,omitempty"`
+	URL      string   `json:"url"`
+}
+
+// UpdateRequest is the UpdateRequest schema.
+type UpdateRequest struct {
+	NewURL       string            `json:"new_url,omitempty"`
+	Headers      map[string]string `json:"headers"`
+	RedirectType *int              `json:"redirect_type,omitempty"`
+	CacheControl *string           `json:"cache_control,omitempty"`
+	Language     *string           `json:"language,omitempty"`
+	// An RFC 3339 timestamp; an empty string removes the expiry.
+	ExpiresAt       *string           `json:"expires_at,omitempty"`
+	LanguageTargets map[string]string `json:"language_targets"`
+	PixelIDs        []int64           `json:"pixel_ids"`
+	StatsVisibility *string           `json:"stats_visibility,omitempty"`
+	SingleUse       *bool             `json:"single_use,omitempty"`
+	// ISO 3166-1 alpha-2 codes; an empty list removes the rule.
+	AllowedCountries []string `json:"allowed_countries"`
+	// ISO 3166-1 alpha-2 codes; an empty list removes the rule.
+	BlockedCountries []string `json:"blocked_countries"`
+	// Replaces the ordered time rules; an empty list removes them.
+	TimeRules        []TimeRule `json:"time_rules"`
+	SocialPreview    *bool      `json:"social_preview,omitempty"`
+	QueryPassthrough *string    `json:"query_passthrough,omitempty"`
+	// The click spike alert threshold; 0 restores the default and a negative
+	// factor turns the alerts off.
+	SpikeFactor    *float64 `json:"spike_factor,omitempty"`
+	SpikeMinClicks *int64   `json:"spike_min_clicks,omitempty"`
+}
+
+// UpdateResponse is the UpdateResponse schema.
+type UpdateResponse struct {
+	Message string `json:"message"`
+	// The new stats token, only ever shown in this response.
+	StatsToken string `json:"stats_token,omitempty"`
+}
+
+// Client calls the API at BaseURL. The zero HTTPClient is
+// http.DefaultClient.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Header is sent with every request, e.g. an Authorization header.
+	Header http.Header
+}
+
+// New returns a Client for the API at baseURL, e.g. https://go.example.com.
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Header: http.Header{}}
+}
+
+// Error is returned for a response with another status than the operation
+// succeeds with. Body is the decoded error response, zero when the server
+// did not send one.
+type Error struct {
+	Status int
+	Body   ErrorResponse
+}
+
+func (e *Error) Error() string {
+	if e.Body.Error != "" {
+		return fmt.Sprintf("%d %s: %s", e.Status, e.Body.Code, e.Body.Error)
+	}
+	return fmt.Sprintf("unexpected status %d", e.Status)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}, status int) error {
+	var reqBody io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.BaseURL, "/")+path, reqBody)
+	if err != nil {
+		return err
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != status {
+		apiErr := &Error{Status: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr.Body)
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+// DeleteLink deletes a link.
+//
+// DELETE /delete/{code}
+func (c *Client) DeleteLink(ctx context.Context, code string) error {
+	return c.do(ctx, "DELETE", "/delete/"+url.PathEscape(code), nil, nil, 204)
+}
+
+// Shorten creates a short link, or returns the existing link to the same
+// destination.
+//
+// POST /shorten
+func (c *Client) Shorten(ctx context.Context, body ShortenRequest) (*ShortenResponse, error) {
+	var out ShortenResponse
+	if err := c.do(ctx, "POST", "/shorten", body, &out, 201); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateLink changes the destination or settings of a link; fields left out
+// stay as they are.
+//
+// PUT /update/{code}
+func (c *Client) UpdateLink(ctx context.Context, code string, body UpdateRequest) (*UpdateResponse, error) {
+	var out UpdateResponse
+	if err := c.do(ctx, "PUT", "/update/"+url.PathEscape(code), body, &out, 200); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,76 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"template/pkg/client"
+	"template/pkg/shortener"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// TestClientAgainstServer runs the generated client against the shortening
+// API served by the embedded shortener.
+func TestClientAgainstServer(t *testing.T) {
+	db, err := shortener.OpenSQLite(filepath.Join(t.TempDir(), "links.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	server := httptest.NewServer(nil)
+	defer server.Close()
+	svc, err := shortener.New(shortener.NewSQLiteRepository(db, false), shortener.Options{BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+	server.Config.Handler = svc.Handler()
+
+	ctx := context.Background()
+	c := client.New(server.URL)
+
+	link, err := c.Shorten(ctx, client.ShortenRequest{URL: "https://example.com/page"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.ShortCode == "" || link.ShortURL != server.URL+"/"+link.ShortCode || link.LongURL != "https://example.com/page" {
+		t.Fatalf("Shorten = %+v", link)
+	}
+
+	redirectType := http.StatusMovedPermanently
+	if _, err := c.UpdateLink(ctx, link.ShortCode, client.UpdateRequest{NewURL: "https://example.com/other", RedirectType: &redirectType}); err != nil {
+		t.Fatal(err)
+	}
+	mapping, err := svc.GetLink(link.ShortCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.LongURL != "https://example.com/other" || mapping.RedirectType != redirectType {
+		t.Errorf("link after UpdateLink = %+v", mapping)
+	}
+
+	if err := c.DeleteLink(ctx, link.ShortCode); err != nil {
+		t.Fatal(err)
+	}
+	err = c.DeleteLink(ctx, link.ShortCode)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound || apiErr.Body.Code != "LINK_NOT_FOUND" {
+		t.Errorf("second DeleteLink = %v, want 404 LINK_NOT_FOUND", err)
+	}
+
+	_, err = c.Shorten(ctx, client.ShortenRequest{URL: "javascript:alert(1)"})
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest || apiErr.Body.Code != "INVALID_URL" {
+		t.Errorf("Shorten of a javascript: URL = %v, want 400 INVALID_URL", err)
+	}
+}
@@ -0,0 +1,19 @@
+// Package client is a typed Go client for the shortening API, generated
+// from api/openapi.json by cmd/apigen. Do not edit client.gen.go; change
+// the spec and run make generate.
+//
+//	c := client.New("https://go.example.com")
+//	link, err := c.Shorten(ctx, client.ShortenRequest{URL: "https://example.com/a/long/path"})
+//	if err != nil {
+//		var apiErr *client.Error
+//		if errors.As(err, &apiErr) && apiErr.Body.Code == "INVALID_URL" {
+//			...
+//		}
+//	}
+//	fmt.Println(link.ShortURL)
+//
+// The client expects the plain response bodies, so it cannot talk to a
+// server with RESPONSE_ENVELOPE on.
+package client
+
+//go:generate go run ../../cmd/apigen -spec ../../api/openapi.json -go client.gen.go -ts ../../clients/typescript/client.ts
@@ -0,0 +1,272 @@
+// Package shortener embeds the URL shortener in another Go program: it
+// builds the link service on a repository of the caller's choosing, serves
+// the shortening and redirect endpoints on the caller's mux and lets the
+// program create links directly, without the configuration, background
+// jobs and integrations of the full server.
+//
+//	db, err := shortener.OpenSQLite("./links.db")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	svc, err := shortener.New(shortener.NewSQLiteRepository(db, false), shortener.Options{
+//		BaseURL: "https://go.example.com",
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer svc.Close()
+//
+//	code, err := svc.CreateShortURL("https://example.com/a/long/path")
+//	...
+//	mux := http.NewServeMux()
+//	svc.RegisterRoutes(mux) // POST /shorten, GET /{code}, ...
+//
+// The types below are aliases of the server's own, so a repository written
+// for this package works in the server and the other way round.
+package shortener
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	httpHandlers "template/internal/deliveries/http"
+	"template/internal/pkg/kvfile"
+	"template/internal/pkg/tasks"
+	"template/internal/repositories"
+	"template/internal/services"
+	"template/internal/usecases/shortner"
+)
+
+type (
+	// Mapping is a stored link.
+	Mapping = shortner.URLMapping
+	// Click is one recorded visit of a link.
+	Click = shortner.Click
+	// Repository stores links. InitSchema is called once by New.
+	Repository = repositories.ShortenerRepository
+	// KeyValueStore is the storage a key-value Repository keeps links in;
+	// see NewKeyValueRepository.
+	KeyValueStore = repositories.KeyValueStore
+	// FileStore is a KeyValueStore in a file, in pure Go; see OpenFileStore.
+	FileStore = repositories.FileKeyValueStore
+	// ClickRepository stores the clicks recorded on redirects.
+	ClickRepository = repositories.ClickRepository
+	// Policy holds the rules applied to new links, such as blocked
+	// domains and reserved codes.
+	Policy = services.LinkPolicy
+	// RedirectOptions control the headers of redirect responses.
+	RedirectOptions = httpHandlers.RedirectOptions
+	// Error is returned for requests the service refuses, such as an
+	// invalid or blocked destination; Code tells them apart.
+	Error = services.Error
+	// Clock tells the service the time, for creation dates and expiry.
+	Clock = services.Clock
+	// Generator produces the random strings new codes are made of.
+	Generator = services.Generator
+)
+
+// ErrNotFound is returned by repositories for a code they do not hold.
+var ErrNotFound = repositories.ErrNotFound
+
+// ErrCorruptStore is returned by OpenFileStore for a file damaged other
+// than by a crash in the middle of a write.
+var ErrCorruptStore = kvfile.ErrCorrupt
+
+// Options configure an embedded Service. Only BaseURL is required.
+type Options struct {
+	// BaseURL is the address the short links are served under, e.g.
+	// https://go.example.com; short URLs are BaseURL/code.
+	BaseURL string
+	// Clicks stores a click for every redirect. When nil, clicks are not
+	// recorded.
+	Clicks ClickRepository
+	// ClickWorkers is the number of goroutines that store clicks in the
+	// background (default 4).
+	ClickWorkers int
+	// Policy is applied to every new link; the zero value refuses
+	// destinations on private networks and allows everything else.
+	Policy Policy
+	// Redirect defaults to no-store for temporary redirects and a year of
+	// caching for permanent ones, as in the server.
+	Redirect RedirectOptions
+	// Clock and Generator replace the system clock and crypto/rand, so
+	// the program's tests can control expiry, creation dates and codes.
+	Clock     Clock
+	Generator Generator
+}
+
+// Service is an embedded shortener. It is safe for concurrent use.
+type Service struct {
+	links     services.ShortenerService
+	analytics services.AnalyticsService
+	handler   *httpHandlers.ShortenerHandler
+	clicks    *tasks.Pool
+	baseURL   string
+}
+
+// New creates the tables repo and opts.Clicks need, if they are missing,
+// and returns a Service storing links in repo. Close stops it.
+func New(repo Repository, opts Options) (*Service, error) {
+	if opts.BaseURL == "" {
+		return nil, errors.New("shortener: Options.BaseURL is required")
+	}
+	if repo == nil {
+		return nil, errors.New("shortener: repository is required")
+	}
+	if err := repo.InitSchema(); err != nil {
+		return nil, fmt.Errorf("shortener: initializing link schema: %w", err)
+	}
+	clickRepo := opts.Clicks
+	if clickRepo == nil {
+		clickRepo = discardClicks{}
+	} else if err := clickRepo.InitSchema(); err != nil {
+		return nil, fmt.Errorf("shortener: initializing click schema: %w", err)
+	}
+	if opts.Redirect.CacheControlTemporary == "" {
+		opts.Redirect.CacheControlTemporary = "no-store"
+	}
+	if opts.Redirect.CacheControlPermanent == "" {
+		opts.Redirect.CacheControlPermanent = "public, max-age=31536000"
+	}
+
+	pool := tasks.New("clicks", tasks.Options{Workers: opts.ClickWorkers})
+	links := services.NewShortenerService(repo, nil, nil, nil, nil)
+	links.SetPolicy(opts.Policy)
+	analytics := services.NewAnalyticsService(clickRepo, nil, nil, pool, services.AnalyticsOptions{})
+	handler := httpHandlers.NewShortenerHandler(links, analytics, repo, opts.BaseURL, opts.Redirect)
+	if opts.Clock != nil {
+		links.(services.Deterministic).SetClock(opts.Clock)
+		analytics.(services.Deterministic).SetClock(opts.Clock)
+		handler.SetClock(opts.Clock)
+	}
+	if opts.Generator != nil {
+		links.(services.Deterministic).SetGenerator(opts.Generator)
+	}
+	return &Service{
+		links:     links,
+		analytics: analytics,
+		handler:   handler,
+		clicks:    pool,
+		baseURL:   opts.BaseURL,
+	}, nil
+}
+
+// OpenSQLite opens, creating it if needed, the SQLite database at path for
+// NewSQLiteRepository and NewSQLiteClickRepository.
+func OpenSQLite(path string) (*sql.DB, error) {
+	return repositories.ConnectDB(path)
+}
+
+// NewSQLiteRepository stores links in the urls table of db, the same
+// layout the server uses. With caseInsensitive, abc and ABC are one code.
+func NewSQLiteRepository(db *sql.DB, caseInsensitive bool) Repository {
+	return repositories.NewSQLiteShortenerRepo(db, caseInsensitive)
+}
+
+// NewKeyValueRepository stores links as JSON under their codes in store,
+// which can wrap BoltDB, Badger, DynamoDB or any store with conditional
+// writes. It cannot find links by destination, so every CreateShortURL
+// creates a new link. With caseInsensitive, abc and ABC are one code.
+func NewKeyValueRepository(store KeyValueStore, caseInsensitive bool) Repository {
+	return repositories.NewKeyValueShortenerRepo(store, caseInsensitive)
+}
+
+// OpenFileStore opens, creating it if needed, the KeyValueStore in the file
+// at path. Unlike SQLite it needs no cgo, so a program keeping its links in
+// it, without Options.Clicks, builds with CGO_ENABLED=0 into a static
+// binary. Every link is held in memory. Close it after the Service.
+func OpenFileStore(path string) (*FileStore, error) {
+	return repositories.OpenFileKeyValueStore(path)
+}
+
+// NewMemoryStore is a KeyValueStore in memory, which loses the links when
+// the program exits; for tests.
+func NewMemoryStore() KeyValueStore {
+	return repositories.NewMemoryKeyValueStore()
+}
+
+// NewSQLiteClickRepository stores clicks in the clicks table of db.
+func NewSQLiteClickRepository(db *sql.DB) ClickRepository {
+	return repositories.NewSQLiteClickRepo(db)
+}
+
+// CreateShortURL stores a link to longURL and returns its short code, or
+// the code of the existing link to the same destination. Use ShortURL for
+// the full address.
+func (s *Service) CreateShortURL(longURL string) (string, error) {
+	return s.links.CreateShortURL(longURL)
+}
+
+// CreateLink stores a link with the settings of mapping, such as a title,
+// an expiry or a redirect type, under a new code.
+func (s *Service) CreateLink(mapping Mapping) (string, error) {
+	return s.links.CreateLink(mapping)
+}
+
+// GetLink returns the link stored under shortCode.
+func (s *Service) GetLink(shortCode string) (*Mapping, error) {
+	return s.links.GetLink(shortCode)
+}
+
+// DeleteLink removes the link stored under shortCode.
+func (s *Service) DeleteLink(shortCode string) error {
+	return s.links.DeleteMapping(shortCode)
+}
+
+// SetPolicy replaces the rules applied to new links.
+func (s *Service) SetPolicy(policy Policy) {
+	s.links.SetPolicy(policy)
+}
+
+// ShortURL returns the address a short code is served under.
+func (s *Service) ShortURL(shortCode string) string {
+	return strings.TrimSuffix(s.baseURL, "/") + "/" + shortCode
+}
+
+// RegisterRoutes serves the shortening API (POST /shorten, POST /quick,
+// PUT /update/{code}, DELETE /delete/{code}) and the redirects on mux. The
+// redirects are served from "/", so more specific patterns the program
+// registers keep precedence over short codes.
+func (s *Service) RegisterRoutes(mux *http.ServeMux) {
+	s.handler.RegisterRoutes(mux)
+}
+
+// Handler returns a handler serving only the routes of RegisterRoutes, for
+// mounting under a prefix with http.StripPrefix.
+func (s *Service) Handler() http.Handler {
+	mux := http.NewServeMux()
+	s.RegisterRoutes(mux)
+	return mux
+}
+
+// Close waits for the clicks still queued to be stored. The Service must
+// not be used afterwards.
+func (s *Service) Close() {
+	s.analytics.Stop()
+	s.clicks.Stop()
+}
+
+// discardClicks is the click repository of a Service without Options.Clicks.
+type discardClicks struct{}
+
+func (discardClicks) InitSchema() error                         { return nil }
+func (discardClicks) RecordClick(shortner.Click) (int64, error) { return 0, nil }
+func (discardClicks) ListSince(int64, int) ([]shortner.Click, error) {
+	return nil, nil
+}
+func (discardClicks) ListForLink(string, int64, int) ([]shortner.Click, error) {
+	return nil, nil
+}
+func (discardClicks) ListBetween([]string, time.Time, time.Time, int64, int) ([]shortner.Click, error) {
+	return nil, nil
+}
+func (discardClicks) TopLinks([]string, time.Time, time.Time, int) ([]shortner.LinkClicks, int64, error) {
+	return nil, 0, nil
+}
+func (discardClicks) CountPerPeriod([]string, time.Time, time.Time, string) ([]shortner.PeriodClicks, error) {
+	return nil, nil
+}